@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// assertion is one declarative check of assert_state. Type selects the
+// check, the other fields are its parameters; router and interfaces accept
+// name globs.
+type assertion struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	Router   string `json:"router"`
+	VRF      string `json:"vrf"`
+	Neighbor string `json:"neighbor"`
+
+	VNI   int      `json:"vni"`
+	VTEPs []string `json:"vteps"`
+
+	Interfaces    string `json:"interfaces"`
+	WindowSeconds int    `json:"window_seconds"`
+	MaxDrops      uint64 `json:"max_drops"`
+
+	Prefix string `json:"prefix"`
+
+	AFI string `json:"afi"`
+	Min int    `json:"min"`
+	Max int    `json:"max"`
+}
+
+// assertionChecks evaluate an assertion, returning whether it holds and the
+// evidence either way.
+var assertionChecks = map[string]func(*assertionRun, *assertion) (bool, []string, error){
+	"bgp_established": (*assertionRun).bgpEstablished,
+	"evpn_type3":      (*assertionRun).evpnType3,
+	"no_drops":        (*assertionRun).noDrops,
+	"route_present":   (*assertionRun).routePresent,
+	"route_count":     (*assertionRun).routeCount,
+}
+
+// maxWindowSeconds bounds the counter sampling window of no_drops.
+const maxWindowSeconds = 300
+
+func (a *assertion) validate() error {
+	if _, ok := assertionChecks[a.Type]; !ok {
+		types := make([]string, 0, len(assertionChecks))
+		for t := range assertionChecks {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return fmt.Errorf("unknown type %q, expected one of %s", a.Type, strings.Join(types, ", "))
+	}
+	switch a.Type {
+	case "evpn_type3":
+		if a.VNI == 0 {
+			return fmt.Errorf("vni is required")
+		}
+	case "no_drops":
+		if a.WindowSeconds < 0 || a.WindowSeconds > maxWindowSeconds {
+			return fmt.Errorf("window_seconds must be between 0 and %d", maxWindowSeconds)
+		}
+	case "route_present":
+		if a.Prefix == "" {
+			return fmt.Errorf("prefix is required")
+		}
+	case "route_count":
+		w := a.watermark()
+		if w.Router == "" || (w.VRF == "") == (w.VNI == 0) {
+			return fmt.Errorf("router and exactly one of vrf or vni are required")
+		}
+	}
+	if _, err := path.Match(a.Router, ""); err != nil {
+		return fmt.Errorf("invalid router glob %q", a.Router)
+	}
+	if _, err := path.Match(a.Interfaces, ""); err != nil {
+		return fmt.Errorf("invalid interfaces glob %q", a.Interfaces)
+	}
+	return nil
+}
+
+func (a *assertion) watermark() *RouteWatermark {
+	return &RouteWatermark{Router: a.Router, VRF: a.VRF, VNI: a.VNI, AFI: a.AFI, Min: a.Min, Max: a.Max}
+}
+
+// title names an assertion in the report.
+func (a *assertion) title() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	var params []string
+	for _, p := range []struct{ key, value string }{
+		{"router", a.Router}, {"vrf", a.VRF}, {"neighbor", a.Neighbor}, {"prefix", a.Prefix}, {"interfaces", a.Interfaces},
+	} {
+		if p.value != "" {
+			params = append(params, p.key+"="+p.value)
+		}
+	}
+	if a.VNI != 0 {
+		params = append(params, fmt.Sprintf("vni=%d", a.VNI))
+	}
+	if len(params) == 0 {
+		return a.Type
+	}
+	return a.Type + " " + strings.Join(params, " ")
+}
+
+// assertionRun holds what the assertions of one assert_state call share.
+type assertionRun struct {
+	once    sync.Once
+	routers []string
+	err     error
+}
+
+// matchRouters returns the fabric routers whose full or short name matches
+// the glob, every router when it is empty.
+func (r *assertionRun) matchRouters(glob string) ([]string, error) {
+	r.once.Do(func() { r.routers, r.err = fabricRouters() })
+	if r.err != nil {
+		return nil, r.err
+	}
+	if glob == "" {
+		glob = "*"
+	}
+	matched := matchRouters(r.routers, glob)
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no router matches %q", glob)
+	}
+	return matched, nil
+}
+
+func (r *assertionRun) bgpEstablished(a *assertion) (bool, []string, error) {
+	routers, err := r.matchRouters(a.Router)
+	if err != nil {
+		return false, nil, err
+	}
+	var evidence []string
+	total, down := 0, 0
+	for _, router := range routers {
+		sessions, err := bgpSessions(router)
+		if err != nil {
+			return false, evidence, err
+		}
+		// A neighbor is listed once per address family.
+		seen := make(map[string]bool)
+		for _, p := range sessions {
+			if (a.VRF != "" && p.VRF != a.VRF) || (a.Neighbor != "" && p.Neighbor != a.Neighbor) {
+				continue
+			}
+			key := p.VRF + "/" + p.Neighbor
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			total++
+			if p.State != "Established" {
+				down++
+				evidence = append(evidence, fmt.Sprintf("%s vrf %s neighbor %s: %s", router, p.VRF, p.Neighbor, p.State))
+			}
+		}
+	}
+	if total == 0 {
+		return false, []string{"no matching BGP session found"}, nil
+	}
+	if down == 0 {
+		evidence = append(evidence, fmt.Sprintf("%d session(s) on %d router(s) Established", total, len(routers)))
+	}
+	return down == 0, evidence, nil
+}
+
+func (r *assertionRun) evpnType3(a *assertion) (bool, []string, error) {
+	routers, err := r.matchRouters(a.Router)
+	if err != nil {
+		return false, nil, err
+	}
+	seen := make(map[string][]string, len(routers))
+	expected := make(map[string]bool)
+	for _, v := range a.VTEPs {
+		expected[v] = true
+	}
+	for _, router := range routers {
+		routes, err := frrClient(router).EVPNRoutes(fmt.Sprintf("show bgp l2vpn evpn route vni %d type multicast", a.VNI))
+		if err != nil {
+			return false, nil, err
+		}
+		var prefixes []string
+		for _, r := range routes {
+			if strings.HasPrefix(r.Prefix, "[3]") {
+				prefixes = append(prefixes, r.Prefix)
+			}
+		}
+		seen[router] = originators(prefixes)
+		if len(a.VTEPs) == 0 {
+			for _, v := range seen[router] {
+				expected[v] = true
+			}
+		}
+	}
+
+	vteps := make([]string, 0, len(expected))
+	for v := range expected {
+		vteps = append(vteps, v)
+	}
+	sort.Strings(vteps)
+	if len(vteps) == 0 {
+		return false, []string{fmt.Sprintf("no type-3 route for VNI %d on any router", a.VNI)}, nil
+	}
+
+	var evidence []string
+	for _, router := range routers {
+		var missing []string
+		for _, v := range vteps {
+			if !containsString(seen[router], v) {
+				missing = append(missing, v)
+			}
+		}
+		if len(missing) > 0 {
+			evidence = append(evidence, fmt.Sprintf("%s has no type-3 route for VNI %d from %s", router, a.VNI, strings.Join(missing, ", ")))
+		}
+	}
+	if len(evidence) > 0 {
+		return false, evidence, nil
+	}
+	return true, []string{fmt.Sprintf("%d router(s) have type-3 routes for VNI %d from %s", len(routers), a.VNI, strings.Join(vteps, ", "))}, nil
+}
+
+// dropCounters returns the receive and transmit drop counters of the
+// interfaces of a router matching the glob.
+func dropCounters(router, glob string) (map[string]uint64, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "-s", "link", "show")
+	if err != nil {
+		return nil, err
+	}
+	var links []struct {
+		Ifname  string `json:"ifname"`
+		Stats64 struct {
+			RX struct {
+				Dropped uint64 `json:"dropped"`
+			} `json:"rx"`
+			TX struct {
+				Dropped uint64 `json:"dropped"`
+			} `json:"tx"`
+		} `json:"stats64"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("parsing link statistics of %s: %w", router, err)
+	}
+	drops := make(map[string]uint64)
+	for _, l := range links {
+		if ok, _ := path.Match(glob, l.Ifname); ok && l.Ifname != "lo" {
+			drops[l.Ifname] = l.Stats64.RX.Dropped + l.Stats64.TX.Dropped
+		}
+	}
+	return drops, nil
+}
+
+func (r *assertionRun) noDrops(a *assertion) (bool, []string, error) {
+	routers, err := r.matchRouters(a.Router)
+	if err != nil {
+		return false, nil, err
+	}
+	glob := a.Interfaces
+	if glob == "" {
+		glob = "*"
+	}
+
+	before := make(map[string]map[string]uint64, len(routers))
+	if a.WindowSeconds > 0 {
+		for _, router := range routers {
+			if before[router], err = dropCounters(router, glob); err != nil {
+				return false, nil, err
+			}
+		}
+		time.Sleep(time.Duration(a.WindowSeconds) * time.Second)
+	}
+
+	var evidence []string
+	links := 0
+	for _, router := range routers {
+		after, err := dropCounters(router, glob)
+		if err != nil {
+			return false, evidence, err
+		}
+		names := make([]string, 0, len(after))
+		for name := range after {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			links++
+			drops := after[name]
+			if b, ok := before[router][name]; ok && drops >= b {
+				drops -= b
+			}
+			if drops > a.MaxDrops {
+				evidence = append(evidence, fmt.Sprintf("%s %s: %d dropped packets", router, name, drops))
+			}
+		}
+	}
+	if links == 0 {
+		return false, []string{fmt.Sprintf("no interface matches %q", glob)}, nil
+	}
+	if len(evidence) > 0 {
+		return false, evidence, nil
+	}
+	scope := "since the interfaces came up"
+	if a.WindowSeconds > 0 {
+		scope = fmt.Sprintf("over %ds", a.WindowSeconds)
+	}
+	return true, []string{fmt.Sprintf("%d interface(s) with at most %d dropped packets %s", links, a.MaxDrops, scope)}, nil
+}
+
+func (r *assertionRun) routePresent(a *assertion) (bool, []string, error) {
+	routers, err := r.matchRouters(a.Router)
+	if err != nil {
+		return false, nil, err
+	}
+	vrf := a.VRF
+	if vrf == "" {
+		vrf = "default"
+	}
+	family := "ip"
+	if strings.Contains(a.Prefix, ":") {
+		family = "ipv6"
+	}
+
+	var evidence []string
+	for _, router := range routers {
+		prefixes, err := frrClient(router).Route(family, vrf, a.Prefix)
+		if err != nil {
+			return false, evidence, err
+		}
+		installed := false
+		for prefix, routes := range prefixes {
+			for _, rt := range routes {
+				if rt.Selected && rt.Installed {
+					installed = true
+					evidence = append(evidence, fmt.Sprintf("%s vrf %s: %s via %s", router, vrf, prefix, rt.Protocol))
+				}
+			}
+		}
+		if !installed {
+			return false, []string{fmt.Sprintf("%s vrf %s: no installed route for %s", router, vrf, a.Prefix)}, nil
+		}
+	}
+	return true, evidence, nil
+}
+
+func (r *assertionRun) routeCount(a *assertion) (bool, []string, error) {
+	w := a.watermark()
+	count, err := w.routeCount()
+	if err != nil {
+		return false, nil, err
+	}
+	evidence := []string{fmt.Sprintf("%s: %d routes, expected %s", w, count, w.bounds())}
+	return count >= w.Min && (w.Max == 0 || count <= w.Max), evidence, nil
+}
+
+func (s *MCPServer) assertState(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	raw, err := json.Marshal(args["assertions"])
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid assertions: %v", err))
+	}
+	var assertions []assertion
+	if err := json.Unmarshal(raw, &assertions); err != nil || len(assertions) == 0 {
+		return toolError("assertions must be a non-empty array of objects with a type")
+	}
+	for i := range assertions {
+		if err := assertions[i].validate(); err != nil {
+			return toolError(fmt.Sprintf("assertions[%d]: %v", i, err))
+		}
+	}
+
+	run := &assertionRun{}
+	results := newTable("assertions", "index", "name", "type", "status", "evidence")
+	var b strings.Builder
+	failed := 0
+	for i := range assertions {
+		a := &assertions[i]
+		passed, evidence, err := assertionChecks[a.Type](run, a)
+		status := "pass"
+		if err != nil {
+			evidence = append(evidence, "error: "+err.Error())
+			passed = false
+		}
+		if !passed {
+			status = "fail"
+			failed++
+		}
+		results.add(i, a.title(), a.Type, status, evidence)
+
+		mark := "✓"
+		if !passed {
+			mark = "✗"
+		}
+		fmt.Fprintf(&b, "%s %s\n", mark, a.title())
+		for _, e := range evidence {
+			fmt.Fprintf(&b, "    %s\n", e)
+		}
+	}
+
+	verdict := "PASS"
+	if failed > 0 {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(&b, "\n%s: %d of %d assertion(s) passed\n", verdict, len(assertions)-failed, len(assertions))
+
+	var fields record
+	fields.add("result", strings.ToLower(verdict))
+	fields.add("passed", len(assertions)-failed)
+	fields.add("failed", failed)
+	return formattedResult(format, b.String(), failed > 0, fields, results)
+}
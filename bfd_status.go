@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// bfdPeer is a BFD session as reported by 'show bfd peers json'. Intervals
+// are in milliseconds, uptime and downtime in seconds.
+type bfdPeer struct {
+	Peer                   string `json:"peer"`
+	Local                  string `json:"local"`
+	VRF                    string `json:"vrf"`
+	Interface              string `json:"interface"`
+	Multihop               bool   `json:"multihop"`
+	Status                 string `json:"status"`
+	Uptime                 int64  `json:"uptime"`
+	Downtime               int64  `json:"downtime"`
+	Diagnostic             string `json:"diagnostic"`
+	RemoteDiagnostic       string `json:"remote-diagnostic"`
+	ReceiveInterval        int64  `json:"receive-interval"`
+	TransmitInterval       int64  `json:"transmit-interval"`
+	DetectMultiplier       int64  `json:"detect-multiplier"`
+	RemoteReceiveInterval  int64  `json:"remote-receive-interval"`
+	RemoteTransmitInterval int64  `json:"remote-transmit-interval"`
+	RemoteDetectMultiplier int64  `json:"remote-detect-multiplier"`
+}
+
+// key identifies a session across 'show bfd peers json' and 'show bfd peers
+// counters json'.
+func (p *bfdPeer) key() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%t", p.VRF, p.Peer, p.Local, p.Interface, p.Multihop)
+}
+
+// detectTime returns the time without control packets after which the
+// router declares the session down: the multiplier the peer advertises
+// times the interval it actually transmits at, the slower of the one it
+// desires and the one this router requires.
+func (p *bfdPeer) detectTime() int64 {
+	return p.RemoteDetectMultiplier * max(p.ReceiveInterval, p.RemoteTransmitInterval)
+}
+
+// bfdCounters are the counters of a BFD session, from 'show bfd peers
+// counters json'.
+type bfdCounters struct {
+	bfdPeer
+	ControlPacketInput  int64 `json:"control-packet-input"`
+	ControlPacketOutput int64 `json:"control-packet-output"`
+	SessionUpEvents     int64 `json:"session-up-event"`
+	SessionDownEvents   int64 `json:"session-down-event"`
+}
+
+// bfdPeers returns the BFD sessions of a router, with their counters when
+// the router reports them.
+func bfdPeers(router string) ([]bfdPeer, map[string]bfdCounters, error) {
+	client := frrClient(router)
+	peers, err := frr.QueryList[bfdPeer](client, "show bfd peers")
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].key() < peers[j].key() })
+
+	counters := make(map[string]bfdCounters)
+	if list, err := frr.QueryList[bfdCounters](client, "show bfd peers counters"); err == nil {
+		for _, c := range list {
+			counters[c.key()] = c
+		}
+	}
+	return peers, counters, nil
+}
+
+func (s *MCPServer) getBFDStatus(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	downOnly, _ := args["down_only"].(bool)
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	table := newTable("peers", "router", "vrf", "peer", "local", "interface", "multihop", "status", "uptime", "downtime",
+		"diagnostic", "remote_diagnostic", "rx_interval_ms", "tx_interval_ms", "detect_multiplier", "detect_time_ms",
+		"up_events", "down_events")
+	total, up, flapped, failed := 0, 0, 0, 0
+	for _, router := range routers {
+		peers, counters, err := bfdPeers(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		var lines []string
+		for _, p := range peers {
+			total++
+			isUp := p.Status == "up"
+			if isUp {
+				up++
+			}
+			c, hasCounters := counters[p.key()]
+			if c.SessionDownEvents > 0 {
+				flapped++
+			}
+			if downOnly && isUp {
+				continue
+			}
+			uptime, downtime := "", ""
+			if isUp {
+				uptime = (time.Duration(p.Uptime) * time.Second).String()
+			} else if p.Downtime > 0 {
+				downtime = (time.Duration(p.Downtime) * time.Second).String()
+			}
+			table.add(router, p.VRF, p.Peer, p.Local, p.Interface, p.Multihop, p.Status, uptime, downtime,
+				p.Diagnostic, p.RemoteDiagnostic, p.ReceiveInterval, p.TransmitInterval, p.DetectMultiplier, p.detectTime(),
+				c.SessionUpEvents, c.SessionDownEvents)
+
+			mark := "✓"
+			if !isUp {
+				mark = "✗"
+			}
+			peer := p.Peer
+			if p.Interface != "" {
+				peer += "%" + p.Interface
+			}
+			if p.Multihop {
+				peer += " (multihop)"
+			}
+			line := fmt.Sprintf("  %s %-10s %-30s %-6s", mark, p.VRF, peer, p.Status)
+			if isUp {
+				line += " up " + uptime
+			} else {
+				if downtime != "" {
+					line += " down " + downtime
+				}
+				if p.Diagnostic != "" && p.Diagnostic != "ok" {
+					line += ", diagnostic " + p.Diagnostic
+				}
+				if p.RemoteDiagnostic != "" && p.RemoteDiagnostic != "ok" {
+					line += ", remote diagnostic " + p.RemoteDiagnostic
+				}
+			}
+			line += fmt.Sprintf(", rx/tx %d/%d ms x%d, detect %s", p.ReceiveInterval, p.TransmitInterval, p.DetectMultiplier, msecs(p.detectTime()))
+			if hasCounters {
+				line += fmt.Sprintf(", %d up / %d down event(s)", c.SessionUpEvents, c.SessionDownEvents)
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+	}
+
+	summary := fmt.Sprintf("%d of %d BFD session(s) up on %d router(s)", up, total, len(routers)-failed)
+	if flapped > 0 {
+		summary += fmt.Sprintf(", %d went down at least once", flapped)
+	}
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if total == 0 && failed < len(routers) {
+		text += "\nNo BFD session is configured on the routers queried\n"
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("total", total)
+	fields.add("up", up)
+	fields.add("flapped", flapped)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
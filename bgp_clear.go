@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxClearWaitSeconds bounds how long clear_bgp_session waits for a hard
+// cleared session to come back.
+const maxClearWaitSeconds = 300
+
+// clearModes are the ways clear_bgp_session resets a session: a route
+// refresh in both directions or one, or tearing the TCP session down.
+var clearModes = []string{"soft", "soft-in", "soft-out", "hard"}
+
+// acceptedPrefixes returns the prefixes a neighbor has accepted, summed
+// over its address families.
+func (n *bgpNeighborDetail) acceptedPrefixes() int64 {
+	var total int64
+	for _, af := range n.AddressFamilies {
+		if v, ok := af["acceptedPrefixCounter"].(float64); ok {
+			total += int64(v)
+		}
+	}
+	return total
+}
+
+func (s *MCPServer) clearBGPSession(sessionID string, args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	neighbor, _ := args["neighbor"].(string)
+	if router == "" || neighbor == "" {
+		return toolError("router and neighbor are required")
+	}
+	// Only one session is cleared at a time: "*" and peer groups would
+	// reset many.
+	if strings.ContainsAny(neighbor, " \t\n;*") {
+		return toolError(fmt.Sprintf("invalid neighbor %q: give the address or interface of a single neighbor", neighbor))
+	}
+	vrf, _ := args["vrf"].(string)
+	if vrf == "" {
+		vrf = "default"
+	}
+	if strings.ContainsAny(vrf, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid vrf %q", vrf))
+	}
+	mode, _ := args["mode"].(string)
+	if mode == "" {
+		mode = "soft"
+	}
+	if !containsString(clearModes, mode) {
+		return toolError(fmt.Sprintf("invalid mode %q, expected one of %s", mode, strings.Join(clearModes, ", ")))
+	}
+	confirm, _ := args["confirm"].(bool)
+	wait := 0
+	if v, ok := args["wait_seconds"].(float64); ok {
+		if v < 0 || v > maxClearWaitSeconds {
+			return toolError(fmt.Sprintf("wait_seconds must be between 0 and %d", maxClearWaitSeconds))
+		}
+		wait = int(v)
+	}
+
+	before, err := bgpNeighbor(router, vrf, neighbor)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	container := routerContainer(router)
+	command := fmt.Sprintf("clear bgp vrf %s %s", vrf, neighbor)
+	impact := "the session stays up, the routes are refreshed"
+	switch mode {
+	case "soft":
+		command += " soft"
+	case "soft-in":
+		command += " soft in"
+		impact = "the session stays up, the neighbor is asked to resend its routes"
+	case "soft-out":
+		command += " soft out"
+		impact = "the session stays up, the routes are resent to the neighbor"
+	case "hard":
+		impact = fmt.Sprintf("the TCP session is torn down and the %d prefix(es) accepted from the neighbor are withdrawn until it is re-established", before.acceptedPrefixes())
+	}
+	current := before.State
+	if before.State == "Established" {
+		current += " for " + msecs(before.UpMsec)
+	}
+
+	var fields record
+	fields.add("router", container)
+	fields.add("vrf", vrf)
+	fields.add("neighbor", neighbor)
+	fields.add("mode", mode)
+	fields.add("command", command)
+	fields.add("state_before", before.State)
+
+	// The user approves the clear through an elicitation when the client
+	// supports it, whatever confirm says. Otherwise, without confirm, the
+	// call only describes what clearing would do, so the user can approve
+	// it before anything is disrupted.
+	if s.canElicit(sessionID) {
+		action, err := s.confirm(sessionID, fmt.Sprintf("Clear (%s) the BGP session with %s on %s (vrf %s, AS %d), currently %s? '%s': %s.",
+			mode, neighbor, container, vrf, before.RemoteAs, current, command, impact))
+		if err != nil {
+			return toolError(fmt.Sprintf("Error asking for confirmation: %v", err))
+		}
+		fields.add("confirmation", action)
+		if action != "accept" {
+			fields.add("cleared", false)
+			return formattedResult(format, fmt.Sprintf("Not cleared: the user did not approve clearing the session with %s on %s (%s).\n", neighbor, container, action), false, fields)
+		}
+	} else if !confirm {
+		text := fmt.Sprintf("Not cleared: confirmation required.\n\n"+
+			"'%s' on %s would clear (%s) the BGP session with %s (vrf %s, AS %d), currently %s: %s.\n\n"+
+			"Call clear_bgp_session again with confirm set to true to proceed.\n",
+			command, container, mode, neighbor, vrf, before.RemoteAs, current, impact)
+		fields.add("cleared", false)
+		return formattedResult(format, text, false, fields)
+	}
+
+	fmt.Fprintf(os.Stderr, "Clearing BGP session: '%s' on %s\n", command, container)
+	if _, err := runVtysh(router, command); err != nil {
+		return toolError(fmt.Sprintf("Error clearing the session with %s on %s: %v", neighbor, container, err))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Ran '%s' on %s: %s.\n", command, container, impact)
+	fmt.Fprintf(&b, "  before: %s\n", current)
+	fields.add("cleared", true)
+
+	// A hard cleared session is back once it is Established over a new
+	// connection.
+	isError := false
+	if mode == "hard" && wait > 0 {
+		start := time.Now()
+		deadline := start.Add(time.Duration(wait) * time.Second)
+		var after *bgpNeighborDetail
+		for time.Now().Before(deadline) {
+			time.Sleep(time.Second)
+			if after, err = bgpNeighbor(router, vrf, neighbor); err == nil &&
+				after.State == "Established" && after.ConnectionsUp > before.ConnectionsUp {
+				break
+			}
+			after = nil
+		}
+		if after != nil {
+			took := time.Since(start).Truncate(100 * time.Millisecond)
+			fmt.Fprintf(&b, "  after: Established again in %s\n", took)
+			fields.add("reestablished_after", took.String())
+		} else {
+			fmt.Fprintf(&b, "  after: ✗ not Established again within %ds\n", wait)
+			fields.add("reestablished_after", "")
+			isError = true
+		}
+	} else if after, err := bgpNeighbor(router, vrf, neighbor); err == nil {
+		fmt.Fprintf(&b, "  now: %s\n", after.State)
+		fields.add("state_after", after.State)
+	}
+	return formattedResult(format, b.String(), isError, fields)
+}
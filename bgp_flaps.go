@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultFlapLimit bounds the sessions get_bgp_flaps lists, when not given.
+const defaultFlapLimit = 20
+
+// recentResetWindow is how recent a reset of a session that is up again is
+// flagged.
+const recentResetWindow = time.Hour
+
+// neighborCounters is a BGP neighbor of a router with its counters, as
+// 'show bgp vrf all neighbors json' reports it.
+type neighborCounters struct {
+	router   string
+	vrf      string
+	neighbor string
+	bgpNeighborDetail
+}
+
+// lastReason returns why the session was last reset, with the NOTIFICATION
+// that reset it when one did.
+func (s *neighborCounters) lastReason() string {
+	reason := s.LastResetDueTo
+	if s.LastNotification != "" && !strings.Contains(reason, s.LastNotification) {
+		reason = strings.TrimSpace(reason + " (" + s.LastNotification + ")")
+	}
+	if s.LastShutdownText != "" {
+		reason += ": " + s.LastShutdownText
+	}
+	return reason
+}
+
+// neighborCountersOf returns the BGP neighbors of every VRF of a router.
+func neighborCountersOf(router string) ([]*neighborCounters, error) {
+	neighbors, err := frrClient(router).BGPNeighbors()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*neighborCounters, 0, len(neighbors))
+	for _, n := range neighbors {
+		sessions = append(sessions, &neighborCounters{router: router, vrf: n.VRF, neighbor: n.Address, bgpNeighborDetail: bgpNeighborDetail{n.Neighbor}})
+	}
+	return sessions, nil
+}
+
+func (s *MCPServer) getBGPFlaps(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	vrf, _ := args["vrf"].(string)
+	includeStable, _ := args["include_stable"].(bool)
+	limit := defaultFlapLimit
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	var sessions []*neighborCounters
+	// bgpdUptime is how long the counters of each router have been
+	// counting: they start over when bgpd restarts.
+	bgpdUptime := make(map[string]time.Duration)
+	failed := 0
+	for _, router := range routers {
+		rs, err := neighborCountersOf(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		for _, s := range rs {
+			if vrf == "" || s.vrf == vrf {
+				sessions = append(sessions, s)
+			}
+		}
+		if processes, err := frrDaemonProcesses(router); err == nil {
+			if d, ok := processes["bgpd"]; ok && d.running {
+				bgpdUptime[router] = d.uptime
+			}
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		x, y := sessions[i], sessions[j]
+		if x.ConnectionsDown != y.ConnectionsDown {
+			return x.ConnectionsDown > y.ConnectionsDown
+		}
+		if x.router != y.router {
+			return x.router < y.router
+		}
+		if x.vrf != y.vrf {
+			return x.vrf < y.vrf
+		}
+		return x.neighbor < y.neighbor
+	})
+
+	table := newTable("sessions", "router", "vrf", "neighbor", "remote_as", "state", "established", "dropped", "flaps_per_hour", "uptime", "last_reset_ago", "last_reset_reason")
+	var findings []string
+	flapping, drops, shown := 0, 0, 0
+	var lines []string
+	for _, s := range sessions {
+		if s.ConnectionsDown > 0 {
+			flapping++
+			drops += s.ConnectionsDown
+		}
+		name := s.neighbor
+		if s.Hostname != "" {
+			name += " (" + s.Hostname + ")"
+		}
+		where := fmt.Sprintf("%s vrf %s %s", s.router, s.vrf, name)
+		lastReset := ""
+		if s.LastResetMsecAgo > 0 {
+			lastReset = msecs(s.LastResetMsecAgo - s.LastResetMsecAgo%1000)
+		}
+		switch {
+		case s.State != "Established" && !s.AdminShutdown:
+			finding := fmt.Sprintf("%s is %s", where, s.State)
+			if reason := s.lastReason(); reason != "" && s.ConnectionsUp > 0 {
+				finding += ", last reset: " + reason
+			}
+			findings = append(findings, finding)
+		case s.ConnectionsDown > 0 && s.LastResetMsecAgo > 0 && time.Duration(s.LastResetMsecAgo)*time.Millisecond < recentResetWindow:
+			findings = append(findings, fmt.Sprintf("%s is up again but was reset %s ago: %s", where, lastReset, s.lastReason()))
+		}
+		if s.ConnectionsDown == 0 && !includeStable || shown >= limit {
+			continue
+		}
+		shown++
+
+		rate := 0.0
+		if up := bgpdUptime[s.router]; up > 0 {
+			rate = float64(s.ConnectionsDown) / up.Hours()
+		}
+		uptime := ""
+		if s.State == "Established" {
+			uptime = msecs(s.UpMsec - s.UpMsec%1000)
+		}
+		table.add(s.router, s.vrf, s.neighbor, s.RemoteAs, s.State, s.ConnectionsUp, s.ConnectionsDown, rate, uptime, lastReset, s.lastReason())
+
+		mark := "✓"
+		if s.ConnectionsDown > 0 || s.State != "Established" {
+			mark = "✗"
+		}
+		line := fmt.Sprintf("  %s %-48s %3d drop(s) / %3d established", mark, where, s.ConnectionsDown, s.ConnectionsUp)
+		if rate > 0 {
+			line += fmt.Sprintf(", %.2f/h", rate)
+		}
+		if uptime != "" {
+			line += ", up " + uptime
+		} else {
+			line += ", " + s.State
+		}
+		if lastReset != "" {
+			line += fmt.Sprintf(", last reset %s ago", lastReset)
+			if reason := s.lastReason(); reason != "" {
+				line += ": " + reason
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	summary := fmt.Sprintf("%d BGP session(s) on %d router(s), %d dropped at least once, %d drop(s) in total", len(sessions), len(routers)-failed, flapping, drops)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(lines) > 0 {
+		text += "\n" + strings.Join(lines, "\n") + "\n"
+		listed := flapping
+		if includeStable {
+			listed = len(sessions)
+		}
+		if shown < listed {
+			text += fmt.Sprintf("  ... only the first %d shown, raise limit to see more\n", shown)
+		}
+	} else if len(sessions) > 0 {
+		text += "\n✓ No session dropped since bgpd started\n"
+	}
+	if len(bgpdUptime) > 0 {
+		names := make([]string, 0, len(bgpdUptime))
+		for r := range bgpdUptime {
+			names = append(names, r)
+		}
+		sort.Strings(names)
+		var ups []string
+		for _, r := range names {
+			ups = append(ups, fmt.Sprintf("%s %s", r, bgpdUptime[r]))
+		}
+		text += "\nCounters count since bgpd started: " + strings.Join(ups, ", ") + "\n"
+	}
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("sessions", len(sessions))
+	fields.add("flapping", flapping)
+	fields.add("drops", drops)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
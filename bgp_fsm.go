@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fsmEvent is a single step in the life of a BGP session, either a state
+// transition reported by bgpd or a message observed on the wire.
+type fsmEvent struct {
+	Time   time.Time
+	Source string
+	From   string
+	To     string
+	Kind   string
+	Detail string
+}
+
+var (
+	fsmTransitionRe = regexp.MustCompile(`(\S+) went from (\w+) to (\w+)`)
+	fsmAdjChangeRe  = regexp.MustCompile(`%ADJCHANGE: neighbor (\S+?)(?:\(\S*\))?(?: in vrf \S+)? (Up|Down)(.*)`)
+	fsmNotifyRe     = regexp.MustCompile(`%NOTIFICATION(?:\(\w+\))?: (sent to|received from) neighbor (\S+?)(?:\(\S*\))? (\d+/\d+ \([^)]*\))`)
+)
+
+var bgpMessageTypes = map[string]string{
+	"1": "OPEN",
+	"2": "UPDATE",
+	"3": "NOTIFICATION",
+	"4": "KEEPALIVE",
+	"5": "ROUTE-REFRESH",
+}
+
+// parseTimeArg accepts either an RFC3339 timestamp or a duration relative to
+// now (e.g. "15m").
+func parseTimeArg(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC3339 or a duration like 15m", value)
+	}
+	return t, nil
+}
+
+func isKindNode(container string) bool {
+	return strings.HasSuffix(container, "-control-plane") || strings.Contains(container, "-worker")
+}
+
+// fetchRouterLogs returns timestamped bgpd log lines for a router. For
+// containerlab routers the container logs are used; for kind nodes the logs
+// of the FRR container running in the router pod are read through crictl.
+func fetchRouterLogs(router string, since time.Time) (string, error) {
+	router = routerContainer(router)
+	sinceArg := since.UTC().Format(time.RFC3339)
+	if !isKindNode(router) {
+		out, err := exec.Command("docker", "logs", "--timestamps", "--since", sinceArg, router).CombinedOutput()
+		return string(out), err
+	}
+
+	id, err := frrContainerID(router)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("docker", "exec", router, "crictl", "logs", "--timestamps", "--since", sinceArg, id).CombinedOutput()
+	return string(out), err
+}
+
+func parseFSMLogEvents(logs, neighbor string, since, until time.Time) []fsmEvent {
+	var events []fsmEvent
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		line := scanner.Text()
+		stamp, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil || t.Before(since) || t.After(until) {
+			continue
+		}
+
+		if m := fsmTransitionRe.FindStringSubmatch(rest); m != nil && m[1] == neighbor {
+			events = append(events, fsmEvent{Time: t, Source: "log", Kind: "transition", From: m[2], To: m[3]})
+		} else if m := fsmAdjChangeRe.FindStringSubmatch(rest); m != nil && m[1] == neighbor {
+			events = append(events, fsmEvent{Time: t, Source: "log", Kind: "adjchange", To: m[2], Detail: strings.TrimSpace(m[3])})
+		} else if m := fsmNotifyRe.FindStringSubmatch(rest); m != nil && m[2] == neighbor {
+			kind := "notification-sent"
+			if m[1] == "received from" {
+				kind = "notification-received"
+			}
+			events = append(events, fsmEvent{Time: t, Source: "log", Kind: kind, Detail: m[3]})
+		}
+	}
+	return events
+}
+
+// parseFSMCaptureEvents extracts the TCP handshake/teardown and the BGP
+// messages exchanged with the neighbor from a pcap using tshark.
+func parseFSMCaptureEvents(captureFile, neighbor string, since, until time.Time) ([]fsmEvent, error) {
+	filter := fmt.Sprintf("ip.addr==%s && tcp.port==179 && (bgp || tcp.flags.syn==1 || tcp.flags.fin==1 || tcp.flags.reset==1)", neighbor)
+	out, err := exec.Command("tshark", "-r", captureFile, "-Y", filter, "-T", "fields",
+		"-E", "separator=|", "-e", "frame.time_epoch", "-e", "ip.src",
+		"-e", "tcp.flags.syn", "-e", "tcp.flags.ack", "-e", "tcp.flags.fin", "-e", "tcp.flags.reset", "-e", "bgp.type").Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s with tshark: %w", captureFile, err)
+	}
+
+	var events []fsmEvent
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 7 {
+			continue
+		}
+		epoch, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		t := time.Unix(0, int64(epoch*float64(time.Second)))
+		if t.Before(since) || t.After(until) {
+			continue
+		}
+
+		kind := "sent"
+		if fields[1] == neighbor {
+			kind = "received"
+		}
+
+		var names []string
+		for _, typ := range strings.Split(fields[6], ",") {
+			if name, ok := bgpMessageTypes[typ]; ok {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			var flags []string
+			for i, flag := range []string{"SYN", "ACK", "FIN", "RST"} {
+				if isTsharkTrue(fields[2+i]) {
+					flags = append(flags, flag)
+				}
+			}
+			names = append(names, "TCP "+strings.Join(flags, "/"))
+		}
+		events = append(events, fsmEvent{Time: t, Source: "capture", Kind: kind, Detail: strings.Join(names, ", ")})
+	}
+	return events, nil
+}
+
+// isTsharkTrue handles both the numeric and the textual boolean rendering
+// used by different tshark versions.
+func isTsharkTrue(value string) bool {
+	return value == "1" || strings.EqualFold(value, "true")
+}
+
+func renderFSMSequence(router, neighbor string, events []fsmEvent) string {
+	var b strings.Builder
+	b.WriteString("sequenceDiagram\n")
+	fmt.Fprintf(&b, "    participant R as %s\n", router)
+	fmt.Fprintf(&b, "    participant N as %s\n", neighbor)
+
+	for _, e := range events {
+		stamp := e.Time.UTC().Format("15:04:05.000")
+		switch e.Kind {
+		case "transition":
+			fmt.Fprintf(&b, "    Note over R: %s %s → %s\n", stamp, e.From, e.To)
+		case "adjchange":
+			fmt.Fprintf(&b, "    Note over R,N: %s session %s %s\n", stamp, e.To, e.Detail)
+		case "notification-sent":
+			fmt.Fprintf(&b, "    R-xN: %s NOTIFICATION %s\n", stamp, e.Detail)
+		case "notification-received":
+			fmt.Fprintf(&b, "    N-xR: %s NOTIFICATION %s\n", stamp, e.Detail)
+		case "sent":
+			fmt.Fprintf(&b, "    R->>N: %s %s\n", stamp, e.Detail)
+		case "received":
+			fmt.Fprintf(&b, "    N->>R: %s %s\n", stamp, e.Detail)
+		}
+	}
+	return b.String()
+}
+
+func (s *MCPServer) bgpSessionFSM(args map[string]any) CallToolResult {
+	router, _ := args["router"].(string)
+	neighbor, _ := args["neighbor"].(string)
+	if router == "" || neighbor == "" {
+		return toolError("router and neighbor are required")
+	}
+
+	now := time.Now()
+	since := now.Add(-time.Hour)
+	until := now
+	if v, ok := args["since"].(string); ok && v != "" {
+		t, err := parseTimeArg(v, now)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		since = t
+	}
+	if v, ok := args["until"].(string); ok && v != "" {
+		t, err := parseTimeArg(v, now)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		until = t
+	}
+
+	var warnings []string
+	logs, err := fetchRouterLogs(router, since)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("Could not read logs from %s: %v", router, err))
+	}
+	events := parseFSMLogEvents(logs, neighbor, since, until)
+
+	if captureFile, ok := args["capture_file"].(string); ok && captureFile != "" {
+		captured, err := parseFSMCaptureEvents(captureFile, neighbor, since, until)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		}
+		events = append(events, captured...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "BGP session %s ↔ %s between %s and %s\n\n", router, neighbor,
+		since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	for _, w := range warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", w)
+	}
+
+	if len(events) == 0 {
+		b.WriteString("No FSM transitions or BGP messages found in the window. " +
+			"Enable 'debug bgp neighbor-events' on the router to log every state change.\n")
+		return CallToolResult{Content: []ContentItem{{Type: "text", Text: b.String()}}}
+	}
+
+	lastState := ""
+	var lastNotification string
+	for _, e := range events {
+		switch e.Kind {
+		case "transition":
+			lastState = e.To
+		case "adjchange":
+			if e.To == "Up" {
+				lastState = "Established"
+			}
+		case "notification-sent", "notification-received":
+			lastNotification = fmt.Sprintf("%s at %s: %s", e.Kind, e.Time.UTC().Format(time.RFC3339), e.Detail)
+		}
+	}
+	if lastState != "" {
+		fmt.Fprintf(&b, "Last known state: %s\n", lastState)
+	}
+	if lastNotification != "" {
+		fmt.Fprintf(&b, "Last notification: %s\n", lastNotification)
+	}
+
+	b.WriteString("\n```mermaid\n")
+	b.WriteString(renderFSMSequence(router, neighbor, events))
+	b.WriteString("```\n")
+
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: b.String()}}}
+}
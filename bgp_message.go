@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// BGP message types (RFC 4271).
+const (
+	bgpMsgOpen         = 1
+	bgpMsgUpdate       = 2
+	bgpMsgNotification = 3
+	bgpMsgKeepalive    = 4
+	bgpMsgRouteRefresh = 5
+)
+
+const bgpHeaderLen = 19
+
+// Address families used in the fabric.
+const (
+	afiIPv4  = 1
+	afiIPv6  = 2
+	afiL2VPN = 25
+
+	safiUnicast = 1
+	safiEVPN    = 70
+)
+
+// Path attribute type codes.
+const (
+	attrOrigin         = 1
+	attrASPath         = 2
+	attrNextHop        = 3
+	attrMED            = 4
+	attrLocalPref      = 5
+	attrCommunities    = 8
+	attrMPReach        = 14
+	attrMPUnreach      = 15
+	attrExtCommunities = 16
+)
+
+// bgpNLRI is a decoded prefix or EVPN route along with its address family.
+type bgpNLRI struct {
+	AFI    uint16 `json:"afi"`
+	SAFI   uint8  `json:"safi"`
+	Prefix string `json:"prefix"`
+	// RouteType is the EVPN route type, zero for IP prefixes.
+	RouteType int `json:"route_type,omitempty"`
+	// VNI is the label of EVPN routes, which VXLAN uses as VNI (RFC 8365).
+	VNI uint32 `json:"vni,omitempty"`
+	// NextHop is the next hop of announced routes: the NEXT_HOP attribute
+	// for IPv4 unicast, the MP_REACH_NLRI one for the other families.
+	NextHop string `json:"next_hop,omitempty"`
+}
+
+type bgpPathAttributes struct {
+	Origin         string   `json:"origin,omitempty"`
+	ASPath         []uint32 `json:"as_path,omitempty"`
+	NextHop        string   `json:"next_hop,omitempty"`
+	MED            *uint32  `json:"med,omitempty"`
+	LocalPref      *uint32  `json:"local_pref,omitempty"`
+	Communities    []string `json:"communities,omitempty"`
+	ExtCommunities []string `json:"ext_communities,omitempty"`
+}
+
+type bgpUpdate struct {
+	Withdrawn  []bgpNLRI          `json:"withdrawn,omitempty"`
+	Announced  []bgpNLRI          `json:"announced,omitempty"`
+	Attributes *bgpPathAttributes `json:"attributes,omitempty"`
+	// EndOfRIB is the family of an End-of-RIB marker (RFC 4724).
+	EndOfRIB string `json:"end_of_rib,omitempty"`
+}
+
+type bgpOpen struct {
+	Version  uint8  `json:"version"`
+	AS       uint32 `json:"as"`
+	HoldTime uint16 `json:"hold_time"`
+	RouterID string `json:"router_id"`
+	// Families are the multiprotocol capabilities advertised, as "afi/safi".
+	Families []string `json:"families,omitempty"`
+	// FourByteAS tells whether the 4-octet AS number capability is
+	// advertised (RFC 6793).
+	FourByteAS bool `json:"four_byte_as"`
+}
+
+type bgpNotification struct {
+	Code    uint8  `json:"code"`
+	Subcode uint8  `json:"subcode"`
+	Reason  string `json:"reason"`
+}
+
+var errShortBGPMessage = errors.New("truncated BGP message")
+
+var bgpNotificationCodes = map[uint8]string{
+	1: "Message Header Error",
+	2: "OPEN Message Error",
+	3: "UPDATE Message Error",
+	4: "Hold Timer Expired",
+	5: "Finite State Machine Error",
+	6: "Cease",
+	7: "ROUTE-REFRESH Message Error",
+}
+
+var bgpCeaseSubcodes = map[uint8]string{
+	1:  "Maximum Number of Prefixes Reached",
+	2:  "Administrative Shutdown",
+	3:  "Peer De-configured",
+	4:  "Administrative Reset",
+	5:  "Connection Rejected",
+	6:  "Other Configuration Change",
+	7:  "Connection Collision Resolution",
+	8:  "Out of Resources",
+	9:  "Hard Reset",
+	10: "BFD Down",
+}
+
+func familyName(afi uint16, safi uint8) string {
+	switch {
+	case afi == afiIPv4 && safi == safiUnicast:
+		return "ipv4-unicast"
+	case afi == afiIPv6 && safi == safiUnicast:
+		return "ipv6-unicast"
+	case afi == afiL2VPN && safi == safiEVPN:
+		return "l2vpn-evpn"
+	}
+	return fmt.Sprintf("%d/%d", afi, safi)
+}
+
+// parseBGPHeader returns the type and total length of the BGP message at the
+// start of data.
+func parseBGPHeader(data []byte) (msgType uint8, length int, err error) {
+	if len(data) < bgpHeaderLen {
+		return 0, 0, errShortBGPMessage
+	}
+	length = int(binary.BigEndian.Uint16(data[16:18]))
+	if length < bgpHeaderLen {
+		return 0, 0, fmt.Errorf("invalid BGP message length %d", length)
+	}
+	return data[18], length, nil
+}
+
+func parseBGPOpen(msg []byte) (*bgpOpen, error) {
+	body := msg[bgpHeaderLen:]
+	if len(body) < 10 {
+		return nil, errShortBGPMessage
+	}
+	open := &bgpOpen{
+		Version:  body[0],
+		AS:       uint32(binary.BigEndian.Uint16(body[1:3])),
+		HoldTime: binary.BigEndian.Uint16(body[3:5]),
+		RouterID: net.IP(body[5:9]).String(),
+	}
+	optLen := int(body[9])
+	opts := body[10:]
+	if len(opts) < optLen {
+		return nil, errShortBGPMessage
+	}
+	opts = opts[:optLen]
+	for len(opts) >= 2 {
+		paramType, paramLen := opts[0], int(opts[1])
+		if len(opts) < 2+paramLen {
+			break
+		}
+		if paramType == 2 {
+			caps := opts[2 : 2+paramLen]
+			for len(caps) >= 2 {
+				code, capLen := caps[0], int(caps[1])
+				if len(caps) < 2+capLen {
+					break
+				}
+				value := caps[2 : 2+capLen]
+				switch {
+				case code == 1 && capLen == 4:
+					open.Families = append(open.Families, familyName(binary.BigEndian.Uint16(value[0:2]), value[3]))
+				case code == 65 && capLen == 4:
+					open.AS = binary.BigEndian.Uint32(value)
+					open.FourByteAS = true
+				}
+				caps = caps[2+capLen:]
+			}
+		}
+		opts = opts[2+paramLen:]
+	}
+	return open, nil
+}
+
+func parseBGPNotification(msg []byte) (*bgpNotification, error) {
+	body := msg[bgpHeaderLen:]
+	if len(body) < 2 {
+		return nil, errShortBGPMessage
+	}
+	n := &bgpNotification{Code: body[0], Subcode: body[1]}
+	n.Reason = bgpNotificationCodes[n.Code]
+	if n.Code == 6 {
+		if sub, ok := bgpCeaseSubcodes[n.Subcode]; ok {
+			n.Reason += "/" + sub
+		}
+	}
+	if n.Reason == "" {
+		n.Reason = "Unknown"
+	}
+	return n, nil
+}
+
+// parseIPPrefixes decodes a sequence of length-prefixed IP prefixes.
+func parseIPPrefixes(data []byte, afi uint16, safi uint8) ([]bgpNLRI, error) {
+	size := net.IPv4len
+	if afi == afiIPv6 {
+		size = net.IPv6len
+	}
+	var prefixes []bgpNLRI
+	for len(data) > 0 {
+		bits := int(data[0])
+		n := (bits + 7) / 8
+		if bits > size*8 || len(data) < 1+n {
+			return prefixes, errShortBGPMessage
+		}
+		ip := make(net.IP, size)
+		copy(ip, data[1:1+n])
+		prefixes = append(prefixes, bgpNLRI{AFI: afi, SAFI: safi, Prefix: fmt.Sprintf("%s/%d", ip, bits)})
+		data = data[1+n:]
+	}
+	return prefixes, nil
+}
+
+// formatRD renders a route distinguisher as ASN:value or IP:value.
+func formatRD(rd []byte) string {
+	switch binary.BigEndian.Uint16(rd[0:2]) {
+	case 0:
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint16(rd[2:4]), binary.BigEndian.Uint32(rd[4:8]))
+	case 1:
+		return fmt.Sprintf("%s:%d", net.IP(rd[2:6]), binary.BigEndian.Uint16(rd[6:8]))
+	case 2:
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint32(rd[2:6]), binary.BigEndian.Uint16(rd[6:8]))
+	}
+	return fmt.Sprintf("%x", rd)
+}
+
+func formatESI(esi []byte) string {
+	parts := make([]string, len(esi))
+	for i, b := range esi {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// formatLengthPrefixedIP renders an EVPN IP address field, preceded by its
+// length in bits, as FRR does ("[32]:[10.0.0.1]"). It returns an empty
+// string if the address is absent.
+func formatLengthPrefixedIP(data []byte) (string, bool) {
+	if len(data) < 1 {
+		return "", false
+	}
+	bits := int(data[0])
+	n := bits / 8
+	if len(data) < 1+n || (n != 0 && n != net.IPv4len && n != net.IPv6len) {
+		return "", false
+	}
+	if n == 0 {
+		return "", true
+	}
+	return fmt.Sprintf("[%d]:[%s]", bits, net.IP(data[1:1+n])), true
+}
+
+// parseEVPNRoutes decodes EVPN NLRIs (RFC 7432, RFC 9136) in the bracketed
+// notation FRR uses, prefixed by the route distinguisher.
+func parseEVPNRoutes(data []byte) ([]bgpNLRI, error) {
+	var routes []bgpNLRI
+	for len(data) >= 2 {
+		routeType, length := int(data[0]), int(data[1])
+		if len(data) < 2+length {
+			return routes, errShortBGPMessage
+		}
+		r := data[2 : 2+length]
+		data = data[2+length:]
+
+		var prefix string
+		var vni uint32
+		switch {
+		case routeType == 1 && len(r) >= 25:
+			prefix = fmt.Sprintf("RD %s [1]:[%s]:[%d]", formatRD(r[0:8]), formatESI(r[8:18]), binary.BigEndian.Uint32(r[18:22]))
+			vni = evpnLabel(r[22:25])
+		case routeType == 2 && len(r) >= 33:
+			mac := net.HardwareAddr(r[23:29])
+			ip, ok := formatLengthPrefixedIP(r[29:])
+			if !ok {
+				return routes, errShortBGPMessage
+			}
+			prefix = fmt.Sprintf("RD %s [2]:[%d]:[48]:[%s]", formatRD(r[0:8]), binary.BigEndian.Uint32(r[18:22]), mac)
+			if ip != "" {
+				prefix += ":" + ip
+			}
+			if label := 30 + int(r[29])/8; len(r) >= label+3 {
+				vni = evpnLabel(r[label : label+3])
+			}
+		case routeType == 3 && len(r) >= 13:
+			ip, ok := formatLengthPrefixedIP(r[12:])
+			if !ok {
+				return routes, errShortBGPMessage
+			}
+			prefix = fmt.Sprintf("RD %s [3]:[%d]:%s", formatRD(r[0:8]), binary.BigEndian.Uint32(r[8:12]), ip)
+		case routeType == 4 && len(r) >= 19:
+			ip, ok := formatLengthPrefixedIP(r[18:])
+			if !ok {
+				return routes, errShortBGPMessage
+			}
+			prefix = fmt.Sprintf("RD %s [4]:[%s]:%s", formatRD(r[0:8]), formatESI(r[8:18]), ip)
+		case routeType == 5 && (len(r) == 34 || len(r) == 58):
+			ipLen := net.IPv4len
+			if len(r) == 58 {
+				ipLen = net.IPv6len
+			}
+			bits := int(r[22])
+			ip := net.IP(r[23 : 23+ipLen])
+			prefix = fmt.Sprintf("RD %s [5]:[%d]:[%d]:[%s]", formatRD(r[0:8]), binary.BigEndian.Uint32(r[18:22]), bits, ip)
+			vni = evpnLabel(r[23+2*ipLen : 26+2*ipLen])
+		default:
+			prefix = fmt.Sprintf("[%d]:[%x]", routeType, r)
+		}
+		routes = append(routes, bgpNLRI{AFI: afiL2VPN, SAFI: safiEVPN, Prefix: prefix, RouteType: routeType, VNI: vni})
+	}
+	return routes, nil
+}
+
+// evpnLabel returns the 3-octet label field of an EVPN route as a VXLAN VNI.
+func evpnLabel(label []byte) uint32 {
+	return uint32(label[0])<<16 | uint32(label[1])<<8 | uint32(label[2])
+}
+
+func parseNLRI(data []byte, afi uint16, safi uint8) ([]bgpNLRI, error) {
+	if afi == afiL2VPN && safi == safiEVPN {
+		return parseEVPNRoutes(data)
+	}
+	if safi == safiUnicast && (afi == afiIPv4 || afi == afiIPv6) {
+		return parseIPPrefixes(data, afi, safi)
+	}
+	return []bgpNLRI{{AFI: afi, SAFI: safi, Prefix: fmt.Sprintf("%x", data)}}, nil
+}
+
+func formatExtCommunity(c []byte) string {
+	switch {
+	case (c[0] == 0x00 || c[0] == 0x40) && c[1] == 0x02:
+		return fmt.Sprintf("RT:%d:%d", binary.BigEndian.Uint16(c[2:4]), binary.BigEndian.Uint32(c[4:8]))
+	case (c[0] == 0x01 || c[0] == 0x41) && c[1] == 0x02:
+		return fmt.Sprintf("RT:%s:%d", net.IP(c[2:6]), binary.BigEndian.Uint16(c[6:8]))
+	case (c[0] == 0x02 || c[0] == 0x42) && c[1] == 0x02:
+		return fmt.Sprintf("RT:%d:%d", binary.BigEndian.Uint32(c[2:6]), binary.BigEndian.Uint16(c[6:8]))
+	case c[0] == 0x03 && c[1] == 0x0c:
+		return fmt.Sprintf("ET:%d", binary.BigEndian.Uint16(c[6:8]))
+	case c[0] == 0x06 && c[1] == 0x00:
+		return fmt.Sprintf("MM:%d", binary.BigEndian.Uint32(c[4:8]))
+	case c[0] == 0x06 && c[1] == 0x03:
+		return "Rmac:" + net.HardwareAddr(c[2:8]).String()
+	}
+	return fmt.Sprintf("%x", c)
+}
+
+// parseBGPUpdate decodes an UPDATE message, header included. asn4 tells
+// whether AS_PATH carries 4-byte AS numbers, as negotiated by the peers.
+func parseBGPUpdate(msg []byte, asn4 bool) (*bgpUpdate, error) {
+	body := msg[bgpHeaderLen:]
+	if len(body) < 2 {
+		return nil, errShortBGPMessage
+	}
+	update := &bgpUpdate{}
+
+	withdrawnLen := int(binary.BigEndian.Uint16(body[0:2]))
+	if len(body) < 2+withdrawnLen+2 {
+		return nil, errShortBGPMessage
+	}
+	withdrawn, err := parseIPPrefixes(body[2:2+withdrawnLen], afiIPv4, safiUnicast)
+	if err != nil {
+		return nil, err
+	}
+	update.Withdrawn = withdrawn
+
+	attrs := body[2+withdrawnLen:]
+	attrLen := int(binary.BigEndian.Uint16(attrs[0:2]))
+	if len(attrs) < 2+attrLen {
+		return nil, errShortBGPMessage
+	}
+	nlri := attrs[2+attrLen:]
+	attrs = attrs[2 : 2+attrLen]
+
+	if attrLen > 0 {
+		update.Attributes = &bgpPathAttributes{}
+	} else if withdrawnLen == 0 && len(nlri) == 0 {
+		update.EndOfRIB = familyName(afiIPv4, safiUnicast)
+	}
+	for len(attrs) >= 3 {
+		flags, code := attrs[0], attrs[1]
+		var length, hdr int
+		if flags&0x10 != 0 {
+			if len(attrs) < 4 {
+				return nil, errShortBGPMessage
+			}
+			length, hdr = int(binary.BigEndian.Uint16(attrs[2:4])), 4
+		} else {
+			length, hdr = int(attrs[2]), 3
+		}
+		if len(attrs) < hdr+length {
+			return nil, errShortBGPMessage
+		}
+		value := attrs[hdr : hdr+length]
+		attrs = attrs[hdr+length:]
+
+		a := update.Attributes
+		switch code {
+		case attrOrigin:
+			if len(value) == 1 {
+				a.Origin = []string{"IGP", "EGP", "incomplete"}[min(int(value[0]), 2)]
+			}
+		case attrASPath:
+			size := 2
+			if asn4 {
+				size = 4
+			}
+			for len(value) >= 2 {
+				count := int(value[1])
+				if len(value) < 2+count*size {
+					break
+				}
+				for i := 0; i < count; i++ {
+					seg := value[2+i*size : 2+(i+1)*size]
+					if asn4 {
+						a.ASPath = append(a.ASPath, binary.BigEndian.Uint32(seg))
+					} else {
+						a.ASPath = append(a.ASPath, uint32(binary.BigEndian.Uint16(seg)))
+					}
+				}
+				value = value[2+count*size:]
+			}
+		case attrNextHop:
+			if len(value) == net.IPv4len {
+				a.NextHop = net.IP(value).String()
+			}
+		case attrMED:
+			if len(value) == 4 {
+				v := binary.BigEndian.Uint32(value)
+				a.MED = &v
+			}
+		case attrLocalPref:
+			if len(value) == 4 {
+				v := binary.BigEndian.Uint32(value)
+				a.LocalPref = &v
+			}
+		case attrCommunities:
+			for i := 0; i+4 <= len(value); i += 4 {
+				a.Communities = append(a.Communities, fmt.Sprintf("%d:%d",
+					binary.BigEndian.Uint16(value[i:i+2]), binary.BigEndian.Uint16(value[i+2:i+4])))
+			}
+		case attrExtCommunities:
+			for i := 0; i+8 <= len(value); i += 8 {
+				a.ExtCommunities = append(a.ExtCommunities, formatExtCommunity(value[i:i+8]))
+			}
+		case attrMPReach:
+			if len(value) < 5 {
+				return nil, errShortBGPMessage
+			}
+			afi, safi := binary.BigEndian.Uint16(value[0:2]), value[2]
+			nhLen := int(value[3])
+			if len(value) < 4+nhLen+1 {
+				return nil, errShortBGPMessage
+			}
+			nh := value[4 : 4+nhLen]
+			var nextHop string
+			switch nhLen {
+			case net.IPv4len, net.IPv6len:
+				nextHop = net.IP(nh).String()
+			case 2 * net.IPv6len:
+				nextHop = net.IP(nh[:net.IPv6len]).String()
+			}
+			routes, err := parseNLRI(value[4+nhLen+1:], afi, safi)
+			if err != nil {
+				return nil, err
+			}
+			for i := range routes {
+				routes[i].NextHop = nextHop
+			}
+			update.Announced = append(update.Announced, routes...)
+		case attrMPUnreach:
+			if len(value) < 3 {
+				return nil, errShortBGPMessage
+			}
+			afi, safi := binary.BigEndian.Uint16(value[0:2]), value[2]
+			// The End-of-RIB of the other families is an MP_UNREACH_NLRI
+			// without routes as the only attribute.
+			if len(value) == 3 && hdr+length == attrLen && withdrawnLen == 0 && len(nlri) == 0 {
+				update.EndOfRIB = familyName(afi, safi)
+			}
+			routes, err := parseNLRI(value[3:], afi, safi)
+			if err != nil {
+				return nil, err
+			}
+			update.Withdrawn = append(update.Withdrawn, routes...)
+		}
+	}
+
+	announced, err := parseIPPrefixes(nlri, afiIPv4, safiUnicast)
+	if err != nil {
+		return nil, err
+	}
+	if update.Attributes != nil {
+		for i := range announced {
+			announced[i].NextHop = update.Attributes.NextHop
+		}
+	}
+	update.Announced = append(update.Announced, announced...)
+	return update, nil
+}
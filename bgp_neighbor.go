@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// bgpNeighborDetail is a BGP neighbor as the frr package decodes it, with
+// what tells why its session is not Established. Fields FRR reports with
+// another type in some version are left empty rather than failing the whole
+// neighbor.
+type bgpNeighborDetail struct {
+	frr.Neighbor
+}
+
+// bgpNeighbor returns the detail of a BGP neighbor of a router, given by
+// address or, for unnumbered sessions, by interface.
+func bgpNeighbor(router, vrf, neighbor string) (*bgpNeighborDetail, error) {
+	n, err := frrClient(router).BGPNeighbor(vrf, neighbor)
+	if err != nil {
+		return nil, err
+	}
+	return &bgpNeighborDetail{*n}, nil
+}
+
+// flattenCapabilities turns the nested capability objects of FRR into name
+// and status pairs: {"multiprotocolExtensions": {"ipv4Unicast":
+// {"advertisedAndReceived": true}}} becomes "multiprotocolExtensions
+// ipv4Unicast" and "advertisedAndReceived".
+func flattenCapabilities(prefix string, caps map[string]any) [][2]string {
+	keys := make([]string, 0, len(caps))
+	for k := range caps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var entries [][2]string
+	var flags []string
+	for _, k := range keys {
+		name := strings.TrimSpace(prefix + " " + k)
+		switch v := caps[k].(type) {
+		case map[string]any:
+			entries = append(entries, flattenCapabilities(name, v)...)
+		case bool:
+			if v {
+				flags = append(flags, k)
+			}
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			entries = append(entries, [2]string{name, strings.Join(items, ", ")})
+		default:
+			entries = append(entries, [2]string{name, fmt.Sprint(v)})
+		}
+	}
+	if len(flags) > 0 {
+		entries = append(entries, [2]string{prefix, strings.Join(flags, ", ")})
+	}
+	return entries
+}
+
+// msecs renders a duration FRR gives in milliseconds.
+func msecs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+// diagnose returns the likely reasons a session is not Established, from
+// what FRR knows of the neighbor.
+func (n *bgpNeighborDetail) diagnose(neighbor string) []string {
+	var hints []string
+	if n.State == "Established" {
+		return nil
+	}
+	if n.AdminShutdown {
+		hints = append(hints, "The neighbor is administratively shut down ('neighbor shutdown'): the session will not come up until 'no neighbor shutdown'.")
+	}
+	if n.LastNotification != "" {
+		hints = append(hints, fmt.Sprintf("The last session was reset by a NOTIFICATION: %s. %s",
+			n.LastNotification, notificationHint(n.LastNotification)))
+	}
+	switch n.State {
+	case "Active", "Connect":
+		if n.ConnectionsUp == 0 {
+			hints = append(hints, fmt.Sprintf("No TCP connection to %s ever succeeded: check that it is reachable (a route to it, 'ping'), that it listens on port 179 and has this router (%s) configured as neighbor.", neighbor, n.LocalRouterID))
+		} else {
+			hints = append(hints, fmt.Sprintf("The TCP connection to %s is not re-established: check its reachability and that its BGP process is up.", neighbor))
+		}
+	case "OpenSent", "OpenConfirm":
+		hints = append(hints, "The TCP connection is up but OPEN messages are not agreed on: compare the AS numbers, router IDs, hold times and address families on both ends.")
+	case "Idle":
+		if !n.AdminShutdown && n.LastNotification == "" {
+			hints = append(hints, "The session is Idle: FRR waits for the connect retry timer, or has no route to the neighbor, or the neighbor was just (re)configured.")
+		}
+	}
+	mp := n.multiprotocol()
+	afis := make([]string, 0, len(mp))
+	for afi := range mp {
+		afis = append(afis, afi)
+	}
+	sort.Strings(afis)
+	for _, afi := range afis {
+		status := mp[afi]
+		if status == "advertised" {
+			hints = append(hints, fmt.Sprintf("%s is advertised but not received: the neighbor does not activate this address family.", afi))
+		}
+		if status == "received" {
+			hints = append(hints, fmt.Sprintf("%s is received but not advertised: this router does not activate this address family.", afi))
+		}
+	}
+	return hints
+}
+
+// multiprotocol returns the multiprotocol extension status of each address
+// family: advertised, received, or advertisedAndReceived.
+func (n *bgpNeighborDetail) multiprotocol() map[string]string {
+	afis := make(map[string]string)
+	mp, _ := n.Capabilities["multiprotocolExtensions"].(map[string]any)
+	for afi, v := range mp {
+		flags, _ := v.(map[string]any)
+		for _, status := range []string{"advertisedAndReceived", "advertised", "received"} {
+			if b, _ := flags[status].(bool); b {
+				afis[afi] = status
+				break
+			}
+		}
+	}
+	return afis
+}
+
+// notificationHint explains the NOTIFICATIONs that usually reset sessions
+// of a lab.
+func notificationHint(reason string) string {
+	r := strings.ToLower(reason)
+	switch {
+	case strings.Contains(r, "bad peer as"):
+		return "The remote AS configured on one end does not match the AS of the other."
+	case strings.Contains(r, "bad bgp identifier"):
+		return "Both ends use the same router ID."
+	case strings.Contains(r, "hold timer expired"):
+		return "Keepalives were lost: the link or the peer stalled."
+	case strings.Contains(r, "unacceptable hold time"):
+		return "The hold times of the two ends are incompatible."
+	case strings.Contains(r, "authentication") || strings.Contains(r, "unsupported optional parameter"):
+		return "The two ends disagree on the session parameters (password or capabilities)."
+	case strings.Contains(r, "maximum number of prefixes"):
+		return "The neighbor sent more prefixes than 'maximum-prefix' allows."
+	case strings.Contains(r, "administrative"):
+		return "The peer reset or shut down the session on purpose."
+	}
+	return ""
+}
+
+func (s *MCPServer) getBGPNeighborDetail(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	neighbor, _ := args["neighbor"].(string)
+	if router == "" || neighbor == "" {
+		return toolError("router and neighbor are required")
+	}
+	if strings.ContainsAny(neighbor, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid neighbor %q", neighbor))
+	}
+	vrf, _ := args["vrf"].(string)
+	if vrf == "" {
+		vrf = "default"
+	}
+	if strings.ContainsAny(vrf, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid vrf %q", vrf))
+	}
+
+	n, err := bgpNeighbor(router, vrf, neighbor)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Neighbor %s of %s (vrf %s): %s", neighbor, routerContainer(router), vrf, n.State)
+	if n.State == "Established" {
+		fmt.Fprintf(&b, " for %s", msecs(n.UpMsec))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "  AS %d (local AS %d)", n.RemoteAs, n.LocalAs)
+	if n.Hostname != "" {
+		fmt.Fprintf(&b, ", hostname %s", n.Hostname)
+	}
+	if n.RemoteRouterID != "" {
+		fmt.Fprintf(&b, ", router ID %s (local %s)", n.RemoteRouterID, n.LocalRouterID)
+	}
+	if n.PeerGroup != "" {
+		fmt.Fprintf(&b, ", peer group %s", n.PeerGroup)
+	}
+	if n.Description != "" {
+		fmt.Fprintf(&b, ", %q", n.Description)
+	}
+	b.WriteString("\n")
+	if n.HostLocal != "" {
+		fmt.Fprintf(&b, "  TCP %s:%d -> %s:%d\n", n.HostLocal, n.PortLocal, n.HostForeign, n.PortForeign)
+	}
+	fmt.Fprintf(&b, "  Timers: hold %s, keepalive %s (configured %s/%s), connect retry %ds",
+		msecs(n.HoldTimeMsecs), msecs(n.KeepaliveMsecs), msecs(n.ConfiguredHoldTimeMsecs), msecs(n.ConfiguredKeepaliveMsecs), n.ConnectRetryTimer)
+	if n.NextConnectMsecs > 0 {
+		fmt.Fprintf(&b, ", next connect in %s", msecs(n.NextConnectMsecs))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "  Connections: %d established, %d dropped", n.ConnectionsUp, n.ConnectionsDown)
+	if n.LastResetDueTo != "" {
+		fmt.Fprintf(&b, "; last reset %s ago: %s", msecs(n.LastResetMsecAgo), n.LastResetDueTo)
+	}
+	b.WriteString("\n")
+	if n.LastNotification != "" {
+		fmt.Fprintf(&b, "  Last NOTIFICATION: %s", n.LastNotification)
+		if n.LastErrorSubcode != "" {
+			fmt.Fprintf(&b, " (code/subcode %s)", n.LastErrorSubcode)
+		}
+		if n.LastShutdownText != "" {
+			fmt.Fprintf(&b, ", %q", n.LastShutdownText)
+		}
+		b.WriteString("\n")
+	}
+
+	capabilities := newTable("capabilities", "capability", "status")
+	entries := flattenCapabilities("", n.Capabilities)
+	if len(entries) > 0 {
+		b.WriteString("\nCapabilities:\n")
+	}
+	for _, c := range entries {
+		capabilities.add(c[0], c[1])
+		fmt.Fprintf(&b, "  %-40s %s\n", c[0], c[1])
+	}
+
+	messages := newTable("messages", "type", "sent", "received")
+	if len(n.MessageStats) > 0 {
+		b.WriteString("\nMessages (sent/received):\n")
+		for _, kind := range []string{"opens", "notifications", "updates", "keepalives", "routeRefresh", "capability", "total"} {
+			sent, received := n.MessageStats[kind+"Sent"], n.MessageStats[kind+"Recv"]
+			messages.add(kind, sent, received)
+			fmt.Fprintf(&b, "  %-14s %8d %8d\n", kind, sent, received)
+		}
+	}
+
+	afis := make([]string, 0, len(n.AddressFamilies))
+	for afi := range n.AddressFamilies {
+		afis = append(afis, afi)
+	}
+	sort.Strings(afis)
+	families := newTable("address_families", "afi", "accepted_prefixes", "sent_prefixes", "inbound_route_map", "outbound_route_map")
+	if len(afis) > 0 {
+		b.WriteString("\nAddress families:\n")
+	}
+	for _, afi := range afis {
+		info := n.AddressFamilies[afi]
+		accepted, _ := info["acceptedPrefixCounter"].(float64)
+		sent, _ := info["sentPrefixCounter"].(float64)
+		in, _ := info["routeMapForIncomingAdvertisements"].(string)
+		out, _ := info["routeMapForOutgoingAdvertisements"].(string)
+		families.add(afi, int(accepted), int(sent), in, out)
+		line := fmt.Sprintf("  %-14s %6d accepted, %6d sent", afi, int(accepted), int(sent))
+		if in != "" || out != "" {
+			line += fmt.Sprintf(", route-maps in %q out %q", in, out)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	hints := n.diagnose(neighbor)
+	if len(hints) > 0 {
+		b.WriteString("\nDiagnosis:\n")
+		for _, h := range hints {
+			fmt.Fprintf(&b, "  ⚠ %s\n", strings.TrimSpace(h))
+		}
+	}
+
+	var fields record
+	fields.add("router", routerContainer(router))
+	fields.add("vrf", vrf)
+	fields.add("neighbor", neighbor)
+	fields.add("state", n.State)
+	fields.add("remote_as", n.RemoteAs)
+	fields.add("local_as", n.LocalAs)
+	fields.add("remote_router_id", n.RemoteRouterID)
+	fields.add("hold_time_msecs", n.HoldTimeMsecs)
+	fields.add("keepalive_msecs", n.KeepaliveMsecs)
+	fields.add("connections_established", n.ConnectionsUp)
+	fields.add("connections_dropped", n.ConnectionsDown)
+	fields.add("last_reset", n.LastResetDueTo)
+	fields.add("last_notification", n.LastNotification)
+	fields.add("diagnosis", hints)
+	return formattedResult(format, b.String(), false, fields, capabilities, messages, families)
+}
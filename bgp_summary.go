@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+func (s *MCPServer) getBGPSummary(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	vrf, _ := args["vrf"].(string)
+	downOnly, _ := args["down_only"].(bool)
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	sessions := newTable("sessions", "router", "vrf", "afi", "neighbor", "remote_as", "state", "prefixes_received", "uptime")
+	total, established, failed := 0, 0, 0
+	for _, router := range routers {
+		peers, err := bgpSessions(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		sort.Slice(peers, func(i, j int) bool {
+			if peers[i].VRF != peers[j].VRF {
+				return peers[i].VRF < peers[j].VRF
+			}
+			if peers[i].Neighbor != peers[j].Neighbor {
+				return peers[i].Neighbor < peers[j].Neighbor
+			}
+			return peers[i].AFI < peers[j].AFI
+		})
+		var lines []string
+		for _, p := range peers {
+			if vrf != "" && p.VRF != vrf {
+				continue
+			}
+			up := p.State == "Established"
+			total++
+			if up {
+				established++
+			}
+			if downOnly && up {
+				continue
+			}
+			uptime := p.PeerUptime
+			if !up {
+				// FRR reports the time since the last state change.
+				uptime = ""
+			}
+			sessions.add(router, p.VRF, p.AFI, p.Neighbor, p.RemoteAs, p.State, p.PfxRcd, uptime)
+
+			mark := "✓"
+			if !up {
+				mark = "✗"
+			}
+			line := fmt.Sprintf("  %s %-10s %-14s %-28s AS %-10d %-12s", mark, p.VRF, p.AFI, p.Neighbor, p.RemoteAs, p.State)
+			if up {
+				line += fmt.Sprintf(" %6d prefixes, up %s", p.PfxRcd, p.PeerUptime)
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+	}
+
+	summary := fmt.Sprintf("%d of %d BGP session(s) Established on %d router(s)", established, total, len(routers)-failed)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("total", total)
+	fields.add("established", established)
+	return formattedResult(format, text, failed == len(routers), fields, sessions)
+}
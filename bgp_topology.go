@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// afiLabels shortens the address families of the BGP summary.
+var afiLabels = map[string]string{
+	"ipv4Unicast": "ipv4",
+	"ipv6Unicast": "ipv6",
+	"l2VpnEvpn":   "evpn",
+}
+
+// topologyNode is a BGP speaker of the peering graph: a queried router, or
+// a peer none of them is.
+type topologyNode struct {
+	key      string
+	name     string
+	as       int64
+	routerID string
+	external bool
+}
+
+// topologySide is what one router reports of a session.
+type topologySide struct {
+	state    string
+	remoteAs int64
+	afis     []string
+	prefixes int
+}
+
+// topologyEdge is a BGP session of a VRF between two nodes, with what each
+// queried end reports.
+type topologyEdge struct {
+	vrf   string
+	a, b  string
+	sides map[string]*topologySide
+}
+
+// established tells whether every end reporting the session has it up.
+func (e *topologyEdge) established() bool {
+	for _, s := range e.sides {
+		if s.state != "Established" {
+			return false
+		}
+	}
+	return true
+}
+
+// afis returns the address families of the session, by either end.
+func (e *topologyEdge) afis() []string {
+	var afis []string
+	for _, s := range e.sides {
+		for _, afi := range s.afis {
+			if !containsString(afis, afi) {
+				afis = append(afis, afi)
+			}
+		}
+	}
+	sort.Strings(afis)
+	return afis
+}
+
+// states returns the state each end reports, when the session is not up.
+func (e *topologyEdge) states(nodes map[string]*topologyNode) string {
+	var states []string
+	for _, key := range []string{e.a, e.b} {
+		if s, ok := e.sides[key]; ok {
+			states = append(states, fmt.Sprintf("%s %s", nodes[key].name, s.state))
+		}
+	}
+	return strings.Join(states, ", ")
+}
+
+// label returns the text of the edge in the diagram.
+func (e *topologyEdge) label(nodes map[string]*topologyNode) string {
+	label := strings.Join(e.afis(), ", ")
+	if nodes[e.a].as == nodes[e.b].as && nodes[e.a].as != 0 {
+		label = "iBGP " + label
+	}
+	if e.vrf != "default" {
+		label = "vrf " + e.vrf + ": " + label
+	}
+	if !e.established() {
+		label += " (" + e.states(nodes) + ")"
+	}
+	return label
+}
+
+// mermaidText escapes the text of a Mermaid label.
+func mermaidText(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// renderTopologyMermaid renders the peering graph as a Mermaid flowchart,
+// the sessions not established dashed.
+func renderTopologyMermaid(nodes []*topologyNode, edges []*topologyEdge, byKey map[string]*topologyNode) string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	ids := make(map[string]string, len(nodes))
+	for i, n := range nodes {
+		ids[n.key] = fmt.Sprintf("n%d", i)
+		label := n.name
+		if n.as != 0 {
+			label += fmt.Sprintf("<br/>AS %d", n.as)
+		}
+		if n.external {
+			fmt.Fprintf(&b, "  %s([\"%s\"])\n", ids[n.key], mermaidText(label))
+		} else {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.key], mermaidText(label))
+		}
+	}
+	var down []int
+	for i, e := range edges {
+		link := "---"
+		if !e.established() {
+			link = "-.-"
+			down = append(down, i)
+		}
+		fmt.Fprintf(&b, "  %s %s|\"%s\"| %s\n", ids[e.a], link, mermaidText(e.label(byKey)), ids[e.b])
+	}
+	for _, i := range down {
+		fmt.Fprintf(&b, "  linkStyle %d stroke:#d00\n", i)
+	}
+	return b.String()
+}
+
+// renderTopologyDot renders the peering graph in the Graphviz dot language.
+func renderTopologyDot(nodes []*topologyNode, edges []*topologyEdge, byKey map[string]*topologyNode) string {
+	var b strings.Builder
+	b.WriteString("graph bgp {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, n := range nodes {
+		label := n.name
+		if n.as != 0 {
+			label += fmt.Sprintf("\nAS %d", n.as)
+		}
+		attrs := fmt.Sprintf("label=%q", label)
+		if n.external {
+			attrs += ", shape=ellipse, style=dashed"
+		}
+		fmt.Fprintf(&b, "  %q [%s];\n", n.key, attrs)
+	}
+	for _, e := range edges {
+		attrs := fmt.Sprintf("label=%q", e.label(byKey))
+		if !e.established() {
+			attrs += ", style=dashed, color=red"
+		}
+		fmt.Fprintf(&b, "  %q -- %q [%s];\n", e.a, e.b, attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (s *MCPServer) getBGPTopology(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	vrf, _ := args["vrf"].(string)
+	diagram, _ := args["diagram"].(string)
+	switch diagram {
+	case "":
+		diagram = "mermaid"
+	case "mermaid", "dot":
+	default:
+		return toolError(fmt.Sprintf("invalid diagram %q, expected mermaid or dot", diagram))
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	nodes := make(map[string]*topologyNode)
+	summaries := make(map[string]map[string]map[string]*frr.AFISummary)
+	// The peers are told apart by the addresses of the routers, or the
+	// hostname they advertise; an address found on several routers names
+	// none of them.
+	owners := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	hostnames := make(map[string]string)
+	failed := 0
+	for _, router := range routers {
+		vrfs, err := frrClient(router).BGPSummary()
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		summaries[router] = vrfs
+		name := strings.TrimPrefix(router, clabContainerPrefix)
+		nodes[router] = &topologyNode{key: router, name: name}
+		hostnames[name], hostnames[router] = router, router
+
+		links, err := routerLinks(router)
+		if err != nil {
+			fmt.Fprintf(&b, "  (addresses of %s unavailable: %v)\n", router, err)
+			continue
+		}
+		for _, l := range links {
+			for _, a := range l.AddrInfo {
+				addr, err := netip.ParseAddr(a.Local)
+				if err != nil || addr.IsLoopback() {
+					continue
+				}
+				key := addr.String()
+				if owner, ok := owners[key]; ok && owner != router {
+					ambiguous[key] = true
+				}
+				owners[key] = router
+			}
+		}
+	}
+
+	edges := make(map[string]*topologyEdge)
+	for router, vrfs := range summaries {
+		for vrfName, afis := range vrfs {
+			if vrf != "" && vrfName != vrf {
+				continue
+			}
+			for afi, summary := range afis {
+				if vrfName == "default" || nodes[router].as == 0 {
+					nodes[router].as, nodes[router].routerID = summary.AS, summary.RouterID
+				}
+				label := afiLabels[afi]
+				if label == "" {
+					label = afi
+				}
+				for neighbor, peer := range summary.Peers {
+					peerKey := ""
+					if addr, err := netip.ParseAddr(neighbor); err == nil && !ambiguous[addr.String()] {
+						peerKey = owners[addr.String()]
+					}
+					if peerKey == "" {
+						peerKey = hostnames[peer.Hostname]
+					}
+					if peerKey == "" || peerKey == router {
+						peerKey = "peer " + neighbor
+						if peer.Hostname != "" {
+							peerKey = "peer " + peer.Hostname
+						}
+						if _, ok := nodes[peerKey]; !ok {
+							nodes[peerKey] = &topologyNode{key: peerKey, name: strings.TrimPrefix(peerKey, "peer "), as: peer.RemoteAs, external: true}
+						}
+					}
+					a, z := router, peerKey
+					if z < a {
+						a, z = z, a
+					}
+					key := vrfName + " " + a + " " + z
+					e, ok := edges[key]
+					if !ok {
+						e = &topologyEdge{vrf: vrfName, a: a, b: z, sides: make(map[string]*topologySide)}
+						edges[key] = e
+					}
+					side, ok := e.sides[router]
+					if !ok {
+						side = &topologySide{state: peer.State, remoteAs: peer.RemoteAs}
+						e.sides[router] = side
+					}
+					if peer.State != "Established" {
+						side.state = peer.State
+					}
+					side.afis = append(side.afis, label)
+					side.prefixes += peer.PfxRcd
+				}
+			}
+		}
+	}
+
+	nodeList := make([]*topologyNode, 0, len(nodes))
+	for _, n := range nodes {
+		nodeList = append(nodeList, n)
+	}
+	sort.Slice(nodeList, func(i, j int) bool {
+		if nodeList[i].external != nodeList[j].external {
+			return !nodeList[i].external
+		}
+		return nodeList[i].name < nodeList[j].name
+	})
+	edgeList := make([]*topologyEdge, 0, len(edges))
+	for _, e := range edges {
+		edgeList = append(edgeList, e)
+	}
+	sort.Slice(edgeList, func(i, j int) bool {
+		x, y := edgeList[i], edgeList[j]
+		if x.vrf != y.vrf {
+			return x.vrf < y.vrf
+		}
+		if x.a != y.a {
+			return x.a < y.a
+		}
+		return x.b < y.b
+	})
+
+	nodeTable := newTable("routers", "router", "as", "router_id", "external")
+	for _, n := range nodeList {
+		nodeTable.add(n.name, n.as, n.routerID, n.external)
+	}
+	sessionTable := newTable("sessions", "vrf", "router", "peer", "remote_as", "state", "address_families", "prefixes_received")
+	var findings []string
+	down := 0
+	for _, e := range edgeList {
+		if !e.established() {
+			down++
+			findings = append(findings, fmt.Sprintf("vrf %s %s ↔ %s is not established: %s", e.vrf, nodes[e.a].name, nodes[e.b].name, e.states(nodes)))
+		}
+		for _, key := range []string{e.a, e.b} {
+			side, ok := e.sides[key]
+			if !ok {
+				continue
+			}
+			other := e.b
+			if key == e.b {
+				other = e.a
+			}
+			sessionTable.add(e.vrf, nodes[key].name, nodes[other].name, side.remoteAs, side.state, side.afis, side.prefixes)
+			if peer := nodes[other]; !peer.external {
+				if peer.as != 0 && side.remoteAs != 0 && side.remoteAs != peer.as {
+					findings = append(findings, fmt.Sprintf("%s expects AS %d for %s, which is AS %d", nodes[key].name, side.remoteAs, peer.name, peer.as))
+				}
+				if _, ok := e.sides[other]; !ok {
+					findings = append(findings, fmt.Sprintf("%s peers with %s in vrf %s, which has no session back", nodes[key].name, peer.name, e.vrf))
+				}
+			}
+		}
+	}
+
+	var rendered string
+	if diagram == "dot" {
+		rendered = renderTopologyDot(nodeList, edgeList, nodes)
+	} else {
+		rendered = renderTopologyMermaid(nodeList, edgeList, nodes)
+	}
+
+	summary := fmt.Sprintf("BGP peering of %d router(s): %d session(s), %d not established", len(routers)-failed, len(edgeList), down)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String() + "\n```" + diagram + "\n" + rendered + "```\n"
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("sessions", len(edgeList))
+	fields.add("not_established", down)
+	fields.add("findings", findings)
+	fields.add("diagram", rendered)
+	return formattedResult(format, text, failed == len(routers), fields, nodeTable, sessionTable)
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultWatchInterval is how often a flap watch polls the BGP sessions
+// when the client does not choose.
+const defaultWatchInterval = 5 * time.Second
+
+// Defaults of the capture a flap watch starts, when its capture arguments
+// leave them out: the BGP exchange for two minutes.
+const (
+	defaultFlapCaptureFilter   = "tcp port 179"
+	defaultFlapCaptureDuration = 120
+)
+
+// bgpSessionKey identifies a BGP session across polls, whatever the address
+// families it carries.
+type bgpSessionKey struct {
+	router, vrf, neighbor string
+}
+
+// bgpFlap is a session seen leaving Established by a flap watch.
+type bgpFlap struct {
+	bgpSessionKey
+	// state is the state the session was polled in, Established when it
+	// went down and came back between two polls.
+	state string
+	at    time.Time
+}
+
+func (f bgpFlap) String() string {
+	text := fmt.Sprintf("%s neighbor %s (VRF %s) ", f.router, f.neighbor, f.vrf)
+	if f.state == "Established" {
+		return text + "re-established between polls"
+	}
+	return text + "is " + f.state
+}
+
+// flapTrigger is a poll in which a flap watch saw sessions flap, with the
+// capture it started, if any.
+type flapTrigger struct {
+	flaps     []bgpFlap
+	captureID string
+	// skipped tells why no capture was started.
+	skipped string
+}
+
+// flapWatch polls the BGP sessions of routers and starts a capture when one
+// leaves Established, to catch its re-establishment.
+type flapWatch struct {
+	ID        string
+	SessionID string
+	routers   []string
+	// neighbors are globs the neighbors must match, every one when empty.
+	neighbors []string
+	interval  time.Duration
+	// capture are the start_traffic_capture arguments of the captures the
+	// watch starts.
+	capture map[string]any
+	// once ends the watch after its first capture.
+	once   bool
+	cancel context.CancelFunc
+	// done is closed once the watch stopped polling.
+	done    chan struct{}
+	started time.Time
+	// triggers and captureID are guarded by MCPServer.mu; captureID is the
+	// last capture started.
+	triggers  []flapTrigger
+	captureID string
+}
+
+// pollBGPSessions returns the BGP sessions of the routers that answered,
+// keeping the neighbors matching one of the globs.
+func pollBGPSessions(routers, neighbors []string) (map[bgpSessionKey]bgpPeerSummary, []string) {
+	sessions := make(map[bgpSessionKey]bgpPeerSummary)
+	var failures []string
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, router := range routers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			peers, err := bgpSessions(router)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", router, err))
+				return
+			}
+			for _, p := range peers {
+				if len(neighbors) > 0 && !matchesAny(neighbors, p.Neighbor) {
+					continue
+				}
+				sessions[bgpSessionKey{router, p.VRF, p.Neighbor}] = p.PeerSummary
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(failures)
+	return sessions, failures
+}
+
+func matchesAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runFlapWatch polls the sessions until the watch is cancelled, comparing
+// each poll with the previous state of every session.
+func (s *MCPServer) runFlapWatch(ctx context.Context, w *flapWatch, states map[bgpSessionKey]bgpPeerSummary) {
+	defer close(w.done)
+	defer func() {
+		s.mu.Lock()
+		delete(s.flapWatches, w.ID)
+		s.mu.Unlock()
+	}()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, failures := pollBGPSessions(w.routers, w.neighbors)
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "BGP flap watch %s: %s\n", w.ID, f)
+		}
+		now := time.Now()
+		var flaps []bgpFlap
+		for key, cur := range current {
+			prev, ok := states[key]
+			states[key] = cur
+			if !ok || prev.State != "Established" {
+				continue
+			}
+			// An uptime going backwards is a flap shorter than the interval.
+			if cur.State != "Established" || cur.PeerUptimeMsec < prev.PeerUptimeMsec {
+				flaps = append(flaps, bgpFlap{bgpSessionKey: key, state: cur.State, at: now})
+			}
+		}
+		if len(flaps) == 0 || ctx.Err() != nil {
+			continue
+		}
+		sort.Slice(flaps, func(i, j int) bool { return flaps[i].String() < flaps[j].String() })
+		if s.flapTriggered(w, flaps) && w.once {
+			return
+		}
+	}
+}
+
+// flapTriggered starts the capture of a watch for the flaps of a poll,
+// unless the previous one still runs, and notifies the session. It tells
+// whether a capture was started.
+func (s *MCPServer) flapTriggered(w *flapWatch, flaps []bgpFlap) bool {
+	trigger := flapTrigger{flaps: flaps}
+	s.mu.Lock()
+	previous := w.captureID
+	_, running := s.activeCalls[previous]
+	s.mu.Unlock()
+
+	if running {
+		trigger.skipped = fmt.Sprintf("capture %s started by an earlier flap still runs", previous)
+	} else if !s.acquireToolSlot() {
+		// The capture takes a slot like a start_traffic_capture call.
+		trigger.skipped = fmt.Sprintf("the server is busy, %d tool calls already running", s.config.MaxConcurrentTools)
+	} else {
+		args := make(map[string]any, len(w.capture)+1)
+		for k, v := range w.capture {
+			args[k] = v
+		}
+		// Unless told otherwise, capture where the sessions flapped.
+		if _, ok := args["nodes"]; !ok {
+			var nodes []any
+			var seen []string
+			for _, f := range flaps {
+				if !containsString(seen, f.router) {
+					seen = append(seen, f.router)
+					nodes = append(nodes, f.router)
+				}
+			}
+			args["nodes"] = nodes
+		}
+		requestID := fmt.Sprintf("%s-%d", w.ID, len(w.triggers)+1)
+		result := s.startTrafficCapture(w.SessionID, requestID, args)
+		s.releaseToolSlot()
+		if result.IsError {
+			trigger.skipped = "starting the capture failed: " + result.Content[0].Text
+		} else {
+			s.mu.Lock()
+			for _, call := range s.activeCalls {
+				if call.SessionID == w.SessionID && call.ID == requestID {
+					trigger.captureID = call.CaptureID
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.Lock()
+	w.triggers = append(w.triggers, trigger)
+	if trigger.captureID != "" {
+		w.captureID = trigger.captureID
+	}
+	s.mu.Unlock()
+
+	var sessions []string
+	for _, f := range flaps {
+		sessions = append(sessions, f.String())
+	}
+	message := fmt.Sprintf("BGP session flap: %s; ", strings.Join(sessions, ", "))
+	if trigger.captureID != "" {
+		message += "started capture " + trigger.captureID
+	} else {
+		message += "no capture started, " + trigger.skipped
+	}
+	data := map[string]any{
+		"event":    "bgp_session_flap",
+		"watch_id": w.ID,
+		"sessions": sessions,
+		"message":  message,
+	}
+	if trigger.captureID != "" {
+		data["capture_id"] = trigger.captureID
+	}
+	s.notify(w.SessionID, "warning", data)
+	return trigger.captureID != ""
+}
+
+func (s *MCPServer) watchBGPFlaps(sessionID string, args map[string]any) CallToolResult {
+	routerGlobs, err := stringsArg(args, "routers")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	neighbors, err := stringsArg(args, "neighbors")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	interval := defaultWatchInterval
+	if v, ok := args["interval_seconds"].(float64); ok {
+		if v < 1 {
+			return toolError("interval_seconds must be at least 1")
+		}
+		interval = time.Duration(v * float64(time.Second))
+	}
+	capture := map[string]any{}
+	if raw, ok := args["capture"]; ok {
+		if capture, ok = raw.(map[string]any); !ok {
+			return toolError("capture must be an object of start_traffic_capture arguments")
+		}
+	}
+	if _, ok := capture["capture_filter"]; !ok {
+		capture["capture_filter"] = defaultFlapCaptureFilter
+	}
+	_, hasDuration := capture["duration_seconds"]
+	_, hasLimit := capture["max_packets"]
+	if !hasDuration && !hasLimit {
+		capture["duration_seconds"] = float64(defaultFlapCaptureDuration)
+	}
+	once, _ := args["once"].(bool)
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(fmt.Sprintf("Error listing routers: %v", err))
+	}
+	routers := all
+	if len(routerGlobs) > 0 {
+		routers = nil
+		for _, glob := range routerGlobs {
+			matched := matchRouters(all, glob)
+			if len(matched) == 0 {
+				return toolError(fmt.Sprintf("No router matches %q", glob))
+			}
+			for _, r := range matched {
+				if !containsString(routers, r) {
+					routers = append(routers, r)
+				}
+			}
+		}
+	}
+
+	// The filter is compiled once now rather than at every flap, which
+	// would delay the capture of the re-establishment.
+	filter, _ := capture["capture_filter"].(string)
+	if skip, _ := capture["skip_filter_validation"].(bool); !skip && filter != "" {
+		nodeGlobs, _ := stringsArg(capture, "nodes")
+		ifaceGlobs, _ := stringsArg(capture, "interfaces")
+		nodes, ifaces := routers, map[string][]string(nil)
+		if len(nodeGlobs) > 0 || len(ifaceGlobs) > 0 {
+			if nodes, ifaces, _, err = captureTargets(nodeGlobs, ifaceGlobs); err != nil {
+				return toolError(fmt.Sprintf("Error selecting capture targets: %v", err))
+			}
+		}
+		if problems := filterProblems(checkCaptureFilters(filter, nodes, ifaces)); len(problems) > 0 {
+			return toolError(fmt.Sprintf("Invalid capture filter %q, no watch started:\n  %s", filter, strings.Join(problems, "\n  ")))
+		}
+		capture["skip_filter_validation"] = true
+	}
+
+	states, failures := pollBGPSessions(routers, neighbors)
+	if len(states) == 0 {
+		text := "No BGP session to watch"
+		if len(failures) > 0 {
+			text += ":\n  " + strings.Join(failures, "\n  ")
+		}
+		return toolError(text)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.nextWatch++
+	w := &flapWatch{
+		ID:        fmt.Sprintf("watch-%d", s.nextWatch),
+		SessionID: sessionID,
+		routers:   routers,
+		neighbors: neighbors,
+		interval:  interval,
+		capture:   capture,
+		once:      once,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		started:   time.Now(),
+	}
+	s.flapWatches[w.ID] = w
+	s.mu.Unlock()
+	go s.runFlapWatch(ctx, w, states)
+
+	established := 0
+	var down []string
+	for key, peer := range states {
+		if peer.State == "Established" {
+			established++
+		} else {
+			down = append(down, bgpFlap{bgpSessionKey: key, state: peer.State}.String())
+		}
+	}
+	sort.Strings(down)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Watching %d BGP session(s), %d Established, on %d router(s) every %s (watch_id: %s).\n", len(states), established, len(routers), interval, w.ID)
+	fmt.Fprintf(&b, "When an Established session leaves Established, a capture is started with filter %q", filter)
+	if nodes, ok := capture["nodes"]; ok {
+		fmt.Fprintf(&b, " on %v", nodes)
+	} else {
+		b.WriteString(" on the router of the session")
+	}
+	if d, ok := capture["duration_seconds"].(float64); ok {
+		fmt.Fprintf(&b, " for %gs", d)
+	}
+	b.WriteString(", and the session is notified (event bgp_session_flap).\n")
+	if once {
+		b.WriteString("The watch ends after its first capture.\n")
+	}
+	fmt.Fprintf(&b, "Starting a capture takes a few seconds: keep interval_seconds low, the re-establishment usually waits for the connect retry timer.\n")
+	if len(down) > 0 {
+		fmt.Fprintf(&b, "\nNot Established now, only watched once they are:\n  %s\n", strings.Join(down, "\n  "))
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\nNot answering, watched once they do:\n  %s\n", strings.Join(failures, "\n  "))
+	}
+	b.WriteString("\nUse stop_bgp_flap_watch to stop watching.")
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
+
+// sessionFlapWatches returns the flap watches of a session, or of every
+// session when sessionID is empty.
+func (s *MCPServer) sessionFlapWatches(sessionID string) []*flapWatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var watches []*flapWatch
+	for _, w := range s.flapWatches {
+		if sessionID == "" || w.SessionID == sessionID {
+			watches = append(watches, w)
+		}
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].started.Before(watches[j].started) })
+	return watches
+}
+
+// stopFlapWatches stops watches and waits for them to end, which lets a
+// capture they are starting finish starting.
+func stopFlapWatches(watches []*flapWatch) {
+	for _, w := range watches {
+		w.cancel()
+	}
+	for _, w := range watches {
+		<-w.done
+	}
+}
+
+func (s *MCPServer) stopBGPFlapWatch(sessionID string, args map[string]any) CallToolResult {
+	var watches []*flapWatch
+	if watchID, _ := args["watch_id"].(string); watchID != "" {
+		s.mu.Lock()
+		w, ok := s.flapWatches[watchID]
+		s.mu.Unlock()
+		if !ok {
+			return toolError(fmt.Sprintf("No BGP flap watch %s running", watchID))
+		}
+		watches = []*flapWatch{w}
+	} else {
+		watches = s.sessionFlapWatches(sessionID)
+	}
+	if len(watches) == 0 {
+		return CallToolResult{Content: []ContentItem{{Type: "text", Text: "No BGP flap watch running for this session."}}}
+	}
+	stopFlapWatches(watches)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stopped %d BGP flap watch(es). Captures they started keep running until their duration ends.\n", len(watches))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range watches {
+		fmt.Fprintf(&b, "\n%s (ran for %s): %d flap(s) seen\n", w.ID, time.Since(w.started).Truncate(time.Second), len(w.triggers))
+		for _, t := range w.triggers {
+			for _, f := range t.flaps {
+				fmt.Fprintf(&b, "  %s %s\n", f.at.Format("15:04:05"), f)
+			}
+			if t.captureID != "" {
+				fmt.Fprintf(&b, "    → capture %s\n", t.captureID)
+			} else {
+				fmt.Fprintf(&b, "    → no capture, %s\n", t.skipped)
+			}
+		}
+	}
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BMP message types (RFC 7854).
+const (
+	bmpRouteMonitoring  = 0
+	bmpStatisticsReport = 1
+	bmpPeerDown         = 2
+	bmpPeerUp           = 3
+	bmpInitiation       = 4
+	bmpTermination      = 5
+	bmpRouteMirroring   = 6
+)
+
+const (
+	bmpVersion         = 3
+	bmpCommonHeaderLen = 6
+	bmpPeerHeaderLen   = 42
+	// bmpMaxMessageLen bounds the messages accepted from a router; BGP
+	// messages are at most 64KiB even with extended messages.
+	bmpMaxMessageLen = 1 << 20
+)
+
+// Per-peer header flags.
+const (
+	bmpPeerFlagIPv6       = 0x80
+	bmpPeerFlagPostPolicy = 0x40
+	bmpPeerFlagLegacyAS   = 0x20
+)
+
+// maxBMPEvents bounds the events returned by the BMP query tools.
+const maxBMPEvents = 500
+
+var bmpPeerTypes = []string{"global", "rd", "local", "loc-rib"}
+
+var bmpPeerDownReasons = map[uint8]string{
+	1: "local system closed the session with a NOTIFICATION",
+	2: "local system closed the session without a NOTIFICATION",
+	3: "remote system closed the session with a NOTIFICATION",
+	4: "remote system closed the session without data",
+	5: "peer de-configured",
+}
+
+// bmpPeerHeader is the per-peer header preceding route monitoring, peer up
+// and peer down messages.
+type bmpPeerHeader struct {
+	Type      string
+	Flags     uint8
+	RD        string
+	Address   string
+	AS        uint32
+	BGPID     string
+	Timestamp time.Time
+}
+
+func parseBMPPeerHeader(data []byte) (*bmpPeerHeader, error) {
+	if len(data) < bmpPeerHeaderLen {
+		return nil, errors.New("truncated BMP per-peer header")
+	}
+	h := &bmpPeerHeader{
+		Type:  fmt.Sprintf("%d", data[0]),
+		Flags: data[1],
+		AS:    binary.BigEndian.Uint32(data[26:30]),
+		BGPID: net.IP(data[30:34]).String(),
+	}
+	if int(data[0]) < len(bmpPeerTypes) {
+		h.Type = bmpPeerTypes[data[0]]
+	}
+	if binary.BigEndian.Uint64(data[2:10]) != 0 {
+		h.RD = formatRD(data[2:10])
+	}
+	if h.Flags&bmpPeerFlagIPv6 != 0 {
+		h.Address = net.IP(data[10:26]).String()
+	} else {
+		h.Address = net.IP(data[22:26]).String()
+	}
+	if sec := binary.BigEndian.Uint32(data[34:38]); sec != 0 {
+		h.Timestamp = time.Unix(int64(sec), int64(binary.BigEndian.Uint32(data[38:42]))*1000).UTC()
+	}
+	return h, nil
+}
+
+// bmpRouter is a router currently streaming to the collector.
+type bmpRouter struct {
+	Name      string
+	Addr      string
+	SysDescr  string
+	Connected time.Time
+	Messages  int
+}
+
+// bmpCollector accepts BMP sessions from the FRR routers and stores their
+// peer state changes and route monitoring messages in the state database.
+type bmpCollector struct {
+	db        *sql.DB
+	listener  net.Listener
+	retention time.Duration
+	mu        sync.Mutex
+	routers   map[string]*bmpRouter
+}
+
+func startBMPCollector(addr, dbPath string, retention time.Duration) (*bmpCollector, error) {
+	db, err := openStateDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("BMP listener: %w", err)
+	}
+	c := &bmpCollector{
+		db:        db,
+		listener:  listener,
+		retention: retention,
+		routers:   make(map[string]*bmpRouter),
+	}
+	go c.acceptLoop()
+	if retention > 0 {
+		go c.pruneLoop()
+	}
+	fmt.Fprintf(os.Stderr, "BMP collector listening on %s\n", listener.Addr())
+	return c, nil
+}
+
+func (c *bmpCollector) acceptLoop() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "BMP accept: %v\n", err)
+			continue
+		}
+		go c.serve(conn)
+	}
+}
+
+// pruneLoop drops route monitoring events older than the retention period.
+// Peer events are kept, as they are few and needed to know the peer states.
+func (c *bmpCollector) pruneLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-c.retention).UTC().Format(time.RFC3339Nano)
+		if _, err := c.db.Exec("DELETE FROM bmp_route_events WHERE received_at < ?", cutoff); err != nil {
+			fmt.Fprintf(os.Stderr, "BMP pruning: %v\n", err)
+		}
+	}
+}
+
+func (c *bmpCollector) serve(conn net.Conn) {
+	defer conn.Close()
+	addr := conn.RemoteAddr().String()
+	host, _, _ := net.SplitHostPort(addr)
+	router := &bmpRouter{Name: host, Addr: addr, Connected: time.Now()}
+
+	c.mu.Lock()
+	c.routers[addr] = router
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.routers, addr)
+		c.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	header := make([]byte, bmpCommonHeaderLen)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				fmt.Fprintf(os.Stderr, "BMP session from %s: %v\n", addr, err)
+			}
+			return
+		}
+		if header[0] != bmpVersion {
+			fmt.Fprintf(os.Stderr, "BMP session from %s: unsupported version %d\n", addr, header[0])
+			return
+		}
+		length := int(binary.BigEndian.Uint32(header[1:5]))
+		if length < bmpCommonHeaderLen || length > bmpMaxMessageLen {
+			fmt.Fprintf(os.Stderr, "BMP session from %s: invalid message length %d\n", addr, length)
+			return
+		}
+		body := make([]byte, length-bmpCommonHeaderLen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			fmt.Fprintf(os.Stderr, "BMP session from %s: %v\n", addr, err)
+			return
+		}
+
+		c.mu.Lock()
+		router.Messages++
+		c.mu.Unlock()
+
+		if err := c.handleMessage(router, header[5], body); err != nil {
+			fmt.Fprintf(os.Stderr, "BMP message from %s: %v\n", router.Name, err)
+		}
+		if header[5] == bmpTermination {
+			return
+		}
+	}
+}
+
+func (c *bmpCollector) handleMessage(router *bmpRouter, msgType uint8, body []byte) error {
+	switch msgType {
+	case bmpInitiation:
+		for tlvs := body; len(tlvs) >= 4; {
+			tlvType := binary.BigEndian.Uint16(tlvs[0:2])
+			tlvLen := int(binary.BigEndian.Uint16(tlvs[2:4]))
+			if len(tlvs) < 4+tlvLen {
+				break
+			}
+			value := string(tlvs[4 : 4+tlvLen])
+			c.mu.Lock()
+			switch tlvType {
+			case 1:
+				router.SysDescr = value
+			case 2:
+				router.Name = value
+			}
+			c.mu.Unlock()
+			tlvs = tlvs[4+tlvLen:]
+		}
+		return nil
+
+	case bmpRouteMonitoring, bmpPeerUp, bmpPeerDown:
+		peer, err := parseBMPPeerHeader(body)
+		if err != nil {
+			return err
+		}
+		data := body[bmpPeerHeaderLen:]
+		switch msgType {
+		case bmpRouteMonitoring:
+			return c.storeRouteMonitoring(router.Name, peer, data)
+		case bmpPeerUp:
+			return c.storePeerUp(router.Name, peer, data)
+		default:
+			return c.storePeerDown(router.Name, peer, data)
+		}
+	}
+	// Statistics reports, termination and route mirroring are not stored.
+	return nil
+}
+
+func (c *bmpCollector) storeRouteMonitoring(router string, peer *bmpPeerHeader, data []byte) error {
+	msgType, length, err := parseBGPHeader(data)
+	if err != nil {
+		return err
+	}
+	if msgType != bgpMsgUpdate || len(data) < length {
+		return fmt.Errorf("route monitoring from %s does not carry a BGP UPDATE", peer.Address)
+	}
+	update, err := parseBGPUpdate(data[:length], peer.Flags&bmpPeerFlagLegacyAS == 0)
+	if err != nil {
+		return fmt.Errorf("decoding UPDATE from %s: %w", peer.Address, err)
+	}
+
+	var asPath, attrs string
+	if a := update.Attributes; a != nil {
+		hops := make([]string, len(a.ASPath))
+		for i, as := range a.ASPath {
+			hops[i] = fmt.Sprint(as)
+		}
+		asPath = strings.Join(hops, " ")
+		encoded, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		attrs = string(encoded)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO bmp_route_events
+		(received_at, router, peer, peer_as, peer_rd, post_policy, action, family, prefix, next_hop, as_path, attributes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	postPolicy := peer.Flags&bmpPeerFlagPostPolicy != 0
+	for _, n := range update.Withdrawn {
+		if _, err := stmt.Exec(now, router, peer.Address, peer.AS, peer.RD, postPolicy, "withdraw",
+			familyName(n.AFI, n.SAFI), n.Prefix, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	for _, n := range update.Announced {
+		if _, err := stmt.Exec(now, router, peer.Address, peer.AS, peer.RD, postPolicy, "announce",
+			familyName(n.AFI, n.SAFI), n.Prefix, n.NextHop, asPath, attrs); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *bmpCollector) storePeerEvent(router string, peer *bmpPeerHeader, event, detail string) error {
+	_, err := c.db.Exec(`INSERT INTO bmp_peer_events
+		(received_at, router, peer, peer_as, peer_bgp_id, peer_rd, peer_type, event, detail)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339Nano), router, peer.Address, peer.AS, peer.BGPID,
+		peer.RD, peer.Type, event, detail)
+	return err
+}
+
+func (c *bmpCollector) storePeerUp(router string, peer *bmpPeerHeader, data []byte) error {
+	// Local address, local port and remote port precede the OPEN messages.
+	if len(data) < 20 {
+		return errors.New("truncated BMP peer up message")
+	}
+	local := net.IP(data[0:16])
+	if peer.Flags&bmpPeerFlagIPv6 == 0 {
+		local = local[12:16]
+	}
+	detail := fmt.Sprintf("local %s:%d remote port %d",
+		local, binary.BigEndian.Uint16(data[16:18]), binary.BigEndian.Uint16(data[18:20]))
+
+	opens := data[20:]
+	for _, direction := range []string{"sent", "received"} {
+		_, length, err := parseBGPHeader(opens)
+		if err != nil || len(opens) < length {
+			break
+		}
+		if open, err := parseBGPOpen(opens[:length]); err == nil {
+			detail += fmt.Sprintf("; %s OPEN as %d hold %ds families %s",
+				direction, open.AS, open.HoldTime, strings.Join(open.Families, ","))
+		}
+		opens = opens[length:]
+	}
+	return c.storePeerEvent(router, peer, "up", detail)
+}
+
+func (c *bmpCollector) storePeerDown(router string, peer *bmpPeerHeader, data []byte) error {
+	if len(data) < 1 {
+		return errors.New("truncated BMP peer down message")
+	}
+	reason := data[0]
+	detail, ok := bmpPeerDownReasons[reason]
+	if !ok {
+		detail = fmt.Sprintf("reason %d", reason)
+	}
+	switch reason {
+	case 1, 3:
+		if _, length, err := parseBGPHeader(data[1:]); err == nil && len(data[1:]) >= length {
+			if n, err := parseBGPNotification(data[1 : 1+length]); err == nil {
+				detail += fmt.Sprintf(": %s (%d/%d)", n.Reason, n.Code, n.Subcode)
+			}
+		}
+	case 2:
+		if len(data) >= 3 {
+			detail += fmt.Sprintf(": FSM event %d", binary.BigEndian.Uint16(data[1:3]))
+		}
+	}
+	return c.storePeerEvent(router, peer, "down", detail)
+}
+
+func (s *MCPServer) bmpPeers(args map[string]any) CallToolResult {
+	if s.bmp == nil {
+		return toolError("The BMP collector is not running: set bmp_listen in the config file or pass --bmp-listen")
+	}
+	routerFilter, _ := args["router"].(string)
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	var b strings.Builder
+	s.bmp.mu.Lock()
+	routers := make([]bmpRouter, 0, len(s.bmp.routers))
+	for _, r := range s.bmp.routers {
+		routers = append(routers, *r)
+	}
+	s.bmp.mu.Unlock()
+	sort.Slice(routers, func(i, j int) bool { return routers[i].Name < routers[j].Name })
+
+	routersTable := newTable("routers", "name", "address", "connected_since", "messages")
+	fmt.Fprintf(&b, "Routers connected to the BMP collector on %s: %d\n", s.bmp.listener.Addr(), len(routers))
+	for _, r := range routers {
+		connected := r.Connected.UTC().Format(time.RFC3339)
+		fmt.Fprintf(&b, "  %s (%s) connected since %s, %d messages\n", r.Name, r.Addr, connected, r.Messages)
+		routersTable.add(r.Name, r.Addr, connected, r.Messages)
+	}
+
+	// The state of a peer is given by its latest up or down event.
+	rows, err := s.bmp.db.Query(`SELECT router, peer, peer_rd, peer_type, peer_as, event, received_at, detail
+		FROM bmp_peer_events e
+		WHERE id = (SELECT MAX(id) FROM bmp_peer_events
+			WHERE router = e.router AND peer = e.peer AND peer_rd = e.peer_rd)
+		AND (? = '' OR router = ?)
+		ORDER BY router, peer_rd, peer`, routerFilter, routerFilter)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error reading BMP peers: %v", err))
+	}
+	defer rows.Close()
+
+	peersTable := newTable("peers", "router", "peer", "peer_rd", "peer_type", "peer_as", "state", "since", "detail")
+	b.WriteString("\nPeers:\n")
+	for rows.Next() {
+		var router, peer, rd, peerType, event, at, detail string
+		var as int64
+		if err := rows.Scan(&router, &peer, &rd, &peerType, &as, &event, &at, &detail); err != nil {
+			return toolError(fmt.Sprintf("Error reading BMP peers: %v", err))
+		}
+		peersTable.add(router, peer, rd, peerType, as, event, at, detail)
+		if rd != "" {
+			peer += " rd " + rd
+		}
+		fmt.Fprintf(&b, "  %s -> %s (AS %d, %s): %s since %s, %s\n", router, peer, as, peerType, strings.ToUpper(event), at, detail)
+	}
+	if err := rows.Err(); err != nil {
+		return toolError(fmt.Sprintf("Error reading BMP peers: %v", err))
+	}
+	if len(peersTable.Rows) == 0 {
+		b.WriteString("  none reported yet\n")
+	}
+
+	if format == "text" {
+		return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+	}
+	var fields record
+	fields.add("listen", s.bmp.listener.Addr().String())
+	return formattedResult(format, b.String(), false, fields, routersTable, peersTable)
+}
+
+func (s *MCPServer) bmpRouteEvents(args map[string]any) CallToolResult {
+	if s.bmp == nil {
+		return toolError("The BMP collector is not running: set bmp_listen in the config file or pass --bmp-listen")
+	}
+	router, _ := args["router"].(string)
+	peer, _ := args["peer"].(string)
+	prefix, _ := args["prefix"].(string)
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	since := ""
+	if v, ok := args["since"].(string); ok && v != "" {
+		t, err := parseTimeArg(v, time.Now())
+		if err != nil {
+			return toolError(err.Error())
+		}
+		since = t.UTC().Format(time.RFC3339Nano)
+	}
+	limit := 100
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = min(int(v), maxBMPEvents)
+	}
+
+	rows, err := s.bmp.db.Query(`SELECT received_at, router, peer, peer_rd, post_policy, action, family, prefix,
+			COALESCE(next_hop, ''), COALESCE(as_path, ''), COALESCE(attributes, '')
+		FROM bmp_route_events
+		WHERE (? = '' OR router = ?) AND (? = '' OR peer = ?)
+			AND (? = '' OR instr(prefix, ?) > 0) AND (? = '' OR received_at >= ?)
+		ORDER BY id DESC LIMIT ?`,
+		router, router, peer, peer, prefix, prefix, since, since, limit)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error reading BMP route events: %v", err))
+	}
+	defer rows.Close()
+
+	var lines []string
+	var events [][]any
+	for rows.Next() {
+		var at, from, to, rd, action, family, nlri, nextHop, asPath, attrs string
+		var postPolicy bool
+		if err := rows.Scan(&at, &to, &from, &rd, &postPolicy, &action, &family, &nlri, &nextHop, &asPath, &attrs); err != nil {
+			return toolError(fmt.Sprintf("Error reading BMP route events: %v", err))
+		}
+		policy := "pre-policy"
+		if postPolicy {
+			policy = "post-policy"
+		}
+		events = append(events, []any{at, to, from, rd, policy, action, family, nlri, nextHop, asPath, attrs})
+		if rd != "" {
+			from += " rd " + rd
+		}
+		line := fmt.Sprintf("%s %s <- %s (%s) %s %s %s", at, to, from, policy, strings.ToUpper(action), family, nlri)
+		if action == "announce" {
+			line += fmt.Sprintf(" nh %s path [%s] %s", nextHop, asPath, attrs)
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return toolError(fmt.Sprintf("Error reading BMP route events: %v", err))
+	}
+
+	var b strings.Builder
+	eventsTable := newTable("events", "received_at", "router", "peer", "peer_rd", "policy", "action", "family", "prefix", "next_hop", "as_path", "attributes")
+	fmt.Fprintf(&b, "%d route monitoring events (newest last, limit %d)\n", len(lines), limit)
+	for i := len(lines) - 1; i >= 0; i-- {
+		b.WriteString(lines[i] + "\n")
+		eventsTable.add(events[i]...)
+	}
+	var fields record
+	fields.add("limit", limit)
+	return formattedResult(format, b.String(), false, fields, eventsTable)
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// dhcpOptRelayAgentInfo is the relay agent information option (RFC 3046),
+// option 82, inserted by the relays between the client and the server.
+const dhcpOptRelayAgentInfo layers.DHCPOpt = 82
+
+// l2vniGateway is the gateway an L2VNI resource configures on the routers,
+// which the hosts of the VNI are expected to learn.
+type l2vniGateway struct {
+	cluster  string
+	name     string
+	vni      int
+	gateways []netip.Prefix
+}
+
+// expectedL2VNIs returns the L2VNIs declared in the kind clusters, with their
+// gateways. Clusters without the L2VNI resource are skipped; an error is
+// returned only if none can be queried.
+func expectedL2VNIs() ([]l2vniGateway, error) {
+	nodes, err := kindNodes("")
+	if err != nil {
+		return nil, err
+	}
+	var l2vnis []l2vniGateway
+	var lastErr error
+	queried := 0
+	seen := make(map[string]bool)
+	for _, n := range nodes {
+		if seen[n.Cluster] {
+			continue
+		}
+		seen[n.Cluster] = true
+		var list struct {
+			Items []struct {
+				Metadata objectMeta `json:"metadata"`
+				Spec     struct {
+					VNI          int      `json:"vni"`
+					L2GatewayIP  string   `json:"l2gatewayip"`
+					L2GatewayIPs []string `json:"l2gatewayips"`
+				} `json:"spec"`
+			} `json:"items"`
+		}
+		if err := kubectlGetJSON(n.Cluster, &list, "l2vnis."+openperouterAPIGroup, "-A"); err != nil {
+			lastErr = err
+			continue
+		}
+		queried++
+		for _, item := range list.Items {
+			l := l2vniGateway{cluster: n.Cluster, name: item.Metadata.Namespace + "/" + item.Metadata.Name, vni: item.Spec.VNI}
+			for _, gw := range append([]string{item.Spec.L2GatewayIP}, item.Spec.L2GatewayIPs...) {
+				if prefix, err := netip.ParsePrefix(gw); err == nil {
+					l.gateways = append(l.gateways, prefix)
+				}
+			}
+			l2vnis = append(l2vnis, l)
+		}
+	}
+	if queried == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	sort.Slice(l2vnis, func(i, j int) bool {
+		if l2vnis[i].vni != l2vnis[j].vni {
+			return l2vnis[i].vni < l2vnis[j].vni
+		}
+		return l2vnis[i].cluster < l2vnis[j].cluster
+	})
+	return l2vnis, nil
+}
+
+// dhcpExchange is a DHCPv4 or DHCPv6 transaction, the messages of a client
+// and of the servers sharing its transaction ID.
+type dhcpExchange struct {
+	version  string
+	domain   string
+	xid      string
+	first    time.Time
+	client   string
+	messages []string
+	// answered tells the servers offered, acknowledged or replied.
+	answered, clientSent bool
+	offered              []string
+	// servers are the DHCPv4 server identifiers, or the sources of the
+	// DHCPv6 relay replies; responders the sources of the other server
+	// messages, the relays themselves when the exchange is relayed.
+	servers, responders []string
+	relays              []string
+	relayAgentInfo      bool
+	routers             []string
+	failures            []string
+}
+
+func (e *dhcpExchange) message(name string) {
+	if n := len(e.messages); n > 0 {
+		last, count := e.messages[n-1], 1
+		if base, times, ok := strings.Cut(last, " x"); ok {
+			last = base
+			fmt.Sscan(times, &count)
+		}
+		if last == name {
+			e.messages[n-1] = fmt.Sprintf("%s x%d", name, count+1)
+			return
+		}
+	}
+	e.messages = append(e.messages, name)
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if v != "" && !containsString(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// routerAdvertiser is a router advertising in a broadcast domain.
+type routerAdvertiser struct {
+	domain      string
+	source      netip.Addr
+	mac         string
+	count       int
+	lifetime    uint16
+	prefixes    []netip.Prefix
+	first, last time.Time
+}
+
+// addressingSummary is the analysis of the DHCP exchanges and router
+// advertisements of capture files.
+type addressingSummary struct {
+	exchanges map[string]*dhcpExchange
+	order     []string
+	ras       map[string]*routerAdvertiser
+	dhcpv4    int
+	dhcpv6    int
+	raCount   int
+}
+
+func newAddressingSummary() *addressingSummary {
+	return &addressingSummary{
+		exchanges: make(map[string]*dhcpExchange),
+		ras:       make(map[string]*routerAdvertiser),
+	}
+}
+
+func (a *addressingSummary) exchange(version, domain, xid string, at time.Time) *dhcpExchange {
+	key := version + "|" + domain + "|" + xid
+	e, ok := a.exchanges[key]
+	if !ok {
+		e = &dhcpExchange{version: version, domain: domain, xid: xid, first: at}
+		a.exchanges[key] = e
+		a.order = append(a.order, key)
+	}
+	return e
+}
+
+// add decodes a packet and accounts its DHCP message or router
+// advertisement, in the domain of the innermost VXLAN or 802.1Q header.
+func (a *addressingSummary) add(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	domain := ""
+	var ethSrc string
+	var ipSrc netip.Addr
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.VXLAN:
+			domain = fmt.Sprintf("vni %d", l.VNI)
+		case *layers.Dot1Q:
+			domain = fmt.Sprintf("vlan %d", l.VLANIdentifier)
+		case *layers.Ethernet:
+			ethSrc = l.SrcMAC.String()
+		case *layers.IPv4:
+			ipSrc, _ = netip.AddrFromSlice(l.SrcIP.To4())
+		case *layers.IPv6:
+			ipSrc, _ = netip.AddrFromSlice(l.SrcIP)
+		case *layers.DHCPv4:
+			a.dhcpv4++
+			a.addDHCPv4(domain, l, ci.Timestamp)
+		case *layers.DHCPv6:
+			a.dhcpv6++
+			a.addDHCPv6(domain, l, ipSrc, ci.Timestamp)
+		case *layers.ICMPv6RouterAdvertisement:
+			a.raCount++
+			a.addRA(domain, l, ipSrc, ethSrc, ci.Timestamp)
+		}
+	}
+}
+
+func (a *addressingSummary) addDHCPv4(domain string, d *layers.DHCPv4, at time.Time) {
+	msgType := layers.DHCPMsgTypeUnspecified
+	var serverID string
+	var routers []string
+	agentInfo := false
+	for _, opt := range d.Options {
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			if len(opt.Data) == 1 {
+				msgType = layers.DHCPMsgType(opt.Data[0])
+			}
+		case layers.DHCPOptServerID:
+			if len(opt.Data) == 4 {
+				serverID = net.IP(opt.Data).String()
+			}
+		case layers.DHCPOptRouter:
+			for i := 0; i+4 <= len(opt.Data); i += 4 {
+				routers = append(routers, net.IP(opt.Data[i:i+4]).String())
+			}
+		case dhcpOptRelayAgentInfo:
+			agentInfo = true
+		}
+	}
+	e := a.exchange("DHCPv4", domain, fmt.Sprintf("0x%08x", d.Xid), at)
+	e.message(msgType.String())
+	if agentInfo {
+		e.relayAgentInfo = true
+	}
+	if d.RelayAgentIP != nil && !d.RelayAgentIP.IsUnspecified() {
+		e.relays = appendUnique(e.relays, d.RelayAgentIP.String())
+	}
+	if d.Operation == layers.DHCPOpRequest {
+		e.clientSent = true
+		if e.client == "" {
+			e.client = d.ClientHWAddr.String()
+		}
+		return
+	}
+	e.servers = appendUnique(e.servers, serverID)
+	switch msgType {
+	case layers.DHCPMsgTypeOffer, layers.DHCPMsgTypeAck:
+		e.answered = true
+		if d.YourClientIP != nil && !d.YourClientIP.IsUnspecified() {
+			e.offered = appendUnique(e.offered, d.YourClientIP.String())
+		}
+		e.routers = appendUnique(e.routers, routers...)
+	case layers.DHCPMsgTypeNak:
+		e.answered = true
+		e.failures = appendUnique(e.failures, "NAK")
+	}
+}
+
+// dhcpv6MsgName names a DHCPv6 message type as RFC 8415 does.
+func dhcpv6MsgName(t layers.DHCPv6MsgType) string {
+	if t == layers.DHCPv6MsgTypeAdverstise {
+		return "Advertise"
+	}
+	return t.String()
+}
+
+// dhcpv6Status returns the status code of a DHCPv6 status option, success
+// being 0.
+func dhcpv6Status(data []byte) (uint16, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(data), true
+}
+
+func (a *addressingSummary) addDHCPv6(domain string, d *layers.DHCPv6, ipSrc netip.Addr, at time.Time) {
+	// Unwrap the relay messages down to the one of the client or server,
+	// recording the relays along the way.
+	var relays []string
+	relayReply := false
+	client := ""
+	for d.MsgType == layers.DHCPv6MsgTypeRelayForward || d.MsgType == layers.DHCPv6MsgTypeRelayReply {
+		if d.MsgType == layers.DHCPv6MsgTypeRelayReply {
+			relayReply = true
+		}
+		if d.LinkAddr != nil && !d.LinkAddr.IsUnspecified() {
+			relays = append(relays, d.LinkAddr.String())
+		} else if d.MsgType == layers.DHCPv6MsgTypeRelayForward && ipSrc.IsValid() {
+			relays = append(relays, ipSrc.String())
+		}
+		if d.PeerAddr != nil {
+			client = d.PeerAddr.String()
+		}
+		var inner *layers.DHCPv6
+		for _, opt := range d.Options {
+			if opt.Code == layers.DHCPv6OptRelayMessage {
+				inner = &layers.DHCPv6{}
+				if err := inner.DecodeFromBytes(opt.Data, gopacket.NilDecodeFeedback); err != nil {
+					return
+				}
+			}
+		}
+		if inner == nil {
+			return
+		}
+		d = inner
+	}
+
+	e := a.exchange("DHCPv6", domain, hex.EncodeToString(d.TransactionID), at)
+	e.message(dhcpv6MsgName(d.MsgType))
+	e.relays = appendUnique(e.relays, relays...)
+	switch d.MsgType {
+	case layers.DHCPv6MsgTypeAdverstise, layers.DHCPv6MsgTypeReply:
+	default:
+		e.clientSent = true
+		if client == "" && ipSrc.IsValid() {
+			client = ipSrc.String()
+		}
+		if e.client == "" {
+			e.client = client
+		}
+		return
+	}
+
+	e.answered = true
+	if ipSrc.IsValid() {
+		if relayReply {
+			e.servers = appendUnique(e.servers, ipSrc.String())
+		} else {
+			e.responders = appendUnique(e.responders, ipSrc.String())
+		}
+	}
+	for _, opt := range d.Options {
+		switch opt.Code {
+		case layers.DHCPv6OptStatusCode:
+			if code, ok := dhcpv6Status(opt.Data); ok && code != 0 {
+				e.failures = appendUnique(e.failures, fmt.Sprintf("status %d", code))
+			}
+		case layers.DHCPv6OptIANA, layers.DHCPv6OptIAPD:
+			// IAID, T1 and T2, then the addresses or prefixes.
+			for sub := opt.Data[min(12, len(opt.Data)):]; len(sub) >= 4; {
+				code := layers.DHCPv6Opt(binary.BigEndian.Uint16(sub))
+				length := int(binary.BigEndian.Uint16(sub[2:]))
+				if len(sub) < 4+length {
+					break
+				}
+				body := sub[4 : 4+length]
+				switch {
+				case code == layers.DHCPv6OptIAAddr && len(body) >= 16:
+					addr, _ := netip.AddrFromSlice(body[:16])
+					e.offered = appendUnique(e.offered, addr.String())
+				case code == layers.DHCPv6OptIAPrefix && len(body) >= 25:
+					addr, _ := netip.AddrFromSlice(body[9:25])
+					e.offered = appendUnique(e.offered, netip.PrefixFrom(addr, int(body[8])).String())
+				case code == layers.DHCPv6OptStatusCode:
+					if status, ok := dhcpv6Status(body); ok && status != 0 {
+						e.failures = appendUnique(e.failures, fmt.Sprintf("status %d", status))
+					}
+				}
+				sub = sub[4+length:]
+			}
+		}
+	}
+}
+
+func (a *addressingSummary) addRA(domain string, ra *layers.ICMPv6RouterAdvertisement, ipSrc netip.Addr, ethSrc string, at time.Time) {
+	mac := ethSrc
+	var prefixes []netip.Prefix
+	for _, opt := range ra.Options {
+		switch opt.Type {
+		case layers.ICMPv6OptSourceAddress:
+			if len(opt.Data) == 6 {
+				mac = net.HardwareAddr(opt.Data).String()
+			}
+		case layers.ICMPv6OptPrefixInfo:
+			// Prefix length, flags, lifetimes and reserved, then the prefix.
+			if len(opt.Data) >= 30 {
+				addr, _ := netip.AddrFromSlice(opt.Data[14:30])
+				prefixes = append(prefixes, netip.PrefixFrom(addr, int(opt.Data[0])))
+			}
+		}
+	}
+	key := domain + "|" + ipSrc.String() + "|" + mac
+	r, ok := a.ras[key]
+	if !ok {
+		r = &routerAdvertiser{domain: domain, source: ipSrc, mac: mac, first: at}
+		a.ras[key] = r
+	}
+	r.count++
+	r.lifetime = ra.RouterLifetime
+	r.last = at
+	for _, p := range prefixes {
+		if !containsPrefix(r.prefixes, p) {
+			r.prefixes = append(r.prefixes, p)
+		}
+	}
+}
+
+func containsPrefix(prefixes []netip.Prefix, p netip.Prefix) bool {
+	for _, q := range prefixes {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// advertises tells whether a router advertisement announces the gateway:
+// it carries the prefix of the gateway, or comes from a router of the
+// fabric.
+func (r *routerAdvertiser) advertises(gateway netip.Prefix, routerMACs map[string][]string) bool {
+	for _, p := range r.prefixes {
+		if p.Contains(gateway.Addr()) {
+			return true
+		}
+	}
+	return len(routerMACs[r.mac]) > 0
+}
+
+func (s *MCPServer) analyzeAddressing(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	summary := newAddressingSummary()
+	for _, in := range inputs {
+		if err := readCapture(in, summary.add); err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d DHCPv4 messages, %d DHCPv6 messages, %d router advertisements in %d file(s)\n",
+		summary.dhcpv4, summary.dhcpv6, summary.raCount, len(inputs))
+	routerMACs, _, fabricErr := fabricAddresses()
+	if fabricErr != nil {
+		fmt.Fprintf(&b, "Router addresses unknown, advertisers are matched to the gateways by prefix only: %v\n", fabricErr)
+	}
+	l2vnis, l2vniErr := expectedL2VNIs()
+	if l2vniErr != nil {
+		fmt.Fprintf(&b, "L2VNI resources unknown, the gateways are not checked: %v\n", l2vniErr)
+	}
+	var findings []string
+
+	exchanges := newTable("dhcp_exchanges", "first", "domain", "version", "xid", "client", "messages", "offered", "servers", "relays", "relay_agent_info", "routers")
+	b.WriteString("\nDHCP exchanges:\n")
+	sort.SliceStable(summary.order, func(i, j int) bool {
+		return summary.exchanges[summary.order[i]].first.Before(summary.exchanges[summary.order[j]].first)
+	})
+	for _, key := range summary.order {
+		e := summary.exchanges[key]
+		servers := e.servers
+		if len(servers) == 0 {
+			servers = e.responders
+		}
+		exchanges.add(e.first.UTC().Format(time.RFC3339Nano), domainName(e.domain), e.version, e.xid, e.client,
+			e.messages, e.offered, servers, e.relays, e.relayAgentInfo, e.routers)
+		fmt.Fprintf(&b, "  %s %-9s %s %s from %s: %s\n", e.first.Format("15:04:05.000"), domainName(e.domain),
+			e.version, e.xid, valueOr(e.client, "unknown client"), strings.Join(e.messages, ", "))
+		if len(e.offered) > 0 {
+			fmt.Fprintf(&b, "      offered %s\n", strings.Join(e.offered, ", "))
+		}
+		if len(servers) > 0 {
+			fmt.Fprintf(&b, "      server %s\n", strings.Join(servers, ", "))
+		}
+		if len(e.relays) > 0 {
+			relay := "      relayed by " + strings.Join(e.relays, ", ")
+			if e.relayAgentInfo {
+				relay += ", with relay agent information (option 82)"
+			}
+			b.WriteString(relay + "\n")
+		} else if e.relayAgentInfo {
+			b.WriteString("      relay agent information (option 82) without a relay address\n")
+		}
+		if len(e.routers) > 0 {
+			fmt.Fprintf(&b, "      routers %s\n", strings.Join(e.routers, ", "))
+		}
+
+		what := fmt.Sprintf("%s %s exchange %s of %s", domainName(e.domain), e.version, e.xid, valueOr(e.client, "unknown client"))
+		switch {
+		case e.clientSent && !e.answered && !releaseOnly(e.messages):
+			findings = append(findings, what+" never answered")
+		case len(e.failures) > 0:
+			findings = append(findings, fmt.Sprintf("%s failed: %s", what, strings.Join(e.failures, ", ")))
+		}
+	}
+	if len(summary.order) == 0 {
+		b.WriteString("  none\n")
+	}
+
+	var raKeys []string
+	for key := range summary.ras {
+		raKeys = append(raKeys, key)
+	}
+	sort.Strings(raKeys)
+	advertisers := newTable("router_advertisers", "domain", "source", "mac", "router", "count", "lifetime", "prefixes", "first", "last")
+	b.WriteString("\nRouter advertisements:\n")
+	for _, key := range raKeys {
+		r := summary.ras[key]
+		var prefixes []string
+		for _, p := range r.prefixes {
+			prefixes = append(prefixes, p.String())
+		}
+		var router any
+		owner := ""
+		if routers := routerMACs[r.mac]; len(routers) > 0 {
+			router = strings.Join(routers, ", ")
+			owner = " (" + strings.Join(routers, ", ") + ")"
+		}
+		advertisers.add(domainName(r.domain), r.source.String(), r.mac, router, r.count, r.lifetime, prefixes,
+			r.first.UTC().Format(time.RFC3339Nano), r.last.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(&b, "  %-9s %s %s%s: %d RA(s), router lifetime %ds, prefixes %s\n", domainName(r.domain), r.source, r.mac, owner,
+			r.count, r.lifetime, valueOr(strings.Join(prefixes, ", "), "none"))
+		if r.lifetime == 0 {
+			findings = append(findings, fmt.Sprintf("%s %s advertises a router lifetime of 0, hosts do not use it as default gateway", domainName(r.domain), r.source))
+		}
+	}
+	if len(raKeys) == 0 {
+		b.WriteString("  none\n")
+	}
+
+	gateways := newTable("l2vni_gateways", "cluster", "l2vni", "vni", "gateway", "advertised")
+	if l2vniErr == nil {
+		b.WriteString("\nL2VNI gateways:\n")
+		for _, l := range l2vnis {
+			domain := fmt.Sprintf("vni %d", l.vni)
+			if len(l.gateways) == 0 {
+				fmt.Fprintf(&b, "  %s %s (%s): no gateway configured\n", l.name, domain, l.cluster)
+				continue
+			}
+			for _, gw := range l.gateways {
+				advertised, how := false, ""
+				if gw.Addr().Is6() {
+					for _, key := range raKeys {
+						if r := summary.ras[key]; r.domain == domain && r.advertises(gw, routerMACs) {
+							advertised, how = true, "router advertisement from "+r.source.String()
+							break
+						}
+					}
+				} else {
+					for _, key := range summary.order {
+						if e := summary.exchanges[key]; e.domain == domain && containsString(e.routers, gw.Addr().String()) {
+							advertised, how = true, "DHCP router option"
+							break
+						}
+					}
+				}
+				gateways.add(l.cluster, l.name, l.vni, gw.String(), advertised)
+				if advertised {
+					fmt.Fprintf(&b, "  %s %s (%s): gateway %s advertised by %s\n", l.name, domain, l.cluster, gw, how)
+					continue
+				}
+				fmt.Fprintf(&b, "  %s %s (%s): gateway %s not advertised\n", l.name, domain, l.cluster, gw)
+				if gw.Addr().Is6() {
+					findings = append(findings, fmt.Sprintf("no router advertisement for gateway %s of %s in %s", gw, l.name, domain))
+				}
+			}
+		}
+		if len(l2vnis) == 0 {
+			b.WriteString("  no L2VNI resource\n")
+		}
+		if len(l2vnis) > 0 && summary.raCount+summary.dhcpv4+summary.dhcpv6 > 0 && !hasVNIDomain(summary) {
+			b.WriteString("  No addressing traffic carried by VXLAN: capture the fabric links to attribute it to the VNIs.\n")
+		}
+	}
+
+	b.WriteString("\n")
+	if len(findings) == 0 {
+		b.WriteString("✓ Every DHCP exchange answered, every L2VNI gateway advertised\n")
+	} else {
+		b.WriteString("✗ Findings:\n")
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  - %s\n", f)
+		}
+	}
+
+	var fields record
+	fields.add("dhcpv4_messages", summary.dhcpv4)
+	fields.add("dhcpv6_messages", summary.dhcpv6)
+	fields.add("router_advertisements", summary.raCount)
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, exchanges, advertisers, gateways)
+}
+
+// releaseOnly tells whether a client only released or declined its
+// addresses, which the servers do not answer in DHCPv4.
+func releaseOnly(messages []string) bool {
+	for _, m := range messages {
+		name, _, _ := strings.Cut(m, " x")
+		if name != "Release" && name != "Decline" {
+			return false
+		}
+	}
+	return true
+}
+
+func hasVNIDomain(summary *addressingSummary) bool {
+	for _, e := range summary.exchanges {
+		if strings.HasPrefix(e.domain, "vni ") {
+			return true
+		}
+	}
+	for _, r := range summary.ras {
+		if strings.HasPrefix(r.domain, "vni ") {
+			return true
+		}
+	}
+	return false
+}
+
+// valueOr returns value, or fallback when it is empty.
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
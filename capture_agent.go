@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"golang.org/x/net/bpf"
+)
+
+// captureAgentCommand is the first argument running the server binary as
+// the capture agent of the afpacket backend.
+const captureAgentCommand = "capture-agent"
+
+// agentSnapLength is the largest packet the agent captures, enough for the
+// GRO and loopback packets larger than the MTU.
+const agentSnapLength = 262144
+
+// parseBPFProgram parses a classic BPF program as printed by tcpdump -ddd,
+// the instruction count first, with its lines joined by commas.
+func parseBPFProgram(program string) ([]bpf.RawInstruction, error) {
+	lines := strings.Split(strings.TrimSpace(program), ",")
+	count, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || count != len(lines)-1 {
+		return nil, fmt.Errorf("invalid BPF program: expected the instruction count first")
+	}
+	var instructions []bpf.RawInstruction
+	for _, line := range lines[1:] {
+		var ins bpf.RawInstruction
+		if n, err := fmt.Sscanf(line, "%d %d %d %d", &ins.Op, &ins.Jt, &ins.Jf, &ins.K); err != nil || n != 4 {
+			return nil, fmt.Errorf("invalid BPF instruction %q", line)
+		}
+		instructions = append(instructions, ins)
+	}
+	return instructions, nil
+}
+
+// agentInterfaces returns the interfaces the agent captures on by default:
+// the ones up with Ethernet framing, as the afpacket sockets see them. The
+// loopback is left out, its packets are seen both leaving and arriving.
+func agentInterfaces() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && len(iface.HardwareAddr) == 6 {
+			names = append(names, iface.Name)
+		}
+	}
+	return names, nil
+}
+
+// agentSummary is the one-line summary of a packet the agent prints for live
+// captures, in the spirit of tshark -P.
+func agentSummary(number int, iface string, data []byte, ci gopacket.CaptureInfo) string {
+	packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	src, dst, protocol, app, info := "", "", "", "", ""
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.ARP:
+			src, dst = net.IP(l.SourceProtAddress).String(), net.IP(l.DstProtAddress).String()
+			info = "Who has " + dst
+			if l.Operation == layers.ARPReply {
+				info = src + " is at " + net.HardwareAddr(l.SourceHwAddress).String()
+			}
+		case *layers.IPv4:
+			src, dst = l.SrcIP.String(), l.DstIP.String()
+		case *layers.IPv6:
+			src, dst = l.SrcIP.String(), l.DstIP.String()
+		case *layers.ICMPv4:
+			info = l.TypeCode.String()
+		case *layers.ICMPv6:
+			info = l.TypeCode.String()
+		case *layers.TCP:
+			info = fmt.Sprintf("%d → %d", l.SrcPort, l.DstPort)
+			if name, ok := wellKnownPorts[l.SrcPort]; ok {
+				app = name
+			} else if name, ok := wellKnownPorts[l.DstPort]; ok {
+				app = name
+			}
+		case *layers.UDP:
+			info = fmt.Sprintf("%d → %d", l.SrcPort, l.DstPort)
+			if name, ok := wellKnownUDPPorts[l.DstPort]; ok {
+				app = name
+			}
+		case *gopacket.Payload, *gopacket.DecodeFailure:
+			continue
+		}
+		// The innermost layer names the packet, VXLAN ones included.
+		protocol = layer.LayerType().String()
+	}
+	if app != "" {
+		protocol = app
+	}
+	return strings.TrimSpace(fmt.Sprintf("%5d %s %s %s → %s %s %d %s", number, ci.Timestamp.Format("2006-01-02 15:04:05.000000"), iface, src, dst, protocol, ci.Length, info))
+}
+
+// runCaptureAgent captures with afpacket sockets to a pcapng file, as
+// tshark does for the tshark backend: it stops after -c packets, or on
+// SIGTERM or SIGINT, and prints a summary per packet with -live.
+func runCaptureAgent(args []string) int {
+	fs := flag.NewFlagSet(captureAgentCommand, flag.ContinueOnError)
+	ifaceList := fs.String("i", "", "Comma-separated interfaces to capture on, all of them by default")
+	output := fs.String("w", "", "pcapng file to write, - for stdout")
+	count := fs.Int("c", 0, "Stop after this many packets, unlimited by default")
+	program := fs.String("bpf", "", "Compiled capture filter, as printed by tcpdump -ddd with its lines joined by commas")
+	filter := fs.String("f", "", "Capture filter the program was compiled from, recorded in the file")
+	live := fs.Bool("live", false, "Print a summary of each packet on stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "capture-agent: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		return fail(fmt.Errorf("-w is required"))
+	}
+	// Written to stdout, the capture is streamed: every packet is flushed
+	// as it is captured, and stdout cannot carry the summaries.
+	streamed := *output == "-"
+	if streamed && *live {
+		return fail(fmt.Errorf("-live cannot be used with -w -"))
+	}
+	var instructions []bpf.RawInstruction
+	if *program != "" {
+		var err error
+		if instructions, err = parseBPFProgram(*program); err != nil {
+			return fail(err)
+		}
+	}
+	var ifaces []string
+	if *ifaceList != "" {
+		ifaces = strings.Split(*ifaceList, ",")
+	} else {
+		var err error
+		if ifaces, err = agentInterfaces(); err != nil {
+			return fail(err)
+		}
+	}
+	if len(ifaces) == 0 {
+		return fail(fmt.Errorf("no interface to capture on"))
+	}
+
+	// Every interface is opened before anything is written, so a bad one
+	// fails the start like it does with tshark.
+	sockets, err := openAgentSockets(ifaces, instructions)
+	if err != nil {
+		return fail(err)
+	}
+
+	f := os.Stdout
+	if !streamed {
+		if f, err = os.Create(*output); err != nil {
+			return fail(err)
+		}
+	}
+	w, err := pcapgo.NewNgWriterInterface(f, pcapgo.NgInterface{
+		Name:                ifaces[0],
+		Filter:              *filter,
+		OS:                  "linux",
+		LinkType:            layers.LinkTypeEthernet,
+		SnapLength:          agentSnapLength,
+		TimestampResolution: 9,
+	}, pcapgo.NgWriterOptions{SectionInfo: pcapgo.NgSectionInfo{Application: serverInfo.Name + " " + captureAgentCommand}})
+	if err != nil {
+		return fail(err)
+	}
+	for _, iface := range ifaces[1:] {
+		if _, err := w.AddInterface(pcapgo.NgInterface{Name: iface, Filter: *filter, OS: "linux", LinkType: layers.LinkTypeEthernet, SnapLength: agentSnapLength, TimestampResolution: 9}); err != nil {
+			return fail(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+
+	// mu serializes the writes; exiting with it held leaves the file ending
+	// with a complete packet.
+	var mu sync.Mutex
+	packets := 0
+	exit := func(code int) {
+		w.Flush()
+		f.Sync()
+		f.Close()
+		os.Exit(code)
+	}
+	for i, socket := range sockets {
+		go func() {
+			for {
+				data, ci, err := socket.ReadPacketData()
+				if err != nil {
+					mu.Lock()
+					fmt.Fprintf(os.Stderr, "capture-agent: %s: %v\n", ifaces[i], err)
+					exit(1)
+				}
+				if ci.Timestamp.IsZero() {
+					ci.Timestamp = time.Now()
+				}
+				ci.InterfaceIndex = i
+				mu.Lock()
+				if err := w.WritePacket(ci, data); err != nil {
+					fmt.Fprintf(os.Stderr, "capture-agent: writing %s: %v\n", *output, err)
+					exit(1)
+				}
+				packets++
+				if streamed {
+					if err := w.Flush(); err != nil {
+						// The reader of the stream went away.
+						exit(0)
+					}
+				}
+				if *live {
+					fmt.Println(agentSummary(packets, ifaces[i], data, ci))
+				}
+				if *count > 0 && packets >= *count {
+					exit(0)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+	mu.Lock()
+	exit(0)
+	return 0
+}
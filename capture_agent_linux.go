@@ -0,0 +1,32 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"golang.org/x/net/bpf"
+)
+
+// openAgentSockets opens an afpacket socket per interface, in promiscuous
+// mode, with the capture filter attached.
+func openAgentSockets(ifaces []string, instructions []bpf.RawInstruction) ([]gopacket.PacketDataSource, error) {
+	var sockets []gopacket.PacketDataSource
+	for _, iface := range ifaces {
+		h, err := pcapgo.NewEthernetHandle(iface)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.SetCaptureLength(agentSnapLength); err != nil {
+			return nil, err
+		}
+		if err := h.SetBPF(instructions); err != nil {
+			return nil, fmt.Errorf("attaching the filter on %s: %w", iface, err)
+		}
+		h.SetPromiscuous(true)
+		sockets = append(sockets, h)
+	}
+	return sockets, nil
+}
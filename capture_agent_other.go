@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"golang.org/x/net/bpf"
+)
+
+// openAgentSockets fails, afpacket sockets being specific to Linux.
+func openAgentSockets(ifaces []string, instructions []bpf.RawInstruction) ([]gopacket.PacketDataSource, error) {
+	return nil, fmt.Errorf("the capture agent needs afpacket sockets, only available on Linux")
+}
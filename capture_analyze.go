@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic starts every pcapng file, with its section header block.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// readCapture calls fn for every packet of a pcap or pcapng file, with the
+// link type of the interface it was captured on. Encrypted files are
+// decrypted with the key of the input.
+func readCapture(in captureInput, fn func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType)) error {
+	path := in.path
+	f, err := openCapture(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if bytes.Equal(magic, pcapngMagic) {
+		r, err := pcapgo.NewNgReader(br, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		for {
+			data, ci, err := r.ReadPacketData()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", path, err)
+			}
+			linkType := r.LinkType()
+			if len(ci.AncillaryData) > 0 {
+				if lt, ok := ci.AncillaryData[0].(layers.LinkType); ok {
+					linkType = lt
+				}
+			}
+			fn(data, ci, linkType)
+		}
+	}
+
+	r, err := pcapgo.NewReader(br)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		fn(data, ci, r.LinkType())
+	}
+}
+
+// wellKnownPorts names the application protocols of the fabric gopacket
+// has no decoder for.
+var wellKnownPorts = map[layers.TCPPort]string{
+	179: "BGP",
+}
+
+var wellKnownUDPPorts = map[layers.UDPPort]string{
+	3784: "BFD",
+	3785: "BFD",
+}
+
+// counter accumulates packets and bytes.
+type counter struct {
+	packets int
+	bytes   int
+}
+
+func (c *counter) add(length int) {
+	c.packets++
+	c.bytes += length
+}
+
+// captureSummary is the analysis of one or more capture files.
+type captureSummary struct {
+	packets   counter
+	first     time.Time
+	last      time.Time
+	protocols map[string]*counter
+	talkers   map[string]*counter
+	vlans     map[uint16]*counter
+	vnis      map[uint32]*counter
+	// innerTalkers counts the sources of the traffic carried in VXLAN.
+	innerTalkers map[string]*counter
+	// errors counts the packets reporting or being an error: ICMP errors,
+	// TCP resets and packets that could not be decoded.
+	errors map[string]*counter
+}
+
+func newCaptureSummary() *captureSummary {
+	return &captureSummary{
+		protocols:    make(map[string]*counter),
+		talkers:      make(map[string]*counter),
+		vlans:        make(map[uint16]*counter),
+		vnis:         make(map[uint32]*counter),
+		innerTalkers: make(map[string]*counter),
+		errors:       make(map[string]*counter),
+	}
+}
+
+func count[K comparable](m map[K]*counter, key K, length int) {
+	c, ok := m[key]
+	if !ok {
+		c = &counter{}
+		m[key] = c
+	}
+	c.add(length)
+}
+
+// add decodes a packet and accounts it. Protocols count the packets that
+// contain them at any depth, talkers the outer source address, and the
+// sources seen after a VXLAN header are accounted as inner talkers.
+func (c *captureSummary) add(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	length := ci.Length
+	c.packets.add(length)
+	if c.first.IsZero() || ci.Timestamp.Before(c.first) {
+		c.first = ci.Timestamp
+	}
+	if ci.Timestamp.After(c.last) {
+		c.last = ci.Timestamp
+	}
+
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	seen := make(map[string]bool)
+	inVXLAN := false
+	outerSource := ""
+	for _, layer := range packet.Layers() {
+		name := layer.LayerType().String()
+		switch l := layer.(type) {
+		case *layers.Dot1Q:
+			count(c.vlans, l.VLANIdentifier, length)
+		case *layers.VXLAN:
+			count(c.vnis, l.VNI, length)
+			inVXLAN = true
+		case *layers.IPv4:
+			if inVXLAN {
+				count(c.innerTalkers, l.SrcIP.String(), length)
+			} else if outerSource == "" {
+				outerSource = l.SrcIP.String()
+			}
+		case *layers.IPv6:
+			if inVXLAN {
+				count(c.innerTalkers, l.SrcIP.String(), length)
+			} else if outerSource == "" {
+				outerSource = l.SrcIP.String()
+			}
+		case *layers.TCP:
+			if l.RST {
+				count(c.errors, "TCP RST", length)
+			}
+			if app, ok := wellKnownPorts[l.SrcPort]; ok {
+				seen[app] = true
+			} else if app, ok := wellKnownPorts[l.DstPort]; ok {
+				seen[app] = true
+			}
+		case *layers.UDP:
+			if app, ok := wellKnownUDPPorts[l.DstPort]; ok {
+				seen[app] = true
+			}
+		case *layers.ICMPv4:
+			if kind := icmpErrorKind(l.TypeCode); kind != "" {
+				count(c.errors, kind, length)
+			}
+		case *layers.ICMPv6:
+			if kind := icmpv6ErrorKind(l.TypeCode); kind != "" {
+				count(c.errors, kind, length)
+			}
+		case *gopacket.DecodeFailure:
+			count(c.errors, "decode failure", length)
+			continue
+		case *gopacket.Payload:
+			continue
+		}
+		seen[name] = true
+	}
+	for name := range seen {
+		count(c.protocols, name, length)
+	}
+	if outerSource != "" {
+		count(c.talkers, outerSource, length)
+	}
+}
+
+// icmpErrorKind names the ICMP errors, or returns "" for the other messages.
+func icmpErrorKind(tc layers.ICMPv4TypeCode) string {
+	switch tc.Type() {
+	case layers.ICMPv4TypeDestinationUnreachable:
+		if tc.Code() == layers.ICMPv4CodeFragmentationNeeded {
+			return "ICMP fragmentation needed"
+		}
+		return "ICMP unreachable"
+	case layers.ICMPv4TypeTimeExceeded:
+		return "ICMP TTL exceeded"
+	case layers.ICMPv4TypeParameterProblem:
+		return "ICMP parameter problem"
+	}
+	return ""
+}
+
+// icmpv6ErrorKind names the ICMPv6 errors, or returns "" for the other
+// messages.
+func icmpv6ErrorKind(tc layers.ICMPv6TypeCode) string {
+	switch tc.Type() {
+	case layers.ICMPv6TypeDestinationUnreachable:
+		return "ICMPv6 unreachable"
+	case layers.ICMPv6TypePacketTooBig:
+		return "ICMPv6 packet too big"
+	case layers.ICMPv6TypeTimeExceeded:
+		return "ICMPv6 hop limit exceeded"
+	case layers.ICMPv6TypeParameterProblem:
+		return "ICMPv6 parameter problem"
+	}
+	return ""
+}
+
+// sortedCounters returns the keys of m, busiest first.
+func sortedCounters[K comparable](m map[K]*counter, less func(a, b K) bool) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := m[keys[i]], m[keys[j]]
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		return less(keys[i], keys[j])
+	})
+	return keys
+}
+
+// captureInput is a capture file to analyze, with the node it was captured
+// on when known, and the key decrypting it when it is encrypted.
+type captureInput struct {
+	node string
+	path string
+	key  *ecdh.PrivateKey
+}
+
+// captureInputs resolves the capture_id, node, file and key_path arguments
+// of the capture analysis tools to the files to read.
+func (s *MCPServer) captureInputs(args map[string]any) ([]captureInput, error) {
+	inputs, err := s.resolveCaptureInputs(args)
+	if err != nil {
+		return nil, err
+	}
+	var key *ecdh.PrivateKey
+	if keyPath, _ := args["key_path"].(string); keyPath != "" {
+		if key, err = loadCaptureKey(keyPath); err != nil {
+			return nil, err
+		}
+	}
+	for i := range inputs {
+		if key == nil && isEncryptedCapture(inputs[i].path) {
+			return nil, fmt.Errorf("%s is encrypted, pass key_path with the capture decryption key.", inputs[i].path)
+		}
+		inputs[i].key = key
+	}
+	return inputs, nil
+}
+
+func (s *MCPServer) resolveCaptureInputs(args map[string]any) ([]captureInput, error) {
+	captureID, _ := args["capture_id"].(string)
+	file, _ := args["file"].(string)
+	switch {
+	case (captureID == "") == (file == ""):
+		return nil, errors.New("exactly one of capture_id or file is required")
+	case file != "":
+		return []captureInput{{path: file}}, nil
+	}
+
+	var capture *captureStatus
+	for _, st := range s.captureStatuses("") {
+		if st.CaptureID == captureID {
+			capture = st
+		}
+	}
+	if capture == nil {
+		return nil, fmt.Errorf("No recent capture %s found, pass the pcap path as file instead.", captureID)
+	}
+	if capture.running {
+		return nil, fmt.Errorf("Capture %s is still running, stop it first so its files are copied out.", captureID)
+	}
+	nodes := capture.Nodes
+	if glob, _ := args["node"].(string); glob != "" {
+		nodes = matchRouters(nodes, glob)
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("No node of capture %s matches %q (nodes: %s)", captureID, glob, strings.Join(capture.Nodes, ", "))
+		}
+	}
+	var inputs []captureInput
+	for _, node := range nodes {
+		for _, path := range capturedFiles(capture.OutputDir, capture.nodeFilter(node), node) {
+			inputs = append(inputs, captureInput{node: node, path: path})
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("Capture %s left no file in %s", captureID, capture.OutputDir)
+	}
+	return inputs, nil
+}
+
+func (s *MCPServer) analyzeCapture(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	top := 10
+	if v, ok := args["top"].(float64); ok && v > 0 {
+		top = int(v)
+	}
+
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	summary := newCaptureSummary()
+	files := newTable("files", "node", "file", "packets", "bytes")
+	var perFile []string
+	for _, in := range inputs {
+		var c counter
+		err := readCapture(in, func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+			summary.add(data, ci, linkType)
+			c.add(ci.Length)
+		})
+		if err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+		var node any
+		if in.node != "" {
+			node = in.node
+		}
+		files.add(node, in.path, c.packets, c.bytes)
+		perFile = append(perFile, fmt.Sprintf("  %s: %d packets\n", filepath.Base(in.path), c.packets))
+	}
+
+	var b strings.Builder
+	var fields record
+	fields.add("packets", summary.packets.packets)
+	fields.add("bytes", summary.packets.bytes)
+	if summary.packets.packets == 0 {
+		fields.add("first", nil)
+		fields.add("last", nil)
+		fields.add("duration", nil)
+		fmt.Fprintf(&b, "No packet in %d file(s).\n", len(inputs))
+	} else {
+		duration := summary.last.Sub(summary.first)
+		fields.add("first", summary.first.UTC().Format(time.RFC3339Nano))
+		fields.add("last", summary.last.UTC().Format(time.RFC3339Nano))
+		fields.add("duration", duration.String())
+		fmt.Fprintf(&b, "%d packets, %s in %d file(s), from %s to %s (%s)\n", summary.packets.packets, formatSize(int64(summary.packets.bytes)),
+			len(inputs), summary.first.Format("2006-01-02 15:04:05.000"), summary.last.Format("2006-01-02 15:04:05.000"), duration)
+	}
+
+	protocols := newTable("protocols", "protocol", "packets", "bytes")
+	b.WriteString("\nProtocols:\n")
+	for _, name := range sortedCounters(summary.protocols, func(a, b string) bool { return a < b }) {
+		c := summary.protocols[name]
+		protocols.add(name, c.packets, c.bytes)
+		fmt.Fprintf(&b, "  %-16s %8d packets %10s\n", name, c.packets, formatSize(int64(c.bytes)))
+	}
+
+	talkers := newTable("talkers", "source", "packets", "bytes")
+	b.WriteString("\nTop talkers (outer source address):\n")
+	for i, addr := range sortedCounters(summary.talkers, func(a, b string) bool { return a < b }) {
+		if i == top {
+			break
+		}
+		c := summary.talkers[addr]
+		talkers.add(addr, c.packets, c.bytes)
+		fmt.Fprintf(&b, "  %-40s %8d packets %10s\n", addr, c.packets, formatSize(int64(c.bytes)))
+	}
+
+	vlans := newTable("vlans", "vlan", "packets", "bytes")
+	if len(summary.vlans) > 0 {
+		b.WriteString("\nVLANs:\n")
+		for _, id := range sortedCounters(summary.vlans, func(a, b uint16) bool { return a < b }) {
+			c := summary.vlans[id]
+			vlans.add(id, c.packets, c.bytes)
+			fmt.Fprintf(&b, "  %-6d %8d packets %10s\n", id, c.packets, formatSize(int64(c.bytes)))
+		}
+	}
+
+	vnis := newTable("vnis", "vni", "packets", "bytes")
+	if len(summary.vnis) > 0 {
+		b.WriteString("\nVXLAN VNIs:\n")
+		for _, vni := range sortedCounters(summary.vnis, func(a, b uint32) bool { return a < b }) {
+			c := summary.vnis[vni]
+			vnis.add(vni, c.packets, c.bytes)
+			fmt.Fprintf(&b, "  %-8d %8d packets %10s\n", vni, c.packets, formatSize(int64(c.bytes)))
+		}
+	}
+
+	innerTalkers := newTable("inner_talkers", "source", "packets", "bytes")
+	if len(summary.innerTalkers) > 0 {
+		b.WriteString("\nTop talkers inside VXLAN:\n")
+		for i, addr := range sortedCounters(summary.innerTalkers, func(a, b string) bool { return a < b }) {
+			if i == top {
+				break
+			}
+			c := summary.innerTalkers[addr]
+			innerTalkers.add(addr, c.packets, c.bytes)
+			fmt.Fprintf(&b, "  %-40s %8d packets %10s\n", addr, c.packets, formatSize(int64(c.bytes)))
+		}
+	}
+
+	if len(inputs) > 1 {
+		b.WriteString("\nFiles:\n" + strings.Join(perFile, ""))
+	}
+
+	return formattedResult(format, b.String(), false, fields, files, protocols, talkers, vlans, vnis, innerTalkers)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// archiveManifestName is the manifest at the root of a capture archive.
+	archiveManifestName = "MANIFEST.json"
+	archiveMimeType     = "application/gzip"
+)
+
+// archiveFileName is the name of the archive of a capture directory, made
+// from the capture ID when known.
+func archiveFileName(dir, captureID string) string {
+	if captureID == "" {
+		captureID = filepath.Base(dir)
+	}
+	return "archive_" + captureID + ".tar.gz"
+}
+
+// isArchive tells whether a file of a capture directory is an archive, or
+// one being written, which are never archived themselves.
+func isArchive(name string) bool {
+	return strings.HasPrefix(name, "archive_") && (strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.gz.tmp"))
+}
+
+// writeCaptureArchive writes the files of a capture directory, prefixed by
+// its name and preceded by the manifest, to a gzipped tarball.
+func writeCaptureArchive(path string, manifest *captureManifest) error {
+	prefix := filepath.Base(manifest.Directory)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    prefix + "/" + archiveManifestName,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: manifest.Created,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, entry := range manifest.Files {
+		if err := addArchiveFile(tw, filepath.Join(manifest.Directory, entry.Path), prefix+"/"+filepath.ToSlash(entry.Path), entry.Bytes); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// addArchiveFile copies a file to the archive, as many bytes as the
+// manifest recorded in case it grew since.
+func addArchiveFile(tw *tar.Writer, path, name string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, size)
+	return err
+}
+
+// createCaptureArchive archives the directory of a finished capture, given
+// by its ID or path, into the directory itself. It returns the archive path
+// and its manifest. Only the captures of the session are found, or of any
+// session when sessionID is empty.
+func (s *MCPServer) createCaptureArchive(sessionID, captureID, dir string) (string, *captureManifest, error) {
+	var call *ActiveCall
+	if captureID != "" {
+		var st *captureStatus
+		for _, c := range s.captureStatuses(sessionID) {
+			if c.CaptureID == captureID {
+				st = c
+			}
+		}
+		if st == nil && sessionID != "" {
+			return "", nil, fmt.Errorf("no recent capture %s found for this session", captureID)
+		}
+		if st == nil {
+			return "", nil, fmt.Errorf("no recent capture %s found", captureID)
+		}
+		if st.running {
+			return "", nil, fmt.Errorf("capture %s is still running, stop it first so its files are copied out", captureID)
+		}
+		call = &st.ActiveCall
+		dir = st.OutputDir
+	} else {
+		// Only capture directories are archived, not arbitrary paths.
+		rel, err := filepath.Rel(captureRoot, filepath.Clean(dir))
+		parts := strings.Split(rel, string(filepath.Separator))
+		if err != nil || len(parts) != 2 || parts[0] == ".." || !strings.HasPrefix(parts[1], "capture_") {
+			return "", nil, fmt.Errorf("output_dir %q is not a capture directory under %s/<session>/", dir, captureRoot)
+		}
+		if sessionID != "" && parts[0] != sessionID {
+			return "", nil, fmt.Errorf("output_dir %q is not a capture directory of this session, under %s", dir, filepath.Join(captureRoot, sessionID))
+		}
+		for _, c := range s.sessionCaptures("") {
+			if filepath.Clean(c.OutputDir) == filepath.Clean(dir) {
+				return "", nil, fmt.Errorf("capture %s is still writing to %s, stop it first", c.CaptureID, dir)
+			}
+		}
+	}
+	dir = filepath.Clean(dir)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", nil, fmt.Errorf("capture directory %s not found, it may have been cleaned up", dir)
+	}
+	manifest, err := buildCaptureManifest(call, dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(manifest.Files) == 0 {
+		return "", nil, fmt.Errorf("capture directory %s is empty", dir)
+	}
+
+	path := filepath.Join(dir, archiveFileName(dir, manifest.CaptureID))
+	if err := writeCaptureArchive(path, manifest); err != nil {
+		return "", nil, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return path, manifest, nil
+}
+
+// archiveSession returns the session whose capture:// resources include an
+// archive, empty for an archive outside the capture directories.
+func archiveSession(path string) string {
+	rel, err := filepath.Rel(captureRoot, path)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) != 3 || parts[0] == ".." {
+		return ""
+	}
+	return parts[0]
+}
+
+func (s *MCPServer) archiveCapture(sessionID string, args map[string]any) CallToolResult {
+	captureID, _ := args["capture_id"].(string)
+	dir, _ := args["output_dir"].(string)
+	if (captureID == "") == (dir == "") {
+		return toolError("exactly one of capture_id and output_dir is required")
+	}
+	scope := sessionID
+	if allSessions, ok := args["all_sessions"].(bool); ok && allSessions {
+		scope = ""
+	}
+	path, manifest, err := s.createCaptureArchive(scope, captureID, dir)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error archiving the capture: %v", err))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	dir = manifest.Directory
+
+	kinds := make(map[string]int)
+	var total int64
+	for _, f := range manifest.Files {
+		kinds[f.Kind]++
+		total += f.Bytes
+	}
+	var counts []string
+	for _, kind := range []string{"pcap", "log", "control_plane", "live", "other"} {
+		if kinds[kind] > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", kinds[kind], kind))
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "✓ Archived %d file(s) (%s) of %s into %s (%s, %s uncompressed)\n",
+		len(manifest.Files), strings.Join(counts, ", "), dir, path, formatSize(info.Size()), formatSize(total))
+	// Sessions only read their own resources.
+	if s.demo == nil && archiveSession(path) == sessionID {
+		fmt.Fprintf(&b, "Resource: capture://%s/archive/%s\n", sessionID, filepath.Base(path))
+	}
+	if kinds["control_plane"] == 0 {
+		b.WriteString("Note: no control-plane snapshot was found in the directory.\n")
+	}
+	if kinds["log"] == 0 {
+		b.WriteString("Note: no capture log was found in the directory, it was captured before logs were kept.\n")
+	}
+	fmt.Fprintf(&b, "\nThe archive starts with %s, listing every file with its node, size and SHA-256.\n", archiveManifestName)
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: b.String()}}}
+}
+
+type captureArchiveFile struct {
+	session string
+	name    string
+	path    string
+}
+
+// listCaptureArchives returns the archives written by archive_capture under
+// the per-session capture directories.
+func listCaptureArchives() []captureArchiveFile {
+	matches, _ := filepath.Glob(filepath.Join(captureRoot, "*", "capture_*", "archive_*.tar.gz"))
+	var files []captureArchiveFile
+	for _, m := range matches {
+		session := filepath.Base(filepath.Dir(filepath.Dir(m)))
+		files = append(files, captureArchiveFile{session: session, name: filepath.Base(m), path: m})
+	}
+	return files
+}
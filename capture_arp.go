@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// fabricAddresses returns the routers owning each MAC and IP address
+// configured in the network namespaces FRR programs. Routers that cannot be
+// queried are skipped; an error is returned only if none can.
+func fabricAddresses() (macs, ips map[string][]string, err error) {
+	routers, err := fabricRouters()
+	if err != nil {
+		return nil, nil, err
+	}
+	macs, ips = make(map[string][]string), make(map[string][]string)
+	var lastErr error
+	queried := 0
+	for _, router := range routers {
+		out, err := runInRouterNetns(router, "ip", "-j", "addr", "show")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var links []struct {
+			Address  string `json:"address"`
+			AddrInfo []struct {
+				Local string `json:"local"`
+			} `json:"addr_info"`
+		}
+		if err := json.Unmarshal(out, &links); err != nil {
+			lastErr = fmt.Errorf("parsing addresses of %s: %w", router, err)
+			continue
+		}
+		name := strings.TrimPrefix(router, clabContainerPrefix)
+		for _, l := range links {
+			if l.Address != "" && l.Address != "00:00:00:00:00:00" && !containsString(macs[l.Address], name) {
+				macs[l.Address] = append(macs[l.Address], name)
+			}
+			for _, a := range l.AddrInfo {
+				if !containsString(ips[a.Local], name) {
+					ips[a.Local] = append(ips[a.Local], name)
+				}
+			}
+		}
+		queried++
+	}
+	if queried == 0 && lastErr != nil {
+		return nil, nil, lastErr
+	}
+	return macs, ips, nil
+}
+
+// neighKey is an address resolved in a broadcast domain: a VNI, a VLAN or
+// the untagged segment of the capture.
+type neighKey struct {
+	domain string
+	ip     netip.Addr
+}
+
+// neighQuery accounts the ARP requests or neighbor solicitations for an
+// address.
+type neighQuery struct {
+	requests    int
+	requesters  map[string]bool
+	first, last time.Time
+}
+
+// neighEvent is a gratuitous ARP, an unsolicited neighbor advertisement or a
+// duplicate address detection probe.
+type neighEvent struct {
+	time   time.Time
+	domain string
+	kind   string
+	ip     netip.Addr
+	mac    string
+}
+
+// neighSummary is the analysis of the ARP and neighbor discovery traffic of
+// capture files.
+type neighSummary struct {
+	arpRequests, arpReplies       int
+	solicitations, advertisements int
+	queries                       map[neighKey]*neighQuery
+	// answers counts, per address, the replies and advertisements of each
+	// MAC claiming it, gratuitous ones included.
+	answers map[neighKey]map[string]int
+	// replied holds, per MAC, the addresses it answered requests for.
+	replied map[string]map[neighKey]bool
+	events  []neighEvent
+	// probers are the MACs probing each address before using it.
+	probers map[neighKey]map[string]bool
+}
+
+func newNeighSummary() *neighSummary {
+	return &neighSummary{
+		queries: make(map[neighKey]*neighQuery),
+		answers: make(map[neighKey]map[string]int),
+		replied: make(map[string]map[neighKey]bool),
+		probers: make(map[neighKey]map[string]bool),
+	}
+}
+
+func (n *neighSummary) query(key neighKey, requester string, at time.Time) {
+	q, ok := n.queries[key]
+	if !ok {
+		q = &neighQuery{requesters: make(map[string]bool), first: at}
+		n.queries[key] = q
+	}
+	q.requests++
+	q.requesters[requester] = true
+	if at.Before(q.first) {
+		q.first = at
+	}
+	if at.After(q.last) {
+		q.last = at
+	}
+}
+
+func (n *neighSummary) probe(key neighKey, mac string, at time.Time, kind string) {
+	if n.probers[key] == nil {
+		n.probers[key] = make(map[string]bool)
+	}
+	n.probers[key][mac] = true
+	n.events = append(n.events, neighEvent{time: at, domain: key.domain, kind: kind, ip: key.ip, mac: mac})
+}
+
+func (n *neighSummary) answer(key neighKey, mac string, solicited bool) {
+	if n.answers[key] == nil {
+		n.answers[key] = make(map[string]int)
+	}
+	n.answers[key][mac]++
+	if solicited {
+		if n.replied[mac] == nil {
+			n.replied[mac] = make(map[neighKey]bool)
+		}
+		n.replied[mac][key] = true
+	}
+}
+
+// add decodes a packet and accounts its ARP or neighbor discovery message,
+// in the domain of the innermost VXLAN or 802.1Q header.
+func (n *neighSummary) add(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	domain := ""
+	var ethSrc string
+	var ipSrc netip.Addr
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.VXLAN:
+			domain = fmt.Sprintf("vni %d", l.VNI)
+		case *layers.Dot1Q:
+			domain = fmt.Sprintf("vlan %d", l.VLANIdentifier)
+		case *layers.Ethernet:
+			ethSrc = l.SrcMAC.String()
+		case *layers.IPv6:
+			ipSrc, _ = netip.AddrFromSlice(l.SrcIP)
+		case *layers.ARP:
+			n.addARP(domain, l, ci.Timestamp)
+		case *layers.ICMPv6NeighborSolicitation:
+			n.solicitations++
+			target, _ := netip.AddrFromSlice(l.TargetAddress)
+			key := neighKey{domain: domain, ip: target}
+			if !ipSrc.IsValid() || ipSrc.IsUnspecified() {
+				n.probe(key, ethSrc, ci.Timestamp, "DAD probe")
+				continue
+			}
+			n.query(key, ipSrc.String(), ci.Timestamp)
+		case *layers.ICMPv6NeighborAdvertisement:
+			n.advertisements++
+			target, _ := netip.AddrFromSlice(l.TargetAddress)
+			mac := ethSrc
+			for _, opt := range l.Options {
+				if opt.Type == layers.ICMPv6OptTargetAddress && len(opt.Data) == 6 {
+					mac = net.HardwareAddr(opt.Data).String()
+				}
+			}
+			key := neighKey{domain: domain, ip: target}
+			n.answer(key, mac, l.Solicited())
+			if !l.Solicited() {
+				n.events = append(n.events, neighEvent{time: ci.Timestamp, domain: domain, kind: "unsolicited NA", ip: target, mac: mac})
+			}
+		}
+	}
+}
+
+func (n *neighSummary) addARP(domain string, arp *layers.ARP, at time.Time) {
+	sender, _ := netip.AddrFromSlice(arp.SourceProtAddress)
+	target, _ := netip.AddrFromSlice(arp.DstProtAddress)
+	mac := net.HardwareAddr(arp.SourceHwAddress).String()
+	switch {
+	case arp.Operation == layers.ARPRequest && sender.IsUnspecified():
+		// An ARP probe (RFC 5227): the IPv4 duplicate address detection.
+		n.arpRequests++
+		n.probe(neighKey{domain: domain, ip: target}, mac, at, "ARP probe")
+	case sender == target:
+		if arp.Operation == layers.ARPRequest {
+			n.arpRequests++
+		} else {
+			n.arpReplies++
+		}
+		n.answer(neighKey{domain: domain, ip: sender}, mac, false)
+		n.events = append(n.events, neighEvent{time: at, domain: domain, kind: "gratuitous ARP", ip: sender, mac: mac})
+	case arp.Operation == layers.ARPRequest:
+		n.arpRequests++
+		n.query(neighKey{domain: domain, ip: target}, sender.String(), at)
+	case arp.Operation == layers.ARPReply:
+		n.arpReplies++
+		n.answer(neighKey{domain: domain, ip: sender}, mac, true)
+	}
+}
+
+// sortedNeighKeys returns keys ordered by domain, then address.
+func sortedNeighKeys[V any](m map[neighKey]V) []neighKey {
+	keys := make([]neighKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].domain != keys[j].domain {
+			return keys[i].domain < keys[j].domain
+		}
+		return keys[i].ip.Less(keys[j].ip)
+	})
+	return keys
+}
+
+func domainName(domain string) string {
+	if domain == "" {
+		return "untagged"
+	}
+	return domain
+}
+
+func (s *MCPServer) analyzeARP(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	summary := newNeighSummary()
+	for _, in := range inputs {
+		if err := readCapture(in, summary.add); err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+	}
+	sort.SliceStable(summary.events, func(i, j int) bool { return summary.events[i].time.Before(summary.events[j].time) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d ARP requests, %d ARP replies, %d neighbor solicitations, %d neighbor advertisements in %d file(s)\n",
+		summary.arpRequests, summary.arpReplies, summary.solicitations, summary.advertisements, len(inputs))
+	routerMACs, routerIPs, fabricErr := fabricAddresses()
+	if fabricErr != nil {
+		fmt.Fprintf(&b, "Router addresses unknown, proxy replies are guessed from MACs answering for several addresses: %v\n", fabricErr)
+	}
+	var findings []string
+
+	unanswered := newTable("unanswered", "domain", "address", "requests", "requesters", "first", "last")
+	b.WriteString("\nUnanswered requests:\n")
+	for _, key := range sortedNeighKeys(summary.queries) {
+		if len(summary.answers[key]) > 0 {
+			continue
+		}
+		q := summary.queries[key]
+		requesters := make([]string, 0, len(q.requesters))
+		for r := range q.requesters {
+			requesters = append(requesters, r)
+		}
+		sort.Strings(requesters)
+		unanswered.add(domainName(key.domain), key.ip.String(), q.requests, requesters,
+			q.first.UTC().Format(time.RFC3339Nano), q.last.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(&b, "  %-9s %-39s %4d request(s) from %s\n", domainName(key.domain), key.ip, q.requests, strings.Join(requesters, ", "))
+	}
+	if len(unanswered.Rows) == 0 {
+		b.WriteString("  none\n")
+	} else {
+		findings = append(findings, fmt.Sprintf("%d address(es) requested but never answered", len(unanswered.Rows)))
+	}
+
+	events := newTable("gratuitous", "time", "domain", "kind", "address", "mac")
+	b.WriteString("\nGratuitous ARPs, unsolicited advertisements and DAD probes:\n")
+	for _, e := range summary.events {
+		events.add(e.time.UTC().Format(time.RFC3339Nano), domainName(e.domain), e.kind, e.ip.String(), e.mac)
+		fmt.Fprintf(&b, "  %s %-9s %-15s %-39s from %s\n", e.time.Format("15:04:05.000"), domainName(e.domain), e.kind, e.ip, e.mac)
+	}
+	if len(summary.events) == 0 {
+		b.WriteString("  none\n")
+	}
+
+	// Duplicate addresses: claimed by several MACs, or by another MAC than
+	// the one probing it.
+	duplicates := newTable("duplicates", "domain", "address", "macs", "probe_answered")
+	b.WriteString("\nDuplicate-address indications:\n")
+	for _, key := range sortedNeighKeys(summary.answers) {
+		claims := summary.answers[key]
+		probeAnswered := false
+		macs := make([]string, 0, len(claims))
+		for mac := range claims {
+			macs = append(macs, mac)
+			if probers := summary.probers[key]; len(probers) > 0 && !probers[mac] {
+				probeAnswered = true
+			}
+		}
+		if len(claims) < 2 && !probeAnswered {
+			continue
+		}
+		sort.Strings(macs)
+		duplicates.add(domainName(key.domain), key.ip.String(), macs, probeAnswered)
+		detail := fmt.Sprintf("claimed by %s", strings.Join(macs, ", "))
+		if probeAnswered {
+			detail += ", while being probed for duplicate address detection"
+		}
+		fmt.Fprintf(&b, "  %-9s %-39s %s\n", domainName(key.domain), key.ip, detail)
+		findings = append(findings, fmt.Sprintf("%s %s %s", domainName(key.domain), key.ip, detail))
+	}
+	if len(duplicates.Rows) == 0 {
+		b.WriteString("  none\n")
+	}
+
+	// Proxy replies: a router MAC answering for addresses the router does
+	// not own, or without router addresses, a MAC answering for several.
+	proxies := newTable("proxy_replies", "mac", "router", "domain", "addresses")
+	b.WriteString("\nProxy replies:\n")
+	macs := make([]string, 0, len(summary.replied))
+	for mac := range summary.replied {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	for _, mac := range macs {
+		routers := routerMACs[mac]
+		byDomain := make(map[string][]string)
+		var domains []string
+		for _, key := range sortedNeighKeys(summary.replied[mac]) {
+			if fabricErr == nil && (len(routers) == 0 || len(routerIPs[key.ip.String()]) > 0) {
+				continue
+			}
+			if byDomain[key.domain] == nil {
+				domains = append(domains, key.domain)
+			}
+			byDomain[key.domain] = append(byDomain[key.domain], key.ip.String())
+		}
+		for _, domain := range domains {
+			addrs := byDomain[domain]
+			if fabricErr != nil && len(addrs) < 2 {
+				continue
+			}
+			var router any
+			owner := "unknown owner"
+			if len(routers) > 0 {
+				router = strings.Join(routers, ", ")
+				owner = strings.Join(routers, ", ")
+			}
+			proxies.add(mac, router, domainName(domain), addrs)
+			fmt.Fprintf(&b, "  %s (%s) in %s answers for %s\n", mac, owner, domainName(domain), strings.Join(addrs, ", "))
+		}
+	}
+	if len(proxies.Rows) == 0 {
+		b.WriteString("  none\n")
+	}
+
+	b.WriteString("\n")
+	if len(findings) == 0 {
+		b.WriteString("✓ Every request answered, no duplicate address\n")
+	} else {
+		b.WriteString("✗ Findings:\n")
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  - %s\n", f)
+		}
+	}
+
+	var fields record
+	fields.add("arp_requests", summary.arpRequests)
+	fields.add("arp_replies", summary.arpReplies)
+	fields.add("neighbor_solicitations", summary.solicitations)
+	fields.add("neighbor_advertisements", summary.advertisements)
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, unanswered, events, duplicates, proxies)
+}
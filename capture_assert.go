@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// defaultAssertFrames is the number of matching frames listed per
+// expectation, when not given.
+const defaultAssertFrames = 5
+
+// trafficExpectation is one declarative check of assert_traffic: packets
+// matching every field given must have been seen, between min_packets and
+// max_packets times.
+type trafficExpectation struct {
+	Name string `json:"name"`
+
+	// Protocol is icmp (v4 or v6), tcp or udp, any IP packet when empty.
+	Protocol string `json:"protocol"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	SrcPort  int    `json:"src_port"`
+	DstPort  int    `json:"dst_port"`
+	VNI      int    `json:"vni"`
+	// Encapsulated selects the packets carried in VXLAN, or the bare ones.
+	Encapsulated *bool `json:"encapsulated"`
+	// SeenOn is the glob of the capture nodes the packets must be seen on.
+	SeenOn string `json:"seen_on"`
+
+	MinPackets *int `json:"min_packets"`
+	MaxPackets *int `json:"max_packets"`
+
+	src, dst netip.Prefix
+}
+
+// parseEndpoint parses an address or a prefix into a prefix.
+func parseEndpoint(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+func (e *trafficExpectation) validate() error {
+	e.Protocol = strings.ToLower(e.Protocol)
+	switch e.Protocol {
+	case "", "icmp", "tcp", "udp":
+	default:
+		return fmt.Errorf("invalid protocol %q, expected icmp, tcp or udp", e.Protocol)
+	}
+	for _, ep := range []struct {
+		name, value string
+		prefix      *netip.Prefix
+	}{{"src", e.Src, &e.src}, {"dst", e.Dst, &e.dst}} {
+		if ep.value == "" {
+			continue
+		}
+		p, err := parseEndpoint(ep.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: expected an address or a prefix", ep.name, ep.value)
+		}
+		*ep.prefix = p
+	}
+	if (e.SrcPort != 0 || e.DstPort != 0) && e.Protocol != "tcp" && e.Protocol != "udp" {
+		return fmt.Errorf("src_port and dst_port require protocol tcp or udp")
+	}
+	for name, port := range map[string]int{"src_port": e.SrcPort, "dst_port": e.DstPort} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("%s must be between 1 and 65535", name)
+		}
+	}
+	if e.VNI < 0 || e.VNI >= 1<<24 {
+		return fmt.Errorf("vni must be between 1 and 16777215")
+	}
+	if e.VNI != 0 && e.Encapsulated != nil && !*e.Encapsulated {
+		return fmt.Errorf("vni requires the packets to be encapsulated")
+	}
+	if _, err := path.Match(e.SeenOn, ""); err != nil {
+		return fmt.Errorf("invalid seen_on glob %q", e.SeenOn)
+	}
+	if e.MinPackets != nil && *e.MinPackets < 0 || e.MaxPackets != nil && *e.MaxPackets < 0 {
+		return fmt.Errorf("min_packets and max_packets must not be negative")
+	}
+	if e.MinPackets != nil && e.MaxPackets != nil && *e.MaxPackets < *e.MinPackets {
+		return fmt.Errorf("max_packets is below min_packets")
+	}
+	return nil
+}
+
+// bounds returns the packet counts the expectation accepts, max being -1
+// when unbounded. Without either, at least one packet is expected.
+func (e *trafficExpectation) bounds() (lo, hi int) {
+	lo, hi = 1, -1
+	if e.MaxPackets != nil {
+		lo, hi = 0, *e.MaxPackets
+	}
+	if e.MinPackets != nil {
+		lo = *e.MinPackets
+	}
+	return lo, hi
+}
+
+func (e *trafficExpectation) expected() string {
+	lo, hi := e.bounds()
+	switch {
+	case hi < 0:
+		return fmt.Sprintf("at least %d", lo)
+	case lo == hi:
+		return fmt.Sprintf("exactly %d", lo)
+	case lo == 0:
+		return fmt.Sprintf("at most %d", hi)
+	}
+	return fmt.Sprintf("%d to %d", lo, hi)
+}
+
+// title names an expectation in the report, as a sentence.
+func (e *trafficExpectation) title() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	what := "IP"
+	if e.Protocol != "" {
+		what = strings.ToUpper(e.Protocol)
+	}
+	endpoint := func(prefix string, port int) string {
+		if prefix == "" {
+			prefix = "any"
+		}
+		if port != 0 {
+			return fmt.Sprintf("%s port %d", prefix, port)
+		}
+		return prefix
+	}
+	if e.Src != "" || e.SrcPort != 0 {
+		what += " from " + endpoint(e.Src, e.SrcPort)
+	}
+	if e.Dst != "" || e.DstPort != 0 {
+		what += " to " + endpoint(e.Dst, e.DstPort)
+	}
+	switch {
+	case e.VNI != 0:
+		what += fmt.Sprintf(" encapsulated in VNI %d", e.VNI)
+	case e.Encapsulated != nil && *e.Encapsulated:
+		what += " encapsulated in VXLAN"
+	case e.Encapsulated != nil:
+		what += " outside VXLAN"
+	}
+	if e.SeenOn != "" {
+		what += " seen on " + e.SeenOn
+	}
+	return what
+}
+
+// observedPacket is what the expectations are checked against: the
+// addresses of the packet, the inner ones when it is carried in VXLAN.
+type observedPacket struct {
+	protocol         string
+	src, dst         netip.Addr
+	srcPort, dstPort int
+	encap            bool
+	vni              uint32
+	outerSrc         netip.Addr
+	outerDst         netip.Addr
+	info             string
+}
+
+// observePacket decodes a packet, returning false when it carries no IP.
+// The first IP header after the VXLAN one is the inner packet, so that the
+// packet quoted by an ICMP error does not count.
+func observePacket(data []byte, linkType layers.LinkType) (observedPacket, bool) {
+	var p observedPacket
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	ipSeen := false
+	setIP := func(src, dst []byte) {
+		s, _ := netip.AddrFromSlice(src)
+		d, _ := netip.AddrFromSlice(dst)
+		switch {
+		case !ipSeen:
+			p.src, p.dst = s.Unmap(), d.Unmap()
+			ipSeen = true
+		case p.encap && !p.outerSrc.IsValid():
+			p.outerSrc, p.outerDst = p.src, p.dst
+			p.src, p.dst = s.Unmap(), d.Unmap()
+		}
+	}
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.VXLAN:
+			if !p.encap {
+				p.encap, p.vni = true, l.VNI
+				p.protocol, p.srcPort, p.dstPort, p.info = "", 0, 0, ""
+			}
+		case *layers.IPv4:
+			setIP(l.SrcIP, l.DstIP)
+		case *layers.IPv6:
+			setIP(l.SrcIP, l.DstIP)
+		case *layers.TCP:
+			if p.protocol == "" {
+				p.protocol, p.srcPort, p.dstPort = "tcp", int(l.SrcPort), int(l.DstPort)
+			}
+		case *layers.UDP:
+			if p.protocol == "" {
+				p.protocol, p.srcPort, p.dstPort = "udp", int(l.SrcPort), int(l.DstPort)
+			}
+		case *layers.ICMPv4:
+			if p.protocol == "" {
+				p.protocol, p.info = "icmp", l.TypeCode.String()
+			}
+		case *layers.ICMPv6:
+			if p.protocol == "" {
+				p.protocol, p.info = "icmp", l.TypeCode.String()
+			}
+		}
+	}
+	if p.encap && !p.outerSrc.IsValid() {
+		// VXLAN without an inner IP packet, such as ARP.
+		p.outerSrc, p.outerDst = p.src, p.dst
+		p.src, p.dst = netip.Addr{}, netip.Addr{}
+		p.protocol = ""
+	}
+	return p, p.src.IsValid()
+}
+
+func (p observedPacket) String() string {
+	var b strings.Builder
+	switch p.protocol {
+	case "tcp", "udp":
+		fmt.Fprintf(&b, "%s %s -> %s", strings.ToUpper(p.protocol),
+			netip.AddrPortFrom(p.src, uint16(p.srcPort)), netip.AddrPortFrom(p.dst, uint16(p.dstPort)))
+	case "icmp":
+		fmt.Fprintf(&b, "ICMP %s -> %s %s", p.src, p.dst, p.info)
+	default:
+		fmt.Fprintf(&b, "IP %s -> %s", p.src, p.dst)
+	}
+	if p.encap {
+		fmt.Fprintf(&b, " in VNI %d (%s -> %s)", p.vni, p.outerSrc, p.outerDst)
+	}
+	return b.String()
+}
+
+// matches tells whether a packet seen on a node meets an expectation.
+func (e *trafficExpectation) matches(node string, p observedPacket) bool {
+	switch {
+	case e.Protocol != "" && p.protocol != e.Protocol,
+		e.src.IsValid() && !e.src.Contains(p.src),
+		e.dst.IsValid() && !e.dst.Contains(p.dst),
+		e.SrcPort != 0 && p.srcPort != e.SrcPort,
+		e.DstPort != 0 && p.dstPort != e.DstPort,
+		e.VNI != 0 && (!p.encap || p.vni != uint32(e.VNI)),
+		e.Encapsulated != nil && p.encap != *e.Encapsulated:
+		return false
+	}
+	return e.SeenOn == "" || len(matchRouters([]string{node}, e.SeenOn)) > 0
+}
+
+// matchedFrame is a frame meeting an expectation, numbered from 1 in its
+// file as Wireshark does.
+type matchedFrame struct {
+	point string
+	file  string
+	frame int
+	time  time.Time
+	info  string
+}
+
+func (s *MCPServer) assertTraffic(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	raw, err := json.Marshal(args["expectations"])
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid expectations: %v", err))
+	}
+	var expectations []trafficExpectation
+	if err := json.Unmarshal(raw, &expectations); err != nil || len(expectations) == 0 {
+		return toolError("expectations must be a non-empty array of objects")
+	}
+	for i := range expectations {
+		if err := expectations[i].validate(); err != nil {
+			return toolError(fmt.Sprintf("expectations[%d]: %v", i, err))
+		}
+	}
+	maxFrames := defaultAssertFrames
+	if v, ok := args["max_frames"].(float64); ok && v >= 0 {
+		maxFrames = int(v)
+	}
+
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	counts := make([]int, len(expectations))
+	frames := make([][]matchedFrame, len(expectations))
+	points := make([][]string, len(expectations))
+	packets := 0
+	for _, in := range inputs {
+		point := in.node
+		if point == "" {
+			point = filepath.Base(in.path)
+		}
+		number := 0
+		err := readCapture(in, func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+			number++
+			packets++
+			p, ok := observePacket(data, linkType)
+			if !ok {
+				return
+			}
+			for i := range expectations {
+				if !expectations[i].matches(in.node, p) {
+					continue
+				}
+				counts[i]++
+				if !containsString(points[i], point) {
+					points[i] = append(points[i], point)
+				}
+				if len(frames[i]) < maxFrames {
+					frames[i] = append(frames[i], matchedFrame{point: point, file: in.path, frame: number, time: ci.Timestamp, info: p.String()})
+				}
+			}
+		})
+		if err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+	}
+
+	results := newTable("expectations", "index", "name", "status", "packets", "expected", "points")
+	matched := newTable("frames", "index", "point", "file", "frame", "time", "summary")
+	var b strings.Builder
+	fmt.Fprintf(&b, "Checked %d expectation(s) against %d packets in %d file(s)\n\n", len(expectations), packets, len(inputs))
+	failed := 0
+	for i := range expectations {
+		e := &expectations[i]
+		lo, hi := e.bounds()
+		passed := counts[i] >= lo && (hi < 0 || counts[i] <= hi)
+		status, mark := "pass", "✓"
+		if !passed {
+			status, mark = "fail", "✗"
+			failed++
+		}
+		results.add(i, e.title(), status, counts[i], e.expected(), points[i])
+
+		fmt.Fprintf(&b, "%s %s\n", mark, e.title())
+		where := ""
+		if len(points[i]) > 0 {
+			where = " on " + strings.Join(points[i], ", ")
+		}
+		fmt.Fprintf(&b, "    %d matching packet(s)%s, expected %s\n", counts[i], where, e.expected())
+		for _, f := range frames[i] {
+			matched.add(i, f.point, f.file, f.frame, f.time.UTC().Format(time.RFC3339Nano), f.info)
+			fmt.Fprintf(&b, "    frame %d of %s at %s: %s\n", f.frame, filepath.Base(f.file), f.time.Format("15:04:05.000000"), f.info)
+		}
+		if more := counts[i] - len(frames[i]); more > 0 && len(frames[i]) > 0 {
+			fmt.Fprintf(&b, "    ... and %d more\n", more)
+		}
+	}
+
+	verdict := "PASS"
+	if failed > 0 {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(&b, "\n%s: %d of %d expectation(s) met\n", verdict, len(expectations)-failed, len(expectations))
+
+	var fields record
+	fields.add("result", strings.ToLower(verdict))
+	fields.add("passed", len(expectations)-failed)
+	fields.add("failed", failed)
+	fields.add("packets", packets)
+	return formattedResult(format, b.String(), failed > 0, fields, results, matched)
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// bgpPort is the TCP port of BGP sessions.
+const bgpPort = 179
+
+// Default and maximum number of messages returned by decode_bgp_capture.
+const (
+	defaultBGPCaptureMessages = 200
+	maxBGPCaptureMessages     = 2000
+)
+
+// maxPendingSegments bounds the out of order segments buffered per stream:
+// past it, the missing segment is considered lost from the capture.
+const maxPendingSegments = 256
+
+// bgpMarker starts every BGP message.
+var bgpMarker = bytes.Repeat([]byte{0xff}, 16)
+
+var bgpMessageNames = map[uint8]string{
+	bgpMsgOpen:         "OPEN",
+	bgpMsgUpdate:       "UPDATE",
+	bgpMsgNotification: "NOTIFICATION",
+	bgpMsgKeepalive:    "KEEPALIVE",
+	bgpMsgRouteRefresh: "ROUTE-REFRESH",
+}
+
+// bgpCaptureTypes are the values of the types argument, in protocol order.
+var bgpCaptureTypes = []string{"OPEN", "UPDATE", "NOTIFICATION", "KEEPALIVE", "ROUTE-REFRESH"}
+
+// tcpFlow is one direction of a TCP connection, as seen on a node.
+type tcpFlow struct {
+	node     string
+	src, dst netip.AddrPort
+}
+
+// bgpStream reassembles the BGP messages of one direction of a session.
+type bgpStream struct {
+	synced  bool
+	nextSeq uint32
+	buf     []byte
+	// pending holds the segments received ahead of nextSeq.
+	pending map[uint32][]byte
+	// open is the last OPEN sent on the stream, telling how its UPDATEs
+	// encode AS numbers.
+	open *bgpOpen
+	// gaps counts the times bytes missing from the capture made the stream
+	// skip to the next message.
+	gaps int
+}
+
+// push adds a TCP segment to the stream and returns the BGP messages it
+// completes. A stream joined mid-session starts at the first segment
+// beginning with a message.
+func (st *bgpStream) push(tcp *layers.TCP, truncated bool) [][]byte {
+	if tcp.SYN {
+		st.synced, st.nextSeq, st.buf, st.pending = true, tcp.Seq+1, nil, nil
+		return nil
+	}
+	payload := tcp.Payload
+	if len(payload) == 0 {
+		return nil
+	}
+	if truncated {
+		st.resync()
+		return nil
+	}
+	if !st.synced {
+		if !bytes.HasPrefix(payload, bgpMarker) {
+			return nil
+		}
+		st.synced, st.nextSeq = true, tcp.Seq
+	}
+	st.add(tcp.Seq, payload)
+	for len(st.pending) > 0 {
+		progress := false
+		for seq, segment := range st.pending {
+			if int32(seq-st.nextSeq) <= 0 {
+				delete(st.pending, seq)
+				st.add(seq, segment)
+				progress = true
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return st.messages()
+}
+
+// add appends the bytes of a segment not seen yet, or keeps the segment
+// for later if it comes after a missing one.
+func (st *bgpStream) add(seq uint32, payload []byte) {
+	diff := int32(seq - st.nextSeq)
+	if diff > 0 {
+		if len(st.pending) >= maxPendingSegments {
+			st.resync()
+			return
+		}
+		if st.pending == nil {
+			st.pending = make(map[uint32][]byte)
+		}
+		st.pending[seq] = append([]byte(nil), payload...)
+		return
+	}
+	// A retransmission may carry a few new bytes after the ones seen.
+	if int(-diff) >= len(payload) {
+		return
+	}
+	payload = payload[-diff:]
+	st.buf = append(st.buf, payload...)
+	st.nextSeq += uint32(len(payload))
+}
+
+// messages cuts the complete messages off the reassembled bytes.
+func (st *bgpStream) messages() [][]byte {
+	var msgs [][]byte
+	for st.synced && len(st.buf) >= bgpHeaderLen {
+		if !bytes.HasPrefix(st.buf, bgpMarker) {
+			st.resync()
+			break
+		}
+		_, length, err := parseBGPHeader(st.buf)
+		if err != nil {
+			st.resync()
+			break
+		}
+		if len(st.buf) < length {
+			break
+		}
+		msgs = append(msgs, st.buf[:length:length])
+		st.buf = st.buf[length:]
+	}
+	return msgs
+}
+
+// resync drops the bytes of a stream after a gap, to start again at the next
+// segment beginning with a message.
+func (st *bgpStream) resync() {
+	st.synced, st.buf, st.pending = false, nil, nil
+	st.gaps++
+}
+
+// bgpCaptureMessage is a BGP message decoded from a capture.
+type bgpCaptureMessage struct {
+	time     time.Time
+	node     string
+	src, dst netip.AddrPort
+	// vxlan tells whether the session was carried inside VXLAN.
+	vxlan        bool
+	msgType      string
+	detail       string
+	update       *bgpUpdate
+	undecodable  bool
+	routesFilter string
+}
+
+// bgpSegment returns the innermost TCP segment of a packet if it belongs to
+// a BGP session, along with its addresses.
+func bgpSegment(packet gopacket.Packet) (tcp *layers.TCP, src, dst netip.Addr, vxlan bool) {
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.VXLAN:
+			vxlan = true
+		case *layers.IPv4:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+		case *layers.IPv6:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+		case *layers.TCP:
+			tcp = l
+		}
+	}
+	if tcp == nil || (tcp.SrcPort != bgpPort && tcp.DstPort != bgpPort) {
+		return nil, src, dst, false
+	}
+	return tcp, src.Unmap(), dst.Unmap(), vxlan
+}
+
+// bgpCaptureDecoder follows the BGP sessions of capture files and decodes
+// their messages.
+type bgpCaptureDecoder struct {
+	streams  map[tcpFlow]*bgpStream
+	messages []*bgpCaptureMessage
+	counts   map[string]int
+	errors   int
+}
+
+func newBGPCaptureDecoder() *bgpCaptureDecoder {
+	return &bgpCaptureDecoder{
+		streams: make(map[tcpFlow]*bgpStream),
+		counts:  make(map[string]int),
+	}
+}
+
+func (d *bgpCaptureDecoder) add(node string, data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	tcp, src, dst, vxlan := bgpSegment(packet)
+	if tcp == nil {
+		return
+	}
+	flow := tcpFlow{node: node, src: netip.AddrPortFrom(src, uint16(tcp.SrcPort)), dst: netip.AddrPortFrom(dst, uint16(tcp.DstPort))}
+	st, ok := d.streams[flow]
+	if !ok {
+		st = &bgpStream{}
+		d.streams[flow] = st
+	}
+	for _, msg := range st.push(tcp, ci.CaptureLength < ci.Length) {
+		m := &bgpCaptureMessage{time: ci.Timestamp, node: node, src: flow.src, dst: flow.dst, vxlan: vxlan}
+		d.decode(m, st, d.streams[tcpFlow{node: node, src: flow.dst, dst: flow.src}], msg)
+		d.counts[m.msgType]++
+		d.messages = append(d.messages, m)
+	}
+}
+
+// decode fills the type and details of a message. UPDATEs carry 4-byte AS
+// numbers unless an OPEN of the session says otherwise.
+func (d *bgpCaptureDecoder) decode(m *bgpCaptureMessage, st, reverse *bgpStream, msg []byte) {
+	msgType := msg[18]
+	m.msgType = bgpMessageNames[msgType]
+	if m.msgType == "" {
+		m.msgType = fmt.Sprintf("TYPE-%d", msgType)
+	}
+	var err error
+	switch msgType {
+	case bgpMsgOpen:
+		var open *bgpOpen
+		if open, err = parseBGPOpen(msg); err == nil {
+			st.open = open
+			m.detail = fmt.Sprintf("as %d hold %ds id %s families %s", open.AS, open.HoldTime, open.RouterID, strings.Join(open.Families, ","))
+			if !open.FourByteAS {
+				m.detail += " (2-byte AS)"
+			}
+		}
+	case bgpMsgUpdate:
+		asn4 := true
+		for _, s := range []*bgpStream{st, reverse} {
+			if s != nil && s.open != nil && !s.open.FourByteAS {
+				asn4 = false
+			}
+		}
+		if m.update, err = parseBGPUpdate(msg, asn4); err == nil {
+			m.detail = updateDetail(m.update)
+		}
+	case bgpMsgNotification:
+		var n *bgpNotification
+		if n, err = parseBGPNotification(msg); err == nil {
+			m.detail = fmt.Sprintf("%s (%d/%d)", n.Reason, n.Code, n.Subcode)
+		}
+	case bgpMsgRouteRefresh:
+		if body := msg[bgpHeaderLen:]; len(body) >= 4 {
+			m.detail = familyName(binary.BigEndian.Uint16(body[0:2]), body[3])
+		}
+	}
+	if err != nil {
+		m.undecodable = true
+		m.detail = fmt.Sprintf("undecodable: %v", err)
+		d.errors++
+	}
+}
+
+// updateDetail summarizes an UPDATE on one line, its routes aside.
+func updateDetail(u *bgpUpdate) string {
+	if u.EndOfRIB != "" {
+		return "End-of-RIB " + u.EndOfRIB
+	}
+	parts := []string{fmt.Sprintf("%d announced, %d withdrawn", len(u.Announced), len(u.Withdrawn))}
+	if a := u.Attributes; a != nil {
+		if len(a.ASPath) > 0 || len(u.Announced) > 0 {
+			parts = append(parts, fmt.Sprintf("path [%s]", formatASPath(a.ASPath)))
+		}
+		if a.Origin != "" {
+			parts = append(parts, "origin "+a.Origin)
+		}
+		if a.MED != nil {
+			parts = append(parts, fmt.Sprintf("med %d", *a.MED))
+		}
+		if a.LocalPref != nil {
+			parts = append(parts, fmt.Sprintf("local-pref %d", *a.LocalPref))
+		}
+		if len(a.Communities) > 0 {
+			parts = append(parts, "communities "+strings.Join(a.Communities, " "))
+		}
+		if len(a.ExtCommunities) > 0 {
+			parts = append(parts, strings.Join(a.ExtCommunities, " "))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatASPath(path []uint32) string {
+	hops := make([]string, len(path))
+	for i, as := range path {
+		hops[i] = fmt.Sprint(as)
+	}
+	return strings.Join(hops, " ")
+}
+
+// routeLine renders an announced or withdrawn route of an UPDATE.
+func routeLine(action string, n bgpNLRI) string {
+	line := fmt.Sprintf("%s %s %s", action, familyName(n.AFI, n.SAFI), n.Prefix)
+	if n.VNI != 0 {
+		line += fmt.Sprintf(" vni %d", n.VNI)
+	}
+	if n.NextHop != "" {
+		line += " nh " + n.NextHop
+	}
+	return line
+}
+
+func (s *MCPServer) decodeBGPCapture(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	types := map[string]bool{}
+	if values, err := stringsArg(args, "types"); err != nil {
+		return toolError(err.Error())
+	} else if len(values) == 0 {
+		for _, t := range bgpCaptureTypes {
+			types[t] = t != "KEEPALIVE"
+		}
+	} else {
+		for _, v := range values {
+			t := strings.ToUpper(v)
+			if !containsString(bgpCaptureTypes, t) {
+				return toolError(fmt.Sprintf("unknown message type %q, expected some of %s", v, strings.Join(bgpCaptureTypes, ", ")))
+			}
+			types[t] = true
+		}
+	}
+	var peer netip.Addr
+	if v, _ := args["peer"].(string); v != "" {
+		if peer, err = netip.ParseAddr(v); err != nil {
+			return toolError(fmt.Sprintf("invalid peer address %q", v))
+		}
+	}
+	prefix, _ := args["prefix"].(string)
+	limit := defaultBGPCaptureMessages
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = min(int(v), maxBGPCaptureMessages)
+	}
+
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	d := newBGPCaptureDecoder()
+	for _, in := range inputs {
+		err := readCapture(in, func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+			d.add(in.node, data, ci, linkType)
+		})
+		if err != nil {
+			return toolError(fmt.Sprintf("Error decoding capture: %v", err))
+		}
+	}
+	sort.SliceStable(d.messages, func(i, j int) bool { return d.messages[i].time.Before(d.messages[j].time) })
+
+	var selected []*bgpCaptureMessage
+	for _, m := range d.messages {
+		if !types[m.msgType] && !m.undecodable {
+			continue
+		}
+		if peer.IsValid() && m.src.Addr() != peer && m.dst.Addr() != peer {
+			continue
+		}
+		if prefix != "" {
+			if m.update == nil {
+				continue
+			}
+			m.routesFilter = prefix
+			if !updateMatches(m.update, prefix) {
+				continue
+			}
+		}
+		selected = append(selected, m)
+	}
+	shown := selected
+	if len(shown) > limit {
+		shown = shown[:limit]
+	}
+
+	gaps := 0
+	for _, st := range d.streams {
+		gaps += st.gaps
+	}
+	var b strings.Builder
+	var counts []string
+	for _, t := range bgpCaptureTypes {
+		if n := d.counts[t]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, t))
+		}
+	}
+	fmt.Fprintf(&b, "%d BGP messages in %d file(s)", len(d.messages), len(inputs))
+	if len(counts) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(counts, ", "))
+	}
+	b.WriteString("\n")
+	if len(shown) < len(selected) {
+		fmt.Fprintf(&b, "Showing the first %d of %d matching messages, raise limit for more.\n", len(shown), len(selected))
+	} else {
+		fmt.Fprintf(&b, "%d matching messages.\n", len(selected))
+	}
+	if gaps > 0 {
+		fmt.Fprintf(&b, "Skipped %d gap(s) of bytes missing from the capture, messages around them are lost.\n", gaps)
+	}
+	if d.errors > 0 {
+		fmt.Fprintf(&b, "%d message(s) could not be decoded.\n", d.errors)
+	}
+	b.WriteString("\n")
+
+	messages := newTable("messages", "time", "node", "source", "destination", "vxlan", "type", "detail")
+	routes := newTable("routes", "time", "node", "source", "destination", "action", "family", "route_type", "prefix", "vni", "next_hop", "as_path", "ext_communities")
+	for _, m := range shown {
+		var node any
+		if m.node != "" {
+			node = m.node
+		}
+		at := m.time.UTC().Format(time.RFC3339Nano)
+		messages.add(at, node, m.src.String(), m.dst.String(), m.vxlan, m.msgType, m.detail)
+
+		line := m.time.Format("2006-01-02 15:04:05.000")
+		if m.node != "" {
+			line += " " + m.node
+		}
+		line += fmt.Sprintf(" %s -> %s", m.src.Addr(), m.dst.Addr())
+		if m.vxlan {
+			line += " (in VXLAN)"
+		}
+		line += " " + m.msgType
+		if m.detail != "" {
+			line += " " + m.detail
+		}
+		b.WriteString(line + "\n")
+
+		if m.update == nil {
+			continue
+		}
+		var asPath any
+		var extCommunities []string
+		if a := m.update.Attributes; a != nil {
+			asPath = formatASPath(a.ASPath)
+			extCommunities = a.ExtCommunities
+		}
+		for _, change := range []struct {
+			action string
+			sign   string
+			routes []bgpNLRI
+		}{{"withdraw", "-", m.update.Withdrawn}, {"announce", "+", m.update.Announced}} {
+			for _, n := range change.routes {
+				if m.routesFilter != "" && !strings.Contains(n.Prefix, m.routesFilter) {
+					continue
+				}
+				var routeType, vni, nextHop, path any
+				var ext []string
+				if n.RouteType != 0 {
+					routeType = n.RouteType
+				}
+				if n.VNI != 0 {
+					vni = n.VNI
+				}
+				if change.action == "announce" {
+					nextHop, path, ext = n.NextHop, asPath, extCommunities
+				}
+				routes.add(at, node, m.src.String(), m.dst.String(), change.action, familyName(n.AFI, n.SAFI), routeType, n.Prefix, vni, nextHop, path, ext)
+				b.WriteString("    " + routeLine(change.sign, n) + "\n")
+			}
+		}
+	}
+
+	var fields record
+	fields.add("total", len(d.messages))
+	fields.add("matching", len(selected))
+	fields.add("shown", len(shown))
+	fields.add("gaps", gaps)
+	fields.add("undecodable", d.errors)
+	return formattedResult(format, b.String(), false, fields, messages, routes)
+}
+
+// updateMatches reports whether an UPDATE announces or withdraws a route
+// containing text.
+func updateMatches(u *bgpUpdate, text string) bool {
+	for _, routes := range [][]bgpNLRI{u.Announced, u.Withdrawn} {
+		for _, n := range routes {
+			if strings.Contains(n.Prefix, text) {
+				return true
+			}
+		}
+	}
+	return false
+}
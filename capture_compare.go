@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// counterDiff is the change of a counter between two captures, in packets
+// or packets per second.
+type counterDiff struct {
+	key           string
+	before, after float64
+}
+
+func (d counterDiff) delta() float64 { return d.after - d.before }
+
+// change renders the relative change, or tells the key appeared or
+// disappeared.
+func (d counterDiff) change() string {
+	switch {
+	case d.before == 0 && d.after == 0:
+		return "="
+	case d.before == 0:
+		return "new"
+	case d.after == 0:
+		return "gone"
+	}
+	return fmt.Sprintf("%+.0f%%", 100*d.delta()/d.before)
+}
+
+// diffCounters returns the changes of the packet counters of two captures,
+// largest first, each divided by the given durations in seconds when not 0.
+func diffCounters[K comparable](before, after map[K]*counter, beforeSeconds, afterSeconds float64) []counterDiff {
+	scale := func(packets int, seconds float64) float64 {
+		if seconds > 0 {
+			return math.Round(100*float64(packets)/seconds) / 100
+		}
+		return float64(packets)
+	}
+	byKey := make(map[string]*counterDiff)
+	for k, c := range before {
+		key := fmt.Sprint(k)
+		byKey[key] = &counterDiff{key: key, before: scale(c.packets, beforeSeconds)}
+	}
+	for k, c := range after {
+		key := fmt.Sprint(k)
+		if byKey[key] == nil {
+			byKey[key] = &counterDiff{key: key}
+		}
+		byKey[key].after = scale(c.packets, afterSeconds)
+	}
+	diffs := make([]counterDiff, 0, len(byKey))
+	for _, d := range byKey {
+		diffs = append(diffs, *d)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		a, b := math.Abs(diffs[i].delta()), math.Abs(diffs[j].delta())
+		if a != b {
+			return a > b
+		}
+		return diffs[i].key < diffs[j].key
+	})
+	return diffs
+}
+
+// compareSide is one of the two captures compared.
+type compareSide struct {
+	label   string
+	files   int
+	summary *captureSummary
+}
+
+// seconds is the time the side spans, at least a millisecond so a single
+// packet still gets a rate.
+func (c *compareSide) seconds() float64 {
+	return math.Max(c.summary.last.Sub(c.summary.first).Seconds(), 0.001)
+}
+
+func (c *compareSide) describe() string {
+	if c.summary.packets.packets == 0 {
+		return fmt.Sprintf("%s: no packet in %d file(s)", c.label, c.files)
+	}
+	return fmt.Sprintf("%s: %d packets, %s in %d file(s), from %s to %s (%s)", c.label, c.summary.packets.packets,
+		formatSize(int64(c.summary.packets.bytes)), c.files, c.summary.first.Format("2006-01-02 15:04:05.000"),
+		c.summary.last.Format("2006-01-02 15:04:05.000"), c.summary.last.Sub(c.summary.first))
+}
+
+// compareInputs reads the two sides of a comparison: two captures or files,
+// or a single one split at a time.
+func (s *MCPServer) compareInputs(args map[string]any) (before, after *compareSide, err error) {
+	before = &compareSide{label: "Before", summary: newCaptureSummary()}
+	after = &compareSide{label: "After", summary: newCaptureSummary()}
+
+	if v, _ := args["split_at"].(string); v != "" {
+		splitAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid split_at %q: expected an RFC3339 timestamp such as 2006-01-02T15:04:05.5Z", v)
+		}
+		for _, side := range []string{"before", "after"} {
+			if args[side+"_capture_id"] != nil || args[side+"_file"] != nil {
+				return nil, nil, fmt.Errorf("split_at compares the two parts of capture_id or file, %s_capture_id and %s_file do not apply", side, side)
+			}
+		}
+		inputs, err := s.captureInputs(args)
+		if err != nil {
+			return nil, nil, err
+		}
+		before.label = "Before " + splitAt.Local().Format("15:04:05.000")
+		after.label = "From " + splitAt.Local().Format("15:04:05.000")
+		before.files, after.files = len(inputs), len(inputs)
+		for _, in := range inputs {
+			err := readCapture(in, func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+				if ci.Timestamp.Before(splitAt) {
+					before.summary.add(data, ci, linkType)
+				} else {
+					after.summary.add(data, ci, linkType)
+				}
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return before, after, nil
+	}
+
+	for _, side := range []*compareSide{before, after} {
+		prefix := strings.ToLower(side.label) + "_"
+		captureID, _ := args[prefix+"capture_id"].(string)
+		file, _ := args[prefix+"file"].(string)
+		if (captureID == "") == (file == "") {
+			return nil, nil, fmt.Errorf("exactly one of %scapture_id or %sfile is required, or capture_id or file with split_at", prefix, prefix)
+		}
+		inputs, err := s.captureInputs(map[string]any{"capture_id": captureID, "file": file, "node": args["node"], "key_path": args["key_path"]})
+		if err != nil {
+			return nil, nil, err
+		}
+		side.label += " (" + captureID + file + ")"
+		side.files = len(inputs)
+		for _, in := range inputs {
+			if err := readCapture(in, side.summary.add); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return before, after, nil
+}
+
+func (s *MCPServer) compareCaptureStats(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	top := 10
+	if v, ok := args["top"].(float64); ok && v > 0 {
+		top = int(v)
+	}
+	perSecond, _ := args["per_second"].(bool)
+
+	before, after, err := s.compareInputs(args)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error comparing captures: %v", err))
+	}
+
+	var b strings.Builder
+	b.WriteString(before.describe() + "\n")
+	b.WriteString(after.describe() + "\n")
+	beforeSeconds, afterSeconds := 0.0, 0.0
+	unit, number := "packets", "%.0f"
+	if perSecond {
+		beforeSeconds, afterSeconds = before.seconds(), after.seconds()
+		unit, number = "packets/s", "%.2f"
+	} else if before.summary.packets.packets > 0 && after.summary.packets.packets > 0 {
+		if ratio := before.seconds() / after.seconds(); ratio > 1.2 || ratio < 1/1.2 {
+			b.WriteString("The captures span different durations: pass per_second to compare rates rather than counts.\n")
+		}
+	}
+	var findings []string
+
+	// section renders a diff as a table and a text section, listing at most
+	// limit entries when not 0.
+	section := func(name, title, column string, diffs []counterDiff, limit int) *table {
+		t := newTable(name, column, "before", "after", "delta", "change")
+		fmt.Fprintf(&b, "\n%s (%s, before → after):\n", title, unit)
+		for i, d := range diffs {
+			if limit > 0 && i == limit {
+				fmt.Fprintf(&b, "  ... %d more with smaller changes\n", len(diffs)-limit)
+				break
+			}
+			t.add(d.key, d.before, d.after, d.delta(), d.change())
+			fmt.Fprintf(&b, "  %-40s "+number+" → "+number+" (%s)\n", d.key, d.before, d.after, d.change())
+		}
+		if len(diffs) == 0 {
+			b.WriteString("  none\n")
+		}
+		return t
+	}
+
+	protocolDiffs := diffCounters(before.summary.protocols, after.summary.protocols, beforeSeconds, afterSeconds)
+	protocols := section("protocols", "Protocols", "protocol", protocolDiffs, 0)
+	for _, d := range protocolDiffs {
+		if d.change() == "gone" {
+			findings = append(findings, fmt.Sprintf("no %s packet any more", d.key))
+		}
+	}
+
+	talkers := section("talkers", "Talkers (outer source address), largest changes", "source",
+		diffCounters(before.summary.talkers, after.summary.talkers, beforeSeconds, afterSeconds), top)
+	var innerTalkers *table
+	if len(before.summary.innerTalkers)+len(after.summary.innerTalkers) > 0 {
+		innerTalkers = section("inner_talkers", "Talkers inside VXLAN, largest changes", "source",
+			diffCounters(before.summary.innerTalkers, after.summary.innerTalkers, beforeSeconds, afterSeconds), top)
+	} else {
+		innerTalkers = newTable("inner_talkers", "source", "before", "after", "delta", "change")
+	}
+	vnis := newTable("vnis", "vni", "before", "after", "delta", "change")
+	if len(before.summary.vnis)+len(after.summary.vnis) > 0 {
+		vnis = section("vnis", "VXLAN VNIs", "vni", diffCounters(before.summary.vnis, after.summary.vnis, beforeSeconds, afterSeconds), 0)
+	}
+
+	errorDiffs := diffCounters(before.summary.errors, after.summary.errors, beforeSeconds, afterSeconds)
+	errorPackets := section("errors", "Error packets", "error", errorDiffs, 0)
+	for _, d := range errorDiffs {
+		if d.delta() > 0 {
+			findings = append(findings, fmt.Sprintf("%s: "+number+" → "+number+" %s (%s)", d.key, d.before, d.after, unit, d.change()))
+		}
+	}
+
+	b.WriteString("\n")
+	if len(findings) == 0 {
+		b.WriteString("✓ No protocol disappeared, no more error packets\n")
+	} else {
+		b.WriteString("✗ Findings:\n")
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  - %s\n", f)
+		}
+	}
+
+	var fields record
+	fields.add("before", before.label)
+	fields.add("after", after.label)
+	fields.add("before_packets", before.summary.packets.packets)
+	fields.add("after_packets", after.summary.packets.packets)
+	fields.add("unit", unit)
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, protocols, talkers, innerTalkers, vnis, errorPackets)
+}
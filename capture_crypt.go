@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Captures may hold tenant traffic, so their pcaps can be encrypted as soon
+// as they are copied out, to the X25519 public key of capture_encryption_key.
+// An encrypted file starts with encryptedCaptureMagic and the ephemeral
+// public key of the file; the key derived from the two with HKDF-SHA256
+// seals the pcap with AES-256-GCM in chunks of encryptedChunkSize bytes.
+// The nonce of a chunk is its index and a flag set on the last one, so a
+// truncated or reordered file fails to decrypt.
+const (
+	encryptedCaptureMagic  = "OPMCPENC\x01"
+	encryptedCaptureSuffix = ".enc"
+	encryptedChunkSize     = 64 * 1024
+	encryptionInfo         = "openperouter-mcp capture encryption v1"
+)
+
+// isEncryptedCapture tells whether a capture file was encrypted, by its
+// name.
+func isEncryptedCapture(path string) bool {
+	return strings.HasSuffix(path, encryptedCaptureSuffix)
+}
+
+// parseCapturePublicKey decodes a base64 X25519 public key, as printed by
+// --generate-capture-key.
+func parseCapturePublicKey(text string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture encryption public key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture encryption public key: %w", err)
+	}
+	return key, nil
+}
+
+// loadCaptureKey reads a private key written by --generate-capture-key:
+// its base64 X25519 key, comment lines starting with '#' ignored.
+func loadCaptureKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading capture key: %w", err)
+	}
+	var encoded string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			encoded = line
+			break
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture key %s: %w", path, err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// generateCaptureKey writes a new private key to path, which must not
+// exist, and returns its public key to configure as capture_encryption_key.
+func generateCaptureKey(path string) (string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	public := base64.StdEncoding.EncodeToString(key.PublicKey().Bytes())
+	content := fmt.Sprintf("# openperouter-mcp capture decryption key\n# public key: %s\n%s\n", public, base64.StdEncoding.EncodeToString(key.Bytes()))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return "", err
+	}
+	return public, f.Close()
+}
+
+// captureAEAD derives the cipher of a file from the shared secret of its
+// ephemeral key and the recipient key.
+func captureAEAD(secret, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, append(append([]byte(nil), ephemeral...), recipient...), encryptionInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// readChunk reads up to len(buf) bytes and tells whether they are the last
+// ones of r.
+func readChunk(r *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return n, true, nil
+	case err != nil:
+		return n, false, err
+	}
+	if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+// encryptCapture writes the encryption of r to w for the recipient.
+func encryptCapture(w io.Writer, r io.Reader, recipient *ecdh.PublicKey) error {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	secret, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return err
+	}
+	aead, err := captureAEAD(secret, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, encryptedCaptureMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write(ephemeral.PublicKey().Bytes()); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	plain := make([]byte, encryptedChunkSize)
+	sealed := make([]byte, 0, encryptedChunkSize+aead.Overhead())
+	for index := uint64(0); ; index++ {
+		n, last, err := readChunk(br, plain)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(aead.Seal(sealed[:0], chunkNonce(index, last), plain[:n], nil)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// encryptCaptureFile replaces a file by its encryption, path with the
+// encrypted suffix, and returns the path of the latter.
+func encryptCaptureFile(path string, recipient *ecdh.PublicKey) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	dst := path + encryptedCaptureSuffix
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	bw := bufio.NewWriter(out)
+	err = encryptCapture(bw, in, recipient)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("encrypting %s: %w", path, err)
+	}
+	return dst, os.Remove(path)
+}
+
+// decryptReader decrypts a file written by encryptCapture as it is read.
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	index uint64
+	chunk []byte
+	plain []byte
+	done  bool
+}
+
+func newDecryptReader(r io.Reader, key *ecdh.PrivateKey) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(encryptedCaptureMagic)+32)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(encryptedCaptureMagic)]) != encryptedCaptureMagic {
+		return nil, errors.New("not an encrypted capture")
+	}
+	ephemeralKey := header[len(encryptedCaptureMagic):]
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := captureAEAD(secret, ephemeralKey, key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead, chunk: make([]byte, encryptedChunkSize+aead.Overhead())}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, last, err := readChunk(d.r, d.chunk)
+		if err != nil {
+			return 0, err
+		}
+		if n < d.aead.Overhead() {
+			return 0, errors.New("encrypted capture is truncated")
+		}
+		d.plain, err = d.aead.Open(d.chunk[:0], chunkNonce(d.index, last), d.chunk[:n], nil)
+		if err != nil {
+			return 0, errors.New("decryption failed: wrong key, or the file is corrupted or truncated")
+		}
+		d.index++
+		d.done = last
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// openCapture opens a capture file for reading, decrypting it with the key
+// of the input when it is encrypted.
+func openCapture(in captureInput) (io.ReadCloser, error) {
+	f, err := os.Open(in.path)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(encryptedCaptureMagic))
+	n, _ := io.ReadFull(f, magic)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !bytes.Equal(magic[:n], []byte(encryptedCaptureMagic)) {
+		return f, nil
+	}
+	if in.key == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is encrypted, pass key_path with the capture decryption key", in.path)
+	}
+	r, err := newDecryptReader(f, in.key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", in.path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// decryptedCopy returns a plain copy of an encrypted capture file, in a
+// private temporary directory removed by cleanup, for tools reading files
+// themselves such as tshark. Plain files are returned as they are.
+func decryptedCopy(in captureInput) (path string, cleanup func(), err error) {
+	if !isEncryptedCapture(in.path) {
+		return in.path, func() {}, nil
+	}
+	src, err := openCapture(in)
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+	dir, err := os.MkdirTemp("", "openperouter-mcp-decrypted-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	path = filepath.Join(dir, strings.TrimSuffix(filepath.Base(in.path), encryptedCaptureSuffix))
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err == nil {
+		_, err = io.Copy(out, src)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("decrypting %s: %w", in.path, err)
+	}
+	return path, cleanup, nil
+}
+
+// encryptLike encrypts a file derived from capture inputs, such as a merge
+// or a slice, to the key the inputs were encrypted for, if any were, so
+// their traffic is never left in the clear. It returns the path of the file
+// written.
+func encryptLike(inputs []captureInput, path string) (string, error) {
+	for _, in := range inputs {
+		if in.key != nil && isEncryptedCapture(in.path) {
+			return encryptCaptureFile(path, in.key.PublicKey())
+		}
+	}
+	return path, nil
+}
+
+// encryptCaptureFiles encrypts the pcaps of a finished capture to the
+// configured key, removing the plain ones.
+func (s *MCPServer) encryptCaptureFiles(call *ActiveCall) {
+	recipient, err := parseCapturePublicKey(s.config.CaptureEncryptionKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not encrypting capture %s: %v\n", call.CaptureID, err)
+		return
+	}
+	s.mu.Lock()
+	nodes := append([]string(nil), call.Nodes...)
+	s.mu.Unlock()
+	for _, node := range nodes {
+		for _, path := range capturedFiles(call.OutputDir, call.nodeFilter(node), node) {
+			if isEncryptedCapture(path) {
+				continue
+			}
+			if _, err := encryptCaptureFile(path, recipient); err != nil {
+				fmt.Fprintf(os.Stderr, "Capture %s: %v\n", call.CaptureID, err)
+			}
+		}
+	}
+}
+
+// keyPathProperty is the key_path parameter of the tools reading captures.
+var keyPathProperty = map[string]any{
+	"type":        "string",
+	"description": "Path of the private key decrypting encrypted capture files (.enc), written by --generate-capture-key.",
+}
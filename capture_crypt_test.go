@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sealedChunkSize is the size of a full chunk of an encrypted capture.
+const sealedChunkSize = encryptedChunkSize + 16
+
+func testCaptureKey(t *testing.T) *ecdh.PrivateKey {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encryptBytes(t *testing.T, plain []byte, recipient *ecdh.PublicKey) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	if err := encryptCapture(&sealed, bytes.NewReader(plain), recipient); err != nil {
+		t.Fatalf("encryptCapture: %v", err)
+	}
+	return sealed.Bytes()
+}
+
+func decryptBytes(sealed []byte, key *ecdh.PrivateKey) ([]byte, error) {
+	r, err := newDecryptReader(bytes.NewReader(sealed), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestCaptureEncryptionRoundTrip(t *testing.T) {
+	key := testCaptureKey(t)
+	for _, size := range []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		sealed := encryptBytes(t, plain, key.PublicKey())
+		if !bytes.HasPrefix(sealed, []byte(encryptedCaptureMagic)) {
+			t.Errorf("%d bytes: the encrypted capture does not start with the magic", size)
+		}
+		got, err := decryptBytes(sealed, key)
+		if err != nil {
+			t.Fatalf("%d bytes: decrypting: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: decrypted %d bytes differing from the plain text", size, len(got))
+		}
+	}
+}
+
+func TestCaptureDecryptionErrors(t *testing.T) {
+	key := testCaptureKey(t)
+	plain := make([]byte, 2*encryptedChunkSize+5)
+	rand.Read(plain)
+	sealed := encryptBytes(t, plain, key.PublicKey())
+	header := len(encryptedCaptureMagic) + 32
+
+	reordered := append([]byte(nil), sealed[:header]...)
+	reordered = append(reordered, sealed[header+sealedChunkSize:header+2*sealedChunkSize]...)
+	reordered = append(reordered, sealed[header:header+sealedChunkSize]...)
+	reordered = append(reordered, sealed[header+2*sealedChunkSize:]...)
+	tampered := append([]byte(nil), sealed...)
+	tampered[header+10] ^= 1
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    *ecdh.PrivateKey
+		want   string
+	}{
+		{"empty", nil, key, "not an encrypted capture"},
+		{"plain pcap", plain, key, "not an encrypted capture"},
+		{"truncated header", sealed[:header-1], key, "not an encrypted capture"},
+		{"header only", sealed[:header], key, "truncated"},
+		{"truncated in a chunk", sealed[:header+sealedChunkSize/2], key, "decryption failed"},
+		{"last chunk dropped", sealed[:header+2*sealedChunkSize], key, "decryption failed"},
+		{"last bytes dropped", sealed[:len(sealed)-1], key, "decryption failed"},
+		{"chunks reordered", reordered, key, "decryption failed"},
+		{"tampered", tampered, key, "decryption failed"},
+		{"wrong key", sealed, testCaptureKey(t), "decryption failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptBytes(tt.sealed, tt.key)
+			if err == nil {
+				t.Fatal("decryption succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("decryption error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureKeyFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.key")
+	public, err := generateCaptureKey(path)
+	if err != nil {
+		t.Fatalf("generateCaptureKey: %v", err)
+	}
+	if _, err := generateCaptureKey(path); err == nil {
+		t.Error("generateCaptureKey overwrote an existing key")
+	}
+	key, err := loadCaptureKey(path)
+	if err != nil {
+		t.Fatalf("loadCaptureKey: %v", err)
+	}
+	recipient, err := parseCapturePublicKey(public)
+	if err != nil {
+		t.Fatalf("parseCapturePublicKey(%q): %v", public, err)
+	}
+	if !recipient.Equal(key.PublicKey()) {
+		t.Error("the printed public key is not the one of the private key")
+	}
+	plain := []byte("pcapng")
+	if got, err := decryptBytes(encryptBytes(t, plain, recipient), key); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("round trip through the key files = %q, %v", got, err)
+	}
+}
+
+func TestParseCapturePublicKeyErrors(t *testing.T) {
+	for _, text := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := parseCapturePublicKey(text); err == nil {
+			t.Errorf("parseCapturePublicKey(%q) succeeded, want an error", text)
+		}
+	}
+}
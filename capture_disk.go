@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diskCheckInterval is how often the disks a capture writes to are checked
+// against capture_max_disk_usage_percent.
+const diskCheckInterval = 10 * time.Second
+
+// diskUsage is the use of the filesystem holding a path.
+type diskUsage struct {
+	where   string
+	percent int
+	free    int64
+}
+
+func newDiskUsage(where string, used, available uint64) diskUsage {
+	u := diskUsage{where: where, free: int64(available)}
+	if total := used + available; total > 0 {
+		// Rounded up, as df does.
+		u.percent = int((used*100 + total - 1) / total)
+	}
+	return u
+}
+
+func (u diskUsage) String() string {
+	return fmt.Sprintf("%s is %d%% full, %s free", u.where, u.percent, formatSize(u.free))
+}
+
+// parseDF reads the output of df -Pk for a single path.
+func parseDF(out string) (used, available uint64, err error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 6 {
+		return 0, 0, fmt.Errorf("unexpected df output %q", out)
+	}
+	if used, err = strconv.ParseUint(fields[2], 10, 64); err == nil {
+		available, err = strconv.ParseUint(fields[3], 10, 64)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected df output %q", out)
+	}
+	return used * 1024, available * 1024, nil
+}
+
+// nodeDiskUsage returns the use of the filesystem of a container holding
+// dir.
+func (r *captureRun) nodeDiskUsage(container, dir string) (diskUsage, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, captureExecTimeout)
+	defer cancel()
+	var out bytes.Buffer
+	code, err := r.rt.exec(ctx, container, []string{"df", "-Pk", dir}, &out, nil)
+	if err == nil && code != 0 {
+		err = fmt.Errorf("df exited with code %d", code)
+	}
+	if err != nil {
+		return diskUsage{}, err
+	}
+	used, available, err := parseDF(out.String())
+	if err != nil {
+		return diskUsage{}, err
+	}
+	return newDiskUsage(fmt.Sprintf("%s:%s", container, dir), used, available), nil
+}
+
+// checkDisks returns the use of the first disk the capture writes to that
+// reached the limit: the one of the output directory on the host, or the
+// ones of the containers tshark writes its files in. Disks that cannot be
+// checked are skipped.
+func (r *captureRun) checkDisks() (diskUsage, bool) {
+	if u, err := hostDiskUsage(r.outputDir); err == nil && u.percent >= r.maxDiskUsage {
+		return u, true
+	}
+	checked := make(map[string]bool)
+	for _, n := range r.started() {
+		if n.node == hostCaptureNode || checked[n.container] {
+			continue
+		}
+		checked[n.container] = true
+		u, err := r.nodeDiskUsage(n.container, path.Dir(n.file))
+		if err != nil {
+			r.logf("%s: disk usage not checked: %v", n.node, err)
+			continue
+		}
+		if u.percent >= r.maxDiskUsage {
+			return u, true
+		}
+	}
+	return diskUsage{}, false
+}
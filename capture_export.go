@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultExportPackets = 50
+	maxExportPackets     = 1000
+)
+
+// exportOutputs are the tshark renderings export_capture offers, with the
+// flags selecting them and the MIME type of the result.
+var exportOutputs = map[string]struct {
+	flags     []string
+	mimeType  string
+	extension string
+}{
+	"json": {[]string{"-T", "json"}, "application/json", "json"},
+	"text": {[]string{"-V"}, "text/plain", "txt"},
+}
+
+// tsharkExport dissects a capture file with tshark, keeping the first
+// packets matching a display filter.
+func tsharkExport(path, filter, output string, protocols []string, limit int) ([]byte, error) {
+	args := []string{"-r", path, "-c", strconv.Itoa(limit)}
+	if filter != "" {
+		args = append(args, "-Y", filter)
+	}
+	args = append(args, exportOutputs[output].flags...)
+	if len(protocols) > 0 {
+		// Only the layers asked for are detailed, the others are summarized
+		// in a line (text) or left out (json).
+		if output == "json" {
+			args = append(args, "-J", strings.Join(protocols, " "))
+		} else {
+			args = append(args, "-O", strings.Join(protocols, ","))
+		}
+	}
+	out, err := exec.Command("tshark", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("reading %s with tshark: %s", path, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("reading %s with tshark: %w", path, err)
+	}
+	return out, nil
+}
+
+func (s *MCPServer) exportCapture(args map[string]any) CallToolResult {
+	output, _ := args["output"].(string)
+	if output == "" {
+		output = "json"
+	}
+	if _, ok := exportOutputs[output]; !ok {
+		return toolError(fmt.Sprintf("invalid output %q, expected json or text", output))
+	}
+	filter, _ := args["filter"].(string)
+	limit := defaultExportPackets
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = min(int(v), maxExportPackets)
+	}
+	var protocols []string
+	if v, _ := args["protocols"].(string); v != "" {
+		protocols = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if _, err := exec.LookPath("tshark"); err != nil {
+		return toolError("tshark is not installed on the host, it is required to export packets. Use analyze_capture or decode_bgp_capture instead.")
+	}
+
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	// Each file is exported as an embedded resource, named after it and the
+	// export parameters.
+	query := url.Values{}
+	if filter != "" {
+		query.Set("filter", filter)
+	}
+	query.Set("limit", strconv.Itoa(limit))
+
+	var b strings.Builder
+	content := []ContentItem{{}}
+	for _, in := range inputs {
+		path, cleanup, err := decryptedCopy(in)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		out, err := tsharkExport(path, filter, output, protocols, limit)
+		cleanup()
+		if err != nil {
+			return toolError(err.Error())
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		uri := fmt.Sprintf("capture-export://%s.%s?%s", name, exportOutputs[output].extension, query.Encode())
+		content = append(content, ContentItem{
+			Type: "resource",
+			Resource: &ResourceContents{
+				URI:      uri,
+				MimeType: exportOutputs[output].mimeType,
+				Text:     string(out),
+			},
+			Annotations: &Annotations{Audience: []string{"assistant"}},
+		})
+		fmt.Fprintf(&b, "  %s: %s, %s\n", uri, in.path, formatSize(int64(len(out))))
+	}
+
+	header := fmt.Sprintf("Exported at most %d packet(s)", limit)
+	if filter != "" {
+		header += fmt.Sprintf(" matching %q", filter)
+	}
+	header += fmt.Sprintf(" per file from %d file(s) as tshark %s:\n", len(inputs), output)
+	content[0] = summaryContent(header + b.String())
+	return CallToolResult{Content: content}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// filterCompilers are the tools a capture filter can be compiled with on a
+// node, without capturing anything, in order of preference: dumpcap comes
+// with the tshark the captures install.
+var filterCompilers = []struct {
+	name string
+	args func(filter string, interfaces []string) []string
+}{
+	{"dumpcap", func(filter string, interfaces []string) []string {
+		args := []string{"dumpcap"}
+		for _, iface := range interfaces {
+			args = append(args, "-i", iface)
+		}
+		return append(args, "-f", filter, "-d")
+	}},
+	{"tcpdump", func(filter string, interfaces []string) []string {
+		return []string{"tcpdump", "-i", interfaces[0], "-d", filter}
+	}},
+}
+
+// bpfInstructionRe matches an instruction of the BPF program dumpcap and
+// tcpdump print, such as "(000) ldh [12]".
+var bpfInstructionRe = regexp.MustCompile(`(?m)^\(\d+\) (.*)$`)
+
+// filterCheck is the outcome of compiling a capture filter on a node.
+type filterCheck struct {
+	node     string
+	compiler string
+	// instructions is the number of instructions of the compiled program.
+	instructions int
+	// problem is why the filter is invalid or can never match, empty when
+	// it compiled to a program accepting some packets.
+	problem string
+	// skipped tells why the filter could not be compiled on the node.
+	skipped string
+}
+
+// maxVNI is the largest VNI the 24 bits of the VXLAN header hold.
+const maxVNI = 1<<24 - 1
+
+// vniCaptureFilter returns the capture filter matching the VXLAN packets of
+// a VNI: the VNI is the 3 bytes after the flags and reserved bytes of the
+// VXLAN header, right after the UDP header. libpcap only indexes udp[] over
+// IPv4, so IPv6 underlays are matched at the fixed offset of a UDP header
+// following the IPv6 one. The alternatives are parenthesized, "and" and "or"
+// having the same precedence in capture filters.
+func vniCaptureFilter(vni uint32) string {
+	match := fmt.Sprintf("& 0xffffff00 = 0x%06x00", vni)
+	return fmt.Sprintf("udp port 4789 and (udp[12:4] %s or (ip6[6] = 17 and ip6[52:4] %s))", match, match)
+}
+
+// captureProfiles are the capture filters of the usual EVPN debugging
+// captures, by the name the profile argument selects them with. Neighbor
+// Discovery is ICMPv6 types 133 to 137, the type being read right after the
+// fixed IPv6 header as ND messages carry no extension header.
+var captureProfiles = map[string]string{
+	"bgp":               "tcp port 179",
+	"vxlan":             "udp port 4789",
+	"bfd":               "udp port 3784 or udp port 3785 or udp port 4784",
+	"arp-nd":            "arp or (icmp6 and ip6[40] >= 133 and ip6[40] <= 137)",
+	"all-control-plane": "(tcp port 179) or (udp port 3784 or udp port 3785 or udp port 4784) or (arp or (icmp6 and ip6[40] >= 133 and ip6[40] <= 137))",
+}
+
+// captureProfileNames lists the profiles, for the tool schemas.
+var captureProfileNames = []string{"bgp", "vxlan", "bfd", "arp-nd", "all-control-plane"}
+
+// profileProperty is the profile parameter of the capture tools.
+var profileProperty = map[string]any{
+	"type":        "string",
+	"enum":        captureProfileNames,
+	"description": "Preset filter of the usual EVPN debugging captures, instead of writing one: 'bgp' (TCP port 179), 'vxlan' (UDP port 4789), 'bfd' (UDP ports 3784, 3785 and 4784), 'arp-nd' (ARP and IPv6 Neighbor Discovery) or 'all-control-plane' (BGP, BFD, ARP and ND). capture_filter, if given, is and-ed with it (e.g., 'host 192.168.11.2' for one BGP peer). Optional.",
+}
+
+// profileFilter returns the filter of the profile argument of a capture,
+// and-ed with filter when both are given, so capture_filter narrows the
+// profile down. It returns filter alone when no profile is given.
+func profileFilter(args map[string]any, filter string) (string, error) {
+	name, _ := args["profile"].(string)
+	if name == "" {
+		return filter, nil
+	}
+	profile, ok := captureProfiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown profile %q, expected one of %s", name, strings.Join(captureProfileNames, ", "))
+	}
+	if filter == "" {
+		return profile, nil
+	}
+	return andFilters(profile, filter), nil
+}
+
+// andFilters returns the filter matching the packets both filters match,
+// each parenthesized since "and" and "or" have the same precedence.
+func andFilters(a, b string) string {
+	return "(" + a + ") and (" + b + ")"
+}
+
+// captureFiltersArg returns the capture_filter argument of a capture, a
+// filter for every node or an object of node names or globs to the filter
+// of the nodes they match, as perNode.
+func captureFiltersArg(args map[string]any) (filter string, perNode map[string]string, err error) {
+	switch v := args["capture_filter"].(type) {
+	case nil:
+		return "", nil, nil
+	case string:
+		return v, nil, nil
+	case map[string]any:
+		if len(v) == 0 {
+			return "", nil, fmt.Errorf("capture_filter must not be an empty object")
+		}
+		perNode = make(map[string]string, len(v))
+		for glob, f := range v {
+			value, ok := f.(string)
+			if !ok || value == "" {
+				return "", nil, fmt.Errorf("the capture_filter of %q must be a non-empty string", glob)
+			}
+			if _, err := path.Match(glob, ""); err != nil {
+				return "", nil, fmt.Errorf("invalid glob %q in capture_filter", glob)
+			}
+			perNode[glob] = value
+		}
+		return "", perNode, nil
+	}
+	return "", nil, fmt.Errorf("capture_filter must be a string or an object of nodes to filters")
+}
+
+// resolveNodeFilters maps the nodes of a capture to their filter, given per
+// node name or glob: a node named as such takes its filter, others the one
+// of the glob matching them. The nodes matched by nothing are left out, to
+// capture with the filter of the capture. A node matched by several globs
+// is an error, as is an entry matching no node.
+func resolveNodeFilters(perNode map[string]string, nodes []string) (map[string]string, error) {
+	filters := make(map[string]string)
+	used := make(map[string]bool)
+	for _, node := range nodes {
+		if f, ok := perNode[node]; ok {
+			filters[node], used[node] = f, true
+			continue
+		}
+		var matched []string
+		for glob := range perNode {
+			if ok, _ := path.Match(glob, node); ok {
+				matched = append(matched, glob)
+			}
+		}
+		sort.Strings(matched)
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("node %s matches several capture_filter entries: %s", node, strings.Join(matched, ", "))
+		}
+		if len(matched) == 1 {
+			filters[node], used[matched[0]] = perNode[matched[0]], true
+		}
+	}
+	for glob := range perNode {
+		if !used[glob] {
+			return nil, fmt.Errorf("no captured node matches the capture_filter entry %q", glob)
+		}
+	}
+	return filters, nil
+}
+
+// checkCaptureFilter compiles a capture filter on a node, against the
+// interfaces it would capture on (all of them when none is given).
+func checkCaptureFilter(node, filter string, interfaces []string) filterCheck {
+	check := filterCheck{node: node}
+	if len(interfaces) == 0 {
+		interfaces = []string{"any"}
+	}
+	for _, compiler := range filterCompilers {
+		if _, err := runInRouterNetns(node, "which", compiler.name); err != nil {
+			continue
+		}
+		check.compiler = compiler.name
+		cmd := compiler.args(filter, interfaces)
+		out, err := runInRouterNetns(node, cmd...)
+		if err != nil {
+			// The error is the output of the compiler alone, on one line.
+			message := strings.TrimPrefix(err.Error(), fmt.Sprintf("%s on %s: ", strings.Join(cmd, " "), routerContainer(node)))
+			message = strings.Join(strings.Fields(message), " ")
+			// Only syntax and semantic errors mention the filter, the other
+			// ones (permissions, missing interface) say nothing about it.
+			if strings.Contains(strings.ToLower(message), "filter") {
+				check.problem = message
+			} else {
+				check.skipped = message
+			}
+			return check
+		}
+		program := bpfInstructionRe.FindAllStringSubmatch(string(out), -1)
+		check.instructions = len(program)
+		if len(program) == 1 && strings.Join(strings.Fields(program[0][1]), " ") == "ret #0" {
+			check.problem = "the filter compiles to a program rejecting every packet, nothing would be captured"
+		}
+		return check
+	}
+	check.skipped = "neither dumpcap nor tcpdump is installed (tshark is installed by the first capture)"
+	return check
+}
+
+// checkCaptureFilters compiles a capture filter on every node, concurrently.
+func checkCaptureFilters(filter string, nodes []string, interfaces map[string][]string) []filterCheck {
+	return checkNodeCaptureFilters(filter, nil, nodes, interfaces)
+}
+
+// checkNodeCaptureFilters compiles on every node its own filter, from
+// nodeFilters, or else the given one, concurrently.
+func checkNodeCaptureFilters(filter string, nodeFilters map[string]string, nodes []string, interfaces map[string][]string) []filterCheck {
+	checks := make([]filterCheck, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		f, ok := nodeFilters[node]
+		if !ok {
+			f = filter
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checks[i] = checkCaptureFilter(node, f, interfaces[node])
+		}()
+	}
+	wg.Wait()
+	return checks
+}
+
+// filterProblems returns the nodes the filter is invalid on, with why.
+func filterProblems(checks []filterCheck) []string {
+	var problems []string
+	for _, c := range checks {
+		if c.problem != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", c.node, c.problem))
+		}
+	}
+	return problems
+}
+
+func (s *MCPServer) validateCaptureFilter(args map[string]any) CallToolResult {
+	filter, _ := args["capture_filter"].(string)
+	if filter == "" {
+		return toolError("capture_filter is required")
+	}
+	nodeGlobs, err := stringsArg(args, "nodes")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	ifaceGlobs, err := stringsArg(args, "interfaces")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	nodes, interfaces, _, err := captureTargets(nodeGlobs, ifaceGlobs)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error selecting capture targets: %v", err))
+	}
+
+	checks := checkCaptureFilters(filter, nodes, interfaces)
+	var b strings.Builder
+	problems := filterProblems(checks)
+	validated := 0
+	for _, c := range checks {
+		if c.skipped == "" {
+			validated++
+		}
+	}
+	switch {
+	case len(problems) > 0:
+		fmt.Fprintf(&b, "✗ Capture filter %q is rejected on %d of %d node(s)\n\n", filter, len(problems), len(nodes))
+	case validated == 0:
+		fmt.Fprintf(&b, "Capture filter %q could not be validated on any of %d node(s)\n\n", filter, len(nodes))
+	default:
+		fmt.Fprintf(&b, "✓ Capture filter %q is valid on %d of %d node(s)\n\n", filter, validated, len(nodes))
+	}
+	for _, c := range checks {
+		where := "any interface"
+		if len(interfaces[c.node]) > 0 {
+			where = strings.Join(interfaces[c.node], ", ")
+		}
+		switch {
+		case c.problem != "":
+			fmt.Fprintf(&b, "  ✗ %s (%s, %s): %s\n", c.node, c.compiler, where, c.problem)
+		case c.skipped != "":
+			fmt.Fprintf(&b, "  ? %s: not validated, %s\n", c.node, c.skipped)
+		default:
+			fmt.Fprintf(&b, "  ✓ %s (%s, %s): %d BPF instructions\n", c.node, c.compiler, where, c.instructions)
+		}
+	}
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: b.String()}}, IsError: len(problems) > 0}
+}
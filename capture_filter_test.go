@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestVNICaptureFilter(t *testing.T) {
+	tests := []struct {
+		vni  uint32
+		want string
+	}{
+		{0, "udp port 4789 and (udp[12:4] & 0xffffff00 = 0x00000000 or (ip6[6] = 17 and ip6[52:4] & 0xffffff00 = 0x00000000))"},
+		{100, "udp port 4789 and (udp[12:4] & 0xffffff00 = 0x00006400 or (ip6[6] = 17 and ip6[52:4] & 0xffffff00 = 0x00006400))"},
+		{0xabcdef, "udp port 4789 and (udp[12:4] & 0xffffff00 = 0xabcdef00 or (ip6[6] = 17 and ip6[52:4] & 0xffffff00 = 0xabcdef00))"},
+		{maxVNI, "udp port 4789 and (udp[12:4] & 0xffffff00 = 0xffffff00 or (ip6[6] = 17 and ip6[52:4] & 0xffffff00 = 0xffffff00))"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(int(tt.vni)), func(t *testing.T) {
+			if got := vniCaptureFilter(tt.vni); got != tt.want {
+				t.Errorf("vniCaptureFilter(%d) =\n%s\nwant\n%s", tt.vni, got, tt.want)
+			}
+		})
+	}
+}
+
+// vniFilterTermRe matches the comparisons of a VNI filter, the base its
+// offset is relative to, the offset and the value compared.
+var vniFilterTermRe = regexp.MustCompile(`(udp|ip6)\[(\d+):4\] & 0xffffff00 = 0x([0-9a-f]{8})`)
+
+// TestVNICaptureFilterOffsets checks the offsets of the filter against the
+// VXLAN headers of IPv4 and IPv6 underlay packets.
+func TestVNICaptureFilterOffsets(t *testing.T) {
+	vxlan := func(vni uint32) []byte {
+		// Flags with the VNI bit, reserved bytes, VNI and a reserved byte.
+		header := []byte{0x08, 0, 0, 0, 0, 0, 0, 0xff}
+		binary.BigEndian.PutUint32(header[4:], vni<<8|0xff)
+		return header
+	}
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[2:], 4789)
+
+	for _, vni := range []uint32{1, 100, 0x123456, maxVNI} {
+		packets := map[string][]byte{
+			// udp[] is relative to the UDP header.
+			"udp": append(append([]byte(nil), udp...), vxlan(vni)...),
+			// ip6[] is relative to the fixed IPv6 header, next header UDP.
+			"ip6": append(append(append(make([]byte, 40), udp...), vxlan(vni)...), make([]byte, 16)...),
+		}
+		packets["ip6"][6] = 17
+		terms := vniFilterTermRe.FindAllStringSubmatch(vniCaptureFilter(vni), -1)
+		if len(terms) != 2 {
+			t.Fatalf("vniCaptureFilter(%d) has %d VNI comparisons, want 2", vni, len(terms))
+		}
+		for _, term := range terms {
+			offset, _ := strconv.Atoi(term[2])
+			want, _ := strconv.ParseUint(term[3], 16, 32)
+			packet := packets[term[1]]
+			if got := binary.BigEndian.Uint32(packet[offset:]) & 0xffffff00; uint64(got) != want {
+				t.Errorf("VNI %d: %s[%d:4] of a VXLAN packet is 0x%08x, the filter expects 0x%08x", vni, term[1], offset, got, want)
+			}
+		}
+	}
+}
+
+func TestProfileFilter(t *testing.T) {
+	tests := []struct {
+		profile string
+		filter  string
+		want    string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"", "host 10.0.0.1", "host 10.0.0.1", false},
+		{"bgp", "", "tcp port 179", false},
+		{"bfd", "host 10.0.0.1", "(udp port 3784 or udp port 3785 or udp port 4784) and (host 10.0.0.1)", false},
+		{"ospf", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.profile, tt.filter), func(t *testing.T) {
+			got, err := profileFilter(map[string]any{"profile": tt.profile}, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("profileFilter() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("profileFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
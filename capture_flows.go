@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const defaultTopFlows = 20
+
+// flowEnds identifies a TCP or UDP conversation regardless of its
+// direction: a is the lower of the two endpoints.
+type flowEnds struct {
+	protocol string
+	a, b     netip.AddrPort
+}
+
+func (e flowEnds) less(o flowEnds) bool {
+	if e.a != o.a {
+		return e.a.Compare(o.a) < 0
+	}
+	if e.b != o.b {
+		return e.b.Compare(o.b) < 0
+	}
+	return e.protocol < o.protocol
+}
+
+// flowSighting is a conversation as seen on a capture point, bare or
+// inside a VNI.
+type flowSighting struct {
+	ends  flowEnds
+	point string
+	encap bool
+	vni   uint32
+}
+
+// seqKey is a direction of a TCP conversation on an interface of a capture,
+// so that a packet captured both in and out of a node is no retransmission.
+type seqKey struct {
+	forward bool
+	iface   int
+}
+
+type flowStats struct {
+	// forward is the traffic from a to b, backward the one from b to a.
+	forward, backward counter
+	first, last       time.Time
+	retransmissions   int
+	// nextSeq is the sequence number following the highest sent by each
+	// direction.
+	nextSeq map[seqKey]uint32
+}
+
+// flowSummary is the TCP and UDP conversations of capture files.
+type flowSummary struct {
+	packets   int
+	sightings map[flowSighting]*flowStats
+	// initiators is the endpoint that opened each conversation: the sender
+	// of its SYN, or else of its first packet.
+	initiators map[flowEnds]netip.AddrPort
+	synSeen    map[flowEnds]bool
+}
+
+func newFlowSummary() *flowSummary {
+	return &flowSummary{
+		sightings:  make(map[flowSighting]*flowStats),
+		initiators: make(map[flowEnds]netip.AddrPort),
+		synSeen:    make(map[flowEnds]bool),
+	}
+}
+
+// add accounts the innermost TCP or UDP segment of a packet, along with the
+// VNI it was encapsulated in if any.
+func (f *flowSummary) add(point string, data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	f.packets++
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	var (
+		sighting flowSighting
+		src, dst netip.Addr
+		tcp      *layers.TCP
+		udp      *layers.UDP
+	)
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.VXLAN:
+			sighting.encap, sighting.vni = true, l.VNI
+			tcp, udp = nil, nil
+		case *layers.IPv4:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+		case *layers.IPv6:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+		case *layers.TCP:
+			tcp = l
+		case *layers.UDP:
+			udp = l
+		}
+	}
+	var from, to netip.AddrPort
+	switch {
+	case tcp != nil:
+		sighting.ends.protocol = "TCP"
+		from = netip.AddrPortFrom(src.Unmap(), uint16(tcp.SrcPort))
+		to = netip.AddrPortFrom(dst.Unmap(), uint16(tcp.DstPort))
+	case udp != nil:
+		sighting.ends.protocol = "UDP"
+		from = netip.AddrPortFrom(src.Unmap(), uint16(udp.SrcPort))
+		to = netip.AddrPortFrom(dst.Unmap(), uint16(udp.DstPort))
+	default:
+		return
+	}
+	forward := from.Compare(to) <= 0
+	if forward {
+		sighting.ends.a, sighting.ends.b = from, to
+	} else {
+		sighting.ends.a, sighting.ends.b = to, from
+	}
+	sighting.point = point
+
+	ends := sighting.ends
+	if _, ok := f.initiators[ends]; !ok {
+		f.initiators[ends] = from
+	}
+	if tcp != nil && tcp.SYN && !tcp.ACK && !f.synSeen[ends] {
+		f.synSeen[ends] = true
+		f.initiators[ends] = from
+	}
+
+	st := f.sightings[sighting]
+	if st == nil {
+		st = &flowStats{first: ci.Timestamp, nextSeq: make(map[seqKey]uint32)}
+		f.sightings[sighting] = st
+	}
+	if ci.Timestamp.Before(st.first) {
+		st.first = ci.Timestamp
+	}
+	if ci.Timestamp.After(st.last) {
+		st.last = ci.Timestamp
+	}
+	if forward {
+		st.forward.add(ci.Length)
+	} else {
+		st.backward.add(ci.Length)
+	}
+	if tcp == nil {
+		return
+	}
+
+	// A segment carrying data that ends at or before the highest sequence
+	// number already sent in its direction is a retransmission.
+	length := uint32(len(tcp.Payload))
+	if tcp.SYN {
+		length++
+	}
+	if tcp.FIN {
+		length++
+	}
+	if length == 0 {
+		return
+	}
+	key := seqKey{forward: forward, iface: ci.InterfaceIndex}
+	end := tcp.Seq + length
+	next, ok := st.nextSeq[key]
+	switch {
+	case !ok || int32(end-next) > 0:
+		st.nextSeq[key] = end
+	default:
+		st.retransmissions++
+	}
+}
+
+// vrfVNIs returns the VNIs, L2 and L3, that belong to a VRF on any router
+// of the fabric.
+func vrfVNIs(vrf string) (map[uint32]bool, error) {
+	routers, err := fabricRouters()
+	if err != nil {
+		return nil, err
+	}
+	vnis := make(map[uint32]bool)
+	var lastErr error
+	queried := 0
+	for _, router := range routers {
+		configured, err := frrClient(router).VNIs()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, v := range configured {
+			if v.BoundVRF() == vrf {
+				vnis[v.VNI] = true
+			}
+		}
+		queried++
+	}
+	if queried == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return vnis, nil
+}
+
+func (s *MCPServer) extractFlows(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	top := defaultTopFlows
+	if v, ok := args["top"].(float64); ok && v > 0 {
+		top = int(v)
+	}
+	protocol, _ := args["protocol"].(string)
+	protocol = strings.ToUpper(protocol)
+	if protocol != "" && protocol != "TCP" && protocol != "UDP" {
+		return toolError(fmt.Sprintf("invalid protocol %q, expected tcp or udp", args["protocol"]))
+	}
+	var address netip.Addr
+	if v, _ := args["address"].(string); v != "" {
+		if address, err = netip.ParseAddr(v); err != nil {
+			return toolError(fmt.Sprintf("invalid address %q", v))
+		}
+	}
+	port := -1
+	if v, ok := args["port"].(float64); ok {
+		port = int(v)
+	}
+
+	// Both VNI and VRF select the VXLAN traffic of the VNIs they name.
+	var vnis map[uint32]bool
+	if v, ok := args["vni"].(float64); ok {
+		vnis = map[uint32]bool{uint32(v): true}
+	}
+	vrf, _ := args["vrf"].(string)
+	if vrf != "" {
+		if vnis != nil {
+			return toolError("vni and vrf are mutually exclusive")
+		}
+		if vnis, err = vrfVNIs(vrf); err != nil {
+			return toolError(fmt.Sprintf("Error resolving the VNIs of VRF %s: %v", vrf, err))
+		}
+		if len(vnis) == 0 {
+			return toolError(fmt.Sprintf("VRF %s has no VNI on any router", vrf))
+		}
+	}
+
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	summary := newFlowSummary()
+	for _, in := range inputs {
+		point := in.node
+		if point == "" {
+			point = filepath.Base(in.path)
+		}
+		err := readCapture(in, func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+			summary.add(point, data, ci, linkType)
+		})
+		if err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+	}
+
+	// Group the sightings by conversation, keeping the ones matching the
+	// filters; conversations are ranked by the bytes of their busiest
+	// sighting, so that one seen on every node does not count several times.
+	matches := func(sighting flowSighting) bool {
+		ends := sighting.ends
+		switch {
+		case protocol != "" && ends.protocol != protocol,
+			address.IsValid() && ends.a.Addr() != address && ends.b.Addr() != address,
+			port >= 0 && int(ends.a.Port()) != port && int(ends.b.Port()) != port,
+			vnis != nil && (!sighting.encap || !vnis[sighting.vni]):
+			return false
+		}
+		return true
+	}
+	conversations := make(map[flowEnds][]flowSighting)
+	volume := make(map[flowEnds]int)
+	for sighting, st := range summary.sightings {
+		if !matches(sighting) {
+			continue
+		}
+		conversations[sighting.ends] = append(conversations[sighting.ends], sighting)
+		volume[sighting.ends] = max(volume[sighting.ends], st.forward.bytes+st.backward.bytes)
+	}
+	ranked := make([]flowEnds, 0, len(conversations))
+	for ends := range conversations {
+		ranked = append(ranked, ends)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if volume[ranked[i]] != volume[ranked[j]] {
+			return volume[ranked[i]] > volume[ranked[j]]
+		}
+		return ranked[i].less(ranked[j])
+	})
+	shown := min(len(ranked), top)
+
+	var b strings.Builder
+	var fields record
+	fields.add("packets", summary.packets)
+	fields.add("conversations", len(ranked))
+	fields.add("shown", shown)
+	fmt.Fprintf(&b, "%d TCP/UDP conversation(s) out of %d packets in %d file(s)", len(ranked), summary.packets, len(inputs))
+	if shown < len(ranked) {
+		fmt.Fprintf(&b, ", showing the %d largest", shown)
+	}
+	b.WriteString("\n")
+
+	flows := newTable("flows", "protocol", "source", "destination", "point", "vni", "packets", "bytes",
+		"reply_packets", "reply_bytes", "start", "duration", "retransmissions")
+	for _, ends := range ranked[:shown] {
+		src, dst := ends.a, ends.b
+		if summary.initiators[ends] == ends.b {
+			src, dst = ends.b, ends.a
+		}
+		sightings := conversations[ends]
+		sort.Slice(sightings, func(i, j int) bool {
+			a, b := summary.sightings[sightings[i]], summary.sightings[sightings[j]]
+			if !a.first.Equal(b.first) {
+				return a.first.Before(b.first)
+			}
+			if sightings[i].point != sightings[j].point {
+				return sightings[i].point < sightings[j].point
+			}
+			if sightings[i].encap != sightings[j].encap {
+				return !sightings[i].encap
+			}
+			return sightings[i].vni < sightings[j].vni
+		})
+		points := make([]string, 0, len(sightings))
+		for _, sighting := range sightings {
+			if !containsString(points, sighting.point) {
+				points = append(points, sighting.point)
+			}
+		}
+		fmt.Fprintf(&b, "\n%s %s -> %s, seen on %s\n", ends.protocol, src, dst, strings.Join(points, ", "))
+
+		for _, sighting := range sightings {
+			st := summary.sightings[sighting]
+			sent, replied := st.forward, st.backward
+			if src != ends.a {
+				sent, replied = replied, sent
+			}
+			duration := st.last.Sub(st.first)
+			var vni, retransmissions any
+			where := "bare"
+			if sighting.encap {
+				vni = sighting.vni
+				where = fmt.Sprintf("VNI %d", sighting.vni)
+			}
+			if ends.protocol == "TCP" {
+				retransmissions = st.retransmissions
+			}
+			flows.add(ends.protocol, src.String(), dst.String(), sighting.point, vni, sent.packets, sent.bytes,
+				replied.packets, replied.bytes, st.first.UTC().Format(time.RFC3339Nano), duration.String(), retransmissions)
+
+			line := fmt.Sprintf("  %-24s %-10s %7d pkts %10s, %7d pkts %10s back, %s from %s",
+				sighting.point, where, sent.packets, formatSize(int64(sent.bytes)), replied.packets, formatSize(int64(replied.bytes)),
+				duration.Round(time.Millisecond), st.first.Format("15:04:05.000"))
+			if st.retransmissions > 0 {
+				line += fmt.Sprintf(", %d retransmission(s)", st.retransmissions)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	return formattedResult(format, b.String(), false, fields, flows)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// echoKey identifies an echo request, and its reply with the addresses
+// swapped.
+type echoKey struct {
+	src, dst netip.Addr
+	id, seq  uint16
+}
+
+// echoFlow groups the echoes of a ping run.
+type echoFlow struct {
+	src, dst netip.Addr
+	id       uint16
+}
+
+// echoTrace is where an echo request and its reply were seen: the first time
+// each capture point saw them, and the ICMP errors reporting the request.
+type echoTrace struct {
+	requested map[string]time.Time
+	replied   map[string]time.Time
+	errors    []string
+}
+
+// icmpError is an ICMP error message, with the packet it reports.
+type icmpError struct {
+	time     time.Time
+	point    string
+	reporter netip.Addr
+	kind     string
+	// src and dst are the addresses of the reported packet.
+	src, dst netip.Addr
+	original string
+}
+
+// icmpSummary is the analysis of the ICMP traffic seen at the capture points.
+type icmpSummary struct {
+	requests, replies int
+	echoes            map[echoKey]*echoTrace
+	errors            []icmpError
+	points            []string
+}
+
+func newICMPSummary() *icmpSummary {
+	return &icmpSummary{echoes: make(map[echoKey]*echoTrace)}
+}
+
+func (c *icmpSummary) trace(key echoKey) *echoTrace {
+	t, ok := c.echoes[key]
+	if !ok {
+		t = &echoTrace{requested: make(map[string]time.Time), replied: make(map[string]time.Time)}
+		c.echoes[key] = t
+	}
+	return t
+}
+
+func sighted(seen map[string]time.Time, point string, at time.Time) {
+	if first, ok := seen[point]; !ok || at.Before(first) {
+		seen[point] = at
+	}
+}
+
+// add accounts the innermost ICMP message of a packet seen at a capture
+// point, so echoes carried in VXLAN on some nodes and bare on others are
+// matched.
+func (c *icmpSummary) add(point string, data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	var src, dst netip.Addr
+	var icmp4 *layers.ICMPv4
+	var icmp6 *layers.ICMPv6
+	var echo6 *layers.ICMPv6Echo
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv4:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+			icmp4, icmp6, echo6 = nil, nil, nil
+		case *layers.IPv6:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+			icmp4, icmp6, echo6 = nil, nil, nil
+		case *layers.ICMPv4:
+			icmp4 = l
+		case *layers.ICMPv6:
+			icmp6 = l
+		case *layers.ICMPv6Echo:
+			echo6 = l
+		}
+	}
+	src, dst = src.Unmap(), dst.Unmap()
+
+	switch {
+	case icmp4 != nil:
+		switch icmp4.TypeCode.Type() {
+		case layers.ICMPv4TypeEchoRequest:
+			c.requests++
+			sighted(c.trace(echoKey{src, dst, icmp4.Id, icmp4.Seq}).requested, point, ci.Timestamp)
+		case layers.ICMPv4TypeEchoReply:
+			c.replies++
+			sighted(c.trace(echoKey{dst, src, icmp4.Id, icmp4.Seq}).replied, point, ci.Timestamp)
+		case layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4TypeTimeExceeded:
+			c.addError(point, ci.Timestamp, src, icmp4.TypeCode.String(), icmp4.LayerPayload(), layers.LayerTypeIPv4)
+		}
+	case icmp6 != nil:
+		switch icmp6.TypeCode.Type() {
+		case layers.ICMPv6TypeEchoRequest:
+			if echo6 != nil {
+				c.requests++
+				sighted(c.trace(echoKey{src, dst, echo6.Identifier, echo6.SeqNumber}).requested, point, ci.Timestamp)
+			}
+		case layers.ICMPv6TypeEchoReply:
+			if echo6 != nil {
+				c.replies++
+				sighted(c.trace(echoKey{dst, src, echo6.Identifier, echo6.SeqNumber}).replied, point, ci.Timestamp)
+			}
+		case layers.ICMPv6TypeDestinationUnreachable, layers.ICMPv6TypeTimeExceeded:
+			// The original packet follows 4 unused bytes.
+			if payload := icmp6.LayerPayload(); len(payload) > 4 {
+				c.addError(point, ci.Timestamp, src, icmp6.TypeCode.String(), payload[4:], layers.LayerTypeIPv6)
+			}
+		}
+	}
+}
+
+// addError records an ICMP error and, if it reports an echo request, ties
+// it to the echo.
+func (c *icmpSummary) addError(point string, at time.Time, reporter netip.Addr, kind string, original []byte, first gopacket.LayerType) {
+	e := icmpError{time: at, point: point, reporter: reporter, kind: kind}
+	packet := gopacket.NewPacket(original, first, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	var src, dst netip.Addr
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv4:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+			e.original = fmt.Sprintf("%s -> %s %s", src, dst, l.Protocol)
+		case *layers.IPv6:
+			src, _ = netip.AddrFromSlice(l.SrcIP)
+			dst, _ = netip.AddrFromSlice(l.DstIP)
+			e.original = fmt.Sprintf("%s -> %s %s", src, dst, l.NextHeader)
+		case *layers.ICMPv4:
+			if l.TypeCode.Type() == layers.ICMPv4TypeEchoRequest {
+				e.original += fmt.Sprintf(" echo id %d seq %d", l.Id, l.Seq)
+				c.reportEcho(echoKey{src.Unmap(), dst.Unmap(), l.Id, l.Seq}, e)
+			}
+		case *layers.ICMPv6Echo:
+			e.original += fmt.Sprintf(" echo id %d seq %d", l.Identifier, l.SeqNumber)
+			c.reportEcho(echoKey{src.Unmap(), dst.Unmap(), l.Identifier, l.SeqNumber}, e)
+		case *layers.TCP:
+			e.original += fmt.Sprintf(" port %d -> %d", l.SrcPort, l.DstPort)
+		case *layers.UDP:
+			e.original += fmt.Sprintf(" port %d -> %d", l.SrcPort, l.DstPort)
+		}
+	}
+	e.src, e.dst = src.Unmap(), dst.Unmap()
+	if e.original == "" {
+		e.original = "undecodable packet"
+	}
+	c.errors = append(c.errors, e)
+}
+
+func (c *icmpSummary) reportEcho(key echoKey, e icmpError) {
+	t := c.trace(key)
+	t.errors = append(t.errors, fmt.Sprintf("%s from %s", e.kind, e.reporter))
+}
+
+// pathOf returns the capture points that saw a message, in the order they
+// saw it.
+func pathOf(seen map[string]time.Time) []string {
+	points := make([]string, 0, len(seen))
+	for p := range seen {
+		points = append(points, p)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if !seen[points[i]].Equal(seen[points[j]]) {
+			return seen[points[i]].Before(seen[points[j]])
+		}
+		return points[i] < points[j]
+	})
+	return points
+}
+
+// fate tells what became of an echo: answered, answered by an ICMP error,
+// or where its request or reply was last seen. The first point seeing the
+// request stands for the source; the reply must come back to it.
+func (t *echoTrace) fate() (answered bool, stop string) {
+	requestPath := pathOf(t.requested)
+	if len(requestPath) == 0 {
+		// Only the reply was captured, the request went unseen.
+		return true, ""
+	}
+	source := requestPath[0]
+	if _, ok := t.replied[source]; ok {
+		return true, ""
+	}
+	if len(t.errors) > 0 {
+		return false, "answered by " + t.errors[0]
+	}
+	if replyPath := pathOf(t.replied); len(replyPath) > 0 {
+		return false, "reply last seen on " + replyPath[len(replyPath)-1]
+	}
+	return false, "request last seen on " + requestPath[len(requestPath)-1]
+}
+
+func (s *MCPServer) analyzeICMP(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var address netip.Addr
+	if v, _ := args["address"].(string); v != "" {
+		if address, err = netip.ParseAddr(v); err != nil {
+			return toolError(fmt.Sprintf("invalid address %q", v))
+		}
+	}
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	summary := newICMPSummary()
+	for _, in := range inputs {
+		point := in.node
+		if point == "" {
+			point = filepath.Base(in.path)
+		}
+		if !containsString(summary.points, point) {
+			summary.points = append(summary.points, point)
+		}
+		err := readCapture(in, func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+			summary.add(point, data, ci, linkType)
+		})
+		if err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+	}
+	sort.SliceStable(summary.errors, func(i, j int) bool { return summary.errors[i].time.Before(summary.errors[j].time) })
+
+	flows := make(map[echoFlow][]echoKey)
+	for key := range summary.echoes {
+		if address.IsValid() && key.src != address && key.dst != address {
+			continue
+		}
+		flow := echoFlow{key.src, key.dst, key.id}
+		flows[flow] = append(flows[flow], key)
+	}
+	flowKeys := make([]echoFlow, 0, len(flows))
+	for f := range flows {
+		flowKeys = append(flowKeys, f)
+	}
+	sort.Slice(flowKeys, func(i, j int) bool {
+		a, b := flowKeys[i], flowKeys[j]
+		if a.src != b.src {
+			return a.src.Less(b.src)
+		}
+		if a.dst != b.dst {
+			return a.dst.Less(b.dst)
+		}
+		return a.id < b.id
+	})
+
+	var errors []icmpError
+	for _, e := range summary.errors {
+		if !address.IsValid() || e.src == address || e.dst == address {
+			errors = append(errors, e)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d echo requests, %d echo replies, %d ICMP errors in %d file(s), capture points: %s\n",
+		summary.requests, summary.replies, len(errors), len(inputs), strings.Join(summary.points, ", "))
+
+	flowsTable := newTable("flows", "source", "destination", "id", "echoes", "answered", "lost", "request_path", "reply_path")
+	sightings := newTable("sightings", "source", "destination", "id", "point", "requests", "replies")
+	losses := newTable("losses", "source", "destination", "id", "fate", "echoes")
+	var findings []string
+	for _, flow := range flowKeys {
+		keys := flows[flow]
+		sort.Slice(keys, func(i, j int) bool { return keys[i].seq < keys[j].seq })
+
+		// The paths are the ones of the echo seen by the most points.
+		requestPath, replyPath := []string{}, []string{}
+		requests := make(map[string]int)
+		replies := make(map[string]int)
+		fates := make(map[string]int)
+		answered := 0
+		for _, key := range keys {
+			t := summary.echoes[key]
+			if p := pathOf(t.requested); len(p) > len(requestPath) {
+				requestPath = p
+			}
+			if p := pathOf(t.replied); len(p) > len(replyPath) {
+				replyPath = p
+			}
+			for p := range t.requested {
+				requests[p]++
+			}
+			for p := range t.replied {
+				replies[p]++
+			}
+			if ok, stop := t.fate(); ok {
+				answered++
+			} else {
+				fates[stop]++
+			}
+		}
+		lost := len(keys) - answered
+		flowsTable.add(flow.src.String(), flow.dst.String(), flow.id, len(keys), answered, lost, requestPath, replyPath)
+		fmt.Fprintf(&b, "\n%s -> %s id %d: %d echoes, %d answered, %d lost\n", flow.src, flow.dst, flow.id, len(keys), answered, lost)
+		fmt.Fprintf(&b, "  request path: %s\n", strings.Join(requestPath, " → "))
+		if len(replyPath) > 0 {
+			fmt.Fprintf(&b, "  reply path:   %s\n", strings.Join(replyPath, " → "))
+		}
+		fmt.Fprintf(&b, "  %-40s %8s %8s\n", "seen on", "requests", "replies")
+		for _, point := range summary.points {
+			if requests[point] == 0 && replies[point] == 0 {
+				continue
+			}
+			sightings.add(flow.src.String(), flow.dst.String(), flow.id, point, requests[point], replies[point])
+			fmt.Fprintf(&b, "  %-40s %8d %8d\n", point, requests[point], replies[point])
+		}
+		stops := make([]string, 0, len(fates))
+		for stop := range fates {
+			stops = append(stops, stop)
+		}
+		sort.Strings(stops)
+		for _, stop := range stops {
+			losses.add(flow.src.String(), flow.dst.String(), flow.id, stop, fates[stop])
+			fmt.Fprintf(&b, "  ✗ %d echo(es) %s\n", fates[stop], stop)
+			findings = append(findings, fmt.Sprintf("%s -> %s id %d: %d echo(es) %s", flow.src, flow.dst, flow.id, fates[stop], stop))
+		}
+	}
+	if len(flowKeys) == 0 {
+		b.WriteString("\nNo echo request or reply captured.\n")
+	}
+
+	errorsTable := newTable("errors", "time", "point", "reporter", "type", "original")
+	if len(errors) > 0 {
+		b.WriteString("\nICMP errors:\n")
+	}
+	for _, e := range errors {
+		errorsTable.add(e.time.UTC().Format(time.RFC3339Nano), e.point, e.reporter.String(), e.kind, e.original)
+		fmt.Fprintf(&b, "  %s %s: %s reports %s for %s\n", e.time.Format("15:04:05.000"), e.point, e.reporter, e.kind, e.original)
+	}
+
+	var fields record
+	fields.add("echo_requests", summary.requests)
+	fields.add("echo_replies", summary.replies)
+	fields.add("icmp_errors", len(errors))
+	fields.add("capture_points", summary.points)
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, flowsTable, sightings, losses, errorsTable)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureFileName returns the name of the pcapng tshark writes on a node,
+// derived from the capture filter.
+func captureFileName(filter, node string) string {
+	var b strings.Builder
+	for _, r := range strings.ReplaceAll(filter, " ", "_") {
+		if r == '_' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String() + "_capture_" + node + ".pcapng"
+}
+
+// rotatedSuffixRe matches the suffix tshark appends to the files of a ring
+// buffer, before the extension.
+var rotatedSuffixRe = regexp.MustCompile(`_\d{5}_\d{14}$`)
+
+// rotatedFileGlob returns the glob matching the files of a ring buffer
+// capture of a node.
+func rotatedFileGlob(filter, node string) string {
+	return strings.TrimSuffix(captureFileName(filter, node), ".pcapng") + "_[0-9]*_[0-9]*.pcapng"
+}
+
+// capturedFiles returns the pcaps of a node copied to the output directory,
+// the rotated files of a ring buffer and encrypted files included.
+func capturedFiles(outputDir, filter, node string) []string {
+	var files []string
+	single := filepath.Join(outputDir, captureFileName(filter, node))
+	for _, path := range []string{single, single + encryptedCaptureSuffix} {
+		if fileExists(path) {
+			files = append(files, path)
+		}
+	}
+	for _, suffix := range []string{"", encryptedCaptureSuffix} {
+		rotated, _ := filepath.Glob(filepath.Join(outputDir, rotatedFileGlob(filter, node)+suffix))
+		files = append(files, rotated...)
+	}
+	return files
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// captureStatus is a copy of the state of a capture, safe to read without
+// holding the server lock.
+type captureStatus struct {
+	ActiveCall
+	running bool
+	// sizes maps the nodes to the current size of their pcaps, -1 when it
+	// could not be read, and counts to the number of files.
+	sizes  map[string]int64
+	counts map[string]int
+}
+
+// captureStatuses returns the running and recently finished captures of a
+// session, or of every session when sessionID is empty, oldest first.
+func (s *MCPServer) captureStatuses(sessionID string) []*captureStatus {
+	s.mu.Lock()
+	var statuses []*captureStatus
+	add := func(call *ActiveCall, running bool) {
+		if sessionID != "" && call.SessionID != sessionID {
+			return
+		}
+		st := &captureStatus{ActiveCall: *call, running: running}
+		st.Nodes = append([]string(nil), call.Nodes...)
+		st.PIDs = make(map[string]int, len(call.PIDs))
+		for node, pid := range call.PIDs {
+			st.PIDs[node] = pid
+		}
+		statuses = append(statuses, st)
+	}
+	for _, call := range s.activeCalls {
+		add(call, true)
+	}
+	for _, call := range s.finishedCaptures {
+		add(call, false)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Started.Before(statuses[j].Started) })
+	return statuses
+}
+
+// readSizes fills the pcap sizes of a capture: from the containers while it
+// runs, from the output directory once the files were copied out.
+func (st *captureStatus) readSizes() {
+	st.sizes = make(map[string]int64)
+	st.counts = make(map[string]int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range st.Nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var sizes []int64
+			if st.running && node != hostCaptureNode {
+				// stat fails on the glob when the ring buffer has not
+				// rotated yet, but still prints the size of the other file.
+				out, _ := exec.Command("docker", "exec", node, "sh", "-c",
+					fmt.Sprintf("stat -c%%s /%s /%s 2>/dev/null", captureFileName(st.nodeFilter(node), node), rotatedFileGlob(st.nodeFilter(node), node))).Output()
+				for _, field := range strings.Fields(string(out)) {
+					if n, err := strconv.ParseInt(field, 10, 64); err == nil {
+						sizes = append(sizes, n)
+					}
+				}
+			} else {
+				for _, file := range capturedFiles(st.OutputDir, st.nodeFilter(node), node) {
+					if info, err := os.Stat(file); err == nil {
+						sizes = append(sizes, info.Size())
+					}
+				}
+			}
+			size := int64(-1)
+			if len(sizes) > 0 {
+				size = 0
+				for _, n := range sizes {
+					size += n
+				}
+			}
+			mu.Lock()
+			st.sizes[node] = size
+			st.counts[node] = len(sizes)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *MCPServer) listTrafficCaptures(sessionID string, args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	scope := sessionID
+	if allSessions, ok := args["all_sessions"].(bool); ok && allSessions {
+		scope = ""
+	}
+
+	statuses := s.captureStatuses(scope)
+	if label, _ := args["label"].(string); label != "" {
+		var labelled []*captureStatus
+		for _, st := range statuses {
+			if st.Label == label {
+				labelled = append(labelled, st)
+			}
+		}
+		statuses = labelled
+	}
+	var wg sync.WaitGroup
+	for _, st := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st.readSizes()
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now()
+	captures := newTable("captures", "capture_id", "session", "state", "started", "elapsed", "filter", "nodes", "output_dir", "total_bytes", "stop_at", "max_packets", "label")
+	files := newTable("files", "capture_id", "node", "interfaces", "file", "bytes")
+	var b strings.Builder
+	var running int
+	for _, st := range statuses {
+		state, end, verb := "finished", st.Finished, "ran for"
+		if st.running {
+			state, end, verb = "running", now, "running for"
+			running++
+		}
+		elapsed := end.Sub(st.Started).Truncate(time.Second)
+
+		var total int64
+		var sizes []string
+		for _, node := range st.Nodes {
+			size := st.sizes[node]
+			interfaces := st.Interfaces[node]
+			if len(interfaces) == 0 {
+				interfaces = []string{"any"}
+			}
+			name := captureFileName(st.nodeFilter(node), node)
+			if st.FileSizeKB > 0 {
+				name = rotatedFileGlob(st.nodeFilter(node), node)
+			}
+			path := filepath.Join(st.OutputDir, name)
+			if st.running && node != hostCaptureNode {
+				path = node + ":/" + name
+			}
+			if size < 0 {
+				sizes = append(sizes, node+" (unavailable)")
+				files.add(st.CaptureID, node, interfaces, path, nil)
+				continue
+			}
+			total += size
+			if st.counts[node] > 1 {
+				sizes = append(sizes, fmt.Sprintf("%s %s in %d files", node, formatSize(size), st.counts[node]))
+			} else {
+				sizes = append(sizes, fmt.Sprintf("%s %s", node, formatSize(size)))
+			}
+			files.add(st.CaptureID, node, interfaces, path, size)
+		}
+
+		var stopAt any
+		if !st.StopAt.IsZero() {
+			stopAt = st.StopAt.UTC().Format(time.RFC3339)
+		}
+		var maxPackets any
+		if st.MaxPackets > 0 {
+			maxPackets = st.MaxPackets
+		}
+		var label any
+		if st.Label != "" {
+			label = st.Label
+		}
+		captures.add(st.CaptureID, st.SessionID, state, st.Started.UTC().Format(time.RFC3339), elapsed.String(),
+			st.Filter, strings.Join(st.Nodes, ", "), st.OutputDir, total, stopAt, maxPackets, label)
+		fmt.Fprintf(&b, "%s (%s, session %s): started %s, %s %s, filter %q\n", st.CaptureID, state, st.SessionID,
+			st.Started.Format("2006-01-02 15:04:05"), verb, elapsed, st.Filter)
+		if st.Label != "" {
+			fmt.Fprintf(&b, "  label: %s\n", st.Label)
+		}
+		fmt.Fprintf(&b, "  output directory: %s\n", st.OutputDir)
+		if st.running && !st.StopAt.IsZero() {
+			fmt.Fprintf(&b, "  stops automatically at %s\n", st.StopAt.Format("2006-01-02 15:04:05"))
+		}
+		if st.FileSizeKB > 0 {
+			fmt.Fprintf(&b, "  ring buffer of %d files of %d kB per node\n", st.NumFiles, st.FileSizeKB)
+		}
+		if st.running && st.MaxPackets > 0 {
+			fmt.Fprintf(&b, "  stops once every node captured %d packets\n", st.MaxPackets)
+		}
+		if len(st.Nodes) == 0 {
+			b.WriteString("  nodes: none reported yet\n")
+		} else {
+			fmt.Fprintf(&b, "  pcaps: %s (total %s)\n", strings.Join(sizes, ", "), formatSize(total))
+		}
+		if len(st.Interfaces) > 0 {
+			var selected []string
+			for node, interfaces := range st.Interfaces {
+				selected = append(selected, fmt.Sprintf("%s (%s)", node, strings.Join(interfaces, ", ")))
+			}
+			sort.Strings(selected)
+			fmt.Fprintf(&b, "  interfaces: %s\n", strings.Join(selected, ", "))
+		}
+		if len(st.NodeFilters) > 0 {
+			var filters []string
+			for node, filter := range st.NodeFilters {
+				filters = append(filters, fmt.Sprintf("%s (%q)", node, filter))
+			}
+			sort.Strings(filters)
+			fmt.Fprintf(&b, "  node filters: %s\n", strings.Join(filters, ", "))
+		}
+	}
+
+	scheduled := s.sessionSchedules(scope)
+	schedules := newTable("schedules", "schedule_id", "session", "start_at", "schedule", "next_run", "runs", "last_capture_id")
+	s.mu.Lock()
+	for _, sc := range scheduled {
+		var startAt, expr, lastCapture any
+		when := "once"
+		if sc.cron != nil {
+			expr, when = sc.cron.expr, fmt.Sprintf("on %q", sc.cron.expr)
+		} else {
+			startAt = sc.startAt.UTC().Format(time.RFC3339)
+		}
+		if sc.captureID != "" {
+			lastCapture = sc.captureID
+		}
+		var nextRun any
+		if !sc.nextRun.IsZero() {
+			nextRun = sc.nextRun.UTC().Format(time.RFC3339)
+		}
+		schedules.add(sc.ID, sc.SessionID, startAt, expr, nextRun, len(sc.runs), lastCapture)
+		fmt.Fprintf(&b, "%s (scheduled %s, session %s): next run at %s, %d run(s) so far\n", sc.ID, when, sc.SessionID,
+			sc.nextRun.Format("2006-01-02 15:04:05"), len(sc.runs))
+	}
+	s.mu.Unlock()
+
+	summary := fmt.Sprintf("%d running and %d recently finished capture(s)", running, len(statuses)-running)
+	if len(scheduled) > 0 {
+		summary += fmt.Sprintf(", %d scheduled", len(scheduled))
+	}
+	if scope != "" {
+		summary += " for this session"
+	}
+	text := summary + "\n\n" + b.String()
+	if len(statuses) == 0 && len(scheduled) == 0 {
+		text = summary + ".\n"
+	}
+
+	var fields record
+	fields.add("running", running)
+	fields.add("finished", len(statuses)-running)
+	fields.add("scheduled", len(scheduled))
+	return formattedResult(format, text, false, fields, captures, files, schedules)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultLiveRate is the number of live packet summaries forwarded per
+// second when the client does not choose one.
+const defaultLiveRate = 5
+
+// liveModes are where the live packet summaries of a capture go.
+var liveModes = map[string]struct{ notify, resource bool }{
+	"notify":   {notify: true},
+	"resource": {resource: true},
+	"both":     {notify: true, resource: true},
+}
+
+// liveSummaries forwards the packet summaries of a running capture to its
+// session, filtered and rate-limited. The capture run calls it with one
+// summary at a time.
+type liveSummaries struct {
+	mode   string
+	filter *regexp.Regexp
+	rate   int
+	// path is the file the summaries are appended to for the resource mode.
+	path string
+	// window is the start of the current second, in which sent summaries
+	// were forwarded and dropped ones exceeded the rate.
+	window        time.Time
+	sent, dropped int
+}
+
+// liveSummariesPath returns the file the live summaries of a capture are
+// appended to, served as the capture://{session}/live/{capture_id}.txt
+// resource.
+func liveSummariesPath(outputDir, captureID string) string {
+	return filepath.Join(outputDir, "live_"+captureID+".txt")
+}
+
+// liveSummariesArgs parses the live, live_filter and live_rate arguments of
+// start_traffic_capture, returning nil when live summaries are off.
+func liveSummariesArgs(args map[string]any) (*liveSummaries, error) {
+	mode, _ := args["live"].(string)
+	if mode == "" {
+		if _, ok := args["live_filter"]; ok {
+			return nil, fmt.Errorf("live_filter requires live")
+		}
+		return nil, nil
+	}
+	if _, ok := liveModes[mode]; !ok {
+		return nil, fmt.Errorf("invalid live %q, expected notify, resource or both", mode)
+	}
+	live := &liveSummaries{mode: mode, rate: defaultLiveRate}
+	if v, _ := args["live_filter"].(string); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid live_filter: %w", err)
+		}
+		live.filter = re
+	}
+	if v, ok := args["live_rate"].(float64); ok {
+		if v < 1 {
+			return nil, fmt.Errorf("live_rate must be at least 1")
+		}
+		live.rate = int(v)
+	}
+	return live, nil
+}
+
+// describe tells the client where the summaries of a capture go.
+func (l *liveSummaries) describe(call *ActiveCall) string {
+	var sinks []string
+	if liveModes[l.mode].notify {
+		sinks = append(sinks, "sent as notifications")
+	}
+	if liveModes[l.mode].resource {
+		sinks = append(sinks, fmt.Sprintf("appended to %s (the capture://%s/live/%s.txt resource when saved in the session directory)",
+			l.path, call.SessionID, call.CaptureID))
+	}
+	text := "Live packet summaries are " + strings.Join(sinks, " and ")
+	if l.filter != nil {
+		text += fmt.Sprintf(", when matching %q", l.filter)
+	}
+	return text + fmt.Sprintf(", at most %d per second.\n", l.rate)
+}
+
+// handleLiveSummary forwards a packet summary captured on a node.
+func (s *MCPServer) handleLiveSummary(call *ActiveCall, node, summary string) {
+	l := call.Live
+	if l == nil {
+		return
+	}
+	summary = strings.TrimSpace(summary)
+	if l.filter != nil && !l.filter.MatchString(node+" "+summary) {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(l.window) >= time.Second {
+		if l.dropped > 0 {
+			s.forwardLive(call, "", fmt.Sprintf("%d packet summaries dropped, over %d per second", l.dropped, l.rate))
+		}
+		l.window, l.sent, l.dropped = now, 0, 0
+	}
+	if l.sent >= l.rate {
+		l.dropped++
+		return
+	}
+	l.sent++
+	s.forwardLive(call, node, summary)
+}
+
+// forwardLive sends a packet summary, or a note about them when node is
+// empty, to the sinks of the capture.
+func (s *MCPServer) forwardLive(call *ActiveCall, node, summary string) {
+	l := call.Live
+	if liveModes[l.mode].notify {
+		data := map[string]any{
+			"event":      "capture_packet",
+			"capture_id": call.CaptureID,
+			"message":    summary,
+		}
+		if node != "" {
+			data["node"] = node
+		}
+		s.notify(call.SessionID, "info", data)
+	}
+	if liveModes[l.mode].resource {
+		line := summary
+		if node != "" {
+			line = node + " " + summary
+		}
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Writing live summaries of capture %s: %v\n", call.CaptureID, err)
+			return
+		}
+		fmt.Fprintln(f, line)
+		f.Close()
+	}
+}
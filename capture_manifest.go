@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// captureManifestName is the manifest written to every capture directory
+// once the files are copied out.
+const captureManifestName = "manifest.json"
+
+// manifestEntry describes a file of a capture directory in its manifest.
+type manifestEntry struct {
+	Path string `json:"path"`
+	// Kind is "pcap", "log", "control_plane", "live" or "other".
+	Kind   string `json:"kind"`
+	Node   string `json:"node,omitempty"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// captureManifest lists the files of a capture directory with their
+// checksums, and the capture that produced them when known, so they can be
+// verified once transferred. It is written as manifest.json in the
+// directory, and as MANIFEST.json in its archives.
+type captureManifest struct {
+	Server      ServerInfo          `json:"server"`
+	Created     time.Time           `json:"created"`
+	CaptureID   string              `json:"capture_id,omitempty"`
+	Label       string              `json:"label,omitempty"`
+	Session     string              `json:"session"`
+	Filter      string              `json:"filter,omitempty"`
+	NodeFilters map[string]string   `json:"node_filters,omitempty"`
+	Nodes       []string            `json:"nodes,omitempty"`
+	Interfaces  map[string][]string `json:"interfaces,omitempty"`
+	Started     *time.Time          `json:"started,omitempty"`
+	Finished    *time.Time          `json:"finished,omitempty"`
+	Directory   string              `json:"directory"`
+	Files       []manifestEntry     `json:"files"`
+}
+
+// classifyCaptureFile returns the kind of a file of a capture directory, by
+// its path relative to it, and the node it comes from when known.
+func classifyCaptureFile(rel string) (kind, node string) {
+	name := filepath.Base(rel)
+	switch {
+	case strings.HasPrefix(rel, "control_plane_"):
+		for _, c := range controlPlaneCommands {
+			if router, ok := strings.CutSuffix(name, "_"+c.file); ok {
+				node = router
+			}
+		}
+		return "control_plane", node
+	case name == captureLogName:
+		return "log", ""
+	case strings.HasPrefix(name, "live_") && strings.HasSuffix(name, ".txt"):
+		return "live", ""
+	case strings.HasSuffix(name, ".pcapng") || strings.HasSuffix(name, ".pcap") || strings.HasSuffix(name, ".pcapng"+encryptedCaptureSuffix):
+		name = strings.TrimSuffix(name, encryptedCaptureSuffix)
+		base := rotatedSuffixRe.ReplaceAllString(strings.TrimSuffix(name, filepath.Ext(name)), "")
+		if _, n, ok := strings.Cut(base, "_capture_"); ok {
+			node = n
+		}
+		return "pcap", node
+	}
+	return "other", ""
+}
+
+// hashFile returns the size and SHA-256 of a file.
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// buildCaptureManifest hashes the files of a capture directory, archives
+// and the manifest itself excepted. call describes the capture, nil when
+// the directory is all that is known.
+func buildCaptureManifest(call *ActiveCall, dir string) (*captureManifest, error) {
+	dir = filepath.Clean(dir)
+	manifest := &captureManifest{
+		Server:    serverInfo,
+		Created:   time.Now().UTC(),
+		Session:   filepath.Base(filepath.Dir(dir)),
+		Directory: dir,
+		Files:     []manifestEntry{},
+	}
+	if call != nil {
+		manifest.CaptureID = call.CaptureID
+		manifest.Label = call.Label
+		manifest.Session = call.SessionID
+		manifest.Filter = call.Filter
+		manifest.NodeFilters = call.NodeFilters
+		manifest.Nodes = call.Nodes
+		manifest.Interfaces = call.Interfaces
+		started, finished := call.Started.UTC(), call.Finished.UTC()
+		manifest.Started, manifest.Finished = &started, &finished
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || isArchive(entry.Name()) || strings.HasPrefix(entry.Name(), captureManifestName) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		size, sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		kind, node := classifyCaptureFile(rel)
+		manifest.Files = append(manifest.Files, manifestEntry{Path: filepath.ToSlash(rel), Kind: kind, Node: node, Bytes: size, SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, err)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	return manifest, nil
+}
+
+// writeCaptureManifest writes the manifest of a finished capture to its
+// directory, replacing the one of an earlier run in the same directory.
+func writeCaptureManifest(call *ActiveCall) (*captureManifest, error) {
+	manifest, err := buildCaptureManifest(call, call.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(call.OutputDir, captureManifestName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return nil, err
+	}
+	return manifest, os.Rename(tmp, path)
+}
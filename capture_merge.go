@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// mergedCaptureNode is the node name the merged file of a capture is stored
+// under, so that it is served as the capture://{session}/fabric.pcapng
+// resource alongside the per-node files.
+const mergedCaptureNode = "fabric"
+
+// mergeSource is a capture file being merged, positioned on its next packet.
+type mergeSource struct {
+	node   string
+	path   string
+	offset time.Duration
+	file   io.Closer
+	ng     *pcapgo.NgReader
+	pcap   *pcapgo.Reader
+	// outputIDs maps the interfaces of the file to the ones of the merged
+	// capture.
+	outputIDs []int
+	data      []byte
+	ci        gopacket.CaptureInfo
+	done      bool
+}
+
+func openMergeSource(in captureInput, offset time.Duration) (*mergeSource, error) {
+	path := in.path
+	f, err := openCapture(in)
+	if err != nil {
+		return nil, err
+	}
+	src := &mergeSource{node: in.node, path: path, offset: offset, file: f}
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err == nil {
+		if bytes.Equal(magic, pcapngMagic) {
+			src.ng, err = pcapgo.NewNgReader(br, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+		} else {
+			src.pcap, err = pcapgo.NewReader(br)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return src, src.next()
+}
+
+// next reads the following packet, its timestamp shifted by the clock offset
+// of the node.
+func (m *mergeSource) next() error {
+	var err error
+	if m.ng != nil {
+		m.data, m.ci, err = m.ng.ReadPacketData()
+	} else {
+		m.data, m.ci, err = m.pcap.ReadPacketData()
+	}
+	if errors.Is(err, io.EOF) {
+		m.done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", m.path, err)
+	}
+	m.ci.Timestamp = m.ci.Timestamp.Add(m.offset)
+	return nil
+}
+
+// interfaces returns the interfaces the file declared so far, their
+// descriptions naming the node if the file was not annotated when copied.
+func (m *mergeSource) interfaces() ([]pcapgo.NgInterface, error) {
+	var intfs []pcapgo.NgInterface
+	if m.ng == nil {
+		intfs = []pcapgo.NgInterface{{
+			Name:        filepath.Base(m.path),
+			Description: m.node,
+			LinkType:    m.pcap.LinkType(),
+			SnapLength:  m.pcap.Snaplen(),
+		}}
+	}
+	for i := 0; m.ng != nil && i < m.ng.NInterfaces(); i++ {
+		intf, err := m.ng.Interface(i)
+		if err != nil {
+			return nil, err
+		}
+		if intf.Description == "" {
+			intf.Description = strings.TrimSpace(m.node + " " + intf.Name)
+		}
+		// The merged file does not keep the interface statistics.
+		intf.Statistics = pcapgo.NgInterfaceStatistics{}
+		intfs = append(intfs, intf)
+	}
+	if m.offset != 0 {
+		for i := range intfs {
+			intfs[i].Comment = strings.TrimSpace(intfs[i].Comment + fmt.Sprintf(" (clock offset %s applied)", formatOffset(m.offset)))
+		}
+	}
+	return intfs, nil
+}
+
+// mergeCaptureFiles merges capture files into one pcapng, ordering their
+// packets by their shifted timestamps and keeping those between from and to
+// when not zero. Each file is read in order, so only its next packet is held
+// in memory.
+func mergeCaptureFiles(inputs []captureInput, offsets map[string]time.Duration, from, to time.Time, output, comment string) (packets int, first, last time.Time, err error) {
+	var sources []*mergeSource
+	defer func() {
+		for _, src := range sources {
+			src.file.Close()
+		}
+	}()
+	for _, in := range inputs {
+		src, err := openMergeSource(in, offsets[in.node])
+		if err != nil {
+			return 0, first, last, err
+		}
+		sources = append(sources, src)
+	}
+
+	tmp := output + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, first, last, err
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	var w *pcapgo.NgWriter
+	declared := 0
+	// declare adds the interfaces a file declared since its last packet to
+	// the merged capture, creating it with the very first one.
+	declare := func(src *mergeSource) error {
+		intfs, err := src.interfaces()
+		if err != nil {
+			return err
+		}
+		for _, intf := range intfs[len(src.outputIDs):] {
+			if w == nil {
+				w, err = pcapgo.NewNgWriterInterface(out, intf, pcapgo.NgWriterOptions{
+					SectionInfo: pcapgo.NgSectionInfo{Application: "openperouter-mcp", Comment: comment},
+				})
+			} else {
+				_, err = w.AddInterface(intf)
+			}
+			if err != nil {
+				return err
+			}
+			src.outputIDs = append(src.outputIDs, declared)
+			declared++
+		}
+		return nil
+	}
+
+	for {
+		var earliest *mergeSource
+		for _, src := range sources {
+			if !src.done && (earliest == nil || src.ci.Timestamp.Before(earliest.ci.Timestamp)) {
+				earliest = src
+			}
+		}
+		if earliest == nil {
+			break
+		}
+		if (!from.IsZero() && earliest.ci.Timestamp.Before(from)) || (!to.IsZero() && earliest.ci.Timestamp.After(to)) {
+			if err := earliest.next(); err != nil {
+				return 0, first, last, err
+			}
+			continue
+		}
+		if earliest.ci.InterfaceIndex >= len(earliest.outputIDs) {
+			if err := declare(earliest); err != nil {
+				return 0, first, last, err
+			}
+		}
+		ci := earliest.ci
+		ci.InterfaceIndex = earliest.outputIDs[ci.InterfaceIndex]
+		ci.AncillaryData = nil
+		if err := w.WritePacket(ci, earliest.data); err != nil {
+			return 0, first, last, err
+		}
+		if packets == 0 {
+			first = ci.Timestamp
+		}
+		last = ci.Timestamp
+		packets++
+		if err := earliest.next(); err != nil {
+			return 0, first, last, err
+		}
+	}
+	if w == nil {
+		// No packet at all: still write a valid, empty capture.
+		w, err = pcapgo.NewNgWriterInterface(out, pcapgo.NgInterface{Name: mergedCaptureNode, LinkType: layers.LinkTypeEthernet},
+			pcapgo.NgWriterOptions{SectionInfo: pcapgo.NgSectionInfo{Application: "openperouter-mcp", Comment: comment}})
+		if err != nil {
+			return 0, first, last, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 0, first, last, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, first, last, err
+	}
+	return packets, first, last, os.Rename(tmp, output)
+}
+
+// formatOffset renders a clock offset with its sign.
+func formatOffset(d time.Duration) string {
+	if d > 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+func (s *MCPServer) mergeCaptures(args map[string]any) CallToolResult {
+	captureID, _ := args["capture_id"].(string)
+	if captureID == "" {
+		return toolError("capture_id is required")
+	}
+	inputs, err := s.captureInputs(map[string]any{"capture_id": captureID, "node": args["node"], "key_path": args["key_path"]})
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var capture *captureStatus
+	for _, st := range s.captureStatuses("") {
+		if st.CaptureID == captureID {
+			capture = st
+		}
+	}
+
+	// Offsets are given per node name or glob, in milliseconds, and added to
+	// the timestamps of the packets captured there.
+	offsets := make(map[string]time.Duration)
+	if raw, ok := args["offsets"].(map[string]any); ok {
+		for glob, v := range raw {
+			ms, ok := v.(float64)
+			if !ok {
+				return toolError(fmt.Sprintf("offset of %s must be a number of milliseconds", glob))
+			}
+			nodes := matchRouters(capture.Nodes, glob)
+			if len(nodes) == 0 {
+				return toolError(fmt.Sprintf("No node of capture %s matches offset %q (nodes: %s)", captureID, glob, strings.Join(capture.Nodes, ", ")))
+			}
+			for _, node := range nodes {
+				offsets[node] = time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+	}
+
+	var nodes []string
+	for _, in := range inputs {
+		if !containsString(nodes, in.node) {
+			nodes = append(nodes, in.node)
+		}
+	}
+	comment := fmt.Sprintf("Merged by openperouter-mcp from capture %s, filter %q, nodes %s", captureID, capture.Filter, strings.Join(nodes, ", "))
+	var applied []string
+	for _, node := range nodes {
+		if offsets[node] != 0 {
+			applied = append(applied, node+" "+formatOffset(offsets[node]))
+		}
+	}
+	sort.Strings(applied)
+	if len(applied) > 0 {
+		comment += ", clock offsets " + strings.Join(applied, ", ")
+	}
+
+	output := filepath.Join(capture.OutputDir, captureFileName(capture.Filter, mergedCaptureNode))
+	packets, first, last, err := mergeCaptureFiles(inputs, offsets, time.Time{}, time.Time{}, output, comment)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error merging capture %s: %v", captureID, err))
+	}
+	if output, err = encryptLike(inputs, output); err != nil {
+		return toolError(err.Error())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Merged %d packets from %d file(s) of %d node(s) (%s) into %s\n", packets, len(inputs), len(nodes), strings.Join(nodes, ", "), output)
+	if packets > 0 {
+		fmt.Fprintf(&b, "From %s to %s (%s)\n", first.Format("2006-01-02 15:04:05.000"), last.Format("2006-01-02 15:04:05.000"), last.Sub(first))
+	}
+	if len(applied) > 0 {
+		fmt.Fprintf(&b, "Clock offsets applied: %s\n", strings.Join(applied, ", "))
+	}
+	b.WriteString("Each interface of the merged file is described by its node.\n")
+	for _, c := range listCaptureFiles() {
+		if c.path == output && s.demo == nil {
+			fmt.Fprintf(&b, "Also available as the capture://%s/%s.pcapng resource.\n", c.session, c.node)
+		}
+	}
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
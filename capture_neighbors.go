@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"gopkg.in/yaml.v3"
+)
+
+// neighborFilter captures LLDP frames and CDP ones, sent to the Cisco
+// multicast address.
+const neighborFilter = "ether proto 0x88cc or ether dst 01:00:0c:cc:cc:cc"
+
+// defaultNeighborSeconds covers the 30s default transmit interval of LLDP
+// and CDP agents, so every neighbor is heard at least once.
+const (
+	defaultNeighborSeconds = 35
+	maxNeighborSeconds     = 300
+)
+
+// neighbor is a device heard on an interface of a node.
+type neighbor struct {
+	node      string
+	iface     string
+	protocol  string
+	system    string
+	port      string
+	portDesc  string
+	chassisID string
+	mgmt      string
+	ttl       int
+}
+
+// fabricInterfaces returns the interfaces of a router links to its
+// neighbors can be on: Ethernet interfaces that are neither the management
+// or pod network eth0, nor the bridges, VRFs and VXLAN devices FRR and
+// openperouter create.
+func fabricInterfaces(router string) ([]string, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "-d", "link", "show")
+	if err != nil {
+		return nil, err
+	}
+	var links []struct {
+		Ifname   string `json:"ifname"`
+		LinkType string `json:"link_type"`
+		Linkinfo *struct {
+			InfoKind string `json:"info_kind"`
+		} `json:"linkinfo"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("parsing links of %s: %w", router, err)
+	}
+	var names []string
+	for _, l := range links {
+		if l.LinkType != "ether" || l.Ifname == "eth0" {
+			continue
+		}
+		if l.Linkinfo != nil && l.Linkinfo.InfoKind != "veth" && l.Linkinfo.InfoKind != "macvlan" && l.Linkinfo.InfoKind != "ipvlan" {
+			continue
+		}
+		names = append(names, l.Ifname)
+	}
+	return names, nil
+}
+
+// readNeighbors decodes the LLDP and CDP frames of a capture file written
+// on a node, naming the interface each was heard on from the pcapng
+// interface blocks, or single when the file has none.
+func readNeighbors(node, file, single string) ([]neighbor, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	var read func() ([]byte, gopacket.CaptureInfo, error)
+	var linkType layers.LinkType
+	ifaceName := func(gopacket.CaptureInfo) string { return single }
+	if bytes.Equal(magic, pcapngMagic) {
+		r, err := pcapgo.NewNgReader(br, pcapgo.NgReaderOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		read, linkType = r.ReadPacketData, r.LinkType()
+		ifaceName = func(ci gopacket.CaptureInfo) string {
+			if iface, err := r.Interface(ci.InterfaceIndex); err == nil && iface.Name != "" {
+				return iface.Name
+			}
+			return single
+		}
+	} else {
+		r, err := pcapgo.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		read, linkType = r.ReadPacketData, r.LinkType()
+	}
+
+	var neighbors []neighbor
+	for {
+		data, ci, err := read()
+		if errors.Is(err, io.EOF) {
+			return neighbors, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		n := decodeNeighbor(gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true}))
+		if n == nil {
+			continue
+		}
+		n.node, n.iface = node, ifaceName(ci)
+		neighbors = append(neighbors, *n)
+	}
+}
+
+// decodeNeighbor returns the neighbor an LLDP or CDP frame announces, nil
+// for other frames.
+func decodeNeighbor(p gopacket.Packet) *neighbor {
+	if l, ok := p.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery); ok {
+		n := &neighbor{
+			protocol:  "LLDP",
+			chassisID: lldpID(byte(l.ChassisID.Subtype), byte(layers.LLDPChassisIDSubTypeMACAddr), byte(layers.LLDPChassisIDSubTypeNetworkAddr), l.ChassisID.ID),
+			port:      lldpID(byte(l.PortID.Subtype), byte(layers.LLDPPortIDSubtypeMACAddr), byte(layers.LLDPPortIDSubtypeNetworkAddr), l.PortID.ID),
+			ttl:       int(l.TTL),
+		}
+		if info, ok := p.Layer(layers.LayerTypeLinkLayerDiscoveryInfo).(*layers.LinkLayerDiscoveryInfo); ok {
+			n.system, n.portDesc = info.SysName, info.PortDescription
+			if ip := net.IP(info.MgmtAddress.Address); len(ip) == net.IPv4len || len(ip) == net.IPv6len {
+				n.mgmt = ip.String()
+			}
+		}
+		return n
+	}
+	if info, ok := p.Layer(layers.LayerTypeCiscoDiscoveryInfo).(*layers.CiscoDiscoveryInfo); ok {
+		n := &neighbor{protocol: "CDP", system: info.DeviceID, port: info.PortID, portDesc: info.Platform}
+		if cdp, ok := p.Layer(layers.LayerTypeCiscoDiscovery).(*layers.CiscoDiscovery); ok {
+			n.ttl = int(cdp.TTL)
+		}
+		if len(info.Addresses) > 0 {
+			n.mgmt = info.Addresses[0].String()
+		}
+		return n
+	}
+	return nil
+}
+
+// lldpID renders a chassis or port ID: MAC addresses and network addresses,
+// the latter prefixed with their IANA address family, by their subtypes,
+// the others being names.
+func lldpID(subtype, macSubtype, addrSubtype byte, id []byte) string {
+	switch {
+	case subtype == macSubtype && len(id) == 6:
+		return net.HardwareAddr(id).String()
+	case subtype == addrSubtype && (len(id) == 1+net.IPv4len || len(id) == 1+net.IPv6len):
+		return net.IP(id[1:]).String()
+	}
+	return string(id)
+}
+
+// topologyEndpoint is a side of a link of a containerlab topology.
+type topologyEndpoint struct {
+	node, iface string
+}
+
+func (e topologyEndpoint) String() string {
+	return e.node + ":" + e.iface
+}
+
+// topologyLinks reads the point-to-point links of a containerlab topology
+// file, given in the brief "node:interface" form or the extended one.
+func topologyLinks(file string) ([][2]topologyEndpoint, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading topology: %w", err)
+	}
+	var topo struct {
+		Topology struct {
+			Links []struct {
+				Endpoints []any `yaml:"endpoints"`
+			} `yaml:"links"`
+		} `yaml:"topology"`
+	}
+	if err := yaml.Unmarshal(data, &topo); err != nil {
+		return nil, fmt.Errorf("parsing topology %s: %w", file, err)
+	}
+	var links [][2]topologyEndpoint
+	for i, l := range topo.Topology.Links {
+		if len(l.Endpoints) != 2 {
+			continue
+		}
+		var link [2]topologyEndpoint
+		for j, e := range l.Endpoints {
+			switch v := e.(type) {
+			case string:
+				node, iface, ok := strings.Cut(v, ":")
+				if !ok {
+					return nil, fmt.Errorf("topology %s: link %d: invalid endpoint %q", file, i+1, v)
+				}
+				link[j] = topologyEndpoint{node, iface}
+			case map[string]any:
+				node, _ := v["node"].(string)
+				iface, _ := v["interface"].(string)
+				link[j] = topologyEndpoint{node, iface}
+			}
+			if link[j].node == "" || link[j].iface == "" {
+				return nil, fmt.Errorf("topology %s: link %d: invalid endpoint %v", file, i+1, e)
+			}
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("topology %s has no point-to-point link", file)
+	}
+	return links, nil
+}
+
+// sameNode tells whether a node name of a topology or an LLDP system name
+// designates the container, containerlab prefixing the node names.
+func sameNode(name, container string) bool {
+	name = strings.ToLower(name)
+	container = strings.ToLower(container)
+	return name == container || name == strings.TrimPrefix(container, clabContainerPrefix) || clabContainerPrefix+name == container
+}
+
+// heardPeer tells whether a neighbor is the expected side of a link.
+func heardPeer(n neighbor, peer topologyEndpoint) bool {
+	return sameNode(n.system, peer.node) && (n.port == peer.iface || n.portDesc == peer.iface)
+}
+
+func (s *MCPServer) discoverNeighbors(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	seconds := float64(defaultNeighborSeconds)
+	if v, ok := args["duration_seconds"].(float64); ok {
+		if v <= 0 || v > maxNeighborSeconds {
+			return toolError(fmt.Sprintf("duration_seconds must be between 1 and %d", maxNeighborSeconds))
+		}
+		seconds = v
+	}
+	var links [][2]topologyEndpoint
+	if file, _ := args["topology"].(string); file != "" {
+		if links, err = topologyLinks(file); err != nil {
+			return toolError(err.Error())
+		}
+	}
+	nodeGlobs, err := stringsArg(args, "nodes")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	ifaceGlobs, err := stringsArg(args, "interfaces")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(nodeGlobs) == 0 {
+		// Every router, the containerlab leaves included, and not only the
+		// default capture nodes.
+		nodeGlobs = []string{"*"}
+	}
+	nodes, interfaces, skipped, err := captureTargets(nodeGlobs, ifaceGlobs)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error selecting the nodes: %v", err))
+	}
+	if len(ifaceGlobs) == 0 {
+		interfaces = make(map[string][]string)
+		var withInterfaces []string
+		for _, node := range nodes {
+			names, err := fabricInterfaces(node)
+			if err != nil {
+				return toolError(fmt.Sprintf("Error listing the interfaces of %s: %v", node, err))
+			}
+			if len(names) == 0 {
+				skipped = append(skipped, node)
+				continue
+			}
+			interfaces[node] = names
+			withInterfaces = append(withInterfaces, node)
+		}
+		nodes = withInterfaces
+	}
+	if len(nodes) == 0 {
+		return toolError("No node has an interface to listen on")
+	}
+
+	rt, err := newDockerAPI()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	dir, err := os.MkdirTemp("", "openperouter-mcp-neighbors-")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	run := newCaptureRun(rt, dir, neighborFilter)
+	if err := run.start(nodes, nil, interfaces, nil); err != nil {
+		return toolError(fmt.Sprintf("Error starting the capture: %v", err))
+	}
+	run.waitStarted(captureStartTimeout)
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+	run.stop()
+	<-run.done
+
+	// A neighbor is listed once per interface, as its last frame
+	// announced it.
+	var neighbors []neighbor
+	var failures []string
+	heard := make(map[string][]neighbor)
+	seen := make(map[string]int)
+	for _, c := range run.nodeCopies() {
+		if c.startErr != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.node, c.startErr))
+			continue
+		}
+		single := ""
+		if len(interfaces[c.node]) == 1 {
+			single = interfaces[c.node][0]
+		}
+		for _, file := range capturedFiles(dir, neighborFilter, c.node) {
+			found, err := readNeighbors(c.node, file, single)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", c.node, err))
+				continue
+			}
+			for _, n := range found {
+				key := n.node + ":" + n.iface
+				id := strings.Join([]string{key, n.protocol, n.chassisID, n.system, n.port}, "|")
+				if i, ok := seen[id]; ok {
+					heard[key][i] = n
+					continue
+				}
+				seen[id] = len(heard[key])
+				heard[key] = append(heard[key], n)
+			}
+		}
+		for _, p := range c.problems {
+			failures = append(failures, fmt.Sprintf("%s: %s", c.node, p))
+		}
+	}
+
+	neighborsTable := newTable("neighbors", "node", "interface", "protocol", "neighbor", "port", "port_description", "chassis_id", "management_address", "ttl")
+	var silent []string
+	var b strings.Builder
+	fmt.Fprintf(&b, "Listened for LLDP and CDP for %gs on %d node(s)\n", seconds, len(nodes))
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "\n%s:\n", node)
+		for _, iface := range interfaces[node] {
+			found := heard[node+":"+iface]
+			if len(found) == 0 {
+				silent = append(silent, node+":"+iface)
+				fmt.Fprintf(&b, "  %-12s nothing heard\n", iface)
+				continue
+			}
+			for _, n := range found {
+				neighbors = append(neighbors, n)
+				name := n.system
+				if name == "" {
+					name = n.chassisID
+				}
+				fmt.Fprintf(&b, "  %-12s %s %s port %s", iface, n.protocol, name, n.port)
+				if n.portDesc != "" && n.portDesc != n.port {
+					fmt.Fprintf(&b, " (%s)", n.portDesc)
+				}
+				if n.mgmt != "" {
+					fmt.Fprintf(&b, ", management %s", n.mgmt)
+				}
+				b.WriteString("\n")
+				neighborsTable.add(n.node, n.iface, n.protocol, n.system, n.port, n.portDesc, n.chassisID, n.mgmt, n.ttl)
+			}
+		}
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		fmt.Fprintf(&b, "\nNo interface to listen on: %s\n", strings.Join(skipped, ", "))
+	}
+	if len(neighbors) == 0 {
+		b.WriteString("\nNo LLDP or CDP frame heard: the nodes may not run an LLDP agent (e.g. lldpd), FRR does not send LLDP itself.\n")
+	}
+
+	// Each side of the links of the topology is checked against what the
+	// node it belongs to heard.
+	linksTable := newTable("links", "a", "a_interface", "b", "b_interface", "status", "detail")
+	var mismatches, unverified int
+	if links != nil {
+		b.WriteString("\nTopology links:\n")
+		expected := make(map[string]bool)
+		for _, link := range links {
+			var confirmed, wrong, details []string
+			for side, end := range link {
+				peer := link[1-side]
+				var container string
+				for _, node := range nodes {
+					if sameNode(end.node, node) {
+						container = node
+					}
+				}
+				if container == "" {
+					continue
+				}
+				key := container + ":" + end.iface
+				expected[key] = true
+				found := heard[key]
+				if len(found) == 0 {
+					continue
+				}
+				match := false
+				var others []string
+				for _, n := range found {
+					if heardPeer(n, peer) {
+						match = true
+					} else {
+						others = append(others, fmt.Sprintf("%s port %s", n.system, n.port))
+					}
+				}
+				if match {
+					confirmed = append(confirmed, end.String())
+				} else {
+					wrong = append(wrong, end.String())
+					details = append(details, fmt.Sprintf("%s hears %s, expected %s", end, strings.Join(others, ", "), peer))
+				}
+			}
+			status, mark := "ok", "✓"
+			switch {
+			case len(wrong) > 0:
+				status, mark = "mismatch", "✗"
+				mismatches++
+			case len(confirmed) == 0:
+				status, mark = "unverified", "?"
+				details = append(details, "no neighbor heard on either side")
+				unverified++
+			default:
+				details = append(details, "confirmed by "+strings.Join(confirmed, " and "))
+			}
+			detail := strings.Join(details, "; ")
+			linksTable.add(link[0].node, link[0].iface, link[1].node, link[1].iface, status, detail)
+			fmt.Fprintf(&b, "  %s %s <-> %s: %s\n", mark, link[0], link[1], detail)
+		}
+		var unexpected []string
+		for _, n := range neighbors {
+			if key := n.node + ":" + n.iface; !expected[key] {
+				unexpected = append(unexpected, fmt.Sprintf("%s hears %s port %s", key, n.system, n.port))
+				mismatches++
+			}
+		}
+		for _, u := range unexpected {
+			fmt.Fprintf(&b, "  ✗ %s, not a link of the topology\n", u)
+			linksTable.add(nil, nil, nil, nil, "unexpected", u)
+		}
+	}
+	if len(failures) > 0 {
+		b.WriteString("\nProblems:\n")
+		for _, f := range failures {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	}
+
+	var fields record
+	fields.add("duration_seconds", seconds)
+	fields.add("nodes", nodes)
+	fields.add("silent_interfaces", silent)
+	if links != nil {
+		fields.add("mismatches", mismatches)
+		fields.add("unverified", unverified)
+	}
+	fields.add("problems", failures)
+	tables := []*table{neighborsTable}
+	if links != nil {
+		tables = append(tables, linksTable)
+	}
+	return formattedResult(format, b.String(), mismatches > 0, fields, tables...)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// podCapturePrefix starts the node name of a capture in a pod, followed by
+// the namespace and name of the pod, Kubernetes names having no underscore.
+const podCapturePrefix = "pod_"
+
+// podTarget is a pod a capture runs in: in its network namespace, entered
+// from the kind node the pod is scheduled on.
+type podTarget struct {
+	namespace string
+	name      string
+	node      string
+}
+
+// captureNode is the node name of the capture in the pod.
+func (p podTarget) captureNode() string {
+	return podCapturePrefix + p.namespace + "_" + p.name
+}
+
+// capturePods resolves the pods of a capture, given as namespace/name with
+// globs allowed in both, to the running pods of every kind cluster.
+func capturePods(globs []string) ([]podTarget, error) {
+	type ref struct{ namespace, name string }
+	var refs []ref
+	for _, glob := range globs {
+		namespace, name, ok := strings.Cut(glob, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("pod %q must be given as namespace/name", glob)
+		}
+		refs = append(refs, ref{namespace, name})
+	}
+
+	nodes, err := kindNodes("")
+	if err != nil {
+		return nil, err
+	}
+	var pods []pod
+	seen := make(map[string]bool)
+	for _, n := range nodes {
+		if seen[n.Cluster] {
+			continue
+		}
+		seen[n.Cluster] = true
+		var list podList
+		if err := kubectlGetJSON(n.Cluster, &list, "pods", "-A"); err != nil {
+			return nil, err
+		}
+		pods = append(pods, list.Items...)
+	}
+
+	var targets []podTarget
+	selected := make(map[string]string)
+	for i, r := range refs {
+		matched := 0
+		for _, p := range pods {
+			nsOK, _ := path.Match(r.namespace, p.Metadata.Namespace)
+			nameOK, _ := path.Match(r.name, p.Metadata.Name)
+			if !nsOK || !nameOK || p.Status.Phase != "Running" || p.Spec.NodeName == "" {
+				continue
+			}
+			matched++
+			if node, ok := selected[p.key()]; ok {
+				if node != p.Spec.NodeName {
+					return nil, fmt.Errorf("pod %s runs in several clusters, on %s and %s", p.key(), node, p.Spec.NodeName)
+				}
+				continue
+			}
+			selected[p.key()] = p.Spec.NodeName
+			targets = append(targets, podTarget{namespace: p.Metadata.Namespace, name: p.Metadata.Name, node: p.Spec.NodeName})
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("no running pod matches %q", globs[i])
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// captureStateDir holds a state file per server instance, named after its
+// PID, recording its running captures so that a server started after it
+// crashed finds the tshark processes left behind.
+var captureStateDir = filepath.Join(captureRoot, ".active")
+
+// capturedNodeState is a node of a running capture, as recorded in the
+// state file: what captures there, in which container (none for the host).
+type capturedNodeState struct {
+	Node       string   `json:"node"`
+	Container  string   `json:"container,omitempty"`
+	PID        int      `json:"pid"`
+	Tool       string   `json:"tool"`
+	File       string   `json:"file"`
+	Filter     string   `json:"filter"`
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+// captureState is a running capture as recorded in the state file.
+type captureState struct {
+	CaptureID   string              `json:"capture_id"`
+	SessionID   string              `json:"session_id"`
+	OutputDir   string              `json:"output_dir"`
+	Filter      string              `json:"filter"`
+	NodeFilters map[string]string   `json:"node_filters,omitempty"`
+	Interfaces  map[string][]string `json:"interfaces,omitempty"`
+	Started     time.Time           `json:"started"`
+	StopAt      time.Time           `json:"stop_at,omitzero"`
+	MaxPackets  int                 `json:"max_packets,omitempty"`
+	FileSizeKB  int                 `json:"file_size_kb,omitempty"`
+	NumFiles    int                 `json:"num_files,omitempty"`
+	Backend     string              `json:"backend"`
+	Live        bool                `json:"live,omitempty"`
+	Label       string              `json:"label,omitempty"`
+	Nodes       []capturedNodeState `json:"nodes"`
+}
+
+// serverState is the state file of a server instance.
+type serverState struct {
+	PID      int            `json:"pid"`
+	Captures []captureState `json:"captures"`
+}
+
+// capturedNodeStates returns the nodes of a capture tshark started on.
+func (r *captureRun) capturedNodeStates() []capturedNodeState {
+	nodes := r.started()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make([]capturedNodeState, 0, len(nodes))
+	for _, n := range nodes {
+		states = append(states, capturedNodeState{
+			Node:       n.node,
+			Container:  n.container,
+			PID:        n.pid,
+			Tool:       n.tool,
+			File:       n.file,
+			Filter:     n.filter,
+			Interfaces: n.interfaces,
+		})
+	}
+	return states
+}
+
+// saveCaptureState writes the running captures to the state file of the
+// server, removed once none runs.
+func (s *MCPServer) saveCaptureState() {
+	state := serverState{PID: os.Getpid()}
+	for _, call := range s.sessionCaptures("") {
+		s.mu.Lock()
+		c := captureState{
+			CaptureID:   call.CaptureID,
+			SessionID:   call.SessionID,
+			OutputDir:   call.OutputDir,
+			Filter:      call.Filter,
+			NodeFilters: call.NodeFilters,
+			Interfaces:  call.Interfaces,
+			Started:     call.Started,
+			StopAt:      call.StopAt,
+			MaxPackets:  call.MaxPackets,
+			FileSizeKB:  call.FileSizeKB,
+			NumFiles:    call.NumFiles,
+			Backend:     call.Run.backend,
+			Live:        call.Run.live,
+			Label:       call.Label,
+		}
+		s.mu.Unlock()
+		if c.Nodes = call.Run.capturedNodeStates(); len(c.Nodes) > 0 {
+			state.Captures = append(state.Captures, c)
+		}
+	}
+	sort.Slice(state.Captures, func(i, j int) bool { return state.Captures[i].Started.Before(state.Captures[j].Started) })
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	path := filepath.Join(captureStateDir, strconv.Itoa(state.PID)+".json")
+	if len(state.Captures) == 0 {
+		os.Remove(path)
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(captureStateDir, 0o755)
+	}
+	if err == nil {
+		// Written aside and renamed, a crash never leaves half a file.
+		err = os.WriteFile(path+".tmp", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Saving the capture state: %v\n", err)
+	}
+}
+
+// zombieStateRe matches the state of a zombie in /proc/<pid>/status.
+var zombieStateRe = regexp.MustCompile(`(?m)^State:\s+Z`)
+
+// processAlive tells whether a process of the host runs, zombies not yet
+// reaped by their parent excluded where /proc tells.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil || p.Signal(syscall.Signal(0)) != nil {
+		return false
+	}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	return err != nil || !zombieStateRe.Match(status)
+}
+
+// orphanedStateFiles returns the state files of the server instances that
+// are gone, whose captures nobody stops anymore.
+func orphanedStateFiles() []string {
+	matches, _ := filepath.Glob(filepath.Join(captureStateDir, "*.json"))
+	var orphaned []string
+	for _, m := range matches {
+		pid, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		orphaned = append(orphaned, m)
+	}
+	return orphaned
+}
+
+// adopt takes over the nodes of a capture started by a server that died,
+// to stop them and copy their files out as if it had started them.
+func (r *captureRun) adopt(nodes []capturedNodeState) error {
+	log, err := os.OpenFile(filepath.Join(r.outputDir, captureLogName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	r.log = log
+	for _, state := range nodes {
+		n := &nodeCapture{
+			node:       state.Node,
+			container:  state.Container,
+			interfaces: state.Interfaces,
+			filter:     state.Filter,
+			tool:       state.Tool,
+			file:       state.File,
+			pid:        state.PID,
+		}
+		if n.node == hostCaptureNode {
+			// The host tshark is no child of this server: it is followed
+			// through its PID until it exits.
+			p, err := os.FindProcess(n.pid)
+			if err != nil {
+				return err
+			}
+			n.host, n.hostExited = &exec.Cmd{Process: p}, make(chan struct{})
+			go func() {
+				for processAlive(n.pid) {
+					time.Sleep(time.Second)
+				}
+				close(n.hostExited)
+			}()
+		}
+		r.nodes = append(r.nodes, n)
+		status := "no longer running"
+		if r.capturing(n) {
+			status = "still running"
+		}
+		r.logf("%s: adopted %s PID %d after a server restart, %s -> %s", n.node, n.tool, n.pid, status, n.file)
+	}
+	go r.supervise()
+	return nil
+}
+
+// recoverOrphanedCaptures adopts the captures of the server instances that
+// died, under their session and a new capture ID, and returns them. The
+// captures whose tshark stopped meanwhile are adopted all the same, their
+// files still to be copied out.
+func (s *MCPServer) recoverOrphanedCaptures() ([]*ActiveCall, []string) {
+	var adopted []*ActiveCall
+	var failures []string
+	for _, file := range orphanedStateFiles() {
+		// The file is claimed first, servers starting together never adopt
+		// the same captures.
+		claimed := fmt.Sprintf("%s.%d", file, os.Getpid())
+		if err := os.Rename(file, claimed); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(claimed)
+		var state serverState
+		if err == nil {
+			err = json.Unmarshal(data, &state)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", file, err))
+			os.Rename(claimed, file+".invalid")
+			continue
+		}
+		// The adopted captures are in the state file of this server now,
+		// the other ones are left for a later attempt.
+		left := serverState{PID: state.PID}
+		for _, c := range state.Captures {
+			call, err := s.adoptCapture(state.PID, c)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s of server %d: %v", c.CaptureID, state.PID, err))
+				left.Captures = append(left.Captures, c)
+				continue
+			}
+			adopted = append(adopted, call)
+		}
+		if len(left.Captures) > 0 {
+			if data, err := json.MarshalIndent(left, "", "  "); err == nil && os.WriteFile(claimed, data, 0o644) == nil {
+				os.Rename(claimed, file)
+				continue
+			}
+		}
+		os.Remove(claimed)
+	}
+	return adopted, failures
+}
+
+// adoptCapture registers a capture of a dead server as a running capture.
+func (s *MCPServer) adoptCapture(serverPID int, c captureState) (*ActiveCall, error) {
+	rt, err := newDockerAPI()
+	if err != nil {
+		return nil, err
+	}
+	run := newCaptureRun(rt, c.OutputDir, c.Filter)
+	run.nodeFilters = c.NodeFilters
+	run.maxPackets, run.fileSizeKB, run.numFiles, run.live = c.MaxPackets, c.FileSizeKB, c.NumFiles, c.Live
+	run.backend = c.Backend
+	run.maxDiskUsage = s.config.CaptureMaxDiskUsage
+	if err := run.adopt(c.Nodes); err != nil {
+		return nil, err
+	}
+	call := &ActiveCall{
+		CaptureID:     s.newCaptureID(),
+		SessionID:     c.SessionID,
+		OutputDir:     c.OutputDir,
+		Run:           run,
+		Done:          make(chan struct{}),
+		Filter:        c.Filter,
+		NodeFilters:   c.NodeFilters,
+		Interfaces:    c.Interfaces,
+		Started:       c.Started,
+		StopAt:        c.StopAt,
+		MaxPackets:    c.MaxPackets,
+		FileSizeKB:    c.FileSizeKB,
+		NumFiles:      c.NumFiles,
+		PIDs:          make(map[string]int),
+		RecoveredFrom: serverPID,
+		Label:         c.Label,
+	}
+	s.reportCopies(call)
+	for _, n := range c.Nodes {
+		call.Nodes = append(call.Nodes, n.Node)
+		call.PIDs[n.Node] = n.PID
+	}
+	run.logf("Adopted as %s, %s of server %d", call.CaptureID, c.CaptureID, serverPID)
+
+	s.mu.Lock()
+	s.activeCalls[call.CaptureID] = call
+	var autoStop *time.Timer
+	if !call.StopAt.IsZero() {
+		autoStop = time.AfterFunc(max(time.Until(call.StopAt), 0), func() { s.autoStopCapture(call.CaptureID) })
+	}
+	s.mu.Unlock()
+	s.saveCaptureState()
+	go s.awaitCapture(call, autoStop)
+	return call, nil
+}
+
+// describeRecovered lists adopted captures, one line each.
+func describeRecovered(calls []*ActiveCall) string {
+	var b strings.Builder
+	for _, call := range calls {
+		fmt.Fprintf(&b, "  %s (session %s, started %s by server %d): %s, output directory %s\n", call.CaptureID, call.SessionID,
+			call.Started.Format("2006-01-02 15:04:05"), call.RecoveredFrom, strings.Join(call.Nodes, ", "), call.OutputDir)
+	}
+	return b.String()
+}
+
+// recoverCaptures adopts the captures orphaned by server instances that
+// died, then, depending on the action, hands the recovered captures over to
+// the calling session or stops them.
+func (s *MCPServer) recoverCaptures(sessionID string, args map[string]any) CallToolResult {
+	action, _ := args["action"].(string)
+	if action == "" {
+		action = "adopt"
+	}
+	if action != "adopt" && action != "stop" {
+		return toolError(fmt.Sprintf("invalid action %q, expected \"adopt\" or \"stop\"", action))
+	}
+
+	adopted, failures := s.recoverOrphanedCaptures()
+	// Only the captures of this session, of sessions gone with the dead
+	// server or recovered by this call are taken over: a recovered capture
+	// still belonging to an open session is left to it.
+	now := make(map[*ActiveCall]bool, len(adopted))
+	for _, call := range adopted {
+		now[call] = true
+	}
+	var recovered, others []*ActiveCall
+	for _, call := range s.sessionCaptures("") {
+		if call.RecoveredFrom == 0 {
+			continue
+		}
+		if call.SessionID == sessionID || s.sessionTransport(call.SessionID) == "closed" || now[call] {
+			recovered = append(recovered, call)
+		} else {
+			others = append(others, call)
+		}
+	}
+	sort.Slice(recovered, func(i, j int) bool { return recovered[i].Started.Before(recovered[j].Started) })
+	sort.Slice(others, func(i, j int) bool { return others[i].Started.Before(others[j].Started) })
+
+	var b strings.Builder
+	switch {
+	case len(recovered) == 0:
+		b.WriteString("No capture orphaned by a previous server instance.\n")
+	case action == "adopt":
+		s.mu.Lock()
+		for _, call := range recovered {
+			call.SessionID = sessionID
+		}
+		s.mu.Unlock()
+		s.saveCaptureState()
+		fmt.Fprintf(&b, "Adopted %d capture(s) orphaned by a previous server instance into this session:\n%s\n", len(recovered), describeRecovered(recovered))
+		b.WriteString("Use stop_traffic_capture to stop them and retrieve their files.\n")
+	default:
+		description := describeRecovered(recovered)
+		stopCaptures(recovered)
+		fmt.Fprintf(&b, "Stopped %d capture(s) orphaned by a previous server instance, their files copied to their output directory:\n%s", len(recovered), description)
+	}
+	if len(others) > 0 {
+		fmt.Fprintf(&b, "\nLeft to the open sessions they belong to:\n%s", describeRecovered(others))
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\nCould not recover:\n  %s\n", strings.Join(failures, "\n  "))
+	}
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: b.String()}}, IsError: len(failures) > 0 && len(recovered) == 0}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// captureRoot holds a directory per session, in which sessionCaptureDir puts
+// a capture_<timestamp> directory per capture.
+const captureRoot = "captures"
+
+// bytesPerMB is the size of the megabytes of the capture size limits, the
+// binary ones formatSize reports sizes in.
+const bytesPerMB = 1 << 20
+
+// captureDir is the output directory of a capture under captureRoot.
+type captureDir struct {
+	session string
+	path    string
+	started time.Time
+	bytes   int64
+	// running tells the directory belongs to a running capture, which is
+	// never deleted.
+	running bool
+	// expired tells the retention policy selected it for deletion.
+	expired bool
+}
+
+// listCaptureDirs returns the capture directories of every session, oldest
+// first.
+func (s *MCPServer) listCaptureDirs() []*captureDir {
+	matches, _ := filepath.Glob(filepath.Join(captureRoot, "*", "capture_*"))
+	running := make(map[string]bool)
+	for _, call := range s.sessionCaptures("") {
+		running[filepath.Clean(call.OutputDir)] = true
+	}
+
+	var dirs []*captureDir
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		d := &captureDir{
+			session: filepath.Base(filepath.Dir(m)),
+			path:    m,
+			started: info.ModTime(),
+			running: running[filepath.Clean(m)],
+		}
+		// The timestamp may be followed by the label of the capture.
+		stamp := strings.TrimPrefix(filepath.Base(m), "capture_")
+		if t, err := time.ParseInLocation("20060102_150405", stamp[:min(len(stamp), len("20060102_150405"))], time.Local); err == nil {
+			d.started = t
+		}
+		filepath.WalkDir(m, func(_ string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				if fi, err := entry.Info(); err == nil {
+					d.bytes += fi.Size()
+				}
+			}
+			return nil
+		})
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].started.Before(dirs[j].started) })
+	return dirs
+}
+
+// expireCaptureDirs marks the directories older than maxAge, then the
+// oldest ones until the rest fits in maxBytes. Zero disables either limit.
+func expireCaptureDirs(dirs []*captureDir, maxAge time.Duration, maxBytes int64, now time.Time) {
+	var total int64
+	for _, d := range dirs {
+		if !d.running && maxAge > 0 && now.Sub(d.started) > maxAge {
+			d.expired = true
+			continue
+		}
+		total += d.bytes
+	}
+	for _, d := range dirs {
+		if maxBytes <= 0 || total <= maxBytes {
+			break
+		}
+		if !d.running && !d.expired {
+			d.expired = true
+			total -= d.bytes
+		}
+	}
+}
+
+// removeCaptureDir deletes a capture directory, the session directory once
+// empty, and the finished captures it held.
+func (s *MCPServer) removeCaptureDir(d *captureDir) error {
+	if err := os.RemoveAll(d.path); err != nil {
+		return err
+	}
+	// Fails, as it should, while the session has other directories.
+	os.Remove(filepath.Dir(d.path))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.finishedCaptures[:0]
+	for _, call := range s.finishedCaptures {
+		if filepath.Clean(call.OutputDir) != filepath.Clean(d.path) {
+			kept = append(kept, call)
+		}
+	}
+	s.finishedCaptures = kept
+	return nil
+}
+
+// enforceCaptureRetention deletes the capture directories the configured
+// retention policy expires.
+func (s *MCPServer) enforceCaptureRetention() {
+	dirs := s.listCaptureDirs()
+	expireCaptureDirs(dirs, s.config.CaptureRetention.Duration, s.config.CaptureMaxTotalMB*bytesPerMB, time.Now())
+	for _, d := range dirs {
+		if !d.expired {
+			continue
+		}
+		if err := s.removeCaptureDir(d); err != nil {
+			fmt.Fprintf(os.Stderr, "Capture retention: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Capture retention: deleted %s (%s)\n", d.path, formatSize(d.bytes))
+	}
+}
+
+// startCaptureRetention enforces the capture retention policy now and then
+// every hour, until the process exits.
+func (s *MCPServer) startCaptureRetention() {
+	fmt.Fprintf(os.Stderr, "Enforcing capture retention in %s every hour\n", captureRoot)
+	go func() {
+		s.enforceCaptureRetention()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.enforceCaptureRetention()
+		}
+	}()
+}
+
+// cleanupCaptures deletes the capture directories of the session, or of
+// every session with all_sessions.
+func (s *MCPServer) cleanupCaptures(sessionID string, args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var maxAge time.Duration
+	if v, _ := args["older_than"].(string); v != "" {
+		if maxAge, err = time.ParseDuration(v); err != nil || maxAge <= 0 {
+			return toolError(fmt.Sprintf("invalid older_than %q, expected a positive duration like \"72h\"", v))
+		}
+	}
+	var maxBytes int64
+	if v, ok := args["max_total_mb"].(float64); ok {
+		if v <= 0 {
+			return toolError("max_total_mb must be positive")
+		}
+		maxBytes = int64(v * bytesPerMB)
+	}
+	sessions, err := stringsArg(args, "sessions")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	dryRun, _ := args["dry_run"].(bool)
+	scope := sessionID
+	if allSessions, ok := args["all_sessions"].(bool); ok && allSessions {
+		scope = ""
+	}
+	if scope != "" && len(sessions) > 0 {
+		return toolError("sessions requires all_sessions: without it only the directories of this session are cleaned up")
+	}
+
+	// Without criteria of its own, the call applies the configured policy.
+	policy := "the given criteria"
+	if maxAge == 0 && maxBytes == 0 && len(sessions) == 0 {
+		maxAge, maxBytes = s.config.CaptureRetention.Duration, s.config.CaptureMaxTotalMB*bytesPerMB
+		policy = "the configured retention policy"
+		if maxAge == 0 && maxBytes == 0 {
+			policy = ""
+		}
+	}
+
+	dirs := s.listCaptureDirs()
+	if scope != "" {
+		own := dirs[:0]
+		for _, d := range dirs {
+			if d.session == scope {
+				own = append(own, d)
+			}
+		}
+		dirs = own
+	}
+	root := captureRoot
+	if scope != "" {
+		root = filepath.Join(captureRoot, scope)
+	}
+	now := time.Now()
+	expireCaptureDirs(dirs, maxAge, maxBytes, now)
+	for _, d := range dirs {
+		if !d.running && len(sessions) > 0 && matchesAny(sessions, d.session) {
+			d.expired = true
+		}
+	}
+
+	table := newTable("directories", "session", "directory", "started", "age", "bytes", "action")
+	var deleted, kept []string
+	var reclaimed, remaining int64
+	var failures []string
+	for _, d := range dirs {
+		action := "kept"
+		switch {
+		case d.running:
+			action = "kept, capture running"
+		case d.expired && dryRun:
+			action = "would delete"
+		case d.expired:
+			if err := s.removeCaptureDir(d); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", d.path, err))
+				action = "delete failed"
+			} else {
+				action = "deleted"
+			}
+		}
+		line := fmt.Sprintf("%s (session %s, %s old, %s)", d.path, d.session, now.Sub(d.started).Truncate(time.Minute), formatSize(d.bytes))
+		if action == "deleted" || action == "would delete" {
+			deleted = append(deleted, line)
+			reclaimed += d.bytes
+		} else {
+			if action != "kept" {
+				line += ", " + action
+			}
+			kept = append(kept, line)
+			remaining += d.bytes
+		}
+		table.add(d.session, d.path, d.started.UTC().Format(time.RFC3339), now.Sub(d.started).Truncate(time.Second).String(), d.bytes, action)
+	}
+
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	var b strings.Builder
+	switch {
+	case len(dirs) == 0:
+		fmt.Fprintf(&b, "No capture directory in %s.\n", root)
+	case policy == "":
+		fmt.Fprintf(&b, "%d capture director(ies) in %s using %s. No retention policy is configured: pass older_than, max_total_mb or sessions to delete some.\n",
+			len(dirs), root, formatSize(remaining))
+	default:
+		fmt.Fprintf(&b, "%s %d capture director(ies) per %s, reclaiming %s; %d kept using %s.\n",
+			verb, len(deleted), policy, formatSize(reclaimed), len(kept), formatSize(remaining))
+	}
+	if len(deleted) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n  %s\n", verb, strings.Join(deleted, "\n  "))
+	}
+	if len(kept) > 0 {
+		fmt.Fprintf(&b, "\nKept:\n  %s\n", strings.Join(kept, "\n  "))
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\nFailed:\n  %s\n", strings.Join(failures, "\n  "))
+	}
+
+	var fields record
+	fields.add("deleted", len(deleted))
+	fields.add("reclaimed_bytes", reclaimed)
+	fields.add("remaining_bytes", remaining)
+	fields.add("dry_run", dryRun)
+	return formattedResult(format, b.String(), len(failures) > 0, fields, table)
+}
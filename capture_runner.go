@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// captureStartTimeout is how long start_traffic_capture waits for the
+	// nodes to capture before replying; slower ones, installing tshark for
+	// instance, are reported in the capture log as they start.
+	captureStartTimeout = 20 * time.Second
+	// captureStopGrace is how long tshark is given to close its files after
+	// SIGTERM before it is killed.
+	captureStopGrace = 3 * time.Second
+	// captureExecTimeout bounds the commands stopping and checking tshark,
+	// which must complete even once the capture is aborted.
+	captureExecTimeout = 10 * time.Second
+	// copyRetries is how many times copying a file out is retried after a
+	// transient error, waiting a second longer each time.
+	copyRetries = 2
+)
+
+// The capture backends: tshark, installed on the nodes when missing, or the
+// server binary itself copied to the nodes as an agent capturing with
+// afpacket sockets, which changes nothing else in the images.
+const (
+	tsharkBackend   = "tshark"
+	afpacketBackend = "afpacket"
+	// captureAgentPath is where the afpacket backend copies the agent in
+	// the containers.
+	captureAgentPath = "/openperouter-mcp-capture-agent"
+)
+
+// tsharkInstallers install tshark with the package manager of a node, tried
+// in order.
+var tsharkInstallers = []struct {
+	manager  string
+	commands [][]string
+}{
+	{"apt-get", [][]string{{"apt-get", "update"}, {"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "install", "-y", "tshark"}}},
+	{"yum", [][]string{{"yum", "install", "-y", "wireshark"}}},
+	{"apk", [][]string{{"apk", "add", "--no-cache", "tshark"}}},
+}
+
+// nodeCapture is the tshark, or agent, of a capture on a node, or on the
+// host.
+type nodeCapture struct {
+	node string
+	// container is the one the capture runs in: the node itself, or the kind
+	// node of the pod a capture in a pod runs in.
+	container  string
+	pod        *podTarget
+	interfaces []string
+	// filter is the capture filter of the node, which names its files.
+	filter string
+	// tool is what captures on the node: tshark, tcpdump when tshark could
+	// not be installed, or the capture agent.
+	tool string
+	// file is the pcapng tshark writes to: in the root of the container for
+	// the nodes, in the output directory for the host.
+	file string
+	pid  int
+	// starting is true until tshark runs or failed to; startErr tells why it
+	// did not start.
+	starting bool
+	startErr error
+	// problems are what went wrong stopping tshark and copying its files,
+	// copied the number of files saved to the output directory, with their
+	// size, and retries the copies retried after a transient error.
+	problems []string
+	copied   int
+	bytes    int64
+	retries  int
+	// host and hostExited are the local tshark of the host capture.
+	host       *exec.Cmd
+	hostExited chan struct{}
+}
+
+// captureRun orchestrates the tshark processes of a capture, or the agents
+// of the afpacket backend: one goroutine per node starts tshark through the
+// container runtime, in the network namespace of the router, and the files
+// are copied out once they all stopped. Its progress is written to capture.log in the output directory.
+type captureRun struct {
+	rt         containerRuntime
+	outputDir  string
+	filter     string
+	maxPackets int
+	fileSizeKB int
+	numFiles   int
+	live       bool
+	// nodeFilters are the filters of the nodes capturing with their own
+	// rather than filter.
+	nodeFilters map[string]string
+	// backend is tsharkBackend or afpacketBackend; programs are the capture
+	// filters compiled for the agent of the latter, by filter.
+	backend  string
+	programs map[string]string
+	// onStarted is called as tshark starts on a node, onLive with every
+	// packet summary of a live capture, one call at a time.
+	onStarted func(node string, pid int)
+	onLive    func(node, summary string)
+	// onCopied is called as each node is stopped and its files copied out,
+	// one call at a time, with the number of nodes done so far.
+	onCopied func(c nodeCopy, done, total int)
+	copiedMu sync.Mutex
+	copies   int
+
+	// ctx is cancelled by abort, interrupting the starts and copies in
+	// progress; liveCtx stops following the packet summaries.
+	ctx        context.Context
+	abort      context.CancelFunc
+	liveCtx    context.Context
+	stopLive   context.CancelFunc
+	liveMu     sync.Mutex
+	liveFollow sync.WaitGroup
+
+	// mu guards the log, the nodes and the setup locks, which keep tshark
+	// installs and agent copies to a container, shared by a node and its
+	// pods, one at a time.
+	mu       sync.Mutex
+	setup    map[string]*sync.Mutex
+	log      *os.File
+	nodes    []*nodeCapture
+	starting sync.WaitGroup
+	stopping chan struct{}
+	stopOnce sync.Once
+	// done is closed once every tshark stopped and the files are copied.
+	done chan struct{}
+	// limitReached tells every tshark stopped at the packet limit, which
+	// ended the capture on its own.
+	limitReached bool
+	// maxDiskUsage is the percentage of a disk the capture writes to at
+	// which it is stopped, 0 for no limit; diskFull is the disk that
+	// reached it and ended the capture.
+	maxDiskUsage int
+	diskFull     *diskUsage
+}
+
+func newCaptureRun(rt containerRuntime, outputDir, filter string) *captureRun {
+	r := &captureRun{
+		rt:        rt,
+		outputDir: outputDir,
+		filter:    filter,
+		backend:   tsharkBackend,
+		programs:  make(map[string]string),
+		stopping:  make(chan struct{}),
+		done:      make(chan struct{}),
+		onStarted: func(string, int) {},
+		onLive:    func(string, string) {},
+		onCopied:  func(nodeCopy, int, int) {},
+	}
+	r.ctx, r.abort = context.WithCancel(context.Background())
+	r.liveCtx, r.stopLive = context.WithCancel(r.ctx)
+	return r
+}
+
+// logf appends a line to the capture log.
+func (r *captureRun) logf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.log != nil {
+		fmt.Fprintf(r.log, format+"\n", args...)
+	}
+}
+
+// start starts tshark on the nodes, capturing on the given interfaces of
+// each (all of them when none), in the pods on all their interfaces, and on
+// the host interfaces if any. It returns once the starts are under way.
+func (r *captureRun) start(nodes []string, pods []podTarget, interfaces map[string][]string, hostInterfaces []string) error {
+	if err := os.MkdirAll(r.outputDir, 0o755); err != nil {
+		return err
+	}
+	if r.maxDiskUsage > 0 {
+		if u, err := hostDiskUsage(r.outputDir); err == nil && u.percent >= r.maxDiskUsage {
+			return fmt.Errorf("%s, at or above the %d%% capture_max_disk_usage_percent: free some space first", u, r.maxDiskUsage)
+		}
+	}
+	running, err := r.rt.runningContainers(r.ctx)
+	if err != nil {
+		return err
+	}
+	log, err := os.Create(filepath.Join(r.outputDir, captureLogName))
+	if err != nil {
+		return err
+	}
+	r.log = log
+	r.logf("Using capture filter: %s", r.filter)
+	var filtered []string
+	for node := range r.nodeFilters {
+		filtered = append(filtered, node)
+	}
+	sort.Strings(filtered)
+	for _, node := range filtered {
+		r.logf("%s: using capture filter: %s", node, r.nodeFilters[node])
+	}
+	r.logf("Capturing with the %s backend", r.backend)
+
+	for _, node := range nodes {
+		r.nodes = append(r.nodes, &nodeCapture{node: node, container: node, interfaces: interfaces[node]})
+	}
+	for _, p := range pods {
+		r.nodes = append(r.nodes, &nodeCapture{node: p.captureNode(), container: p.node, pod: &p})
+	}
+	for _, n := range r.nodes {
+		n.filter = r.nodeFilter(n.node)
+		n.tool, n.file, n.starting = r.tool(), "/"+captureFileName(n.filter, n.node), true
+		if !containsString(running, n.container) {
+			n.starting, n.startErr = false, fmt.Errorf("container %s not found or not running", n.container)
+			r.logf("%s: ✗ %v", n.node, n.startErr)
+		}
+	}
+	if len(hostInterfaces) > 0 {
+		filter := r.nodeFilter(hostCaptureNode)
+		r.nodes = append(r.nodes, &nodeCapture{
+			node:       hostCaptureNode,
+			interfaces: hostInterfaces,
+			filter:     filter,
+			tool:       r.tool(),
+			file:       filepath.Join(r.outputDir, captureFileName(filter, hostCaptureNode)),
+			starting:   true,
+		})
+	}
+	for _, n := range r.nodes {
+		if !n.starting {
+			continue
+		}
+		r.starting.Add(1)
+		go func() {
+			defer r.starting.Done()
+			var pid int
+			var err error
+			if n.node == hostCaptureNode {
+				pid, err = r.startHost(n)
+			} else {
+				pid, err = r.startNode(n)
+			}
+			r.mu.Lock()
+			n.starting, n.pid, n.startErr = false, pid, err
+			r.mu.Unlock()
+			if err != nil {
+				r.logf("%s: ✗ %v", n.node, err)
+				return
+			}
+			r.logf("%s: ✓ capturing with %s PID %d -> %s", n.node, n.tool, pid, n.file)
+			r.onStarted(n.node, pid)
+		}()
+	}
+	go r.supervise()
+	return nil
+}
+
+// waitStarted waits for tshark to start, or fail to, on every node, and
+// tells whether they all did within the timeout.
+func (r *captureRun) waitStarted(timeout time.Duration) bool {
+	started := make(chan struct{})
+	go func() {
+		r.starting.Wait()
+		close(started)
+	}()
+	select {
+	case <-started:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// nodeFilter returns the capture filter of a node.
+func (r *captureRun) nodeFilter(node string) string {
+	if filter, ok := r.nodeFilters[node]; ok {
+		return filter
+	}
+	return r.filter
+}
+
+// tsharkArgs returns the tshark command capturing on the interfaces of a
+// node to its file.
+func (r *captureRun) tsharkArgs(n *nodeCapture) []string {
+	args := []string{"tshark"}
+	if len(n.interfaces) == 0 {
+		args = append(args, "-i", "any")
+	}
+	for _, iface := range n.interfaces {
+		args = append(args, "-i", iface)
+	}
+	if r.maxPackets > 0 {
+		args = append(args, "-c", strconv.Itoa(r.maxPackets))
+	}
+	if r.fileSizeKB > 0 {
+		args = append(args, "-b", fmt.Sprintf("filesize:%d", r.fileSizeKB), "-b", fmt.Sprintf("files:%d", r.numFiles))
+	}
+	args = append(args, "-F", "pcapng", "-n", "-t", "ad", "-f", n.filter, "-w", n.file)
+	if r.live {
+		return append(args, "-P", "-l")
+	}
+	return append(args, "-q")
+}
+
+// tcpdumpArgs returns the tcpdump command capturing on the interface of a
+// node, or all of them, to its file. tcpdump writes a classic pcap,
+// converted to pcapng once copied out.
+func (r *captureRun) tcpdumpArgs(n *nodeCapture) []string {
+	iface := "any"
+	if len(n.interfaces) == 1 {
+		iface = n.interfaces[0]
+	}
+	args := []string{"tcpdump", "-i", iface, "-n", "-U", "-Z", "root"}
+	if r.maxPackets > 0 {
+		args = append(args, "-c", strconv.Itoa(r.maxPackets))
+	}
+	args = append(args, "-w", n.file)
+	if r.live {
+		args = append(args, "--print", "-l")
+	}
+	return append(args, n.filter)
+}
+
+// agentArgs returns the command of the agent capturing on the interfaces of
+// a node to its file, the binary being at the given path and the filter
+// compiled to program.
+func (r *captureRun) agentArgs(binary, program string, n *nodeCapture) []string {
+	args := []string{binary, captureAgentCommand, "-w", n.file, "-f", n.filter}
+	if len(n.interfaces) > 0 {
+		args = append(args, "-i", strings.Join(n.interfaces, ","))
+	}
+	if program != "" {
+		args = append(args, "-bpf", program)
+	}
+	if r.maxPackets > 0 {
+		args = append(args, "-c", strconv.Itoa(r.maxPackets))
+	}
+	if r.live {
+		args = append(args, "-live")
+	}
+	return args
+}
+
+// tool is the name of the program capturing on the nodes.
+func (r *captureRun) tool() string {
+	if r.backend == afpacketBackend {
+		return captureAgentCommand
+	}
+	return "tshark"
+}
+
+// shellQuote quotes a word for sh.
+func shellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// sideFile returns a file next to the pcapng of a node: ".live" receives the
+// packet summaries, ".err" the errors of tshark.
+func sideFile(file, ext string) string {
+	return strings.TrimSuffix(file, ".pcapng") + ext
+}
+
+// ensureTshark installs tshark on a node unless it already is.
+func (r *captureRun) ensureTshark(node string) error {
+	if _, err := runtimeOutput(r.ctx, r.rt, node, "which", "tshark"); err == nil {
+		return nil
+	}
+	r.logf("%s: tshark not found, installing it", node)
+	for _, installer := range tsharkInstallers {
+		if _, err := runtimeOutput(r.ctx, r.rt, node, "which", installer.manager); err != nil {
+			continue
+		}
+		for _, cmd := range installer.commands {
+			if _, err := runtimeOutput(r.ctx, r.rt, node, cmd...); err != nil {
+				return fmt.Errorf("installing tshark: %w", err)
+			}
+		}
+		if _, err := runtimeOutput(r.ctx, r.rt, node, "which", "tshark"); err != nil {
+			return fmt.Errorf("tshark still missing after installing it with %s", installer.manager)
+		}
+		r.logf("%s: tshark installed with %s", node, installer.manager)
+		return nil
+	}
+	return fmt.Errorf("tshark is missing and no known package manager was found to install it")
+}
+
+// agentExecutable is the running server binary, copied to the nodes as
+// the capture agent.
+type agentExecutable struct {
+	path   string
+	sha256 string
+}
+
+// agentBinary returns the server binary, once checked it can run in the
+// containers whatever their distribution.
+var agentBinary = sync.OnceValues(func() (agentExecutable, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return agentExecutable{}, err
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		return agentExecutable{}, fmt.Errorf("the afpacket backend needs the server to run as a Linux binary: %w", err)
+	}
+	defer f.Close()
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return agentExecutable{}, fmt.Errorf("the server binary %s is dynamically linked, rebuild it with CGO_ENABLED=0 to use the afpacket backend", exe)
+		}
+	}
+	_, sum, err := hashFile(exe)
+	return agentExecutable{path: exe, sha256: sum}, err
+})
+
+// ensureAgent copies the server binary to a node as the capture agent,
+// unless the same one already is there.
+func (r *captureRun) ensureAgent(node string) error {
+	binary, err := agentBinary()
+	if err != nil {
+		return err
+	}
+	if out, err := runtimeOutput(r.ctx, r.rt, node, "sha256sum", captureAgentPath); err == nil && strings.HasPrefix(out, binary.sha256) {
+		return nil
+	}
+	r.logf("%s: copying the capture agent to %s", node, captureAgentPath)
+	if err := r.rt.copyTo(r.ctx, node, binary.path, captureAgentPath, 0o755); err != nil {
+		return fmt.Errorf("copying the capture agent: %w", err)
+	}
+	return nil
+}
+
+// compileFilter compiles a capture filter to the BPF program the agent
+// attaches, with tcpdump on the host or else on the node. A filter is the
+// same program on every node, the agent capturing Ethernet frames
+// everywhere.
+func (r *captureRun) compileFilter(node, filter string) (string, error) {
+	r.mu.Lock()
+	program, compiled := r.programs[filter]
+	r.mu.Unlock()
+	if compiled {
+		return program, nil
+	}
+	args := []string{"tcpdump", "-ddd", "-y", "EN10MB", filter}
+	out, err := exec.CommandContext(r.ctx, args[0], args[1:]...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil && node != hostCaptureNode {
+		var nodeOut string
+		if nodeOut, err = runtimeOutput(r.ctx, r.rt, node, args...); err == nil {
+			out = []byte(nodeOut)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("compiling the capture filter with tcpdump, on the host or else the node: %v", err)
+	}
+	program = strings.Join(strings.Split(strings.TrimSpace(string(out)), "\n"), ",")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.programs[filter] = program
+	return program, nil
+}
+
+// netnsPrefix returns the command entering the network namespace of the
+// router pod on a kind node, or of the pod of a capture in a pod, empty for
+// containerlab routers which capture in the container itself.
+func (r *captureRun) netnsPrefix(n *nodeCapture) ([]string, error) {
+	if n.pod != nil {
+		// The pod sandbox holds the network namespace of the pod; crictl
+		// matches the names as regular expressions.
+		ids, err := runtimeOutput(r.ctx, r.rt, n.container, "crictl", "pods", "--namespace", "^"+regexp.QuoteMeta(n.pod.namespace)+"$",
+			"--name", "^"+regexp.QuoteMeta(n.pod.name)+"$", "--state", "ready", "-q")
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSpace(strings.SplitN(ids, "\n", 2)[0])
+		if id == "" {
+			return nil, fmt.Errorf("no ready sandbox found for pod %s/%s", n.pod.namespace, n.pod.name)
+		}
+		pid, err := runtimeOutput(r.ctx, r.rt, n.container, "crictl", "inspectp", "--output", "go-template", "--template", "{{.info.pid}}", id)
+		if err != nil {
+			return nil, err
+		}
+		if pid = strings.TrimSpace(pid); pid == "" {
+			return nil, fmt.Errorf("no PID for the sandbox %s", id)
+		}
+		return []string{"nsenter", "-t", pid, "-n"}, nil
+	}
+	if strings.HasPrefix(n.container, "clab-") {
+		return nil, nil
+	}
+	ids, err := runtimeOutput(r.ctx, r.rt, n.container, "crictl", "ps", "--name", "^frr$", "--state", "running", "-q")
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSpace(strings.SplitN(ids, "\n", 2)[0])
+	if id == "" {
+		return nil, fmt.Errorf("no running FRR container found in the router pod")
+	}
+	pid, err := runtimeOutput(r.ctx, r.rt, n.container, "crictl", "inspect", "--output", "go-template", "--template", "{{.info.pid}}", id)
+	if err != nil {
+		return nil, err
+	}
+	if pid = strings.TrimSpace(pid); pid == "" {
+		return nil, fmt.Errorf("no PID for the FRR container %s", id)
+	}
+	return []string{"nsenter", "-t", pid, "-n"}, nil
+}
+
+// fallbackTool picks what captures on a node tshark could not be installed
+// on: tcpdump when the node has it, unless several interfaces are captured
+// on which it cannot do, or else the capture agent.
+func (r *captureRun) fallbackTool(n *nodeCapture, tsharkErr error) (string, error) {
+	if r.fileSizeKB > 0 {
+		return "", fmt.Errorf("%w; only tshark writes a ring buffer, retry without file_size_mb to fall back to tcpdump or the capture agent", tsharkErr)
+	}
+	if len(n.interfaces) <= 1 {
+		if _, err := runtimeOutput(r.ctx, r.rt, n.container, "which", "tcpdump"); err == nil {
+			return "tcpdump", nil
+		}
+	}
+	if _, err := agentBinary(); err != nil {
+		return "", fmt.Errorf("%w; neither tcpdump nor the capture agent can replace it: %v", tsharkErr, err)
+	}
+	return captureAgentCommand, nil
+}
+
+// lockSetup locks the setup of a container, and returns the function
+// unlocking it.
+func (r *captureRun) lockSetup(container string) func() {
+	r.mu.Lock()
+	if r.setup == nil {
+		r.setup = make(map[string]*sync.Mutex)
+	}
+	l, ok := r.setup[container]
+	if !ok {
+		l = &sync.Mutex{}
+		r.setup[container] = l
+	}
+	r.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// prepareNode makes sure what captures on a node is in its container, and
+// returns its command.
+func (r *captureRun) prepareNode(n *nodeCapture) ([]string, error) {
+	defer r.lockSetup(n.container)()
+	tool := n.tool
+	if tool == "tshark" {
+		if tsharkErr := r.ensureTshark(n.container); tsharkErr != nil {
+			var err error
+			if tool, err = r.fallbackTool(n, tsharkErr); err != nil {
+				return nil, err
+			}
+			r.logf("%s: %v, capturing with %s instead", n.node, tsharkErr, tool)
+		}
+	}
+	r.mu.Lock()
+	n.tool = tool
+	r.mu.Unlock()
+	switch tool {
+	case captureAgentCommand:
+		program, err := r.compileFilter(n.container, n.filter)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.ensureAgent(n.container); err != nil {
+			return nil, err
+		}
+		return r.agentArgs(captureAgentPath, program, n), nil
+	case "tcpdump":
+		return r.tcpdumpArgs(n), nil
+	}
+	return r.tsharkArgs(n), nil
+}
+
+// startNode starts tshark, tcpdump or the agent in the background on a
+// node and returns its PID in the container.
+func (r *captureRun) startNode(n *nodeCapture) (int, error) {
+	args, err := r.prepareNode(n)
+	if err != nil {
+		return 0, err
+	}
+	prefix, err := r.netnsPrefix(n)
+	if err != nil {
+		return 0, err
+	}
+	var words []string
+	for _, word := range append(prefix, args...) {
+		words = append(words, shellQuote(word))
+	}
+	output := "/dev/null"
+	if r.live {
+		output = sideFile(n.file, ".live")
+	}
+	script := fmt.Sprintf("%s > %s 2> %s & echo $!", strings.Join(words, " "), output, sideFile(n.file, ".err"))
+	out, err := runtimeOutput(r.ctx, r.rt, n.container, "sh", "-c", script)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected %s PID %q", n.tool, strings.TrimSpace(out))
+	}
+
+	// The capture fails right away on a bad interface or filter.
+	time.Sleep(time.Second)
+	if !r.nodeRunning(n.container, pid) {
+		ctx, cancel := context.WithTimeout(context.Background(), captureExecTimeout)
+		defer cancel()
+		message, _ := runtimeOutput(ctx, r.rt, n.container, "cat", sideFile(n.file, ".err"))
+		r.rt.exec(ctx, n.container, []string{"rm", "-f", sideFile(n.file, ".err"), sideFile(n.file, ".live")}, nil, nil)
+		lines := strings.Split(strings.TrimSpace(message), "\n")
+		return 0, fmt.Errorf("%s exited right away: %s", n.tool, lines[len(lines)-1])
+	}
+	if r.live {
+		r.liveFollow.Add(1)
+		go func() {
+			defer r.liveFollow.Done()
+			w := &lineWriter{line: func(line string) { r.forwardSummary(n.node, line) }}
+			r.rt.exec(r.liveCtx, n.container, []string{"tail", "-n", "+1", "-F", sideFile(n.file, ".live")}, w, nil)
+		}()
+	}
+	return pid, nil
+}
+
+// startHost starts tshark, or the agent, on the host interfaces, writing
+// straight to the output directory.
+func (r *captureRun) startHost(n *nodeCapture) (int, error) {
+	args := r.tsharkArgs(n)
+	if r.backend == afpacketBackend {
+		program, err := r.compileFilter(hostCaptureNode, n.filter)
+		if err != nil {
+			return 0, err
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return 0, err
+		}
+		args = r.agentArgs(exe, program, n)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if r.live {
+		cmd.Stdout = &lineWriter{line: func(line string) { r.forwardSummary(hostCaptureNode, line) }}
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	n.host, n.hostExited = cmd, make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(n.hostExited)
+	}()
+	select {
+	case <-n.hostExited:
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return 0, fmt.Errorf("%s exited right away: %s", n.tool, lines[len(lines)-1])
+	case <-time.After(time.Second):
+	}
+	return cmd.Process.Pid, nil
+}
+
+// forwardSummary forwards a packet summary, one at a time.
+func (r *captureRun) forwardSummary(node, summary string) {
+	r.liveMu.Lock()
+	defer r.liveMu.Unlock()
+	r.onLive(node, summary)
+}
+
+// nodeRunning tells whether tshark still runs on a node, zombies left
+// behind by the container init excluded.
+func (r *captureRun) nodeRunning(node string, pid int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), captureExecTimeout)
+	defer cancel()
+	code, err := r.rt.exec(ctx, node, []string{"sh", "-c", fmt.Sprintf("test -e /proc/%d && ! grep -q '^State:.*Z' /proc/%d/status", pid, pid)}, nil, nil)
+	return err == nil && code == 0
+}
+
+// capturing tells whether tshark still runs on a node of the capture.
+func (r *captureRun) capturing(n *nodeCapture) bool {
+	if n.node == hostCaptureNode {
+		select {
+		case <-n.hostExited:
+			return false
+		default:
+			return true
+		}
+	}
+	return r.nodeRunning(n.container, n.pid)
+}
+
+// started returns the nodes tshark started on.
+func (r *captureRun) started() []*nodeCapture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var nodes []*nodeCapture
+	for _, n := range r.nodes {
+		if !n.starting && n.startErr == nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// supervise ends the capture when it is stopped, when every tshark reached
+// the packet limit, or when a disk it writes to is about to fill up.
+func (r *captureRun) supervise() {
+	defer close(r.done)
+	r.starting.Wait()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var diskChecked time.Time
+	for stopped := false; !stopped; {
+		select {
+		case <-r.stopping:
+			stopped = true
+		case <-ticker.C:
+			if r.maxDiskUsage > 0 && time.Since(diskChecked) >= diskCheckInterval {
+				diskChecked = time.Now()
+				if u, full := r.checkDisks(); full {
+					r.logf("Stopping the capture: %s", u)
+					r.diskFull, stopped = &u, true
+					continue
+				}
+			}
+			nodes := r.started()
+			if r.maxPackets == 0 || len(nodes) == 0 {
+				continue
+			}
+			running := false
+			for _, n := range nodes {
+				if r.capturing(n) {
+					running = true
+					break
+				}
+			}
+			if !running {
+				r.logf("All captures reached their packet limit")
+				r.limitReached, stopped = true, true
+			}
+		}
+	}
+	r.finish()
+}
+
+// stop makes the capture stop tshark and copy the files out.
+func (r *captureRun) stop() {
+	r.stopOnce.Do(func() { close(r.stopping) })
+}
+
+// finish stops tshark on every node, gracefully first, and copies the files
+// to the output directory.
+func (r *captureRun) finish() {
+	r.logf("Stopping the captures")
+	nodes := r.started()
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.stopNode(n)
+			if n.node != hostCaptureNode {
+				r.copyNode(n)
+			} else {
+				for _, file := range capturedFiles(r.outputDir, n.filter, hostCaptureNode) {
+					if info, err := os.Stat(file); err == nil {
+						n.copied++
+						n.bytes += info.Size()
+					}
+				}
+			}
+			r.copiedMu.Lock()
+			defer r.copiedMu.Unlock()
+			r.copies++
+			r.onCopied(r.nodeCopy(n), r.copies, len(nodes))
+		}()
+	}
+	wg.Wait()
+
+	// Following the summaries ends with the connection, not with tail.
+	r.stopLive()
+	r.liveFollow.Wait()
+	if r.live {
+		for _, n := range r.started() {
+			if n.node == hostCaptureNode {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), captureExecTimeout)
+			r.rt.exec(ctx, n.container, []string{"pkill", "-f", "tail -n +1 -F " + sideFile(n.file, ".live")}, nil, nil)
+			r.rt.exec(ctx, n.container, []string{"rm", "-f", sideFile(n.file, ".live")}, nil, nil)
+			cancel()
+		}
+	}
+
+	r.logf("Capture files saved to: %s", r.outputDir)
+	r.mu.Lock()
+	if r.log != nil {
+		r.log.Close()
+		r.log = nil
+	}
+	r.mu.Unlock()
+	r.abort()
+}
+
+// stopNode sends SIGTERM to tshark, so it closes its files, and kills it if
+// it is still running after the grace period.
+func (r *captureRun) stopNode(n *nodeCapture) {
+	signal := func(sig string) {
+		if n.node == hostCaptureNode {
+			if sig == "TERM" {
+				n.host.Process.Signal(syscall.SIGTERM)
+			} else {
+				n.host.Process.Kill()
+			}
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), captureExecTimeout)
+		defer cancel()
+		if _, err := runtimeOutput(ctx, r.rt, n.container, "kill", "-"+sig, strconv.Itoa(n.pid)); err != nil && r.capturing(n) {
+			r.problem(n, fmt.Sprintf("SIG%s to %s failed: %v", sig, n.tool, err))
+		}
+	}
+	if !r.capturing(n) {
+		return
+	}
+	signal("TERM")
+	for deadline := time.Now().Add(captureStopGrace); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+		if !r.capturing(n) {
+			return
+		}
+	}
+	signal("KILL")
+	r.problem(n, fmt.Sprintf("%s was killed after not stopping within %s, its last file may be truncated", n.tool, captureStopGrace))
+}
+
+// copyNode copies the pcaps of a node, the rotated files of a ring buffer
+// included, to the output directory.
+func (r *captureRun) copyNode(n *nodeCapture) {
+	var out bytes.Buffer
+	glob := path.Join(path.Dir(n.file), rotatedFileGlob(n.filter, n.node))
+	if _, err := r.rt.exec(r.ctx, n.container, []string{"sh", "-c", fmt.Sprintf("ls -1 %s %s 2>/dev/null", n.file, glob)}, &out, nil); err != nil {
+		r.problem(n, fmt.Sprintf("listing capture files: %v", err))
+		return
+	}
+	files := strings.Fields(out.String())
+	if len(files) == 0 {
+		r.problem(n, fmt.Sprintf("no capture file found, %s missing", n.file))
+	}
+	for _, file := range files {
+		dst := filepath.Join(r.outputDir, path.Base(file))
+		if err := r.copyFile(n, file, dst); err != nil {
+			r.problem(n, fmt.Sprintf("copying %s: %v", file, err))
+			continue
+		}
+		if n.tool == "tcpdump" {
+			iface := "any"
+			if len(n.interfaces) == 1 {
+				iface = n.interfaces[0]
+			}
+			if err := convertToPcapng(dst, iface); err != nil {
+				r.problem(n, fmt.Sprintf("converting %s to pcapng: %v", dst, err))
+			}
+		}
+		n.copied++
+		if info, err := os.Stat(dst); err == nil {
+			n.bytes += info.Size()
+		}
+		r.logf("%s: ✓ copied %s to %s", n.node, file, dst)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), captureExecTimeout)
+	defer cancel()
+	r.rt.exec(ctx, n.container, []string{"rm", "-f", sideFile(n.file, ".err")}, nil, nil)
+}
+
+// copyFile copies a file out of the container of a node, retrying when the
+// daemon fails or the transfer is cut, unless the capture is aborted.
+func (r *captureRun) copyFile(n *nodeCapture, file, dst string) error {
+	for attempt := 1; ; attempt++ {
+		err := r.rt.copyFrom(r.ctx, n.container, file, dst)
+		if err == nil || attempt > copyRetries || !transientDockerError(err) || r.ctx.Err() != nil {
+			return err
+		}
+		r.logf("%s: copying %s failed, retrying: %v", n.node, file, err)
+		r.mu.Lock()
+		n.retries++
+		r.mu.Unlock()
+		select {
+		case <-r.ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+// nodeCopy is the outcome of stopping a node and copying its files out.
+type nodeCopy struct {
+	node    string
+	files   int
+	bytes   int64
+	retries int
+	// problems are what went wrong; startErr tells why the node never
+	// captured.
+	problems []string
+	startErr error
+}
+
+// status sums up the copy of a node.
+func (c nodeCopy) status() string {
+	switch {
+	case c.startErr != nil:
+		return "not captured"
+	case c.files == 0:
+		return "failed"
+	case len(c.problems) > 0:
+		return "copied with problems"
+	}
+	return "copied"
+}
+
+func (r *captureRun) nodeCopy(n *nodeCapture) nodeCopy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return nodeCopy{
+		node:     n.node,
+		files:    n.copied,
+		bytes:    n.bytes,
+		retries:  n.retries,
+		problems: append([]string{}, n.problems...),
+		startErr: n.startErr,
+	}
+}
+
+// nodeCopies returns the outcome of every node of a stopped capture, the
+// ones that never captured included.
+func (r *captureRun) nodeCopies() []nodeCopy {
+	r.mu.Lock()
+	nodes := append([]*nodeCapture(nil), r.nodes...)
+	r.mu.Unlock()
+	copies := make([]nodeCopy, 0, len(nodes))
+	for _, n := range nodes {
+		copies = append(copies, r.nodeCopy(n))
+	}
+	return copies
+}
+
+// problem records and logs what went wrong on a node.
+func (r *captureRun) problem(n *nodeCapture, message string) {
+	r.logf("%s: ✗ %s", n.node, message)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n.problems = append(n.problems, message)
+}
+
+// startReport describes how the capture started on each node.
+func (r *captureRun) startReport() (text string, capturing int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	for _, n := range r.nodes {
+		where := "all interfaces"
+		if len(n.interfaces) > 0 {
+			where = strings.Join(n.interfaces, ", ")
+		}
+		switch {
+		case n.starting:
+			fmt.Fprintf(&b, "  … %s: still starting (installing %s?), see %s\n", n.node, r.tool(), captureLogName)
+		case n.startErr != nil:
+			fmt.Fprintf(&b, "  ✗ %s: %v\n", n.node, n.startErr)
+		default:
+			capturing++
+			fmt.Fprintf(&b, "  ✓ %s: %s PID %d on %s\n", n.node, n.tool, n.pid, where)
+		}
+	}
+	return b.String(), capturing
+}
+
+// lineWriter calls line with every complete line written to it.
+type lineWriter struct {
+	line    func(string)
+	pending []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.line(string(w.pending[:i]))
+		w.pending = w.pending[i+1:]
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxScheduleSearch bounds the search of the next run of a cron schedule,
+// which never matches when it names a day a month does not have.
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+// cronField is the set of values a field of a cron schedule matches.
+type cronField struct {
+	values map[int]bool
+	// any tells the field is '*', which matters to the day fields: when both
+	// are restricted a day matching either runs, as in cron.
+	any bool
+}
+
+// cronSchedule is a five-field cron expression: minute, hour, day of month,
+// month and day of week, in the local time of the server.
+type cronSchedule struct {
+	expr                             string
+	minute, hour, dom, month, weekly cronField
+}
+
+// parseCronField parses the lists, ranges and steps of a cron field, such
+// as '*/15', '1-5' or '0,30'.
+func parseCronField(field string, min, max int) (cronField, error) {
+	f := cronField{values: make(map[int]bool), any: field == "*"}
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return f, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return f, fmt.Errorf("invalid value %q", first)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return f, fmt.Errorf("invalid value %q", last)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return f, fmt.Errorf("%q is out of %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			f.values[v] = true
+		}
+	}
+	return f, nil
+}
+
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, minute hour day-of-month month day-of-week (e.g., '0 2 * * 1-5')", expr)
+	}
+	c := &cronSchedule{expr: expr}
+	for i, field := range []struct {
+		f        *cronField
+		name     string
+		min, max int
+	}{
+		{&c.minute, "minute", 0, 59},
+		{&c.hour, "hour", 0, 23},
+		{&c.dom, "day of month", 1, 31},
+		{&c.month, "month", 1, 12},
+		{&c.weekly, "day of week", 0, 7},
+	} {
+		f, err := parseCronField(fields[i], field.min, field.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q, %s: %v", expr, field.name, err)
+		}
+		*field.f = f
+	}
+	// Sunday is 0 or 7.
+	if c.weekly.values[7] {
+		c.weekly.values[0] = true
+	}
+	return c, nil
+}
+
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := c.dom.values[t.Day()], c.weekly.values[int(t.Weekday())]
+	switch {
+	case c.dom.any && c.weekly.any:
+		return true
+	case c.dom.any:
+		return dow
+	case c.weekly.any:
+		return dom
+	}
+	return dom || dow
+}
+
+// next returns the first minute after t the schedule matches, or the zero
+// time if it never does.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.Add(maxScheduleSearch); t.Before(limit); {
+		switch {
+		case !c.month.values[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour.values[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute.values[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// scheduledRun is a time a scheduled capture was due, with the capture it
+// started, if any.
+type scheduledRun struct {
+	at        time.Time
+	captureID string
+	// skipped tells why no capture was started.
+	skipped string
+}
+
+// scheduledCapture starts a capture at a given time, or at every time a
+// cron schedule matches, for planned maintenance windows.
+type scheduledCapture struct {
+	ID        string
+	SessionID string
+	// startAt is the time of a one-shot schedule, cron the schedule of a
+	// recurring one.
+	startAt time.Time
+	cron    *cronSchedule
+	// capture are the start_traffic_capture arguments of the captures.
+	capture map[string]any
+	cancel  context.CancelFunc
+	// done is closed once the schedule ended.
+	done    chan struct{}
+	created time.Time
+	// runs, nextRun and captureID are guarded by MCPServer.mu; captureID is
+	// the last capture started.
+	runs      []scheduledRun
+	nextRun   time.Time
+	captureID string
+}
+
+// scheduleArgs reads start_at and schedule, at most one of which is given.
+func scheduleArgs(args map[string]any) (startAt time.Time, cron *cronSchedule, err error) {
+	at, _ := args["start_at"].(string)
+	expr, _ := args["schedule"].(string)
+	if at != "" && expr != "" {
+		return time.Time{}, nil, fmt.Errorf("start_at and schedule are exclusive")
+	}
+	if at != "" {
+		if startAt, err = time.Parse(time.RFC3339, at); err != nil {
+			return time.Time{}, nil, fmt.Errorf("invalid start_at %q: expected an RFC3339 timestamp such as 2006-01-02T01:30:00+02:00", at)
+		}
+		if !startAt.After(time.Now()) {
+			return time.Time{}, nil, fmt.Errorf("start_at %s is in the past", at)
+		}
+		return startAt, nil, nil
+	}
+	if cron, err = parseCronSchedule(expr); err != nil {
+		return time.Time{}, nil, err
+	}
+	if cron.next(time.Now()).IsZero() {
+		return time.Time{}, nil, fmt.Errorf("schedule %q never matches", expr)
+	}
+	return time.Time{}, cron, nil
+}
+
+// scheduleCapture arms a capture to start later instead of now. The
+// capture must end on its own, its files being published as resources
+// once copied out.
+func (s *MCPServer) scheduleCapture(sessionID string, args map[string]any) CallToolResult {
+	startAt, cron, err := scheduleArgs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	_, hasDuration := args["duration_seconds"]
+	_, hasLimit := args["max_packets"]
+	if !hasDuration && !hasLimit {
+		return toolError("A scheduled capture must stop on its own: duration_seconds or max_packets is required")
+	}
+	if d, ok := args["duration_seconds"].(float64); ok && d <= 0 {
+		return toolError("duration_seconds must be positive")
+	}
+	if v, ok := args["max_packets"].(float64); ok && v < 1 {
+		return toolError("max_packets must be at least 1")
+	}
+	if _, ok := args["output_dir"]; ok && cron != nil {
+		return toolError("output_dir does not apply to a recurring schedule, whose runs each get their own directory")
+	}
+
+	capture := make(map[string]any, len(args))
+	for k, v := range args {
+		if k != "start_at" && k != "schedule" {
+			capture[k] = v
+		}
+	}
+
+	// The filter is compiled now rather than when the capture starts,
+	// possibly overnight with nobody around to fix a typo.
+	filter, _ := capture["capture_filter"].(string)
+	if _, err := profileFilter(capture, ""); err != nil {
+		return toolError(err.Error())
+	}
+	if skip, _ := capture["skip_filter_validation"].(bool); !skip && filter != "" {
+		nodeGlobs, err := stringsArg(capture, "nodes")
+		if err != nil {
+			return toolError(err.Error())
+		}
+		ifaceGlobs, err := stringsArg(capture, "interfaces")
+		if err != nil {
+			return toolError(err.Error())
+		}
+		nodes, ifaces, _, err := captureTargets(nodeGlobs, ifaceGlobs)
+		if err != nil {
+			return toolError(fmt.Sprintf("Error selecting capture targets: %v", err))
+		}
+		if problems := filterProblems(checkCaptureFilters(filter, nodes, ifaces)); len(problems) > 0 {
+			return toolError(fmt.Sprintf("Invalid capture filter %q, no capture scheduled:\n  %s", filter, strings.Join(problems, "\n  ")))
+		}
+		capture["skip_filter_validation"] = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.nextSchedule++
+	sc := &scheduledCapture{
+		ID:        fmt.Sprintf("schedule-%d", s.nextSchedule),
+		SessionID: sessionID,
+		startAt:   startAt,
+		cron:      cron,
+		capture:   capture,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		created:   time.Now(),
+		nextRun:   startAt,
+	}
+	if cron != nil {
+		sc.nextRun = cron.next(sc.created)
+	}
+	s.schedules[sc.ID] = sc
+	s.mu.Unlock()
+	go s.runSchedule(ctx, sc)
+
+	var b strings.Builder
+	if cron != nil {
+		fmt.Fprintf(&b, "Capture scheduled (schedule_id: %s) at every match of %q, server local time.\n", sc.ID, cron.expr)
+		b.WriteString("Next runs:\n")
+		t := time.Now()
+		for range 3 {
+			if t = cron.next(t); t.IsZero() {
+				break
+			}
+			fmt.Fprintf(&b, "  %s\n", t.Format("Mon 2006-01-02 15:04 MST"))
+		}
+		b.WriteString("A run is skipped while the capture of the previous one still runs.\n")
+	} else {
+		fmt.Fprintf(&b, "Capture scheduled (schedule_id: %s) to start at %s, in %s.\n", sc.ID,
+			startAt.Local().Format("Mon 2006-01-02 15:04:05 MST"), time.Until(startAt).Truncate(time.Second))
+	}
+	if d, ok := capture["duration_seconds"].(float64); ok {
+		fmt.Fprintf(&b, "Each capture stops after %gs", d)
+		if n, ok := capture["max_packets"].(float64); ok {
+			fmt.Fprintf(&b, " or %g packets per node", n)
+		}
+		b.WriteString(".\n")
+	} else {
+		fmt.Fprintf(&b, "Each capture stops once every node captured %g packets.\n", capture["max_packets"])
+	}
+	b.WriteString("The session is notified when a capture starts (event scheduled_capture_started) and when it stops (event capture_stopped), its pcaps then being listed as capture:// resources.\n")
+	b.WriteString("The schedule ends with this session. Use cancel_scheduled_capture to cancel it.")
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
+
+// runSchedule waits for the runs of a schedule until it is cancelled, or
+// after the single run of a one-shot one.
+func (s *MCPServer) runSchedule(ctx context.Context, sc *scheduledCapture) {
+	defer close(sc.done)
+	defer func() {
+		s.mu.Lock()
+		delete(s.schedules, sc.ID)
+		s.mu.Unlock()
+	}()
+	next := sc.startAt
+	for {
+		if sc.cron != nil {
+			if next = sc.cron.next(time.Now()); next.IsZero() {
+				return
+			}
+		}
+		s.mu.Lock()
+		sc.nextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.scheduledRunDue(sc, next)
+		if sc.cron == nil {
+			return
+		}
+	}
+}
+
+// scheduledRunDue starts the capture of a run, unless the previous one
+// still runs, and notifies the session.
+func (s *MCPServer) scheduledRunDue(sc *scheduledCapture, at time.Time) {
+	run := scheduledRun{at: at}
+	s.mu.Lock()
+	previous := sc.captureID
+	_, running := s.activeCalls[previous]
+	s.mu.Unlock()
+
+	if running {
+		run.skipped = fmt.Sprintf("capture %s of the previous run still runs", previous)
+	} else if !s.acquireToolSlot() {
+		// The capture takes a slot like a start_traffic_capture call.
+		run.skipped = fmt.Sprintf("the server is busy, %d tool calls already running", s.config.MaxConcurrentTools)
+	} else {
+		args := make(map[string]any, len(sc.capture))
+		for k, v := range sc.capture {
+			args[k] = v
+		}
+		requestID := fmt.Sprintf("%s-%d", sc.ID, len(sc.runs)+1)
+		result := s.startTrafficCapture(sc.SessionID, requestID, args)
+		s.releaseToolSlot()
+		if result.IsError {
+			run.skipped = "starting the capture failed: " + result.Content[0].Text
+		} else {
+			s.mu.Lock()
+			for _, call := range s.activeCalls {
+				if call.SessionID == sc.SessionID && call.ID == requestID {
+					run.captureID = call.CaptureID
+				}
+			}
+			// A capture stopping at once, on max_packets, may be done
+			// already.
+			for _, call := range s.finishedCaptures {
+				if call.SessionID == sc.SessionID && call.ID == requestID {
+					run.captureID = call.CaptureID
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.Lock()
+	sc.runs = append(sc.runs, run)
+	if run.captureID != "" {
+		sc.captureID = run.captureID
+	}
+	s.mu.Unlock()
+
+	level := "info"
+	message := fmt.Sprintf("Scheduled capture %s: ", sc.ID)
+	if run.captureID != "" {
+		message += "started capture " + run.captureID
+	} else {
+		level = "warning"
+		message += "no capture started, " + run.skipped
+	}
+	data := map[string]any{
+		"event":       "scheduled_capture_started",
+		"schedule_id": sc.ID,
+		"message":     message,
+	}
+	if run.captureID != "" {
+		data["capture_id"] = run.captureID
+	}
+	s.notify(sc.SessionID, level, data)
+}
+
+// sessionSchedules returns the scheduled captures of a session, or of
+// every session when sessionID is empty.
+func (s *MCPServer) sessionSchedules(sessionID string) []*scheduledCapture {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var schedules []*scheduledCapture
+	for _, sc := range s.schedules {
+		if sessionID == "" || sc.SessionID == sessionID {
+			schedules = append(schedules, sc)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].created.Before(schedules[j].created) })
+	return schedules
+}
+
+// cancelSchedules cancels schedules and waits for them to end, which lets
+// a capture they are starting finish starting.
+func cancelSchedules(schedules []*scheduledCapture) {
+	for _, sc := range schedules {
+		sc.cancel()
+	}
+	for _, sc := range schedules {
+		<-sc.done
+	}
+}
+
+func (s *MCPServer) cancelScheduledCapture(sessionID string, args map[string]any) CallToolResult {
+	var schedules []*scheduledCapture
+	if scheduleID, _ := args["schedule_id"].(string); scheduleID != "" {
+		s.mu.Lock()
+		sc, ok := s.schedules[scheduleID]
+		s.mu.Unlock()
+		if !ok || sc.SessionID != sessionID {
+			return toolError(fmt.Sprintf("No scheduled capture %s for this session", scheduleID))
+		}
+		schedules = []*scheduledCapture{sc}
+	} else {
+		schedules = s.sessionSchedules(sessionID)
+	}
+	if len(schedules) == 0 {
+		return CallToolResult{Content: []ContentItem{{Type: "text", Text: "No scheduled capture for this session."}}}
+	}
+	cancelSchedules(schedules)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cancelled %d scheduled capture(s). Captures they started keep running until they stop on their own.\n", len(schedules))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range schedules {
+		when := "at " + sc.startAt.Local().Format("2006-01-02 15:04:05")
+		if sc.cron != nil {
+			when = fmt.Sprintf("on %q", sc.cron.expr)
+		}
+		fmt.Fprintf(&b, "\n%s (%s): %d run(s)\n", sc.ID, when, len(sc.runs))
+		for _, r := range sc.runs {
+			if r.captureID != "" {
+				fmt.Fprintf(&b, "  %s → capture %s\n", r.at.Format("2006-01-02 15:04"), r.captureID)
+			} else {
+				fmt.Fprintf(&b, "  %s → no capture, %s\n", r.at.Format("2006-01-02 15:04"), r.skipped)
+			}
+		}
+	}
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2025-01-01 is a Wednesday.
+	from := time.Date(2025, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{"every quarter hour", "*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"strictly after", "7 10 * * *", time.Date(2025, 1, 2, 10, 7, 0, 0, time.UTC)},
+		{"day of week", "30 2 * * 6", time.Date(2025, 1, 4, 2, 30, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"sunday as 0", "0 0 * * 0", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"weekdays", "0 8 * * 1-5", time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC)},
+		{"stepped range", "0 9-17/4 * * *", time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"list", "0,45 10 * * *", time.Date(2025, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"day of month", "0 0 15 * *", time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"month", "0 0 1 3 *", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"day of month or day of week", "0 9 20 * 1", time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCronSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q): %v", tt.expr, err)
+			}
+			if got := c.next(from); !got.Equal(tt.want) {
+				t.Errorf("next(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"60 * * * *", "minute"},
+		{"* 24 * * *", "hour"},
+		{"* * 0 * *", "day of month"},
+		{"* * * 13 *", "month"},
+		{"* * * * 8", "day of week"},
+		{"*/0 * * * *", "invalid step"},
+		{"5-1 * * * *", "out of 0-59"},
+		{"a * * * *", "invalid value"},
+		{"1-b * * * *", "invalid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseCronSchedule(tt.expr)
+			if err == nil {
+				t.Fatalf("parseCronSchedule(%q) succeeded, want an error", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseCronSchedule(%q) = %v, want it to mention %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
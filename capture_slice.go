@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultSliceSeconds is the time kept on each side of the frame a slice is
+// cut around, when not given.
+const defaultSliceSeconds = 5
+
+// frameTime returns the timestamp of a frame of a capture file, numbered
+// from 1 as Wireshark does.
+func frameTime(in captureInput, frame int) (time.Time, error) {
+	src, err := openMergeSource(in, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer src.file.Close()
+	for number := 1; !src.done; number++ {
+		if number == frame {
+			return src.ci.Timestamp, nil
+		}
+		if err := src.next(); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s has fewer than %d frames", in.path, frame)
+}
+
+// sliceFileName returns the name of the slice of a capture file, or of the
+// files of a node, made from the window so slices never overwrite each
+// other.
+func sliceFileName(name string, from, to time.Time) string {
+	bound := func(t time.Time, open string) string {
+		if t.IsZero() {
+			return open
+		}
+		return t.Local().Format("150405.000")
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(name, ".pcapng"), ".pcap")
+	return fmt.Sprintf("%s_slice_%s-%s.pcapng", base, bound(from, "begin"), bound(to, "end"))
+}
+
+func (s *MCPServer) sliceCapture(args map[string]any) CallToolResult {
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	var from, to time.Time
+	for name, bound := range map[string]*time.Time{"start": &from, "end": &to} {
+		if v, _ := args[name].(string); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return toolError(fmt.Sprintf("invalid %s %q: expected an RFC3339 timestamp such as 2006-01-02T15:04:05.5Z", name, v))
+			}
+			*bound = t
+		}
+	}
+	frame := 0
+	if v, ok := args["frame"].(float64); ok {
+		if v < 1 || v != float64(int(v)) {
+			return toolError("frame must be a frame number, starting at 1")
+		}
+		frame = int(v)
+	}
+	switch {
+	case frame > 0 && (!from.IsZero() || !to.IsZero()):
+		return toolError("frame and start/end are exclusive")
+	case frame == 0 && from.IsZero() && to.IsZero():
+		return toolError("a window is required: start and/or end, or frame")
+	case !from.IsZero() && !to.IsZero() && to.Before(from):
+		return toolError("end is before start")
+	}
+
+	var around string
+	if frame > 0 {
+		if len(inputs) != 1 {
+			return toolError(fmt.Sprintf("frame numbers are per file, and %d files are selected: pass file, or a node whose capture left a single file", len(inputs)))
+		}
+		seconds := map[string]float64{"before_seconds": defaultSliceSeconds, "after_seconds": defaultSliceSeconds}
+		for name := range seconds {
+			if v, ok := args[name].(float64); ok {
+				if v < 0 {
+					return toolError(name + " must not be negative")
+				}
+				seconds[name] = v
+			}
+		}
+		t, err := frameTime(inputs[0], frame)
+		if err != nil {
+			return toolError(fmt.Sprintf("Error finding frame %d: %v", frame, err))
+		}
+		from = t.Add(-time.Duration(seconds["before_seconds"] * float64(time.Second)))
+		to = t.Add(time.Duration(seconds["after_seconds"] * float64(time.Second)))
+		around = fmt.Sprintf("Frame %d of %s was captured at %s\n", frame, inputs[0].path, t.Local().Format("2006-01-02 15:04:05.000000"))
+	}
+
+	// The files of a node, the rotated ones of a ring buffer included, make
+	// a single slice.
+	var nodes []string
+	perNode := make(map[string][]captureInput)
+	for _, in := range inputs {
+		if _, ok := perNode[in.node]; !ok {
+			nodes = append(nodes, in.node)
+		}
+		perNode[in.node] = append(perNode[in.node], in)
+	}
+
+	var b strings.Builder
+	b.WriteString(around)
+	for _, node := range nodes {
+		files := perNode[node]
+		name := strings.TrimSuffix(filepath.Base(files[0].path), encryptedCaptureSuffix)
+		if node != "" {
+			name = rotatedSuffixRe.ReplaceAllString(strings.TrimSuffix(name, ".pcapng"), "")
+		}
+		output := filepath.Join(filepath.Dir(files[0].path), sliceFileName(name, from, to))
+		var sources []string
+		for _, in := range files {
+			sources = append(sources, filepath.Base(in.path))
+		}
+		comment := fmt.Sprintf("Sliced by openperouter-mcp from %s", strings.Join(sources, ", "))
+		packets, first, last, err := mergeCaptureFiles(files, nil, from, to, output, comment)
+		if err != nil {
+			return toolError(fmt.Sprintf("Error slicing %s: %v", strings.Join(sources, ", "), err))
+		}
+		if output, err = encryptLike(files, output); err != nil {
+			return toolError(err.Error())
+		}
+		where := ""
+		if node != "" {
+			where = " of " + node
+		}
+		if packets == 0 {
+			fmt.Fprintf(&b, "No packet%s in the window, %s is empty\n", where, output)
+			continue
+		}
+		fmt.Fprintf(&b, "Kept %d packets%s, from %s to %s, in %s\n", packets, where,
+			first.Local().Format("15:04:05.000"), last.Local().Format("15:04:05.000"), output)
+	}
+	b.WriteString("Pass the slices as file to the capture analysis tools.\n")
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
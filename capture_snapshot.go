@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// controlPlaneCommands are the vtysh commands saved alongside every capture,
+// so each pcap comes with the control-plane state that produced it.
+var controlPlaneCommands = []struct {
+	file    string
+	command string
+}{
+	{"running-config.txt", "show running-config"},
+	{"bgp-summary.json", "show bgp vrf all summary json"},
+	{"routes.json", "show ip route vrf all json"},
+	{"ipv6-routes.json", "show ipv6 route vrf all json"},
+	{"evpn-routes.json", "show bgp l2vpn evpn json"},
+}
+
+// saveControlPlaneSnapshot saves the configuration and routes of every
+// router to <outputDir>/control_plane_<phase>. Routers are queried in
+// parallel; commands that fail are listed in errors.txt rather than failing
+// the snapshot. It returns the snapshot directory and the number of routers
+// saved.
+func saveControlPlaneSnapshot(outputDir, phase string) (string, int, error) {
+	dir := filepath.Join(outputDir, "control_plane_"+phase)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	routers, err := fabricRouters()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var mu sync.Mutex
+	var failures []string
+	var wg sync.WaitGroup
+	for _, router := range routers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, c := range controlPlaneCommands {
+				out, err := runVtysh(router, c.command)
+				if err == nil {
+					err = os.WriteFile(filepath.Join(dir, router+"_"+c.file), out, 0o644)
+				}
+				if err != nil {
+					mu.Lock()
+					failures = append(failures, fmt.Sprintf("%s: %v", router, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		data := strings.Join(failures, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "errors.txt"), []byte(data), 0o644); err != nil {
+			return "", 0, err
+		}
+	}
+	return dir, len(routers), nil
+}
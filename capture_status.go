@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// pcapng interface statistics blocks, which dumpcap writes for every
+// interface when it closes a file, and their options counting the packets
+// the interface received and the kernel dropped, since the capture started.
+const (
+	pcapngISB     = 5
+	isbOptIfRecv  = 4
+	isbOptIfDrop  = 5
+	statsTailSize = 64 * 1024
+)
+
+// capinfosPacketsRe matches the packet count capinfos prints for a file, or
+// the one it read before reaching the end of a file still being written.
+var capinfosPacketsRe = regexp.MustCompile(`Number of packets:\s*(\d+)|after reading (\d+) packets?`)
+
+// nodeCaptureStatus is the progress of a capture on a node.
+type nodeCaptureStatus struct {
+	node string
+	pid  int
+	// health is "capturing", "exited", "no dumpcap" when tshark runs without
+	// its capture child, "finished" once the capture stopped, or why the
+	// node could not be queried.
+	health string
+	files  int
+	// bytes and packets are -1 when unknown.
+	bytes   int64
+	packets int64
+	// received and dropped come from the last closed file, stats tells
+	// whether there was one.
+	received, dropped uint64
+	stats             bool
+}
+
+// tailStats returns the packets received and dropped on the interfaces of a
+// pcapng, from the interface statistics blocks ending the given tail of the
+// file. ok is false when the tail does not end with any, which is the case
+// of a file dumpcap still writes to.
+func tailStats(tail []byte) (received, dropped uint64, ok bool) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		seen := make(map[uint32]bool)
+		for end := len(tail); end >= 24; {
+			n := int(order.Uint32(tail[end-4:]))
+			if n < 24 || n%4 != 0 || n > end {
+				break
+			}
+			block := tail[end-n : end]
+			if order.Uint32(block) != pcapngISB || int(order.Uint32(block[4:])) != n {
+				break
+			}
+			end -= n
+			// Walking backwards, the first block of an interface is its
+			// latest.
+			if id := order.Uint32(block[8:]); !seen[id] {
+				seen[id] = true
+				for opts := block[20 : n-4]; len(opts) >= 4; {
+					code, length := order.Uint16(opts), int(order.Uint16(opts[2:]))
+					padded := (length + 3) &^ 3
+					if code == 0 || 4+padded > len(opts) {
+						break
+					}
+					if length == 8 && code == isbOptIfRecv {
+						received += order.Uint64(opts[4:])
+					}
+					if length == 8 && code == isbOptIfDrop {
+						dropped += order.Uint64(opts[4:])
+					}
+					opts = opts[4+padded:]
+				}
+			}
+		}
+		if len(seen) > 0 {
+			return received, dropped, true
+		}
+	}
+	return 0, 0, false
+}
+
+// fileTailStats reads the interface statistics ending a local pcapng.
+func fileTailStats(path string) (received, dropped uint64, ok bool) {
+	if isEncryptedCapture(path) {
+		return 0, 0, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, false
+	}
+	tail := make([]byte, min(info.Size(), statsTailSize))
+	if _, err := f.ReadAt(tail, info.Size()-int64(len(tail))); err != nil && err != io.EOF {
+		return 0, 0, false
+	}
+	return tailStats(tail)
+}
+
+// probeRunningCapture queries a node for the tshark of a running capture:
+// its process state and children, and the size and packet count of every
+// file it wrote so far. The tshark of the host is queried locally.
+func probeRunningCapture(st *captureStatus, node string) nodeCaptureStatus {
+	ns := nodeCaptureStatus{node: node, pid: st.PIDs[node], bytes: -1, packets: -1}
+	dir, shell := "/", []string{"docker", "exec", node, "sh", "-c"}
+	if node == hostCaptureNode {
+		dir, shell = st.OutputDir+"/", []string{"sh", "-c"}
+	}
+	// The directory and file names are quoted, the glob of the rotated files
+	// is left to expand after them.
+	file := captureFileName(st.nodeFilter(node), node)
+	glob := strings.TrimPrefix(rotatedFileGlob(st.nodeFilter(node), node), strings.TrimSuffix(file, ".pcapng"))
+	script := fmt.Sprintf(`pid=%d
+state=$(awk '/^State:/{print $2}' /proc/$pid/status 2>/dev/null)
+echo "state ${state:-gone}"
+for c in $(cat /proc/$pid/task/*/children 2>/dev/null); do echo "child $(cat /proc/$c/comm 2>/dev/null)"; done
+for f in %s %s%s; do
+  [ -e "$f" ] || continue
+  echo "file $(stat -c %%s "$f") $f"
+  echo "packets $(capinfos -M -c "$f" 2>&1 | tr '\n' ' ')"
+done`, ns.pid, shellQuote(dir+file), shellQuote(dir+strings.TrimSuffix(file, ".pcapng")), glob)
+	out, err := exec.Command(shell[0], append(shell[1:], script)...).Output()
+	if err != nil {
+		ns.health = fmt.Sprintf("unreachable: %v", err)
+		return ns
+	}
+
+	var state string
+	var dumpcap bool
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		kind, rest, _ := strings.Cut(line, " ")
+		switch kind {
+		case "state":
+			state = rest
+		case "child":
+			dumpcap = dumpcap || rest == "dumpcap"
+		case "file":
+			size, path, _ := strings.Cut(rest, " ")
+			if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+				ns.bytes = max(ns.bytes, 0) + n
+				files = append(files, path)
+			}
+		case "packets":
+			if m := capinfosPacketsRe.FindStringSubmatch(rest); m != nil {
+				n, _ := strconv.ParseInt(m[1]+m[2], 10, 64)
+				ns.packets = max(ns.packets, 0) + n
+			}
+		}
+	}
+	ns.files = len(files)
+	switch {
+	case ns.pid == 0:
+		ns.health = "unknown PID"
+	case state == "gone" || state == "Z":
+		ns.health = "exited"
+	case !dumpcap:
+		ns.health = "no dumpcap"
+	default:
+		ns.health = "capturing"
+	}
+
+	// The counters are cumulative, so the newest closed file has the
+	// latest: every file once tshark exited, the rotated ones but the one
+	// being written otherwise.
+	sort.Strings(files)
+	closed := files
+	if ns.health != "exited" && len(closed) > 0 {
+		closed = closed[:len(closed)-1]
+	}
+	switch {
+	case len(closed) == 0:
+	case node == hostCaptureNode:
+		ns.received, ns.dropped, ns.stats = fileTailStats(closed[len(closed)-1])
+	default:
+		tail, err := exec.Command("docker", "exec", node, "tail", "-c", strconv.Itoa(statsTailSize), closed[len(closed)-1]).Output()
+		if err == nil {
+			ns.received, ns.dropped, ns.stats = tailStats(tail)
+		}
+	}
+	return ns
+}
+
+// readFinishedCapture reads the files a finished capture copied out of a
+// node.
+func readFinishedCapture(st *captureStatus, node string) nodeCaptureStatus {
+	ns := nodeCaptureStatus{node: node, pid: st.PIDs[node], health: "finished", bytes: -1, packets: -1}
+	files := capturedFiles(st.OutputDir, st.nodeFilter(node), node)
+	ns.files = len(files)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		ns.bytes = max(ns.bytes, 0) + info.Size()
+		var packets int64
+		if err := readCapture(captureInput{node: node, path: path}, func([]byte, gopacket.CaptureInfo, layers.LinkType) { packets++ }); err == nil {
+			ns.packets = max(ns.packets, 0) + packets
+		}
+	}
+	if len(files) > 0 {
+		ns.received, ns.dropped, ns.stats = fileTailStats(files[len(files)-1])
+	}
+	return ns
+}
+
+func (s *MCPServer) captureStatus(sessionID string, args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var statuses []*captureStatus
+	if captureID, _ := args["capture_id"].(string); captureID != "" {
+		for _, st := range s.captureStatuses("") {
+			if st.CaptureID == captureID {
+				statuses = append(statuses, st)
+			}
+		}
+		if len(statuses) == 0 {
+			return toolError(fmt.Sprintf("No recent capture %s found", captureID))
+		}
+	} else {
+		for _, st := range s.captureStatuses(sessionID) {
+			if st.running {
+				statuses = append(statuses, st)
+			}
+		}
+		if len(statuses) == 0 {
+			return CallToolResult{Content: []ContentItem{{Type: "text", Text: "No active traffic captures found for this session."}}}
+		}
+	}
+
+	results := make([][]nodeCaptureStatus, len(statuses))
+	var wg sync.WaitGroup
+	for i, st := range statuses {
+		results[i] = make([]nodeCaptureStatus, len(st.Nodes))
+		for j, node := range st.Nodes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if st.running {
+					results[i][j] = probeRunningCapture(st, node)
+				} else {
+					results[i][j] = readFinishedCapture(st, node)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	now := time.Now()
+	nodes := newTable("nodes", "capture_id", "node", "health", "pid", "files", "bytes", "bytes_per_second", "packets", "received", "dropped")
+	var b strings.Builder
+	unhealthy := 0
+	for i, st := range statuses {
+		end, state := now, "running"
+		if !st.running {
+			end, state = st.Finished, "finished"
+		}
+		elapsed := end.Sub(st.Started)
+		fmt.Fprintf(&b, "%s (%s for %s, filter %q)\n", st.CaptureID, state, elapsed.Truncate(time.Second), st.Filter)
+		if len(st.Nodes) == 0 {
+			b.WriteString("  nodes: none reported yet\n")
+		}
+		for _, ns := range results[i] {
+			mark := "✓"
+			if ns.health != "capturing" && ns.health != "finished" {
+				mark = "✗"
+				unhealthy++
+			}
+			var pid, bytes, rate, packets, received, dropped any
+			if ns.pid > 0 {
+				pid = ns.pid
+			}
+			size := "size unknown"
+			if ns.bytes >= 0 {
+				bytes = ns.bytes
+				size = fmt.Sprintf("%s in %d file(s)", formatSize(ns.bytes), ns.files)
+				if elapsed >= time.Second {
+					perSecond := int64(float64(ns.bytes) / elapsed.Seconds())
+					rate = perSecond
+					size += fmt.Sprintf(" (%s/s)", formatSize(perSecond))
+				}
+			}
+			count := "packet count unknown"
+			if ns.packets >= 0 {
+				packets = ns.packets
+				count = fmt.Sprintf("%d packets", ns.packets)
+			}
+			drops := "drops not reported yet, dumpcap records them when it closes a file"
+			if !st.running {
+				drops = "no drops recorded"
+			}
+			if ns.stats {
+				received, dropped = ns.received, ns.dropped
+				drops = fmt.Sprintf("%d of %d packets dropped by the kernel", ns.dropped, ns.received)
+				if st.running && ns.health != "exited" {
+					drops += " as of the last closed file"
+				}
+			}
+			fmt.Fprintf(&b, "  %s %s: %s, %s, %s, %s\n", mark, ns.node, ns.health, size, count, drops)
+			nodes.add(st.CaptureID, ns.node, ns.health, pid, ns.files, bytes, rate, packets, received, dropped)
+		}
+	}
+
+	summary := fmt.Sprintf("%d capture(s), %d node(s) not capturing\n\n", len(statuses), unhealthy)
+	var fields record
+	fields.add("captures", len(statuses))
+	fields.add("unhealthy", unhealthy)
+	return formattedResult(format, summary+b.String(), false, fields, nodes)
+}
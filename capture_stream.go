@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultStreamAddress is where the TCP endpoint of a stream listens when
+// the client does not choose: the loopback, on a free port, since the
+// stream carries the traffic of the fabric unauthenticated.
+const defaultStreamAddress = "127.0.0.1:0"
+
+// captureStreamDir holds the named pipes of the streams.
+var captureStreamDir = filepath.Join(captureRoot, ".streams")
+
+// captureStream serves the packets captured on a node, in real time, to
+// Wireshark: on a TCP endpoint, every client getting its own capture, or on
+// a named pipe, read by one client at a time.
+type captureStream struct {
+	ID         string
+	SessionID  string
+	node       string
+	interfaces []string
+	filter     string
+	tool       string
+	// cmd is the capture command writing to stdout, run in the container of
+	// the node for every client.
+	cmd      []string
+	rt       containerRuntime
+	listener net.Listener
+	fifo     string
+	cancel   context.CancelFunc
+	// done is closed once the stream stopped serving and its captures
+	// ended.
+	done    chan struct{}
+	started time.Time
+
+	bytes   atomic.Int64
+	clients atomic.Int32
+	// lastErr is the last error a capture of the stream ended with, guarded
+	// by MCPServer.mu.
+	lastErr string
+}
+
+// countingWriter counts the bytes of a stream written to its client.
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+// streamArgs returns the command capturing on a node to stdout with the
+// tool prepared on it.
+func (r *captureRun) streamArgs(n *nodeCapture) ([]string, error) {
+	switch n.tool {
+	case captureAgentCommand:
+		program, err := r.compileFilter(n.container, n.filter)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.ensureAgent(n.container); err != nil {
+			return nil, err
+		}
+		args := []string{captureAgentPath, captureAgentCommand, "-w", "-", "-f", n.filter}
+		if len(n.interfaces) > 0 {
+			args = append(args, "-i", strings.Join(n.interfaces, ","))
+		}
+		if program != "" {
+			args = append(args, "-bpf", program)
+		}
+		return args, nil
+	case "tcpdump":
+		iface := "any"
+		if len(n.interfaces) == 1 {
+			iface = n.interfaces[0]
+		}
+		args := []string{"tcpdump", "-i", iface, "-n", "-U", "-w", "-"}
+		if n.filter != "" {
+			args = append(args, n.filter)
+		}
+		return args, nil
+	}
+	args := []string{"tshark"}
+	if len(n.interfaces) == 0 {
+		args = append(args, "-i", "any")
+	}
+	for _, iface := range n.interfaces {
+		args = append(args, "-i", iface)
+	}
+	if n.filter != "" {
+		args = append(args, "-f", n.filter)
+	}
+	return append(args, "-F", "pcapng", "-n", "-q", "-w", "-"), nil
+}
+
+// prepareStream picks the tool capturing on a node, installing tshark if
+// needed, and returns the command streaming its packets to stdout, entering
+// the network namespace of the router pod.
+func (r *captureRun) prepareStream(n *nodeCapture) ([]string, error) {
+	if err := r.ensureTshark(n.container); err != nil {
+		if n.tool, err = r.fallbackTool(n, err); err != nil {
+			return nil, err
+		}
+	}
+	args, err := r.streamArgs(n)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := r.netnsPrefix(n)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, args...), nil
+}
+
+// serveClient runs a capture of the stream writing to a client until the
+// client goes away, the capture ends or the stream stops. The capture
+// prints its PID first, to be killed in the container once done, as
+// closing the exec does not stop it.
+func (s *MCPServer) serveClient(ctx context.Context, st *captureStream, w io.Writer) {
+	st.clients.Add(1)
+	var words []string
+	for _, word := range st.cmd {
+		words = append(words, shellQuote(word))
+	}
+	script := "echo $$ >&2; exec " + strings.Join(words, " ")
+	var stderr bytes.Buffer
+	code, err := st.rt.exec(ctx, st.node, []string{"sh", "-c", script}, &countingWriter{w: w, count: &st.bytes}, &stderr)
+
+	pid, message, _ := strings.Cut(stderr.String(), "\n")
+	if _, convErr := strconv.Atoi(strings.TrimSpace(pid)); convErr == nil {
+		killCtx, cancel := context.WithTimeout(context.Background(), captureExecTimeout)
+		st.rt.exec(killCtx, st.node, []string{"kill", strings.TrimSpace(pid)}, nil, nil)
+		cancel()
+	}
+	// The exec fails when the client goes away; only a capture exiting on
+	// its own with an error is reported.
+	if err == nil && code != 0 {
+		lines := strings.Split(strings.TrimSpace(message), "\n")
+		s.mu.Lock()
+		st.lastErr = fmt.Sprintf("%s exited with code %d: %s", st.tool, code, lines[len(lines)-1])
+		s.mu.Unlock()
+	}
+}
+
+// serveTCP serves a capture to every client connecting, until the listener
+// is closed.
+func (s *MCPServer) serveTCP(ctx context.Context, st *captureStream, clients *sync.WaitGroup) {
+	for {
+		conn, err := st.listener.Accept()
+		if err != nil {
+			return
+		}
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			defer conn.Close()
+			clientCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			// The client sends nothing: a read returning tells it went
+			// away, even while no packet is captured.
+			go func() {
+				io.Copy(io.Discard, conn)
+				cancel()
+			}()
+			s.serveClient(clientCtx, st, conn)
+		}()
+	}
+}
+
+// serveFIFO serves a capture to each reader of the named pipe in turn,
+// until the stream stops.
+func (s *MCPServer) serveFIFO(ctx context.Context, st *captureStream) {
+	for {
+		f, err := openFIFOWriter(ctx, st.fifo)
+		if err != nil {
+			return
+		}
+		s.serveClient(ctx, st, f)
+		f.Close()
+	}
+}
+
+func (s *MCPServer) streamCapture(sessionID string, args map[string]any) CallToolResult {
+	glob, _ := args["node"].(string)
+	if glob == "" {
+		return toolError("node is required")
+	}
+	ifaceGlobs, err := stringsArg(args, "interfaces")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	filter, _ := args["capture_filter"].(string)
+	filter, err = profileFilter(args, filter)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	endpoint, _ := args["endpoint"].(string)
+	if endpoint == "" {
+		endpoint = "tcp"
+	}
+	address, _ := args["address"].(string)
+	switch {
+	case endpoint != "tcp" && endpoint != "pipe":
+		return toolError(fmt.Sprintf("invalid endpoint %q, expected tcp or pipe", endpoint))
+	case endpoint == "pipe" && address != "":
+		return toolError("address only applies to the tcp endpoint")
+	case address == "":
+		address = defaultStreamAddress
+	}
+
+	nodes, interfaces, _, err := captureTargets([]string{glob}, ifaceGlobs)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error selecting the node: %v", err))
+	}
+	if len(nodes) != 1 {
+		return toolError(fmt.Sprintf("A stream captures on a single node, and %q matches %s", glob, strings.Join(nodes, ", ")))
+	}
+	node := nodes[0]
+	if len(ifaceGlobs) > 0 && len(interfaces[node]) == 0 {
+		return toolError(fmt.Sprintf("No interface of %s matches %s", node, strings.Join(ifaceGlobs, ", ")))
+	}
+	if filter != "" {
+		if problems := filterProblems(checkCaptureFilters(filter, nodes, interfaces)); len(problems) > 0 {
+			return toolError(fmt.Sprintf("Invalid capture filter %q, no stream started:\n  %s", filter, strings.Join(problems, "\n  ")))
+		}
+	}
+
+	rt, err := newDockerAPI()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	run := newCaptureRun(rt, "", filter)
+	n := &nodeCapture{node: node, container: node, interfaces: interfaces[node], filter: filter, tool: "tshark"}
+	cmd, err := run.prepareStream(n)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error preparing the capture on %s: %v", node, err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st := &captureStream{
+		SessionID:  sessionID,
+		node:       node,
+		interfaces: interfaces[node],
+		filter:     filter,
+		tool:       n.tool,
+		cmd:        cmd,
+		rt:         rt,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		started:    time.Now(),
+	}
+	s.mu.Lock()
+	s.nextStream++
+	st.ID = fmt.Sprintf("stream-%d", s.nextStream)
+	s.mu.Unlock()
+
+	if endpoint == "pipe" {
+		st.fifo = filepath.Join(captureStreamDir, st.ID)
+		if err := os.MkdirAll(captureStreamDir, 0o755); err != nil {
+			cancel()
+			return toolError(err.Error())
+		}
+		os.Remove(st.fifo)
+		if err := makeFIFO(st.fifo); err != nil {
+			cancel()
+			return toolError(fmt.Sprintf("Error creating the named pipe: %v", err))
+		}
+		if abs, err := filepath.Abs(st.fifo); err == nil {
+			st.fifo = abs
+		}
+	} else if st.listener, err = net.Listen("tcp", address); err != nil {
+		cancel()
+		return toolError(fmt.Sprintf("Error listening on %s: %v", address, err))
+	}
+
+	s.mu.Lock()
+	s.streams[st.ID] = st
+	s.mu.Unlock()
+	go func() {
+		var clients sync.WaitGroup
+		if st.fifo != "" {
+			s.serveFIFO(ctx, st)
+		} else {
+			s.serveTCP(ctx, st, &clients)
+		}
+		clients.Wait()
+		close(st.done)
+	}()
+
+	var b strings.Builder
+	where := "all its interfaces"
+	if len(st.interfaces) > 0 {
+		where = strings.Join(st.interfaces, ", ")
+	}
+	fmt.Fprintf(&b, "Streaming the packets of %s (%s) with %s", node, where, st.tool)
+	if filter != "" {
+		fmt.Fprintf(&b, ", filter %q", filter)
+	}
+	fmt.Fprintf(&b, " (stream_id: %s).\n", st.ID)
+	if st.fifo != "" {
+		fmt.Fprintf(&b, "Named pipe: %s\n", st.fifo)
+		fmt.Fprintf(&b, "Open it live with: wireshark -k -i %s\n", st.fifo)
+		b.WriteString("The capture starts when a reader opens the pipe, and is served to one reader at a time.\n")
+	} else {
+		addr := st.listener.Addr().String()
+		host, port, _ := net.SplitHostPort(addr)
+		fmt.Fprintf(&b, "TCP endpoint: %s\n", addr)
+		fmt.Fprintf(&b, "Open it live with: wireshark -k -i TCP@%s\n", addr)
+		fmt.Fprintf(&b, "or, with an older Wireshark: nc %s %s | wireshark -k -i -\n", host, port)
+		b.WriteString("Every connection gets its own capture, started when it connects and stopped when it closes.\n")
+	}
+	b.WriteString("The stream is not saved: run start_traffic_capture alongside for files to analyze. Use stop_capture_stream to stop streaming.")
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
+
+// sessionStreams returns the capture streams of a session, or of every
+// session when sessionID is empty.
+func (s *MCPServer) sessionStreams(sessionID string) []*captureStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var streams []*captureStream
+	for _, st := range s.streams {
+		if sessionID == "" || st.SessionID == sessionID {
+			streams = append(streams, st)
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].started.Before(streams[j].started) })
+	return streams
+}
+
+// stopStreams stops serving streams, ends their captures and waits for
+// them to be killed.
+func (s *MCPServer) stopStreams(streams []*captureStream) {
+	for _, st := range streams {
+		st.cancel()
+		if st.listener != nil {
+			st.listener.Close()
+		}
+	}
+	for _, st := range streams {
+		<-st.done
+		if st.fifo != "" {
+			os.Remove(st.fifo)
+		}
+		s.mu.Lock()
+		delete(s.streams, st.ID)
+		s.mu.Unlock()
+	}
+}
+
+func (s *MCPServer) stopCaptureStream(sessionID string, args map[string]any) CallToolResult {
+	var streams []*captureStream
+	if streamID, _ := args["stream_id"].(string); streamID != "" {
+		s.mu.Lock()
+		st, ok := s.streams[streamID]
+		s.mu.Unlock()
+		if !ok {
+			return toolError(fmt.Sprintf("No capture stream %s running", streamID))
+		}
+		streams = []*captureStream{st}
+	} else {
+		streams = s.sessionStreams(sessionID)
+	}
+	if len(streams) == 0 {
+		return CallToolResult{Content: []ContentItem{{Type: "text", Text: "No capture stream running for this session."}}}
+	}
+	s.stopStreams(streams)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stopped %d capture stream(s).\n", len(streams))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range streams {
+		fmt.Fprintf(&b, "\n%s on %s (ran for %s): %d client(s) served, %s streamed\n", st.ID, st.node,
+			time.Since(st.started).Truncate(time.Second), st.clients.Load(), formatSize(st.bytes.Load()))
+		if st.lastErr != "" {
+			fmt.Fprintf(&b, "  last capture error: %s\n", st.lastErr)
+		}
+	}
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
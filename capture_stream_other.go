@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// makeFIFO fails, named pipes being specific to Unix.
+func makeFIFO(path string) error {
+	return fmt.Errorf("named pipes are only available on Unix, stream to a TCP endpoint instead")
+}
+
+func openFIFOWriter(ctx context.Context, path string) (*os.File, error) {
+	return nil, fmt.Errorf("named pipes are only available on Unix")
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// makeFIFO creates the named pipe a stream is written to.
+func makeFIFO(path string) error {
+	return syscall.Mkfifo(path, 0o600)
+}
+
+// openFIFOWriter waits for a reader to open a named pipe, and opens it for
+// writing. Opening it without one fails right away rather than blocking, so
+// the stream can be stopped while nobody reads.
+func openFIFOWriter(ctx context.Context, path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, syscall.ENXIO) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// hostCaptureNode is the node name of the capture on the interfaces of the
+// host running kind and containerlab, whose files tshark writes straight to
+// the output directory.
+const hostCaptureNode = "host"
+
+// defaultCaptureNode reports whether a capture runs on a router when no node
+// is selected: the kind nodes and the spine.
+func defaultCaptureNode(router string) bool {
+	return isKindNode(router) || strings.HasPrefix(strings.TrimPrefix(router, clabContainerPrefix), "spine")
+}
+
+// stringsArg returns a string array argument of a tool call.
+func stringsArg(args map[string]any, name string) ([]string, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", name)
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%s must be an array of strings", name)
+		}
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q in %s", value, name)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// routerInterfaces returns the interface names of a router, in the network
+// namespace the capture runs in.
+func routerInterfaces(router string) ([]string, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "link", "show")
+	if err != nil {
+		return nil, err
+	}
+	var links []struct {
+		Ifname string `json:"ifname"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("parsing links of %s: %w", router, err)
+	}
+	names := make([]string, 0, len(links))
+	for _, l := range links {
+		names = append(names, l.Ifname)
+	}
+	return names, nil
+}
+
+// captureTargets resolves the node and interface globs of a capture to the
+// containers to capture on and, for each, the interfaces to capture on.
+// Nodes default to the kind nodes and the spine; nodes without a matching
+// interface are skipped and returned apart.
+func captureTargets(nodeGlobs, ifaceGlobs []string) (nodes []string, interfaces map[string][]string, skipped []string, err error) {
+	routers, err := fabricRouters()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(nodeGlobs) == 0 {
+		for _, r := range routers {
+			if defaultCaptureNode(r) {
+				nodes = append(nodes, r)
+			}
+		}
+	} else {
+		selected := make(map[string]bool)
+		for _, glob := range nodeGlobs {
+			matched := matchRouters(routers, glob)
+			if len(matched) == 0 {
+				return nil, nil, nil, fmt.Errorf("no node matches %q", glob)
+			}
+			for _, m := range matched {
+				selected[m] = true
+			}
+		}
+		for _, r := range routers {
+			if selected[r] {
+				nodes = append(nodes, r)
+			}
+		}
+	}
+	if len(ifaceGlobs) == 0 {
+		return nodes, nil, nil, nil
+	}
+
+	interfaces = make(map[string][]string)
+	var withInterfaces []string
+	for _, node := range nodes {
+		names, err := routerInterfaces(node)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, name := range names {
+			for _, glob := range ifaceGlobs {
+				if ok, _ := path.Match(glob, name); ok {
+					interfaces[node] = append(interfaces[node], name)
+					break
+				}
+			}
+		}
+		if len(interfaces[node]) == 0 {
+			skipped = append(skipped, node)
+			continue
+		}
+		withInterfaces = append(withInterfaces, node)
+	}
+	if len(withInterfaces) == 0 {
+		return nil, nil, nil, fmt.Errorf("no interface matches %s on the selected nodes", strings.Join(ifaceGlobs, ", "))
+	}
+	return withInterfaces, interfaces, skipped, nil
+}
+
+// vethLink is a veth interface as "ip -j link show type veth" lists it. The
+// peer index is only given when the peer is in another namespace.
+type vethLink struct {
+	Index     int    `json:"ifindex"`
+	Name      string `json:"ifname"`
+	PeerIndex int    `json:"link_index"`
+}
+
+func parseVeths(out []byte, where string) ([]vethLink, error) {
+	var links []vethLink
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("parsing veth interfaces of %s: %w", where, err)
+	}
+	return links, nil
+}
+
+// routerVeths returns the interfaces of the router pod of a kind node that
+// are veth peers of interfaces in the host namespace of the node, the
+// boundary the encapsulated traffic crosses. Each pair is matched by the
+// peer indexes of both ends, indexes being per namespace.
+func routerVeths(node string) ([]string, error) {
+	if !isKindNode(node) {
+		return nil, nil
+	}
+	out, err := exec.Command("docker", "exec", node, "ip", "-j", "link", "show", "type", "veth").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing veth interfaces of %s: %w", node, err)
+	}
+	hostSide, err := parseVeths(out, node)
+	if err != nil {
+		return nil, err
+	}
+	if out, err = runInRouterNetns(node, "ip", "-j", "link", "show", "type", "veth"); err != nil {
+		return nil, err
+	}
+	podSide, err := parseVeths(out, "the router pod of "+node)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range podSide {
+		for _, h := range hostSide {
+			if p.PeerIndex != 0 && p.PeerIndex == h.Index && h.PeerIndex == p.Index {
+				names = append(names, p.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// routerVethTargets restricts the nodes of a capture to the kind nodes whose
+// router pod has veth interfaces to the host namespace, capturing on those.
+// The other nodes, the containerlab ones among them, are returned apart.
+func routerVethTargets(nodes []string) (withVeths []string, interfaces map[string][]string, skipped []string, err error) {
+	interfaces = make(map[string][]string)
+	for _, node := range nodes {
+		names, err := routerVeths(node)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(names) == 0 {
+			skipped = append(skipped, node)
+			continue
+		}
+		interfaces[node] = names
+		withVeths = append(withVeths, node)
+	}
+	if len(withVeths) == 0 {
+		return nil, nil, nil, fmt.Errorf("no router pod with veth interfaces to the host namespace on the selected nodes")
+	}
+	return withVeths, interfaces, skipped, nil
+}
+
+// dockerNetworkBridge returns the bridge of a docker network, such as the
+// kind one, on the host.
+func dockerNetworkBridge(network string) (string, error) {
+	out, err := exec.Command("docker", "network", "inspect", "-f",
+		`{{.Driver}} {{.Id}} {{index .Options "com.docker.network.bridge.name"}}`, network).Output()
+	if err != nil {
+		return "", fmt.Errorf("no docker network %s", network)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 || fields[0] != "bridge" || len(fields[1]) < 12 {
+		return "", fmt.Errorf("docker network %s is not a bridge network", network)
+	}
+	if len(fields) > 2 {
+		return fields[2], nil
+	}
+	return "br-" + fields[1][:12], nil
+}
+
+// hostCaptureInterfaces resolves the host interfaces of a capture, given as
+// names or globs of interfaces of the host, or as docker networks whose
+// bridge is captured on.
+func hostCaptureInterfaces(globs []string) ([]string, error) {
+	links, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("listing host interfaces: %w", err)
+	}
+	var interfaces []string
+	for _, glob := range globs {
+		var matched []string
+		for _, l := range links {
+			if ok, _ := path.Match(glob, l.Name); ok {
+				matched = append(matched, l.Name)
+			}
+		}
+		if len(matched) == 0 {
+			bridge, err := dockerNetworkBridge(glob)
+			if err != nil {
+				return nil, fmt.Errorf("no host interface matches %q, and %v", glob, err)
+			}
+			if _, err := net.InterfaceByName(bridge); err != nil {
+				return nil, fmt.Errorf("bridge %s of docker network %s not found on the host", bridge, glob)
+			}
+			matched = []string{bridge}
+		}
+		for _, name := range matched {
+			if !containsString(interfaces, name) {
+				interfaces = append(interfaces, name)
+			}
+		}
+	}
+	return interfaces, nil
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// fabricVXLAN returns the VTEPs of the fabric, as the originators of its
+// type-3 routes, and the routers each VNI is configured on. Routers that
+// cannot be queried are skipped; an error is returned only if none can.
+func fabricVXLAN() (vteps []string, vnis map[uint32][]string, err error) {
+	routers, err := fabricRouters()
+	if err != nil {
+		return nil, nil, err
+	}
+	vnis = make(map[uint32][]string)
+	var routes []string
+	var lastErr error
+	queried := 0
+	for _, router := range routers {
+		client := frrClient(router)
+		prefixes, err := client.EVPNRoutes("show bgp l2vpn evpn route type multicast")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, p := range prefixes {
+			if strings.HasPrefix(p.Prefix, "[3]") {
+				routes = append(routes, p.Prefix)
+			}
+		}
+
+		configured, err := client.VNIs()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, v := range configured {
+			vnis[v.VNI] = append(vnis[v.VNI], strings.TrimPrefix(router, clabContainerPrefix))
+		}
+		queried++
+	}
+	if queried == 0 && lastErr != nil {
+		return nil, nil, lastErr
+	}
+	for _, on := range vnis {
+		sort.Strings(on)
+	}
+	return originators(routes), vnis, nil
+}
+
+// vxlanFlow is a flow carried in VXLAN, with the VTEPs encapsulating it.
+type vxlanFlow struct {
+	vni                uint32
+	outerSrc, outerDst netip.Addr
+	srcMAC, dstMAC     string
+	innerSrc, innerDst string
+	protocol           string
+}
+
+func (f vxlanFlow) less(o vxlanFlow) bool {
+	return fmt.Sprint(f) < fmt.Sprint(o)
+}
+
+// vxlanHost is a MAC address, and the IP address it sent from if any, seen
+// inside a VNI.
+type vxlanHost struct {
+	vni uint32
+	mac string
+	ip  string
+}
+
+// vxlanSummary is the analysis of the VXLAN traffic of capture files.
+type vxlanSummary struct {
+	packets      counter
+	vxlanPackets counter
+	// noVNIFlag counts the packets whose VXLAN header has the I flag clear.
+	noVNIFlag int
+	vnis      map[uint32]*counter
+	flows     map[vxlanFlow]*counter
+	hosts     map[vxlanHost]*counter
+	// hostVTEPs are the VTEPs each host was seen behind.
+	hostVTEPs map[vxlanHost]map[netip.Addr]bool
+}
+
+func newVXLANSummary() *vxlanSummary {
+	return &vxlanSummary{
+		vnis:      make(map[uint32]*counter),
+		flows:     make(map[vxlanFlow]*counter),
+		hosts:     make(map[vxlanHost]*counter),
+		hostVTEPs: make(map[vxlanHost]map[netip.Addr]bool),
+	}
+}
+
+// add decodes a packet and accounts it if it carries VXLAN. The addresses
+// met before the VXLAN header are the VTEPs, the ones after it the inner
+// flow; the hosts are the inner sources, ARP senders included.
+func (v *vxlanSummary) add(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	v.packets.add(ci.Length)
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	var flow vxlanFlow
+	inVXLAN, innerIP := false, false
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.VXLAN:
+			if !inVXLAN {
+				inVXLAN = true
+				flow.vni = l.VNI
+				if !l.ValidIDFlag {
+					v.noVNIFlag++
+				}
+			}
+			continue
+		case *gopacket.Payload, *gopacket.DecodeFailure:
+			continue
+		}
+		if !inVXLAN {
+			switch l := layer.(type) {
+			case *layers.IPv4:
+				flow.outerSrc, _ = netip.AddrFromSlice(l.SrcIP)
+				flow.outerDst, _ = netip.AddrFromSlice(l.DstIP)
+			case *layers.IPv6:
+				flow.outerSrc, _ = netip.AddrFromSlice(l.SrcIP)
+				flow.outerDst, _ = netip.AddrFromSlice(l.DstIP)
+			}
+			continue
+		}
+		switch l := layer.(type) {
+		case *layers.Ethernet:
+			if flow.srcMAC == "" {
+				flow.srcMAC, flow.dstMAC = l.SrcMAC.String(), l.DstMAC.String()
+			}
+		case *layers.ARP:
+			if flow.innerSrc == "" {
+				flow.innerSrc = arpAddress(l.SourceProtAddress)
+				flow.innerDst = arpAddress(l.DstProtAddress)
+				flow.protocol = "ARP"
+			}
+		case *layers.IPv4:
+			if !innerIP {
+				innerIP = true
+				flow.innerSrc, flow.innerDst = l.SrcIP.String(), l.DstIP.String()
+				flow.protocol = l.Protocol.String()
+			}
+		case *layers.IPv6:
+			if !innerIP {
+				innerIP = true
+				flow.innerSrc, flow.innerDst = l.SrcIP.String(), l.DstIP.String()
+				flow.protocol = l.NextHeader.String()
+			}
+		}
+	}
+	if !inVXLAN {
+		return
+	}
+	flow.outerSrc, flow.outerDst = flow.outerSrc.Unmap(), flow.outerDst.Unmap()
+	length := ci.Length
+	v.vxlanPackets.add(length)
+	count(v.vnis, flow.vni, length)
+	count(v.flows, flow, length)
+	if flow.srcMAC != "" {
+		host := vxlanHost{vni: flow.vni, mac: flow.srcMAC, ip: flow.innerSrc}
+		count(v.hosts, host, length)
+		if v.hostVTEPs[host] == nil {
+			v.hostVTEPs[host] = make(map[netip.Addr]bool)
+		}
+		v.hostVTEPs[host][flow.outerSrc] = true
+	}
+}
+
+// arpAddress renders an ARP protocol address, empty if it is not IPv4.
+func arpAddress(b []byte) string {
+	addr, ok := netip.AddrFromSlice(b)
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
+
+func sortedAddrs(set map[netip.Addr]bool) []string {
+	addrs := make([]netip.Addr, 0, len(set))
+	for a := range set {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+	names := make([]string, len(addrs))
+	for i, a := range addrs {
+		names[i] = a.String()
+	}
+	return names
+}
+
+func (s *MCPServer) analyzeVXLAN(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	top := 10
+	if v, ok := args["top"].(float64); ok && v > 0 {
+		top = int(v)
+	}
+	vniFilter := -1
+	if v, ok := args["vni"].(float64); ok {
+		vniFilter = int(v)
+	}
+	expected, err := stringsArg(args, "vteps")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	for _, v := range expected {
+		if _, err := netip.ParseAddr(v); err != nil {
+			return toolError(fmt.Sprintf("invalid VTEP address %q", v))
+		}
+	}
+
+	inputs, err := s.captureInputs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	summary := newVXLANSummary()
+	for _, in := range inputs {
+		if err := readCapture(in, summary.add); err != nil {
+			return toolError(fmt.Sprintf("Error analyzing capture: %v", err))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d VXLAN packets, %s out of %d packets in %d file(s), %d VNI(s)\n",
+		summary.vxlanPackets.packets, formatSize(int64(summary.vxlanPackets.bytes)), summary.packets.packets, len(inputs), len(summary.vnis))
+
+	// The expected VTEPs default to the ones of the fabric; the configured
+	// VNIs are only known when it can be queried.
+	vteps := expected
+	fabricVTEPs, configured, fabricErr := fabricVXLAN()
+	switch {
+	case len(expected) > 0:
+		fmt.Fprintf(&b, "Expected VTEPs: %s\n", strings.Join(vteps, ", "))
+	case fabricErr != nil:
+		fmt.Fprintf(&b, "Expected VTEPs unknown, pass vteps: could not query the fabric: %v\n", fabricErr)
+	default:
+		vteps = fabricVTEPs
+		fmt.Fprintf(&b, "Expected VTEPs (type-3 route originators of the fabric): %s\n", strings.Join(vteps, ", "))
+	}
+	expectedSet := make(map[netip.Addr]bool)
+	for _, v := range vteps {
+		expectedSet[netip.MustParseAddr(v)] = true
+	}
+
+	var findings []string
+	if summary.noVNIFlag > 0 {
+		findings = append(findings, fmt.Sprintf("%d packet(s) have the VNI flag clear in their VXLAN header", summary.noVNIFlag))
+	}
+
+	vnisTable := newTable("vnis", "vni", "packets", "bytes", "vtep_pairs", "configured_on")
+	hostsTable := newTable("hosts", "vni", "mac", "ip", "vteps", "packets", "bytes")
+	flowsTable := newTable("flows", "vni", "outer_source", "outer_destination", "inner_source_mac", "inner_destination_mac",
+		"inner_source", "inner_destination", "protocol", "packets", "bytes")
+	flows := sortedCounters(summary.flows, vxlanFlow.less)
+	hosts := sortedCounters(summary.hosts, func(a, b vxlanHost) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	for _, vni := range sortedCounters(summary.vnis, func(a, b uint32) bool { return a < b }) {
+		if vniFilter >= 0 && vni != uint32(vniFilter) {
+			continue
+		}
+		c := summary.vnis[vni]
+
+		// Encapsulation: the VTEP pairs and the unexpected addresses.
+		pairs := make(map[string]bool)
+		unexpected := make(map[netip.Addr]int)
+		for flow, fc := range summary.flows {
+			if flow.vni != vni {
+				continue
+			}
+			pairs[fmt.Sprintf("%s -> %s", flow.outerSrc, flow.outerDst)] = true
+			for _, addr := range []netip.Addr{flow.outerSrc, flow.outerDst} {
+				if len(expectedSet) > 0 && !expectedSet[addr] {
+					unexpected[addr] += fc.packets
+				}
+			}
+		}
+		var pairList []string
+		for p := range pairs {
+			pairList = append(pairList, p)
+		}
+		sort.Strings(pairList)
+		var strangers []netip.Addr
+		for addr := range unexpected {
+			strangers = append(strangers, addr)
+		}
+		sort.Slice(strangers, func(i, j int) bool { return strangers[i].Less(strangers[j]) })
+		for _, addr := range strangers {
+			findings = append(findings, fmt.Sprintf("VNI %d: %d packet(s) encapsulated from or to %s, which is not an expected VTEP",
+				vni, unexpected[addr], addr))
+		}
+
+		var configuredOn any
+		line := fmt.Sprintf("\nVNI %d: %d packets %s, VTEPs %s", vni, c.packets, formatSize(int64(c.bytes)), strings.Join(pairList, ", "))
+		if configured != nil {
+			on := configured[vni]
+			configuredOn = append([]string{}, on...)
+			if len(on) == 0 {
+				findings = append(findings, fmt.Sprintf("VNI %d carries traffic but is configured on no router", vni))
+				line += " (configured on no router)"
+			} else {
+				line += fmt.Sprintf(" (configured on %s)", strings.Join(on, ", "))
+			}
+		}
+		b.WriteString(line + "\n")
+		vnisTable.add(vni, c.packets, c.bytes, pairList, configuredOn)
+
+		// Hosts: the MAC/IP pairs, a MAC behind several VTEPs and an IP
+		// used by several MACs.
+		b.WriteString("  Hosts (inner source MAC/IP):\n")
+		macVTEPs := make(map[string]map[netip.Addr]bool)
+		ipMACs := make(map[string][]string)
+		for _, host := range hosts {
+			if host.vni != vni {
+				continue
+			}
+			hc := summary.hosts[host]
+			behind := sortedAddrs(summary.hostVTEPs[host])
+			var ip any
+			if host.ip != "" {
+				ip = host.ip
+				ipMACs[host.ip] = append(ipMACs[host.ip], host.mac)
+			}
+			if macVTEPs[host.mac] == nil {
+				macVTEPs[host.mac] = make(map[netip.Addr]bool)
+			}
+			for a := range summary.hostVTEPs[host] {
+				macVTEPs[host.mac][a] = true
+			}
+			hostsTable.add(vni, host.mac, ip, behind, hc.packets, hc.bytes)
+			fmt.Fprintf(&b, "    %-17s %-39s behind %-31s %8d packets\n", host.mac, host.ip, strings.Join(behind, ", "), hc.packets)
+		}
+		var macs []string
+		for mac := range macVTEPs {
+			macs = append(macs, mac)
+		}
+		sort.Strings(macs)
+		for _, mac := range macs {
+			if len(macVTEPs[mac]) > 1 {
+				findings = append(findings, fmt.Sprintf("VNI %d: MAC %s is seen behind several VTEPs (%s), moved or looped",
+					vni, mac, strings.Join(sortedAddrs(macVTEPs[mac]), ", ")))
+			}
+		}
+		var ips []string
+		for ip := range ipMACs {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			if len(ipMACs[ip]) > 1 {
+				sort.Strings(ipMACs[ip])
+				findings = append(findings, fmt.Sprintf("VNI %d: IP %s is used by several MACs (%s)", vni, ip, strings.Join(ipMACs[ip], ", ")))
+			}
+		}
+
+		b.WriteString("  Top inner flows:\n")
+		shown := 0
+		for _, flow := range flows {
+			if flow.vni != vni {
+				continue
+			}
+			if shown == top {
+				break
+			}
+			shown++
+			fc := summary.flows[flow]
+			var innerSrc, innerDst, protocol any
+			inner := flow.srcMAC + " -> " + flow.dstMAC
+			if flow.innerSrc != "" {
+				innerSrc, innerDst, protocol = flow.innerSrc, flow.innerDst, flow.protocol
+				inner = fmt.Sprintf("%s -> %s %s", flow.innerSrc, flow.innerDst, flow.protocol)
+			}
+			flowsTable.add(vni, flow.outerSrc.String(), flow.outerDst.String(), flow.srcMAC, flow.dstMAC, innerSrc, innerDst, protocol, fc.packets, fc.bytes)
+			fmt.Fprintf(&b, "    [%s -> %s] %s %8d packets %10s\n", flow.outerSrc, flow.outerDst, inner, fc.packets, formatSize(int64(fc.bytes)))
+		}
+	}
+
+	b.WriteString("\n")
+	switch {
+	case len(findings) > 0:
+		b.WriteString("✗ Findings:\n")
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  - %s\n", f)
+		}
+	case len(expectedSet) == 0:
+		b.WriteString("Encapsulation not checked, no expected VTEP known.\n")
+	default:
+		b.WriteString("✓ Every VXLAN packet is encapsulated between expected VTEPs\n")
+	}
+
+	var fields record
+	fields.add("packets", summary.packets.packets)
+	fields.add("vxlan_packets", summary.vxlanPackets.packets)
+	fields.add("vxlan_bytes", summary.vxlanPackets.bytes)
+	fields.add("expected_vteps", vteps)
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, vnisTable, hostsTable, flowsTable)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+const cniConfDir = "/etc/cni/net.d"
+
+type cniIPAM struct {
+	Type   string `json:"type"`
+	Subnet string `json:"subnet"`
+	Range  string `json:"range"`
+	Ranges [][]struct {
+		Subnet string `json:"subnet"`
+	} `json:"ranges"`
+}
+
+// subnets returns the address ranges handed out by host-local and
+// whereabouts style IPAM configurations.
+func (ipam *cniIPAM) subnets() []string {
+	if ipam == nil {
+		return nil
+	}
+	var subnets []string
+	for _, s := range []string{ipam.Subnet, ipam.Range} {
+		if s != "" {
+			subnets = append(subnets, s)
+		}
+	}
+	for _, set := range ipam.Ranges {
+		for _, r := range set {
+			if r.Subnet != "" {
+				subnets = append(subnets, r.Subnet)
+			}
+		}
+	}
+	return subnets
+}
+
+type cniPlugin struct {
+	Type      string   `json:"type"`
+	Master    string   `json:"master"`
+	Device    string   `json:"device"`
+	Bridge    string   `json:"bridge"`
+	IsGateway bool     `json:"isGateway"`
+	IPMasq    bool     `json:"ipMasq"`
+	IPAM      *cniIPAM `json:"ipam"`
+}
+
+// cniNetwork is a network configuration, either a .conflist or a single
+// plugin .conf, which is normalized into a one element chain.
+type cniNetwork struct {
+	Source  string
+	Name    string      `json:"name"`
+	Plugins []cniPlugin `json:"plugins"`
+	Error   string
+}
+
+func parseCNINetwork(source string, data []byte) cniNetwork {
+	network := cniNetwork{Source: source}
+	if err := json.Unmarshal(data, &network); err != nil {
+		network.Error = err.Error()
+		return network
+	}
+	network.Source = source
+	if len(network.Plugins) == 0 {
+		var single cniPlugin
+		if err := json.Unmarshal(data, &single); err == nil && single.Type != "" {
+			network.Plugins = []cniPlugin{single}
+		}
+	}
+	return network
+}
+
+func (n *cniNetwork) chain() string {
+	var types []string
+	for _, p := range n.Plugins {
+		types = append(types, p.Type)
+	}
+	return strings.Join(types, " → ")
+}
+
+// readNodeCNIConfigs returns the CNI network configurations of a kind node in
+// the order the container runtime considers them: the lexicographically
+// first one is the default network.
+func readNodeCNIConfigs(node string) ([]cniNetwork, error) {
+	out, err := exec.Command("docker", "exec", node, "ls", "-1", cniConfDir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", cniConfDir, err)
+	}
+
+	var files []string
+	for _, f := range strings.Fields(string(out)) {
+		switch path.Ext(f) {
+		case ".conf", ".conflist", ".json":
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+
+	var networks []cniNetwork
+	for _, f := range files {
+		full := path.Join(cniConfDir, f)
+		data, err := exec.Command("docker", "exec", node, "cat", full).Output()
+		if err != nil {
+			networks = append(networks, cniNetwork{Source: full, Error: err.Error()})
+			continue
+		}
+		networks = append(networks, parseCNINetwork(full, data))
+	}
+	return networks, nil
+}
+
+type networkAttachmentDefinition struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Config string `json:"config"`
+	} `json:"spec"`
+}
+
+type underlay struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Nics []string `json:"nics"`
+	} `json:"spec"`
+}
+
+// underlayNics returns the interfaces openperouter moves into the router pod
+// namespace, as declared by the Underlay resources of the cluster.
+func underlayNics(cluster string) []string {
+	var underlays struct {
+		Items []underlay `json:"items"`
+	}
+	if err := kubectlGetJSON(cluster, &underlays, "underlays.openpe.openperouter.github.io", "-A"); err != nil {
+		return nil
+	}
+	var nics []string
+	for _, u := range underlays.Items {
+		nics = append(nics, u.Spec.Nics...)
+	}
+	return nics
+}
+
+type ipamUse struct {
+	owner  string
+	subnet *net.IPNet
+}
+
+// cniFindings flags the configurations known to conflict with the way
+// openperouter manages interfaces on the node.
+func cniFindings(networks []cniNetwork, nics []string) []string {
+	var findings []string
+
+	multusIndex := -1
+	for i, n := range networks {
+		if n.Error != "" {
+			findings = append(findings, fmt.Sprintf("%s is not valid JSON (%s); the runtime may skip it or fail pod creation", n.Source, n.Error))
+			continue
+		}
+		for _, p := range n.Plugins {
+			if p.Type == "multus" || p.Type == "multus-shim" {
+				if multusIndex < 0 {
+					multusIndex = i
+				}
+			}
+		}
+	}
+	firstValid := -1
+	for i, n := range networks {
+		if n.Error == "" && len(n.Plugins) > 0 {
+			firstValid = i
+			break
+		}
+	}
+	switch {
+	case multusIndex < 0:
+		findings = append(findings, "No Multus configuration found: pods cannot get secondary interfaces on openperouter networks")
+	case multusIndex != firstValid:
+		findings = append(findings, fmt.Sprintf("Multus (%s) is not the default network, %s sorts first: secondary networks will not be attached", networks[multusIndex].Source, networks[firstValid].Source))
+	}
+
+	var uses []ipamUse
+	for _, n := range networks {
+		for _, p := range n.Plugins {
+			for _, nic := range nics {
+				if p.Master == nic || p.Device == nic {
+					findings = append(findings, fmt.Sprintf("%s: %s plugin uses %s, which openperouter moves into the router pod as underlay interface", n.Source, p.Type, nic))
+				}
+			}
+			if p.Type == "bridge" && strings.HasPrefix(p.Bridge, "br-hs-") && (p.IsGateway || p.IPMasq) {
+				findings = append(findings, fmt.Sprintf("%s: bridge plugin sets isGateway/ipMasq on %s, competing with the openperouter L2VNI gateway", n.Source, p.Bridge))
+			}
+			for _, subnet := range p.IPAM.subnets() {
+				if _, ipnet, err := net.ParseCIDR(subnet); err == nil {
+					uses = append(uses, ipamUse{owner: n.Source, subnet: ipnet})
+				}
+			}
+		}
+	}
+	for i := range uses {
+		for j := i + 1; j < len(uses); j++ {
+			a, b := uses[i], uses[j]
+			if a.owner != b.owner && (a.subnet.Contains(b.subnet.IP) || b.subnet.Contains(a.subnet.IP)) {
+				findings = append(findings, fmt.Sprintf("IPAM range %s of %s overlaps %s of %s", a.subnet, a.owner, b.subnet, b.owner))
+			}
+		}
+	}
+	return findings
+}
+
+func (s *MCPServer) inspectCNIChain(args map[string]any) CallToolResult {
+	cluster, _ := args["cluster"].(string)
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	nodes, err := kindNodes(cluster)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(nodes) == 0 {
+		return toolError("No kind nodes found")
+	}
+
+	nicsByCluster := make(map[string][]string)
+	nadsByCluster := make(map[string][]cniNetwork)
+	var b strings.Builder
+	var errs []string
+	networkTable := newTable("networks", "node", "cluster", "source", "name", "chain", "default", "ipam", "error")
+	findingTable := newTable("findings", "node", "cluster", "finding")
+	for _, node := range nodes {
+		if _, ok := nicsByCluster[node.Cluster]; !ok {
+			nicsByCluster[node.Cluster] = underlayNics(node.Cluster)
+
+			var nads struct {
+				Items []networkAttachmentDefinition `json:"items"`
+			}
+			if err := kubectlGetJSON(node.Cluster, &nads, "network-attachment-definitions.k8s.cni.cncf.io", "-A"); err == nil {
+				for _, nad := range nads.Items {
+					source := fmt.Sprintf("NetworkAttachmentDefinition %s/%s", nad.Metadata.Namespace, nad.Metadata.Name)
+					nadsByCluster[node.Cluster] = append(nadsByCluster[node.Cluster], parseCNINetwork(source, []byte(nad.Spec.Config)))
+				}
+			}
+		}
+
+		fmt.Fprintf(&b, "=== %s (cluster %s) ===\n", node.Name, node.Cluster)
+		networks, err := readNodeCNIConfigs(node.Name)
+		if err != nil {
+			fmt.Fprintf(&b, "  ✗ %v\n\n", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", node.Name, err))
+			continue
+		}
+		for i, n := range networks {
+			marker := "  "
+			if i == 0 {
+				marker = "* "
+			}
+			if n.Error != "" {
+				fmt.Fprintf(&b, "%s%s: invalid (%s)\n", marker, n.Source, n.Error)
+				networkTable.add(node.Name, node.Cluster, n.Source, n.Name, "", i == 0, []string{}, n.Error)
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s: network %q, chain %s\n", marker, n.Source, n.Name, n.chain())
+			ipam := []string{}
+			for _, p := range n.Plugins {
+				if subnets := p.IPAM.subnets(); len(subnets) > 0 {
+					fmt.Fprintf(&b, "    %s IPAM (%s): %s\n", p.Type, p.IPAM.Type, strings.Join(subnets, ", "))
+					ipam = append(ipam, fmt.Sprintf("%s (%s): %s", p.Type, p.IPAM.Type, strings.Join(subnets, ", ")))
+				}
+			}
+			networkTable.add(node.Name, node.Cluster, n.Source, n.Name, n.chain(), i == 0, ipam, "")
+		}
+		for _, n := range nadsByCluster[node.Cluster] {
+			fmt.Fprintf(&b, "  %s: network %q, chain %s\n", n.Source, n.Name, n.chain())
+			networkTable.add(node.Name, node.Cluster, n.Source, n.Name, n.chain(), false, []string{}, n.Error)
+		}
+
+		all := append(append([]cniNetwork{}, networks...), nadsByCluster[node.Cluster]...)
+		findings := cniFindings(all, nicsByCluster[node.Cluster])
+		if len(findings) == 0 {
+			b.WriteString("  ✓ No known conflicts with openperouter\n")
+		}
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  ⚠ %s\n", f)
+			findingTable.add(node.Name, node.Cluster, f)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("(* marks the default network the container runtime uses)\n")
+
+	var fields record
+	fields.add("errors", errs)
+	return formattedResult(format, b.String(), false, fields, networkTable, findingTable)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that is written as a Go duration string
+// (e.g. "30m") in the config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Config holds the operator-provided server configuration, loaded from the
+// JSON file passed with --config.
+type Config struct {
+	// Instructions is returned to the client in the initialize result so
+	// operators can describe their topology names, namespaces and
+	// conventions to the model.
+	Instructions string `json:"instructions,omitempty"`
+
+	// SessionIdleTimeout is how long an HTTP session may stay without an
+	// open event stream and without requests before it is considered dead.
+	// Captures it left running are then stopped and copied out. Zero
+	// disables the cleanup.
+	SessionIdleTimeout Duration `json:"session_idle_timeout,omitempty"`
+
+	// RouteWatermarks are the expected route counts per VRF/VNI checked by
+	// the check_route_watermarks tool.
+	RouteWatermarks []RouteWatermark `json:"route_watermarks,omitempty"`
+
+	// StateDB is the SQLite file snapshot_state persists the collected
+	// fabric state to, and query_state reads from.
+	StateDB string `json:"state_db,omitempty"`
+
+	// BMPListen is the TCP address the BMP collector accepts router
+	// sessions on (e.g. ":11019"). Empty disables the collector.
+	BMPListen string `json:"bmp_listen,omitempty"`
+
+	// MaxConcurrentTools bounds the tool calls executing at the same time
+	// across all sessions, so a runaway agent cannot overload the lab host.
+	// Zero removes the limit.
+	MaxConcurrentTools int `json:"max_concurrent_tools,omitempty"`
+
+	// ToolQueueTimeout is how long a tool call waits for a free slot before
+	// being rejected as busy. Zero rejects it immediately.
+	ToolQueueTimeout Duration `json:"tool_queue_timeout,omitempty"`
+
+	// BMPRetention is how long BMP route monitoring events are kept in the
+	// state database. Zero keeps them forever.
+	BMPRetention Duration `json:"bmp_retention,omitempty"`
+
+	// TrendInterval is how often the BGP session states, route counts and
+	// probe RTTs are sampled into the state database for query_trends. Zero
+	// disables the background sampling; sample_trends still records on
+	// demand.
+	TrendInterval Duration `json:"trend_interval,omitempty"`
+
+	// TrendRetention is how long trend samples are kept. Zero keeps them
+	// forever.
+	TrendRetention Duration `json:"trend_retention,omitempty"`
+
+	// CaptureRetention is how long the capture directories of the sessions
+	// are kept before the hourly cleanup deletes them. Zero keeps them
+	// forever.
+	CaptureRetention Duration `json:"capture_retention,omitempty"`
+
+	// CaptureMaxTotalMB bounds the disk space of the capture directories,
+	// in MiB: the hourly cleanup deletes the oldest ones until the rest
+	// fits. Zero removes the limit.
+	CaptureMaxTotalMB int64 `json:"capture_max_total_mb,omitempty"`
+
+	// CaptureMaxDiskUsage is the percentage of the host disk holding the
+	// captures, or of the disk of a node tshark writes to, at which the
+	// running captures are stopped, before a full disk takes the topology
+	// down. Zero disables the guard.
+	CaptureMaxDiskUsage int `json:"capture_max_disk_usage_percent"`
+
+	// ObjectStore is the bucket upload_artifacts pushes to, nil when
+	// uploads are disabled.
+	ObjectStore *ObjectStoreConfig `json:"object_store,omitempty"`
+
+	// CaptureEncryptionKey is the base64 X25519 public key the pcaps of the
+	// captures are encrypted to as soon as they are copied out, empty to
+	// keep them in the clear. --generate-capture-key creates a key pair.
+	CaptureEncryptionKey string `json:"capture_encryption_key,omitempty"`
+
+	// TrendProbes are the pings whose RTT and loss are sampled.
+	TrendProbes []TrendProbe `json:"trend_probes,omitempty"`
+
+	// WebUI serves a read-only web page listing sessions, captures,
+	// artifacts and health history on /ui/ of the HTTP transport.
+	WebUI bool `json:"web_ui,omitempty"`
+
+	// WSAllowedOrigins are the browser origins, besides the one of the
+	// WebSocket listener itself, whose pages may open a WebSocket session
+	// (e.g. "https://dashboard.lab:3000").
+	WSAllowedOrigins []string `json:"ws_allowed_origins,omitempty"`
+
+	// VtyshAllowlist are the command prefixes run_vtysh accepts, compared
+	// word by word. Empty disables the tool.
+	VtyshAllowlist []string `json:"vtysh_allowlist,omitempty"`
+
+	// DemoMode rewrites node names, IP addresses and ASNs consistently in
+	// tool outputs, notifications, resources and the web UI, so recorded
+	// sessions can be shown in public talks and docs.
+	DemoMode bool `json:"demo_mode,omitempty"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	config := &Config{
+		SessionIdleTimeout:  Duration{5 * time.Minute},
+		StateDB:             "fabric_state.db",
+		BMPRetention:        Duration{24 * time.Hour},
+		MaxConcurrentTools:  8,
+		ToolQueueTimeout:    Duration{30 * time.Second},
+		TrendRetention:      Duration{90 * 24 * time.Hour},
+		CaptureMaxDiskUsage: 90,
+		VtyshAllowlist:      []string{"show"},
+	}
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	if config.SessionIdleTimeout.Duration < 0 {
+		return nil, fmt.Errorf("session_idle_timeout must not be negative")
+	}
+	if config.MaxConcurrentTools < 0 {
+		return nil, fmt.Errorf("max_concurrent_tools must not be negative")
+	}
+	if config.CaptureRetention.Duration < 0 || config.CaptureMaxTotalMB < 0 {
+		return nil, fmt.Errorf("capture_retention and capture_max_total_mb must not be negative")
+	}
+	if config.CaptureMaxDiskUsage < 0 || config.CaptureMaxDiskUsage > 100 {
+		return nil, fmt.Errorf("capture_max_disk_usage_percent must be between 0 and 100")
+	}
+
+	if config.CaptureEncryptionKey != "" {
+		if _, err := parseCapturePublicKey(config.CaptureEncryptionKey); err != nil {
+			return nil, fmt.Errorf("capture_encryption_key: %w", err)
+		}
+	}
+
+	if config.ObjectStore != nil {
+		if err := config.ObjectStore.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, p := range config.TrendProbes {
+		if p.Router == "" || p.Target == "" {
+			return nil, fmt.Errorf("trend_probes[%d]: router and target are required", i)
+		}
+	}
+
+	for i, prefix := range config.VtyshAllowlist {
+		if strings.TrimSpace(prefix) == "" {
+			return nil, fmt.Errorf("vtysh_allowlist[%d]: empty command prefix", i)
+		}
+	}
+
+	for i, origin := range config.WSAllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("ws_allowed_origins[%d]: %q is not an origin like https://host:port", i, origin)
+		}
+	}
+
+	for i, w := range config.RouteWatermarks {
+		if w.Router == "" || (w.VRF == "") == (w.VNI == 0) {
+			return nil, fmt.Errorf("route_watermarks[%d]: router and exactly one of vrf or vni are required", i)
+		}
+		if w.Max != 0 && w.Max < w.Min {
+			return nil, fmt.Errorf("route_watermarks[%d]: max is lower than min", i)
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configSnapshotPattern matches the directories the extraction tools save
+// configurations to; their timestamp suffix sorts them chronologically.
+const configSnapshotPattern = "network_configs_*"
+
+// defaultDiffContext is the number of unchanged lines shown around changes.
+const defaultDiffContext = 3
+
+// maxDiffCells bounds the size of the table computed to diff two files,
+// beyond which they are only reported as changed.
+const maxDiffCells = 4 << 20
+
+// configSnapshots returns the configuration extraction directories of the
+// working directory, oldest first.
+func configSnapshots() ([]string, error) {
+	matches, err := filepath.Glob(configSnapshotPattern)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			dirs = append(dirs, m)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// diffOp is a line of an edit script: kept (' '), removed ('-') or added
+// ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script turning a into b, from their longest
+// common subsequence, or false when the files are too large to diff.
+func diffLines(a, b []string) ([]diffOp, bool) {
+	// Common head and tail, most of a configuration, are kept as is.
+	head := 0
+	for head < len(a) && head < len(b) && a[head] == b[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(a)-head && tail < len(b)-head && a[len(a)-1-tail] == b[len(b)-1-tail] {
+		tail++
+	}
+	ma, mb := a[head:len(a)-tail], b[head:len(b)-tail]
+	if (len(ma)+1)*(len(mb)+1) > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i][j] is the length of the common subsequence of ma[i:] and mb[j:].
+	lcs := make([][]int32, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, l := range a[:head] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case j == len(mb) || i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mb[j]})
+			j++
+		}
+	}
+	for _, l := range a[len(a)-tail:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops, true
+}
+
+// unifiedDiff renders an edit script as a unified diff with context lines
+// around each change, or returns "" when nothing changed.
+func unifiedDiff(from, to string, ops []diffOp, context int) string {
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+	for c := 0; c < len(changes); {
+		// A hunk spans the changes separated by at most twice the context.
+		start := max(changes[c]-context, 0)
+		end := changes[c]
+		for c < len(changes) && changes[c] <= end+2*context {
+			end = changes[c]
+			c++
+		}
+		end = min(end+context, len(ops)-1)
+
+		// Line numbers of the hunk start, in each file.
+		lineA, lineB := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				lineA++
+			}
+			if op.kind != '-' {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, op := range ops[start : end+1] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		if countA == 0 {
+			lineA--
+		}
+		if countB == 0 {
+			lineB--
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB)
+		for _, op := range ops[start : end+1] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// readConfigLines returns the lines of a configuration file, and whether it
+// exists.
+func readConfigLines(name string) ([]string, bool, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return []string{}, true, nil
+	}
+	return strings.Split(text, "\n"), true, nil
+}
+
+// configNode returns the node a configuration file belongs to, its name
+// without the suffix the extraction tools add.
+func configNode(file string) string {
+	for _, suffix := range []string{"_running-config.txt", "_config.txt", "_frr.conf", ".txt", ".conf"} {
+		if node, ok := strings.CutSuffix(file, suffix); ok {
+			return node
+		}
+	}
+	return file
+}
+
+func (s *MCPServer) diffConfigSnapshots(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	from, _ := args["from"].(string)
+	to, _ := args["to"].(string)
+	glob, _ := args["node"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid node glob %q", glob))
+	}
+	context := defaultDiffContext
+	if v, ok := args["context"].(float64); ok && v >= 0 {
+		context = int(v)
+	}
+
+	// Missing snapshots default to the latest ones: the two latest without
+	// any, the latest against the one given otherwise.
+	snapshots, err := configSnapshots()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	switch {
+	case from == "" && to == "":
+		if len(snapshots) < 2 {
+			return toolError(fmt.Sprintf("at least two %s directories are needed, found %d: run extract_leaf_configs again, or give from and to", configSnapshotPattern, len(snapshots)))
+		}
+		from, to = snapshots[len(snapshots)-2], snapshots[len(snapshots)-1]
+	case to == "" || from == "":
+		if from == "" {
+			from = to
+		}
+		if len(snapshots) == 0 || filepath.Clean(snapshots[len(snapshots)-1]) == filepath.Clean(from) {
+			return toolError(fmt.Sprintf("%s is the latest snapshot: give the snapshot to compare it with", from))
+		}
+		to = snapshots[len(snapshots)-1]
+	}
+	for _, dir := range []string{from, to} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return toolError(fmt.Sprintf("%s is not a configuration snapshot directory", dir))
+		}
+	}
+
+	var files []string
+	for _, dir := range []string{from, to} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return toolError(fmt.Sprintf("Error reading %s: %v", dir, err))
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if glob != "" {
+				if ok, _ := path.Match(glob, configNode(e.Name())); !ok {
+					continue
+				}
+			}
+			if !containsString(files, e.Name()) {
+				files = append(files, e.Name())
+			}
+		}
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return toolError(fmt.Sprintf("no configuration file in %s or %s matches %q", from, to, glob))
+	}
+
+	var b strings.Builder
+	table := newTable("files", "node", "file", "status", "added", "removed", "diff")
+	counts := make(map[string]int)
+	for _, file := range files {
+		a, inFrom, errA := readConfigLines(filepath.Join(from, file))
+		c, inTo, errC := readConfigLines(filepath.Join(to, file))
+		node := configNode(file)
+		if err := errors.Join(errA, errC); err != nil {
+			counts["error"]++
+			fmt.Fprintf(&b, "✗ %s: %v\n", file, err)
+			table.add(node, file, "error", 0, 0, err.Error())
+			continue
+		}
+		status := "unchanged"
+		switch {
+		case !inFrom:
+			status = "added"
+		case !inTo:
+			status = "removed"
+		}
+		ops, ok := diffLines(a, c)
+		if !ok {
+			counts["changed"]++
+			fmt.Fprintf(&b, "\n=== %s: changed, too large to diff ===\n", file)
+			table.add(node, file, "changed", 0, 0, "")
+			continue
+		}
+		added, removed := 0, 0
+		for _, op := range ops {
+			switch op.kind {
+			case '+':
+				added++
+			case '-':
+				removed++
+			}
+		}
+		if status == "unchanged" && added+removed > 0 {
+			status = "changed"
+		}
+		counts[status]++
+		diff := unifiedDiff(filepath.Join(from, file), filepath.Join(to, file), ops, context)
+		table.add(node, file, status, added, removed, diff)
+		if status != "unchanged" {
+			fmt.Fprintf(&b, "\n=== %s: %s, +%d -%d ===\n%s", file, status, added, removed, diff)
+		}
+	}
+
+	summary := fmt.Sprintf("%s → %s: %d file(s) changed, %d added, %d removed, %d unchanged",
+		from, to, counts["changed"], counts["added"], counts["removed"], counts["unchanged"])
+	if counts["error"] > 0 {
+		summary += fmt.Sprintf(", %d unreadable", counts["error"])
+	}
+	text := summary + "\n" + b.String()
+	if counts["changed"]+counts["added"]+counts["removed"] == 0 {
+		text += "✓ No configuration drift\n"
+	}
+
+	var fields record
+	fields.add("from", from)
+	fields.add("to", to)
+	fields.add("changed", counts["changed"])
+	fields.add("added", counts["added"])
+	fields.add("removed", counts["removed"])
+	fields.add("unchanged", counts["unchanged"])
+	return formattedResult(format, text, counts["error"] == len(files), fields, table)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// containerRuntime is the part of the container runtime API the captures
+// are orchestrated with.
+type containerRuntime interface {
+	// runningContainers returns the names of the running containers.
+	runningContainers(ctx context.Context) ([]string, error)
+	// exec runs a command in a container, streaming its output, and returns
+	// its exit code.
+	exec(ctx context.Context, container string, cmd []string, stdout, stderr io.Writer) (int, error)
+	// copyFrom copies a file out of a container to a local path.
+	copyFrom(ctx context.Context, container, path, dst string) error
+	// copyTo copies a local file into a container, as dst with the given
+	// mode.
+	copyTo(ctx context.Context, container, src, dst string, mode int64) error
+}
+
+// defaultDockerHost is the Docker Engine socket used when DOCKER_HOST is
+// not set.
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerAPI talks to the Docker Engine API, on the socket or TCP address of
+// DOCKER_HOST.
+type dockerAPI struct {
+	client *http.Client
+	base   string
+}
+
+func newDockerAPI() (*dockerAPI, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &dockerAPI{client: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &dockerAPI{client: &http.Client{}, base: "http://" + u.Host}, nil
+	}
+	return nil, fmt.Errorf("unsupported DOCKER_HOST %q, expected unix:// or tcp://", host)
+}
+
+// do sends a request to the API with a JSON body, if any.
+func (d *dockerAPI) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	if body == nil {
+		return d.send(ctx, method, path, "", nil)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return d.send(ctx, method, path, "application/json", bytes.NewReader(data))
+}
+
+// send sends a request to the API, failing on error statuses with the
+// message the daemon returned.
+func (d *dockerAPI) send(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, d.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &dockerStatusError{method: method, path: path, status: resp.Status, code: resp.StatusCode, message: apiErr.Message}
+	}
+	return resp, nil
+}
+
+// dockerStatusError is an error status returned by the API.
+type dockerStatusError struct {
+	method, path, status string
+	code                 int
+	message              string
+}
+
+func (e *dockerStatusError) Error() string {
+	return fmt.Sprintf("docker API %s %s: %s: %s", e.method, e.path, e.status, e.message)
+}
+
+// transientDockerError tells whether a call failing with err may succeed
+// when retried: the daemon failing or being unreachable, or the connection
+// dropped during a transfer, rather than a missing container or file.
+func transientDockerError(err error) bool {
+	var status *dockerStatusError
+	if errors.As(err, &status) {
+		return status.code >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func (d *dockerAPI) runningContainers(ctx context.Context) ([]string, error) {
+	resp, err := d.do(ctx, http.MethodGet, "/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var containers []struct {
+		Names []string `json:"Names"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("decoding containers: %w", err)
+	}
+	var names []string
+	for _, c := range containers {
+		for _, name := range c.Names {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+	}
+	return names, nil
+}
+
+func (d *dockerAPI) exec(ctx context.Context, container string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	resp, err := d.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", map[string]any{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          cmd,
+	})
+	if err != nil {
+		return -1, err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		return -1, fmt.Errorf("decoding exec: %w", err)
+	}
+
+	resp, err = d.do(ctx, http.MethodPost, "/exec/"+created.ID+"/start", map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return -1, err
+	}
+	err = demuxStream(resp.Body, stdout, stderr)
+	resp.Body.Close()
+	if err != nil {
+		return -1, err
+	}
+
+	// The stream ends with the command, whose exit code can lag a little.
+	for range 20 {
+		resp, err := d.do(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil)
+		if err != nil {
+			return -1, err
+		}
+		var inspect struct {
+			Running  bool `json:"Running"`
+			ExitCode int  `json:"ExitCode"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&inspect)
+		resp.Body.Close()
+		if err != nil {
+			return -1, fmt.Errorf("decoding exec status: %w", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return -1, fmt.Errorf("%s on %s: still running after its output ended", cmd[0], container)
+}
+
+// demuxStream splits the multiplexed stdout and stderr of an exec without
+// TTY: each frame starts with the stream number and the frame length.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("reading exec output: %w", err)
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if w == nil {
+			w = io.Discard
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return fmt.Errorf("reading exec output: %w", err)
+		}
+	}
+}
+
+func (d *dockerAPI) copyFrom(ctx context.Context, container, path, dst string) error {
+	resp, err := d.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(container)+"/archive?path="+url.QueryEscape(path), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The archive holds the file alone, named after it.
+	tr := tar.NewReader(resp.Body)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in the archive of %s", path, container)
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive of %s: %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return fmt.Errorf("copying %s: %w", path, err)
+		}
+		return f.Close()
+	}
+}
+
+func (d *dockerAPI) copyTo(ctx context.Context, container, src, dst string, mode int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// The archive is streamed as it is written, the file may be large.
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{Name: path.Base(dst), Mode: mode, Size: info.Size(), ModTime: info.ModTime()})
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	resp, err := d.send(ctx, http.MethodPut, "/containers/"+url.PathEscape(container)+"/archive?path="+url.QueryEscape(path.Dir(dst)), "application/x-tar", pr)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// runtimeOutput runs a command in a container and returns its output,
+// failing with its error output when it exits with an error.
+func runtimeOutput(ctx context.Context, rt containerRuntime, container string, cmd ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	code, err := rt.exec(ctx, container, cmd, &stdout, &stderr)
+	if err != nil {
+		return "", err
+	}
+	if code != 0 {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = fmt.Sprintf("exit code %d", code)
+		}
+		return stdout.String(), fmt.Errorf("%s on %s: %s", strings.Join(cmd, " "), container, message)
+	}
+	return stdout.String(), nil
+}
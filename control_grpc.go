@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The gRPC control API is described by api/control.proto. Its messages are
+// google.protobuf.Struct, so the service is declared by hand below instead
+// of being generated.
+
+const (
+	controlServiceName = "openperouter.mcp.v1.Control"
+	// grpcSessionHeader is the metadata key naming the session of a call.
+	grpcSessionHeader = "x-mcp-session"
+	grpcSessionID     = "grpc"
+)
+
+// controlTools maps the dedicated control methods to the tool they run.
+var controlTools = map[string]string{
+	"ExtractLeafConfigs":  "extract_leaf_configs",
+	"StartTrafficCapture": "start_traffic_capture",
+	"StopTrafficCapture":  "stop_traffic_capture",
+}
+
+// controlHandler is the handler type of the control service.
+type controlHandler interface {
+	call(ctx context.Context, method string, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+type controlServer struct {
+	server *MCPServer
+}
+
+func controlMethod(name string) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(structpb.Struct)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req any) (any, error) {
+				return srv.(controlHandler).call(ctx, name, req.(*structpb.Struct))
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + controlServiceName + "/" + name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+var controlServiceDesc = grpc.ServiceDesc{
+	ServiceName: controlServiceName,
+	HandlerType: (*controlHandler)(nil),
+	Methods: []grpc.MethodDesc{
+		controlMethod("ListTools"),
+		controlMethod("CallTool"),
+		controlMethod("ExtractLeafConfigs"),
+		controlMethod("StartTrafficCapture"),
+		controlMethod("StopTrafficCapture"),
+		controlMethod("ListTrafficCaptures"),
+	},
+	Metadata: "api/control.proto",
+}
+
+// toStruct converts a result to a protobuf Struct through its JSON form, so
+// gRPC clients get the same field names as MCP clients.
+func toStruct(v any) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return structpb.NewStruct(m)
+}
+
+// grpcSessionNameRe matches the session names gRPC clients may choose.
+var grpcSessionNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// callSession returns the session a call belongs to, opening it on first
+// use. Clients only name their session within the gRPC namespace: the ID is
+// "grpc", followed by "@" and a digest of the subject of their verified TLS
+// client certificate if any, then by "-" and the name of the
+// grpcSessionHeader metadata if given. A client can thus neither reach the
+// session of another transport nor, with mutual TLS, of another identity.
+func (c *controlServer) callSession(ctx context.Context) (string, error) {
+	sessionID := grpcSessionID
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			sessionID += "@" + sessionLabel(string(info.State.VerifiedChains[0][0].RawSubject))
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(grpcSessionHeader); len(values) > 0 && values[0] != "" {
+			// The name is part of the capture directory.
+			if !grpcSessionNameRe.MatchString(values[0]) {
+				return "", status.Errorf(codes.InvalidArgument, "invalid session %q, only letters, digits, '_', '.' and '-' are allowed", values[0])
+			}
+			sessionID += "-" + values[0]
+		}
+	}
+	switch c.server.sessionTransport(sessionID) {
+	case "closed":
+		c.server.openSession(sessionID, "grpc")
+	case "grpc":
+	default:
+		return "", status.Errorf(codes.PermissionDenied, "session %q belongs to another transport", sessionID)
+	}
+	return sessionID, nil
+}
+
+func (c *controlServer) call(ctx context.Context, method string, req *structpb.Struct) (*structpb.Struct, error) {
+	sessionID, err := c.callSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := req.AsMap()
+
+	var params CallToolParams
+	switch method {
+	case "ListTools":
+		return toStruct(ToolsListResult{Tools: c.server.tools()})
+	case "ListTrafficCaptures":
+		scope := sessionID
+		if all, ok := args["all_sessions"].(bool); ok && all {
+			scope = ""
+		}
+		captures := []map[string]any{}
+		for _, call := range c.server.sessionCaptures(scope) {
+			captures = append(captures, map[string]any{
+				"capture_id": call.CaptureID,
+				"session":    call.SessionID,
+				"output_dir": call.OutputDir,
+			})
+		}
+		return toStruct(map[string]any{"captures": captures})
+	case "CallTool":
+		params.Name, _ = args["name"].(string)
+		params.Arguments, _ = args["arguments"].(map[string]any)
+	default:
+		params.Name = controlTools[method]
+		params.Arguments = args
+	}
+
+	resp := c.server.handleToolCall(sessionID, "grpc:"+method, params)
+	if resp.Error != nil {
+		code := codes.InvalidArgument
+		if resp.Error.Code == errCodeServerBusy {
+			code = codes.ResourceExhausted
+		}
+		return nil, status.Error(code, resp.Error.Message)
+	}
+	return toStruct(resp.Result)
+}
+
+// serveGRPC serves the control API on addr, with the same TLS configuration
+// as the other listeners.
+func serveGRPC(server *MCPServer, addr string, tlsConfig *tls.Config) error {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	grpcServer.RegisterService(&controlServiceDesc, &controlServer{server: server})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "gRPC control API listening on %s\n", addr)
+	return grpcServer.Serve(listener)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// hostDiskUsage is not implemented here: the disk of the host is not
+// checked, the ones of the nodes still are.
+func hostDiskUsage(path string) (diskUsage, error) {
+	return diskUsage{}, errors.ErrUnsupported
+}
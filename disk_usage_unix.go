@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+// hostDiskUsage returns the use of the host filesystem holding path.
+func hostDiskUsage(path string) (diskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return diskUsage{}, err
+	}
+	size := uint64(st.Bsize)
+	return newDiskUsage(path, (st.Blocks-st.Bfree)*size, st.Bavail*size), nil
+}
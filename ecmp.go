@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ecmpProbeBasePort is the first destination port of the probe flows, in the
+// traceroute range so nothing listens on them.
+const ecmpProbeBasePort = 33434
+
+// maxECMPFlows bounds the number of probe flows sent by a single call.
+const maxECMPFlows = 1024
+
+var hashPolicies = map[string]string{
+	"0": "L3 only, flows between the same VTEPs all take the same link",
+	"1": "L4 (5-tuple)",
+	"2": "L3 of the inner packet",
+	"3": "custom fields",
+}
+
+type ipRoute struct {
+	Dst      string `json:"dst"`
+	Dev      string `json:"dev"`
+	Nexthops []struct {
+		Dev string `json:"dev"`
+	} `json:"nexthops"`
+}
+
+func (r *ipRoute) prefixLen() int {
+	if r.Dst == "default" {
+		return 0
+	}
+	if _, n, err := net.ParseCIDR(r.Dst); err == nil {
+		ones, _ := n.Mask.Size()
+		return ones
+	}
+	return 128
+}
+
+// ecmpEgressLinks returns the interfaces of the longest-prefix route from a
+// router to a destination, one per ECMP next hop.
+func ecmpEgressLinks(router, dst string) ([]string, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "route", "show", "match", dst)
+	if err != nil {
+		return nil, err
+	}
+	var routes []ipRoute
+	if err := json.Unmarshal(out, &routes); err != nil {
+		return nil, fmt.Errorf("parsing routes of %s: %w", router, err)
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("%s has no route to %s", router, dst)
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].prefixLen() > routes[j].prefixLen() })
+
+	best := routes[0]
+	var links []string
+	seen := make(map[string]bool)
+	for _, nh := range best.Nexthops {
+		if !seen[nh.Dev] {
+			seen[nh.Dev] = true
+			links = append(links, nh.Dev)
+		}
+	}
+	if len(links) == 0 && best.Dev != "" {
+		links = append(links, best.Dev)
+	}
+	return links, nil
+}
+
+// txPackets returns the transmitted packet counters of a router's
+// interfaces.
+func txPackets(router string) (map[string]uint64, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "-s", "link", "show")
+	if err != nil {
+		return nil, err
+	}
+	var links []struct {
+		Ifname  string `json:"ifname"`
+		Stats64 struct {
+			TX struct {
+				Packets uint64 `json:"packets"`
+			} `json:"tx"`
+		} `json:"stats64"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("parsing link statistics of %s: %w", router, err)
+	}
+	counters := make(map[string]uint64, len(links))
+	for _, l := range links {
+		counters[l.Ifname] = l.Stats64.TX.Packets
+	}
+	return counters, nil
+}
+
+// ecmpHop is a router whose egress links towards the destination are
+// observed.
+type ecmpHop struct {
+	router string
+	policy string
+	links  []string
+	before map[string]uint64
+	after  map[string]uint64
+}
+
+func (s *MCPServer) analyzeECMP(args map[string]any) CallToolResult {
+	source, _ := args["source"].(string)
+	destination, _ := args["destination"].(string)
+	if source == "" || net.ParseIP(destination) == nil {
+		return toolError("source (router) and destination (VTEP IP address) are required")
+	}
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	flows := 64
+	if v, ok := args["flows"].(float64); ok && v > 0 {
+		flows = min(int(v), maxECMPFlows)
+	}
+	packetsPerFlow := 10
+	if v, ok := args["packets_per_flow"].(float64); ok && v > 0 {
+		packetsPerFlow = min(int(v), 100)
+	}
+
+	routers := []string{source}
+	if transit, ok := args["transit"].([]any); ok {
+		for _, t := range transit {
+			if name, ok := t.(string); ok && name != "" {
+				routers = append(routers, name)
+			}
+		}
+	}
+
+	var hops []*ecmpHop
+	for _, r := range routers {
+		links, err := ecmpEgressLinks(r, destination)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		policy, err := runInRouterNetns(r, "sysctl", "-n", "net.ipv4.fib_multipath_hash_policy")
+		if err != nil {
+			return toolError(err.Error())
+		}
+		before, err := txPackets(r)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		hops = append(hops, &ecmpHop{router: r, policy: strings.TrimSpace(string(policy)), links: links, before: before})
+	}
+
+	// Every flow gets its own socket, hence source port, and its own
+	// destination port, so the 5-tuples differ.
+	script := fmt.Sprintf(`for i in $(seq 0 %d); do
+	exec 3>/dev/udp/%s/$((%d + i))
+	for j in $(seq %d); do echo ecmp-probe >&3; done
+	exec 3>&-
+done`, flows-1, destination, ecmpProbeBasePort, packetsPerFlow)
+	if _, err := runInRouterNetns(source, "bash", "-c", script); err != nil {
+		return toolError(fmt.Sprintf("Error sending probe flows: %v", err))
+	}
+
+	for _, hop := range hops {
+		after, err := txPackets(hop.router)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		hop.after = after
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sent %d UDP flows of %d packets from %s to %s\n", flows, packetsPerFlow, source, destination)
+
+	var findings []string
+	links := newTable("links", "router", "hash_policy", "link", "packets", "share_pct", "flows_est")
+	sent := float64(flows * packetsPerFlow)
+	for _, hop := range hops {
+		policy := hashPolicies[hop.policy]
+		if policy == "" {
+			policy = "unknown"
+		}
+		fmt.Fprintf(&b, "\n%s: %d egress link(s) towards %s, fib_multipath_hash_policy=%s (%s)\n",
+			hop.router, len(hop.links), destination, hop.policy, policy)
+
+		deltas := make([]float64, len(hop.links))
+		var total float64
+		for i, l := range hop.links {
+			deltas[i] = float64(hop.after[l] - hop.before[l])
+			total += deltas[i]
+		}
+		for i, l := range hop.links {
+			share := 0.0
+			if total > 0 {
+				share = 100 * deltas[i] / total
+			}
+			flowsEst := int(math.Round(deltas[i] / float64(packetsPerFlow)))
+			fmt.Fprintf(&b, "  %-12s %8.0f packets  %5.1f%%  ~%d flows\n", l, deltas[i], share, flowsEst)
+			links.add(hop.router, hop.policy, l, uint64(deltas[i]), math.Round(share*10)/10, flowsEst)
+		}
+
+		if len(hop.links) < 2 {
+			continue
+		}
+		if hop.policy == "0" {
+			findings = append(findings, fmt.Sprintf("%s hashes on L3 only: all flows between two VTEPs share one link, set net.ipv4.fib_multipath_hash_policy=1", hop.router))
+		}
+		// Transit routers only see the flows the previous hop sent their way.
+		if total < sent/2 && hop.router != source {
+			fmt.Fprintf(&b, "  (only %.0f of %.0f probe packets crossed this router)\n", total, sent)
+		}
+		if total == 0 {
+			continue
+		}
+		fair := total / float64(len(hop.links))
+		var starved []string
+		for i, l := range hop.links {
+			if deltas[i] < fair/2 {
+				starved = append(starved, fmt.Sprintf("%s (%.0f%% of its fair share)", l, 100*deltas[i]/fair))
+			}
+		}
+		if len(starved) > 0 {
+			findings = append(findings, fmt.Sprintf("%s: uneven distribution, under-used links: %s", hop.router, strings.Join(starved, ", ")))
+		}
+	}
+
+	b.WriteString("\n")
+	if len(findings) == 0 {
+		b.WriteString("✓ No hash polarization detected\n")
+	} else {
+		b.WriteString("✗ Possible hash polarization:\n")
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  - %s\n", f)
+		}
+		b.WriteString("Counters include background traffic (BGP, BFD); rerun with more flows to confirm.\n")
+	}
+
+	var fields record
+	fields.add("source", source)
+	fields.add("destination", destination)
+	fields.add("flows", flows)
+	fields.add("packets_per_flow", packetsPerFlow)
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, links)
+}
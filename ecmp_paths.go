@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// bgpDefaultTable returns the unicast BGP paths of the default VRF of a
+// router, by prefix, both address families together.
+func bgpDefaultTable(router string) (map[netip.Prefix][]frr.Path, error) {
+	table := make(map[netip.Prefix][]frr.Path)
+	for _, afi := range []string{"ipv4", "ipv6"} {
+		routes, err := frrClient(router).UnicastRoutes("default", afi)
+		if err != nil {
+			return nil, err
+		}
+		for prefix, paths := range routes {
+			if p, err := netip.ParsePrefix(prefix); err == nil {
+				table[p.Masked()] = paths
+			}
+		}
+	}
+	return table, nil
+}
+
+// longestMatch returns the longest prefix of a set covering an address.
+func longestMatch[V any](set map[netip.Prefix]V, addr netip.Addr) (netip.Prefix, bool) {
+	var best netip.Prefix
+	found := false
+	for p := range set {
+		if p.Contains(addr) && (!found || p.Bits() > best.Bits()) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// kernelMultipath returns the nexthops of the routes of the main table of a
+// router, by prefix. Routes using a nexthop object are expanded with its
+// group, as iproute2 only lists their nexthops in the compatibility mode of
+// the kernel.
+func kernelMultipath(router string) (map[netip.Prefix][]string, error) {
+	routes := make(map[netip.Prefix][]string)
+	groups := make(map[netip.Prefix]int)
+	for _, family := range []string{"-4", "-6"} {
+		out, err := runInRouterNetns(router, "ip", "-j", family, "route", "show", "table", "main")
+		if err != nil {
+			return nil, err
+		}
+		var rs []struct {
+			kernelRoute
+			NHID int `json:"nhid"`
+		}
+		if err := json.Unmarshal(out, &rs); err != nil {
+			return nil, fmt.Errorf("parsing routes of %s: %w", router, err)
+		}
+		for _, r := range rs {
+			dst, ok := fibPrefix(r.Dst, family == "-6")
+			if !ok {
+				continue
+			}
+			p := netip.MustParsePrefix(dst)
+			var nexthops []string
+			for _, nh := range r.Nexthops {
+				nexthops = append(nexthops, nexthopKey(nh.Gateway, nh.Dev))
+			}
+			if len(nexthops) == 0 && (r.Gateway != "" || r.Dev != "") {
+				nexthops = append(nexthops, nexthopKey(r.Gateway, r.Dev))
+			}
+			if len(r.Nexthops) == 0 && r.NHID != 0 {
+				groups[p] = r.NHID
+			}
+			routes[p] = nexthops
+		}
+	}
+	if len(groups) == 0 {
+		return routes, nil
+	}
+
+	out, err := runInRouterNetns(router, "ip", "-j", "nexthop", "show")
+	if err != nil {
+		return nil, err
+	}
+	var objects []struct {
+		ID      int    `json:"id"`
+		Gateway string `json:"gateway"`
+		Dev     string `json:"dev"`
+		Group   []struct {
+			ID int `json:"id"`
+		} `json:"group"`
+	}
+	if err := json.Unmarshal(out, &objects); err != nil {
+		return nil, fmt.Errorf("parsing nexthops of %s: %w", router, err)
+	}
+	byID := make(map[int]int, len(objects))
+	for i, o := range objects {
+		byID[o.ID] = i
+	}
+	for p, id := range groups {
+		i, ok := byID[id]
+		if !ok {
+			continue
+		}
+		members := objects[i].Group
+		if len(members) == 0 {
+			members = append(members, struct {
+				ID int `json:"id"`
+			}{id})
+		}
+		var nexthops []string
+		for _, m := range members {
+			if j, ok := byID[m.ID]; ok {
+				nexthops = append(nexthops, nexthopKey(objects[j].Gateway, objects[j].Dev))
+			}
+		}
+		routes[p] = nexthops
+	}
+	return routes, nil
+}
+
+// ecmpDestination is a destination of a router whose multipath is checked:
+// the loopback of another router, or the next hop of EVPN routes.
+type ecmpDestination struct {
+	prefix netip.Prefix
+	kinds  []string
+	vteps  []string
+}
+
+func (s *MCPServer) checkECMPPaths(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	var only netip.Addr
+	if v, _ := args["destination"].(string); v != "" {
+		if only, err = netip.ParseAddr(v); err != nil {
+			return toolError(fmt.Sprintf("invalid destination %q", v))
+		}
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	table := newTable("destinations", "router", "destination", "kind", "vteps", "expected", "bgp_multipath", "kernel", "kernel_nexthops", "as_paths")
+	checked, degraded, failed := 0, 0, 0
+	var findings []string
+	for _, router := range routers {
+		bgp, err := bgpDefaultTable(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		kernel, err := kernelMultipath(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+
+		// The loopbacks of the other routers are the host routes they
+		// originate; the EVPN next hops are resolved to the route
+		// covering them.
+		destinations := make(map[netip.Prefix]*ecmpDestination)
+		add := func(p netip.Prefix, kind, vtep string) {
+			d, ok := destinations[p]
+			if !ok {
+				d = &ecmpDestination{prefix: p}
+				destinations[p] = d
+			}
+			if !containsString(d.kinds, kind) {
+				d.kinds = append(d.kinds, kind)
+			}
+			if vtep != "" && !containsString(d.vteps, vtep) {
+				d.vteps = append(d.vteps, vtep)
+			}
+		}
+		for p, paths := range bgp {
+			if !p.IsSingleIP() || len(paths) == 0 || localEVPNPeer(paths[0].PeerID) {
+				continue
+			}
+			add(p, "loopback", "")
+		}
+		var lines []string
+		if routes, err := evpnRoutes(router, 0, 0); err == nil {
+			for _, r := range routes {
+				if localEVPNPeer(r.peer) || !r.valid {
+					continue
+				}
+				for _, vtep := range r.vteps {
+					addr, err := netip.ParseAddr(vtep)
+					if err != nil || addr.IsUnspecified() {
+						continue
+					}
+					p, ok := longestMatch(bgp, addr)
+					if !ok {
+						p = netip.PrefixFrom(addr, addr.BitLen())
+					}
+					add(p, "evpn_nexthop", vtep)
+				}
+			}
+		} else {
+			lines = append(lines, fmt.Sprintf("  (EVPN next hops unavailable: %v)", err))
+		}
+
+		prefixes := make([]netip.Prefix, 0, len(destinations))
+		for p := range destinations {
+			if !only.IsValid() || p.Contains(only) {
+				prefixes = append(prefixes, p)
+			}
+		}
+		sort.Slice(prefixes, func(i, j int) bool {
+			if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+				return c < 0
+			}
+			return prefixes[i].Bits() < prefixes[j].Bits()
+		})
+
+		for _, p := range prefixes {
+			d := destinations[p]
+			checked++
+			expected, multipath := 0, 0
+			var asPaths []string
+			for _, bp := range bgp[p] {
+				if !bp.Valid {
+					continue
+				}
+				expected++
+				if bp.Best() || bp.Multipath {
+					multipath++
+				}
+				if !containsString(asPaths, bp.Path) {
+					asPaths = append(asPaths, bp.Path)
+				}
+			}
+			// The kernel route is the one the destination resolves
+			// through, which may be shorter than the BGP one.
+			var nexthops []string
+			if kp, ok := longestMatch(kernel, p.Addr()); ok {
+				nexthops = kernel[kp]
+			}
+			sort.Strings(d.vteps)
+			table.add(router, p.String(), d.kinds, d.vteps, expected, multipath, len(nexthops), nexthops, asPaths)
+
+			var problems []string
+			switch {
+			case expected == 0:
+				problems = append(problems, "no BGP route")
+			case multipath < expected && len(asPaths) > 1:
+				problems = append(problems, fmt.Sprintf("bgpd uses %d of %d paths, whose AS paths differ (%s): configure 'bgp bestpath as-path multipath-relax'", multipath, expected, strings.Join(asPaths, " | ")))
+			case multipath < expected:
+				problems = append(problems, fmt.Sprintf("bgpd uses %d of %d paths: raise 'maximum-paths'", multipath, expected))
+			}
+			switch {
+			case len(nexthops) == 0:
+				problems = append(problems, "no kernel route")
+			case multipath > 0 && len(nexthops) < multipath:
+				problems = append(problems, fmt.Sprintf("the kernel has %d of the %d nexthops of bgpd", len(nexthops), multipath))
+			}
+			mark := "✓"
+			if len(problems) > 0 {
+				mark = "✗"
+				degraded++
+				for _, problem := range problems {
+					findings = append(findings, fmt.Sprintf("%s %s: %s", router, p, problem))
+				}
+			}
+			line := fmt.Sprintf("  %s %-20s %d expected, %d in bgpd, %d in the kernel", mark, p, expected, multipath, len(nexthops))
+			if len(nexthops) > 0 {
+				line += " (" + strings.Join(nexthops, ", ") + ")"
+			}
+			line += " [" + strings.Join(d.kinds, ", ") + "]"
+			lines = append(lines, line)
+		}
+		if len(prefixes) == 0 {
+			lines = append(lines, "  no destination")
+		}
+		fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+	}
+
+	summary := fmt.Sprintf("%d destination(s) checked on %d router(s), %d without full multipath", checked, len(routers)-failed, degraded)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("destinations", checked)
+	fields.add("degraded", degraded)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
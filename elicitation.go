@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// elicitationProtocolVersion is the protocol version adding elicitation,
+// spoken with the clients asking for it.
+const elicitationProtocolVersion = "2025-06-18"
+
+// elicitationTimeout bounds how long a tool waits for the user to answer an
+// elicitation.
+const elicitationTimeout = 5 * time.Minute
+
+// negotiateProtocol returns the protocol version to speak with a client:
+// the one it asked for when the server speaks it, protocolVersion otherwise.
+func negotiateProtocol(requested string) string {
+	if requested == elicitationProtocolVersion {
+		return requested
+	}
+	return protocolVersion
+}
+
+// clientResponse is the response of a client to a request of the server.
+type clientResponse struct {
+	result json.RawMessage
+	err    *RPCError
+}
+
+// isResponse reports whether a message received from the client is the
+// response to a request of the server rather than a request.
+func (req *JSONRPCRequest) isResponse() bool {
+	return req.Method == "" && req.ID != nil && (req.Result != nil || req.Error != nil)
+}
+
+// pendingKey identifies a request of the server to a session.
+func pendingKey(sessionID string, id any) string {
+	return sessionID + " " + requestIDKey(id)
+}
+
+// handleClientResponse hands the response of a client over to the request
+// of the server waiting for it. Responses nothing waits for, such as late
+// ones, are dropped.
+func (s *MCPServer) handleClientResponse(sessionID string, req JSONRPCRequest) {
+	s.mu.Lock()
+	waiting, ok := s.pending[pendingKey(sessionID, req.ID)]
+	delete(s.pending, pendingKey(sessionID, req.ID))
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	waiting <- clientResponse{result: req.Result, err: req.Error}
+}
+
+// cancelPending fails the requests of the server still waiting on the
+// client of a session, whose connection is gone.
+func (s *MCPServer) cancelPending(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, waiting := range s.pending {
+		if strings.HasPrefix(key, sessionID+" ") {
+			// Whoever deletes the key is the only sender.
+			waiting <- clientResponse{err: &RPCError{Code: -32000, Message: "the client disconnected"}}
+			delete(s.pending, key)
+		}
+	}
+}
+
+// request sends a request to the client of a session and waits up to
+// timeout for its response.
+func (s *MCPServer) request(sessionID, method string, params any, timeout time.Duration) (json.RawMessage, error) {
+	s.mu.Lock()
+	var notify func([]byte)
+	if info, ok := s.sessions[sessionID]; ok {
+		notify = info.notify
+	}
+	s.nextRequest++
+	id := fmt.Sprintf("server-%d", s.nextRequest)
+	key := pendingKey(sessionID, id)
+	waiting := make(chan clientResponse, 1)
+	if notify != nil {
+		s.pending[key] = waiting
+	}
+	s.mu.Unlock()
+	if notify == nil {
+		return nil, errors.New("the session cannot receive requests")
+	}
+
+	msg, err := json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID      string `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{"2.0", id, method, params})
+	if err != nil {
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+		return nil, err
+	}
+	if s.demo != nil {
+		msg = []byte(s.demo.text(string(msg)))
+	}
+	notify(msg)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-waiting:
+		if resp.err != nil {
+			return nil, fmt.Errorf("%s failed: %s", method, resp.err.Message)
+		}
+		return resp.result, nil
+	case <-timer.C:
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("no answer to %s within %s", method, timeout)
+	}
+}
+
+// canElicit reports whether the client of a session advertised the
+// elicitation capability.
+func (s *MCPServer) canElicit(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.sessions[sessionID]
+	return ok && info.Elicitation && info.notify != nil
+}
+
+// confirm asks the user of a session to approve an action through an
+// elicitation, and returns the action the user took: "accept", "decline" or
+// "cancel".
+func (s *MCPServer) confirm(sessionID, message string) (string, error) {
+	raw, err := s.request(sessionID, "elicitation/create", map[string]any{
+		"message": message,
+		// Nothing is asked but the approval itself.
+		"requestedSchema": map[string]any{"type": "object", "properties": map[string]any{}},
+	}, elicitationTimeout)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("parsing the elicitation result: %w", err)
+	}
+	return result.Action, nil
+}
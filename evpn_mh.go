@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// zebraES is an Ethernet Segment as seen by zebra, which runs the DF
+// election.
+type zebraES struct {
+	ESI          string   `json:"esi"`
+	AccessPort   string   `json:"accessPort"`
+	Type         []string `json:"type"`
+	DFStatus     string   `json:"dfStatus"`
+	DFPreference int      `json:"dfPreference"`
+	VTEPs        []struct {
+		VTEP         string `json:"vtep"`
+		DFAlgorithm  string `json:"dfAlgorithm"`
+		DFPreference int    `json:"dfPreference"`
+	} `json:"vteps"`
+}
+
+func (es *zebraES) isLocal() bool {
+	return containsString(es.Type, "local")
+}
+
+// bgpES is an Ethernet Segment as seen by bgpd, which flags the
+// inconsistencies between the local and the remote ES configuration.
+type bgpES struct {
+	ESI             string   `json:"esi"`
+	Inconsistencies []string `json:"inconsistencies"`
+}
+
+var (
+	esiRe      = regexp.MustCompile(`[0-9a-f]{2}(?::[0-9a-f]{2}){9}`)
+	evpnIPv4Re = regexp.MustCompile(`\[(\d+\.\d+\.\d+\.\d+)\]`)
+)
+
+// evpnRoutesByESI returns the EVPN routes of a type ("ead" or "es") known to
+// a router, grouped by ESI.
+func evpnRoutesByESI(client *frr.Client, routeType string) (map[string][]string, error) {
+	prefixes, err := client.EVPNRoutes("show bgp l2vpn evpn route type " + routeType)
+	if err != nil {
+		return nil, err
+	}
+	routes := make(map[string][]string)
+	for _, p := range prefixes {
+		if esi := esiRe.FindString(p.Prefix); esi != "" {
+			routes[esi] = append(routes[esi], p.Prefix)
+		}
+	}
+	for esi := range routes {
+		sort.Strings(routes[esi])
+	}
+	return routes, nil
+}
+
+// esRouterState is the multihoming state collected from one router.
+type esRouterState struct {
+	router    string
+	segments  []zebraES
+	bgp       map[string]bgpES
+	eadRoutes map[string][]string
+	esRoutes  map[string][]string
+}
+
+func collectESState(router string) (*esRouterState, error) {
+	client := frrClient(router)
+	segments, err := frr.QueryList[zebraES](client, "show evpn es detail")
+	if err != nil {
+		return nil, err
+	}
+	state := &esRouterState{router: router, segments: segments, bgp: make(map[string]bgpES)}
+
+	bgpSegments, err := frr.QueryList[bgpES](client, "show bgp l2vpn evpn es detail")
+	if err != nil {
+		return nil, err
+	}
+	for _, es := range bgpSegments {
+		state.bgp[es.ESI] = es
+	}
+
+	if state.eadRoutes, err = evpnRoutesByESI(client, "ead"); err != nil {
+		return nil, err
+	}
+	if state.esRoutes, err = evpnRoutesByESI(client, "es"); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// originators returns the originating VTEPs of type-4 routes, the last IP
+// address of the route.
+func originators(routes []string) []string {
+	seen := make(map[string]bool)
+	var ips []string
+	for _, r := range routes {
+		matches := evpnIPv4Re.FindAllStringSubmatch(r, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		ip := matches[len(matches)-1][1]
+		if !seen[ip] {
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func (s *MCPServer) evpnMultihoming(args map[string]any) CallToolResult {
+	router, _ := args["router"].(string)
+	esiFilter, _ := args["esi"].(string)
+	esiFilter = strings.ToLower(esiFilter)
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	var routers []string
+	if router != "" {
+		routers = []string{router}
+	} else {
+		var err error
+		if routers, err = fabricRouters(); err != nil {
+			return toolError(err.Error())
+		}
+	}
+
+	var b strings.Builder
+	var states []*esRouterState
+	var errs []string
+	for _, r := range routers {
+		state, err := collectESState(r)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", r, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", r, err))
+			continue
+		}
+		states = append(states, state)
+	}
+
+	// localOn lists, per ESI, the routers the segment is attached to.
+	localOn := make(map[string][]*esRouterState)
+	localES := make(map[string]map[string]*zebraES)
+	segments := newTable("segments", "router", "esi", "type", "access_port", "df_status", "df_preference", "remote_vteps", "ead_routes", "es_routes", "es_originators")
+	for _, state := range states {
+		var shown int
+		for i := range state.segments {
+			es := &state.segments[i]
+			if esiFilter != "" && es.ESI != esiFilter {
+				continue
+			}
+			if shown == 0 {
+				fmt.Fprintf(&b, "\n=== %s ===\n", state.router)
+			}
+			shown++
+
+			var vteps []string
+			for _, v := range es.VTEPs {
+				vteps = append(vteps, fmt.Sprintf("%s (%s pref %d)", v.VTEP, v.DFAlgorithm, v.DFPreference))
+			}
+			fmt.Fprintf(&b, "ESI %s: %s", es.ESI, strings.Join(es.Type, "+"))
+			if es.isLocal() {
+				fmt.Fprintf(&b, ", access port %s, %s (preference %d)", es.AccessPort, strings.ToUpper(es.DFStatus), es.DFPreference)
+				localOn[es.ESI] = append(localOn[es.ESI], state)
+				if localES[es.ESI] == nil {
+					localES[es.ESI] = make(map[string]*zebraES)
+				}
+				localES[es.ESI][state.router] = es
+			}
+			fmt.Fprintf(&b, "\n  remote VTEPs: %s\n", strings.Join(vteps, ", "))
+			segments.add(state.router, es.ESI, strings.Join(es.Type, "+"), es.AccessPort, es.DFStatus, es.DFPreference,
+				strings.Join(vteps, ", "), len(state.eadRoutes[es.ESI]), len(state.esRoutes[es.ESI]),
+				strings.Join(originators(state.esRoutes[es.ESI]), ", "))
+			fmt.Fprintf(&b, "  routes: %d type-1 (EAD), %d type-4 (ES) from %s\n",
+				len(state.eadRoutes[es.ESI]), len(state.esRoutes[es.ESI]), strings.Join(originators(state.esRoutes[es.ESI]), ", "))
+			for _, r := range state.eadRoutes[es.ESI] {
+				fmt.Fprintf(&b, "    %s\n", r)
+			}
+			for _, r := range state.esRoutes[es.ESI] {
+				fmt.Fprintf(&b, "    %s\n", r)
+			}
+		}
+		if shown == 0 && router != "" {
+			fmt.Fprintf(&b, "\n=== %s ===\nno Ethernet Segments\n", state.router)
+		}
+	}
+
+	// Cross-check the routers sharing each segment.
+	var issues []string
+	esis := make([]string, 0, len(localOn))
+	for esi := range localOn {
+		esis = append(esis, esi)
+	}
+	sort.Strings(esis)
+	for _, esi := range esis {
+		peers := localOn[esi]
+		var dfs []string
+		for _, state := range peers {
+			es := localES[esi][state.router]
+			if es.DFStatus == "df" {
+				dfs = append(dfs, state.router)
+			}
+			if len(es.VTEPs) < len(peers)-1 {
+				issues = append(issues, fmt.Sprintf("ESI %s: %s knows %d remote VTEP(s) but the segment is attached to %d routers - missing type-1/type-4 routes from a peer?",
+					esi, state.router, len(es.VTEPs), len(peers)))
+			}
+			if n := len(originators(state.esRoutes[esi])); n < len(peers) {
+				issues = append(issues, fmt.Sprintf("ESI %s: %s has type-4 routes from %d VTEP(s), expected %d", esi, state.router, n, len(peers)))
+			}
+			if len(state.eadRoutes[esi]) == 0 {
+				issues = append(issues, fmt.Sprintf("ESI %s: %s has no type-1 (EAD) route - aliasing and mass withdrawal will not work", esi, state.router))
+			}
+			for _, inc := range state.bgp[esi].Inconsistencies {
+				issues = append(issues, fmt.Sprintf("ESI %s: bgpd on %s reports inconsistency %q", esi, state.router, inc))
+			}
+		}
+		switch {
+		case len(dfs) == 0:
+			issues = append(issues, fmt.Sprintf("ESI %s: no designated forwarder among %d attached router(s) - BUM traffic to the segment is dropped", esi, len(peers)))
+		case len(dfs) > 1:
+			issues = append(issues, fmt.Sprintf("ESI %s: %d designated forwarders (%s) - BUM traffic is duplicated", esi, len(dfs), strings.Join(dfs, ", ")))
+		}
+	}
+
+	b.WriteString("\nConsistency checks:\n")
+	if len(localOn) == 0 {
+		b.WriteString("  no locally attached Ethernet Segment found\n")
+	} else if len(issues) == 0 {
+		fmt.Fprintf(&b, "  ✓ %d Ethernet Segment(s) consistent across their multihomed peers\n", len(localOn))
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "  ✗ %s\n", issue)
+	}
+
+	var fields record
+	fields.add("errors", errs)
+	fields.add("issues", issues)
+	return formattedResult(format, b.String(), len(issues) > 0, fields, segments)
+}
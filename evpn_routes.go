@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultEVPNRouteLimit bounds the routes returned by get_evpn_routes, when
+// not given.
+const defaultEVPNRouteLimit = 200
+
+// evpnRouteTypes maps the EVPN route types to their vtysh keyword.
+var evpnRouteTypes = map[int]string{
+	1: "ead",
+	2: "macip",
+	3: "multicast",
+	4: "es",
+	5: "prefix",
+}
+
+// evpnFieldRe matches the bracketed fields of an EVPN prefix as printed by
+// FRR, e.g. [2]:[0]:[48]:[aa:bb:cc:dd:ee:ff]:[32]:[10.1.1.2].
+var evpnFieldRe = regexp.MustCompile(`\[([^\]]*)\]`)
+
+// evpnRoute is a path of an EVPN route known to a router, with the fields
+// of its prefix decoded.
+type evpnRoute struct {
+	router string
+	rd     string
+	prefix string
+	typ    int
+	mac    string
+	// ip is the IP of a type-2 route, the originator of a type-3 or type-4
+	// one, and the prefix of a type-5 one.
+	ip          string
+	esi         string
+	vteps       []string
+	rts         []string
+	communities []string
+	asPath      string
+	peer        string
+	best, valid bool
+}
+
+// parseEVPNPrefix decodes the type, MAC, IP and ESI of an EVPN prefix.
+func parseEVPNPrefix(prefix string) (typ int, mac, ip, esi string) {
+	var fields []string
+	for _, m := range evpnFieldRe.FindAllStringSubmatch(prefix, -1) {
+		fields = append(fields, m[1])
+	}
+	if len(fields) == 0 {
+		return 0, "", "", ""
+	}
+	typ, _ = strconv.Atoi(fields[0])
+	for i, f := range fields[1:] {
+		switch {
+		case esiRe.MatchString(f):
+			esi = f
+		case len(f) == 17 && strings.Count(f, ":") == 5:
+			if _, err := net.ParseMAC(f); err == nil {
+				mac = f
+			}
+		default:
+			addr, err := netip.ParseAddr(f)
+			if err != nil {
+				continue
+			}
+			ip = addr.String()
+			// A type-5 prefix is preceded by its length.
+			if typ == 5 && i > 0 {
+				ip += "/" + fields[i]
+			}
+		}
+	}
+	return typ, mac, ip, esi
+}
+
+// evpnRoutes returns the EVPN routes of a router: its whole EVPN table, or
+// the routes of a VNI, optionally of a single type.
+func evpnRoutes(router string, typ, vni int) ([]evpnRoute, error) {
+	command := "show bgp l2vpn evpn route detail"
+	if vni != 0 {
+		command = fmt.Sprintf("show bgp l2vpn evpn route vni %d", vni)
+	}
+	if typ != 0 {
+		command += " type " + evpnRouteTypes[typ]
+	}
+	prefixes, err := frrClient(router).EVPNRoutes(command)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []evpnRoute
+	for _, e := range prefixes {
+		typ, mac, ip, esi := parseEVPNPrefix(e.Prefix)
+		for _, p := range e.Paths {
+			r := evpnRoute{router: router, rd: e.RD, prefix: e.Prefix, typ: typ, mac: mac, ip: ip, esi: esi,
+				best: p.Best(), valid: p.Valid, asPath: p.ASPathString(), peer: p.From()}
+			for _, nh := range p.Nexthops {
+				r.vteps = append(r.vteps, nh.IP)
+			}
+			for _, c := range strings.Fields(p.ExtendedCommunity.String) {
+				if rt, ok := strings.CutPrefix(c, "RT:"); ok {
+					r.rts = append(r.rts, rt)
+				} else {
+					r.communities = append(r.communities, c)
+				}
+			}
+			routes = append(routes, r)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.typ != b.typ {
+			return a.typ < b.typ
+		}
+		if a.prefix != b.prefix {
+			return a.prefix < b.prefix
+		}
+		if a.rd != b.rd {
+			return a.rd < b.rd
+		}
+		return a.best && !b.best
+	})
+	return routes, nil
+}
+
+func (s *MCPServer) getEVPNRoutes(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	typ := 0
+	if v, ok := args["type"].(float64); ok {
+		typ = int(v)
+		if _, ok := evpnRouteTypes[typ]; !ok || v != float64(typ) {
+			return toolError("type must be an EVPN route type, 1 to 5")
+		}
+	}
+	vni := 0
+	if v, ok := args["vni"].(float64); ok {
+		if v < 1 || v >= 1<<24 || v != float64(int(v)) {
+			return toolError("vni must be between 1 and 16777215")
+		}
+		vni = int(v)
+	}
+	if vni != 0 && (typ == 4 || typ == 5) {
+		return toolError(fmt.Sprintf("type-%d routes are not kept per VNI: filter them by prefix instead of vni", typ))
+	}
+	var mac string
+	if v, _ := args["mac"].(string); v != "" {
+		hw, err := net.ParseMAC(v)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid mac %q", v))
+		}
+		mac = hw.String()
+	}
+	var prefix netip.Prefix
+	if v, _ := args["prefix"].(string); v != "" {
+		if prefix, err = parseEndpoint(v); err != nil {
+			return toolError(fmt.Sprintf("invalid prefix %q: expected an address or a prefix", v))
+		}
+	}
+	bestOnly, _ := args["best_only"].(bool)
+	limit := defaultEVPNRouteLimit
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	// matches tells whether the route IP, or a type-5 prefix, is within the
+	// prefix asked for, or contains the address asked for.
+	matches := func(r evpnRoute) bool {
+		if mac != "" && r.mac != mac {
+			return false
+		}
+		if bestOnly && !r.best {
+			return false
+		}
+		if !prefix.IsValid() {
+			return true
+		}
+		if r.ip == "" {
+			return false
+		}
+		routePrefix, err := parseEndpoint(r.ip)
+		if err != nil {
+			return false
+		}
+		return prefix.Contains(routePrefix.Addr()) || (routePrefix.Contains(prefix.Addr()) && prefix.Bits() >= routePrefix.Bits())
+	}
+
+	var b strings.Builder
+	table := newTable("routes", "router", "rd", "type", "prefix", "mac", "ip", "esi", "vteps", "route_targets", "communities", "as_path", "peer", "best", "valid")
+	total, shown, failed := 0, 0, 0
+	for _, router := range routers {
+		routes, err := evpnRoutes(router, typ, vni)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		var lines []string
+		for _, r := range routes {
+			if !matches(r) {
+				continue
+			}
+			total++
+			if shown >= limit {
+				continue
+			}
+			shown++
+			table.add(router, r.rd, r.typ, r.prefix, r.mac, r.ip, r.esi, r.vteps, r.rts, r.communities, r.asPath, r.peer, r.best, r.valid)
+
+			mark := " "
+			if r.best {
+				mark = "*"
+			}
+			if !r.valid {
+				mark = "!"
+			}
+			line := fmt.Sprintf("  %s %s", mark, r.prefix)
+			if r.rd != "" {
+				line += " RD " + r.rd
+			}
+			if len(r.vteps) > 0 {
+				line += " via " + strings.Join(r.vteps, ", ")
+			}
+			if len(r.rts) > 0 {
+				line += " RT " + strings.Join(r.rts, ", ")
+			}
+			if len(r.communities) > 0 {
+				line += " " + strings.Join(r.communities, " ")
+			}
+			if r.asPath != "" {
+				line += " AS path " + r.asPath
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+		}
+	}
+
+	summary := fmt.Sprintf("%d EVPN route path(s) on %d router(s)", total, len(routers)-failed)
+	if shown < total {
+		summary += fmt.Sprintf(", showing the first %d", shown)
+	}
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if total > 0 {
+		text += "\n* best path, ! invalid path\n"
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("total", total)
+	fields.add("shown", shown)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// evpnVNI is a VNI of zebra, as the frr package decodes it.
+type evpnVNI = frr.VNI
+
+// vniRouters returns the routers hosting VNIs: the containerlab leaves and
+// the openperouter router pods, spines only routing the underlay.
+func vniRouters(glob string) ([]string, error) {
+	all, err := fabricRouters()
+	if err != nil {
+		return nil, err
+	}
+	if glob != "" {
+		return matchRouters(all, glob), nil
+	}
+	var routers []string
+	for _, r := range all {
+		if !strings.HasPrefix(strings.TrimPrefix(r, clabContainerPrefix), "spine") {
+			routers = append(routers, r)
+		}
+	}
+	return routers, nil
+}
+
+func (s *MCPServer) getEVPNVNIStatus(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	only := uint32(0)
+	if v, ok := args["vni"].(float64); ok {
+		if v < 1 || v >= 1<<24 || v != float64(int(v)) {
+			return toolError("vni must be between 1 and 16777215")
+		}
+		only = uint32(v)
+	}
+	routers, err := vniRouters(glob)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	// on holds, per VNI, its state on each router that has it.
+	on := make(map[uint32]map[string]*evpnVNI)
+	var queried []string
+	var errs []string
+	for _, router := range routers {
+		vnis, err := frrClient(router).VNIs()
+		if err == nil {
+			for i := range vnis {
+				v := &vnis[i]
+				if only != 0 && v.VNI != only {
+					continue
+				}
+				if on[v.VNI] == nil {
+					on[v.VNI] = make(map[string]*evpnVNI)
+				}
+				on[v.VNI][router] = v
+			}
+			queried = append(queried, router)
+			continue
+		}
+		fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+		errs = append(errs, err.Error())
+	}
+
+	vnis := make([]uint32, 0, len(on))
+	for vni := range on {
+		vnis = append(vnis, vni)
+	}
+	sort.Slice(vnis, func(i, j int) bool { return vnis[i] < vnis[j] })
+
+	table := newTable("vnis", "vni", "router", "type", "vrf", "vtep", "vxlan_interface", "svi", "state", "macs", "arp_nd", "remote_vteps", "l2_vnis")
+	var findings []string
+	for _, vni := range vnis {
+		routersOf := on[vni]
+		fmt.Fprintf(&b, "\n=== VNI %d ===\n", vni)
+		types := make(map[string]bool)
+		vrfs := make(map[string]bool)
+		var missing []string
+		for _, router := range queried {
+			v, ok := routersOf[router]
+			if !ok {
+				missing = append(missing, router)
+				continue
+			}
+			types[v.Type] = true
+			vrfs[v.BoundVRF()] = true
+			remotes := v.Remotes()
+			table.add(vni, router, v.Type, v.BoundVRF(), v.VTEP(), v.Vxlan(), v.SVI(), v.State, v.NumMACs, v.NumARPND, remotes, v.L2VNIs)
+
+			line := fmt.Sprintf("  %-28s %-3s vrf %-12s VTEP %-15s %s/%s", router, v.Type, v.BoundVRF(), v.VTEP(), v.Vxlan(), v.SVI())
+			switch v.Type {
+			case "L3":
+				line += fmt.Sprintf(" %s, router MAC %s", v.State, v.RouterMAC)
+				if len(v.L2VNIs) > 0 {
+					line += fmt.Sprintf(", L2 VNIs %v", v.L2VNIs)
+				}
+				if v.State != "" && v.State != "Up" {
+					findings = append(findings, fmt.Sprintf("L3 VNI %d is %s on %s", vni, v.State, router))
+				}
+			default:
+				line += fmt.Sprintf(" %d MACs, %d ARP/ND, remote VTEPs: %s", v.NumMACs, v.NumARPND, strings.Join(remotes, ", "))
+				if len(remotes) == 0 && len(routersOf) > 1 {
+					findings = append(findings, fmt.Sprintf("L2 VNI %d has no remote VTEP on %s, while %d routers have it: BUM traffic is not flooded to them", vni, router, len(routersOf)))
+				}
+			}
+			b.WriteString(line + "\n")
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(&b, "  missing on %s\n", strings.Join(missing, ", "))
+			findings = append(findings, fmt.Sprintf("VNI %d exists on %d router(s) but not on %s", vni, len(routersOf), strings.Join(missing, ", ")))
+		}
+		if len(types) > 1 {
+			findings = append(findings, fmt.Sprintf("VNI %d is L2 on some routers and L3 on others", vni))
+		}
+		if len(vrfs) > 1 {
+			bound := make([]string, 0, len(vrfs))
+			for vrf := range vrfs {
+				bound = append(bound, vrf)
+			}
+			sort.Strings(bound)
+			findings = append(findings, fmt.Sprintf("VNI %d is bound to different VRFs: %s", vni, strings.Join(bound, ", ")))
+		}
+	}
+
+	summary := fmt.Sprintf("%d VNI(s) on %d router(s)", len(vnis), len(queried))
+	if len(errs) > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", len(errs))
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	} else if len(vnis) > 0 {
+		text += "\n✓ Every VNI exists on every router with the same type and VRF\n"
+	}
+
+	var fields record
+	fields.add("routers", len(queried))
+	fields.add("unreachable_routers", len(errs))
+	fields.add("vni_count", len(vnis))
+	fields.add("findings", findings)
+	return formattedResult(format, text, len(queried) == 0, fields, table)
+}
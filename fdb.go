@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+)
+
+// vxlanDevice is a VXLAN device of a router, and the bridge it is a port of.
+type vxlanDevice struct {
+	vni    uint32
+	bridge string
+}
+
+// vxlanDevices returns the VXLAN devices of a router by name.
+func vxlanDevices(router string) (map[string]vxlanDevice, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "-d", "link", "show", "type", "vxlan")
+	if err != nil {
+		return nil, err
+	}
+	var links []struct {
+		Ifname   string `json:"ifname"`
+		Master   string `json:"master"`
+		Linkinfo struct {
+			InfoData struct {
+				ID uint32 `json:"id"`
+			} `json:"info_data"`
+		} `json:"linkinfo"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("parsing VXLAN devices of %s: %w", router, err)
+	}
+	devices := make(map[string]vxlanDevice, len(links))
+	for _, l := range links {
+		devices[l.Ifname] = vxlanDevice{vni: l.Linkinfo.InfoData.ID, bridge: l.Master}
+	}
+	return devices, nil
+}
+
+// bridgeVLAN is a VLAN of a bridge port, from 'bridge -j vlan show'.
+type bridgeVLAN struct {
+	Vlan    int      `json:"vlan"`
+	VlanEnd int      `json:"vlanEnd"`
+	Flags   []string `json:"flags"`
+}
+
+// bridgeVLANs returns the VLANs of the bridge ports of a router by port,
+// listed as a list or, by older iproute2 versions, as an object.
+func bridgeVLANs(router string) (map[string][]bridgeVLAN, error) {
+	out, err := runInRouterNetns(router, "bridge", "-j", "vlan", "show")
+	if err != nil {
+		return nil, err
+	}
+	vlans := make(map[string][]bridgeVLAN)
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return vlans, nil
+	}
+	var list []struct {
+		Ifname string       `json:"ifname"`
+		Vlans  []bridgeVLAN `json:"vlans"`
+	}
+	if err := json.Unmarshal(out, &list); err == nil {
+		for _, port := range list {
+			vlans[port.Ifname] = append(vlans[port.Ifname], port.Vlans...)
+		}
+		return vlans, nil
+	}
+	if err := json.Unmarshal(out, &vlans); err != nil {
+		return nil, fmt.Errorf("parsing bridge VLANs of %s: %w", router, err)
+	}
+	return vlans, nil
+}
+
+// fdbMAC is a MAC of the forwarding database of a router. The entries the
+// kernel lists for the same MAC, port and VLAN, on the bridge and on the
+// VXLAN device itself, are merged.
+type fdbMAC struct {
+	mac    string
+	dev    string
+	bridge string
+	vlan   int
+	vni    uint32
+	dsts   []string
+	state  string
+	flags  []string
+	// kind is "remote" for MACs learned over VXLAN, "flood" for the
+	// all-zero MAC listing the VTEPs BUM traffic is replicated to, "local"
+	// for MACs learned on the other ports and "permanent" for the MACs of
+	// the router own interfaces.
+	kind string
+}
+
+// segment names the L2 domain of a MAC: its VNI when its bridge has a VXLAN
+// port, its VLAN or bridge otherwise.
+func (m *fdbMAC) segment() string {
+	switch {
+	case m.vni != 0:
+		return fmt.Sprintf("VNI %d", m.vni)
+	case m.vlan != 0:
+		return fmt.Sprintf("VLAN %d", m.vlan)
+	case m.bridge != "":
+		return "bridge " + m.bridge
+	}
+	return "dev " + m.dev
+}
+
+// fdbMACs returns the forwarding database of a router, with the VNI of the
+// bridge of every MAC.
+func fdbMACs(router string) ([]*fdbMAC, error) {
+	devices, err := vxlanDevices(router)
+	if err != nil {
+		return nil, err
+	}
+	vniOf := make(map[string]uint32)
+	for _, d := range devices {
+		if d.bridge != "" {
+			vniOf[d.bridge] = d.vni
+		}
+	}
+
+	out, err := runInRouterNetns(router, "bridge", "-j", "fdb", "show")
+	if err != nil {
+		return nil, err
+	}
+	var entries []fdbEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, fmt.Errorf("parsing FDB of %s: %w", router, err)
+	}
+
+	var macs []*fdbMAC
+	byKey := make(map[string]*fdbMAC)
+	for _, e := range entries {
+		key := fmt.Sprintf("%s|%s|%d", e.MAC, e.IfName, e.Vlan)
+		m, ok := byKey[key]
+		if !ok {
+			m = &fdbMAC{mac: e.MAC, dev: e.IfName, vlan: e.Vlan, state: e.State}
+			byKey[key] = m
+			macs = append(macs, m)
+		}
+		if e.Master != "" {
+			m.bridge = e.Master
+		}
+		if e.Dst != "" && !containsString(m.dsts, e.Dst) {
+			m.dsts = append(m.dsts, e.Dst)
+		}
+		for _, f := range e.Flags {
+			if !containsString(m.flags, f) {
+				m.flags = append(m.flags, f)
+			}
+		}
+	}
+	for _, m := range macs {
+		if d, ok := devices[m.dev]; ok {
+			m.vni = d.vni
+			if m.bridge == "" {
+				m.bridge = d.bridge
+			}
+		} else {
+			m.vni = vniOf[m.bridge]
+		}
+		_, overVXLAN := devices[m.dev]
+		switch {
+		case overVXLAN && m.mac == "00:00:00:00:00:00":
+			m.kind = "flood"
+		case overVXLAN:
+			m.kind = "remote"
+		case m.state == "permanent":
+			m.kind = "permanent"
+		default:
+			m.kind = "local"
+		}
+		sort.Strings(m.dsts)
+	}
+	sort.Slice(macs, func(i, j int) bool {
+		a, b := macs[i], macs[j]
+		if a.vni != b.vni {
+			return a.vni < b.vni
+		}
+		if a.segment() != b.segment() {
+			return a.segment() < b.segment()
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.mac < b.mac
+	})
+	return macs, nil
+}
+
+func (s *MCPServer) getFDB(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	only := uint32(0)
+	if v, ok := args["vni"].(float64); ok {
+		if v < 1 || v >= 1<<24 || v != float64(int(v)) {
+			return toolError("vni must be between 1 and 16777215")
+		}
+		only = uint32(v)
+	}
+	var mac string
+	if v, _ := args["mac"].(string); v != "" {
+		hw, err := net.ParseMAC(v)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid mac %q", v))
+		}
+		mac = hw.String()
+	}
+	remoteOnly, _ := args["remote_only"].(bool)
+	includePermanent, _ := args["include_permanent"].(bool)
+
+	routers, err := vniRouters(glob)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	table := newTable("macs", "router", "segment", "vni", "vlan", "bridge", "mac", "dev", "kind", "dsts", "state", "flags")
+	vlanTable := newTable("vlans", "router", "interface", "vlan", "vlan_end", "flags")
+	var findings []string
+	total, remote, local, failed := 0, 0, 0, 0
+	for _, router := range routers {
+		macs, err := fdbMACs(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		if vlans, err := bridgeVLANs(router); err == nil {
+			ports := make([]string, 0, len(vlans))
+			for port := range vlans {
+				ports = append(ports, port)
+			}
+			sort.Strings(ports)
+			for _, port := range ports {
+				for _, v := range vlans[port] {
+					vlanTable.add(router, port, v.Vlan, v.VlanEnd, v.Flags)
+				}
+			}
+		}
+
+		// kinds holds, per segment and MAC, how the router learned it, to
+		// flag the MACs both local and remote.
+		kinds := make(map[string]map[string]string)
+		var lines []string
+		current := ""
+		for _, m := range macs {
+			switch {
+			case only != 0 && m.vni != only,
+				mac != "" && m.mac != mac,
+				remoteOnly && m.kind != "remote" && m.kind != "flood",
+				!includePermanent && m.kind == "permanent":
+				continue
+			}
+			seg := m.segment()
+			if kinds[seg] == nil {
+				kinds[seg] = make(map[string]string)
+			}
+			if prev, ok := kinds[seg][m.mac]; ok && (prev == "local" && m.kind == "remote" || prev == "remote" && m.kind == "local") {
+				findings = append(findings, fmt.Sprintf("%s on %s is learned both on a local port and over VXLAN in %s", m.mac, router, seg))
+			}
+			kinds[seg][m.mac] = m.kind
+
+			total++
+			switch m.kind {
+			case "remote":
+				remote++
+			case "local":
+				local++
+			}
+			table.add(router, seg, m.vni, m.vlan, m.bridge, m.mac, m.dev, m.kind, m.dsts, m.state, m.flags)
+
+			if seg != current {
+				current = seg
+				header := "  " + seg
+				if m.bridge != "" {
+					header += " (" + m.bridge + ")"
+				}
+				lines = append(lines, header)
+			}
+			var line string
+			switch m.kind {
+			case "flood":
+				line = fmt.Sprintf("    BUM flooded over %s to %s", m.dev, strings.Join(m.dsts, ", "))
+			case "remote":
+				line = fmt.Sprintf("    R %s over %s", m.mac, m.dev)
+				if len(m.dsts) > 0 {
+					line += " via VTEP " + strings.Join(m.dsts, ", ")
+				}
+			case "permanent":
+				line = fmt.Sprintf("    P %s on %s", m.mac, m.dev)
+			default:
+				line = fmt.Sprintf("    L %s on %s", m.mac, m.dev)
+			}
+			if m.vlan != 0 && m.vni != 0 {
+				line += fmt.Sprintf(" vlan %d", m.vlan)
+			}
+			if len(m.flags) > 0 {
+				line += " [" + strings.Join(m.flags, ",") + "]"
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+		}
+	}
+
+	summary := fmt.Sprintf("%d FDB entry(ies) on %d router(s): %d learned over VXLAN, %d on local ports", total, len(routers)-failed, remote, local)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if total > 0 {
+		text += "\nR learned over VXLAN, L learned on a local port, P interface address\n"
+	}
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("total", total)
+	fields.add("remote", remote)
+	fields.add("local", local)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, table, vlanTable)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats are the renderings inspection tools accept in their format
+// argument: text for humans in chat, the others for scripts and documents.
+var outputFormats = []string{"text", "json", "yaml", "markdown-table"}
+
+// formatProperty is the input schema of the format argument.
+var formatProperty = map[string]any{
+	"type":        "string",
+	"enum":        outputFormats,
+	"description": "Rendering of the result: text (default), json, yaml or markdown-table.",
+}
+
+// formatArg returns the format requested by a tool call.
+func formatArg(args map[string]any) (string, error) {
+	format, _ := args["format"].(string)
+	if format == "" {
+		return "text", nil
+	}
+	if !containsString(outputFormats, format) {
+		return "", fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(outputFormats, ", "))
+	}
+	return format, nil
+}
+
+// record is a set of named values marshalled to JSON in order, so
+// structured output keeps the column order of the tables.
+type record struct {
+	names  []string
+	values []any
+}
+
+func (r *record) add(name string, value any) {
+	// Render empty findings as an empty list rather than null.
+	if v, ok := value.([]string); ok && v == nil {
+		value = []string{}
+	}
+	r.names = append(r.names, name)
+	r.values = append(r.values, value)
+}
+
+func (r record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range r.names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// table is tabular data of a tool result. Name is its key in JSON and YAML
+// output.
+type table struct {
+	Name    string
+	Columns []string
+	Rows    [][]any
+}
+
+func newTable(name string, columns ...string) *table {
+	return &table{Name: name, Columns: columns}
+}
+
+func (t *table) add(values ...any) {
+	t.Rows = append(t.Rows, values)
+}
+
+func (t *table) records() []record {
+	records := make([]record, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		records = append(records, record{names: t.Columns, values: row})
+	}
+	return records
+}
+
+func markdownCell(v any) string {
+	if v == nil {
+		return ""
+	}
+	s := fmt.Sprint(v)
+	if items, ok := v.([]string); ok {
+		s = strings.Join(items, "\n")
+	}
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func (t *table) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n\n", t.Name)
+	if len(t.Rows) == 0 {
+		b.WriteString("_none_\n")
+		return b.String()
+	}
+	b.WriteString("| " + strings.Join(t.Columns, " | ") + " |\n")
+	b.WriteString(strings.Repeat("|---", len(t.Columns)) + "|\n")
+	for _, row := range t.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = markdownCell(v)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return b.String()
+}
+
+// jsonToYAML converts JSON to block-style YAML, keeping the key order.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the flow style inherited from the JSON input.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// structuredProtocolVersion is the protocol version adding the
+// structuredContent of tool results, along with elicitation.
+const structuredProtocolVersion = elicitationProtocolVersion
+
+// formattedResult renders the result of an inspection tool. text is the
+// text rendering; fields (scalars or string lists such as findings) and
+// tables make up the structured renderings, also returned as the
+// structuredContent of the result whatever the format.
+func formattedResult(format, text string, isError bool, fields record, tables ...*table) CallToolResult {
+	doc := fields
+	for _, t := range tables {
+		doc.add(t.Name, t.records())
+	}
+	var out string
+	switch format {
+	case "json", "yaml":
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err == nil && format == "yaml" {
+			data, err = jsonToYAML(data)
+		}
+		if err != nil {
+			return toolError(fmt.Sprintf("Error rendering %s: %v", format, err))
+		}
+		out = string(data)
+	case "markdown-table":
+		var b strings.Builder
+		for i, name := range fields.names {
+			if items, ok := fields.values[i].([]string); ok {
+				fmt.Fprintf(&b, "**%s**\n\n", name)
+				if len(items) == 0 {
+					b.WriteString("_none_\n")
+				}
+				for _, item := range items {
+					fmt.Fprintf(&b, "- %s\n", item)
+				}
+				b.WriteString("\n")
+				continue
+			}
+			fmt.Fprintf(&b, "**%s**: %v\n\n", name, fields.values[i])
+		}
+		for _, t := range tables {
+			b.WriteString(t.markdown() + "\n")
+		}
+		out = b.String()
+	default:
+		out = text
+	}
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: out}}, StructuredContent: doc, IsError: isError}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// routerContainer maps a router name as given by the user ("leafA",
+// "spine" or a full container name) to its container name.
+func routerContainer(router string) string {
+	if strings.HasPrefix(router, "clab-") || isKindNode(router) {
+		return router
+	}
+	return clabContainerPrefix + router
+}
+
+// frrContainerID returns the ID of the FRR container of the openperouter
+// router pod running on a kind node.
+func frrContainerID(node string) (string, error) {
+	ids, err := exec.Command("docker", "exec", node, "crictl", "ps", "--name", "^frr$", "-q").Output()
+	if err != nil {
+		return "", fmt.Errorf("listing FRR containers on %s: %w", node, err)
+	}
+	id := strings.TrimSpace(strings.SplitN(string(ids), "\n", 2)[0])
+	if id == "" {
+		return "", fmt.Errorf("no FRR container found on %s", node)
+	}
+	return id, nil
+}
+
+// frrCommand returns the command running args where FRR runs: directly in
+// containerlab routers, in the FRR container of the openperouter router pod
+// on kind nodes. Interactive commands read their standard input.
+func frrCommand(router string, interactive bool, args ...string) (*exec.Cmd, error) {
+	container := routerContainer(router)
+	cmdArgs := []string{"exec"}
+	if interactive {
+		cmdArgs = append(cmdArgs, "-i")
+	}
+	cmdArgs = append(cmdArgs, container)
+	if isKindNode(container) {
+		id, err := frrContainerID(container)
+		if err != nil {
+			return nil, err
+		}
+		cmdArgs = append(cmdArgs, "crictl", "exec")
+		if interactive {
+			cmdArgs = append(cmdArgs, "-i")
+		}
+		cmdArgs = append(cmdArgs, id)
+	}
+	return exec.Command("docker", append(cmdArgs, args...)...), nil
+}
+
+// runVtysh runs a vtysh command on a router.
+func runVtysh(router, command string) ([]byte, error) {
+	container := routerContainer(router)
+	cmd, err := frrCommand(router, false, "vtysh", "-c", command)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("vtysh -c %q on %s: %s", command, container, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("vtysh -c %q on %s: %w", command, container, err)
+	}
+	return out, nil
+}
+
+// frrClient returns a client decoding the JSON output of the vtysh commands
+// of a router.
+func frrClient(router string) *frr.Client {
+	return frr.NewClient(router, func(command string) ([]byte, error) {
+		return runVtysh(router, command)
+	})
+}
+
+// fabricRouters returns every FRR instance of the lab: the containerlab
+// spines and leaves, and the openperouter router pods on the kind nodes,
+// which are addressed through their node.
+func fabricRouters() ([]string, error) {
+	out, err := exec.Command("docker", "ps", "--filter", "name="+clabContainerPrefix, "--format", "{{.Names}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing containerlab routers: %w", err)
+	}
+	var routers []string
+	for _, name := range strings.Fields(string(out)) {
+		short := strings.TrimPrefix(name, clabContainerPrefix)
+		if strings.HasPrefix(short, "spine") || strings.HasPrefix(short, "leaf") {
+			routers = append(routers, name)
+		}
+	}
+	sort.Strings(routers)
+
+	nodes, err := kindNodes("")
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		routers = append(routers, n.Name)
+	}
+	return routers, nil
+}
+
+// matchRouters returns the routers whose container name, or short name
+// without the containerlab prefix (e.g. "leafA"), matches the glob.
+func matchRouters(routers []string, glob string) []string {
+	var matched []string
+	for _, name := range routers {
+		if ok, _ := path.Match(glob, name); ok {
+			matched = append(matched, name)
+		} else if ok, _ := path.Match(glob, strings.TrimPrefix(name, clabContainerPrefix)); ok {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
+
+// routerPID returns the host PID of the FRR container of the router pod on a
+// kind node, used to enter its network namespace.
+func routerPID(node string) (string, error) {
+	id, err := frrContainerID(node)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("docker", "exec", node, "crictl", "inspect", "--output", "go-template", "--template", "{{.info.pid}}", id).Output()
+	if err != nil {
+		return "", fmt.Errorf("inspecting FRR container on %s: %w", node, err)
+	}
+	pid := strings.TrimSpace(string(out))
+	if pid == "" {
+		return "", fmt.Errorf("no PID for FRR container on %s", node)
+	}
+	return pid, nil
+}
+
+// runInRouterNetns runs a command in the network namespace FRR programs:
+// the container itself for containerlab routers, the router pod namespace
+// for kind nodes.
+func runInRouterNetns(router string, args ...string) ([]byte, error) {
+	container := routerContainer(router)
+	cmdArgs := []string{"exec", container}
+	if isKindNode(container) {
+		pid, err := routerPID(container)
+		if err != nil {
+			return nil, err
+		}
+		cmdArgs = append(cmdArgs, "nsenter", "-t", pid, "-n")
+	}
+	out, err := exec.Command("docker", append(cmdArgs, args...)...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s on %s: %s", strings.Join(args, " "), container, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("%s on %s: %w", strings.Join(args, " "), container, err)
+	}
+	return out, nil
+}
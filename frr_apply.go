@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// frrReloadPath is the FRR script applying a whole configuration, used to
+// revert a change to a snapshot: it removes what the snapshot lacks, which
+// applying the snapshot with vtysh would not.
+const frrReloadPath = "/usr/lib/frr/frr-reload.py"
+
+// frrChangesPattern matches the directories apply_frr_config saves the
+// snapshots and diff of every change to.
+const frrChangesPattern = "frr_changes_*"
+
+// runFRRScript runs a command in the FRR container of a router with input
+// as its standard input, returning its output, standard error included:
+// vtysh reports the lines it rejects there.
+func runFRRScript(router string, input string, args ...string) (string, error) {
+	cmd, err := frrCommand(router, true, args...)
+	if err != nil {
+		return "", err
+	}
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// configErrors returns the errors vtysh printed while reading a
+// configuration, such as "line 3: % Unknown command[4]: neighbr 1.2.3.4".
+func configErrors(output string) []string {
+	var errs []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "% ") {
+			errs = append(errs, strings.TrimSpace(line))
+		}
+	}
+	return errs
+}
+
+// readRevertSnapshot reads a pre-change snapshot to revert a router to. Only
+// the snapshots apply_frr_config took of that same router are accepted, so
+// the tool cannot be used to read arbitrary files or to push the
+// configuration of a router onto another.
+func readRevertSnapshot(path, container string) ([]byte, error) {
+	pattern := filepath.Join(frrChangesPattern, container+"_before.conf")
+	clean := filepath.Clean(path)
+	if ok, _ := filepath.Match(pattern, clean); !ok {
+		return nil, fmt.Errorf("revert_snapshot must be a pre-change snapshot of %s taken by apply_frr_config (%s), got %s", container, pattern, path)
+	}
+	// A symlink planted in a changes directory could point anywhere.
+	info, err := os.Lstat(clean)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("snapshot %s is not a regular file", path)
+	}
+	data, err := os.ReadFile(clean)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+	}
+	return data, nil
+}
+
+func (s *MCPServer) applyFRRConfig(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	if router == "" {
+		return toolError("router is required")
+	}
+	config, _ := args["config"].(string)
+	revert, _ := args["revert_snapshot"].(string)
+	if (config == "") == (revert == "") {
+		return toolError("exactly one of config and revert_snapshot is required")
+	}
+	dryRun, _ := args["dry_run"].(bool)
+	if dryRun && revert != "" {
+		return toolError("dry_run only checks a config snippet, not a revert")
+	}
+	container := routerContainer(router)
+	if revert != "" {
+		data, err := readRevertSnapshot(revert, container)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		config = string(data)
+	}
+	if !strings.HasSuffix(config, "\n") {
+		config += "\n"
+	}
+
+	var fields record
+	fields.add("router", container)
+
+	// A dry run only has vtysh parse the snippet.
+	if dryRun {
+		out, err := runFRRScript(router, config, "vtysh", "--dryrun", "-f", "/dev/stdin")
+		errs := configErrors(out)
+		if err != nil && len(errs) == 0 {
+			return toolError(fmt.Sprintf("Error checking the configuration on %s: %v: %s", container, err, strings.TrimSpace(out)))
+		}
+		text := fmt.Sprintf("✓ vtysh on %s accepts the configuration (dry run, nothing applied)\n", container)
+		if len(errs) > 0 {
+			text = fmt.Sprintf("✗ vtysh on %s rejects %d line(s) (dry run, nothing applied):\n  %s\n", container, len(errs), strings.Join(errs, "\n  "))
+		}
+		fields.add("applied", false)
+		fields.add("errors", errs)
+		return formattedResult(format, text, len(errs) > 0, fields)
+	}
+
+	before, err := runVtysh(router, "show running-config")
+	if err != nil {
+		return toolError(fmt.Sprintf("Error taking the pre-change snapshot: %v", err))
+	}
+	// Changes to the same router within a second get their own directory,
+	// not to overwrite the snapshot of the previous one.
+	dir := "frr_changes_" + time.Now().Format("20060102_150405")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, container+"_before.conf")); os.IsNotExist(err) {
+			break
+		}
+		dir = fmt.Sprintf("frr_changes_%s_%d", time.Now().Format("20060102_150405"), i)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return toolError(fmt.Sprintf("Error creating %s: %v", dir, err))
+	}
+	beforeFile := filepath.Join(dir, container+"_before.conf")
+	if err := os.WriteFile(beforeFile, before, 0o644); err != nil {
+		return toolError(fmt.Sprintf("Error saving the pre-change snapshot: %v", err))
+	}
+	inputFile := filepath.Join(dir, container+"_snippet.conf")
+	if revert != "" {
+		inputFile = filepath.Join(dir, container+"_revert.conf")
+	}
+	if err := os.WriteFile(inputFile, []byte(config), 0o644); err != nil {
+		return toolError(fmt.Sprintf("Error saving the configuration applied: %v", err))
+	}
+
+	fmt.Fprintf(os.Stderr, "Applying %s to %s\n", inputFile, container)
+	var out string
+	var runErr error
+	if revert != "" {
+		// frr-reload.py reads a file: the snapshot is copied into the
+		// container first, to a file of its own so concurrent reverts do
+		// not overwrite each other's.
+		out, runErr = runFRRScript(router, config, "sh", "-c",
+			fmt.Sprintf(`tmp=$(mktemp /tmp/openperouter-mcp-revert.XXXXXX) || exit; cat > "$tmp" && %s --reload "$tmp"; rc=$?; rm -f "$tmp"; exit $rc`, frrReloadPath))
+	} else {
+		out, runErr = runFRRScript(router, config, "vtysh", "-f", "/dev/stdin")
+	}
+	errs := configErrors(out)
+	if runErr != nil && len(errs) == 0 {
+		errs = append(errs, fmt.Sprintf("%v: %s", runErr, strings.TrimSpace(out)))
+	}
+
+	after, err := runVtysh(router, "show running-config")
+	if err != nil {
+		return toolError(fmt.Sprintf("Applied, but taking the post-change snapshot failed: %v; the pre-change snapshot is %s", err, beforeFile))
+	}
+	afterFile := filepath.Join(dir, container+"_after.conf")
+	if err := os.WriteFile(afterFile, after, 0o644); err != nil {
+		return toolError(fmt.Sprintf("Error saving the post-change snapshot: %v", err))
+	}
+
+	beforeLines, _, _ := readConfigLines(beforeFile)
+	afterLines, _, _ := readConfigLines(afterFile)
+	diff := ""
+	added, removed := 0, 0
+	if ops, ok := diffLines(beforeLines, afterLines); ok {
+		diff = unifiedDiff(beforeFile, afterFile, ops, defaultDiffContext)
+		for _, op := range ops {
+			switch op.kind {
+			case '+':
+				added++
+			case '-':
+				removed++
+			}
+		}
+		if diff != "" {
+			if err := os.WriteFile(filepath.Join(dir, container+".diff"), []byte(diff), 0o644); err != nil {
+				return toolError(fmt.Sprintf("Error saving the diff: %v", err))
+			}
+		}
+	}
+
+	var b strings.Builder
+	action := "Applied " + inputFile
+	if revert != "" {
+		action = "Reverted to " + revert
+	}
+	fmt.Fprintf(&b, "%s on %s: running configuration +%d -%d line(s)\n", action, container, added, removed)
+	if len(errs) > 0 {
+		fmt.Fprintf(&b, "\n✗ %d line(s) rejected:\n  %s\n", len(errs), strings.Join(errs, "\n  "))
+	}
+	if diff != "" {
+		fmt.Fprintf(&b, "\n%s", diff)
+	} else {
+		b.WriteString("\nThe running configuration did not change\n")
+	}
+	fmt.Fprintf(&b, "\nPre-change snapshot: %s\n", beforeFile)
+	fmt.Fprintf(&b, "To revert, call apply_frr_config with router %q and revert_snapshot %q\n", router, beforeFile)
+	b.WriteString("The change is not saved to frr.conf: it is lost when FRR restarts, and the openperouter reloader may overwrite it.\n")
+
+	fields.add("applied", true)
+	fields.add("directory", dir)
+	fields.add("snapshot", beforeFile)
+	fields.add("added", added)
+	fields.add("removed", removed)
+	fields.add("errors", errs)
+	fields.add("diff", diff)
+	return formattedResult(format, b.String(), len(errs) > 0, fields)
+}
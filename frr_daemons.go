@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frrProcessScript prints, for every pid file of the FRR daemons, the daemon,
+// its pid and its start time in clock ticks since boot (empty when the
+// process is gone), then the clock tick rate and the uptime of the host.
+const frrProcessScript = `for f in /var/run/frr/*.pid; do
+  [ -e "$f" ] || continue
+  p=$(cat "$f")
+  echo "$(basename "$f" .pid) $p $(cut -d' ' -f22 /proc/$p/stat 2>/dev/null)"
+done
+echo "ticks $(getconf CLK_TCK 2>/dev/null || echo 100)"
+echo "uptime $(cut -d' ' -f1 /proc/uptime)"`
+
+var (
+	frrVersionRe     = regexp.MustCompile(`FRRouting (\S+)`)
+	watchfrrDaemonRe = regexp.MustCompile(`^\s+(\S+)\s+(Init|Down|Connecting|Up|Unresponsive)\b`)
+	watchfrrDownRe   = regexp.MustCompile(`\b(\w+) state -> down : (.*)`)
+)
+
+// restartedSlack is how much later than watchfrr a daemon may have started
+// without being reported as restarted.
+const restartedSlack = time.Minute
+
+// frrDaemon is a daemon of a router, as watchfrr and the process table see
+// it.
+type frrDaemon struct {
+	name     string
+	state    string
+	pid      int
+	running  bool
+	uptime   time.Duration
+	downs    int
+	lastDown time.Time
+	reason   string
+}
+
+// frrInventory is the FRR version and daemons of a router.
+type frrInventory struct {
+	version           string
+	containerRestarts int
+	daemons           []*frrDaemon
+	watchfrrUptime    time.Duration
+}
+
+// frrDaemonProcesses returns the daemons of a router by name, with their pid
+// and uptime.
+func frrDaemonProcesses(router string) (map[string]*frrDaemon, error) {
+	cmd, err := frrCommand(router, false, "sh", "-c", frrProcessScript)
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing FRR processes on %s: %w", routerContainer(router), err)
+	}
+	ticks, uptime := 100.0, 0.0
+	type process struct {
+		name  string
+		pid   int
+		start float64
+		alive bool
+	}
+	var processes []process
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 2 && f[0] == "ticks":
+			if v, err := strconv.ParseFloat(f[1], 64); err == nil && v > 0 {
+				ticks = v
+			}
+		case len(f) == 2 && f[0] == "uptime":
+			uptime, _ = strconv.ParseFloat(f[1], 64)
+		case len(f) >= 2:
+			p := process{name: f[0]}
+			p.pid, _ = strconv.Atoi(f[1])
+			if len(f) == 3 {
+				p.start, _ = strconv.ParseFloat(f[2], 64)
+				p.alive = true
+			}
+			processes = append(processes, p)
+		}
+	}
+	daemons := make(map[string]*frrDaemon, len(processes))
+	for _, p := range processes {
+		d := &frrDaemon{name: p.name, pid: p.pid, running: p.alive}
+		if p.alive && uptime > 0 {
+			d.uptime = time.Duration((uptime - p.start/ticks) * float64(time.Second)).Truncate(time.Second)
+		}
+		daemons[p.name] = d
+	}
+	return daemons, nil
+}
+
+// containerRestarts returns how many times the FRR container of a router
+// was restarted: the restart count of containerlab routers, the attempt of
+// the FRR container of the router pod on kind nodes.
+func containerRestarts(router string) (int, error) {
+	container := routerContainer(router)
+	if !isKindNode(container) {
+		out, err := exec.Command("docker", "inspect", "-f", "{{.RestartCount}}", container).Output()
+		if err != nil {
+			return 0, fmt.Errorf("inspecting %s: %w", container, err)
+		}
+		return strconv.Atoi(strings.TrimSpace(string(out)))
+	}
+	id, err := frrContainerID(container)
+	if err != nil {
+		return 0, err
+	}
+	out, err := exec.Command("docker", "exec", container, "crictl", "inspect", id).Output()
+	if err != nil {
+		return 0, fmt.Errorf("inspecting the FRR container on %s: %w", container, err)
+	}
+	var info struct {
+		Status struct {
+			Metadata struct {
+				Attempt int `json:"attempt"`
+			} `json:"metadata"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return 0, fmt.Errorf("parsing the FRR container on %s: %w", container, err)
+	}
+	return info.Status.Metadata.Attempt, nil
+}
+
+// routerFRRInventory returns the FRR version and daemons of a router, with
+// the times watchfrr saw each daemon go down since the given time.
+func routerFRRInventory(router string, since time.Time) (*frrInventory, error) {
+	inv := &frrInventory{}
+	out, err := runVtysh(router, "show version")
+	if err != nil {
+		return nil, err
+	}
+	if m := frrVersionRe.FindStringSubmatch(string(out)); m != nil {
+		inv.version = m[1]
+	}
+
+	processes, err := frrDaemonProcesses(router)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*frrDaemon)
+	// watchfrr lists the daemons it monitors, those configured even when
+	// not running.
+	if out, err := runVtysh(router, "show watchfrr"); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if m := watchfrrDaemonRe.FindStringSubmatch(line); m != nil {
+				d := &frrDaemon{name: m[1]}
+				if p, ok := processes[m[1]]; ok {
+					d = p
+				}
+				d.state = m[2]
+				byName[d.name] = d
+			}
+		}
+	}
+	for name, p := range processes {
+		if name == "watchfrr" {
+			inv.watchfrrUptime = p.uptime
+			continue
+		}
+		if _, ok := byName[name]; !ok {
+			byName[name] = p
+		}
+	}
+
+	if logs, err := fetchRouterLogs(router, since); err == nil {
+		scanner := bufio.NewScanner(strings.NewReader(logs))
+		for scanner.Scan() {
+			line := scanner.Text()
+			m := watchfrrDownRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			d, ok := byName[m[1]]
+			if !ok {
+				continue
+			}
+			d.downs++
+			stamp, _, _ := strings.Cut(line, " ")
+			if t, err := time.Parse(time.RFC3339Nano, stamp); err == nil {
+				d.lastDown = t
+			}
+			d.reason = strings.TrimSpace(m[2])
+		}
+	}
+
+	inv.containerRestarts, _ = containerRestarts(router)
+	for _, d := range byName {
+		inv.daemons = append(inv.daemons, d)
+	}
+	sort.Slice(inv.daemons, func(i, j int) bool { return inv.daemons[i].name < inv.daemons[j].name })
+	return inv, nil
+}
+
+// problems returns what is wrong with a daemon: not running, not Up for
+// watchfrr, started well after watchfrr, or seen going down.
+func (d *frrDaemon) problems(watchfrrUptime time.Duration) []string {
+	var problems []string
+	switch {
+	case !d.running:
+		problems = append(problems, "not running")
+	case d.state != "" && d.state != "Up":
+		problems = append(problems, "watchfrr state "+d.state)
+	case watchfrrUptime > 0 && d.uptime+restartedSlack < watchfrrUptime:
+		problems = append(problems, fmt.Sprintf("restarted: up for %s, FRR for %s", d.uptime, watchfrrUptime))
+	}
+	if d.downs > 0 {
+		p := fmt.Sprintf("went down %d time(s) in the window", d.downs)
+		if !d.lastDown.IsZero() {
+			p += ", last at " + d.lastDown.Format(time.RFC3339)
+		}
+		if d.reason != "" {
+			p += " (" + d.reason + ")"
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+func (s *MCPServer) getFRRDaemons(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	sinceArg, _ := args["since"].(string)
+	if sinceArg == "" {
+		sinceArg = "1h"
+	}
+	since, err := parseTimeArg(sinceArg, time.Now())
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	routerTable := newTable("routers", "router", "version", "container_restarts", "uptime_seconds", "problems")
+	daemonTable := newTable("daemons", "router", "daemon", "state", "running", "pid", "uptime_seconds", "down_events", "last_down", "problems")
+	var findings []string
+	versions := make(map[string][]string)
+	failed := 0
+	for _, router := range routers {
+		inv, err := routerFRRInventory(router, since)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		versions[inv.version] = append(versions[inv.version], router)
+
+		var routerProblems []string
+		if inv.containerRestarts > 0 {
+			routerProblems = append(routerProblems, fmt.Sprintf("FRR container restarted %d time(s)", inv.containerRestarts))
+		}
+		for _, p := range routerProblems {
+			findings = append(findings, router+": "+p)
+		}
+		routerTable.add(router, inv.version, inv.containerRestarts, int64(inv.watchfrrUptime.Seconds()), routerProblems)
+
+		fmt.Fprintf(&b, "\n=== %s === FRR %s", router, inv.version)
+		if inv.watchfrrUptime > 0 {
+			fmt.Fprintf(&b, ", up %s", inv.watchfrrUptime)
+		}
+		if inv.containerRestarts > 0 {
+			fmt.Fprintf(&b, ", container restarted %d time(s)", inv.containerRestarts)
+		}
+		b.WriteString("\n")
+		for _, d := range inv.daemons {
+			problems := d.problems(inv.watchfrrUptime)
+			for _, p := range problems {
+				findings = append(findings, fmt.Sprintf("%s: %s %s", router, d.name, p))
+			}
+			lastDown := ""
+			if !d.lastDown.IsZero() {
+				lastDown = d.lastDown.Format(time.RFC3339)
+			}
+			daemonTable.add(router, d.name, d.state, d.running, d.pid, int64(d.uptime.Seconds()), d.downs, lastDown, problems)
+
+			mark := "✓"
+			if len(problems) > 0 {
+				mark = "✗"
+			}
+			line := fmt.Sprintf("  %s %-9s", mark, d.name)
+			if d.running {
+				line += fmt.Sprintf(" pid %-6d up %s", d.pid, d.uptime)
+			} else {
+				line += " not running"
+			}
+			if d.state != "" {
+				line += ", watchfrr " + d.state
+			}
+			if len(problems) > 0 {
+				line += " ⚠ " + strings.Join(problems, "; ")
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	if len(versions) > 1 {
+		var parts []string
+		for v, rs := range versions {
+			if v == "" {
+				v = "unknown"
+			}
+			parts = append(parts, fmt.Sprintf("%s on %s", v, strings.Join(rs, ", ")))
+		}
+		sort.Strings(parts)
+		findings = append(findings, "routers run different FRR versions: "+strings.Join(parts, "; "))
+	}
+
+	summary := fmt.Sprintf("FRR daemons of %d router(s), down events since %s", len(routers)-failed, since.Format(time.RFC3339))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	} else if failed < len(routers) {
+		text += "\n✓ Every daemon is up and none restarted\n"
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, routerTable, daemonTable)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFRRLogLines = 500
+	maxFRRLogLines     = 5000
+)
+
+// frrDaemons are the FRR daemons get_frr_logs tells the logs apart of, and
+// frrLogDaemons those it returns the logs of by default.
+var (
+	frrDaemons    = []string{"bgpd", "zebra", "bfdd", "staticd", "watchfrr", "mgmtd"}
+	frrLogDaemons = []string{"bgpd", "zebra", "bfdd"}
+)
+
+// frrDaemonTags maps the protocol tags FRR prefixes its messages with, as in
+// "2025/01/10 10:00:00 BGP: [...]", to the daemon logging them.
+var frrDaemonTags = map[string]string{
+	"BGP":      "bgpd",
+	"ZEBRA":    "zebra",
+	"BFD":      "bfdd",
+	"STATIC":   "staticd",
+	"WATCHFRR": "watchfrr",
+	"MGMTD":    "mgmtd",
+}
+
+// frrDaemonRe matches the daemon of a log line, from either its syslog tag,
+// e.g. "bgpd[27]:", or its FRR protocol tag, e.g. "ZEBRA:".
+var frrDaemonRe = regexp.MustCompile(`\b(?:(bgpd|zebra|bfdd|staticd|watchfrr|mgmtd)\[\d+\]|(BGP|ZEBRA|BFD|STATIC|WATCHFRR|MGMTD)):`)
+
+// frrLogDaemon returns the daemon that logged a line, or "" when the line
+// does not tell.
+func frrLogDaemon(line string) string {
+	m := frrDaemonRe.FindStringSubmatch(line)
+	switch {
+	case m == nil:
+		return ""
+	case m[1] != "":
+		return m[1]
+	}
+	return frrDaemonTags[m[2]]
+}
+
+func (s *MCPServer) getFRRLogs(args map[string]any) CallToolResult {
+	router, _ := args["router"].(string)
+	if router == "" {
+		return toolError("router is required")
+	}
+	daemons, err := stringsArg(args, "daemons")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(daemons) == 0 {
+		daemons = frrLogDaemons
+	}
+	for _, d := range daemons {
+		if !containsString(frrDaemons, d) {
+			return toolError(fmt.Sprintf("invalid daemon %q, expected one of %s", d, strings.Join(frrDaemons, ", ")))
+		}
+	}
+
+	now := time.Now()
+	sinceArg, _ := args["since"].(string)
+	if sinceArg == "" {
+		sinceArg = "15m"
+	}
+	since, err := parseTimeArg(sinceArg, now)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	until := now
+	if v, _ := args["until"].(string); v != "" {
+		if until, err = parseTimeArg(v, now); err != nil {
+			return toolError(err.Error())
+		}
+	}
+	if !until.After(since) {
+		return toolError("until must be after since")
+	}
+	keyword, _ := args["keyword"].(string)
+	maxLines := defaultFRRLogLines
+	if v, ok := args["max_lines"].(float64); ok && v > 0 {
+		maxLines = min(int(v), maxFRRLogLines)
+	}
+
+	container := routerContainer(router)
+	logs, err := fetchRouterLogs(router, since)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error fetching the logs of %s: %v: %s", container, err, strings.TrimSpace(logs)))
+	}
+
+	// The lines are split by daemon, within the window and matching the
+	// keyword, case insensitively.
+	lower := strings.ToLower(keyword)
+	byDaemon := make(map[string][]string)
+	untagged := 0
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		stamp, _, _ := strings.Cut(line, " ")
+		if t, err := time.Parse(time.RFC3339Nano, stamp); err == nil && (t.Before(since) || t.After(until)) {
+			continue
+		}
+		if keyword != "" && !strings.Contains(strings.ToLower(line), lower) {
+			continue
+		}
+		daemon := frrLogDaemon(line)
+		if daemon == "" {
+			untagged++
+			continue
+		}
+		if containsString(daemons, daemon) {
+			byDaemon[daemon] = append(byDaemon[daemon], line)
+		}
+	}
+
+	query := url.Values{}
+	query.Set("since", since.UTC().Format(time.RFC3339))
+	query.Set("until", until.UTC().Format(time.RFC3339))
+	if keyword != "" {
+		query.Set("keyword", keyword)
+	}
+
+	var b strings.Builder
+	content := []ContentItem{{}}
+	sorted := append([]string(nil), daemons...)
+	sort.Strings(sorted)
+	total := 0
+	for _, daemon := range sorted {
+		lines := byDaemon[daemon]
+		if len(lines) == 0 {
+			fmt.Fprintf(&b, "  %s: no line\n", daemon)
+			continue
+		}
+		// Only the latest lines are kept, the closest to the problem being
+		// investigated.
+		dropped := 0
+		if len(lines) > maxLines {
+			dropped = len(lines) - maxLines
+			lines = lines[dropped:]
+		}
+		total += len(lines)
+		uri := fmt.Sprintf("frr-logs://%s/%s.log?%s", container, daemon, query.Encode())
+		content = append(content, ContentItem{
+			Type: "resource",
+			Resource: &ResourceContents{
+				URI:      uri,
+				MimeType: "text/plain",
+				Text:     strings.Join(lines, "\n") + "\n",
+			},
+			Annotations: &Annotations{Audience: []string{"assistant"}},
+		})
+		line := fmt.Sprintf("  %s: %d line(s), %s", daemon, len(lines), uri)
+		if dropped > 0 {
+			line += fmt.Sprintf(" (%d older line(s) dropped, raise max_lines to see them)", dropped)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	header := fmt.Sprintf("%d log line(s) of %s from %s to %s", total, container,
+		since.Format(time.RFC3339), until.Format(time.RFC3339))
+	if keyword != "" {
+		header += fmt.Sprintf(" matching %q", keyword)
+	}
+	header += ":\n"
+	if untagged > 0 {
+		fmt.Fprintf(&b, "%d line(s) not attributed to an FRR daemon were skipped\n", untagged)
+	}
+	content[0] = summaryContent(header + b.String())
+	return CallToolResult{Content: content}
+}
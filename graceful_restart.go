@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// grAddressFamily is the graceful restart state of an address family of a
+// neighbor.
+type grAddressFamily struct {
+	afi string
+	// fBit tells whether the neighbor preserved its forwarding state for
+	// the address family across its last restart.
+	fBit          bool
+	eorSent       bool
+	eorReceived   bool
+	staleTime     int64
+	deferralTime  int64
+	staleLeft     int64
+	deferralLeft  int64
+	hasGRSettings bool
+}
+
+// grNeighbor is the graceful restart and long-lived graceful restart state
+// of a BGP neighbor.
+type grNeighbor struct {
+	router, vrf, neighbor string
+	state                 string
+	grCapability          string
+	llgrCapability        string
+	localMode, remoteMode string
+	rBit, nBit            bool
+	restartConfigured     int64
+	restartReceived       int64
+	// restartLeftMsecs and staleLeftMsecs are set while the neighbor is
+	// restarting and its routes are kept stale.
+	restartLeftMsecs int64
+	staleLeftMsecs   int64
+	afs              []*grAddressFamily
+}
+
+// negotiated tells whether both sides advertised graceful restart.
+func (n *grNeighbor) negotiated() bool {
+	return n.grCapability == "advertisedAndReceived"
+}
+
+// restarting tells whether the neighbor is restarting, its routes kept
+// while it comes back.
+func (n *grNeighbor) restarting() bool {
+	return n.restartLeftMsecs > 0 || n.staleLeftMsecs > 0
+}
+
+// grNumber returns an integer of a decoded JSON object, 0 when missing.
+func grNumber(obj map[string]any, key string) int64 {
+	v, _ := obj[key].(float64)
+	return int64(v)
+}
+
+// parseGRNeighbor returns the graceful restart state of a neighbor of 'show
+// bgp neighbors json'. The gracefulRestartInfo object holds the modes, bits
+// and timers of the neighbor and one object per address family.
+func parseGRNeighbor(raw json.RawMessage) (*grNeighbor, bool) {
+	var n struct {
+		State        string         `json:"bgpState"`
+		Capabilities map[string]any `json:"neighborCapabilities"`
+		GR           map[string]any `json:"gracefulRestartInfo"`
+	}
+	if err := json.Unmarshal(raw, &n); err != nil || n.State == "" {
+		return nil, false
+	}
+	gr := &grNeighbor{state: n.State}
+	for _, key := range []string{"gracefulRestart", "gracefulRestartCapability"} {
+		if v, ok := n.Capabilities[key].(string); ok {
+			gr.grCapability = v
+		}
+	}
+	if v, ok := n.Capabilities["longLivedGracefulRestart"].(string); ok {
+		gr.llgrCapability = v
+	}
+
+	info := n.GR
+	gr.localMode, _ = info["localGrMode"].(string)
+	gr.remoteMode, _ = info["remoteGrMode"].(string)
+	gr.rBit, _ = info["rBit"].(bool)
+	gr.nBit, _ = info["nBit"].(bool)
+	gr.restartLeftMsecs = grNumber(info, "gracefulRestartTimerMsecs")
+	gr.staleLeftMsecs = grNumber(info, "gracefulStalepathTimerMsecs")
+	if timers, ok := info["timers"].(map[string]any); ok {
+		gr.restartConfigured = grNumber(timers, "configuredRestartTimer")
+		gr.restartReceived = grNumber(timers, "receivedRestartTimer")
+		if left := grNumber(timers, "restartTimerRemaining"); left > 0 && gr.restartLeftMsecs == 0 {
+			gr.restartLeftMsecs = left * 1000
+		}
+	}
+	// Older versions only list the address families End-of-RIB was sent
+	// and received for.
+	afs := make(map[string]*grAddressFamily)
+	get := func(afi string) *grAddressFamily {
+		af, ok := afs[afi]
+		if !ok {
+			af = &grAddressFamily{afi: afi}
+			afs[afi] = af
+		}
+		return af
+	}
+	for key, v := range info {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "timers":
+		case "endOfRibSend":
+			for afi := range obj {
+				get(afi).eorSent = true
+			}
+		case "endOfRibRecv":
+			for afi := range obj {
+				get(afi).eorReceived = true
+			}
+		default:
+			af := get(key)
+			af.hasGRSettings = true
+			af.fBit, _ = obj["fBit"].(bool)
+			if eor, ok := obj["endOfRibStatus"].(map[string]any); ok {
+				sent, _ := eor["endOfRibSend"].(bool)
+				received, _ := eor["endOfRibRecv"].(bool)
+				af.eorSent = af.eorSent || sent
+				af.eorReceived = af.eorReceived || received
+			}
+			if timers, ok := obj["timers"].(map[string]any); ok {
+				af.staleTime = grNumber(timers, "stalePathTimer")
+				af.staleLeft = grNumber(timers, "stalePathTimerRemaining")
+				af.deferralTime = grNumber(timers, "selectionDeferralTimer")
+				af.deferralLeft = grNumber(timers, "selectionDeferralTimerRemaining")
+			}
+		}
+	}
+	for _, af := range afs {
+		gr.afs = append(gr.afs, af)
+	}
+	sort.Slice(gr.afs, func(i, j int) bool { return gr.afs[i].afi < gr.afs[j].afi })
+	return gr, true
+}
+
+// grNeighbors returns the graceful restart state of the BGP neighbors of
+// every VRF of a router.
+func grNeighbors(router string) ([]*grNeighbor, error) {
+	entries, err := frrClient(router).BGPNeighbors()
+	if err != nil {
+		return nil, err
+	}
+	var neighbors []*grNeighbor
+	for _, e := range entries {
+		if n, ok := parseGRNeighbor(e.Raw); ok {
+			n.router, n.vrf, n.neighbor = router, e.VRF, e.Address
+			neighbors = append(neighbors, n)
+		}
+	}
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].vrf != neighbors[j].vrf {
+			return neighbors[i].vrf < neighbors[j].vrf
+		}
+		return neighbors[i].neighbor < neighbors[j].neighbor
+	})
+	return neighbors, nil
+}
+
+// kernelBGPRoutes counts the routes bgpd installed in the kernel, which
+// zebra keeps while bgpd restarts gracefully.
+func kernelBGPRoutes(router string) (int, error) {
+	total := 0
+	for _, family := range []string{"-4", "-6"} {
+		out, err := runInRouterNetns(router, "ip", "-j", family, "route", "show", "table", "all", "proto", "bgp")
+		if err != nil {
+			return 0, err
+		}
+		if len(strings.TrimSpace(string(out))) == 0 {
+			continue
+		}
+		var routes []json.RawMessage
+		if err := json.Unmarshal(out, &routes); err != nil {
+			return 0, fmt.Errorf("parsing routes of %s: %w", router, err)
+		}
+		total += len(routes)
+	}
+	return total, nil
+}
+
+func (s *MCPServer) getGracefulRestart(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	vrf, _ := args["vrf"].(string)
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	routerTable := newTable("routers", "router", "bgpd_answering", "kernel_bgp_routes")
+	neighborTable := newTable("neighbors", "router", "vrf", "neighbor", "state", "gr_capability", "llgr_capability", "local_mode", "remote_mode", "r_bit", "n_bit", "restart_time_configured", "restart_time_received", "restart_remaining_msecs", "stale_path_remaining_msecs")
+	afTable := newTable("address_families", "router", "vrf", "neighbor", "afi", "f_bit", "eor_sent", "eor_received", "stale_path_time", "stale_path_remaining", "selection_deferral_time", "selection_deferral_remaining")
+	var findings []string
+	total, negotiated, restarting, failed := 0, 0, 0, 0
+	for _, router := range routers {
+		kernelRoutes, kernelErr := kernelBGPRoutes(router)
+		neighbors, err := grNeighbors(router)
+		if err != nil {
+			// While bgpd restarts, what matters is whether the kernel kept
+			// its routes.
+			routerTable.add(router, false, kernelRoutes)
+			if kernelErr != nil {
+				fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(&b, "\n=== %s === bgpd not answering (%v), %d BGP route(s) kept in the kernel\n", router, err, kernelRoutes)
+			if kernelRoutes == 0 {
+				findings = append(findings, fmt.Sprintf("%s: bgpd is not answering and the kernel has no BGP route left: forwarding was not preserved", router))
+			}
+			continue
+		}
+		routerTable.add(router, true, kernelRoutes)
+
+		fmt.Fprintf(&b, "\n=== %s ===", router)
+		if kernelErr == nil {
+			fmt.Fprintf(&b, " %d BGP route(s) in the kernel", kernelRoutes)
+		}
+		b.WriteString("\n")
+		for _, n := range neighbors {
+			if vrf != "" && n.vrf != vrf {
+				continue
+			}
+			total++
+			where := fmt.Sprintf("%s vrf %s %s", router, n.vrf, n.neighbor)
+			if n.negotiated() {
+				negotiated++
+			} else if n.state == "Established" {
+				findings = append(findings, fmt.Sprintf("%s: graceful restart not negotiated (capability %s)", where, orNone(n.grCapability)))
+			}
+			if n.restarting() {
+				restarting++
+				findings = append(findings, fmt.Sprintf("%s: restarting, restart timer %s and stale path timer %s left", where, msecs(n.restartLeftMsecs), msecs(n.staleLeftMsecs)))
+			}
+			neighborTable.add(router, n.vrf, n.neighbor, n.state, n.grCapability, n.llgrCapability, n.localMode, n.remoteMode, n.rBit, n.nBit, n.restartConfigured, n.restartReceived, n.restartLeftMsecs, n.staleLeftMsecs)
+
+			mark := "✓"
+			if !n.negotiated() || n.restarting() {
+				mark = "✗"
+			}
+			line := fmt.Sprintf("  %s vrf %s %s (%s): GR %s", mark, n.vrf, n.neighbor, n.state, orNone(n.grCapability))
+			if n.localMode != "" || n.remoteMode != "" {
+				line += fmt.Sprintf(", local %s, remote %s", orNone(n.localMode), orNone(n.remoteMode))
+			}
+			if n.negotiated() {
+				line += fmt.Sprintf(", R-bit %t, N-bit %t, restart time %ds/%ds", n.rBit, n.nBit, n.restartConfigured, n.restartReceived)
+			}
+			if n.llgrCapability != "" {
+				line += ", LLGR " + n.llgrCapability
+			}
+			b.WriteString(line + "\n")
+			for _, af := range n.afs {
+				afTable.add(router, n.vrf, n.neighbor, af.afi, af.fBit, af.eorSent, af.eorReceived, af.staleTime, af.staleLeft, af.deferralTime, af.deferralLeft)
+				afLine := fmt.Sprintf("      %-14s F-bit %-5t EoR sent %-5t received %-5t", af.afi, af.fBit, af.eorSent, af.eorReceived)
+				if af.hasGRSettings {
+					afLine += fmt.Sprintf(" stale path %ds, selection deferral %ds", af.staleTime, af.deferralTime)
+				}
+				b.WriteString(afLine + "\n")
+				switch {
+				case !n.negotiated():
+				case n.remoteMode == "Restart" && af.hasGRSettings && !af.fBit:
+					findings = append(findings, fmt.Sprintf("%s %s: the neighbor did not preserve forwarding (F-bit unset): its routes are withdrawn when it restarts", where, af.afi))
+				case n.state == "Established" && !af.eorReceived:
+					findings = append(findings, fmt.Sprintf("%s %s: no End-of-RIB received yet", where, af.afi))
+				}
+			}
+		}
+	}
+
+	summary := fmt.Sprintf("%d BGP neighbor(s) on %d router(s), graceful restart negotiated with %d, %d restarting", total, len(routers)-failed, negotiated, restarting)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("neighbors", total)
+	fields.add("negotiated", negotiated)
+	fields.add("restarting", restarting)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, routerTable, neighborTable, afTable)
+}
+
+// orNone returns a value, or "none" when empty.
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
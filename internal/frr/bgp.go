@@ -0,0 +1,241 @@
+package frr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PeerSummary is a peer of a BGP summary.
+type PeerSummary struct {
+	RemoteAs   int64  `json:"remoteAs"`
+	State      string `json:"state"`
+	Hostname   string `json:"hostname"`
+	PfxRcd     int    `json:"pfxRcd"`
+	PeerUptime string `json:"peerUptime"`
+	// PeerUptimeMsec tells apart a session that flapped between two polls.
+	PeerUptimeMsec int64 `json:"peerUptimeMsec"`
+}
+
+// AFISummary is the summary of an address family of a VRF.
+type AFISummary struct {
+	RouterID string                 `json:"routerId"`
+	AS       int64                  `json:"as"`
+	Peers    map[string]PeerSummary `json:"peers"`
+}
+
+// BGPSummary returns the summary of every address family of every VRF, by
+// VRF then address family, as 'show bgp vrf all summary json' reports them.
+func (c *Client) BGPSummary() (map[string]map[string]*AFISummary, error) {
+	var vrfs map[string]map[string]json.RawMessage
+	if err := c.Query("show bgp vrf all summary", &vrfs); err != nil {
+		return nil, err
+	}
+	summaries := make(map[string]map[string]*AFISummary, len(vrfs))
+	for vrf, afis := range vrfs {
+		for afi, raw := range afis {
+			// The address families are mixed with the id and name of
+			// the VRF.
+			var summary AFISummary
+			if json.Unmarshal(raw, &summary) != nil || summary.Peers == nil {
+				continue
+			}
+			if summaries[vrf] == nil {
+				summaries[vrf] = make(map[string]*AFISummary)
+			}
+			summaries[vrf][afi] = &summary
+		}
+	}
+	return summaries, nil
+}
+
+// Session is a BGP peer of an address family of a VRF.
+type Session struct {
+	VRF      string
+	AFI      string
+	Neighbor string
+	PeerSummary
+}
+
+// BGPSessions returns the peers of every address family of every VRF.
+func (c *Client) BGPSessions() ([]Session, error) {
+	summaries, err := c.BGPSummary()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []Session
+	for vrf, afis := range summaries {
+		for afi, summary := range afis {
+			for neighbor, peer := range summary.Peers {
+				sessions = append(sessions, Session{VRF: vrf, AFI: afi, Neighbor: neighbor, PeerSummary: peer})
+			}
+		}
+	}
+	return sessions, nil
+}
+
+// Neighbor is a BGP neighbor, as 'show bgp neighbors json' reports it.
+type Neighbor struct {
+	RemoteAs       int64  `json:"remoteAs"`
+	LocalAs        int64  `json:"localAs"`
+	Description    string `json:"nbrDesc"`
+	Hostname       string `json:"hostname"`
+	PeerGroup      string `json:"peerGroup"`
+	RemoteRouterID string `json:"remoteRouterId"`
+	LocalRouterID  string `json:"localRouterId"`
+	State          string `json:"bgpState"`
+	AdminShutdown  bool   `json:"adminShutDown"`
+	UpMsec         int64  `json:"bgpTimerUpMsec"`
+
+	HoldTimeMsecs            int64 `json:"bgpTimerHoldTimeMsecs"`
+	KeepaliveMsecs           int64 `json:"bgpTimerKeepAliveIntervalMsecs"`
+	ConfiguredHoldTimeMsecs  int64 `json:"bgpTimerConfiguredHoldTimeMsecs"`
+	ConfiguredKeepaliveMsecs int64 `json:"bgpTimerConfiguredKeepAliveIntervalMsecs"`
+	ConnectRetryTimer        int64 `json:"connectRetryTimer"`
+	NextConnectMsecs         int64 `json:"nextConnectTimerDueInMsecs"`
+
+	Capabilities     map[string]any            `json:"neighborCapabilities"`
+	MessageStats     map[string]int64          `json:"messageStats"`
+	AddressFamilies  map[string]map[string]any `json:"addressFamilyInfo"`
+	ConnectionsUp    int                       `json:"connectionsEstablished"`
+	ConnectionsDown  int                       `json:"connectionsDropped"`
+	LastResetMsecAgo int64                     `json:"lastResetTimerMsecAgo"`
+	LastResetDueTo   string                    `json:"lastResetDueTo"`
+	// The NOTIFICATION that reset the session, when one did.
+	LastNotification string `json:"lastNotificationReason"`
+	LastErrorSubcode string `json:"lastErrorCodeSubcode"`
+	LastShutdownText string `json:"lastShutdownDescription"`
+	HostLocal        string `json:"hostLocal"`
+	PortLocal        int    `json:"portLocal"`
+	HostForeign      string `json:"hostForeign"`
+	PortForeign      int    `json:"portForeign"`
+}
+
+// NeighborEntry is a BGP neighbor of a VRF, with its raw object for the
+// fields Neighbor does not decode.
+type NeighborEntry struct {
+	VRF     string
+	Address string
+	Neighbor
+	Raw json.RawMessage
+}
+
+// BGPNeighbors returns the BGP neighbors of every VRF.
+func (c *Client) BGPNeighbors() ([]NeighborEntry, error) {
+	var vrfs map[string]map[string]json.RawMessage
+	if err := c.Query("show bgp vrf all neighbors", &vrfs); err != nil {
+		return nil, err
+	}
+	var neighbors []NeighborEntry
+	for vrf, entries := range vrfs {
+		for address, raw := range entries {
+			n := NeighborEntry{VRF: vrf, Address: address, Raw: raw}
+			// The neighbors are mixed with the id and name of the VRF.
+			if decodeLoose(raw, &n.Neighbor) != nil || n.State == "" {
+				continue
+			}
+			neighbors = append(neighbors, n)
+		}
+	}
+	return neighbors, nil
+}
+
+// BGPNeighbor returns a BGP neighbor of a VRF, given by address or, for
+// unnumbered sessions, by interface.
+func (c *Client) BGPNeighbor(vrf, neighbor string) (*Neighbor, error) {
+	var neighbors map[string]json.RawMessage
+	if err := c.Query(fmt.Sprintf("show bgp vrf %s neighbors %s", vrf, neighbor), &neighbors); err != nil {
+		return nil, err
+	}
+	for _, raw := range neighbors {
+		var n Neighbor
+		if decodeLoose(raw, &n) == nil && n.State != "" {
+			return &n, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no BGP neighbor %s in vrf %s", c.router, neighbor, vrf)
+}
+
+// Path is a path of a BGP route, in the brief or the detail form, which FRR
+// renders differently.
+type Path struct {
+	Valid     bool            `json:"valid"`
+	Bestpath  json.RawMessage `json:"bestpath"`
+	Multipath bool            `json:"multipath"`
+	PathFrom  string          `json:"pathFrom"`
+	Nexthops  []struct {
+		IP       string `json:"ip"`
+		Hostname string `json:"hostname"`
+	} `json:"nexthops"`
+	ExtendedCommunity struct {
+		String string `json:"string"`
+	} `json:"extendedCommunity"`
+	// Path is the AS path of the brief form, ASPath the one of the detail
+	// form.
+	Path   string `json:"path"`
+	ASPath struct {
+		String string `json:"string"`
+	} `json:"aspath"`
+	LocPrf *int64 `json:"locPrf"`
+	Metric *int64 `json:"metric"`
+	PeerID string `json:"peerId"`
+	Peer   struct {
+		PeerID string `json:"peerId"`
+	} `json:"peer"`
+}
+
+// Best tells whether the path is the best one, a flag in the brief form and
+// an object in the detail one.
+func (p *Path) Best() bool {
+	var flag bool
+	if json.Unmarshal(p.Bestpath, &flag) == nil {
+		return flag
+	}
+	var detail struct {
+		Overall bool `json:"overall"`
+	}
+	return json.Unmarshal(p.Bestpath, &detail) == nil && detail.Overall
+}
+
+// ASPathString returns the AS path of either form.
+func (p *Path) ASPathString() string {
+	if p.ASPath.String != "" {
+		return p.ASPath.String
+	}
+	return p.Path
+}
+
+// From returns the peer the path was received from, of either form.
+func (p *Path) From() string {
+	if p.Peer.PeerID != "" {
+		return p.Peer.PeerID
+	}
+	return p.PeerID
+}
+
+// UnicastRoutes returns the paths of the unicast BGP table of an address
+// family ("ipv4" or "ipv6") of a VRF, by prefix.
+func (c *Client) UnicastRoutes(vrf, afi string) (map[string][]Path, error) {
+	var top struct {
+		Routes map[string][]Path `json:"routes"`
+	}
+	if err := c.Query(fmt.Sprintf("show bgp vrf %s %s unicast", vrf, afi), &top); err != nil {
+		return nil, err
+	}
+	return top.Routes, nil
+}
+
+// AllUnicastRoutes returns the paths of the unicast BGP tables of an
+// address family of every VRF, by VRF then prefix.
+func (c *Client) AllUnicastRoutes(afi string) (map[string]map[string][]Path, error) {
+	var vrfs map[string]struct {
+		Routes map[string][]Path `json:"routes"`
+	}
+	if err := c.Query(fmt.Sprintf("show bgp vrf all %s unicast", afi), &vrfs); err != nil {
+		return nil, err
+	}
+	routes := make(map[string]map[string][]Path, len(vrfs))
+	for vrf, table := range vrfs {
+		routes[vrf] = table.Routes
+	}
+	return routes, nil
+}
@@ -0,0 +1,81 @@
+package frr
+
+import (
+	"sort"
+	"testing"
+)
+
+const testBGPSummary = `{
+	"default":{"vrfId":0,"vrfName":"default",
+		"ipv4Unicast":{"routerId":"10.0.0.1","as":64512,"peers":{
+			"192.168.1.2":{"remoteAs":64513,"state":"Established","pfxRcd":4,"peerUptimeMsec":60000},
+			"192.168.1.3":{"remoteAs":64514,"state":"Active"}}},
+		"l2VpnEvpn":{"routerId":"10.0.0.1","as":64512,"peers":{
+			"192.168.1.2":{"remoteAs":64513,"state":"Established","pfxRcd":12}}}},
+	"red":{"vrfId":5,"vrfName":"red"}}`
+
+func TestBGPSessions(t *testing.T) {
+	c := NewClient("r1", fakeRunner(map[string]string{"show bgp vrf all summary json": testBGPSummary}))
+	summaries, err := c.BGPSummary()
+	if err != nil {
+		t.Fatalf("BGPSummary(): %v", err)
+	}
+	if len(summaries) != 1 || len(summaries["default"]) != 2 {
+		t.Errorf("BGPSummary() = %+v, want the two address families of the default VRF", summaries)
+	}
+	sessions, err := c.BGPSessions()
+	if err != nil {
+		t.Fatalf("BGPSessions(): %v", err)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].AFI != sessions[j].AFI {
+			return sessions[i].AFI < sessions[j].AFI
+		}
+		return sessions[i].Neighbor < sessions[j].Neighbor
+	})
+	want := []struct {
+		afi, neighbor, state string
+		pfxRcd               int
+	}{
+		{"ipv4Unicast", "192.168.1.2", "Established", 4},
+		{"ipv4Unicast", "192.168.1.3", "Active", 0},
+		{"l2VpnEvpn", "192.168.1.2", "Established", 12},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("BGPSessions() returned %d sessions, want %d", len(sessions), len(want))
+	}
+	for i, w := range want {
+		s := sessions[i]
+		if s.VRF != "default" || s.AFI != w.afi || s.Neighbor != w.neighbor || s.State != w.state || s.PfxRcd != w.pfxRcd {
+			t.Errorf("session %d = %+v, want %+v", i, s, w)
+		}
+	}
+}
+
+func TestBGPNeighbors(t *testing.T) {
+	c := NewClient("r1", fakeRunner(map[string]string{
+		"show bgp vrf all neighbors json": `{
+			"default":{"vrfId":0,"vrfName":"default",
+				"192.168.1.2":{"bgpState":"Established","remoteAs":64513},
+				"eth1":{"bgpState":"Idle","remoteAs":"external"}}}`,
+		"show bgp vrf red neighbors eth1 json": `{"eth1":{"bgpState":"Connect"}}`,
+		"show bgp vrf red neighbors eth2 json": `{}`,
+	}))
+	neighbors, err := c.BGPNeighbors()
+	if err != nil {
+		t.Fatalf("BGPNeighbors(): %v", err)
+	}
+	states := make(map[string]string)
+	for _, n := range neighbors {
+		states[n.VRF+" "+n.Address] = n.State
+	}
+	if len(states) != 2 || states["default 192.168.1.2"] != "Established" || states["default eth1"] != "Idle" {
+		t.Errorf("BGPNeighbors() states = %v", states)
+	}
+	if n, err := c.BGPNeighbor("red", "eth1"); err != nil || n.State != "Connect" {
+		t.Errorf("BGPNeighbor(red, eth1) = %+v, %v", n, err)
+	}
+	if _, err := c.BGPNeighbor("red", "eth2"); err == nil {
+		t.Error("BGPNeighbor of a missing neighbor succeeded")
+	}
+}
@@ -0,0 +1,280 @@
+package frr
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EVPNPrefix is a prefix of an EVPN table with its paths. RD is empty for
+// the routes of a VNI, which are not keyed by RD.
+type EVPNPrefix struct {
+	RD     string
+	Prefix string
+	Paths  []Path
+}
+
+// EVPNRoutes returns the prefixes of an EVPN table command, e.g. 'show bgp
+// l2vpn evpn route detail' or 'show bgp l2vpn evpn route vni 100'.
+func (c *Client) EVPNRoutes(command string) ([]EVPNPrefix, error) {
+	var top map[string]json.RawMessage
+	if err := c.Query(command, &top); err != nil {
+		return nil, err
+	}
+	// The whole table is keyed by RD then prefix, the routes of a VNI by
+	// prefix; both are mixed with counters.
+	var prefixes []EVPNPrefix
+	for key, raw := range top {
+		if strings.HasPrefix(key, "[") {
+			prefixes = append(prefixes, EVPNPrefix{Prefix: key, Paths: DecodePaths(raw)})
+			continue
+		}
+		var byPrefix map[string]json.RawMessage
+		if json.Unmarshal(raw, &byPrefix) != nil {
+			continue
+		}
+		for prefix, raw := range byPrefix {
+			if strings.HasPrefix(prefix, "[") {
+				prefixes = append(prefixes, EVPNPrefix{RD: key, Prefix: prefix, Paths: DecodePaths(raw)})
+			}
+		}
+	}
+	return prefixes, nil
+}
+
+// VNIPrefixCount returns the number of prefixes of the EVPN table of a VNI.
+func (c *Client) VNIPrefixCount(vni uint32) (int, error) {
+	var table struct {
+		NumPrefix int `json:"numPrefix"`
+	}
+	if err := c.Query(fmt.Sprintf("show bgp l2vpn evpn route vni %d", vni), &table); err != nil {
+		return 0, err
+	}
+	return table.NumPrefix, nil
+}
+
+// DecodePaths decodes the paths of an EVPN prefix, a list of paths or, in
+// some FRR versions, a list of lists of paths.
+func DecodePaths(raw json.RawMessage) []Path {
+	var prefix struct {
+		Paths []json.RawMessage `json:"paths"`
+	}
+	if json.Unmarshal(raw, &prefix) != nil {
+		return nil
+	}
+	var paths []Path
+	for _, p := range prefix.Paths {
+		var nested []json.RawMessage
+		if json.Unmarshal(p, &nested) != nil {
+			nested = []json.RawMessage{p}
+		}
+		for _, n := range nested {
+			var path Path
+			if decodeLoose(n, &path) != nil {
+				continue
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// VNI is a VNI as reported by 'show evpn vni detail json'. L2 and L3 VNIs
+// name their fields differently; fields whose type varies across FRR
+// versions are kept raw.
+type VNI struct {
+	VNI  uint32 `json:"vni"`
+	Type string `json:"type"`
+
+	// L2 VNIs.
+	TenantVRF      string            `json:"tenantVrf"`
+	VxlanInterface string            `json:"vxlanInterface"`
+	SVIInterface   string            `json:"sviInterface"`
+	VTEPIP         string            `json:"vtepIp"`
+	NumMACs        int               `json:"numMacs"`
+	NumARPND       int               `json:"numArpNd"`
+	RemoteVTEPs    []json.RawMessage `json:"remoteVteps"`
+
+	// L3 VNIs.
+	VRF       string   `json:"vrf"`
+	LocalVTEP string   `json:"localVtepIp"`
+	VxlanIntf string   `json:"vxlanIntf"`
+	SVIIntf   string   `json:"sviIntf"`
+	State     string   `json:"state"`
+	RouterMAC string   `json:"routerMac"`
+	L2VNIs    []uint32 `json:"l2Vnis"`
+}
+
+// BoundVRF returns the VRF the VNI is bound to.
+func (v *VNI) BoundVRF() string {
+	if v.VRF != "" {
+		return v.VRF
+	}
+	return v.TenantVRF
+}
+
+// VTEP returns the local VTEP address of the VNI.
+func (v *VNI) VTEP() string {
+	if v.LocalVTEP != "" {
+		return v.LocalVTEP
+	}
+	return v.VTEPIP
+}
+
+// Vxlan returns the VXLAN interface of the VNI.
+func (v *VNI) Vxlan() string {
+	if v.VxlanIntf != "" {
+		return v.VxlanIntf
+	}
+	return v.VxlanInterface
+}
+
+// SVI returns the SVI of the VNI.
+func (v *VNI) SVI() string {
+	if v.SVIIntf != "" {
+		return v.SVIIntf
+	}
+	return v.SVIInterface
+}
+
+// Remotes returns the remote VTEPs of an L2 VNI, listed as addresses or as
+// objects depending on the FRR version.
+func (v *VNI) Remotes() []string {
+	var vteps []string
+	for _, raw := range v.RemoteVTEPs {
+		var ip string
+		if json.Unmarshal(raw, &ip) != nil {
+			var obj struct {
+				IP string `json:"ip"`
+			}
+			if json.Unmarshal(raw, &obj) != nil {
+				continue
+			}
+			ip = obj.IP
+		}
+		vteps = append(vteps, ip)
+	}
+	sort.Strings(vteps)
+	return vteps
+}
+
+// VNIs returns the VNIs of zebra.
+func (c *Client) VNIs() ([]VNI, error) {
+	return QueryList[VNI](c, "show evpn vni detail")
+}
+
+// VRFVNIs returns the L3 VNIs of zebra, by VRF, as 'show vrf vni' reports
+// them; VRFs without a VNI have a zero VNI.
+func (c *Client) VRFVNIs() ([]VNI, error) {
+	var top struct {
+		VRFs []VNI `json:"vrfs"`
+	}
+	if err := c.Query("show vrf vni", &top); err != nil {
+		return nil, err
+	}
+	return top.VRFs, nil
+}
+
+// VNIConfig is a VNI of bgpd with its route targets, as 'show bgp l2vpn
+// evpn vni json' reports the L2 and L3 VNIs.
+type VNIConfig struct {
+	VNI       uint32   `json:"vni"`
+	Type      string   `json:"type"`
+	RD        string   `json:"rd"`
+	TenantVRF string   `json:"tenantVrf"`
+	ImportRTs []string `json:"importRts"`
+	ExportRTs []string `json:"exportRts"`
+}
+
+// VNIConfigs returns the VNIs of bgpd, by VNI.
+func (c *Client) VNIConfigs() ([]*VNIConfig, error) {
+	var top map[string]json.RawMessage
+	if err := c.Query("show bgp l2vpn evpn vni", &top); err != nil {
+		return nil, err
+	}
+	// The VNIs are mixed with the global EVPN settings.
+	var vnis []*VNIConfig
+	for _, raw := range top {
+		var v VNIConfig
+		if json.Unmarshal(raw, &v) != nil || v.VNI == 0 {
+			continue
+		}
+		vnis = append(vnis, &v)
+	}
+	sort.Slice(vnis, func(i, j int) bool { return vnis[i].VNI < vnis[j].VNI })
+	return vnis, nil
+}
+
+// MAC is a MAC of an L2 VNI in zebra, as 'show evpn mac vni all detail json'
+// reports it: learnt locally on an interface, or from a remote VTEP.
+type MAC struct {
+	Type       string `json:"type"`
+	Intf       string `json:"intf"`
+	Vlan       int    `json:"vlan"`
+	ESI        string `json:"esi"`
+	RemoteVTEP string `json:"remoteVtep"`
+	// LocalSequence and RemoteSequence are the MAC mobility sequence
+	// numbers of the local and the remote route, incremented at every
+	// move of the MAC between VTEPs.
+	LocalSequence  uint32 `json:"localSequence"`
+	RemoteSequence uint32 `json:"remoteSequence"`
+	// DetectionCount is the number of moves within the current
+	// duplicate detection window, IsDuplicate whether the MAC is frozen.
+	DetectionCount int  `json:"detectionCount"`
+	IsDuplicate    bool `json:"isDuplicate"`
+	StickyMAC      bool `json:"stickyMac"`
+}
+
+// MACs returns the MACs of every L2 VNI of zebra, by VNI then MAC.
+func (c *Client) MACs() (map[uint32]map[string]MAC, error) {
+	var vnis map[string]json.RawMessage
+	if err := c.Query("show evpn mac vni all detail", &vnis); err != nil {
+		return nil, err
+	}
+	macs := make(map[uint32]map[string]MAC, len(vnis))
+	for key, raw := range vnis {
+		vni, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		var table struct {
+			MACs map[string]json.RawMessage `json:"macs"`
+		}
+		if json.Unmarshal(raw, &table) != nil {
+			continue
+		}
+		byMAC := make(map[string]MAC, len(table.MACs))
+		for mac, raw := range table.MACs {
+			var m MAC
+			if decodeLoose(raw, &m) == nil {
+				byMAC[mac] = m
+			}
+		}
+		macs[uint32(vni)] = byMAC
+	}
+	return macs, nil
+}
+
+// EVPNSettings are the global EVPN settings of zebra, as 'show evpn json'
+// reports them, with the duplicate address detection parameters. The
+// detection times are in seconds; a freeze without time is permanent.
+type EVPNSettings struct {
+	NumVNIs int `json:"numVnis"`
+	// DupDetection is nil when the FRR version does not report it.
+	DupDetection    *bool `json:"isDuplicateAddrDetection"`
+	MaxMoves        int   `json:"maxMoves"`
+	DetectionTime   int   `json:"detectionTime"`
+	DetectionFreeze bool  `json:"isDetectionFreeze"`
+	FreezeTime      int   `json:"detectionFreezeTime"`
+}
+
+// EVPNSettings returns the global EVPN settings of zebra.
+func (c *Client) EVPNSettings() (*EVPNSettings, error) {
+	var settings EVPNSettings
+	if err := c.Query("show evpn", &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
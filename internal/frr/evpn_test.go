@@ -0,0 +1,173 @@
+package frr
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDecodePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantBest []bool
+		wantFrom []string
+	}{
+		{
+			name:     "flat",
+			raw:      `{"paths":[{"valid":true,"bestpath":true,"peerId":"10.0.0.2"},{"valid":true,"peerId":"10.0.0.3"}]}`,
+			wantBest: []bool{true, false},
+			wantFrom: []string{"10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:     "nested detail",
+			raw:      `{"paths":[[{"valid":true,"bestpath":{"overall":true},"peer":{"peerId":"10.0.0.2"}}],[{"valid":true,"bestpath":{"overall":false},"peer":{"peerId":"10.0.0.3"}}]]}`,
+			wantBest: []bool{true, false},
+			wantFrom: []string{"10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:     "mistyped field",
+			raw:      `{"paths":[{"valid":true,"metric":"none","peerId":"10.0.0.2"}]}`,
+			wantBest: []bool{false},
+			wantFrom: []string{"10.0.0.2"},
+		},
+		{name: "no paths", raw: `{"prefix":"[2]:[0]:[48]:[aa:bb:cc:dd:ee:ff]"}`},
+		{name: "not an object", raw: `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var best []bool
+			var from []string
+			for _, p := range DecodePaths(json.RawMessage(tt.raw)) {
+				best = append(best, p.Best())
+				from = append(from, p.From())
+			}
+			if !reflect.DeepEqual(best, tt.wantBest) || !reflect.DeepEqual(from, tt.wantFrom) {
+				t.Errorf("DecodePaths() best %v from %v, want %v %v", best, from, tt.wantBest, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestPathASPathString(t *testing.T) {
+	var brief, detail Path
+	json.Unmarshal([]byte(`{"path":"65001 65002"}`), &brief)
+	json.Unmarshal([]byte(`{"aspath":{"string":"65001 65003"},"path":""}`), &detail)
+	if got := brief.ASPathString(); got != "65001 65002" {
+		t.Errorf("ASPathString() of the brief form = %q", got)
+	}
+	if got := detail.ASPathString(); got != "65001 65003" {
+		t.Errorf("ASPathString() of the detail form = %q", got)
+	}
+}
+
+func TestVNIs(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+	}{
+		// FRR 8 lists the VNIs, later versions key them by VNI.
+		{"list", `[
+			{"vni":100,"type":"L2","tenantVrf":"red","vxlanInterface":"vxlan100","sviInterface":"br100","vtepIp":"10.0.0.1","remoteVteps":["10.0.0.3","10.0.0.2"]},
+			{"vni":1000,"type":"L3","vrf":"red","localVtepIp":"10.0.0.1","vxlanIntf":"vxlan1000","sviIntf":"br1000","l2Vnis":[100]}]`},
+		{"object", `{
+			"1000":{"vni":1000,"type":"L3","vrf":"red","localVtepIp":"10.0.0.1","vxlanIntf":"vxlan1000","sviIntf":"br1000","l2Vnis":[100]},
+			"100":{"vni":100,"type":"L2","tenantVrf":"red","vxlanInterface":"vxlan100","sviInterface":"br100","vtepIp":"10.0.0.1","remoteVteps":[{"ip":"10.0.0.3"},{"ip":"10.0.0.2"}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient("r1", fakeRunner(map[string]string{"show evpn vni detail json": tt.out}))
+			vnis, err := c.VNIs()
+			if err != nil {
+				t.Fatalf("VNIs(): %v", err)
+			}
+			if len(vnis) != 2 {
+				t.Fatalf("VNIs() returned %d VNIs, want 2", len(vnis))
+			}
+			sort.Slice(vnis, func(i, j int) bool { return vnis[i].VNI < vnis[j].VNI })
+			for _, v := range vnis {
+				if v.BoundVRF() != "red" || v.VTEP() != "10.0.0.1" {
+					t.Errorf("VNI %d: VRF %q, VTEP %q", v.VNI, v.BoundVRF(), v.VTEP())
+				}
+			}
+			l2, l3 := vnis[0], vnis[1]
+			if l2.Vxlan() != "vxlan100" || l2.SVI() != "br100" || l3.Vxlan() != "vxlan1000" || l3.SVI() != "br1000" {
+				t.Errorf("interfaces: %s %s %s %s", l2.Vxlan(), l2.SVI(), l3.Vxlan(), l3.SVI())
+			}
+			if got := l2.Remotes(); !reflect.DeepEqual(got, []string{"10.0.0.2", "10.0.0.3"}) {
+				t.Errorf("Remotes() = %v", got)
+			}
+		})
+	}
+}
+
+func TestEVPNRoutes(t *testing.T) {
+	c := NewClient("r1", fakeRunner(map[string]string{
+		"show bgp l2vpn evpn route detail json": `{
+			"10.0.0.2:2":{"rd":"10.0.0.2:2","[2]:[0]:[48]:[aa:bb:cc:dd:ee:ff]":{"paths":[{"valid":true}]}},
+			"numPrefix":1,"numPaths":1}`,
+		"show bgp l2vpn evpn route vni 100 json": `{
+			"[3]:[0]:[32]:[10.0.0.2]":{"paths":[[{"valid":true}],[{"valid":true}]]},
+			"numPrefix":1,"numPaths":2}`,
+	}))
+	tests := []struct {
+		command string
+		want    EVPNPrefix
+	}{
+		{"show bgp l2vpn evpn route detail", EVPNPrefix{RD: "10.0.0.2:2", Prefix: "[2]:[0]:[48]:[aa:bb:cc:dd:ee:ff]", Paths: make([]Path, 1)}},
+		{"show bgp l2vpn evpn route vni 100", EVPNPrefix{Prefix: "[3]:[0]:[32]:[10.0.0.2]", Paths: make([]Path, 2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			prefixes, err := c.EVPNRoutes(tt.command)
+			if err != nil {
+				t.Fatalf("EVPNRoutes(): %v", err)
+			}
+			if len(prefixes) != 1 {
+				t.Fatalf("EVPNRoutes() = %+v, want a single prefix", prefixes)
+			}
+			got := prefixes[0]
+			if got.RD != tt.want.RD || got.Prefix != tt.want.Prefix || len(got.Paths) != len(tt.want.Paths) {
+				t.Errorf("EVPNRoutes() = %s %s with %d paths, want %s %s with %d", got.RD, got.Prefix, len(got.Paths), tt.want.RD, tt.want.Prefix, len(tt.want.Paths))
+			}
+		})
+	}
+}
+
+func TestMACs(t *testing.T) {
+	c := NewClient("r1", fakeRunner(map[string]string{
+		"show evpn mac vni all detail json": `{
+			"100":{"numMacs":2,"macs":{
+				"aa:bb:cc:dd:ee:01":{"type":"local","intf":"eth1","vlan":100,"localSequence":1},
+				"aa:bb:cc:dd:ee:02":{"type":"remote","remoteVtep":"10.0.0.2","remoteSequence":3,"isDuplicate":true}}},
+			"vniCount":1}`,
+	}))
+	macs, err := c.MACs()
+	if err != nil {
+		t.Fatalf("MACs(): %v", err)
+	}
+	want := map[uint32]map[string]MAC{100: {
+		"aa:bb:cc:dd:ee:01": {Type: "local", Intf: "eth1", Vlan: 100, LocalSequence: 1},
+		"aa:bb:cc:dd:ee:02": {Type: "remote", RemoteVTEP: "10.0.0.2", RemoteSequence: 3, IsDuplicate: true},
+	}}
+	if !reflect.DeepEqual(macs, want) {
+		t.Errorf("MACs() = %+v, want %+v", macs, want)
+	}
+}
+
+func TestVNIConfigs(t *testing.T) {
+	c := NewClient("r1", fakeRunner(map[string]string{
+		"show bgp l2vpn evpn vni json": `{
+			"advertiseGatewayMacip":"Disabled","numVnis":2,
+			"1000":{"vni":1000,"type":"L3","rd":"10.0.0.1:3","importRts":["64512:1000"],"exportRts":["64512:1000"]},
+			"100":{"vni":100,"type":"L2","rd":"10.0.0.1:2","importRts":["64512:100"],"exportRts":["64512:100"]}}`,
+	}))
+	vnis, err := c.VNIConfigs()
+	if err != nil {
+		t.Fatalf("VNIConfigs(): %v", err)
+	}
+	if len(vnis) != 2 || vnis[0].VNI != 100 || vnis[1].VNI != 1000 || vnis[0].RD != "10.0.0.1:2" {
+		t.Errorf("VNIConfigs() = %+v, want VNIs 100 and 1000 in order", vnis)
+	}
+}
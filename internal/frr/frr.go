@@ -0,0 +1,97 @@
+// Package frr runs vtysh commands in their JSON form and decodes their
+// output into the types shared by the BGP, EVPN and RIB tools.
+//
+// FRR renders the same objects differently across versions and commands:
+// the types keep the fields whose shape varies raw, and their methods
+// normalize them.
+package frr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Runner runs a vtysh command and returns its output.
+type Runner func(command string) ([]byte, error)
+
+// Client queries the FRR instance of a router.
+type Client struct {
+	router string
+	run    Runner
+}
+
+// NewClient returns a client of the FRR instance of a router, running its
+// commands with run.
+func NewClient(router string, run Runner) *Client {
+	return &Client{router: router, run: run}
+}
+
+// Query runs a show command with its JSON output and decodes it into v.
+func (c *Client) Query(command string, v any) error {
+	if !strings.HasSuffix(command, " json") {
+		command += " json"
+	}
+	out, err := c.run(command)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("parsing %q on %s: %w", command, c.router, err)
+	}
+	return nil
+}
+
+// QueryList runs a show command whose output is either a list or an object
+// keyed by name, depending on the FRR version, and decodes its entries.
+func QueryList[T any](c *Client, command string) ([]T, error) {
+	var raw json.RawMessage
+	if err := c.Query(command, &raw); err != nil {
+		return nil, err
+	}
+	list, err := DecodeList[T](raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q on %s: %w", command, c.router, err)
+	}
+	return list, nil
+}
+
+// DecodeList decodes FRR JSON output that is either a list or an object
+// keyed by name, depending on the FRR version. Empty output means no entries.
+func DecodeList[T any](data []byte) ([]T, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	var list []T
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var byKey map[string]T
+	if err := json.Unmarshal(data, &byKey); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		list = append(list, byKey[k])
+	}
+	return list, nil
+}
+
+// decodeLoose decodes an object, ignoring the fields whose type differs
+// from the one expected, which some FRR versions change.
+func decodeLoose(raw json.RawMessage, v any) error {
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(raw, v); err != nil && !errors.As(err, &typeErr) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package frr
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner returns a Runner answering commands from outputs, failing for
+// the others.
+func fakeRunner(outputs map[string]string) Runner {
+	return func(command string) ([]byte, error) {
+		out, ok := outputs[command]
+		if !ok {
+			return nil, errors.New("unexpected command " + command)
+		}
+		return []byte(out), nil
+	}
+}
+
+func TestQuery(t *testing.T) {
+	c := NewClient("r1", fakeRunner(map[string]string{
+		"show evpn json":    `{"numVnis": 2}`,
+		"show vrf vni json": "  \n",
+		"show bgp json":     `% Unknown command`,
+	}))
+
+	var settings EVPNSettings
+	if err := c.Query("show evpn", &settings); err != nil || settings.NumVNIs != 2 {
+		t.Errorf("Query(show evpn) = %+v, %v", settings, err)
+	}
+	if err := c.Query("show evpn json", &settings); err != nil {
+		t.Errorf("Query with the json suffix: %v", err)
+	}
+	var empty map[string]any
+	if err := c.Query("show vrf vni", &empty); err != nil || empty != nil {
+		t.Errorf("Query of empty output = %v, %v, want nothing decoded", empty, err)
+	}
+	err := c.Query("show bgp", &empty)
+	if err == nil || !strings.Contains(err.Error(), `"show bgp json" on r1`) {
+		t.Errorf("Query of non-JSON output = %v, want an error naming the command and router", err)
+	}
+	if err := c.Query("show ip route", &empty); err == nil {
+		t.Error("Query succeeded though the command failed")
+	}
+}
+
+func TestDecodeList(t *testing.T) {
+	type entry struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    []entry
+		wantErr bool
+	}{
+		{"list", `[{"name":"b"},{"name":"a"}]`, []entry{{"b"}, {"a"}}, false},
+		{"object sorted by key", `{"vrf2":{"name":"b"},"vrf1":{"name":"a"}}`, []entry{{"a"}, {"b"}}, false},
+		{"empty list", `[]`, []entry{}, false},
+		{"empty output", " \n", nil, false},
+		{"scalar", `42`, nil, true},
+		{"invalid", `{"vrf1":`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeList[entry]([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeList(%s) error = %v, want error %v", tt.data, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeList(%s) = %+v, want %+v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLoose(t *testing.T) {
+	var m MAC
+	// Some FRR versions render the VLAN as a string.
+	if err := decodeLoose([]byte(`{"type":"remote","vlan":"none","remoteVtep":"10.0.0.2"}`), &m); err != nil {
+		t.Fatalf("decodeLoose with a mistyped field: %v", err)
+	}
+	if m.Type != "remote" || m.RemoteVTEP != "10.0.0.2" {
+		t.Errorf("decodeLoose = %+v, want the other fields decoded", m)
+	}
+	if err := decodeLoose([]byte(`{"type":`), &m); err == nil {
+		t.Error("decodeLoose of invalid JSON succeeded")
+	}
+}
@@ -0,0 +1,87 @@
+package frr
+
+import "fmt"
+
+// Nexthop is a nexthop of a RIB route.
+type Nexthop struct {
+	IP            string `json:"ip"`
+	InterfaceName string `json:"interfaceName"`
+	Active        bool   `json:"active"`
+	FIB           bool   `json:"fib"`
+}
+
+func (nh Nexthop) String() string {
+	via := nh.IP
+	if via == "" {
+		via = "directly connected"
+	}
+	if nh.InterfaceName != "" {
+		via += " dev " + nh.InterfaceName
+	}
+	return via
+}
+
+// Route is a route of the RIB of zebra.
+type Route struct {
+	Prefix    string    `json:"prefix"`
+	Protocol  string    `json:"protocol"`
+	Selected  bool      `json:"selected"`
+	Installed bool      `json:"installed"`
+	Distance  int       `json:"distance"`
+	Metric    int       `json:"metric"`
+	Uptime    string    `json:"uptime"`
+	Nexthops  []Nexthop `json:"nexthops"`
+}
+
+// Routes returns the routes of an address family ("ip" or "ipv6") of a VRF,
+// or of all VRFs when vrf is empty, by VRF.
+func (c *Client) Routes(family, vrf string) (map[string][]Route, error) {
+	byVRF := make(map[string][]Route)
+	if vrf == "" {
+		var vrfs map[string]map[string][]Route
+		if err := c.Query(fmt.Sprintf("show %s route vrf all", family), &vrfs); err != nil {
+			return nil, err
+		}
+		for name, prefixes := range vrfs {
+			for _, rs := range prefixes {
+				byVRF[name] = append(byVRF[name], rs...)
+			}
+		}
+		return byVRF, nil
+	}
+
+	var prefixes map[string][]Route
+	if err := c.Query(fmt.Sprintf("show %s route vrf %s", family, vrf), &prefixes); err != nil {
+		return nil, err
+	}
+	for _, rs := range prefixes {
+		byVRF[vrf] = append(byVRF[vrf], rs...)
+	}
+	return byVRF, nil
+}
+
+// Route returns the routes of a VRF looked up for a prefix or an address, by
+// prefix, as 'show ip route vrf <vrf> <prefix>' finds them.
+func (c *Client) Route(family, vrf, prefix string) (map[string][]Route, error) {
+	var prefixes map[string][]Route
+	if err := c.Query(fmt.Sprintf("show %s route vrf %s %s", family, vrf, prefix), &prefixes); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
+
+// RouteSummary is the summary of the RIB of a VRF.
+type RouteSummary struct {
+	RoutesTotal    int `json:"routesTotal"`
+	RoutesTotalFIB int `json:"routesTotalFib"`
+}
+
+// RouteSummary returns the summary of the RIB of an address family ("ip" or
+// "ipv6") of a VRF.
+func (c *Client) RouteSummary(family, vrf string) (*RouteSummary, error) {
+	var summary RouteSummary
+	if err := c.Query(fmt.Sprintf("show %s route vrf %s summary", family, vrf), &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Minimal views of the Kubernetes API objects the tools inspect. Only the
+// fields that are actually used are decoded.
+
+type objectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type labelSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+type labelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels"`
+	MatchExpressions []labelSelectorRequirement `json:"matchExpressions"`
+}
+
+// matches implements the Kubernetes label selector semantics. A nil selector
+// matches nothing, an empty one matches everything.
+func (sel *labelSelector) matches(labels map[string]string) bool {
+	if sel == nil {
+		return false
+	}
+	for k, v := range sel.MatchLabels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for _, req := range sel.MatchExpressions {
+		value, exists := labels[req.Key]
+		switch req.Operator {
+		case "In":
+			if !exists || !containsString(req.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if exists && containsString(req.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !exists {
+				return false
+			}
+		case "DoesNotExist":
+			if exists {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type containerPort struct {
+	Name          string `json:"name"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+}
+
+type pod struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Name  string          `json:"name"`
+			Ports []containerPort `json:"ports"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase  string `json:"phase"`
+		PodIPs []struct {
+			IP string `json:"ip"`
+		} `json:"podIPs"`
+	} `json:"status"`
+}
+
+func (p *pod) key() string {
+	return p.Metadata.Namespace + "/" + p.Metadata.Name
+}
+
+// multusNetworkStatus is an entry of the k8s.v1.cni.cncf.io/network-status
+// annotation Multus sets on pods with secondary interfaces.
+type multusNetworkStatus struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface"`
+	IPs       []string `json:"ips"`
+	Default   bool     `json:"default"`
+}
+
+const (
+	multusNetworksAnnotation      = "k8s.v1.cni.cncf.io/networks"
+	multusNetworkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+)
+
+// secondaryNetworks returns the Multus networks attached to the pod besides
+// the cluster default network. These are the interfaces openperouter
+// connects to the fabric.
+func (p *pod) secondaryNetworks() []multusNetworkStatus {
+	var statuses []multusNetworkStatus
+	if raw, ok := p.Metadata.Annotations[multusNetworkStatusAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &statuses); err == nil {
+			var secondary []multusNetworkStatus
+			for _, st := range statuses {
+				if !st.Default {
+					secondary = append(secondary, st)
+				}
+			}
+			return secondary
+		}
+	}
+	if raw := p.Metadata.Annotations[multusNetworksAnnotation]; raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			statuses = append(statuses, multusNetworkStatus{Name: strings.TrimSpace(name)})
+		}
+	}
+	return statuses
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+type namespace struct {
+	Metadata objectMeta `json:"metadata"`
+}
+
+type namespaceList struct {
+	Items []namespace `json:"items"`
+}
+
+// kubectl runs kubectl against the given kind cluster, or against the current
+// context when cluster is empty.
+func kubectl(cluster string, args ...string) ([]byte, error) {
+	if cluster != "" {
+		args = append([]string{"--context", "kind-" + cluster}, args...)
+	}
+	cmd := exec.Command("kubectl", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("kubectl %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("kubectl %s: %w", strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// kubectlGetJSON runs "kubectl get <args> -o json" and decodes the result.
+func kubectlGetJSON(cluster string, into any, args ...string) error {
+	out, err := kubectl(cluster, append(append([]string{"get"}, args...), "-o", "json")...)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(out, into)
+}
+
+// kindNode is a node container of a kind cluster.
+type kindNode struct {
+	Name    string
+	Cluster string
+}
+
+// kindNodes lists the running kind node containers, optionally restricted to
+// a single cluster, using the labels kind puts on them.
+func kindNodes(cluster string) ([]kindNode, error) {
+	filter := "label=io.x-k8s.kind.cluster"
+	if cluster != "" {
+		filter += "=" + cluster
+	}
+	out, err := exec.Command("docker", "ps", "--filter", filter,
+		"--format", `{{.Names}} {{.Label "io.x-k8s.kind.cluster"}}`).Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing kind nodes: %w", err)
+	}
+
+	var nodes []kindNode
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, clusterName, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		nodes = append(nodes, kindNode{Name: name, Cluster: clusterName})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
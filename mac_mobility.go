@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// defaultMACMobilityLimit bounds the MACs check_mac_mobility lists, when not
+// given.
+const defaultMACMobilityLimit = 100
+
+// macMobility is a MAC of an L2 VNI, with what each router knows of it.
+type macMobility struct {
+	vni     uint32
+	mac     string
+	entries map[string]frr.MAC
+	state   string
+}
+
+func (m *macMobility) routers() []string {
+	routers := make([]string, 0, len(m.entries))
+	for r := range m.entries {
+		routers = append(routers, r)
+	}
+	sort.Strings(routers)
+	return routers
+}
+
+// localOn returns the routers that learnt the MAC locally.
+func (m *macMobility) localOn() []string {
+	var routers []string
+	for _, r := range m.routers() {
+		if m.entries[r].Type == "local" {
+			routers = append(routers, r)
+		}
+	}
+	return routers
+}
+
+// multihomed tells whether the MAC is local on several routers through the
+// same Ethernet Segment, which is not a move.
+func (m *macMobility) multihomed() bool {
+	esi := ""
+	for _, r := range m.localOn() {
+		e := m.entries[r].ESI
+		if e == "" || esi != "" && e != esi {
+			return false
+		}
+		esi = e
+	}
+	return esi != ""
+}
+
+// remoteVTEPs returns the VTEPs the routers see the MAC behind.
+func (m *macMobility) remoteVTEPs() []string {
+	var vteps []string
+	for _, r := range m.routers() {
+		if v := m.entries[r].RemoteVTEP; v != "" && !containsString(vteps, v) {
+			vteps = append(vteps, v)
+		}
+	}
+	sort.Strings(vteps)
+	return vteps
+}
+
+// seqOf returns the sequence number a router has for the MAC: the one of its
+// own route when local, the one of the route it received otherwise.
+func seqOf(e frr.MAC) uint32 {
+	if e.Type == "local" {
+		return e.LocalSequence
+	}
+	return e.RemoteSequence
+}
+
+// sequence returns the highest sequence number of the MAC, the number of
+// times it moved.
+func (m *macMobility) sequence() uint32 {
+	var seq uint32
+	for _, e := range m.entries {
+		seq = max(seq, e.LocalSequence, e.RemoteSequence)
+	}
+	return seq
+}
+
+// detections returns the highest number of moves within the duplicate
+// detection window.
+func (m *macMobility) detections() int {
+	n := 0
+	for _, e := range m.entries {
+		n = max(n, e.DetectionCount)
+	}
+	return n
+}
+
+// duplicateOn returns the routers that froze the MAC as a duplicate.
+func (m *macMobility) duplicateOn() []string {
+	var routers []string
+	for _, r := range m.routers() {
+		if m.entries[r].IsDuplicate {
+			routers = append(routers, r)
+		}
+	}
+	return routers
+}
+
+// stale returns the routers whose sequence number is behind the highest
+// one, which have not seen the last move.
+func (m *macMobility) stale() []string {
+	seq := m.sequence()
+	var routers []string
+	for _, r := range m.routers() {
+		if seqOf(m.entries[r]) < seq {
+			routers = append(routers, r)
+		}
+	}
+	return routers
+}
+
+// macStateOrder sorts the MACs, the most severe first.
+var macStateOrder = map[string]int{"frozen": 0, "flapping": 1, "moved": 2, "stable": 3}
+
+func (s *MCPServer) checkMACMobility(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	only := uint32(0)
+	if v, ok := args["vni"].(float64); ok {
+		if v < 1 || v >= 1<<24 || v != float64(int(v)) {
+			return toolError("vni must be between 1 and 16777215")
+		}
+		only = uint32(v)
+	}
+	onlyMAC := ""
+	if v, _ := args["mac"].(string); v != "" {
+		hw, err := net.ParseMAC(v)
+		if err != nil || len(hw) != 6 {
+			return toolError(fmt.Sprintf("invalid mac %q", v))
+		}
+		onlyMAC = hw.String()
+	}
+	all, _ := args["all"].(bool)
+	limit := defaultMACMobilityLimit
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	routers, err := vniRouters(glob)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	routerTable := newTable("dup_detection", "router", "enabled", "max_moves", "detection_time", "freeze", "freeze_time", "macs")
+	macs := make(map[string]*macMobility)
+	var findings, noDetection []string
+	settingsOf := make(map[string]string)
+	failed := 0
+	for _, router := range routers {
+		client := frrClient(router)
+		byVNI, err := client.MACs()
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		count := 0
+		for vni, entries := range byVNI {
+			if only != 0 && vni != only {
+				continue
+			}
+			for mac, e := range entries {
+				if onlyMAC != "" && !strings.EqualFold(mac, onlyMAC) {
+					continue
+				}
+				key := fmt.Sprintf("%d %s", vni, strings.ToLower(mac))
+				m, ok := macs[key]
+				if !ok {
+					m = &macMobility{vni: vni, mac: strings.ToLower(mac), entries: make(map[string]frr.MAC)}
+					macs[key] = m
+				}
+				m.entries[router] = e
+				count++
+			}
+		}
+
+		settings, err := client.EVPNSettings()
+		if err != nil {
+			fmt.Fprintf(&b, "  (duplicate detection settings of %s unavailable: %v)\n", router, err)
+			routerTable.add(router, nil, nil, nil, nil, nil, count)
+			continue
+		}
+		var enabled any
+		if settings.DupDetection != nil {
+			enabled = *settings.DupDetection
+			if !*settings.DupDetection {
+				noDetection = append(noDetection, router)
+			}
+		}
+		freeze := settings.DetectionFreeze || settings.FreezeTime > 0
+		routerTable.add(router, enabled, settings.MaxMoves, settings.DetectionTime, freeze, settings.FreezeTime, count)
+		if enabled != false {
+			settingsOf[router] = fmt.Sprintf("%d moves in %ds", settings.MaxMoves, settings.DetectionTime)
+		}
+	}
+
+	if len(noDetection) > 0 {
+		findings = append(findings, fmt.Sprintf("duplicate address detection is disabled on %s: MACs flapping between VTEPs are never frozen there", strings.Join(noDetection, ", ")))
+	}
+	var variants []string
+	for _, router := range routers {
+		if v, ok := settingsOf[router]; ok && !containsString(variants, v) {
+			variants = append(variants, v)
+		}
+	}
+	if len(variants) > 1 {
+		var per []string
+		for _, router := range routers {
+			if v, ok := settingsOf[router]; ok {
+				per = append(per, router+" "+v)
+			}
+		}
+		findings = append(findings, "duplicate detection thresholds differ between routers: "+strings.Join(per, ", "))
+	}
+
+	list := make([]*macMobility, 0, len(macs))
+	counts := make(map[string]int)
+	vnis := make(map[uint32]bool)
+	for _, m := range macs {
+		vnis[m.vni] = true
+		local := m.localOn()
+		switch {
+		case len(m.duplicateOn()) > 0:
+			m.state = "frozen"
+		case m.detections() > 0, len(local) > 1 && !m.multihomed(), len(m.remoteVTEPs()) > 1:
+			m.state = "flapping"
+		case m.sequence() > 0:
+			m.state = "moved"
+		default:
+			m.state = "stable"
+		}
+		counts[m.state]++
+		if all || m.state != "stable" {
+			list = append(list, m)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, z := list[i], list[j]
+		if a.state != z.state {
+			return macStateOrder[a.state] < macStateOrder[z.state]
+		}
+		if a.sequence() != z.sequence() {
+			return a.sequence() > z.sequence()
+		}
+		if a.vni != z.vni {
+			return a.vni < z.vni
+		}
+		return a.mac < z.mac
+	})
+	listed := len(list)
+	truncated := listed > limit
+	if truncated {
+		list = list[:limit]
+	}
+
+	macTable := newTable("macs", "vni", "mac", "state", "local_on", "remote_vteps", "sequence", "detection_count", "duplicate_on", "stale_on")
+	entryTable := newTable("entries", "router", "vni", "mac", "type", "interface", "esi", "remote_vtep", "local_sequence", "remote_sequence", "detection_count", "duplicate")
+	var lines []string
+	for _, m := range list {
+		local, vteps, dups, stale := m.localOn(), m.remoteVTEPs(), m.duplicateOn(), m.stale()
+		macTable.add(m.vni, m.mac, m.state, local, vteps, m.sequence(), m.detections(), dups, stale)
+		for _, r := range m.routers() {
+			e := m.entries[r]
+			entryTable.add(r, m.vni, m.mac, e.Type, e.Intf, e.ESI, e.RemoteVTEP, e.LocalSequence, e.RemoteSequence, e.DetectionCount, e.IsDuplicate)
+		}
+
+		mark := "✓"
+		switch m.state {
+		case "frozen", "flapping":
+			mark = "✗"
+		case "moved":
+			mark = " "
+		}
+		line := fmt.Sprintf("  %s VNI %-8d %s %-8s sequence %d", mark, m.vni, m.mac, m.state, m.sequence())
+		if n := m.detections(); n > 0 {
+			line += fmt.Sprintf(", %d move(s) in the detection window", n)
+		}
+		if len(local) > 0 {
+			line += ", local on " + strings.Join(local, ", ")
+		}
+		if len(vteps) > 0 {
+			line += ", behind " + strings.Join(vteps, ", ")
+		}
+		if len(dups) > 0 {
+			line += ", frozen on " + strings.Join(dups, ", ")
+		}
+		lines = append(lines, line)
+
+		switch {
+		case len(dups) > 0:
+			findings = append(findings, fmt.Sprintf("MAC %s of VNI %d is frozen by duplicate detection on %s after %d move(s): remove the duplicate, then run 'clear evpn dup-addr vni %d mac %s'", m.mac, m.vni, strings.Join(dups, ", "), max(m.detections(), int(m.sequence())), m.vni, m.mac))
+		case len(local) > 1 && !m.multihomed():
+			findings = append(findings, fmt.Sprintf("MAC %s of VNI %d is local on %s at the same time: the same MAC is used behind several leaves (cloned VM or misconfigured tenant)", m.mac, m.vni, strings.Join(local, ", ")))
+		case m.detections() > 0:
+			findings = append(findings, fmt.Sprintf("MAC %s of VNI %d moved %d time(s) within the detection window (sequence %d): it is flapping between VTEPs", m.mac, m.vni, m.detections(), m.sequence()))
+		case len(vteps) > 1:
+			findings = append(findings, fmt.Sprintf("routers see MAC %s of VNI %d behind different VTEPs (%s): it moved recently or is flapping", m.mac, m.vni, strings.Join(vteps, ", ")))
+		}
+		if m.state != "stable" && len(stale) > 0 && len(dups) == 0 {
+			findings = append(findings, fmt.Sprintf("MAC %s of VNI %d is at sequence %d, but %s did not see its last move", m.mac, m.vni, m.sequence(), strings.Join(stale, ", ")))
+		}
+	}
+
+	summary := fmt.Sprintf("%d MAC(s) of %d VNI(s) on %d router(s): %d frozen, %d flapping, %d moved, %d stable",
+		len(macs), len(vnis), len(routers)-failed, counts["frozen"], counts["flapping"], counts["moved"], counts["stable"])
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	switch {
+	case len(lines) > 0:
+		text += "\n" + strings.Join(lines, "\n") + "\n"
+		if truncated {
+			text += fmt.Sprintf("  ... %d more (raise limit)\n", listed-limit)
+		}
+	case failed < len(routers):
+		text += "\n✓ No MAC moved between VTEPs\n"
+	}
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("total_macs", len(macs))
+	fields.add("frozen", counts["frozen"])
+	fields.add("flapping", counts["flapping"])
+	fields.add("moved", counts["moved"])
+	fields.add("truncated", truncated)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, routerTable, macTable, entryTable)
+}
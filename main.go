@@ -1,30 +1,33 @@
 package main
 
 import (
-	"bufio"
-	"context"
 	_ "embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
+	"unicode"
 )
 
 //go:embed scripts/extract-leaf-configs.sh
 var extractLeafConfigsScript string
 
-//go:embed scripts/capture-traffic.sh
-var captureTrafficScript string
-
 type JSONRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      any             `json:"id,omitempty"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
+	// Result and Error are set on the responses of the client to the
+	// requests of the server.
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
 }
 
 type JSONRPCResponse struct {
@@ -55,10 +58,14 @@ type InitializeResult struct {
 	ProtocolVersion string             `json:"protocolVersion"`
 	Capabilities    ServerCapabilities `json:"capabilities"`
 	ServerInfo      ServerInfo         `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
 }
 
 type ServerCapabilities struct {
-	Tools map[string]any `json:"tools,omitempty"`
+	Tools     map[string]any `json:"tools,omitempty"`
+	Resources map[string]any `json:"resources,omitempty"`
+	// Logging is advertised so clients expect notifications/message.
+	Logging *struct{} `json:"logging,omitempty"`
 }
 
 type ServerInfo struct {
@@ -67,9 +74,37 @@ type ServerInfo struct {
 }
 
 type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema InputSchema `json:"inputSchema"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	InputSchema InputSchema      `json:"inputSchema"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations describe how a tool behaves, so hosts can decide which
+// calls need a confirmation. None of the tools reach outside the lab.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    bool   `json:"readOnlyHint"`
+	DestructiveHint bool   `json:"destructiveHint"`
+	IdempotentHint  bool   `json:"idempotentHint"`
+	OpenWorldHint   bool   `json:"openWorldHint"`
+}
+
+// readOnlyTool annotates a tool that only inspects the lab.
+func readOnlyTool(title string) *ToolAnnotations {
+	return &ToolAnnotations{Title: title, ReadOnlyHint: true, IdempotentHint: true}
+}
+
+// writingTool annotates a tool that changes the lab or writes files on the
+// host, without destroying anything.
+func writingTool(title string, idempotent bool) *ToolAnnotations {
+	return &ToolAnnotations{Title: title, IdempotentHint: idempotent}
+}
+
+// destructiveTool annotates a tool that deletes files on the host or
+// disrupts the lab.
+func destructiveTool(title string) *ToolAnnotations {
+	return &ToolAnnotations{Title: title, DestructiveHint: true}
 }
 
 type InputSchema struct {
@@ -89,41 +124,306 @@ type CallToolParams struct {
 
 type CallToolResult struct {
 	Content []ContentItem `json:"content"`
-	IsError bool          `json:"isError,omitempty"`
+	// StructuredContent is the result as a JSON object, only sent to the
+	// clients speaking structuredProtocolVersion.
+	StructuredContent any  `json:"structuredContent,omitempty"`
+	IsError           bool `json:"isError,omitempty"`
 }
 
 type ContentItem struct {
 	Type string `json:"type"`
 	Text string `json:"text"`
+	// Resource is the content of an embedded resource item, of type
+	// "resource".
+	Resource    *ResourceContents `json:"resource,omitempty"`
+	Annotations *Annotations      `json:"annotations,omitempty"`
+}
+
+// Annotations tell the host who a content item is meant for and how
+// important it is, so verbose script output can be kept for the model while
+// summaries are shown to the user.
+type Annotations struct {
+	Audience []string `json:"audience,omitempty"`
+	Priority float64  `json:"priority,omitempty"`
+}
+
+// summaryContent is a short result meant for both the user and the model.
+func summaryContent(text string) ContentItem {
+	return ContentItem{
+		Type: "text",
+		Text: text,
+		Annotations: &Annotations{
+			Audience: []string{"user", "assistant"},
+			Priority: 1,
+		},
+	}
+}
+
+// rawOutputContent is verbose script output, only useful to the model.
+func rawOutputContent(text string) ContentItem {
+	return ContentItem{
+		Type: "text",
+		Text: text,
+		Annotations: &Annotations{
+			Audience: []string{"assistant"},
+			Priority: 0.2,
+		},
+	}
 }
 
 type ActiveCall struct {
-	ID     any
-	Cancel context.CancelFunc
-	Cmd    *exec.Cmd
+	// CaptureID is the server-generated identifier returned to the client,
+	// which stop_traffic_capture accepts to stop this capture alone.
+	CaptureID string
+	ID        any
+	SessionID string
+	OutputDir string
+	// Run orchestrates the tshark processes of the capture.
+	Run *captureRun
+	// Done is closed once tshark stopped on every node and the files were
+	// copied out.
+	Done chan struct{}
+	// Filter is the effective tshark capture filter, and NodeFilters the
+	// one of the nodes given their own, which names their files.
+	Filter      string
+	NodeFilters map[string]string
+	// Interfaces lists, per node, the interfaces captured on; nodes absent
+	// from it capture on all interfaces.
+	Interfaces map[string][]string
+	Started    time.Time
+	// StopAt is when the server stops the capture on its own, zero unless
+	// a duration was given.
+	StopAt time.Time
+	// MaxPackets is the number of packets after which tshark stops on each
+	// node, zero when unlimited.
+	MaxPackets int
+	// FileSizeKB and NumFiles describe the ring buffer tshark writes on
+	// each node, zero for a single file.
+	FileSizeKB int
+	NumFiles   int
+	// Live forwards the packet summaries of the capture to the session,
+	// nil unless they were asked for.
+	Live *liveSummaries
+	// Nodes, PIDs and Finished are guarded by MCPServer.mu: nodes are added
+	// with the PID of their tshark, inside their container, as it starts,
+	// Finished is set once the files are copied out.
+	Nodes    []string
+	PIDs     map[string]int
+	Finished time.Time
+	// Manifest lists the files copied out with their checksums, set before
+	// Done is closed; nil if it could not be written.
+	Manifest *captureManifest
+	// RecoveredFrom is the PID of the server the capture was started by,
+	// when adopted after that server died, zero otherwise.
+	RecoveredFrom int
+	// Label names the capture for its user, typically the e2e test case it
+	// was taken for.
+	Label string
+}
+
+// nodeFilter returns the capture filter of a node of the capture.
+func (c *ActiveCall) nodeFilter(node string) string {
+	if filter, ok := c.NodeFilters[node]; ok {
+		return filter
+	}
+	return c.Filter
+}
+
+// defaultCaptureFilter is the filter captures apply when none is given.
+const defaultCaptureFilter = "icmp"
+
+// maxFinishedCaptures bounds the finished captures kept for
+// list_traffic_captures.
+const maxFinishedCaptures = 20
+
+// defaultRingFiles is the number of files kept per node by a ring buffer
+// capture when num_files is not given.
+const defaultRingFiles = 10
+
+// maxCaptureLabel bounds the length of capture labels, and maxLabelSlug the
+// part of them kept in directory names.
+const (
+	maxCaptureLabel = 256
+	maxLabelSlug    = 64
+)
+
+// captureLogName is the file the progress of a capture, node by node, is
+// logged to in the output directory.
+const captureLogName = "capture.log"
+
+// stdioSessionID identifies the single session served over stdio.
+const stdioSessionID = "stdio"
+
+// sessionInfo describes an open session and the transport serving it.
+type sessionInfo struct {
+	Transport string
+	Opened    time.Time
+	// notify sends a notification to the client, nil when the transport
+	// cannot push messages.
+	notify func(data []byte)
+	// Elicitation is set when the client can be asked for confirmations.
+	Elicitation bool
+	// ProtocolVersion is the protocol version negotiated on initialize.
+	ProtocolVersion string
 }
 
 type MCPServer struct {
+	// activeCalls is keyed by the server-generated capture ID, so that
+	// clients reusing request IDs cannot clobber each other's captures.
 	activeCalls map[string]*ActiveCall
-	mu          sync.Mutex
-	writer      io.Writer
+	// finishedCaptures holds the most recently finished captures, oldest
+	// first.
+	finishedCaptures []*ActiveCall
+	// inFlight holds, per session, the IDs of the requests being handled.
+	inFlight map[string]map[string]bool
+	// sessions holds the open sessions of every transport.
+	sessions    map[string]*sessionInfo
+	nextCapture int
+	// flapWatches holds the running BGP flap watches by watch ID.
+	flapWatches map[string]*flapWatch
+	nextWatch   int
+	// streams holds the capture streams served to Wireshark by stream ID.
+	streams    map[string]*captureStream
+	nextStream int
+	// schedules holds the captures armed to start later by schedule ID.
+	schedules    map[string]*scheduledCapture
+	nextSchedule int
+	mu           sync.Mutex
+	writer       io.Writer
+	// writeMu serializes the messages written to writer.
+	writeMu sync.Mutex
+	config  *Config
+	// bmp is the BMP collector, nil unless enabled in the config.
+	bmp *bmpCollector
+	// toolSlots holds a token per executing tool call, nil when unlimited.
+	toolSlots chan struct{}
+	// demo rewrites what is sent to clients, nil unless in demo mode.
+	demo *sanitizer
+	// stateMu serializes the writes of the capture state file.
+	stateMu sync.Mutex
+	// pending holds the requests sent to clients waiting for their
+	// response, by session and request ID.
+	pending     map[string]chan clientResponse
+	nextRequest int
 }
 
-func NewMCPServer(writer io.Writer) *MCPServer {
-	return &MCPServer{
+func NewMCPServer(writer io.Writer, config *Config) *MCPServer {
+	s := &MCPServer{
 		activeCalls: make(map[string]*ActiveCall),
+		inFlight:    make(map[string]map[string]bool),
+		sessions:    make(map[string]*sessionInfo),
+		flapWatches: make(map[string]*flapWatch),
+		streams:     make(map[string]*captureStream),
+		schedules:   make(map[string]*scheduledCapture),
+		pending:     make(map[string]chan clientResponse),
 		writer:      writer,
+		config:      config,
+	}
+	if config.MaxConcurrentTools > 0 {
+		s.toolSlots = make(chan struct{}, config.MaxConcurrentTools)
+	}
+	if config.DemoMode {
+		s.demo = newSanitizer()
+	}
+	return s
+}
+
+// errCodeServerBusy is returned when every tool slot stays taken for the
+// configured queue timeout.
+const errCodeServerBusy = -32003
+
+// acquireToolSlot waits for a tool execution slot, up to the queue timeout.
+// It returns false if none freed up.
+func (s *MCPServer) acquireToolSlot() bool {
+	if s.toolSlots == nil {
+		return true
+	}
+	select {
+	case s.toolSlots <- struct{}{}:
+		return true
+	default:
+	}
+	wait := s.config.ToolQueueTimeout.Duration
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case s.toolSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (s *MCPServer) releaseToolSlot() {
+	if s.toolSlots != nil {
+		<-s.toolSlots
+	}
+}
+
+// requestIDKey returns the canonical form of a JSON-RPC request ID, so that
+// the number 1 and the string "1" are told apart.
+func requestIDKey(id any) string {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Sprintf("%v", id)
 	}
+	return string(data)
 }
 
-func (s *MCPServer) handleRequest(req JSONRPCRequest) JSONRPCResponse {
+// beginRequest records a request as in flight for the session. It returns
+// false if the session already has a request with the same ID in flight.
+func (s *MCPServer) beginRequest(sessionID, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, ok := s.inFlight[sessionID]
+	if !ok {
+		ids = make(map[string]bool)
+		s.inFlight[sessionID] = ids
+	}
+	if ids[key] {
+		return false
+	}
+	ids[key] = true
+	return true
+}
+
+func (s *MCPServer) endRequest(sessionID, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight[sessionID], key)
+	if len(s.inFlight[sessionID]) == 0 {
+		delete(s.inFlight, sessionID)
+	}
+}
+
+// newCaptureID returns a server-generated identifier for a capture,
+// independent of the client request ID.
+func (s *MCPServer) newCaptureID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCapture++
+	return fmt.Sprintf("capture-%d", s.nextCapture)
+}
+
+func (s *MCPServer) handleRequest(sessionID string, req JSONRPCRequest) JSONRPCResponse {
+	if req.ID != nil {
+		key := requestIDKey(req.ID)
+		if !s.beginRequest(sessionID, key) {
+			return s.errorResponse(req.ID, -32600, "Duplicate request ID: a request with this ID is already in flight")
+		}
+		defer s.endRequest(sessionID, key)
+	}
+
 	switch req.Method {
 	case "initialize":
 		var params InitializeParams
 		if err := json.Unmarshal(req.Params, &params); err != nil {
 			return s.errorResponse(req.ID, -32602, "Invalid params")
 		}
-		return s.handleInitialize(req.ID, params)
+		return s.handleInitialize(sessionID, req.ID, params)
 	case "tools/list":
 		return s.handleToolsList(req.ID)
 	case "tools/call":
@@ -131,24 +431,58 @@ func (s *MCPServer) handleRequest(req JSONRPCRequest) JSONRPCResponse {
 		if err := json.Unmarshal(req.Params, &params); err != nil {
 			return s.errorResponse(req.ID, -32602, "Invalid params")
 		}
-		return s.handleToolCall(req.ID, params)
+		return s.handleToolCall(sessionID, req.ID, params)
+	case "resources/list":
+		return s.handleResourcesList(sessionID, req.ID)
+	case "resources/templates/list":
+		return s.handleResourceTemplatesList(req.ID)
+	case "resources/read":
+		var params ReadResourceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.errorResponse(req.ID, -32602, "Invalid params")
+		}
+		return s.handleResourceRead(sessionID, req.ID, params)
+	case "logging/setLevel":
+		// Only capture completions and the live packet summaries asked for
+		// are sent, at info level, so the requested level is accepted
+		// without filtering anything.
+		return JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
 	default:
 		return s.errorResponse(req.ID, -32601, "Method not found")
 	}
 }
 
-func (s *MCPServer) handleInitialize(id any, params InitializeParams) JSONRPCResponse {
+const protocolVersion = "2024-11-05"
+
+var serverInfo = ServerInfo{
+	Name:    "openperouter-mcp",
+	Version: "1.0.0",
+}
+
+func (s *MCPServer) handleInitialize(sessionID string, id any, params InitializeParams) JSONRPCResponse {
+	version := negotiateProtocol(params.ProtocolVersion)
+	// Elicitation needs the protocol version adding it.
+	_, elicitation := params.Capabilities["elicitation"]
+	s.mu.Lock()
+	if info, ok := s.sessions[sessionID]; ok {
+		info.Elicitation = elicitation && version == elicitationProtocolVersion
+		info.ProtocolVersion = version
+	}
+	s.mu.Unlock()
+
 	result := InitializeResult{
-		ProtocolVersion: "2024-11-05",
+		ProtocolVersion: version,
 		Capabilities: ServerCapabilities{
 			Tools: map[string]any{
 				"listChanged": true,
 			},
+			Resources: map[string]any{
+				"listChanged": true,
+			},
+			Logging: &struct{}{},
 		},
-		ServerInfo: ServerInfo{
-			Name:    "openperouter-mcp",
-			Version: "1.0.0",
-		},
+		ServerInfo:   serverInfo,
+		Instructions: s.config.Instructions,
 	}
 	return JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -157,29 +491,147 @@ func (s *MCPServer) handleInitialize(id any, params InitializeParams) JSONRPCRes
 	}
 }
 
-func (s *MCPServer) handleToolsList(id any) JSONRPCResponse {
-	tools := []Tool{
+// toolDefinitions returns the tools exposed by the server, as listed to
+// clients and exported with --export-manifest.
+func toolDefinitions() []Tool {
+	return []Tool{
 		{
 			Name:        "extract_leaf_configs",
-			Description: "Extracts FRR running configurations from all leaf nodes in the CLAB topology. The configurations are saved to a timestamped directory.",
+			Description: "Extracts FRR running configurations from the routers of the CLAB topology: the leaves and the openperouter router pods of the kind clusters, and the spines with role 'spine' or 'all'. The configurations are saved to a timestamped directory.",
+			Annotations: writingTool("Extract leaf configurations", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"role": map[string]any{
+						"type":        "string",
+						"enum":        routerRoles,
+						"description": "Routers to extract: 'leaf' (containerlab leaves and kind clusters), 'spine', or 'all'. Optional, defaults to 'leaf'.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "extract_spine_configs",
+			Description: "Extracts FRR running configurations from the spine routers of the CLAB topology into a timestamped directory, with the same layout as extract_leaf_configs (<spine>_config.txt).",
+			Annotations: writingTool("Extract spine configurations", true),
 			InputSchema: InputSchema{
 				Type:       "object",
 				Properties: map[string]any{},
 			},
 		},
+		{
+			Name:        "extract_perouter_frr_configs",
+			Description: "Extracts, from the openperouter router pod of every node of the kind clusters, the FRR running configuration ('vtysh -c \"show running-config\"' in the frr container) and the frr.conf rendered by the operator (" + frrConfPath + "), into a timestamped directory as <cluster>_<node>_running-config.txt and <cluster>_<node>_frr.conf. Reports the rendered lines missing from the running configuration, a sign of a failed reload.",
+			Annotations: writingTool("Extract openperouter FRR configurations", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"cluster": map[string]any{
+						"type":        "string",
+						"description": "Only extract the configurations of this kind cluster (e.g., 'pe-kind-a'). Optional, defaults to every cluster.",
+					},
+					"output_dir": map[string]any{
+						"type":        "string",
+						"description": "Directory to save the configurations to. Optional, defaults to network_configs_<timestamp>.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
 		{
 			Name:        "start_traffic_capture",
-			Description: "Starts capturing network traffic from Kubernetes cluster nodes and spine router using tshark. This operation starts in the background and returns immediately. Use stop_traffic_capture to stop the capture and retrieve files. Automatically installs tshark on nodes if needed.",
+			Description: "Starts capturing network traffic from Kubernetes cluster nodes and spine router using tshark. This operation starts in the background and returns immediately with a capture_id. Use stop_traffic_capture to stop the capture and retrieve files. Automatically installs tshark on nodes if needed, falling back to tcpdump, or to the server binary as a capture agent, on nodes it cannot be installed on.",
+			Annotations: writingTool("Start traffic capture", false),
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]any{
 					"output_dir": map[string]any{
 						"type":        "string",
-						"description": "Directory where capture files will be saved. Optional, defaults to './captures/capture_<timestamp>'.",
+						"description": "Directory where capture files will be saved. Optional, defaults to './captures/<session>/capture_<timestamp>', followed by '_<label>' when a label is given.",
+					},
+					"label": map[string]any{
+						"type":        "string",
+						"description": "Free-form label of the capture, such as the name of the e2e test case it is taken for (e.g., 'TestL3VNI/ping_between_pods'). Recorded with the capture, in the default directory name and in its manifest.json, so captures can be matched to the tests that produced them. Optional.",
 					},
 					"capture_filter": map[string]any{
+						"type":                 []string{"string", "object"},
+						"additionalProperties": map[string]any{"type": "string"},
+						"description":          "Tshark capture filter (e.g., 'arp or icmp'), or an object of node names or globs to the filter of the nodes they match (e.g., {\"clab-kind-spine\": \"tcp port 179\", \"*-worker*\": \"udp port 4789\"}), names taking precedence over globs and the other nodes using the default filter. Optional, defaults to capturing all traffic.",
+					},
+					"profile": profileProperty,
+					"vni": map[string]any{
+						"type":        "number",
+						"description": "Only capture the VXLAN packets of this VNI, the server building the filter matching UDP port 4789 and the VNI in the VXLAN header, over IPv4 or IPv6. capture_filter, if given, is and-ed with it and applies to the outer packets (e.g., 'host 100.65.0.1' for one VTEP). Exclusive with profile. Optional.",
+					},
+					"nodes": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Nodes to capture on, as names or globs (e.g., ['leafA', 'spine*', 'pe-kind-a-*']). Optional, defaults to the kind nodes and the spine.",
+					},
+					"max_packets": map[string]any{
+						"type":        "number",
+						"description": "Stop tshark on each node after this many packets (tshark -c). Once every node reached it, the files are copied out and the client notified. Optional, unlimited by default.",
+					},
+					"file_size_mb": map[string]any{
+						"type":        "number",
+						"description": "Write a ring buffer on each node, switching to a new file every this many MB (tshark -b filesize), so long soak tests don't fill the container filesystems. Optional, a single file by default.",
+					},
+					"num_files": map[string]any{
+						"type":        "number",
+						"description": "Number of files the ring buffer keeps per node, the oldest being deleted (tshark -b files). Requires file_size_mb, defaults to 10.",
+					},
+					"duration_seconds": map[string]any{
+						"type":        "number",
+						"description": "Stop the capture automatically after this many seconds, copying the files out and notifying the client. Optional, by default the capture runs until stop_traffic_capture is called.",
+					},
+					"interfaces": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Interfaces to capture on, as names or globs (e.g., ['eth1', 'br-*']), matched on every selected node; nodes without a match are skipped. Optional, defaults to all interfaces.",
+					},
+					"router_veths": map[string]any{
+						"type":        "boolean",
+						"description": "Capture on the veth interfaces connecting the openperouter router pod to the host namespace of each kind node, discovered on every node, where most encapsulation bugs show. Nodes without such interfaces, such as the spine, are skipped. Exclusive with interfaces. Optional, defaults to false.",
+					},
+					"pods": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Pods to capture in as well, as namespace/name with globs allowed (e.g., ['default/client-*']), on all their interfaces, in their network namespace entered from the kind node they run on. Saved as the 'pod_<namespace>_<name>' node. Optional.",
+					},
+					"host_interfaces": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Interfaces of the host running kind and containerlab to capture on as well, as names, globs (e.g., ['veth*']) or docker networks whose bridge is captured on (e.g., ['kind']), to catch traffic that never reaches the containers. Saved as the 'host' node. Optional, requires tshark on the host.",
+					},
+					"skip_filter_validation": map[string]any{
+						"type":        "boolean",
+						"description": "Don't compile capture_filter on the nodes before starting. Optional, defaults to false: an invalid filter fails the call.",
+					},
+					"start_at": map[string]any{
 						"type":        "string",
-						"description": "Tshark capture filter (e.g., 'arp or icmp'). Optional, defaults to capturing all traffic.",
+						"description": "Arm the capture to start at this RFC3339 time (e.g., '2026-03-14T02:00:00+01:00'), during a planned maintenance window, instead of now. Requires duration_seconds or max_packets. Returns a schedule_id; the session is notified when the capture starts and stops. Optional.",
+					},
+					"schedule": map[string]any{
+						"type":        "string",
+						"description": "Start the capture at every match of this cron expression, minute hour day-of-month month day-of-week in the server local time (e.g., '30 2 * * 6' every Saturday at 02:30), a run being skipped while the previous capture still runs. Exclusive with start_at and output_dir, requires duration_seconds or max_packets. Optional.",
+					},
+					"backend": map[string]any{
+						"type":        "string",
+						"enum":        []string{"tshark", "afpacket"},
+						"description": "What captures on the nodes: 'tshark', installed on the nodes when missing, or 'afpacket', the server binary copied to the nodes as an agent reading afpacket sockets with the filter compiled to BPF by tcpdump on the host or the node, lighter on busy nodes and leaving their packages untouched. afpacket requires a statically linked server (CGO_ENABLED=0) and does not support file_size_mb. Optional, defaults to 'tshark'.",
+					},
+					"live": map[string]any{
+						"type":        "string",
+						"enum":        []string{"notify", "resource", "both"},
+						"description": "Stream a one-line summary of each captured packet (tshark -P) while the capture runs: as notifications, appended to the capture://{session}/live/{capture_id}.txt resource, or both. Optional, off by default.",
+					},
+					"live_filter": map[string]any{
+						"type":        "string",
+						"description": "Regular expression the node name and summary of a packet must match to be streamed (e.g., 'leafA.*ICMP'). Requires live.",
+					},
+					"live_rate": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of summaries streamed per second, the others being dropped and counted. Optional, defaults to 5.",
 					},
 				},
 				Required: []string{},
@@ -187,238 +639,2662 @@ func (s *MCPServer) handleToolsList(id any) JSONRPCResponse {
 		},
 		{
 			Name:        "stop_traffic_capture",
-			Description: "Stops all running traffic captures, retrieves the pcap files from containers, and saves them to the host directory. This will gracefully terminate all tshark processes and copy the capture files.",
+			Description: "Stops the running traffic captures started by this session, or only the one given by capture_id, retrieves the pcap files from containers, and saves them to the host directory. This will gracefully terminate the tshark processes and copy the capture files, the nodes in parallel, and reports per node the files copied or what failed.",
+			Annotations: writingTool("Stop traffic captures", true),
 			InputSchema: InputSchema{
-				Type:       "object",
-				Properties: map[string]any{},
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "capture_id returned by start_traffic_capture. Optional, stops only this capture and leaves the others running.",
+					},
+					"all_sessions": map[string]any{
+						"type":        "boolean",
+						"description": "Stop the captures of every session, not only the ones started by this session. Optional, defaults to false.",
+					},
+					"format": formatProperty,
+				},
 			},
 		},
-	}
-
-	result := ToolsListResult{Tools: tools}
-	return JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      id,
-		Result:  result,
-	}
-}
-
-func (s *MCPServer) handleToolCall(id any, params CallToolParams) JSONRPCResponse {
-	var result CallToolResult
-
-	switch params.Name {
-	case "extract_leaf_configs":
-		result = s.extractLeafConfigs()
-	case "start_traffic_capture":
-		result = s.startTrafficCapture(id, params.Arguments)
-	case "stop_traffic_capture":
-		result = s.stopTrafficCapture()
-	default:
-		return s.errorResponse(id, -32602, "Unknown tool: "+params.Name)
-	}
-
-	return JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      id,
-		Result:  result,
-	}
-}
-
-func executeScript(script string, args []string, env []string) (string, error) {
-	cmd := exec.Command("bash", "-c", script)
-	if len(args) > 0 {
-		cmd.Args = append(cmd.Args, args...)
-	}
-	if len(env) > 0 {
-		cmd.Env = append(os.Environ(), env...)
-	}
-
-	output, err := cmd.CombinedOutput()
-	return string(output), err
-}
-
-func (s *MCPServer) extractLeafConfigs() CallToolResult {
-	output, err := executeScript(extractLeafConfigsScript, nil, nil)
-	if err != nil {
-		return CallToolResult{
-			Content: []ContentItem{{
-				Type: "text",
-				Text: fmt.Sprintf("Error executing extract-leaf-configs.sh: %v\nOutput: %s", err, output),
-			}},
-			IsError: true,
-		}
-	}
-
-	return CallToolResult{
-		Content: []ContentItem{{
-			Type: "text",
-			Text: output,
-		}},
-	}
-}
-
-func (s *MCPServer) startTrafficCapture(id any, args map[string]any) CallToolResult {
-	var scriptWithArgs string
-	if outputDir, ok := args["output_dir"].(string); ok && outputDir != "" {
-		scriptWithArgs = fmt.Sprintf("%s %s", captureTrafficScript, outputDir)
-	} else {
-		scriptWithArgs = captureTrafficScript
-	}
-
-	var env []string
-	if captureFilter, ok := args["capture_filter"].(string); ok && captureFilter != "" {
-		env = []string{fmt.Sprintf("CAPTURE_FILTER=%s", captureFilter)}
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", scriptWithArgs)
-	if len(env) > 0 {
-		cmd.Env = append(os.Environ(), env...)
-	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		cancel()
-		return CallToolResult{
-			Content: []ContentItem{{
-				Type: "text",
-				Text: fmt.Sprintf("Error creating stdout pipe: %v", err),
-			}},
-			IsError: true,
-		}
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		cancel()
-		return CallToolResult{
-			Content: []ContentItem{{
-				Type: "text",
-				Text: fmt.Sprintf("Error creating stderr pipe: %v", err),
-			}},
-			IsError: true,
-		}
-	}
-
-	if err := cmd.Start(); err != nil {
-		cancel()
-		return CallToolResult{
-			Content: []ContentItem{{
-				Type: "text",
-				Text: fmt.Sprintf("Error starting capture-traffic.sh: %v", err),
-			}},
-			IsError: true,
-		}
-	}
-
-	requestID := fmt.Sprintf("%v", id)
-	s.mu.Lock()
-	s.activeCalls[requestID] = &ActiveCall{
-		ID:     id,
-		Cancel: cancel,
-		Cmd:    cmd,
-	}
-	s.mu.Unlock()
-
-	outputChan := make(chan string, 1)
-
-	go func() {
-		defer func() {
-			cmd.Wait()
-			s.mu.Lock()
-			delete(s.activeCalls, requestID)
-			s.mu.Unlock()
-			cancel()
-		}()
-
-		scanner := bufio.NewScanner(io.MultiReader(stdout, stderr))
-		var lines []string
-		lineCount := 0
-		maxLines := 20
-
-		for scanner.Scan() && lineCount < maxLines {
-			lines = append(lines, scanner.Text())
-			lineCount++
-		}
-
-		if len(lines) > 0 {
-			outputChan <- fmt.Sprintf("%s", lines[0])
-		} else {
-			outputChan <- "Capture started (no initial output yet)"
-		}
-
-		for scanner.Scan() {
-		}
-	}()
-
-	var initialOutput string
-	select {
-	case initialOutput = <-outputChan:
-	case <-time.After(5 * time.Second):
-		initialOutput = "Capture process started (waiting for initial output timed out after 5s)"
-	case <-ctx.Done():
-		return CallToolResult{
-			Content: []ContentItem{{
-				Type: "text",
-				Text: "Traffic capture was cancelled before starting.",
-			}},
-			IsError: false,
-		}
-	}
-
-	return CallToolResult{
-		Content: []ContentItem{{
-			Type: "text",
-			Text: fmt.Sprintf("Traffic capture started successfully and is running in the background (Request ID: %s).\n\nInitial output:\n%s\n\nThe capture will continue running. Use the stop_traffic_capture tool to stop all captures and retrieve the files.", requestID, initialOutput),
-		}},
-		IsError: false,
-	}
-}
-
-func (s *MCPServer) stopTrafficCapture() CallToolResult {
-	s.mu.Lock()
+		{
+			Name:        "list_traffic_captures",
+			Description: "Lists the running and recently finished traffic captures with their capture_id, start time, nodes, filter, output directory, elapsed duration and current pcap file sizes, and the captures scheduled to start later. Check it before starting more captures, to reuse what is already being collected.",
+			Annotations: readOnlyTool("List traffic captures"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"all_sessions": map[string]any{
+						"type":        "boolean",
+						"description": "List the captures of every session, not only the ones started by this session. Optional, defaults to false.",
+					},
+					"label": map[string]any{
+						"type":        "string",
+						"description": "Only list the captures with this label, as given to start_traffic_capture. Optional.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "bgp_session_fsm",
+			Description: "Reconstructs the FSM transitions of a BGP session over a time window from the router logs and, optionally, a traffic capture, and renders them as a Mermaid sequence diagram. Use it to explain why a session failed to come up or flapped. Full transition history requires 'debug bgp neighbor-events' on the router.",
+			Annotations: readOnlyTool("BGP session FSM"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Container name of the router (e.g., 'clab-kind-leafA' or a kind node such as 'pe-kind-a-worker' for the openperouter router pod).",
+					},
+					"neighbor": map[string]any{
+						"type":        "string",
+						"description": "IP address of the BGP neighbor as seen by the router.",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "Start of the window, as RFC3339 or a duration ago (e.g., '15m'). Optional, defaults to one hour ago.",
+					},
+					"until": map[string]any{
+						"type":        "string",
+						"description": "End of the window, as RFC3339 or a duration ago. Optional, defaults to now.",
+					},
+					"capture_file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap captured during the window, used to add the BGP messages exchanged with the neighbor. Optional, requires tshark on the host.",
+					},
+				},
+				Required: []string{"router", "neighbor"},
+			},
+		},
+		{
+			Name:        "audit_network_policies",
+			Description: "Lists the NetworkPolicies and MultiNetworkPolicies selecting pods attached to openperouter networks and, given a source and destination, evaluates whether the flow is allowed. Use it before blaming the fabric: policy drops are often misdiagnosed as routing failures.",
+			Annotations: readOnlyTool("Audit network policies"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"cluster": map[string]any{
+						"type":        "string",
+						"description": "Kind cluster name (e.g., 'pe-kind-a'). Optional, defaults to the current kubectl context.",
+					},
+					"source": map[string]any{
+						"type":        "string",
+						"description": "Flow source as 'namespace/pod' or an IP address. Optional, requires destination.",
+					},
+					"destination": map[string]any{
+						"type":        "string",
+						"description": "Flow destination as 'namespace/pod' or an IP address. Optional, requires source.",
+					},
+					"port": map[string]any{
+						"type":        "number",
+						"description": "Destination port of the flow. Optional, when omitted only rules allowing all ports match.",
+					},
+					"protocol": map[string]any{
+						"type":        "string",
+						"description": "Flow protocol: TCP, UDP or SCTP. Optional, defaults to TCP.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "inspect_cni_chain",
+			Description: "Dumps the CNI configuration chain on each kind node (config files in runtime order, plugin chains, IPAM ranges) plus the NetworkAttachmentDefinitions, and flags configurations known to conflict with openperouter's interface management, such as Multus not being the default network, plugins using the underlay NIC, or overlapping IPAM ranges.",
+			Annotations: readOnlyTool("Inspect CNI chain"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"cluster": map[string]any{
+						"type":        "string",
+						"description": "Kind cluster name (e.g., 'pe-kind-a'). Optional, defaults to all kind clusters.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "collect_node_runtime_logs",
+			Description: "Collects kubelet and containerd log slices from kind nodes for a time window, saving them to a timestamped directory and returning the error lines. Given a pod stuck in ContainerCreating, the window is centered on its last FailedCreatePodSandBox event and only its node is inspected.",
+			Annotations: writingTool("Collect node runtime logs", false),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"cluster": map[string]any{
+						"type":        "string",
+						"description": "Kind cluster name (e.g., 'pe-kind-a'). Optional, defaults to the current kubectl context for pod lookups and to all kind nodes otherwise.",
+					},
+					"pod": map[string]any{
+						"type":        "string",
+						"description": "Pod as 'namespace/name' whose sandbox creation failed. Optional.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Kind node to collect from. Optional, defaults to the pod's node or all nodes.",
+					},
+					"around": map[string]any{
+						"type":        "string",
+						"description": "Center of the window as RFC3339 or a duration ago (e.g., '10m'). Optional, defaults to the last sandbox failure of the pod, or now.",
+					},
+					"window": map[string]any{
+						"type":        "string",
+						"description": "Half-width of the window as a duration. Optional, defaults to '5m'.",
+					},
+					"keyword": map[string]any{
+						"type":        "string",
+						"description": "Only highlight error lines containing this text. Optional, defaults to the pod name.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "check_route_watermarks",
+			Description: "Checks the route counts of the VRFs and EVPN VNIs configured in route_watermarks against their expected ranges, alerting when a count falls below (mass withdrawal) or spikes above (leak) its watermark. Catches problems that don't break any single session or probe.",
+			Annotations: readOnlyTool("Check route watermarks"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only check the watermarks of this router. Optional, defaults to all configured watermarks.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "snapshot_state",
+			Description: "Collects the structured fabric state (BGP sessions, RIB routes and bridge FDB of every router, openperouter custom resources of every cluster) and persists it as a new snapshot in the SQLite state database, for ad-hoc analysis with query_state.",
+			Annotations: writingTool("Snapshot fabric state", false),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"label": map[string]any{
+						"type":        "string",
+						"description": "Free-form label stored with the snapshot (e.g., 'before-upgrade'). Optional.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "query_state",
+			Description: "Runs a read-only SQL query against the SQLite state database filled by snapshot_state. Tables: snapshots(id, taken_at, label), bgp_sessions(snapshot_id, router, vrf, afi, neighbor, remote_as, state, prefixes_received, uptime), routes(snapshot_id, router, vrf, prefix, protocol, selected, installed, nexthops), fdb(snapshot_id, router, mac, dev, vlan, dst, master, state, flags), resources(snapshot_id, cluster, kind, namespace, name, spec), collection_errors(snapshot_id, source, error).",
+			Annotations: readOnlyTool("Query fabric state"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"sql": map[string]any{
+						"type":        "string",
+						"description": "SQL query to run. Results are limited to 500 rows.",
+					},
+				},
+				Required: []string{"sql"},
+			},
+		},
+		{
+			Name:        "bmp_peers",
+			Description: "Shows the routers streaming to the BMP collector and the current state of every BGP peer they monitor, with the time and reason of its last up/down transition.",
+			Annotations: readOnlyTool("BMP peers"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only show the peers of this router, as named in its BMP initiation message (its hostname). Optional.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "bmp_route_events",
+			Description: "Returns the route announcements and withdrawals received by the BMP collector, oldest first, to follow how a prefix or EVPN route propagated or flapped over time.",
+			Annotations: readOnlyTool("BMP route events"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only return events reported by this router. Optional.",
+					},
+					"peer": map[string]any{
+						"type":        "string",
+						"description": "Only return events learned from this peer address. Optional.",
+					},
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Only return events whose prefix or EVPN route contains this text (e.g., '10.100.0.0/24' or a MAC address). Optional.",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "Only return events received after this time, RFC3339 or a duration ago (e.g., '15m'). Optional.",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of events, the most recent ones are kept. Optional, defaults to 100, at most 500.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "evpn_multihoming",
+			Description: "Dumps the EVPN multihoming state of the routers: Ethernet Segments, DF election results and type-1 (EAD) / type-4 (ES) routes, and validates it across the multihomed peers of each segment (single DF, every peer known as remote VTEP, routes from every peer, bgpd inconsistencies).",
+			Annotations: readOnlyTool("EVPN multihoming"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only inspect this router. Optional, defaults to every router of the fabric; cross-checks need all the peers of a segment.",
+					},
+					"esi": map[string]any{
+						"type":        "string",
+						"description": "Only show this Ethernet Segment (e.g., '03:44:38:39:ff:ff:01:00:00:01'). Optional.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "analyze_ecmp_distribution",
+			Description: "Sends a set of varied UDP flows from a router to a VTEP and reports how they distribute across the ECMP uplinks, using the per-link transmit counters of the source and of optional transit routers (e.g., spines). Detects hash polarization and L3-only multipath hashing after topology changes.",
+			Annotations: writingTool("Analyze ECMP distribution", false),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"source": map[string]any{
+						"type":        "string",
+						"description": "Router the flows are sent from (e.g., 'leafA', or a kind node for its router pod).",
+					},
+					"destination": map[string]any{
+						"type":        "string",
+						"description": "VTEP IP address the flows are sent to.",
+					},
+					"transit": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Routers on the path (e.g., the spines) whose egress links towards the destination are also observed. Optional.",
+					},
+					"flows": map[string]any{
+						"type":        "number",
+						"description": "Number of distinct flows. Optional, defaults to 64, at most 1024.",
+					},
+					"packets_per_flow": map[string]any{
+						"type":        "number",
+						"description": "Packets sent per flow. Optional, defaults to 10, at most 100.",
+					},
+				},
+				Required: []string{"source", "destination"},
+			},
+		},
+		{
+			Name:        "assert_state",
+			Description: "Evaluates a set of declarative assertions against the live fabric and returns pass/fail with evidence for each, failing the call if any assertion fails. Designed to be the single gate call in CI. Assertion types: bgp_established (router, vrf, neighbor), evpn_type3 (vni, router, vteps: every router has a type-3 route from every VTEP), no_drops (router, interfaces, window_seconds, max_drops), route_present (router, vrf, prefix), route_count (router, vrf or vni, afi, min, max). router and interfaces accept globs (e.g., 'leaf*', 'eth*').",
+			Annotations: readOnlyTool("Assert fabric state"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"assertions": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"type": map[string]any{
+									"type": "string",
+									"enum": []string{"bgp_established", "evpn_type3", "no_drops", "route_present", "route_count"},
+								},
+								"name":           map[string]any{"type": "string", "description": "Name shown in the report. Optional."},
+								"router":         map[string]any{"type": "string", "description": "Router name or glob. Optional, defaults to every router (required by route_count)."},
+								"vrf":            map[string]any{"type": "string"},
+								"neighbor":       map[string]any{"type": "string"},
+								"vni":            map[string]any{"type": "number"},
+								"vteps":          map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Expected VTEPs of evpn_type3. Optional, defaults to every VTEP seen on the routers."},
+								"interfaces":     map[string]any{"type": "string", "description": "Interface glob of no_drops. Optional, defaults to every interface."},
+								"window_seconds": map[string]any{"type": "number", "description": "Measure no_drops over this window instead of since the interfaces came up. At most 300."},
+								"max_drops":      map[string]any{"type": "number"},
+								"prefix":         map[string]any{"type": "string"},
+								"afi":            map[string]any{"type": "string", "enum": []string{"ipv4", "ipv6"}},
+								"min":            map[string]any{"type": "number"},
+								"max":            map[string]any{"type": "number"},
+							},
+							"required": []string{"type"},
+						},
+						"description": "Assertions to evaluate, in order (e.g., [{\"type\": \"bgp_established\"}, {\"type\": \"evpn_type3\", \"vni\": 100}, {\"type\": \"no_drops\", \"router\": \"spine*\", \"window_seconds\": 10}]).",
+					},
+				},
+				Required: []string{"assertions"},
+			},
+		},
+		{
+			Name:        "sample_trends",
+			Description: "Records a sample of the monitoring metrics (established and down BGP sessions per router, prefixes received per neighbor, route counts of the route_watermarks targets, RTT and loss of the trend_probes pings) into the state database, for long-term comparison with query_trends. Meant to be called at the end of nightly or CI runs, alongside the values they measured themselves (e.g., convergence time).",
+			Annotations: writingTool("Sample trends", false),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"label": map[string]any{
+						"type":        "string",
+						"description": "Label stored with the samples, e.g. the run or build identifier. Optional.",
+					},
+					"values": map[string]any{
+						"type":                 "object",
+						"additionalProperties": map[string]any{"type": "number"},
+						"description":          "Additional metrics measured by the caller, by name (e.g., {\"convergence_seconds\": 42.5}). Optional.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "query_trends",
+			Description: "Aggregates the trend samples of a metric per hour, day or week (min, average, max per router and target), and flags the series whose average changed by 20% or more over the window. Answers questions like 'has convergence been getting slower over the last month of nightly runs'. Metrics: bgp_sessions_established, bgp_sessions_down, bgp_prefixes_received, route_count, probe_rtt_ms, probe_loss_pct, plus those recorded through sample_trends values.",
+			Annotations: readOnlyTool("Query trends"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"metric": map[string]any{
+						"type":        "string",
+						"description": "Metric to aggregate (e.g., 'probe_rtt_ms').",
+					},
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only aggregate the samples of this router. Optional.",
+					},
+					"target": map[string]any{
+						"type":        "string",
+						"description": "Only aggregate the samples whose target contains this text (e.g., a neighbor address or 'VRF red'). Optional.",
+					},
+					"label": map[string]any{
+						"type":        "string",
+						"description": "Only aggregate the samples recorded with this label. Optional.",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "Start of the window, RFC3339 or a duration ago (e.g., '168h'). Optional, defaults to 30 days.",
+					},
+					"bucket": map[string]any{
+						"type":        "string",
+						"enum":        []string{"hour", "day", "week"},
+						"description": "Aggregation period. Optional, defaults to day.",
+					},
+				},
+				Required: []string{"metric"},
+			},
+		},
+		{
+			Name:        "analyze_capture",
+			Description: "Summarizes the pcaps of a finished capture, or a given pcap file, natively without tshark: packet counts per protocol, top talkers, VLAN and VXLAN VNI breakdowns and time range.",
+			Annotations: readOnlyTool("Analyze capture"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to analyze, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only analyze the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to analyze instead of a capture.",
+					},
+					"top": map[string]any{
+						"type":        "number",
+						"description": "Number of top talkers listed. Optional, defaults to 10.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "decode_bgp_capture",
+			Description: "Decodes the BGP messages of a finished capture, or a given pcap file, into a timeline: OPEN capabilities, UPDATE address families, EVPN route types, NLRI, VNIs and path attributes, and NOTIFICATION reasons. TCP segments are reassembled and sessions carried inside VXLAN are decoded too.",
+			Annotations: readOnlyTool("Decode BGP capture"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to decode, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only decode the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to decode instead of a capture.",
+					},
+					"peer": map[string]any{
+						"type":        "string",
+						"description": "Only return the messages sent or received by this address. Optional.",
+					},
+					"types": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string", "enum": bgpCaptureTypes},
+						"description": "Message types to return. Optional, defaults to every type but KEEPALIVE.",
+					},
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Only return the UPDATEs with a prefix or EVPN route containing this text (e.g., '10.100.0.0/24' or a MAC address). Optional.",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of messages, the oldest ones are kept. Optional, defaults to 200, at most 2000.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "analyze_vxlan",
+			Description: "Decapsulates the VXLAN traffic of a finished capture, or a given pcap file, and groups it by VNI: the VTEP pairs encapsulating each VNI, the inner MAC/IP pairs and the top inner flows. Checks that the encapsulation is between the expected VTEPs (by default the type-3 route originators of the fabric), that each VNI is configured on a router, and flags MACs seen behind several VTEPs and IPs used by several MACs.",
+			Annotations: readOnlyTool("Analyze VXLAN"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to analyze, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only analyze the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to analyze instead of a capture.",
+					},
+					"vni": map[string]any{
+						"type":        "number",
+						"description": "Only report this VNI. Optional.",
+					},
+					"vteps": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Expected VTEP addresses. Optional, defaults to the originators of the type-3 routes of the fabric.",
+					},
+					"top": map[string]any{
+						"type":        "number",
+						"description": "Number of inner flows listed per VNI. Optional, defaults to 10.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "analyze_arp",
+			Description: "Summarizes the ARP and IPv6 neighbor discovery traffic of a finished capture, or a given pcap file, per broadcast domain (VNI or VLAN), to spot broken L2VNI forwarding: unanswered requests, gratuitous ARPs and unsolicited advertisements, duplicate-address indications, and proxy replies from the routers.",
+			Annotations: readOnlyTool("Analyze ARP"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to analyze, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only analyze the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to analyze instead of a capture.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "analyze_addressing",
+			Description: "Extracts the DHCPv4 and DHCPv6 exchanges and the IPv6 router advertisements of a finished capture, or a given pcap file, per broadcast domain (VNI or VLAN), for debugging tenant onboarding: the addresses offered, the servers and relays (relay address, option 82) involved, exchanges never answered or refused, and whether the gateway of each L2VNI resource was advertised in its VNI.",
+			Annotations: readOnlyTool("Analyze addressing"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to analyze, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only analyze the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to analyze instead of a capture.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "compare_capture_stats",
+			Description: "Diffs the statistics of two finished captures, or pcap files, or of the two parts of one split at a time: the packets per protocol, the talkers and the error packets (ICMP errors, TCP resets, undecodable packets), to quantify the effect of a configuration change or a failure injection.",
+			Annotations: readOnlyTool("Compare capture statistics"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"before_capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture taken before the change. Exactly one of before_capture_id and before_file is required, unless split_at is given.",
+					},
+					"before_file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file taken before the change.",
+					},
+					"after_capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture taken after the change. Exactly one of after_capture_id and after_file is required, unless split_at is given.",
+					},
+					"after_file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file taken after the change.",
+					},
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to split at split_at, instead of comparing two captures.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to split at split_at, instead of comparing two files.",
+					},
+					"split_at": map[string]any{
+						"type":        "string",
+						"description": "RFC3339 timestamp (e.g., '2025-06-01T10:15:30.250Z') of the change: the packets of capture_id or file before it are compared with the ones from it on.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only compare the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"per_second": map[string]any{
+						"type":        "boolean",
+						"description": "Compare packet rates rather than packet counts, for captures of different durations. Optional, defaults to false.",
+					},
+					"top": map[string]any{
+						"type":        "number",
+						"description": "Number of talkers listed, largest changes first. Optional, defaults to 10.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "analyze_icmp",
+			Description: "Extracts the ICMP echoes, unreachables and TTL-exceeded messages of a finished capture, or a given pcap file, and correlates each echo request with its reply across the capture points of the capture, reporting the path they took and, for the lost ones, the last node that saw them along the leaf -> spine -> leaf path.",
+			Annotations: readOnlyTool("Analyze ICMP"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to analyze, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only analyze the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to analyze instead of a capture.",
+					},
+					"address": map[string]any{
+						"type":        "string",
+						"description": "Only report the echoes and errors to or from this address. Optional.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "extract_flows",
+			Description: "Extracts the TCP and UDP conversations of a finished capture, or a given pcap file, with their endpoints, packets and bytes each way, duration and TCP retransmissions, per capture point and VNI, so as to tell whether a flow (e.g. iperf) actually traversed the fabric. Traffic inside VXLAN is accounted to its inner endpoints.",
+			Annotations: readOnlyTool("Extract flows"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to analyze, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only analyze the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to analyze instead of a capture.",
+					},
+					"vni": map[string]any{
+						"type":        "number",
+						"description": "Only report the conversations carried in VXLAN with this VNI. Optional.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only report the conversations carried in VXLAN with the L2 or L3 VNIs of this VRF, as configured on the routers. Optional, exclusive with vni.",
+					},
+					"protocol": map[string]any{
+						"type":        "string",
+						"enum":        []string{"tcp", "udp"},
+						"description": "Only report the conversations of this protocol. Optional.",
+					},
+					"address": map[string]any{
+						"type":        "string",
+						"description": "Only report the conversations to or from this address. Optional.",
+					},
+					"port": map[string]any{
+						"type":        "number",
+						"description": "Only report the conversations to or from this port (e.g., 5201 for iperf3). Optional.",
+					},
+					"top": map[string]any{
+						"type":        "number",
+						"description": "Number of conversations to report, the largest first. Optional, defaults to 20.",
+					},
+					"format":   formatProperty,
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "export_capture",
+			Description: "Dissects the packets of a finished capture, or a given pcap file, matching a Wireshark display filter with tshark on the host, and returns them as tshark JSON (-T json) or verbose text (-V), one embedded resource per file, to inspect exact packet fields.",
+			Annotations: readOnlyTool("Export capture"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to export, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only export the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to export instead of a capture.",
+					},
+					"filter": map[string]any{
+						"type":        "string",
+						"description": "Wireshark display filter selecting the packets (e.g., 'bgp.type == 2 && ip.src == 192.168.1.1'). Optional, defaults to every packet.",
+					},
+					"output": map[string]any{
+						"type":        "string",
+						"enum":        []string{"json", "text"},
+						"description": "json for tshark -T json, text for the tshark -V packet details. Optional, defaults to json.",
+					},
+					"protocols": map[string]any{
+						"type":        "string",
+						"description": "Comma-separated protocols to detail (e.g., 'bgp,vxlan'), the others being left out of json and summarized in text. Optional, defaults to every layer.",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of matching packets exported per file. Optional, defaults to 50, at most 1000.",
+					},
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "merge_captures",
+			Description: "Merges the per-node pcaps of a finished capture into a single chronologically ordered pcapng, each interface described by its node, optionally shifting the timestamps of some nodes to correct their clock offsets. The merged file is written next to the per-node ones and served as the capture://{session}/fabric.pcapng resource.",
+			Annotations: writingTool("Merge captures", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to merge, as returned by start_traffic_capture.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only merge the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"offsets": map[string]any{
+						"type":                 "object",
+						"additionalProperties": map[string]any{"type": "number"},
+						"description":          "Milliseconds added to the timestamps of the packets of each node, keyed by node name or glob (e.g., {\"leafA\": -1.5}). Optional.",
+					},
+					"key_path": keyPathProperty,
+				},
+				Required: []string{"capture_id"},
+			},
+		},
+		{
+			Name:        "slice_capture",
+			Description: "Cuts the pcaps of a finished capture, or a pcap file, down to a time window or to the seconds around a frame, like editcap, so the analysis tools and the reader work on the moments around an event rather than the whole capture. Each node gets one slice of its files, ring buffer included, written next to them as pcapng.",
+			Annotations: writingTool("Slice capture", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to slice, as returned by start_traffic_capture. Either this or file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only slice the files of the capture nodes matching this name or glob. Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path of a pcap or pcapng file to slice instead of a capture.",
+					},
+					"start": map[string]any{
+						"type":        "string",
+						"description": "Start of the window, as an RFC3339 timestamp with fractional seconds if needed (e.g., '2025-06-01T10:15:30.250Z'). Optional, defaults to the first packet.",
+					},
+					"end": map[string]any{
+						"type":        "string",
+						"description": "End of the window, as an RFC3339 timestamp. Optional, defaults to the last packet.",
+					},
+					"frame": map[string]any{
+						"type":        "number",
+						"description": "Frame number, from 1 as in Wireshark, to cut the slice around instead of start and end. Requires a single file: file, or a node whose capture left one.",
+					},
+					"before_seconds": map[string]any{
+						"type":        "number",
+						"description": "Seconds kept before the frame. Optional, defaults to 5.",
+					},
+					"after_seconds": map[string]any{
+						"type":        "number",
+						"description": "Seconds kept after the frame. Optional, defaults to 5.",
+					},
+					"key_path": keyPathProperty,
+				},
+			},
+		},
+		{
+			Name:        "validate_capture_filter",
+			Description: "Compiles a tshark capture (BPF) filter on the nodes a capture would run on, with dumpcap -d (or tcpdump -d) and without capturing anything, reporting syntax errors and filters that can never match. start_traffic_capture runs the same check before starting.",
+			Annotations: readOnlyTool("Validate capture filter"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_filter": map[string]any{
+						"type":        "string",
+						"description": "Capture filter to validate (e.g., 'tcp port 179 or udp port 4789').",
+					},
+					"nodes": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Nodes to validate on, as names or globs, as for start_traffic_capture. Optional, defaults to the kind nodes and the spine.",
+					},
+					"interfaces": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Interfaces to compile the filter for, as names or globs, as for start_traffic_capture. Optional, defaults to all interfaces.",
+					},
+				},
+				Required: []string{"capture_filter"},
+			},
+		},
+		{
+			Name:        "capture_status",
+			Description: "Reports the progress of running traffic captures per node without stopping them: pcap size so far and growth rate, packets captured, packets dropped by the kernel and whether tshark and its dumpcap child are still alive. Pass a capture_id to look at a finished capture as well. Use it to monitor long captures.",
+			Annotations: readOnlyTool("Capture status"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Capture to report on, running or recently finished. Optional, defaults to every running capture of this session.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "watch_bgp_flaps",
+			Description: "Polls the BGP sessions of the routers and, when one leaves Established (or re-establishes between two polls), automatically starts a traffic capture to catch its re-establishment exchange, which is otherwise impossible to catch by hand. The session is notified of every flap. Returns a watch_id; use stop_bgp_flap_watch to stop watching.",
+			Annotations: writingTool("Watch BGP flaps", false),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"routers": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Routers whose sessions are watched, as names or globs. Optional, defaults to every router.",
+					},
+					"neighbors": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Neighbors to watch, as addresses, interface names or globs (e.g., ['192.168.11.*']). Optional, defaults to every neighbor.",
+					},
+					"interval_seconds": map[string]any{
+						"type":        "number",
+						"description": "How often the sessions are polled. Optional, defaults to 5.",
+					},
+					"capture": map[string]any{
+						"type":        "object",
+						"description": "start_traffic_capture arguments of the capture started on a flap. Optional: capture_filter defaults to 'tcp port 179', duration_seconds to 120 unless max_packets is given, and nodes to the routers whose sessions flapped.",
+					},
+					"once": map[string]any{
+						"type":        "boolean",
+						"description": "Stop watching after the first capture. Optional, defaults to false: every flap starts a capture, unless the previous one still runs.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "stop_bgp_flap_watch",
+			Description: "Stops BGP flap watches and reports the flaps they saw and the captures they started. The captures keep running until their duration ends.",
+			Annotations: writingTool("Stop BGP flap watch", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"watch_id": map[string]any{
+						"type":        "string",
+						"description": "Watch to stop. Optional, defaults to every watch of this session.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "stream_capture",
+			Description: "Streams the packets captured on a node in real time, sshdump-style, on a local TCP endpoint or a named pipe, so engineers can watch them live in Wireshark while the agent goes on with its own captures and analysis. Every TCP connection gets its own capture, started when it connects and stopped when it closes; the pipe is served to one reader at a time. Nothing is saved. Returns a stream_id; use stop_capture_stream to stop streaming.",
+			Annotations: writingTool("Stream capture", false),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Node to capture on, by name or a glob matching a single node (e.g., 'clab-kind-leafA').",
+					},
+					"interfaces": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Interfaces of the node to capture on, by name or glob. Optional, defaults to all of them.",
+					},
+					"capture_filter": map[string]any{
+						"type":        "string",
+						"description": "Capture filter (pcap-filter syntax, e.g. 'tcp port 179'). Optional, defaults to every packet.",
+					},
+					"profile": profileProperty,
+					"endpoint": map[string]any{
+						"type":        "string",
+						"enum":        []string{"tcp", "pipe"},
+						"description": "Where the stream is served: 'tcp' (default), opened in Wireshark as TCP@<host>:<port>, or 'pipe', a named pipe under ./captures/.streams opened as a file.",
+					},
+					"address": map[string]any{
+						"type":        "string",
+						"description": "host:port the TCP endpoint listens on. Optional, defaults to a free port of the loopback; the stream is not authenticated.",
+					},
+				},
+				Required: []string{"node"},
+			},
+		},
+		{
+			Name:        "stop_capture_stream",
+			Description: "Stops capture streams, ending the captures they serve, and reports how many clients they served and what they streamed.",
+			Annotations: writingTool("Stop capture stream", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"stream_id": map[string]any{
+						"type":        "string",
+						"description": "Stream to stop. Optional, defaults to every stream of this session.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "cancel_scheduled_capture",
+			Description: "Cancels captures scheduled with start_at or schedule before they start, and reports the captures their earlier runs started. Those keep running until they stop on their own.",
+			Annotations: writingTool("Cancel scheduled capture", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"schedule_id": map[string]any{
+						"type":        "string",
+						"description": "Schedule to cancel. Optional, defaults to every schedule of this session.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "cleanup_captures",
+			Description: "Lists the capture directories of this session, or of every session with all_sessions, with their age and size, and deletes the old ones: older than older_than, the oldest beyond max_total_mb, or every one of the given sessions. Without criteria it applies the configured retention policy, or only lists when there is none. Directories of running captures are never deleted. Reports the reclaimed disk space; use dry_run to preview.",
+			Annotations: destructiveTool("Clean up captures"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"format": formatProperty,
+					"older_than": map[string]any{
+						"type":        "string",
+						"description": "Delete the capture directories older than this duration (e.g., '72h'). Optional.",
+					},
+					"max_total_mb": map[string]any{
+						"type":        "number",
+						"description": "Delete the oldest capture directories until the rest fits in this many MiB (1048576 bytes). Optional.",
+					},
+					"all_sessions": map[string]any{
+						"type":        "boolean",
+						"description": "List and delete the capture directories of every session, not only the ones of this session. Optional, defaults to false.",
+					},
+					"sessions": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Sessions whose capture directories are all deleted, as IDs or globs. Requires all_sessions. Optional.",
+					},
+					"dry_run": map[string]any{
+						"type":        "boolean",
+						"description": "Report what would be deleted without deleting it. Optional, defaults to false.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "archive_capture",
+			Description: "Packs a finished capture into a single .tar.gz for bug reports: its pcaps, the capture log, the control-plane snapshots taken at start and stop, and a MANIFEST.json listing every file with its node, size and SHA-256. Returns the archive path and, for a capture of this session, its capture:// resource URI.",
+			Annotations: writingTool("Archive capture", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "ID of a recently finished capture to archive. Either this or output_dir is required.",
+					},
+					"output_dir": map[string]any{
+						"type":        "string",
+						"description": "Capture directory to archive (e.g., 'captures/<session>/capture_20250101_120000'), for captures no longer listed. Either this or capture_id is required.",
+					},
+					"all_sessions": map[string]any{
+						"type":        "boolean",
+						"description": "Archive a capture of any session, not only one started by this session. Optional, defaults to false.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "upload_artifacts",
+			Description: "Uploads capture archives and other artifacts to the S3 compatible object store configured on the server (AWS S3, MinIO), so they can be shared, and returns a presigned download URL for each. Finished captures given by ID are archived first, as archive_capture does.",
+			Annotations: writingTool("Upload artifacts", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_ids": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "IDs of finished captures to archive and upload. Optional.",
+					},
+					"paths": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Files under the captures directory of this session to upload, such as archives written by archive_capture. Optional.",
+					},
+					"expires_in": map[string]any{
+						"type":        "string",
+						"description": "How long the download URLs are valid (e.g., '1h', at most '168h'). Optional, defaults to the configured url_expiry.",
+					},
+					"all_sessions": map[string]any{
+						"type":        "boolean",
+						"description": "Upload the captures and files of any session, not only the ones of this session. Optional, defaults to false.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "recover_captures",
+			Description: "Recovers the traffic captures left running by a previous server instance that crashed, whose tshark processes nothing stops anymore. The server adopts them on startup under their original session; this tool looks again for orphans of instances that died since, then hands the recovered captures over to this session, or stops them and copies their files out. Only the captures whose original session is gone, or that this call recovered, are acted on; those of another open session are left to it.",
+			Annotations: writingTool("Recover orphaned captures", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"action": map[string]any{
+						"type":        "string",
+						"enum":        []string{"adopt", "stop"},
+						"description": "'adopt' moves the recovered captures to this session, to stop them with stop_traffic_capture later; 'stop' stops them and copies their files to their output directory. Optional, defaults to 'adopt'.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "discover_neighbors",
+			Description: "Listens for LLDP and CDP frames on the fabric interfaces of each node for a short while, with a brief capture, and returns the neighbor each interface hears: system name, port, chassis ID and management address. Given the containerlab topology file, checks that every link is cabled as declared, flagging links whose ends hear another device and neighbors heard on interfaces the topology does not link. Requires an LLDP agent (e.g. lldpd) on the nodes, FRR not sending LLDP.",
+			Annotations: writingTool("Discover neighbors", true),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"nodes": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Nodes to listen on, as names or globs (e.g., ['leaf*', 'spine']). Optional, defaults to every router: the containerlab spines and leaves and the kind nodes.",
+					},
+					"interfaces": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Interfaces to listen on, as names or globs (e.g., ['eth1', 'eth2']), matched on every selected node. Optional, defaults to the fabric interfaces: the Ethernet, veth and macvlan ones but eth0.",
+					},
+					"duration_seconds": map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("How long to listen, covering the transmit interval of the agents. Optional, defaults to %d, at most %d.", defaultNeighborSeconds, maxNeighborSeconds),
+					},
+					"topology": map[string]any{
+						"type":        "string",
+						"description": "Path of the containerlab topology file (e.g., 'kind.clab.yml') whose links are checked against the neighbors heard. Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "assert_traffic",
+			Description: "Checks declarative expectations about the packets of a finished capture, or a given pcap file, and returns pass/fail for each with the matching frames, failing the call if any expectation is not met. Meant for automated datapath validation, e.g. {\"protocol\": \"icmp\", \"src\": \"10.1.1.2\", \"dst\": \"10.2.2.2\", \"vni\": 100, \"seen_on\": \"spine\"} for pings from 10.1.1.2 to 10.2.2.2 encapsulated in VNI 100 on the spine. Addresses and ports are the inner ones of packets carried in VXLAN.",
+			Annotations: readOnlyTool("Assert captured traffic"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"capture_id": map[string]any{
+						"type":        "string",
+						"description": "Finished capture to check, as returned by start_traffic_capture. Exactly one of capture_id and file is required.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only read the files of the capture nodes matching this name or glob (e.g., 'clab-kind-leaf*'). Optional, defaults to every node.",
+					},
+					"file": map[string]any{
+						"type":        "string",
+						"description": "Path to a pcap or pcapng file to check instead of a capture.",
+					},
+					"key_path": keyPathProperty,
+					"expectations": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"name":         map[string]any{"type": "string", "description": "Name shown in the report. Optional."},
+								"protocol":     map[string]any{"type": "string", "enum": []string{"icmp", "tcp", "udp"}, "description": "ICMP (v4 or v6), TCP or UDP. Optional, defaults to any IP packet."},
+								"src":          map[string]any{"type": "string", "description": "Source address or prefix (e.g., '10.1.1.0/24'). Optional."},
+								"dst":          map[string]any{"type": "string", "description": "Destination address or prefix. Optional."},
+								"src_port":     map[string]any{"type": "number", "description": "Source port, with protocol tcp or udp. Optional."},
+								"dst_port":     map[string]any{"type": "number", "description": "Destination port, with protocol tcp or udp. Optional."},
+								"vni":          map[string]any{"type": "number", "description": "Only count packets carried in VXLAN with this VNI. Optional."},
+								"encapsulated": map[string]any{"type": "boolean", "description": "Only count packets carried in VXLAN when true, bare ones when false. Optional."},
+								"seen_on":      map[string]any{"type": "string", "description": "Only count packets seen on the capture nodes matching this name or glob (e.g., 'spine'). Optional, defaults to every node."},
+								"min_packets":  map[string]any{"type": "number", "description": "Minimum number of matching packets. Optional, defaults to 1, or to 0 when max_packets is given."},
+								"max_packets":  map[string]any{"type": "number", "description": "Maximum number of matching packets, 0 asserting that no such packet was seen. Optional."},
+							},
+						},
+						"description": "Expectations to check, in order; a packet matches one when it meets every field given.",
+					},
+					"max_frames": map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("Number of matching frames listed per expectation. Optional, defaults to %d.", defaultAssertFrames),
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"expectations"},
+			},
+		},
+		{
+			Name:        "get_bgp_summary",
+			Description: "Returns the BGP sessions of every FRR instance of the fabric (the containerlab leaves and spines, and the openperouter router pods of the kind nodes) as one table, from 'show bgp vrf all summary json': per router, VRF, address family and neighbor, the remote AS, state, prefixes received and uptime. Routers that cannot be queried are reported without failing the call.",
+			Annotations: readOnlyTool("Get BGP summary"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob (e.g., 'leaf*'). Optional, defaults to every router.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only report the sessions of this VRF (e.g., 'default'). Optional.",
+					},
+					"down_only": map[string]any{
+						"type":        "boolean",
+						"description": "Only list the sessions that are not Established. Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_bgp_neighbor_detail",
+			Description: "Returns the parsed detail of one BGP neighbor of a router, from 'show bgp vrf <vrf> neighbors <neighbor> json': state, AS numbers and router IDs, TCP endpoints, negotiated and configured timers, capabilities, message counters, connections established and dropped with the last reset reason and NOTIFICATION, and the prefixes accepted and sent per address family. Sessions that are not Established get a diagnosis of the likely cause, so the agent can tell why a session is stuck in Active or Idle.",
+			Annotations: readOnlyTool("Get BGP neighbor detail"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to query (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"neighbor": map[string]any{
+						"type":        "string",
+						"description": "Neighbor address, or interface for unnumbered sessions (e.g., '192.168.11.2', 'eth1').",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "VRF of the session. Optional, defaults to 'default'.",
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router", "neighbor"},
+			},
+		},
+		{
+			Name:        "get_evpn_routes",
+			Description: "Returns the EVPN routes known to the routers of the fabric, from 'show bgp l2vpn evpn route detail json' (or 'route vni <vni>' when filtering by VNI), as structured paths: RD, route type, prefix with its MAC, IP and ESI decoded, next-hop VTEPs, route targets and other extended communities (router MAC, encapsulation, MAC mobility), AS path, peer, and whether the path is valid and best. Filters by route type, VNI, MAC or IP prefix, so EVPN advertisement problems can be investigated without raw vtysh access.",
+			Annotations: readOnlyTool("Get EVPN routes"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob (e.g., 'leafA'). Optional, defaults to every router.",
+					},
+					"type": map[string]any{
+						"type":        "number",
+						"enum":        []int{1, 2, 3, 4, 5},
+						"description": "Only return routes of this type: 2 (MAC/IP), 3 (inclusive multicast), 5 (IP prefix), or 1 and 4 (multihoming). Optional.",
+					},
+					"vni": map[string]any{
+						"type":        "number",
+						"description": "Only return the routes of this VNI, as imported in it. Optional, not combinable with types 4 and 5.",
+					},
+					"mac": map[string]any{
+						"type":        "string",
+						"description": "Only return the type-2 routes of this MAC. Optional.",
+					},
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Only return the routes whose IP (type-2 host, type-3 originator, type-5 prefix) is within this address or prefix, or the type-5 prefixes covering it (e.g., '10.1.1.2', '10.1.1.0/24'). Optional.",
+					},
+					"best_only": map[string]any{
+						"type":        "boolean",
+						"description": "Only return best paths. Optional.",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("Maximum number of paths returned. Optional, defaults to %d.", defaultEVPNRouteLimit),
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_evpn_vni_status",
+			Description: "Collects 'show evpn vni detail json' from the leaves and the openperouter router pods and reports the state of every VNI on each: type (L2/L3), local VTEP IP, VRF binding, VXLAN and SVI interfaces, number of MACs and ARP/ND entries and remote VTEPs of L2 VNIs, state, router MAC and L2 VNIs of L3 ones. Flags VNIs that exist on some routers but not others, are bound to different VRFs or types, L3 VNIs that are not Up and L2 VNIs without remote VTEPs.",
+			Annotations: readOnlyTool("Get EVPN VNI status"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob (e.g., 'leaf*'). Optional, defaults to the leaves and kind nodes.",
+					},
+					"vni": map[string]any{
+						"type":        "number",
+						"description": "Only report this VNI. Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_route_table",
+			Description: "Returns the IPv4 and IPv6 RIB of a VRF, or of every VRF, of a router, parsed from 'show ip route vrf <vrf> json' and 'show ipv6 route vrf <vrf> json': prefix, protocol, whether the route is selected and installed, distance, metric, next hops and uptime. Filters by prefix, protocol and selection, so routes can be checked without extracting the configurations.",
+			Annotations: readOnlyTool("Get route table"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to query (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "VRF whose RIB to return (e.g., 'default', 'red'). Optional, defaults to every VRF.",
+					},
+					"afi": map[string]any{
+						"type":        "string",
+						"enum":        []string{"ipv4", "ipv6"},
+						"description": "Only return this address family. Optional, defaults to both.",
+					},
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Only return the routes within this prefix and the ones covering it, so an address finds the route it uses (e.g., '10.1.1.0/24', '10.1.1.2'). Optional.",
+					},
+					"protocol": map[string]any{
+						"type":        "string",
+						"description": "Only return the routes of this protocol (e.g., 'bgp', 'connected', 'kernel'). Optional.",
+					},
+					"selected_only": map[string]any{
+						"type":        "boolean",
+						"description": "Only return selected routes. Optional.",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("Maximum number of routes returned. Optional, defaults to %d.", defaultRouteLimit),
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router"},
+			},
+		},
+		{
+			Name:        "diff_config_snapshots",
+			Description: "Compares two configuration extraction directories (network_configs_<timestamp>, as written by extract_leaf_configs, extract_spine_configs and extract_perouter_frr_configs) and returns a unified diff per node, flagging the files added or removed between them, so configuration drift introduced by a CR change or an operator upgrade is visible at a glance. Defaults to the two latest snapshots, or to the given one against the latest.",
+			Annotations: readOnlyTool("Diff configuration snapshots"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"from": map[string]any{
+						"type":        "string",
+						"description": "Older snapshot directory (e.g., 'network_configs_20250101_120000'). Optional, defaults to the snapshot before the latest, or, when only 'to' is given, to 'to' compared against the latest.",
+					},
+					"to": map[string]any{
+						"type":        "string",
+						"description": "Newer snapshot directory. Optional, defaults to the latest.",
+					},
+					"node": map[string]any{
+						"type":        "string",
+						"description": "Only compare the configurations of the nodes matching this name or glob (e.g., 'leaf*', 'pe-kind-a_*'). Optional.",
+					},
+					"context": map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("Number of unchanged lines shown around each change. Optional, defaults to %d.", defaultDiffContext),
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_bfd_status",
+			Description: "Returns the BFD sessions of every FRR instance of the fabric (the containerlab leaves and spines, and the openperouter router pods of the kind nodes), from 'show bfd peers json' and 'show bfd peers counters json': per router, the peer, local address, interface and VRF, the state with its uptime or downtime and diagnostics, the negotiated intervals, detect multiplier and detection time, and the up and down event counts, which show sessions that flapped. BFD is what tears BGP sessions down on failures, so this tells whether and when it did.",
+			Annotations: readOnlyTool("Get BFD status"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob (e.g., 'leaf*'). Optional, defaults to every router.",
+					},
+					"down_only": map[string]any{
+						"type":        "boolean",
+						"description": "Only list the sessions that are not up. Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_fdb",
+			Description: "Dumps the bridge forwarding database ('bridge -j fdb show') and bridge port VLANs ('bridge -j vlan show') of the containerlab leaves and the openperouter router pods of the kind nodes, grouped by VNI (from the VXLAN port of each bridge) or VLAN. MACs learned over VXLAN, with the VTEP they are reached through, are told apart from the ones learned on local ports, and the VTEPs BUM traffic is flooded to are listed, for debugging L2VNI forwarding. MACs learned both locally and over VXLAN in the same segment are flagged.",
+			Annotations: readOnlyTool("Get FDB"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob, spines included (e.g., 'leafA'). Optional, defaults to the leaves and kind nodes.",
+					},
+					"vni": map[string]any{
+						"type":        "number",
+						"description": "Only report the MACs of this VNI. Optional.",
+					},
+					"mac": map[string]any{
+						"type":        "string",
+						"description": "Only report this MAC (e.g., 'aa:bb:cc:dd:ee:ff'). Optional.",
+					},
+					"remote_only": map[string]any{
+						"type":        "boolean",
+						"description": "Only report the MACs learned over VXLAN and the flood lists. Optional.",
+					},
+					"include_permanent": map[string]any{
+						"type":        "boolean",
+						"description": "Also report the permanent entries of the router own interfaces. Optional, defaults to false.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_neigh",
+			Description: "Collects the neighbor (ARP and ND) tables of the containerlab leaves and the openperouter router pods of the kind nodes with 'ip -j neigh show', grouped by VRF, flags FAILED and INCOMPLETE entries, and correlates the entries with the EVPN type-2 routes of the router: entries installed from EVPN whose route is gone, entries whose MAC differs from the one advertised for their IP, and remote type-2 routes within a subnet of the router without a neighbor entry, so stale or missing entries are spotted quickly.",
+			Annotations: readOnlyTool("Get neighbor tables"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob, spines included (e.g., 'leafA'). Optional, defaults to the leaves and kind nodes.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only report the neighbors of this VRF (e.g., 'red', 'default'). Optional.",
+					},
+					"problems_only": map[string]any{
+						"type":        "boolean",
+						"description": "Only list the failed, stale and missing entries. Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "list_vrfs",
+			Description: "Enumerates the VRFs of every FRR instance of the fabric (the containerlab leaves and spines, and the openperouter router pods of the kind nodes), from 'show vrf', 'show vrf vni json' and 'ip -j vrf show': table ID, L3VNI with its VXLAN and SVI interfaces, state and router MAC, and the interfaces enslaved to the VRF. VRFs that exist in FRR but not in the kernel, or in the kernel but not in FRR, and VRFs whose table differs between both are flagged.",
+			Annotations: readOnlyTool("List VRFs"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Only query the routers matching this name or glob (e.g., 'leaf*'). Optional, defaults to every router.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "clear_bgp_session",
+			Description: "Clears one BGP session of a router with 'clear bgp vrf <vrf> <neighbor> [soft [in|out]]': a soft clear refreshes the routes and keeps the session up, a hard one tears it down, withdrawing its routes until it is re-established, to drive convergence tests. Requires the approval of the user, asked by the server through an elicitation when the client supports it. With clients without elicitation support only, confirm must be set to true: without it, nothing is cleared and the call describes the session and the impact of clearing it, to be approved by the user first. After a hard clear, can wait for the session to be Established again and report how long it took.",
+			Annotations: destructiveTool("Clear BGP session"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to clear the session on (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"neighbor": map[string]any{
+						"type":        "string",
+						"description": "Address of the neighbor, or interface of an unnumbered session (e.g., '192.168.11.2', 'eth1'). A single neighbor: '*' is rejected.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "VRF of the session. Optional, defaults to 'default'.",
+					},
+					"mode": map[string]any{
+						"type":        "string",
+						"enum":        clearModes,
+						"description": "'soft' (route refresh in and out), 'soft-in', 'soft-out' or 'hard' (reset the TCP session). Optional, defaults to 'soft'.",
+					},
+					"confirm": map[string]any{
+						"type":        "boolean",
+						"description": "For clients without elicitation support: set to true, once the user approved it, to actually clear the session. Optional, defaults to false: only describe what would be cleared. Ignored when the server asks the user through an elicitation.",
+					},
+					"wait_seconds": map[string]any{
+						"type":        "number",
+						"description": fmt.Sprintf("After a hard clear, wait up to this many seconds for the session to be Established again (max %d). Optional, defaults to not waiting.", maxClearWaitSeconds),
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router", "neighbor"},
+			},
+		},
+		{
+			Name:        "apply_frr_config",
+			Description: "Applies a configuration snippet, in frr.conf syntax, to the running configuration of a router with 'vtysh -f', and returns the diff of the running configuration and the lines vtysh rejected. The running configuration is saved before and after the change to frr_changes_<timestamp>/, and the change can be reverted by calling the tool again with the pre-change snapshot as revert_snapshot, applied with frr-reload.py. The change is not saved to frr.conf.",
+			Annotations: destructiveTool("Apply FRR configuration"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to configure (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"config": map[string]any{
+						"type":        "string",
+						"description": "Configuration snippet, as in frr.conf (e.g., \"router bgp 64512\\n neighbor 192.168.11.2 shutdown\\n\"). Either config or revert_snapshot is required.",
+					},
+					"revert_snapshot": map[string]any{
+						"type":        "string",
+						"description": "Pre-change snapshot written by a previous call on the same router (frr_changes_<timestamp>/<router>_before.conf, relative to the working directory), to revert the running configuration to. Other files are refused.",
+					},
+					"dry_run": map[string]any{
+						"type":        "boolean",
+						"description": "Only check the snippet with 'vtysh --dryrun', without applying it. Optional.",
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router"},
+			},
+		},
+		{
+			Name:        "get_frr_logs",
+			Description: "Returns the logs of the FRR daemons (bgpd, zebra and bfdd by default) of a router or of the openperouter router pod of a kind node, for a time window and optionally only the lines containing a keyword, as one embedded text resource per daemon.",
+			Annotations: readOnlyTool("Get FRR logs"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to read the logs of (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"daemons": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string", "enum": []string{"bgpd", "zebra", "bfdd", "staticd", "watchfrr", "mgmtd"}},
+						"description": "Daemons to return the logs of. Optional, defaults to ['bgpd', 'zebra', 'bfdd'].",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "Start of the window, as RFC3339 or a duration ago (e.g., '15m'). Optional, defaults to 15 minutes ago.",
+					},
+					"until": map[string]any{
+						"type":        "string",
+						"description": "End of the window, as RFC3339 or a duration ago. Optional, defaults to now.",
+					},
+					"keyword": map[string]any{
+						"type":        "string",
+						"description": "Only return the lines containing this text, case insensitively (e.g., '192.168.11.2' or 'ADJCHANGE'). Optional.",
+					},
+					"max_lines": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of lines returned per daemon, the latest ones (default 500, max 5000).",
+					},
+				},
+				Required: []string{"router"},
+			},
+		},
+		{
+			Name:        "get_frr_daemons",
+			Description: "Reports, per router and kind node, the FRR version, the daemons watchfrr monitors with their state, pid and uptime, the times watchfrr saw them go down and the restarts of the FRR container, flagging the daemons not running or restarted since FRR started, such as a crashed bgpd.",
+			Annotations: readOnlyTool("Get FRR daemons"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*', 'pe-kind-a-*'). Optional, defaults to all routers and kind nodes.",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "Start of the window the watchfrr logs are searched for daemons going down, as RFC3339 or a duration ago (e.g., '15m'). Optional, defaults to one hour ago.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "check_rib_fib",
+			Description: "Compares, per VRF, the routes FRR selected in its RIB ('show ip route json') with the kernel FIB ('ip -j route') on the routers and kind nodes, and reports the routes present in only one of them and the ones whose nexthops differ, as zebra or netlink issues leave them.",
+			Annotations: readOnlyTool("Check RIB against FIB"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*', 'pe-kind-a-*'). Optional, defaults to all routers and kind nodes.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only compare this VRF (e.g., 'default' or 'red'). Optional, defaults to all VRFs.",
+					},
+					"afi": map[string]any{
+						"type":        "string",
+						"enum":        []string{"ipv4", "ipv6"},
+						"description": "Only compare this address family. Optional, defaults to both.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_route_policies",
+			Description: "Returns the route-maps of bgpd on a router, with their entries, match and set clauses and invoked counters, and the prefix-lists with their hit counts. Given a prefix, and optionally its attributes, evaluates it against a route-map as bgpd does and explains which entries match, whether the route is permitted or denied and what is set on it.",
+			Annotations: readOnlyTool("Get route policies"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to inspect (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"route_map": map[string]any{
+						"type":        "string",
+						"description": "Only return this route-map and the prefix-lists it matches on. Required to evaluate a prefix.",
+					},
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Prefix of the route to evaluate against route_map (e.g., '10.100.0.0/24'). Optional.",
+					},
+					"as_path": map[string]any{
+						"type":        "string",
+						"description": "AS path of the route, as space separated AS numbers (e.g., '64512 64513'), empty for a local route. Optional, needed by 'match as-path'.",
+					},
+					"communities": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Communities of the route (e.g., ['64512:100', 'no-export']). Optional, needed by 'match community'.",
+					},
+					"local_preference": map[string]any{
+						"type":        "integer",
+						"description": "Local preference of the route. Optional.",
+					},
+					"metric": map[string]any{
+						"type":        "integer",
+						"description": "MED of the route. Optional.",
+					},
+					"tag": map[string]any{
+						"type":        "integer",
+						"description": "Tag of the route. Optional.",
+					},
+					"source_protocol": map[string]any{
+						"type":        "string",
+						"description": "Protocol the route comes from (e.g., 'bgp', 'connected', 'static'). Optional.",
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router"},
+			},
+		},
+		{
+			Name:        "get_bgp_flaps",
+			Description: "Collects the established and dropped counters and the last reset reason of every BGP neighbor across the fabric and kind nodes, and lists the sessions that dropped the most since bgpd started, with their drop rate, so intermittent instability shows up even when every session is up at query time.",
+			Annotations: readOnlyTool("Get BGP flaps"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*', 'pe-kind-a-*'). Optional, defaults to all routers and kind nodes.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only report the sessions of this VRF. Optional.",
+					},
+					"include_stable": map[string]any{
+						"type":        "boolean",
+						"description": "Also list the sessions that never dropped. Optional.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of sessions listed, the flappiest first (default 20).",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_graceful_restart",
+			Description: "Reports the graceful restart and long-lived graceful restart negotiation of every BGP neighbor of the routers and kind nodes, with the modes, R and N bits and restart times, and per address family the F-bit, End-of-RIB and stale path timers, plus the BGP routes kept in the kernel, also while bgpd is down, to verify forwarding was preserved across a bgpd restart.",
+			Annotations: readOnlyTool("Get graceful restart state"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*', 'pe-kind-a-*'). Optional, defaults to all routers and kind nodes.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only report the neighbors of this VRF. Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "check_route_targets",
+			Description: "Extracts the import and export route targets of every L2 and L3 VNI of bgpd on the leaves and kind nodes, compares them across routers and against the route targets of the EVPN routes received, and flags the VNIs that import none of the route targets the same VNI exports elsewhere and the received routes no VNI or VRF imports, which silently black-hole traffic between leaves and the perouters.",
+			Annotations: readOnlyTool("Check route targets"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*', 'pe-kind-a-*'). Optional, defaults to the leaves and kind nodes.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "trace_route_origin",
+			Description: "Traces a prefix, an address or a MAC through the BGP tables of every router: the EVPN type-2 and type-5 routes advertising it and, for an address or prefix, the unicast BGP routes of every VRF covering it. Shows the routers originating it, the RDs, peers, AS paths, VTEPs and route targets of the paths each router received, ordered by AS path length from the origin, and flags the routers it stopped propagating before, the invalid paths and the type-5 routes imported into no VRF.",
+			Annotations: readOnlyTool("Trace route origin"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Prefix (e.g., '10.100.0.0/24'), matched exactly, or address (e.g., '10.100.0.5'), matched by the routes covering it. Either prefix or mac is required.",
+					},
+					"mac": map[string]any{
+						"type":        "string",
+						"description": "MAC address of the EVPN type-2 routes to trace. Either prefix or mac is required.",
+					},
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*'). Optional, defaults to all the routers.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "check_ecmp_paths",
+			Description: "Checks that multipath is installed towards the loopbacks of the other routers and the next hops of the EVPN routes: for each destination, compares the valid BGP paths (expected), the paths bgpd selected as best or multipath, and the nexthops of the kernel route, expanding nexthop groups. Flags the destinations missing paths, with a hint at 'maximum-paths' or 'bgp bestpath as-path multipath-relax'.",
+			Annotations: readOnlyTool("Check ECMP paths"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*'). Optional, defaults to all the routers.",
+					},
+					"destination": map[string]any{
+						"type":        "string",
+						"description": "Only check the destination covering this address (e.g., a VTEP). Optional.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "simulate_policy",
+			Description: "Simulates a candidate change to the route-maps and prefix-lists of bgpd on a router, without applying anything: evaluates a route-map against a set of routes with the current and the candidate policies, as get_route_policies does, and reports the routes newly accepted, newly rejected or modified (different set clauses). The routes are given, or the best routes of the BGP table of a VRF. The candidate is FRR configuration: 'route-map NAME permit|deny SEQ' stanzas with match, set, call and on-match clauses, each replacing the entry of the same sequence, 'ip|ipv6 prefix-list' lines, and their 'no' forms.",
+			Annotations: readOnlyTool("Simulate policy"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router whose policies are simulated (e.g., 'leafA' or a kind node name).",
+					},
+					"route_map": map[string]any{
+						"type":        "string",
+						"description": "Route-map whose outcome is compared, e.g. the inbound or outbound route-map of a neighbor.",
+					},
+					"candidate": map[string]any{
+						"type":        "string",
+						"description": "Candidate change, as FRR configuration lines (e.g., 'ip prefix-list PL-IN seq 15 permit 10.200.0.0/16 le 24' or 'route-map RM-IN permit 20\\n match ip address prefix-list PL-IN\\n set local-preference 200').",
+					},
+					"routes": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"prefix":           map[string]any{"type": "string"},
+								"as_path":          map[string]any{"type": "string"},
+								"communities":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+								"local_preference": map[string]any{"type": "integer"},
+								"metric":           map[string]any{"type": "integer"},
+								"tag":              map[string]any{"type": "integer"},
+								"source_protocol":  map[string]any{"type": "string"},
+							},
+							"required": []string{"prefix"},
+						},
+						"description": "Routes to evaluate, with the attributes get_route_policies takes. Optional, defaults to the best routes of the BGP table of vrf.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "VRF whose BGP table gives the routes, when routes is not given. Optional, defaults to 'default'.",
+					},
+					"neighbor": map[string]any{
+						"type":        "string",
+						"description": "Only evaluate the routes of the BGP table received from this neighbor. Optional.",
+					},
+					"max_routes": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of routes of the BGP table evaluated. Optional, defaults to 1000.",
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router", "route_map", "candidate"},
+			},
+		},
+		{
+			Name:        "get_bgp_topology",
+			Description: "Builds the BGP peering graph of the fabric from the BGP summaries of every router: who peers with whom, in which VRF and address families, their AS numbers and the session states, telling the routers apart by their addresses or advertised hostnames. Returns it as a Mermaid flowchart or a Graphviz dot graph, the sessions not established dashed, and flags the sessions down, the remote AS mismatches and the sessions configured on one end only.",
+			Annotations: readOnlyTool("Get BGP topology"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*'). Optional, defaults to all routers and kind nodes.",
+					},
+					"vrf": map[string]any{
+						"type":        "string",
+						"description": "Only draw the sessions of this VRF. Optional.",
+					},
+					"diagram": map[string]any{
+						"type":        "string",
+						"enum":        []string{"mermaid", "dot"},
+						"description": "Diagram language. Optional, defaults to mermaid.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "get_route_churn",
+			Description: "Reports the routes with the most announcements, withdrawals and changes over a window, from the events of the BMP collector when it runs, or by sampling the EVPN tables of the routers and the UPDATE counters of their neighbors. Attributes the churn to the leaf whose router ID is in the RD of the routes, or the origin AS, and to the VNI of their route targets, and flags flapping routes and a single origin generating most of the routing noise.",
+			Annotations: readOnlyTool("Get route churn"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"source": map[string]any{
+						"type":        "string",
+						"enum":        []string{"bmp", "poll"},
+						"description": "Where the events come from. Optional, defaults to bmp when the BMP collector runs, poll otherwise.",
+					},
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*'): the routers sampled, or the BMP routers whose events are counted. Optional, defaults to all routers.",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "With bmp, start of the window, as a duration before now (e.g., '1h') or an RFC3339 time. Optional, defaults to 15m.",
+					},
+					"duration_seconds": map[string]any{
+						"type":        "number",
+						"description": "With poll, how long the EVPN tables are sampled. Optional, defaults to 60, at most 600.",
+					},
+					"interval_seconds": map[string]any{
+						"type":        "number",
+						"description": "With poll, time between two samples. Optional, defaults to 5.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of routes listed. Optional, defaults to 20.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+		{
+			Name:        "run_vtysh",
+			Description: "Runs a vtysh command on a router and returns its output, for the queries no other tool covers (e.g., 'show bgp l2vpn evpn route rd 192.168.1.1:2 json', 'show zebra client'). Only commands starting with a prefix of the vtysh_allowlist of the config file are accepted, 'show' by default; commands are compared word by word, so abbreviated keywords, several lines and '|' output filters are refused. With a command ending in 'json', the json and yaml formats embed the parsed output. Annotated as destructive when the allowlist holds other commands than show.",
+			Annotations: readOnlyTool("Run vtysh command"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router to query (e.g., 'leafA', 'clab-kind-spine' or a kind node name).",
+					},
+					"command": map[string]any{
+						"type":        "string",
+						"description": "vtysh command, e.g. 'show bgp vrf red ipv4 unicast 10.1.1.0/24 json'.",
+					},
+					"format": formatProperty,
+				},
+				Required: []string{"router", "command"},
+			},
+		},
+		{
+			Name:        "check_mac_mobility",
+			Description: "Inspects the MACs of the L2 VNIs of the leaves and openperouter router pods, from 'show evpn mac vni all detail json', and compares their EVPN MAC mobility sequence numbers and duplicate detection state across routers. Reports the MACs frozen by duplicate detection, flapping between VTEPs (moves within the detection window, local on several leaves at once, seen behind different VTEPs) or that moved, and the routers that missed the last move. Also flags routers with duplicate address detection disabled or different thresholds.",
+			Annotations: readOnlyTool("Check MAC mobility"),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]any{
+					"router": map[string]any{
+						"type":        "string",
+						"description": "Router name or glob (e.g., 'leafA', 'leaf*'). Optional, defaults to the leaves and the openperouter router pods.",
+					},
+					"vni": map[string]any{
+						"type":        "integer",
+						"description": "Only this L2 VNI. Optional.",
+					},
+					"mac": map[string]any{
+						"type":        "string",
+						"description": "Only this MAC. Optional.",
+					},
+					"all": map[string]any{
+						"type":        "boolean",
+						"description": "Also list the MACs that never moved. Optional, defaults to false.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of MACs listed. Optional, defaults to 100.",
+					},
+					"format": formatProperty,
+				},
+			},
+		},
+	}
+}
+
+func (s *MCPServer) handleToolsList(id any) JSONRPCResponse {
+	result := ToolsListResult{Tools: s.tools()}
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
+func (s *MCPServer) handleToolCall(sessionID string, id any, params CallToolParams) JSONRPCResponse {
+	if !s.acquireToolSlot() {
+		return JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &RPCError{
+				Code:    errCodeServerBusy,
+				Message: fmt.Sprintf("Server busy: %d tool calls already running, retry later", s.config.MaxConcurrentTools),
+				Data: map[string]any{
+					"max_concurrent_tools": s.config.MaxConcurrentTools,
+					"queue_timeout":        s.config.ToolQueueTimeout.String(),
+				},
+			},
+		}
+	}
+	defer s.releaseToolSlot()
+
+	if s.demo != nil {
+		params.Arguments = s.demo.arguments(params.Arguments)
+	}
+
+	var result CallToolResult
+
+	switch params.Name {
+	case "extract_leaf_configs":
+		role, _ := params.Arguments["role"].(string)
+		result = s.extractLeafConfigs(role)
+	case "extract_spine_configs":
+		result = s.extractLeafConfigs("spine")
+	case "extract_perouter_frr_configs":
+		result = s.extractPERouterFRRConfigs(params.Arguments)
+	case "start_traffic_capture":
+		result = s.startTrafficCapture(sessionID, id, params.Arguments)
+	case "list_traffic_captures":
+		result = s.listTrafficCaptures(sessionID, params.Arguments)
+	case "stop_traffic_capture":
+		result = s.stopTrafficCapture(sessionID, params.Arguments)
+	case "bgp_session_fsm":
+		result = s.bgpSessionFSM(params.Arguments)
+	case "audit_network_policies":
+		result = s.auditNetworkPolicies(params.Arguments)
+	case "inspect_cni_chain":
+		result = s.inspectCNIChain(params.Arguments)
+	case "collect_node_runtime_logs":
+		result = s.collectNodeRuntimeLogs(params.Arguments)
+	case "check_route_watermarks":
+		result = s.checkRouteWatermarks(params.Arguments)
+	case "snapshot_state":
+		result = s.snapshotState(params.Arguments)
+	case "query_state":
+		result = s.queryState(params.Arguments)
+	case "bmp_peers":
+		result = s.bmpPeers(params.Arguments)
+	case "bmp_route_events":
+		result = s.bmpRouteEvents(params.Arguments)
+	case "evpn_multihoming":
+		result = s.evpnMultihoming(params.Arguments)
+	case "analyze_ecmp_distribution":
+		result = s.analyzeECMP(params.Arguments)
+	case "assert_state":
+		result = s.assertState(params.Arguments)
+	case "sample_trends":
+		result = s.sampleTrends(params.Arguments)
+	case "query_trends":
+		result = s.queryTrends(params.Arguments)
+	case "analyze_capture":
+		result = s.analyzeCapture(params.Arguments)
+	case "decode_bgp_capture":
+		result = s.decodeBGPCapture(params.Arguments)
+	case "analyze_vxlan":
+		result = s.analyzeVXLAN(params.Arguments)
+	case "analyze_arp":
+		result = s.analyzeARP(params.Arguments)
+	case "analyze_addressing":
+		result = s.analyzeAddressing(params.Arguments)
+	case "compare_capture_stats":
+		result = s.compareCaptureStats(params.Arguments)
+	case "analyze_icmp":
+		result = s.analyzeICMP(params.Arguments)
+	case "extract_flows":
+		result = s.extractFlows(params.Arguments)
+	case "export_capture":
+		result = s.exportCapture(params.Arguments)
+	case "merge_captures":
+		result = s.mergeCaptures(params.Arguments)
+	case "validate_capture_filter":
+		result = s.validateCaptureFilter(params.Arguments)
+	case "capture_status":
+		result = s.captureStatus(sessionID, params.Arguments)
+	case "watch_bgp_flaps":
+		result = s.watchBGPFlaps(sessionID, params.Arguments)
+	case "stop_bgp_flap_watch":
+		result = s.stopBGPFlapWatch(sessionID, params.Arguments)
+	case "stream_capture":
+		result = s.streamCapture(sessionID, params.Arguments)
+	case "stop_capture_stream":
+		result = s.stopCaptureStream(sessionID, params.Arguments)
+	case "cancel_scheduled_capture":
+		result = s.cancelScheduledCapture(sessionID, params.Arguments)
+	case "cleanup_captures":
+		result = s.cleanupCaptures(sessionID, params.Arguments)
+	case "archive_capture":
+		result = s.archiveCapture(sessionID, params.Arguments)
+	case "upload_artifacts":
+		result = s.uploadArtifacts(sessionID, params.Arguments)
+	case "slice_capture":
+		result = s.sliceCapture(params.Arguments)
+	case "recover_captures":
+		result = s.recoverCaptures(sessionID, params.Arguments)
+	case "discover_neighbors":
+		result = s.discoverNeighbors(params.Arguments)
+	case "assert_traffic":
+		result = s.assertTraffic(params.Arguments)
+	case "get_bgp_summary":
+		result = s.getBGPSummary(params.Arguments)
+	case "get_bgp_neighbor_detail":
+		result = s.getBGPNeighborDetail(params.Arguments)
+	case "get_evpn_routes":
+		result = s.getEVPNRoutes(params.Arguments)
+	case "get_evpn_vni_status":
+		result = s.getEVPNVNIStatus(params.Arguments)
+	case "get_route_table":
+		result = s.getRouteTable(params.Arguments)
+	case "diff_config_snapshots":
+		result = s.diffConfigSnapshots(params.Arguments)
+	case "get_bfd_status":
+		result = s.getBFDStatus(params.Arguments)
+	case "get_fdb":
+		result = s.getFDB(params.Arguments)
+	case "get_neigh":
+		result = s.getNeigh(params.Arguments)
+	case "list_vrfs":
+		result = s.listVRFs(params.Arguments)
+	case "clear_bgp_session":
+		result = s.clearBGPSession(sessionID, params.Arguments)
+	case "apply_frr_config":
+		result = s.applyFRRConfig(params.Arguments)
+	case "get_frr_logs":
+		result = s.getFRRLogs(params.Arguments)
+	case "get_frr_daemons":
+		result = s.getFRRDaemons(params.Arguments)
+	case "check_rib_fib":
+		result = s.checkRIBFIB(params.Arguments)
+	case "get_route_policies":
+		result = s.getRoutePolicies(params.Arguments)
+	case "get_bgp_flaps":
+		result = s.getBGPFlaps(params.Arguments)
+	case "get_graceful_restart":
+		result = s.getGracefulRestart(params.Arguments)
+	case "check_route_targets":
+		result = s.checkRouteTargets(params.Arguments)
+	case "trace_route_origin":
+		result = s.traceRouteOrigin(params.Arguments)
+	case "check_ecmp_paths":
+		result = s.checkECMPPaths(params.Arguments)
+	case "simulate_policy":
+		result = s.simulatePolicy(params.Arguments)
+	case "get_bgp_topology":
+		result = s.getBGPTopology(params.Arguments)
+	case "get_route_churn":
+		result = s.getRouteChurn(params.Arguments)
+	case "run_vtysh":
+		result = s.runVtyshTool(params.Arguments)
+	case "check_mac_mobility":
+		result = s.checkMACMobility(params.Arguments)
+	default:
+		return s.errorResponse(id, -32602, "Unknown tool: "+params.Name)
+	}
+
+	if result.StructuredContent != nil && s.sessionProtocol(sessionID) != structuredProtocolVersion {
+		result.StructuredContent = nil
+	}
+	if s.demo != nil {
+		result = s.demo.result(result)
+	}
+
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
+func executeScript(script string, args []string, env []string) (string, error) {
+	cmd := exec.Command("bash", "-c", script)
+	if len(args) > 0 {
+		cmd.Args = append(cmd.Args, args...)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func toolError(message string) CallToolResult {
+	return CallToolResult{
+		Content: []ContentItem{{
+			Type: "text",
+			Text: message,
+		}},
+		IsError: true,
+	}
+}
+
+// routerRoles are the routers extract-leaf-configs.sh can be restricted to.
+var routerRoles = []string{"all", "leaf", "spine"}
+
+// extractLeafConfigs runs extract-leaf-configs.sh on the routers of a role,
+// the leaves and kind clusters when empty.
+func (s *MCPServer) extractLeafConfigs(role string) CallToolResult {
+	if role == "" {
+		role = "leaf"
+	}
+	if !containsString(routerRoles, role) {
+		return toolError(fmt.Sprintf("invalid role %q, expected one of %s", role, strings.Join(routerRoles, ", ")))
+	}
+	output, err := executeScript(extractLeafConfigsScript, nil, []string{"ROUTER_ROLE=" + role})
+	if err != nil {
+		return CallToolResult{
+			Content: []ContentItem{{
+				Type: "text",
+				Text: fmt.Sprintf("Error executing extract-leaf-configs.sh: %v\nOutput: %s", err, output),
+			}},
+			IsError: true,
+		}
+	}
+
+	return CallToolResult{
+		Content: []ContentItem{
+			summaryContent(summarizeLeafConfigs(output)),
+			rawOutputContent(output),
+		},
+	}
+}
+
+var (
+	ansiEscapeRe      = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	configSavedRe     = regexp.MustCompile(`✓ Config saved to`)
+	configFailedRe    = regexp.MustCompile(`✗ Failed to extract`)
+	configOutputDirRe = regexp.MustCompile(`All configurations saved to: (\S+)`)
+)
+
+// summarizeLeafConfigs condenses the extract-leaf-configs.sh output into one
+// line for the user.
+func summarizeLeafConfigs(output string) string {
+	plain := ansiEscapeRe.ReplaceAllString(output, "")
+	saved := len(configSavedRe.FindAllString(plain, -1))
+	failed := len(configFailedRe.FindAllString(plain, -1))
+	dir := "the output directory"
+	if m := configOutputDirRe.FindStringSubmatch(plain); m != nil {
+		dir = m[1]
+	}
+	summary := fmt.Sprintf("Extracted %d FRR configuration(s) to %s", saved, dir)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) failed", failed)
+	}
+	return summary + "."
+}
+
+func (s *MCPServer) startTrafficCapture(sessionID string, id any, args map[string]any) CallToolResult {
+	if args["start_at"] != nil || args["schedule"] != nil {
+		return s.scheduleCapture(sessionID, args)
+	}
+	label, _ := args["label"].(string)
+	if len(label) > maxCaptureLabel || strings.ContainsFunc(label, unicode.IsControl) {
+		return toolError(fmt.Sprintf("label must be at most %d characters, without control characters", maxCaptureLabel))
+	}
+	outputDir, _ := args["output_dir"].(string)
+	if outputDir == "" {
+		outputDir = sessionCaptureDir(sessionID, label)
+	}
+
+	filter := defaultCaptureFilter
+	captureFilter, perNodeFilters, err := captureFiltersArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if captureFilter != "" {
+		filter = captureFilter
+	}
+	// The filter of a profile or VNI is and-ed with capture_filter, which
+	// narrows it down, e.g. to a VTEP.
+	baseFilter, err := profileFilter(args, "")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if v, ok := args["vni"].(float64); ok {
+		if v < 1 || v > maxVNI || v != float64(int(v)) {
+			return toolError(fmt.Sprintf("vni must be an integer between 1 and %d", maxVNI))
+		}
+		if baseFilter != "" {
+			return toolError("profile and vni are exclusive")
+		}
+		baseFilter = vniCaptureFilter(uint32(v))
+	}
+	if baseFilter != "" {
+		filter = baseFilter
+		if captureFilter != "" {
+			filter = andFilters(baseFilter, captureFilter)
+		}
+	}
+
+	nodeGlobs, err := stringsArg(args, "nodes")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	ifaceGlobs, err := stringsArg(args, "interfaces")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var duration time.Duration
+	if v, ok := args["duration_seconds"].(float64); ok {
+		if v <= 0 {
+			return toolError("duration_seconds must be positive")
+		}
+		duration = time.Duration(v * float64(time.Second))
+	}
+	maxPackets := 0
+	if v, ok := args["max_packets"].(float64); ok {
+		if v < 1 {
+			return toolError("max_packets must be at least 1")
+		}
+		maxPackets = int(v)
+	}
+	fileSizeKB, numFiles := 0, 0
+	if v, ok := args["file_size_mb"].(float64); ok {
+		if v <= 0 {
+			return toolError("file_size_mb must be positive")
+		}
+		fileSizeKB, numFiles = max(int(v*1000), 1), defaultRingFiles
+	}
+	if v, ok := args["num_files"].(float64); ok {
+		if fileSizeKB == 0 {
+			return toolError("num_files requires file_size_mb")
+		}
+		if v < 2 {
+			return toolError("num_files must be at least 2")
+		}
+		numFiles = int(v)
+	}
+	live, err := liveSummariesArgs(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	backend := tsharkBackend
+	if v, _ := args["backend"].(string); v != "" {
+		if v != tsharkBackend && v != afpacketBackend {
+			return toolError(fmt.Sprintf("invalid backend %q, expected %q or %q", v, tsharkBackend, afpacketBackend))
+		}
+		backend = v
+	}
+	if backend == afpacketBackend && fileSizeKB > 0 {
+		return toolError("file_size_mb requires the tshark backend, the afpacket one writes a single file per node")
+	}
+
+	hostGlobs, err := stringsArg(args, "host_interfaces")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	podGlobs, err := stringsArg(args, "pods")
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	routerVethsMode, _ := args["router_veths"].(bool)
+	if routerVethsMode && len(ifaceGlobs) > 0 {
+		return toolError("router_veths and interfaces are exclusive")
+	}
+	nodes, interfaces, skipped, err := captureTargets(nodeGlobs, ifaceGlobs)
+	if err == nil && routerVethsMode {
+		nodes, interfaces, skipped, err = routerVethTargets(nodes)
+	}
+	if err != nil {
+		return toolError(fmt.Sprintf("Error selecting capture targets: %v", err))
+	}
+	selection := ""
+	switch {
+	case routerVethsMode:
+		for _, node := range nodes {
+			selection += fmt.Sprintf("Router pod veths of %s: %s\n", node, strings.Join(interfaces[node], ", "))
+		}
+		if len(skipped) > 0 {
+			selection += "Skipped, no router pod veth: " + strings.Join(skipped, ", ") + "\n"
+		}
+	case len(skipped) > 0:
+		selection += "Skipped, no matching interface: " + strings.Join(skipped, ", ") + "\n"
+	}
+	var pods []podTarget
+	if len(podGlobs) > 0 {
+		if pods, err = capturePods(podGlobs); err != nil {
+			return toolError(fmt.Sprintf("Error selecting pods: %v", err))
+		}
+		for _, p := range pods {
+			selection += fmt.Sprintf("Pod %s/%s captured on %s as %s\n", p.namespace, p.name, p.node, p.captureNode())
+		}
+	}
+	var hostIfaces []string
+	if len(hostGlobs) > 0 {
+		if _, err := exec.LookPath("tshark"); err != nil && backend == tsharkBackend {
+			return toolError("host_interfaces requires tshark installed on the host running the server")
+		}
+		hostIfaces, err = hostCaptureInterfaces(hostGlobs)
+		if err != nil {
+			return toolError(fmt.Sprintf("Error selecting host interfaces: %v", err))
+		}
+		if interfaces == nil {
+			interfaces = make(map[string][]string)
+		}
+		interfaces[hostCaptureNode] = hostIfaces
+	}
+
+	// Nodes absent from a per-node capture_filter capture with the default
+	// filter, or the one of the profile or VNI.
+	var nodeFilters map[string]string
+	if perNodeFilters != nil {
+		captured := append([]string(nil), nodes...)
+		for _, p := range pods {
+			captured = append(captured, p.captureNode())
+		}
+		if len(hostIfaces) > 0 {
+			captured = append(captured, hostCaptureNode)
+		}
+		if nodeFilters, err = resolveNodeFilters(perNodeFilters, captured); err != nil {
+			return toolError(fmt.Sprintf("Error selecting capture filters: %v", err))
+		}
+		if baseFilter != "" {
+			for node, f := range nodeFilters {
+				nodeFilters[node] = andFilters(baseFilter, f)
+			}
+		}
+	}
+
+	// The filter is compiled on the nodes first, so a typo fails the call
+	// instead of leaving every node capturing nothing.
+	if skip, _ := args["skip_filter_validation"].(bool); (filter != defaultCaptureFilter || nodeFilters != nil) && !skip {
+		checks := checkNodeCaptureFilters(filter, nodeFilters, nodes, interfaces)
+		if problems := filterProblems(checks); len(problems) > 0 && nodeFilters != nil {
+			return toolError(fmt.Sprintf("Invalid capture filters, no capture started:\n  %s\n\nFix the filters, or pass skip_filter_validation if they are known to be right.",
+				strings.Join(problems, "\n  ")))
+		} else if len(problems) > 0 {
+			return toolError(fmt.Sprintf("Invalid capture filter %q, no capture started:\n  %s\n\nFix the filter, or pass skip_filter_validation if it is known to be right.",
+				filter, strings.Join(problems, "\n  ")))
+		}
+		validated := 0
+		for _, c := range checks {
+			if c.skipped == "" {
+				validated++
+			}
+		}
+		selection += fmt.Sprintf("Capture filter validated on %d of %d node(s)\n", validated, len(nodes))
+	}
+
+	rt, err := newDockerAPI()
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	// The snapshot is taken while the capture starts up, and waited for
+	// before replying.
+	snapshotDone := make(chan string, 1)
+	go func() {
+		dir, routers, err := saveControlPlaneSnapshot(outputDir, "start")
+		if err != nil {
+			snapshotDone <- fmt.Sprintf("Control-plane snapshot failed: %v", err)
+			return
+		}
+		snapshotDone <- fmt.Sprintf("Control-plane snapshot of %d routers saved to %s", routers, dir)
+	}()
+
+	captureID := s.newCaptureID()
+	run := newCaptureRun(rt, outputDir, filter)
+	run.nodeFilters = nodeFilters
+	run.maxPackets, run.fileSizeKB, run.numFiles, run.live = maxPackets, fileSizeKB, numFiles, live != nil
+	run.backend = backend
+	run.maxDiskUsage = s.config.CaptureMaxDiskUsage
+	done := make(chan struct{})
+	call := &ActiveCall{
+		CaptureID:   captureID,
+		ID:          id,
+		SessionID:   sessionID,
+		OutputDir:   outputDir,
+		Run:         run,
+		Done:        done,
+		Filter:      filter,
+		NodeFilters: nodeFilters,
+		Interfaces:  interfaces,
+		Label:       label,
+		Started:     time.Now(),
+		MaxPackets:  maxPackets,
+		FileSizeKB:  fileSizeKB,
+		NumFiles:    numFiles,
+		Live:        live,
+		PIDs:        make(map[string]int),
+	}
+	if live != nil {
+		live.path = liveSummariesPath(outputDir, captureID)
+	}
+	run.onStarted = func(node string, pid int) {
+		s.mu.Lock()
+		call.Nodes = append(call.Nodes, node)
+		call.PIDs[node] = pid
+		s.mu.Unlock()
+		s.saveCaptureState()
+	}
+	run.onLive = func(node, summary string) { s.handleLiveSummary(call, node, summary) }
+	s.reportCopies(call)
+	if err := run.start(nodes, pods, interfaces, hostIfaces); err != nil {
+		<-snapshotDone
+		return toolError(fmt.Sprintf("Error starting the capture: %v", err))
+	}
+
+	s.mu.Lock()
+	s.activeCalls[captureID] = call
+	var autoStop *time.Timer
+	if duration > 0 {
+		call.StopAt = call.Started.Add(duration)
+		autoStop = time.AfterFunc(duration, func() { s.autoStopCapture(captureID) })
+	}
+	s.mu.Unlock()
+	s.saveCaptureState()
+
+	go s.awaitCapture(call, autoStop)
+
+	allStarted := run.waitStarted(captureStartTimeout)
+	report, capturing := run.startReport()
+	snapshot := <-snapshotDone
+
+	if allStarted && capturing == 0 {
+		run.stop()
+		<-done
+		return toolError(fmt.Sprintf("Traffic capture %s failed to start on every node, see %s:\n%s", captureID, filepath.Join(outputDir, captureLogName), report))
+	}
+
+	stopHint := fmt.Sprintf("The capture will continue running. Use the stop_traffic_capture tool with capture_id %s to stop this capture and retrieve its files, or without capture_id to stop every capture of this session.", captureID)
+	var limits []string
+	if duration > 0 {
+		limits = append(limits, "after "+duration.String())
+	}
+	if maxPackets > 0 {
+		limits = append(limits, fmt.Sprintf("once every node captured %d packets", maxPackets))
+	}
+	if len(limits) > 0 {
+		stopHint = fmt.Sprintf("The capture stops automatically %s, and a notification is sent once its files are copied to the output directory. Use the stop_traffic_capture tool with capture_id %s to stop it earlier.", strings.Join(limits, " or "), captureID)
+	}
+
+	if live != nil {
+		selection += live.describe(call)
+	}
 
-	var captureProcesses []*exec.Cmd
-	var captureIDs []string
+	return CallToolResult{
+		Content: []ContentItem{
+			summaryContent(fmt.Sprintf("Traffic capture started and running in the background on %d of %d node(s) (capture_id: %s).\n\n%s%sOutput directory: %s\n%s\n\n%s",
+				capturing, len(run.nodes), captureID, report, selection, outputDir, snapshot, stopHint)),
+		},
+		IsError: false,
+	}
+}
 
-	for reqID, call := range s.activeCalls {
-		if call.Cmd != nil && call.Cmd.Process != nil {
-			captureProcesses = append(captureProcesses, call.Cmd)
-			captureIDs = append(captureIDs, reqID)
+// awaitCapture waits for a capture to end, stopped or on its own, to
+// annotate its files and move it to the finished captures.
+func (s *MCPServer) awaitCapture(call *ActiveCall, autoStop *time.Timer) {
+	<-call.Run.done
+	if autoStop != nil {
+		autoStop.Stop()
+	}
+	s.annotateCaptureFiles(call)
+	if s.config.CaptureEncryptionKey != "" {
+		s.encryptCaptureFiles(call)
+	}
+	if call.Run.limitReached {
+		// The capture ended on its own: the closing snapshot is taken now,
+		// to be listed in the manifest.
+		if _, _, err := saveControlPlaneSnapshot(call.OutputDir, "stop"); err != nil {
+			fmt.Fprintf(os.Stderr, "Control-plane snapshot for capture %s failed: %v\n", call.CaptureID, err)
 		}
 	}
+	s.mu.Lock()
+	call.Finished = time.Now()
+	s.mu.Unlock()
+	manifest, err := writeCaptureManifest(call)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Writing the manifest of capture %s failed: %v\n", call.CaptureID, err)
+	}
+	s.mu.Lock()
+	call.Manifest = manifest
+	delete(s.activeCalls, call.CaptureID)
+	s.finishedCaptures = append(s.finishedCaptures, call)
+	if len(s.finishedCaptures) > maxFinishedCaptures {
+		s.finishedCaptures = s.finishedCaptures[1:]
+	}
 	s.mu.Unlock()
+	s.saveCaptureState()
+	close(call.Done)
+	s.notifyResourcesChanged()
+	switch {
+	case call.Run.diskFull != nil:
+		s.diskFull(call)
+	case call.Run.limitReached:
+		s.packetLimitReached(call)
+	}
+}
+
+// sessionCaptureDir returns the default output directory for a capture
+// started by the given session, so concurrent users never share one, named
+// after the label of the capture if any.
+func sessionCaptureDir(sessionID, label string) string {
+	name := "capture_" + time.Now().Format("20060102_150405")
+	if slug := labelSlug(label); slug != "" {
+		name += "_" + slug
+	}
+	return filepath.Join(".", captureRoot, sessionID, name)
+}
+
+// labelSlug returns a capture label reduced to the characters safe in a
+// directory name, others replaced by dashes.
+func labelSlug(label string) string {
+	var b strings.Builder
+	for _, r := range label {
+		if r == '_' || r == '-' || r == '.' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxLabelSlug {
+		slug = slug[:maxLabelSlug]
+	}
+	return strings.Trim(slug, "-.")
+}
+
+// sessionCaptures returns the running captures started by a session, or by
+// every session when sessionID is empty.
+func (s *MCPServer) sessionCaptures(sessionID string) []*ActiveCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []*ActiveCall
+	for _, call := range s.activeCalls {
+		if sessionID != "" && call.SessionID != sessionID {
+			continue
+		}
+		if call.Run != nil {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// sessionCapture returns the running capture with the given ID if it was
+// started by the session, or by any session when sessionID is empty.
+func (s *MCPServer) sessionCapture(sessionID, captureID string) *ActiveCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	call := s.activeCalls[captureID]
+	if call == nil || (sessionID != "" && call.SessionID != sessionID) || call.Run == nil {
+		return nil
+	}
+	return call
+}
+
+func (s *MCPServer) stopTrafficCapture(sessionID string, args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	scope := sessionID
+	if allSessions, ok := args["all_sessions"].(bool); ok && allSessions {
+		scope = ""
+	}
+
+	var calls []*ActiveCall
+	if captureID, _ := args["capture_id"].(string); captureID != "" {
+		call := s.sessionCapture(scope, captureID)
+		if call == nil {
+			text := fmt.Sprintf("No running capture %s found for this session.", captureID)
+			if scope == "" {
+				text = fmt.Sprintf("No running capture %s found.", captureID)
+			}
+			return toolError(text)
+		}
+		calls = []*ActiveCall{call}
+	} else {
+		calls = s.sessionCaptures(scope)
+	}
 
-	if len(captureProcesses) == 0 {
+	if len(calls) == 0 {
+		text := "No active traffic captures found for this session."
+		if scope == "" {
+			text = "No active traffic captures found."
+		}
 		return CallToolResult{
 			Content: []ContentItem{{
 				Type: "text",
-				Text: "No active traffic captures found.",
+				Text: text,
 			}},
 			IsError: false,
 		}
 	}
 
-	var stoppedCount int
-	for i, cmd := range captureProcesses {
-		reqID := captureIDs[i]
-		if cmd.Process != nil {
-			fmt.Fprintf(os.Stderr, "Stopping capture for request %s (PID: %d)\n", reqID, cmd.Process.Pid)
-			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to send SIGTERM to PID %d: %v\n", cmd.Process.Pid, err)
-			} else {
-				stoppedCount++
+	stoppedCount := stopCaptures(calls)
+
+	var dirs []string
+	for _, call := range calls {
+		if scope == "" {
+			dirs = append(dirs, fmt.Sprintf("- %s: %s (session %s, %s)", call.CaptureID, call.OutputDir, call.SessionID, s.sessionTransport(call.SessionID)))
+		} else {
+			dirs = append(dirs, fmt.Sprintf("- %s: %s", call.CaptureID, call.OutputDir))
+		}
+	}
+
+	nodes := newTable("nodes", "capture_id", "node", "status", "files", "bytes", "retries", "problems")
+	files := newTable("files", "capture_id", "path", "kind", "node", "bytes", "sha256")
+	manifests := []string{}
+	var report strings.Builder
+	failed := 0
+	for _, call := range calls {
+		fmt.Fprintf(&report, "\n%s:\n", call.CaptureID)
+		if call.Manifest != nil {
+			path := filepath.Join(call.OutputDir, captureManifestName)
+			manifests = append(manifests, path)
+			fmt.Fprintf(&report, "  manifest of %d file(s) with their SHA-256: %s\n", len(call.Manifest.Files), path)
+			for _, f := range call.Manifest.Files {
+				files.add(call.CaptureID, f.Path, f.Kind, f.Node, f.Bytes, f.SHA256)
+			}
+		}
+		for _, c := range call.Run.nodeCopies() {
+			problems := c.problems
+			if c.startErr != nil {
+				problems = append([]string{c.startErr.Error()}, problems...)
+			}
+			nodes.add(call.CaptureID, c.node, c.status(), c.files, c.bytes, c.retries, problems)
+			mark := "✓"
+			if c.status() != "copied" {
+				mark = "✗"
+				failed++
 			}
+			fmt.Fprintf(&report, "  %s %s: %s", mark, c.node, c.status())
+			if c.startErr == nil {
+				fmt.Fprintf(&report, ", %d file(s), %s", c.files, formatSize(c.bytes))
+			}
+			if c.retries > 0 {
+				fmt.Fprintf(&report, ", copies retried %d time(s)", c.retries)
+			}
+			report.WriteString("\n")
+			for _, p := range problems {
+				fmt.Fprintf(&report, "      %s\n", p)
+			}
+		}
+	}
+	text := fmt.Sprintf("Successfully stopped %d traffic capture(s).\n\nThe cleanup process has:\n- Terminated the tshark processes, or capture agents, in containers\n- Copied pcap files from containers to the host\n- Saved a control-plane snapshot next to each capture\n\nCapture files were saved to:\n%s\n\nCopy-out, per node:%s", stoppedCount, strings.Join(dirs, "\n"), report.String())
+	if failed > 0 {
+		text += fmt.Sprintf("\n%d node(s) had problems, details in %s.", failed, captureLogName)
+	}
+	if format == "text" {
+		return CallToolResult{
+			Content: []ContentItem{summaryContent(text)},
+			IsError: false,
 		}
 	}
+	var fields record
+	fields.add("stopped", stoppedCount)
+	fields.add("failed_nodes", failed)
+	fields.add("manifests", manifests)
+	return formattedResult(format, text, false, fields, nodes, files)
+}
+
+// reportCopies notifies the session that started a capture as each node is
+// stopped and its files copied out.
+func (s *MCPServer) reportCopies(call *ActiveCall) {
+	call.Run.onCopied = func(c nodeCopy, done, total int) {
+		level := "info"
+		message := fmt.Sprintf("Capture %s, %s: %s, %d file(s), %s (%d/%d nodes)", call.CaptureID, c.node, c.status(), c.files, formatSize(c.bytes), done, total)
+		if len(c.problems) > 0 {
+			level = "warning"
+			message += ": " + strings.Join(c.problems, "; ")
+		}
+		s.notify(call.SessionID, level, map[string]any{
+			"event":      "capture_copy_progress",
+			"capture_id": call.CaptureID,
+			"node":       c.node,
+			"status":     c.status(),
+			"files":      c.files,
+			"bytes":      c.bytes,
+			"retries":    c.retries,
+			"problems":   c.problems,
+			"done":       done,
+			"total":      total,
+			"message":    message,
+		})
+	}
+}
+
+// stopCaptures makes the captures stop tshark on their nodes and copy the
+// pcap files to the host, and waits for them. Captures still copying after
+// 15s are aborted. A control-plane snapshot is saved in each capture
+// directory first, to match the end of the capture. It returns the number
+// of captures stopped.
+func stopCaptures(calls []*ActiveCall) int {
+	var wg sync.WaitGroup
+	for _, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := saveControlPlaneSnapshot(call.OutputDir, "stop"); err != nil {
+				fmt.Fprintf(os.Stderr, "Control-plane snapshot for capture %s failed: %v\n", call.CaptureID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, call := range calls {
+		fmt.Fprintf(os.Stderr, "Stopping capture %s for request %v\n", call.CaptureID, call.ID)
+		call.Run.stop()
+	}
 
 	fmt.Fprintf(os.Stderr, "Waiting for captures to cleanup and copy files...\n")
 
 	done := make(chan bool, 1)
 	go func() {
-		for _, cmd := range captureProcesses {
-			cmd.Wait()
+		for _, call := range calls {
+			<-call.Done
 		}
 		done <- true
 	}()
@@ -427,24 +3303,158 @@ func (s *MCPServer) stopTrafficCapture() CallToolResult {
 	case <-done:
 		fmt.Fprintf(os.Stderr, "All captures stopped successfully\n")
 	case <-time.After(15 * time.Second):
-		fmt.Fprintf(os.Stderr, "Timeout waiting for captures to stop, forcing kill\n")
-		for _, cmd := range captureProcesses {
-			if cmd.Process != nil {
-				cmd.Process.Kill()
+		fmt.Fprintf(os.Stderr, "Timeout waiting for captures to stop, aborting the copies\n")
+		for _, call := range calls {
+			call.Run.abort()
+		}
+		<-done
+	}
+
+	return len(calls)
+}
+
+// autoStopCapture stops a capture whose duration elapsed, and notifies the
+// session that started it once the files are on the host.
+func (s *MCPServer) autoStopCapture(captureID string) {
+	call := s.sessionCapture("", captureID)
+	if call == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Capture %s reached its duration, stopping it\n", captureID)
+	stopCaptures([]*ActiveCall{call})
+	<-call.Done
+	s.notifyCaptureStopped(call, "info", "duration elapsed", fmt.Sprintf("stopped after %s", call.StopAt.Sub(call.Started)))
+}
+
+// packetLimitReached notifies the session of a capture that ended after
+// every node reached the packet limit.
+func (s *MCPServer) packetLimitReached(call *ActiveCall) {
+	fmt.Fprintf(os.Stderr, "Capture %s reached its packet limit\n", call.CaptureID)
+	s.notifyCaptureStopped(call, "info", "packet limit reached", fmt.Sprintf("captured %d packets per node", call.MaxPackets))
+}
+
+// diskFull warns the session of a capture stopped because a disk it wrote
+// to reached capture_max_disk_usage_percent.
+func (s *MCPServer) diskFull(call *ActiveCall) {
+	u := call.Run.diskFull
+	fmt.Fprintf(os.Stderr, "Capture %s stopped: %s\n", call.CaptureID, u)
+	s.notifyCaptureStopped(call, "warning", "disk usage limit reached",
+		fmt.Sprintf("stopped because %s (limit %d%%)", u, call.Run.maxDiskUsage))
+}
+
+// notifyCaptureStopped tells the session that started a capture the server
+// stopped that its files are on the host.
+func (s *MCPServer) notifyCaptureStopped(call *ActiveCall, level, reason, detail string) {
+	s.mu.Lock()
+	nodes := append([]string(nil), call.Nodes...)
+	s.mu.Unlock()
+	files := []map[string]any{}
+	for _, node := range nodes {
+		for _, path := range capturedFiles(call.OutputDir, call.nodeFilter(node), node) {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
 			}
+			files = append(files, map[string]any{"node": node, "file": path, "bytes": info.Size()})
+		}
+	}
+	// The pcaps are served as resources while they are the most recent of
+	// their node and session, except in demo mode.
+	resources := []string{}
+	for _, c := range listCaptureFiles() {
+		if s.demo == nil && filepath.Clean(filepath.Dir(c.path)) == filepath.Clean(call.OutputDir) {
+			resources = append(resources, fmt.Sprintf("capture://%s/%s.pcapng", c.session, c.node))
 		}
 	}
+	data := map[string]any{
+		"event":      "capture_stopped",
+		"capture_id": call.CaptureID,
+		"reason":     reason,
+		"output_dir": call.OutputDir,
+		"files":      files,
+		"resources":  resources,
+		"message":    fmt.Sprintf("Capture %s %s, %d pcap file(s) saved to %s", call.CaptureID, detail, len(files), call.OutputDir),
+	}
+	if call.Manifest != nil {
+		data["manifest"] = filepath.Join(call.OutputDir, captureManifestName)
+	}
+	if call.Label != "" {
+		data["label"] = call.Label
+	}
+	s.notify(call.SessionID, level, data)
+}
 
-	return CallToolResult{
-		Content: []ContentItem{{
-			Type: "text",
-			Text: fmt.Sprintf("Successfully stopped %d traffic capture(s).\n\nThe cleanup process has:\n- Terminated all tshark processes in containers\n- Copied pcap files from containers to the host\n\nCheck the output directory for the capture files.", stoppedCount),
-		}},
-		IsError: false,
+// openSession records a session opened on the given transport.
+func (s *MCPServer) openSession(sessionID, transport string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sessionID] = &sessionInfo{Transport: transport, Opened: time.Now()}
+}
+
+// sessionTransport returns the transport serving a session, or "closed" if
+// the session is gone.
+func (s *MCPServer) sessionTransport(sessionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.sessions[sessionID]; ok {
+		return info.Transport
+	}
+	return "closed"
+}
+
+// sessionProtocol returns the protocol version a session negotiated, empty
+// before initialize or for transports without one.
+func (s *MCPServer) sessionProtocol(sessionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.sessions[sessionID]; ok {
+		return info.ProtocolVersion
+	}
+	return ""
+}
+
+// forgetSession stops tracking a session without touching its captures.
+func (s *MCPServer) forgetSession(sessionID string) {
+	s.mu.Lock()
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+	s.cancelPending(sessionID)
+}
+
+// closeSession releases everything a session left behind. Captures it
+// started and never stopped are terminated, which also copies whatever was
+// captured so far to the host.
+func (s *MCPServer) closeSession(sessionID string) {
+	s.forgetSession(sessionID)
+	stopFlapWatches(s.sessionFlapWatches(sessionID))
+	cancelSchedules(s.sessionSchedules(sessionID))
+	s.stopStreams(s.sessionStreams(sessionID))
+
+	calls := s.sessionCaptures(sessionID)
+	if len(calls) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Session %s ended with %d active capture(s), stopping them\n", sessionID, len(calls))
+	stopCaptures(calls)
+}
+
+// closeAllSessions stops the captures of every session, on shutdown.
+func (s *MCPServer) closeAllSessions() {
+	stopFlapWatches(s.sessionFlapWatches(""))
+	cancelSchedules(s.sessionSchedules(""))
+	s.stopStreams(s.sessionStreams(""))
+	calls := s.sessionCaptures("")
+	if len(calls) == 0 {
+		return
 	}
+	fmt.Fprintf(os.Stderr, "Shutting down with %d active capture(s), stopping them\n", len(calls))
+	stopCaptures(calls)
 }
 
 func (s *MCPServer) errorResponse(id any, code int, message string) JSONRPCResponse {
+	if s.demo != nil {
+		message = s.demo.text(message)
+	}
 	return JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
@@ -456,32 +3466,151 @@ func (s *MCPServer) errorResponse(id any, code int, message string) JSONRPCRespo
 }
 
 func main() {
-	server := NewMCPServer(os.Stdout)
-	scanner := bufio.NewScanner(os.Stdin)
+	// The afpacket backend runs the binary on the nodes as its capture agent.
+	if len(os.Args) > 1 && os.Args[1] == captureAgentCommand {
+		os.Exit(runCaptureAgent(os.Args[2:]))
+	}
 
-	const maxCapacity = 1024 * 1024
-	buf := make([]byte, maxCapacity)
-	scanner.Buffer(buf, maxCapacity)
+	listen := flag.String("listen", "", "Serve the HTTP+SSE transport on this address (e.g. ':8080') instead of stdio")
+	wsListen := flag.String("ws", "", "Serve the WebSocket transport on this address (e.g. ':8081'), alone or alongside --listen")
+	grpcListen := flag.String("grpc", "", "Serve the gRPC control API on this address (e.g. ':9090'), for CI pipelines and non-LLM tooling")
+	withStdio := flag.Bool("stdio", false, "Also serve stdio when --listen, --ws or --grpc is set, sharing tools and captures between the transports")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file for the network listeners")
+	tlsKey := flag.String("tls-key", "", "TLS private key file for the network listeners")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA bundle used to verify client certificates (enables mutual TLS)")
+	configFile := flag.String("config", "", "JSON configuration file")
+	instructions := flag.String("instructions", "", "Instructions returned to the client on initialize (overrides the config file)")
+	idleTimeout := flag.Duration("session-idle-timeout", 0, "Time after which a disconnected HTTP session is cleaned up, 0 to disable (overrides the config file, default 5m)")
+	exportFormat := flag.String("export-manifest", "", "Write the tool manifest to stdout as 'json' or 'yaml' and exit")
+	bmpListen := flag.String("bmp-listen", "", "Run the BMP collector on this address (e.g. ':11019', overrides the config file)")
+	webUI := flag.Bool("web-ui", false, "Serve a read-only web UI on /ui/ of the --listen address")
+	demo := flag.Bool("demo", false, "Rewrite node names, IP addresses and ASNs in everything sent to clients, for public recordings")
+	generateKey := flag.String("generate-capture-key", "", "Write a new capture decryption key to this file, print its public key for capture_encryption_key and exit")
+	flag.Parse()
+
+	if *exportFormat != "" {
+		if err := exportManifest(os.Stdout, *exportFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting manifest: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
+	if *generateKey != "" {
+		public, err := generateCaptureKey(*generateKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating capture key: %v\n", err)
+			os.Exit(1)
 		}
+		fmt.Println(public)
+		return
+	}
 
-		var req JSONRPCRequest
-		if err := json.Unmarshal(line, &req); err != nil {
-			resp := server.errorResponse(nil, -32700, "Parse error")
-			server.writeResponse(resp)
-			continue
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if *instructions != "" {
+		config.Instructions = *instructions
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "session-idle-timeout" {
+			return
+		}
+		if *idleTimeout < 0 {
+			fmt.Fprintf(os.Stderr, "--session-idle-timeout must not be negative\n")
+			os.Exit(1)
+		}
+		config.SessionIdleTimeout = Duration{*idleTimeout}
+	})
+	if *bmpListen != "" {
+		config.BMPListen = *bmpListen
+	}
+	if *webUI {
+		config.WebUI = true
+	}
+	if *demo {
+		config.DemoMode = true
+	}
+	if config.WebUI && *listen == "" {
+		fmt.Fprintf(os.Stderr, "The web UI requires --listen\n")
+		os.Exit(1)
+	}
+
+	server := NewMCPServer(os.Stdout, config)
+
+	if config.BMPListen != "" {
+		server.bmp, err = startBMPCollector(config.BMPListen, config.StateDB, config.BMPRetention.Duration)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting BMP collector: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if config.TrendInterval.Duration > 0 {
+		if err := startTrendSampler(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting trend sampler: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Orphans are adopted before the retention policy runs, which would
+	// otherwise take their directories for finished captures.
+	if adopted, failures := server.recoverOrphanedCaptures(); len(adopted) > 0 || len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "Adopted %d capture(s) orphaned by a previous server instance:\n%s", len(adopted), describeRecovered(adopted))
+		for _, failure := range failures {
+			fmt.Fprintf(os.Stderr, "Recovering captures: %s\n", failure)
+		}
+	}
+
+	if config.CaptureRetention.Duration > 0 || config.CaptureMaxTotalMB > 0 {
+		server.startCaptureRetention()
+	}
+
+	if *listen == "" && *wsListen == "" && *grpcListen == "" {
+		if *tlsCert != "" || *tlsKey != "" || *tlsClientCA != "" {
+			fmt.Fprintf(os.Stderr, "TLS flags require --listen, --ws or --grpc\n")
+			os.Exit(1)
+		}
+		if *withStdio {
+			fmt.Fprintf(os.Stderr, "--stdio requires --listen, --ws or --grpc\n")
+			os.Exit(1)
+		}
+		if err := serveStdio(server); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			os.Exit(1)
 		}
+		return
+	}
 
-		resp := server.handleRequest(req)
-		server.writeResponse(resp)
+	tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring TLS: %v\n", err)
+		os.Exit(1)
+	}
+	if !*withStdio {
+		if err := serveNetwork(server, *listen, *wsListen, *grpcListen, tlsConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+	// All transports share the server, hence the tools and captures. The
+	// process belongs to the stdio client that launched it, so it exits when
+	// that client goes away, stopping the captures of the network sessions
+	// too.
+	go func() {
+		if err := serveNetwork(server, *listen, *wsListen, *grpcListen, tlsConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+	stdinErr := serveStdio(server)
+	server.closeAllSessions()
+	if stdinErr != nil {
+		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", stdinErr)
 		os.Exit(1)
 	}
 }
@@ -492,5 +3621,13 @@ func (s *MCPServer) writeResponse(resp JSONRPCResponse) {
 		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
 		return
 	}
-	fmt.Println(string(data))
+	s.writeMessage(data)
+}
+
+// writeMessage writes an encoded message on its own line, so that
+// responses and notifications sent concurrently don't interleave.
+func (s *MCPServer) writeMessage(data []byte) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	fmt.Fprintln(s.writer, string(data))
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// manifest is the tool catalog written by --export-manifest, for publishing
+// to MCP registries and validating in other tooling.
+type manifest struct {
+	ProtocolVersion   string             `json:"protocolVersion"`
+	ServerInfo        ServerInfo         `json:"serverInfo"`
+	Tools             []Tool             `json:"tools"`
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+}
+
+// exportManifest writes the manifest to w as "json" or "yaml".
+func exportManifest(w io.Writer, format string) error {
+	m := manifest{
+		ProtocolVersion:   protocolVersion,
+		ServerInfo:        serverInfo,
+		Tools:             toolDefinitions(),
+		ResourceTemplates: resourceTemplates,
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "yaml":
+		// Going through JSON keeps the field names of the protocol.
+		data, err := jsonToYAML(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return fmt.Errorf("unknown manifest format %q, expected json or yaml", format)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+)
+
+// neighEntry is a neighbor as reported by 'ip -j neigh show'.
+type neighEntry struct {
+	Dst    string   `json:"dst"`
+	Dev    string   `json:"dev"`
+	LLAddr string   `json:"lladdr"`
+	State  []string `json:"state"`
+	Flags  []string `json:"flags"`
+}
+
+// failed tells whether the kernel could not resolve the neighbor.
+func (n *neighEntry) failed() bool {
+	return containsString(n.State, "FAILED") || containsString(n.State, "INCOMPLETE")
+}
+
+// routerLink is an interface of a router with its master and addresses, as
+// 'ip -j -d addr show' reports it.
+type routerLink struct {
+	Ifname   string `json:"ifname"`
+	Master   string `json:"master"`
+	Linkinfo struct {
+		InfoKind string `json:"info_kind"`
+	} `json:"linkinfo"`
+	AddrInfo []struct {
+		Local     string `json:"local"`
+		Prefixlen int    `json:"prefixlen"`
+	} `json:"addr_info"`
+}
+
+// routerLinks returns the interfaces of a router by name.
+func routerLinks(router string) (map[string]routerLink, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "-d", "addr", "show")
+	if err != nil {
+		return nil, err
+	}
+	var list []routerLink
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("parsing addresses of %s: %w", router, err)
+	}
+	links := make(map[string]routerLink, len(list))
+	for _, l := range list {
+		links[l.Ifname] = l
+	}
+	return links, nil
+}
+
+// linkVRF returns the VRF of an interface: its master when it is a VRF,
+// the VRF of its bridge for bridge ports, "default" otherwise.
+func linkVRF(links map[string]routerLink, dev string) string {
+	for hops := 0; hops < 3; hops++ {
+		l, ok := links[dev]
+		if !ok || l.Master == "" {
+			break
+		}
+		if links[l.Master].Linkinfo.InfoKind == "vrf" {
+			return l.Master
+		}
+		dev = l.Master
+	}
+	return "default"
+}
+
+// localEVPNPeer tells whether the peer of an EVPN path denotes a route the
+// router originated.
+func localEVPNPeer(peer string) bool {
+	return peer == "" || peer == "(unspec)" || peer == "0.0.0.0" || peer == "::"
+}
+
+func (s *MCPServer) getNeigh(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	vrf, _ := args["vrf"].(string)
+	problemsOnly, _ := args["problems_only"].(bool)
+
+	routers, err := vniRouters(glob)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	table := newTable("neighbors", "router", "vrf", "ip", "dev", "mac", "state", "flags", "evpn", "problem")
+	var findings []string
+	total, problems, failed := 0, 0, 0
+	for _, router := range routers {
+		links, err := routerLinks(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		out, err := runInRouterNetns(router, "ip", "-j", "neigh", "show")
+		var entries []neighEntry
+		if err == nil {
+			if err = json.Unmarshal(out, &entries); err != nil {
+				err = fmt.Errorf("parsing neighbors of %s: %w", router, err)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+
+		// macsOf holds the MACs the type-2 routes known to the router bind
+		// to each IP, and whether the router originated them.
+		type binding struct {
+			mac   string
+			local bool
+		}
+		macsOf := make(map[string][]binding)
+		routes, evpnErr := evpnRoutes(router, 2, 0)
+		for _, r := range routes {
+			if r.ip == "" || r.mac == "" || !r.valid {
+				continue
+			}
+			macsOf[r.ip] = append(macsOf[r.ip], binding{r.mac, localEVPNPeer(r.peer)})
+		}
+
+		var lines []string
+		seen := make(map[string]bool)
+		sort.Slice(entries, func(i, j int) bool {
+			vi, vj := linkVRF(links, entries[i].Dev), linkVRF(links, entries[j].Dev)
+			if vi != vj {
+				return vi < vj
+			}
+			return entries[i].Dst < entries[j].Dst
+		})
+		current := ""
+		for _, n := range entries {
+			nvrf := linkVRF(links, n.Dev)
+			if vrf != "" && nvrf != vrf {
+				continue
+			}
+			addr, err := netip.ParseAddr(n.Dst)
+			if err == nil {
+				seen[addr.String()] = true
+			}
+
+			// evpn tells how the type-2 routes relate to the entry.
+			evpn, problem := "", ""
+			if err == nil && !addr.IsLinkLocalUnicast() {
+				bindings := macsOf[addr.String()]
+				for _, bd := range bindings {
+					if bd.mac == n.LLAddr {
+						evpn = "remote"
+						if bd.local {
+							evpn = "local"
+						}
+						break
+					}
+				}
+				if evpn == "" && len(bindings) > 0 && n.LLAddr != "" {
+					evpn = "mac mismatch"
+				}
+			}
+			switch {
+			case n.failed():
+				problem = strings.Join(n.State, ",")
+			case evpn == "mac mismatch":
+				problem = fmt.Sprintf("type-2 route binds %s to another MAC", n.Dst)
+			case evpn == "" && containsString(n.Flags, "extern_learn") && evpnErr == nil:
+				problem = "installed from EVPN but no type-2 route left"
+			}
+			total++
+			if problem != "" {
+				problems++
+				who := n.Dst
+				if n.LLAddr != "" {
+					who += " " + n.LLAddr
+				}
+				findings = append(findings, fmt.Sprintf("%s vrf %s: %s on %s: %s", router, nvrf, who, n.Dev, problem))
+			}
+			if problemsOnly && problem == "" {
+				continue
+			}
+			table.add(router, nvrf, n.Dst, n.Dev, n.LLAddr, n.State, n.Flags, evpn, problem)
+
+			if nvrf != current || len(lines) == 0 {
+				current = nvrf
+				lines = append(lines, "  vrf "+nvrf)
+			}
+			mark := "✓"
+			if problem != "" {
+				mark = "✗"
+			}
+			line := fmt.Sprintf("    %s %-28s %-17s %-12s %s", mark, n.Dst, n.LLAddr, n.Dev, strings.Join(n.State, ","))
+			if len(n.Flags) > 0 {
+				line += " [" + strings.Join(n.Flags, ",") + "]"
+			}
+			if evpn == "local" || evpn == "remote" {
+				line += ", EVPN " + evpn
+			}
+			if problem != "" && !n.failed() {
+				line += ": " + problem
+			}
+			lines = append(lines, line)
+		}
+
+		// The remote type-2 routes with an IP within a subnet of the router
+		// should have a neighbor entry, installed by zebra.
+		ips := make([]string, 0, len(macsOf))
+		for ip := range macsOf {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		names := make([]string, 0, len(links))
+		for name := range links {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, ip := range ips {
+			bindings := macsOf[ip]
+			addr, err := netip.ParseAddr(ip)
+			if err != nil || seen[ip] {
+				continue
+			}
+			originated := false
+			for _, bd := range bindings {
+				originated = originated || bd.local
+			}
+			if originated {
+				continue
+			}
+			for _, name := range names {
+				l := links[name]
+				lvrf := linkVRF(links, l.Ifname)
+				if vrf != "" && lvrf != vrf {
+					continue
+				}
+				onLink := false
+				for _, a := range l.AddrInfo {
+					if p, err := netip.ParsePrefix(fmt.Sprintf("%s/%d", a.Local, a.Prefixlen)); err == nil && p.Masked().Contains(addr) && p.Addr() != addr {
+						onLink = true
+					}
+				}
+				if onLink {
+					problems++
+					findings = append(findings, fmt.Sprintf("%s vrf %s: no neighbor entry for %s (%s), advertised in a type-2 route, on %s", router, lvrf, ip, bindings[0].mac, l.Ifname))
+					table.add(router, lvrf, ip, l.Ifname, bindings[0].mac, []string{}, []string{}, "remote", "missing neighbor entry")
+					break
+				}
+			}
+		}
+		if evpnErr != nil {
+			lines = append(lines, "  (EVPN routes unavailable: "+evpnErr.Error()+")")
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+		}
+	}
+	sort.Strings(findings)
+
+	summary := fmt.Sprintf("%d neighbor(s) on %d router(s), %d problem(s)", total, len(routers)-failed, problems)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("total", total)
+	fields.add("problems", problems)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
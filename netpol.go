@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ipBlock struct {
+	CIDR   string   `json:"cidr"`
+	Except []string `json:"except"`
+}
+
+type networkPolicyPeer struct {
+	PodSelector       *labelSelector `json:"podSelector"`
+	NamespaceSelector *labelSelector `json:"namespaceSelector"`
+	IPBlock           *ipBlock       `json:"ipBlock"`
+}
+
+type networkPolicyPort struct {
+	Protocol string          `json:"protocol"`
+	Port     json.RawMessage `json:"port"`
+	EndPort  int             `json:"endPort"`
+}
+
+type networkPolicyRule struct {
+	From  []networkPolicyPeer `json:"from"`
+	To    []networkPolicyPeer `json:"to"`
+	Ports []networkPolicyPort `json:"ports"`
+}
+
+// networkPolicy decodes both networking.k8s.io NetworkPolicies and the
+// k8s.cni.cncf.io MultiNetworkPolicies, which share the same spec.
+type networkPolicy struct {
+	Kind     string     `json:"kind"`
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		PodSelector labelSelector       `json:"podSelector"`
+		PolicyTypes []string            `json:"policyTypes"`
+		Ingress     []networkPolicyRule `json:"ingress"`
+		Egress      []networkPolicyRule `json:"egress"`
+	} `json:"spec"`
+}
+
+type networkPolicyList struct {
+	Items []networkPolicy `json:"items"`
+}
+
+// multiNetworkPolicyForAnnotation lists the network attachments a
+// MultiNetworkPolicy applies to.
+const multiNetworkPolicyForAnnotation = "k8s.v1.cni.cncf.io/policy-for"
+
+func (np *networkPolicy) key() string {
+	return np.Metadata.Namespace + "/" + np.Metadata.Name
+}
+
+// hasType applies the API defaulting: Ingress is always implied, Egress only
+// when egress rules are present.
+func (np *networkPolicy) hasType(policyType string) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		return policyType == "Ingress" || (policyType == "Egress" && len(np.Spec.Egress) > 0)
+	}
+	return containsString(np.Spec.PolicyTypes, policyType)
+}
+
+func (np *networkPolicy) selects(p *pod) bool {
+	return p.Metadata.Namespace == np.Metadata.Namespace && np.Spec.PodSelector.matches(p.Metadata.Labels)
+}
+
+// appliesToNetwork reports whether the policy is enforced on the given
+// network: NetworkPolicies only cover the default network, MultiNetworkPolicies
+// only the attachments listed in their policy-for annotation.
+func (np *networkPolicy) appliesToNetwork(network string) bool {
+	if np.Kind != "MultiNetworkPolicy" {
+		return network == ""
+	}
+	if network == "" {
+		return false
+	}
+	for _, target := range strings.Split(np.Metadata.Annotations[multiNetworkPolicyForAnnotation], ",") {
+		target = strings.TrimSpace(target)
+		if target == network || strings.HasSuffix(network, "/"+target) || strings.HasSuffix(target, "/"+network) {
+			return true
+		}
+	}
+	return false
+}
+
+// flowEndpoint is one side of the evaluated flow. pod is nil for addresses
+// outside the cluster. network is the Multus network the address belongs to,
+// empty for the cluster default network.
+type flowEndpoint struct {
+	spec    string
+	ip      net.IP
+	pod     *pod
+	network string
+}
+
+func (e *flowEndpoint) String() string {
+	if e.pod == nil {
+		return e.spec + " (outside the cluster)"
+	}
+	if e.network != "" {
+		return fmt.Sprintf("%s (%s on network %s)", e.pod.key(), e.ip, e.network)
+	}
+	return fmt.Sprintf("%s (%s)", e.pod.key(), e.ip)
+}
+
+func resolveFlowEndpoint(spec string, pods []pod) (*flowEndpoint, error) {
+	if ns, name, ok := strings.Cut(spec, "/"); ok && net.ParseIP(spec) == nil {
+		for i := range pods {
+			p := &pods[i]
+			if p.Metadata.Namespace == ns && p.Metadata.Name == name {
+				if len(p.Status.PodIPs) == 0 {
+					return nil, fmt.Errorf("pod %s has no IP", spec)
+				}
+				return &flowEndpoint{spec: spec, ip: net.ParseIP(p.Status.PodIPs[0].IP), pod: p}, nil
+			}
+		}
+		return nil, fmt.Errorf("pod %s not found", spec)
+	}
+
+	ip := net.ParseIP(spec)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is neither a namespace/pod nor an IP address", spec)
+	}
+	for i := range pods {
+		p := &pods[i]
+		for _, podIP := range p.Status.PodIPs {
+			if net.ParseIP(podIP.IP).Equal(ip) {
+				return &flowEndpoint{spec: spec, ip: ip, pod: p}, nil
+			}
+		}
+		for _, st := range p.secondaryNetworks() {
+			for _, addr := range st.IPs {
+				if net.ParseIP(addr).Equal(ip) {
+					return &flowEndpoint{spec: spec, ip: ip, pod: p, network: st.Name}, nil
+				}
+			}
+		}
+	}
+	return &flowEndpoint{spec: spec, ip: ip}, nil
+}
+
+func (peer *networkPolicyPeer) matches(policyNamespace string, e *flowEndpoint, namespaces map[string]map[string]string) bool {
+	if peer.IPBlock != nil {
+		_, cidr, err := net.ParseCIDR(peer.IPBlock.CIDR)
+		if err != nil || !cidr.Contains(e.ip) {
+			return false
+		}
+		for _, except := range peer.IPBlock.Except {
+			if _, ex, err := net.ParseCIDR(except); err == nil && ex.Contains(e.ip) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if e.pod == nil {
+		return false
+	}
+	if peer.NamespaceSelector != nil {
+		if !peer.NamespaceSelector.matches(namespaces[e.pod.Metadata.Namespace]) {
+			return false
+		}
+	} else if e.pod.Metadata.Namespace != policyNamespace {
+		return false
+	}
+	if peer.PodSelector != nil {
+		return peer.PodSelector.matches(e.pod.Metadata.Labels)
+	}
+	return true
+}
+
+// matches checks the destination port/protocol of the flow against a policy
+// port, resolving named ports against the containers of the target pod.
+func (pp *networkPolicyPort) matches(protocol string, port int, target *pod) bool {
+	ppProtocol := pp.Protocol
+	if ppProtocol == "" {
+		ppProtocol = "TCP"
+	}
+	if !strings.EqualFold(ppProtocol, protocol) {
+		return false
+	}
+	if len(pp.Port) == 0 || string(pp.Port) == "null" {
+		return true
+	}
+
+	var number int
+	if err := json.Unmarshal(pp.Port, &number); err != nil {
+		var name string
+		if err := json.Unmarshal(pp.Port, &name); err != nil || target == nil {
+			return false
+		}
+		for _, c := range target.Spec.Containers {
+			for _, cp := range c.Ports {
+				cpProtocol := cp.Protocol
+				if cpProtocol == "" {
+					cpProtocol = "TCP"
+				}
+				if cp.Name == name && strings.EqualFold(cpProtocol, protocol) {
+					return cp.ContainerPort == port
+				}
+			}
+		}
+		return false
+	}
+	if pp.EndPort > 0 {
+		return port >= number && port <= pp.EndPort
+	}
+	return port == number
+}
+
+type directionVerdict struct {
+	isolatedBy []string
+	allowedBy  []string
+}
+
+func (v directionVerdict) allowed() bool {
+	return len(v.isolatedBy) == 0 || len(v.allowedBy) > 0
+}
+
+// evaluateDirection checks whether the policies selecting subject allow
+// traffic from/to peer in the given direction ("Ingress" or "Egress").
+func evaluateDirection(direction string, subject, peer *flowEndpoint, target *pod, network, protocol string, port int,
+	policies []networkPolicy, namespaces map[string]map[string]string) directionVerdict {
+	var v directionVerdict
+	if subject.pod == nil {
+		return v
+	}
+	for i := range policies {
+		np := &policies[i]
+		if !np.appliesToNetwork(network) || !np.selects(subject.pod) || !np.hasType(direction) {
+			continue
+		}
+		v.isolatedBy = append(v.isolatedBy, np.key())
+
+		rules := np.Spec.Ingress
+		if direction == "Egress" {
+			rules = np.Spec.Egress
+		}
+		for ri, rule := range rules {
+			peers := rule.From
+			if direction == "Egress" {
+				peers = rule.To
+			}
+			peerOK := len(peers) == 0
+			for pi := range peers {
+				if peers[pi].matches(np.Metadata.Namespace, peer, namespaces) {
+					peerOK = true
+					break
+				}
+			}
+			portOK := len(rule.Ports) == 0
+			for pi := range rule.Ports {
+				if rule.Ports[pi].matches(protocol, port, target) {
+					portOK = true
+					break
+				}
+			}
+			if peerOK && portOK {
+				v.allowedBy = append(v.allowedBy, fmt.Sprintf("%s (%s rule %d)", np.key(), strings.ToLower(direction), ri))
+			}
+		}
+	}
+	return v
+}
+
+func (s *MCPServer) auditNetworkPolicies(args map[string]any) CallToolResult {
+	cluster, _ := args["cluster"].(string)
+	source, _ := args["source"].(string)
+	destination, _ := args["destination"].(string)
+	protocol := "TCP"
+	if p, ok := args["protocol"].(string); ok && p != "" {
+		protocol = strings.ToUpper(p)
+	}
+	port := 0
+	if p, ok := args["port"].(float64); ok {
+		port = int(p)
+	}
+	if (source == "") != (destination == "") {
+		return toolError("source and destination must be provided together")
+	}
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	var pods podList
+	if err := kubectlGetJSON(cluster, &pods, "pods", "-A"); err != nil {
+		return toolError(fmt.Sprintf("Error listing pods: %v", err))
+	}
+	var nsList namespaceList
+	if err := kubectlGetJSON(cluster, &nsList, "namespaces"); err != nil {
+		return toolError(fmt.Sprintf("Error listing namespaces: %v", err))
+	}
+	namespaces := make(map[string]map[string]string)
+	for _, ns := range nsList.Items {
+		namespaces[ns.Metadata.Name] = ns.Metadata.Labels
+	}
+
+	var policies networkPolicyList
+	if err := kubectlGetJSON(cluster, &policies, "networkpolicies.networking.k8s.io", "-A"); err != nil {
+		return toolError(fmt.Sprintf("Error listing NetworkPolicies: %v", err))
+	}
+	for i := range policies.Items {
+		policies.Items[i].Kind = "NetworkPolicy"
+	}
+	var multiPolicies networkPolicyList
+	var notes []string
+	if err := kubectlGetJSON(cluster, &multiPolicies, "multi-networkpolicies.k8s.cni.cncf.io", "-A"); err != nil {
+		notes = append(notes, "MultiNetworkPolicy CRD not available, only NetworkPolicies were considered.")
+	}
+	for i := range multiPolicies.Items {
+		multiPolicies.Items[i].Kind = "MultiNetworkPolicy"
+	}
+	all := append(policies.Items, multiPolicies.Items...)
+
+	var b strings.Builder
+	var fields record
+	policyTable := newTable("policies", "kind", "policy", "types", "selects", "policy_for")
+	directions := newTable("directions", "direction", "allowed", "isolated_by", "allowed_by")
+	b.WriteString("NetworkPolicies selecting pods attached to openperouter networks:\n")
+	found := false
+	for i := range all {
+		np := &all[i]
+		var selected []string
+		for pi := range pods.Items {
+			p := &pods.Items[pi]
+			if len(p.secondaryNetworks()) > 0 && np.selects(p) {
+				selected = append(selected, p.Metadata.Name)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+		found = true
+		var types []string
+		for _, t := range []string{"Ingress", "Egress"} {
+			if np.hasType(t) {
+				types = append(types, t)
+			}
+		}
+		sort.Strings(selected)
+		fmt.Fprintf(&b, "- %s %s [%s] selects: %s", np.Kind, np.key(), strings.Join(types, ","), strings.Join(selected, ", "))
+		policyFor := ""
+		if np.Kind == "MultiNetworkPolicy" {
+			policyFor = np.Metadata.Annotations[multiNetworkPolicyForAnnotation]
+			fmt.Fprintf(&b, " (policy-for: %s)", policyFor)
+		}
+		b.WriteString("\n")
+		policyTable.add(np.Kind, np.key(), types, selected, policyFor)
+	}
+	if !found {
+		b.WriteString("  none\n")
+	}
+
+	if source != "" {
+		src, err := resolveFlowEndpoint(source, pods.Items)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		dst, err := resolveFlowEndpoint(destination, pods.Items)
+		if err != nil {
+			return toolError(err.Error())
+		}
+
+		// The flow travels on the network the destination address lives on.
+		network := dst.network
+		if dst.pod == nil {
+			network = src.network
+		}
+
+		portDesc := "any port"
+		if port > 0 {
+			portDesc = protocol + "/" + strconv.Itoa(port)
+		}
+		fmt.Fprintf(&b, "\nFlow %s -> %s, %s\n", src, dst, portDesc)
+		fields.add("source", src.String())
+		fields.add("destination", dst.String())
+		fields.add("port", portDesc)
+		fields.add("network", network)
+		if network != "" {
+			fmt.Fprintf(&b, "The flow uses the secondary network %s. NetworkPolicies are only enforced on the cluster default network, so only MultiNetworkPolicies targeting that network are evaluated.\n", network)
+		}
+
+		egress := evaluateDirection("Egress", src, dst, dst.pod, network, protocol, port, all, namespaces)
+		ingress := evaluateDirection("Ingress", dst, src, dst.pod, network, protocol, port, all, namespaces)
+
+		for _, d := range []struct {
+			name    string
+			verdict directionVerdict
+		}{{"Egress from source", egress}, {"Ingress to destination", ingress}} {
+			switch {
+			case len(d.verdict.isolatedBy) == 0:
+				fmt.Fprintf(&b, "- %s: allowed (no policy isolates this pod)\n", d.name)
+			case d.verdict.allowed():
+				fmt.Fprintf(&b, "- %s: allowed by %s\n", d.name, strings.Join(d.verdict.allowedBy, ", "))
+			default:
+				fmt.Fprintf(&b, "- %s: DENIED, pod isolated by %s and no rule matches\n", d.name, strings.Join(d.verdict.isolatedBy, ", "))
+			}
+			directions.add(d.name, d.verdict.allowed(), append([]string{}, d.verdict.isolatedBy...), append([]string{}, d.verdict.allowedBy...))
+		}
+		fields.add("allowed", egress.allowed() && ingress.allowed())
+
+		if egress.allowed() && ingress.allowed() {
+			b.WriteString("Verdict: ALLOWED by policy. If the traffic is still lost, look at the fabric routing.\n")
+		} else {
+			b.WriteString("Verdict: DENIED by policy. This drop is not a fabric routing failure.\n")
+		}
+	}
+
+	for _, n := range notes {
+		fmt.Fprintf(&b, "\nNote: %s\n", n)
+	}
+	fields.add("notes", notes)
+
+	return formattedResult(format, b.String(), false, fields, policyTable, directions)
+}
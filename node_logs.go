@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// nodeLogUnits are the systemd units whose logs explain pods stuck in
+// ContainerCreating.
+var nodeLogUnits = []string{"kubelet", "containerd"}
+
+// maxLogHighlights bounds the number of error lines returned per unit; the
+// full slices are saved to disk.
+const maxLogHighlights = 40
+
+var nodeLogErrorRe = regexp.MustCompile(`(?i)\berror\b|\bfailed\b|level=error|^\S+ \S+ \S+\[\d+\]: E\d{4}`)
+
+type kubeEvent struct {
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	EventTime      time.Time `json:"eventTime"`
+	InvolvedObject struct {
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+}
+
+func (e *kubeEvent) time() time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp
+	}
+	return e.EventTime
+}
+
+// lastSandboxFailure returns the most recent FailedCreatePodSandBox event of
+// a pod, which is where the interesting kubelet and containerd logs are.
+func lastSandboxFailure(cluster, namespace, name string) (*kubeEvent, error) {
+	var events struct {
+		Items []kubeEvent `json:"items"`
+	}
+	if err := kubectlGetJSON(cluster, &events, "events", "-n", namespace,
+		"--field-selector", "involvedObject.name="+name+",reason=FailedCreatePodSandBox"); err != nil {
+		return nil, err
+	}
+	var last *kubeEvent
+	for i := range events.Items {
+		if last == nil || events.Items[i].time().After(last.time()) {
+			last = &events.Items[i]
+		}
+	}
+	return last, nil
+}
+
+func journalTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05") + " UTC"
+}
+
+func (s *MCPServer) collectNodeRuntimeLogs(args map[string]any) CallToolResult {
+	cluster, _ := args["cluster"].(string)
+	node, _ := args["node"].(string)
+	podRef, _ := args["pod"].(string)
+	keyword, _ := args["keyword"].(string)
+
+	window := 5 * time.Minute
+	if v, ok := args["window"].(string); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid window %q: %v", v, err))
+		}
+		window = d
+	}
+
+	var b strings.Builder
+	now := time.Now()
+	center := now
+	if v, ok := args["around"].(string); ok && v != "" {
+		t, err := parseTimeArg(v, now)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		center = t
+	}
+
+	if podRef != "" {
+		namespace, name, ok := strings.Cut(podRef, "/")
+		if !ok {
+			return toolError("pod must be given as namespace/name")
+		}
+		var p pod
+		if err := kubectlGetJSON(cluster, &p, "pod", "-n", namespace, name); err != nil {
+			return toolError(fmt.Sprintf("Error getting pod %s: %v", podRef, err))
+		}
+		if node == "" {
+			node = p.Spec.NodeName
+		}
+		if keyword == "" {
+			keyword = name
+		}
+		if _, ok := args["around"]; !ok {
+			event, err := lastSandboxFailure(cluster, namespace, name)
+			if err != nil {
+				fmt.Fprintf(&b, "Warning: could not read events of %s: %v\n", podRef, err)
+			} else if event != nil {
+				center = event.time()
+				fmt.Fprintf(&b, "Last FailedCreatePodSandBox at %s: %s\n\n", center.UTC().Format(time.RFC3339), event.Message)
+			} else {
+				fmt.Fprintf(&b, "No FailedCreatePodSandBox event found for %s, using the window before now\n\n", podRef)
+			}
+		}
+	}
+
+	// Without a known failure time, look back from now rather than into the
+	// future.
+	since, until := center.Add(-window), center.Add(window)
+	if until.After(now) {
+		since, until = now.Add(-2*window), now
+	}
+
+	var nodes []string
+	if node != "" {
+		nodes = []string{node}
+	} else {
+		kn, err := kindNodes(cluster)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		for _, n := range kn {
+			nodes = append(nodes, n.Name)
+		}
+	}
+	if len(nodes) == 0 {
+		return toolError("No kind nodes found")
+	}
+
+	outputDir := "node_logs_" + now.Format("20060102_150405")
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return toolError(fmt.Sprintf("Error creating %s: %v", outputDir, err))
+	}
+
+	fmt.Fprintf(&b, "Log window: %s to %s\n", since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Output directory: %s\n", outputDir)
+
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "\n=== %s ===\n", n)
+		for _, unit := range nodeLogUnits {
+			out, err := exec.Command("docker", "exec", n, "journalctl", "-u", unit, "--no-pager", "-o", "short-iso",
+				"--since", journalTime(since), "--until", journalTime(until)).CombinedOutput()
+			if err != nil {
+				fmt.Fprintf(&b, "  ✗ %s: %v\n", unit, err)
+				continue
+			}
+
+			file := filepath.Join(outputDir, fmt.Sprintf("%s_%s.log", n, unit))
+			if err := os.WriteFile(file, out, 0o644); err != nil {
+				fmt.Fprintf(&b, "  ✗ %s: writing %s: %v\n", unit, file, err)
+				continue
+			}
+
+			lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+			var highlights []string
+			for _, line := range lines {
+				if nodeLogErrorRe.MatchString(line) && (keyword == "" || strings.Contains(line, keyword)) {
+					highlights = append(highlights, line)
+				}
+			}
+			fmt.Fprintf(&b, "  %s: %d lines saved to %s, %d matching errors\n", unit, len(lines), file, len(highlights))
+			if len(highlights) > maxLogHighlights {
+				fmt.Fprintf(&b, "    (showing the last %d)\n", maxLogHighlights)
+				highlights = highlights[len(highlights)-maxLogHighlights:]
+			}
+			for _, h := range highlights {
+				fmt.Fprintf(&b, "    %s\n", h)
+			}
+		}
+	}
+
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: b.String()}}}
+}
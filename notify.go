@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// JSONRPCNotification is a message sent to a client without a request,
+// such as the completion of a capture stopped by the server.
+type JSONRPCNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// LoggingMessageParams are the params of a notifications/message
+// notification.
+type LoggingMessageParams struct {
+	Level  string `json:"level"`
+	Logger string `json:"logger,omitempty"`
+	Data   any    `json:"data"`
+}
+
+// setNotifier registers how notifications reach an open session. Sessions
+// without one, such as the gRPC ones, don't receive notifications.
+func (s *MCPServer) setNotifier(sessionID string, notify func(data []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.sessions[sessionID]; ok {
+		info.notify = notify
+	}
+}
+
+// notify sends a notifications/message notification to a session. It is
+// dropped if the session is gone or cannot receive notifications.
+func (s *MCPServer) notify(sessionID, level string, data any) {
+	s.mu.Lock()
+	var notify func([]byte)
+	if info, ok := s.sessions[sessionID]; ok {
+		notify = info.notify
+	}
+	s.mu.Unlock()
+	if notify == nil {
+		fmt.Fprintf(os.Stderr, "Session %s cannot receive notifications, dropping one\n", sessionID)
+		return
+	}
+	s.send(notify, JSONRPCNotification{
+		JSONRPC: "2.0",
+		Method:  "notifications/message",
+		Params:  LoggingMessageParams{Level: level, Logger: serverInfo.Name, Data: data},
+	})
+}
+
+// notifyResourcesChanged tells every session able to receive notifications
+// that the resource list changed, such as when a capture copied its files
+// out.
+func (s *MCPServer) notifyResourcesChanged() {
+	s.mu.Lock()
+	var notifiers []func([]byte)
+	for _, info := range s.sessions {
+		if info.notify != nil {
+			notifiers = append(notifiers, info.notify)
+		}
+	}
+	s.mu.Unlock()
+	for _, notify := range notifiers {
+		s.send(notify, JSONRPCNotification{JSONRPC: "2.0", Method: "notifications/resources/list_changed"})
+	}
+}
+
+func (s *MCPServer) send(notify func([]byte), n JSONRPCNotification) {
+	msg, err := json.Marshal(n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling notification: %v\n", err)
+		return
+	}
+	if s.demo != nil {
+		msg = []byte(s.demo.text(string(msg)))
+	}
+	notify(msg)
+}
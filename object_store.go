@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPresignExpiry is the longest validity SigV4 allows a presigned URL.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// ObjectStoreConfig is the S3 compatible bucket (AWS S3, MinIO, ...)
+// upload_artifacts pushes capture archives and other artifacts to.
+type ObjectStoreConfig struct {
+	// Endpoint is the URL of the service, e.g.
+	// "https://s3.eu-west-1.amazonaws.com" or "http://minio:9000".
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region,omitempty"`
+	Bucket   string `json:"bucket"`
+	// Prefix is prepended to the object keys, e.g. "openperouter/".
+	Prefix string `json:"prefix,omitempty"`
+	// AccessKeyID and SecretAccessKey default to the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables.
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	// PathStyle addresses the bucket in the path rather than the host name,
+	// as MinIO expects.
+	PathStyle bool `json:"path_style,omitempty"`
+	// URLExpiry is how long the returned presigned URLs are valid.
+	URLExpiry Duration `json:"url_expiry,omitempty"`
+}
+
+// validate fills the defaults and credentials and checks the settings.
+func (c *ObjectStoreConfig) validate() error {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return fmt.Errorf("object_store: endpoint and bucket are required")
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("object_store: endpoint %q must be an http or https URL", c.Endpoint)
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.AccessKeyID == "" {
+		c.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if c.SecretAccessKey == "" {
+		c.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return fmt.Errorf("object_store: credentials missing, set access_key_id and secret_access_key or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if c.URLExpiry.Duration == 0 {
+		c.URLExpiry.Duration = 24 * time.Hour
+	}
+	if c.URLExpiry.Duration < time.Second || c.URLExpiry.Duration > maxPresignExpiry {
+		return fmt.Errorf("object_store: url_expiry must be between 1s and %s", maxPresignExpiry)
+	}
+	return nil
+}
+
+// objectURL returns the URL of an object, without query.
+func (c *ObjectStoreConfig) objectURL(key string) *url.URL {
+	u, _ := url.Parse(c.Endpoint)
+	path := strings.TrimSuffix(u.Path, "/")
+	if c.PathStyle {
+		path += "/" + c.Bucket
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+	}
+	u.Path = path + "/" + key
+	u.RawPath = escapePath(u.Path)
+	return u
+}
+
+// escapePath URI-encodes every byte of a path but the unreserved ones and
+// the slashes, as SigV4 canonical requests expect.
+func escapePath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery sorts and encodes query parameters for SigV4.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, strings.ReplaceAll(escapePath(k), "/", "%2F")+"="+strings.ReplaceAll(escapePath(query.Get(k)), "/", "%2F"))
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signature returns the SigV4 signature of a canonical request made at t.
+func (c *ObjectStoreConfig) signature(t time.Time, canonicalRequest string) string {
+	date := t.Format("20060102")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		c.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func (c *ObjectStoreConfig) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + c.Region + "/s3/aws4_request"
+}
+
+// putObject uploads a local file to the bucket.
+func (c *ObjectStoreConfig) putObject(key, path, contentType string) error {
+	size, sum, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	u := c.objectURL(key)
+	t := time.Now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	headers := "content-type:" + contentType + "\nhost:" + u.Host + "\nx-amz-content-sha256:" + sum + "\nx-amz-date:" + amzDate + "\n"
+	signed := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{http.MethodPut, u.RawPath, "", headers, signed, sum}, "\n")
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), io.LimitReader(f, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", sum)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, c.scope(t), signed, c.signature(t, canonical)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// presignGet returns a URL downloading an object without credentials until
+// it expires.
+func (c *ObjectStoreConfig) presignGet(key string, expiry time.Duration) string {
+	return c.presignGetAt(key, expiry, time.Now().UTC())
+}
+
+// presignGetAt presigns the download of an object at t.
+func (c *ObjectStoreConfig) presignGetAt(key string, expiry time.Duration, t time.Time) string {
+	u := c.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", c.AccessKeyID+"/"+c.scope(t))
+	query.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprint(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonical := strings.Join([]string{http.MethodGet, u.RawPath, canonicalQuery(query), "host:" + u.Host + "\n", "host", "UNSIGNED-PAYLOAD"}, "\n")
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + c.signature(t, canonical)
+	return u.String()
+}
+
+// artifactContentType is the content type artifacts are uploaded with.
+func artifactContentType(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"):
+		return archiveMimeType
+	case strings.HasSuffix(path, ".pcapng"):
+		return captureMimeType
+	case strings.HasSuffix(path, ".txt") || strings.HasSuffix(path, ".log"):
+		return "text/plain"
+	case strings.HasSuffix(path, ".json"):
+		return "application/json"
+	}
+	return "application/octet-stream"
+}
+
+// artifactKey returns the object key of an artifact, its path below the
+// capture directories, refusing files outside of them and, unless
+// sessionID is empty, outside the directory of the session.
+func artifactKey(prefix, sessionID, path string) (string, error) {
+	rel, err := filepath.Rel(captureRoot, filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("%q is not under %s/: %w", path, captureRoot, err)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) < 2 || parts[0] == ".." || parts[0] == "." {
+		return "", fmt.Errorf("%q is not under %s/<session>/", path, captureRoot)
+	}
+	if sessionID != "" && parts[0] != sessionID {
+		return "", fmt.Errorf("%q is not a file of this session, under %s", path, filepath.Join(captureRoot, sessionID))
+	}
+	return prefix + filepath.ToSlash(rel), nil
+}
+
+func (s *MCPServer) uploadArtifacts(sessionID string, args map[string]any) CallToolResult {
+	if s.demo != nil {
+		return toolError("upload_artifacts is disabled in demo mode: the pcaps and archives it uploads cannot be rewritten")
+	}
+	store := s.config.ObjectStore
+	if store == nil {
+		return toolError("No object store is configured: set object_store in the server config")
+	}
+	captureIDs, err := stringsArg(args, "capture_ids")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	paths, err := stringsArg(args, "paths")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(captureIDs) == 0 && len(paths) == 0 {
+		return toolError("capture_ids or paths is required")
+	}
+	expiry := store.URLExpiry.Duration
+	if v, _ := args["expires_in"].(string); v != "" {
+		if expiry, err = time.ParseDuration(v); err != nil || expiry < time.Second || expiry > maxPresignExpiry {
+			return toolError(fmt.Sprintf("invalid expires_in %q, expected a duration between 1s and %s", v, maxPresignExpiry))
+		}
+	}
+
+	scope := sessionID
+	if allSessions, ok := args["all_sessions"].(bool); ok && allSessions {
+		scope = ""
+	}
+
+	// Only files under the capture directories are uploaded, keyed by their
+	// path below it so archives of different sessions never collide.
+	var files, keys []string
+	for _, p := range paths {
+		key, err := artifactKey(store.Prefix, scope, p)
+		if err != nil {
+			return toolError("path " + err.Error())
+		}
+		if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+			return toolError(fmt.Sprintf("path %q is not a file", p))
+		}
+		files = append(files, filepath.Clean(p))
+		keys = append(keys, key)
+	}
+	var failures []string
+	for _, id := range captureIDs {
+		path, _, err := s.createCaptureArchive(scope, id, "")
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		// A capture started with its own output_dir is archived there,
+		// outside the capture directories.
+		key, err := artifactKey(store.Prefix, "", path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: archive %v, upload it from there by hand", id, err))
+			continue
+		}
+		files = append(files, path)
+		keys = append(keys, key)
+	}
+
+	var b strings.Builder
+	uploaded := 0
+	for i, path := range files {
+		key := keys[i]
+		if err := store.putObject(key, path, artifactContentType(path)); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		uploaded++
+		fmt.Fprintf(&b, "✓ %s → s3://%s/%s\n  %s\n", path, store.Bucket, key, store.presignGet(key, expiry))
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\nFailed:\n  %s\n", strings.Join(failures, "\n  "))
+	}
+	header := fmt.Sprintf("Uploaded %d of %d artifact(s) to %s, download URLs valid for %s\n\n", uploaded, len(paths)+len(captureIDs), store.Endpoint, expiry)
+	return CallToolResult{Content: []ContentItem{{Type: "text", Text: header + b.String()}}, IsError: len(failures) > 0}
+}
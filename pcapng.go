@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gopacket/pcapgo"
+)
+
+// annotateCapture rewrites a pcapng copied out of a node so that its section
+// comment and interface descriptions name the node. tshark only records the
+// interface names, which are the same on every node: once the files of a
+// capture are merged, the descriptions tell where each packet was seen.
+func annotateCapture(path, node, comment string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	stats := make(map[int]pcapgo.NgInterfaceStatistics)
+	r, err := pcapgo.NewNgReader(in, pcapgo.NgReaderOptions{
+		WantMixedLinkType:  true,
+		StatisticsCallback: func(id int, s pcapgo.NgInterfaceStatistics) { stats[id] = s },
+	})
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	annotate := func(i int) (pcapgo.NgInterface, error) {
+		intf, err := r.Interface(i)
+		if err != nil {
+			return intf, err
+		}
+		intf.Description = node
+		if intf.Name != "" {
+			intf.Description += " " + intf.Name
+		}
+		intf.Comment = comment
+		return intf, nil
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	// The reader meets the interfaces as it goes, so the writer is created
+	// with the first one at the first packet, and the others are declared
+	// before their first packet.
+	var w *pcapgo.NgWriter
+	written := 0
+	declare := func() error {
+		for ; written < r.NInterfaces(); written++ {
+			intf, err := annotate(written)
+			if err != nil {
+				return err
+			}
+			if w == nil {
+				section := r.SectionInfo()
+				section.Comment = comment
+				w, err = pcapgo.NewNgWriterInterface(out, intf, pcapgo.NgWriterOptions{SectionInfo: section})
+			} else {
+				_, err = w.AddInterface(intf)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err := declare(); err != nil {
+			return err
+		}
+		if err := w.WritePacket(ci, data); err != nil {
+			return err
+		}
+	}
+	if err := declare(); err != nil {
+		return err
+	}
+	if w == nil {
+		// Nothing was captured, there is nothing to tell apart.
+		return nil
+	}
+	for id, s := range stats {
+		if id < written {
+			if err := w.WriteInterfaceStats(id, s); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// convertToPcapng rewrites a classic pcap, as tcpdump writes, to pcapng, so
+// the files of a capture are the same whatever captured them. The file is
+// recorded as captured on iface.
+func convertToPcapng(path, iface string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := pcapgo.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+	intf := pcapgo.DefaultNgInterface
+	intf.Name, intf.LinkType, intf.SnapLength = iface, r.LinkType(), r.Snaplen()
+	w, err := pcapgo.NewNgWriterInterface(out, intf, pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		return err
+	}
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// tcpdump killed mid-packet leaves a truncated last one.
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err := w.WritePacket(ci, data); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// annotateCaptureFiles annotates the pcapng files a finished capture copied
+// to its output directory.
+func (s *MCPServer) annotateCaptureFiles(call *ActiveCall) {
+	s.mu.Lock()
+	nodes := append([]string(nil), call.Nodes...)
+	s.mu.Unlock()
+	for _, node := range nodes {
+		comment := fmt.Sprintf("Captured on %s by openperouter-mcp %s, filter %q", node, call.CaptureID, call.nodeFilter(node))
+		for _, path := range capturedFiles(call.OutputDir, call.nodeFilter(node), node) {
+			if isEncryptedCapture(path) {
+				// Left by an earlier run in the same directory.
+				continue
+			}
+			if err := annotateCapture(path, node, comment); err != nil {
+				fmt.Fprintf(os.Stderr, "Annotating %s: %v\n", path, err)
+			}
+		}
+	}
+}
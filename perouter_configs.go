@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// frrConfPath is the configuration the openperouter controller renders in
+// the FRR container of the router pods, which the reloader applies.
+const frrConfPath = "/etc/frr/frr.conf"
+
+// frrContainer is the name of the FRR container of the router pods.
+const frrContainer = "frr"
+
+// routerPods returns the pods of a kind cluster running an FRR container:
+// the openperouter router pods, one per node.
+func routerPods(cluster string) ([]pod, error) {
+	var list podList
+	if err := kubectlGetJSON(cluster, &list, "pods", "--all-namespaces"); err != nil {
+		return nil, err
+	}
+	var pods []pod
+	for _, p := range list.Items {
+		for _, c := range p.Spec.Containers {
+			if c.Name == frrContainer {
+				pods = append(pods, p)
+				break
+			}
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Spec.NodeName < pods[j].Spec.NodeName })
+	return pods, nil
+}
+
+// configLines returns the statements of an FRR configuration, without the
+// comments, separators and the lines FRR adds or drops when rendering its
+// running configuration.
+func configLines(config string) []string {
+	var lines []string
+	for _, line := range strings.Split(config, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "", strings.HasPrefix(trimmed, "!"), trimmed == "end",
+			strings.HasPrefix(trimmed, "frr version"), strings.HasPrefix(trimmed, "frr defaults"),
+			strings.HasPrefix(trimmed, "Building configuration"), strings.HasPrefix(trimmed, "Current configuration"):
+			continue
+		}
+		lines = append(lines, trimmed)
+	}
+	return lines
+}
+
+// notApplied returns the statements of the rendered configuration missing
+// from the running one: what the reloader failed, or has yet, to apply.
+func notApplied(rendered, running string) []string {
+	have := make(map[string]int)
+	for _, line := range configLines(running) {
+		have[line]++
+	}
+	var missing []string
+	for _, line := range configLines(rendered) {
+		if have[line] > 0 {
+			have[line]--
+			continue
+		}
+		missing = append(missing, line)
+	}
+	return missing
+}
+
+func (s *MCPServer) extractPERouterFRRConfigs(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	only, _ := args["cluster"].(string)
+	outputDir, _ := args["output_dir"].(string)
+	if outputDir == "" {
+		outputDir = "network_configs_" + time.Now().Format("20060102_150405")
+	}
+
+	nodes, err := kindNodes(only)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var clusters []string
+	for _, n := range nodes {
+		if !containsString(clusters, n.Cluster) {
+			clusters = append(clusters, n.Cluster)
+		}
+	}
+	if len(clusters) == 0 {
+		if only != "" {
+			return toolError(fmt.Sprintf("no kind cluster %q is running", only))
+		}
+		return toolError("no kind cluster is running")
+	}
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return toolError(fmt.Sprintf("Error creating %s: %v", outputDir, err))
+	}
+
+	var b strings.Builder
+	configs := newTable("configs", "cluster", "node", "pod", "running_config", "frr_conf", "not_applied", "error")
+	saved, failed := 0, 0
+	for _, cluster := range clusters {
+		pods, err := routerPods(cluster)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", cluster, err)
+			failed++
+			continue
+		}
+		if len(pods) == 0 {
+			fmt.Fprintf(&b, "✗ %s: no pod runs an %s container\n", cluster, frrContainer)
+			continue
+		}
+		for _, p := range pods {
+			base := filepath.Join(outputDir, fmt.Sprintf("%s_%s", cluster, p.Spec.NodeName))
+			var files [2]string
+			var texts [2]string
+			var errs []string
+			for i, cmd := range [][]string{
+				{"vtysh", "-c", "show running-config"},
+				{"cat", frrConfPath},
+			} {
+				out, err := kubectl(cluster, append([]string{"exec", "-n", p.Metadata.Namespace, p.Metadata.Name, "-c", frrContainer, "--"}, cmd...)...)
+				if err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				path := base + []string{"_running-config.txt", "_frr.conf"}[i]
+				if err := os.WriteFile(path, out, 0o644); err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				files[i], texts[i] = path, string(out)
+				saved++
+			}
+
+			var missing []string
+			line := fmt.Sprintf("%s %s (%s)", cluster, p.Spec.NodeName, p.key())
+			if files[0] != "" && files[1] != "" {
+				missing = notApplied(texts[1], texts[0])
+			}
+			switch {
+			case len(errs) > 0:
+				failed++
+				fmt.Fprintf(&b, "✗ %s: %s\n", line, strings.Join(errs, "; "))
+			case len(missing) > 0:
+				fmt.Fprintf(&b, "⚠ %s: %d line(s) of %s not in the running configuration\n", line, len(missing), frrConfPath)
+				for _, m := range missing[:min(len(missing), 10)] {
+					fmt.Fprintf(&b, "    %s\n", m)
+				}
+				if len(missing) > 10 {
+					fmt.Fprintf(&b, "    ... and %d more\n", len(missing)-10)
+				}
+			default:
+				fmt.Fprintf(&b, "✓ %s: running configuration matches %s\n", line, frrConfPath)
+			}
+			configs.add(cluster, p.Spec.NodeName, p.key(), files[0], files[1], missing, strings.Join(errs, "; "))
+		}
+	}
+
+	text := fmt.Sprintf("Extracted %d openperouter FRR configuration file(s) to %s", saved, outputDir)
+	if failed > 0 {
+		text += fmt.Sprintf(", %d failure(s)", failed)
+	}
+	text += "\n" + b.String()
+
+	var fields record
+	fields.add("output_dir", outputDir)
+	fields.add("saved", saved)
+	fields.add("failed", failed)
+	return formattedResult(format, text, saved == 0, fields, configs)
+}
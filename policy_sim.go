@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultSimulatedRoutes bounds the routes of the BGP table simulate_policy
+// evaluates, when not given.
+const defaultSimulatedRoutes = 1000
+
+// clone returns a copy of the policies a candidate change can be applied
+// to, leaving the original untouched.
+func (p *routePolicies) clone() *routePolicies {
+	c := &routePolicies{
+		routeMaps:   make(map[string]*routeMap, len(p.routeMaps)),
+		prefixLists: make(map[string]*prefixList, len(p.prefixLists)),
+		asPathLists: p.asPathLists,
+		commLists:   p.commLists,
+	}
+	for name, rm := range p.routeMaps {
+		copied := *rm
+		copied.entries = append([]*routeMapEntry(nil), rm.entries...)
+		c.routeMaps[name] = &copied
+	}
+	for key, pl := range p.prefixLists {
+		copied := *pl
+		copied.entries = append([]*prefixListEntry(nil), pl.entries...)
+		c.prefixLists[key] = &copied
+	}
+	return c
+}
+
+// setRouteMapEntry adds an entry to a route-map, replacing the entry of the
+// same sequence, and tells whether it replaced one.
+func (p *routePolicies) setRouteMapEntry(name string, entry *routeMapEntry) bool {
+	rm, ok := p.routeMaps[name]
+	if !ok {
+		rm = &routeMap{name: name}
+		p.routeMaps[name] = rm
+	}
+	for i, e := range rm.entries {
+		if e.seq == entry.seq {
+			rm.entries[i] = entry
+			return true
+		}
+	}
+	rm.entries = append(rm.entries, entry)
+	sort.SliceStable(rm.entries, func(i, j int) bool { return rm.entries[i].seq < rm.entries[j].seq })
+	return false
+}
+
+// parsePrefixListLine parses the entry of an 'ip prefix-list' or 'ipv6
+// prefix-list' configuration line, from its name on; an entry without a
+// sequence gets the next multiple of 5, as bgpd numbers them.
+func parsePrefixListLine(f []string, list *prefixList) (*prefixListEntry, error) {
+	e := &prefixListEntry{}
+	if len(f) >= 2 && f[0] == "seq" {
+		seq, err := strconv.Atoi(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence %q", f[1])
+		}
+		e.seq = seq
+		f = f[2:]
+	} else {
+		for _, existing := range list.entries {
+			e.seq = max(e.seq, existing.seq)
+		}
+		e.seq += 5
+	}
+	if len(f) < 2 || f[0] != "permit" && f[0] != "deny" {
+		return nil, fmt.Errorf("expected permit or deny and a prefix")
+	}
+	e.action, e.prefix = f[0], f[1]
+	if e.prefix != "any" {
+		p, err := netip.ParsePrefix(e.prefix)
+		if err != nil || p.Addr().Is4() != (list.afi == "ip") {
+			return nil, fmt.Errorf("invalid %s prefix %q", list.afi, e.prefix)
+		}
+	}
+	for f = f[2:]; len(f) >= 2; f = f[2:] {
+		n, err := strconv.Atoi(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", f[0], f[1])
+		}
+		switch f[0] {
+		case "ge":
+			e.ge = n
+		case "le":
+			e.le = n
+		default:
+			return nil, fmt.Errorf("unexpected %q", f[0])
+		}
+	}
+	if len(f) != 0 {
+		return nil, fmt.Errorf("unexpected %q", f[0])
+	}
+	return e, nil
+}
+
+// applyCandidate applies a candidate policy change, in the configuration
+// syntax of FRR, to the policies and returns what it changed. A route-map
+// entry given replaces the entry of the same sequence as a whole, with the
+// clauses given, rather than adding clauses to it as vtysh would.
+func (p *routePolicies) applyCandidate(config string) ([]string, error) {
+	var changes []string
+	var entry *routeMapEntry
+	for n, line := range strings.Split(config, "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "!") || f[0] == "#" {
+			continue
+		}
+		fail := func(why string) ([]string, error) {
+			return nil, fmt.Errorf("line %d %q: %s", n+1, strings.TrimSpace(line), why)
+		}
+		switch {
+		case f[0] == "exit" || f[0] == "end" || f[0] == "configure":
+			entry = nil
+		case f[0] == "route-map":
+			if len(f) != 4 || f[2] != "permit" && f[2] != "deny" {
+				return fail("expected 'route-map NAME permit|deny SEQUENCE'")
+			}
+			seq, err := strconv.Atoi(f[3])
+			if err != nil {
+				return fail("invalid sequence")
+			}
+			entry = &routeMapEntry{action: f[2], seq: seq, exit: "exit"}
+			what := "added"
+			if p.setRouteMapEntry(f[1], entry) {
+				what = "replaced"
+			}
+			changes = append(changes, fmt.Sprintf("route-map %s %s %d %s", f[1], f[2], seq, what))
+		case len(f) >= 3 && f[0] == "no" && f[1] == "route-map":
+			entry = nil
+			rm, ok := p.routeMaps[f[2]]
+			if !ok {
+				return fail("no such route-map")
+			}
+			if len(f) == 3 {
+				delete(p.routeMaps, f[2])
+				changes = append(changes, fmt.Sprintf("route-map %s removed", f[2]))
+				continue
+			}
+			if len(f) != 5 {
+				return fail("expected 'no route-map NAME [permit|deny SEQUENCE]'")
+			}
+			seq, _ := strconv.Atoi(f[4])
+			removed := false
+			for i, e := range rm.entries {
+				if e.seq == seq {
+					rm.entries = append(rm.entries[:i:i], rm.entries[i+1:]...)
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				return fail("no such entry")
+			}
+			changes = append(changes, fmt.Sprintf("route-map %s %s %d removed", f[2], f[3], seq))
+		case len(f) >= 3 && (f[0] == "ip" || f[0] == "ipv6") && f[1] == "prefix-list":
+			entry = nil
+			key := f[0] + " " + f[2]
+			list, ok := p.prefixLists[key]
+			if !ok {
+				list = &prefixList{afi: f[0], name: f[2]}
+				p.prefixLists[key] = list
+			}
+			e, err := parsePrefixListLine(f[3:], list)
+			if err != nil {
+				return fail(err.Error())
+			}
+			what := "added"
+			for i, existing := range list.entries {
+				if existing.seq == e.seq {
+					list.entries = append(list.entries[:i:i], list.entries[i+1:]...)
+					what = "replaced"
+					break
+				}
+			}
+			list.entries = append(list.entries, e)
+			sort.SliceStable(list.entries, func(i, j int) bool { return list.entries[i].seq < list.entries[j].seq })
+			changes = append(changes, fmt.Sprintf("%s prefix-list %s %s %s", f[0], f[2], e, what))
+		case len(f) >= 4 && f[0] == "no" && (f[1] == "ip" || f[1] == "ipv6") && f[2] == "prefix-list":
+			entry = nil
+			key := f[1] + " " + f[3]
+			list, ok := p.prefixLists[key]
+			if !ok {
+				return fail("no such prefix-list")
+			}
+			if len(f) == 4 {
+				delete(p.prefixLists, key)
+				changes = append(changes, fmt.Sprintf("%s prefix-list %s removed", f[1], f[3]))
+				continue
+			}
+			if len(f) < 6 || f[4] != "seq" {
+				return fail("expected 'no ip prefix-list NAME [seq SEQUENCE]'")
+			}
+			seq, _ := strconv.Atoi(f[5])
+			removed := false
+			for i, e := range list.entries {
+				if e.seq == seq {
+					list.entries = append(list.entries[:i:i], list.entries[i+1:]...)
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				return fail("no such entry")
+			}
+			changes = append(changes, fmt.Sprintf("%s prefix-list %s seq %d removed", f[1], f[3], seq))
+		case entry == nil:
+			return fail("only route-maps and prefix-lists can be simulated")
+		case f[0] == "match" && len(f) > 1:
+			entry.matches = append(entry.matches, strings.Join(f[1:], " "))
+		case f[0] == "set" && len(f) > 1:
+			entry.sets = append(entry.sets, strings.Join(f[1:], " "))
+		case f[0] == "call" && len(f) == 2:
+			entry.call = f[1]
+		case f[0] == "on-match" && len(f) == 2 && f[1] == "next", f[0] == "continue" && len(f) == 1:
+			entry.exit = "next"
+		case f[0] == "on-match" && len(f) == 3 && f[1] == "goto", f[0] == "continue" && len(f) == 2:
+			entry.exit = "goto " + f[len(f)-1]
+		case f[0] == "description":
+		default:
+			return fail("unsupported route-map clause")
+		}
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("the candidate changes no route-map or prefix-list")
+	}
+	return changes, nil
+}
+
+// policyTableRoutes returns the best paths of the unicast BGP tables of a
+// VRF of a router, optionally only those received from a neighbor, as
+// routes to evaluate. Communities are not part of the brief table.
+func policyTableRoutes(router, vrf, neighbor string) ([]routeAttrs, error) {
+	var routes []routeAttrs
+	for _, afi := range []string{"ipv4", "ipv6"} {
+		table, err := frrClient(router).UnicastRoutes(vrf, afi)
+		if err != nil {
+			return nil, err
+		}
+		for prefix, paths := range table {
+			p, err := netip.ParsePrefix(prefix)
+			if err != nil {
+				continue
+			}
+			for _, path := range paths {
+				if !path.Valid || !path.Best() || neighbor != "" && path.PeerID != neighbor {
+					continue
+				}
+				asPath := path.Path
+				routes = append(routes, routeAttrs{prefix: p.Masked(), asPath: &asPath, localPref: path.LocPrf, metric: path.Metric, protocol: "bgp"})
+				break
+			}
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i].prefix, routes[j].prefix
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+	return routes, nil
+}
+
+// policyOutcome is the result of a route-map for a route.
+type policyOutcome struct {
+	result string
+	sets   []string
+	reason string
+}
+
+func evalOutcome(p *routePolicies, name string, route routeAttrs) policyOutcome {
+	result, sets, steps := p.evalRouteMap(name, route, 0)
+	o := policyOutcome{result: result, sets: sets}
+	if len(steps) > 0 {
+		last := steps[len(steps)-1]
+		o.reason = last.reason
+		if last.seq != 0 {
+			o.reason = fmt.Sprintf("%s %s %d: %s", last.routeMap, last.action, last.seq, last.reason)
+		}
+	}
+	return o
+}
+
+func (o policyOutcome) String() string {
+	if o.result == "permit" && len(o.sets) > 0 {
+		return "permit, set " + strings.Join(o.sets, "; ")
+	}
+	return o.result
+}
+
+func (s *MCPServer) simulatePolicy(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	name, _ := args["route_map"].(string)
+	candidate, _ := args["candidate"].(string)
+	if router == "" || name == "" || strings.TrimSpace(candidate) == "" {
+		return toolError("router, route_map and candidate are required")
+	}
+	if strings.ContainsAny(name, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid route_map %q", name))
+	}
+	vrf, _ := args["vrf"].(string)
+	if vrf == "" {
+		vrf = "default"
+	}
+	if strings.ContainsAny(vrf, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid vrf %q", vrf))
+	}
+	neighbor, _ := args["neighbor"].(string)
+	limit := defaultSimulatedRoutes
+	if v, ok := args["max_routes"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	// The routes are given, or the best routes of the BGP table.
+	var routes []routeAttrs
+	fromTable := true
+	if raw, ok := args["routes"]; ok && raw != nil {
+		items, ok := raw.([]any)
+		if !ok {
+			return toolError("routes must be an array of objects")
+		}
+		for i, item := range items {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return toolError("routes must be an array of objects")
+			}
+			route, err := routeAttrsArg(obj)
+			if err != nil {
+				return toolError(fmt.Sprintf("routes[%d]: %v", i, err))
+			}
+			if !route.prefix.IsValid() {
+				return toolError(fmt.Sprintf("routes[%d]: prefix is required", i))
+			}
+			routes = append(routes, route)
+		}
+		fromTable = false
+	}
+
+	current, err := routerPolicies(router, "")
+	if err != nil {
+		return toolError(err.Error())
+	}
+	proposed := current.clone()
+	changes, err := proposed.applyCandidate(candidate)
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid candidate: %v", err))
+	}
+	if fromTable {
+		if routes, err = policyTableRoutes(router, vrf, neighbor); err != nil {
+			return toolError(err.Error())
+		}
+	}
+	truncated := len(routes) > limit
+	if truncated {
+		routes = routes[:limit]
+	}
+
+	table := newTable("changes", "prefix", "as_path", "change", "before", "after", "before_sets", "after_sets", "reason")
+	var b strings.Builder
+	container := routerContainer(router)
+	counts := make(map[string]int)
+	var lines []string
+	for _, route := range routes {
+		before := evalOutcome(current, name, route)
+		after := evalOutcome(proposed, name, route)
+		var change, mark string
+		switch {
+		case before.result == "unknown" || after.result == "unknown":
+			change, mark = "undetermined", "?"
+		case before.result != "permit" && after.result == "permit":
+			change, mark = "newly_accepted", "+"
+		case before.result == "permit" && after.result != "permit":
+			change, mark = "newly_rejected", "-"
+		case before.result == "permit" && strings.Join(before.sets, "; ") != strings.Join(after.sets, "; "):
+			change, mark = "modified", "~"
+		default:
+			counts["unchanged"]++
+			continue
+		}
+		counts[change]++
+		asPath := ""
+		if route.asPath != nil {
+			asPath = *route.asPath
+		}
+		reason := after.reason
+		if change == "undetermined" && before.result == "unknown" {
+			reason = before.reason
+		}
+		table.add(route.prefix.String(), asPath, change, before.result, after.result, before.sets, after.sets, reason)
+		line := fmt.Sprintf("  %s %-20s %s → %s", mark, route.prefix, before, after)
+		if asPath != "" {
+			line = fmt.Sprintf("  %s %-20s (AS path %s) %s → %s", mark, route.prefix, asPath, before, after)
+		}
+		if change == "undetermined" {
+			line += ": " + reason
+		}
+		lines = append(lines, line)
+	}
+
+	source := fmt.Sprintf("%d given route(s)", len(routes))
+	if fromTable {
+		source = fmt.Sprintf("the %d best route(s) of vrf %s", len(routes), vrf)
+		if neighbor != "" {
+			source += " from " + neighbor
+		}
+	}
+	fmt.Fprintf(&b, "Simulating route-map %s on %s against %s: %d newly accepted, %d newly rejected, %d modified, %d undetermined, %d unchanged\n",
+		name, container, source, counts["newly_accepted"], counts["newly_rejected"], counts["modified"], counts["undetermined"], counts["unchanged"])
+	b.WriteString("\nCandidate change (nothing is applied):\n")
+	for _, c := range changes {
+		fmt.Fprintf(&b, "  %s\n", c)
+	}
+	if len(lines) > 0 {
+		b.WriteString("\nRoutes whose outcome changes:\n" + strings.Join(lines, "\n") + "\n")
+	} else {
+		b.WriteString("\n✓ No route changes outcome\n")
+	}
+	if truncated {
+		fmt.Fprintf(&b, "\n  only the first %d route(s) evaluated, raise max_routes to evaluate more\n", limit)
+	}
+	if fromTable {
+		b.WriteString("\nThe routes an inbound route-map already denies are not in the BGP table: give them as routes to see whether the candidate accepts them. Community matches are undetermined for the routes of the table.\n")
+	}
+
+	var fields record
+	fields.add("router", container)
+	fields.add("route_map", name)
+	fields.add("routes", len(routes))
+	fields.add("candidate_changes", changes)
+	for _, c := range []string{"newly_accepted", "newly_rejected", "modified", "undetermined", "unchanged"} {
+		fields.add(c, counts[c])
+	}
+	return formattedResult(format, b.String(), false, fields, table)
+}
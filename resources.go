@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourcesListResult struct {
+	Resources []Resource `json:"resources"`
+}
+
+type ResourceTemplatesListResult struct {
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+}
+
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+const (
+	captureMimeType = "application/x-pcapng"
+
+	// clabContainerPrefix is the prefix containerlab gives to the containers
+	// of the kind topology.
+	clabContainerPrefix = "clab-kind-"
+)
+
+// errResourceNotFound maps to the MCP "resource not found" error code.
+var errResourceNotFound = errors.New("resource not found")
+
+var resourceTemplates = []ResourceTemplate{
+	{
+		URITemplate: "clab://leaf/{name}/frr-config",
+		Name:        "Leaf FRR running configuration",
+		Description: "Running configuration of a containerlab leaf (e.g., leafA), read live with vtysh.",
+		MimeType:    "text/plain",
+	},
+	{
+		URITemplate: "capture://{session}/{node}.pcapng",
+		Name:        "Node capture file",
+		Description: "Most recent pcapng captured on a node (e.g., clab-kind-spine) by the given MCP session, which must be the calling one.",
+		MimeType:    captureMimeType,
+	},
+	{
+		URITemplate: "capture://{session}/live/{capture_id}.txt",
+		Name:        "Live packet summaries",
+		Description: "Packet summaries streamed by a capture started with live set to resource or both, growing while it runs.",
+		MimeType:    "text/plain",
+	},
+	{
+		URITemplate: "capture://{session}/archive/{name}.tar.gz",
+		Name:        "Capture archive",
+		Description: "Archive of a capture directory written by archive_capture, with its pcaps, log, control-plane snapshots and manifest.",
+		MimeType:    archiveMimeType,
+	},
+}
+
+func (s *MCPServer) handleResourceTemplatesList(id any) JSONRPCResponse {
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  ResourceTemplatesListResult{ResourceTemplates: resourceTemplates},
+	}
+}
+
+// handleResourcesList lists the resources of the calling session: the
+// capture:// ones of other sessions are left out.
+func (s *MCPServer) handleResourcesList(sessionID string, id any) JSONRPCResponse {
+	resources := []Resource{}
+
+	out, err := exec.Command("docker", "ps", "--filter", "name="+clabContainerPrefix+"leaf", "--format", "{{.Names}}").Output()
+	if err == nil {
+		for _, container := range strings.Fields(string(out)) {
+			name := strings.TrimPrefix(container, clabContainerPrefix)
+			resources = append(resources, Resource{
+				URI:      fmt.Sprintf("clab://leaf/%s/frr-config", name),
+				Name:     name + " FRR running configuration",
+				MimeType: "text/plain",
+			})
+		}
+	}
+
+	for _, c := range listCaptureFiles() {
+		if c.session != sessionID || s.demo != nil {
+			continue
+		}
+		resources = append(resources, Resource{
+			URI:      fmt.Sprintf("capture://%s/%s.pcapng", c.session, c.node),
+			Name:     fmt.Sprintf("%s capture of session %s", c.node, c.session),
+			MimeType: captureMimeType,
+		})
+	}
+
+	for _, l := range listLiveSummaries() {
+		if l.session != sessionID {
+			continue
+		}
+		resources = append(resources, Resource{
+			URI:      fmt.Sprintf("capture://%s/live/%s.txt", l.session, l.captureID),
+			Name:     fmt.Sprintf("Live packet summaries of capture %s", l.captureID),
+			MimeType: "text/plain",
+		})
+	}
+
+	for _, a := range listCaptureArchives() {
+		if a.session != sessionID || s.demo != nil {
+			continue
+		}
+		resources = append(resources, Resource{
+			URI:      fmt.Sprintf("capture://%s/archive/%s", a.session, a.name),
+			Name:     fmt.Sprintf("Capture archive %s of session %s", a.name, a.session),
+			MimeType: archiveMimeType,
+		})
+	}
+
+	if s.demo != nil {
+		for i, r := range resources {
+			resources[i].URI = s.demo.text(r.URI)
+			resources[i].Name = s.demo.text(r.Name)
+		}
+	}
+
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  ResourcesListResult{Resources: resources},
+	}
+}
+
+func (s *MCPServer) handleResourceRead(sessionID string, id any, params ReadResourceParams) JSONRPCResponse {
+	uri := params.URI
+	if s.demo != nil {
+		uri = s.demo.restore(uri)
+		if strings.HasPrefix(uri, "capture://") && rawArtifact(uri) {
+			return s.errorResponse(id, -32002, fmt.Sprintf("Resource not served in demo mode, pcaps and archives cannot be rewritten: %s", uri))
+		}
+	}
+	contents, err := readResource(sessionID, uri)
+	if errors.Is(err, errResourceNotFound) {
+		return s.errorResponse(id, -32002, fmt.Sprintf("Resource not found: %s", uri))
+	}
+	if err != nil {
+		return s.errorResponse(id, -32603, err.Error())
+	}
+	if s.demo != nil {
+		// The URI keeps its demo names.
+		contents.URI = params.URI
+		contents.Text = s.demo.text(contents.Text)
+	}
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  ReadResourceResult{Contents: []ResourceContents{contents}},
+	}
+}
+
+// validSegment rejects URI path segments that could escape the directories
+// the resources are served from.
+func validSegment(segment string) bool {
+	return segment != "" && segment != "." && segment != ".." && !strings.ContainsAny(segment, `/\`)
+}
+
+// readResource reads a resource for a session, which only has access to its
+// own captures.
+func readResource(sessionID, uri string) (ResourceContents, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return ResourceContents{}, errResourceNotFound
+	}
+	parts := strings.Split(rest, "/")
+
+	switch scheme {
+	case "clab":
+		if len(parts) != 3 || parts[0] != "leaf" || parts[2] != "frr-config" || !validSegment(parts[1]) {
+			return ResourceContents{}, errResourceNotFound
+		}
+		container := parts[1]
+		if !strings.HasPrefix(container, "clab-") {
+			container = clabContainerPrefix + container
+		}
+		out, err := exec.Command("docker", "exec", container, "vtysh", "-c", "show running-config").Output()
+		if err != nil {
+			return ResourceContents{}, fmt.Errorf("reading running-config of %s: %w", container, err)
+		}
+		return ResourceContents{URI: uri, MimeType: "text/plain", Text: string(out)}, nil
+
+	case "capture":
+		// The captures of other sessions are not found rather than
+		// forbidden, not to tell which exist.
+		if parts[0] != sessionID {
+			return ResourceContents{}, errResourceNotFound
+		}
+		if len(parts) == 3 && parts[1] == "live" && strings.HasSuffix(parts[2], ".txt") {
+			session, captureID := parts[0], strings.TrimSuffix(parts[2], ".txt")
+			if !validSegment(session) || !validSegment(captureID) {
+				return ResourceContents{}, errResourceNotFound
+			}
+			for _, l := range listLiveSummaries() {
+				if l.session == session && l.captureID == captureID {
+					data, err := os.ReadFile(l.path)
+					if err != nil {
+						return ResourceContents{}, err
+					}
+					return ResourceContents{URI: uri, MimeType: "text/plain", Text: string(data)}, nil
+				}
+			}
+			return ResourceContents{}, errResourceNotFound
+		}
+		if len(parts) == 3 && parts[1] == "archive" && strings.HasSuffix(parts[2], ".tar.gz") {
+			session, name := parts[0], parts[2]
+			if !validSegment(session) || !validSegment(name) {
+				return ResourceContents{}, errResourceNotFound
+			}
+			for _, a := range listCaptureArchives() {
+				if a.session == session && a.name == name {
+					data, err := os.ReadFile(a.path)
+					if err != nil {
+						return ResourceContents{}, err
+					}
+					return ResourceContents{URI: uri, MimeType: archiveMimeType, Blob: base64.StdEncoding.EncodeToString(data)}, nil
+				}
+			}
+			return ResourceContents{}, errResourceNotFound
+		}
+		if len(parts) != 2 || !strings.HasSuffix(parts[1], ".pcapng") {
+			return ResourceContents{}, errResourceNotFound
+		}
+		session, node := parts[0], strings.TrimSuffix(parts[1], ".pcapng")
+		if !validSegment(session) || !validSegment(node) {
+			return ResourceContents{}, errResourceNotFound
+		}
+		for _, c := range listCaptureFiles() {
+			if c.session == session && c.node == node {
+				data, err := os.ReadFile(c.path)
+				if err != nil {
+					return ResourceContents{}, err
+				}
+				return ResourceContents{URI: uri, MimeType: captureMimeType, Blob: base64.StdEncoding.EncodeToString(data)}, nil
+			}
+		}
+	}
+	return ResourceContents{}, errResourceNotFound
+}
+
+type captureFile struct {
+	session string
+	node    string
+	path    string
+}
+
+// listCaptureFiles returns the pcaps stored under the per-session capture
+// directories, keeping only the most recent file for each session and node.
+func listCaptureFiles() []captureFile {
+	// Capture directories are named capture_<timestamp> and rotated files
+	// end with _<index>_<timestamp>, so sorting the matches in reverse puts
+	// the newest first.
+	matches, _ := filepath.Glob(filepath.Join("captures", "*", "capture_*", "*_capture_*.pcapng"))
+	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+
+	seen := make(map[string]bool)
+	var files []captureFile
+	for _, m := range matches {
+		session := filepath.Base(filepath.Dir(filepath.Dir(m)))
+		// A ring buffer capture is served as its most recent file.
+		base := rotatedSuffixRe.ReplaceAllString(strings.TrimSuffix(filepath.Base(m), ".pcapng"), "")
+		_, node, ok := strings.Cut(base, "_capture_")
+		if !ok {
+			continue
+		}
+		key := session + "/" + node
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		files = append(files, captureFile{session: session, node: node, path: m})
+	}
+	return files
+}
+
+type liveSummariesFile struct {
+	session   string
+	captureID string
+	path      string
+}
+
+// listLiveSummaries returns the live packet summary files stored under the
+// per-session capture directories.
+func listLiveSummaries() []liveSummariesFile {
+	matches, _ := filepath.Glob(filepath.Join("captures", "*", "capture_*", "live_*.txt"))
+	var files []liveSummariesFile
+	for _, m := range matches {
+		session := filepath.Base(filepath.Dir(filepath.Dir(m)))
+		captureID := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "live_"), ".txt")
+		files = append(files, liveSummariesFile{session: session, captureID: captureID, path: m})
+	}
+	return files
+}
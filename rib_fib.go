@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kernelRoute is a route of the kernel FIB, as 'ip -j route show table all'
+// reports it.
+type kernelRoute struct {
+	Dst      string `json:"dst"`
+	Gateway  string `json:"gateway"`
+	Dev      string `json:"dev"`
+	Protocol string `json:"protocol"`
+	Type     string `json:"type"`
+	Table    string `json:"table"`
+	Nexthops []struct {
+		Gateway string `json:"gateway"`
+		Dev     string `json:"dev"`
+	} `json:"nexthops"`
+}
+
+// fibEntry is a prefix of a VRF with its nexthops, in FRR or in the kernel.
+type fibEntry struct {
+	protocol string
+	nexthops []string
+}
+
+// nexthopKey identifies a nexthop by its gateway, or its interface when
+// directly connected: FRR does not always name the interface of the
+// nexthops it resolved.
+func nexthopKey(gateway, dev string) string {
+	switch {
+	case gateway != "":
+		return gateway
+	case dev != "":
+		return "dev " + dev
+	}
+	return "blackhole"
+}
+
+// fibPrefix returns the prefix of a route, as FRR and the kernel name it
+// differently, and whether the route is compared: link-local prefixes are
+// skipped.
+func fibPrefix(dst string, ipv6 bool) (string, bool) {
+	if dst == "default" {
+		if ipv6 {
+			return "::/0", true
+		}
+		return "0.0.0.0/0", true
+	}
+	p, err := netip.ParsePrefix(dst)
+	if err != nil {
+		a, err := netip.ParseAddr(dst)
+		if err != nil {
+			return "", false
+		}
+		p = netip.PrefixFrom(a, a.BitLen())
+	}
+	if p.Addr().IsLinkLocalUnicast() || p.Addr().IsMulticast() {
+		return "", false
+	}
+	return p.Masked().String(), true
+}
+
+// kernelFIB returns the routes of an address family of a router by VRF and
+// prefix, the main table being the default VRF.
+func kernelFIB(router string, ipv6 bool) (map[string]map[string]*fibEntry, error) {
+	out, err := runInRouterNetns(router, "ip", "-j", "vrf", "show")
+	if err != nil {
+		return nil, err
+	}
+	vrfOf := map[string]string{"": "default", "main": "default"}
+	if len(strings.TrimSpace(string(out))) > 0 {
+		var vrfs []struct {
+			Name  string `json:"name"`
+			Table int    `json:"table"`
+		}
+		if err := json.Unmarshal(out, &vrfs); err != nil {
+			return nil, fmt.Errorf("parsing VRFs of %s: %w", router, err)
+		}
+		for _, v := range vrfs {
+			vrfOf[strconv.Itoa(v.Table)] = v.Name
+		}
+	}
+
+	family := "-4"
+	if ipv6 {
+		family = "-6"
+	}
+	out, err = runInRouterNetns(router, "ip", "-j", family, "route", "show", "table", "all")
+	if err != nil {
+		return nil, err
+	}
+	var routes []kernelRoute
+	if err := json.Unmarshal(out, &routes); err != nil {
+		return nil, fmt.Errorf("parsing routes of %s: %w", router, err)
+	}
+	fib := make(map[string]map[string]*fibEntry)
+	for _, r := range routes {
+		vrf, ok := vrfOf[r.Table]
+		if !ok {
+			continue
+		}
+		switch r.Type {
+		case "local", "broadcast", "multicast", "anycast":
+			continue
+		}
+		prefix, ok := fibPrefix(r.Dst, ipv6)
+		if !ok {
+			continue
+		}
+		if fib[vrf] == nil {
+			fib[vrf] = make(map[string]*fibEntry)
+		}
+		e, ok := fib[vrf][prefix]
+		if !ok {
+			e = &fibEntry{protocol: r.Protocol}
+			fib[vrf][prefix] = e
+		}
+		var keys []string
+		switch {
+		case r.Type == "unreachable" || r.Type == "blackhole" || r.Type == "prohibit":
+			keys = append(keys, "blackhole")
+		case len(r.Nexthops) > 0:
+			for _, nh := range r.Nexthops {
+				keys = append(keys, nexthopKey(nh.Gateway, nh.Dev))
+			}
+		default:
+			keys = append(keys, nexthopKey(r.Gateway, r.Dev))
+		}
+		for _, k := range keys {
+			if !containsString(e.nexthops, k) {
+				e.nexthops = append(e.nexthops, k)
+			}
+		}
+	}
+	return fib, nil
+}
+
+// frrFIB returns the routes FRR selected, by VRF and prefix, with the
+// nexthops it installed, and the prefixes of every route of its RIB.
+func frrFIB(router string, ipv6 bool, vrf string) (selected map[string]map[string]*fibEntry, known map[string]map[string]bool, err error) {
+	family := "ip"
+	if ipv6 {
+		family = "ipv6"
+	}
+	routes, err := ribRoutes(router, family, vrf)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected = make(map[string]map[string]*fibEntry)
+	known = make(map[string]map[string]bool)
+	for _, r := range routes {
+		// Local routes are the addresses of the router, kept by the kernel
+		// in its local table, as the connected route of an IPv4 /32.
+		if r.Protocol == "local" {
+			continue
+		}
+		prefix, ok := fibPrefix(r.Prefix, ipv6)
+		if !ok || r.Protocol == "connected" && strings.HasSuffix(prefix, "/32") {
+			continue
+		}
+		if known[r.vrf] == nil {
+			known[r.vrf] = make(map[string]bool)
+			selected[r.vrf] = make(map[string]*fibEntry)
+		}
+		known[r.vrf][prefix] = true
+		if !r.Selected {
+			continue
+		}
+		e := &fibEntry{protocol: r.Protocol}
+		if !r.Installed {
+			e.protocol += " (not installed)"
+		}
+		// The nexthops in the FIB are flagged; older FRR versions only
+		// flag the active ones.
+		fibOnly := false
+		for _, nh := range r.Nexthops {
+			fibOnly = fibOnly || nh.FIB
+		}
+		for _, nh := range r.Nexthops {
+			if fibOnly && !nh.FIB || !fibOnly && !nh.Active {
+				continue
+			}
+			if k := nexthopKey(nh.IP, nh.InterfaceName); !containsString(e.nexthops, k) {
+				e.nexthops = append(e.nexthops, k)
+			}
+		}
+		selected[r.vrf][prefix] = e
+	}
+	return selected, known, nil
+}
+
+// sameNexthops tells whether two nexthop lists hold the same nexthops.
+func sameNexthops(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, nh := range a {
+		if !containsString(b, nh) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MCPServer) checkRIBFIB(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	vrf, _ := args["vrf"].(string)
+	if strings.ContainsAny(vrf, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid vrf %q", vrf))
+	}
+	families := []bool{false, true}
+	switch afi, _ := args["afi"].(string); afi {
+	case "":
+	case "ipv4":
+		families = []bool{false}
+	case "ipv6":
+		families = []bool{true}
+	default:
+		return toolError(fmt.Sprintf("invalid afi %q, expected ipv4 or ipv6", afi))
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	table := newTable("mismatches", "router", "vrf", "prefix", "problem", "frr_protocol", "kernel_protocol", "frr_nexthops", "kernel_nexthops")
+	compared, mismatches, failed := 0, 0, 0
+	for _, router := range routers {
+		var lines []string
+		routerFailed := false
+		for _, ipv6 := range families {
+			selected, known, err := frrFIB(router, ipv6, vrf)
+			if err == nil {
+				var kernel map[string]map[string]*fibEntry
+				if kernel, err = kernelFIB(router, ipv6); err == nil {
+					lines = append(lines, compareFIB(router, vrf, selected, known, kernel, table, &compared, &mismatches)...)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+				routerFailed = true
+				break
+			}
+		}
+		if routerFailed {
+			failed++
+			continue
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "  ✓ FRR and the kernel agree")
+		}
+		fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+	}
+
+	summary := fmt.Sprintf("%d prefix(es) compared on %d router(s), %d mismatch(es)", compared, len(routers)-failed, mismatches)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("compared", compared)
+	fields.add("mismatches", mismatches)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
+
+// compareFIB compares the routes FRR selected in the VRFs of a router with
+// the kernel ones, adding the mismatches to the table and returning them as
+// text lines.
+func compareFIB(router, only string, selected map[string]map[string]*fibEntry, known map[string]map[string]bool,
+	kernel map[string]map[string]*fibEntry, mismatchTable *table, compared, mismatches *int) []string {
+	var vrfs []string
+	for name := range selected {
+		vrfs = append(vrfs, name)
+	}
+	for name := range kernel {
+		if _, ok := selected[name]; !ok && (only == "" || name == only) {
+			vrfs = append(vrfs, name)
+		}
+	}
+	sort.Strings(vrfs)
+
+	var lines []string
+	for _, name := range vrfs {
+		frr, fib := selected[name], kernel[name]
+		var prefixes []string
+		for p := range frr {
+			prefixes = append(prefixes, p)
+		}
+		for p := range fib {
+			if _, ok := frr[p]; !ok {
+				prefixes = append(prefixes, p)
+			}
+		}
+		sort.Slice(prefixes, func(i, j int) bool {
+			a, _ := netip.ParsePrefix(prefixes[i])
+			b, _ := netip.ParsePrefix(prefixes[j])
+			if c := a.Addr().Compare(b.Addr()); c != 0 {
+				return c < 0
+			}
+			return a.Bits() < b.Bits()
+		})
+
+		for _, p := range prefixes {
+			*compared++
+			r, inFRR := frr[p]
+			k, inKernel := fib[p]
+			var problem, detail string
+			switch {
+			case inFRR && !inKernel:
+				problem = "missing_in_kernel"
+				detail = fmt.Sprintf("%s route via %s is not in the kernel", r.protocol, strings.Join(r.nexthops, ", "))
+			case !inFRR && inKernel && known[name][p]:
+				problem = "not_selected_in_frr"
+				detail = fmt.Sprintf("kernel %s route via %s, FRR selected no route", k.protocol, strings.Join(k.nexthops, ", "))
+			case !inFRR && inKernel:
+				problem = "missing_in_frr"
+				detail = fmt.Sprintf("kernel %s route via %s is not in the FRR RIB", k.protocol, strings.Join(k.nexthops, ", "))
+			case !sameNexthops(r.nexthops, k.nexthops):
+				problem = "nexthop_mismatch"
+				detail = fmt.Sprintf("FRR %s via %s, kernel via %s", r.protocol, strings.Join(r.nexthops, ", "), strings.Join(k.nexthops, ", "))
+			default:
+				continue
+			}
+			*mismatches++
+			var frrProtocol, kernelProtocol string
+			frrNexthops, kernelNexthops := []string{}, []string{}
+			if inFRR {
+				frrProtocol, frrNexthops = r.protocol, r.nexthops
+			}
+			if inKernel {
+				kernelProtocol, kernelNexthops = k.protocol, k.nexthops
+			}
+			mismatchTable.add(router, name, p, problem, frrProtocol, kernelProtocol, frrNexthops, kernelNexthops)
+			lines = append(lines, fmt.Sprintf("  ✗ vrf %s %s: %s", name, p, detail))
+		}
+	}
+	return lines
+}
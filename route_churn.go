@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sampling of the EVPN tables when the BMP collector does not run.
+const (
+	defaultChurnSeconds  = 60
+	maxChurnSeconds      = 600
+	defaultChurnInterval = 5
+	// defaultChurnLimit bounds the prefixes get_route_churn lists, when not
+	// given.
+	defaultChurnLimit = 20
+	// flappingRoute is how many times a route must have been withdrawn and
+	// announced again to be reported as flapping.
+	flappingRoute = 3
+)
+
+// churnEntry is the churn of a prefix, or of an EVPN route of an RD.
+type churnEntry struct {
+	family    string
+	prefix    string
+	rd        string
+	origin    string
+	vni       uint32
+	announces int
+	withdraws int
+	changes   int
+	nexthops  []string
+	routers   []string
+}
+
+func (e *churnEntry) total() int {
+	return e.announces + e.withdraws + e.changes
+}
+
+// rdRouterID returns the router ID of a route distinguisher of the form
+// IP:N, as FRR derives them, or "".
+func rdRouterID(rd string) string {
+	i := strings.LastIndex(rd, ":")
+	if i < 0 {
+		return ""
+	}
+	if _, err := netip.ParseAddr(rd[:i]); err != nil {
+		return ""
+	}
+	return rd[:i]
+}
+
+// rtVNI returns the VNI of the first route target of the form AS:VNI, as
+// FRR derives them, or 0.
+func rtVNI(rts []string) uint32 {
+	for _, rt := range rts {
+		rt = strings.TrimPrefix(rt, "RT:")
+		as, value, ok := strings.Cut(rt, ":")
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseUint(as, 10, 32); err != nil {
+			continue
+		}
+		if vni, err := strconv.ParseUint(value, 10, 32); err == nil && vni > 0 && vni < 1<<24 {
+			return uint32(vni)
+		}
+	}
+	return 0
+}
+
+// churnOrigin names where a route comes from: the router whose router ID
+// is in its RD, or the origin AS of its AS path.
+func churnOrigin(rd, asPath string, routerIDs map[string]string) string {
+	if id := rdRouterID(rd); id != "" {
+		if name, ok := routerIDs[id]; ok {
+			return name
+		}
+		return id
+	}
+	if hops := strings.Fields(asPath); len(hops) > 0 {
+		return "AS " + hops[len(hops)-1]
+	}
+	return ""
+}
+
+// bmpChurn counts the announcements and withdrawals the BMP collector
+// received since a time, by prefix.
+func (s *MCPServer) bmpChurn(since time.Time, glob string, routerIDs map[string]string) (map[string]*churnEntry, error) {
+	rows, err := s.bmp.db.Query(`SELECT router, action, family, prefix, COALESCE(next_hop, ''), COALESCE(as_path, ''), COALESCE(attributes, '')
+		FROM bmp_route_events WHERE received_at >= ?`, since.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, fmt.Errorf("reading BMP route events: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]*churnEntry)
+	for rows.Next() {
+		var router, action, family, prefix, nextHop, asPath, attrs string
+		if err := rows.Scan(&router, &action, &family, &prefix, &nextHop, &asPath, &attrs); err != nil {
+			return nil, fmt.Errorf("reading BMP route events: %w", err)
+		}
+		if ok, _ := path.Match(glob, router); !ok {
+			continue
+		}
+		// EVPN routes are stored as "RD <rd> <route>".
+		rd := ""
+		if rest, ok := strings.CutPrefix(prefix, "RD "); ok {
+			rd, prefix, _ = strings.Cut(rest, " ")
+		}
+		key := family + " " + rd + " " + prefix
+		e, ok := entries[key]
+		if !ok {
+			e = &churnEntry{family: family, prefix: prefix, rd: rd}
+			entries[key] = e
+		}
+		if action == "withdraw" {
+			e.withdraws++
+		} else {
+			e.announces++
+		}
+		if e.origin == "" || rd == "" && asPath != "" {
+			e.origin = churnOrigin(rd, asPath, routerIDs)
+		}
+		if attrs != "" && e.vni == 0 {
+			var a bgpPathAttributes
+			if json.Unmarshal([]byte(attrs), &a) == nil {
+				e.vni = rtVNI(a.ExtCommunities)
+			}
+		}
+		if nextHop != "" && !containsString(e.nexthops, nextHop) {
+			e.nexthops = append(e.nexthops, nextHop)
+		}
+		if !containsString(e.routers, router) {
+			e.routers = append(e.routers, router)
+		}
+	}
+	return entries, rows.Err()
+}
+
+// evpnSignature summarizes the paths of an EVPN route, to tell when they
+// change between two samples.
+func evpnSignature(paths []evpnRoute) string {
+	var sigs []string
+	for _, r := range paths {
+		sigs = append(sigs, fmt.Sprintf("%s %t %t %s %s %s", r.peer, r.valid, r.best, strings.Join(r.vteps, ","), r.asPath, strings.Join(r.rts, ",")))
+	}
+	sort.Strings(sigs)
+	return strings.Join(sigs, "|")
+}
+
+// pollChurn samples the EVPN tables of the routers every interval for a
+// duration, and counts the routes that appear, disappear or change between
+// two samples.
+func pollChurn(routers []string, duration, interval time.Duration, routerIDs map[string]string, b *strings.Builder) map[string]*churnEntry {
+	entries := make(map[string]*churnEntry)
+	previous := make(map[string]map[string]string)
+	failed := make(map[string]bool)
+	deadline := time.Now().Add(duration)
+	for sample := 0; ; sample++ {
+		for _, router := range routers {
+			if failed[router] {
+				continue
+			}
+			routes, err := evpnRoutes(router, 0, 0)
+			if err != nil {
+				if sample == 0 {
+					fmt.Fprintf(b, "✗ %s: %v\n", router, err)
+					failed[router] = true
+				}
+				continue
+			}
+			byKey := make(map[string][]evpnRoute)
+			for _, r := range routes {
+				key := r.rd + " " + r.prefix
+				byKey[key] = append(byKey[key], r)
+			}
+			current := make(map[string]string, len(byKey))
+			for key, paths := range byKey {
+				current[key] = evpnSignature(paths)
+			}
+			if before, ok := previous[router]; ok {
+				entry := func(key string) *churnEntry {
+					e, ok := entries[key]
+					if !ok {
+						rd, prefix, _ := strings.Cut(key, " ")
+						e = &churnEntry{family: "l2vpn-evpn", prefix: prefix, rd: rd, origin: churnOrigin(rd, "", routerIDs)}
+						entries[key] = e
+					}
+					// A withdrawn route has no path left to tell its VNI.
+					if paths := byKey[key]; len(paths) > 0 && e.vni == 0 {
+						e.vni = rtVNI(paths[0].rts)
+						if e.origin == "" {
+							e.origin = churnOrigin(e.rd, paths[0].asPath, routerIDs)
+						}
+					}
+					if !containsString(e.routers, router) {
+						e.routers = append(e.routers, router)
+					}
+					for _, r := range byKey[key] {
+						for _, vtep := range r.vteps {
+							if !containsString(e.nexthops, vtep) {
+								e.nexthops = append(e.nexthops, vtep)
+							}
+						}
+					}
+					return e
+				}
+				for key, sig := range current {
+					old, ok := before[key]
+					switch {
+					case !ok:
+						entry(key).announces++
+					case old != sig:
+						entry(key).changes++
+					}
+				}
+				for key := range before {
+					if _, ok := current[key]; !ok {
+						entry(key).withdraws++
+					}
+				}
+			}
+			previous[router] = current
+		}
+		if time.Now().Add(interval).After(deadline) {
+			break
+		}
+		time.Sleep(interval)
+	}
+	return entries
+}
+
+// updateCounters returns the UPDATE messages received from each BGP
+// neighbor of the routers, by router, VRF and neighbor, and records the
+// router IDs of the routers.
+func updateCounters(routers []string, routerIDs map[string]string) map[string]int64 {
+	counters := make(map[string]int64)
+	for _, router := range routers {
+		neighbors, err := neighborCountersOf(router)
+		if err != nil {
+			continue
+		}
+		for _, n := range neighbors {
+			counters[router+" "+n.vrf+" "+n.neighbor] = n.MessageStats["updatesRecv"]
+			if n.LocalRouterID != "" {
+				routerIDs[n.LocalRouterID] = strings.TrimPrefix(router, clabContainerPrefix)
+			}
+		}
+	}
+	return counters
+}
+
+func (s *MCPServer) getRouteChurn(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+	source, _ := args["source"].(string)
+	switch source {
+	case "":
+		source = "poll"
+		if s.bmp != nil {
+			source = "bmp"
+		}
+	case "bmp":
+		if s.bmp == nil {
+			return toolError("The BMP collector is not running: set bmp_listen in the config file or pass --bmp-listen, or use source 'poll'")
+		}
+	case "poll":
+	default:
+		return toolError(fmt.Sprintf("invalid source %q, expected bmp or poll", source))
+	}
+	limit := defaultChurnLimit
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	var b strings.Builder
+	routerIDs := make(map[string]string)
+	var entries map[string]*churnEntry
+	var window time.Duration
+	peerTable := newTable("peers", "router", "vrf", "neighbor", "updates_received", "updates_per_minute")
+	var peerLines []string
+	switch source {
+	case "bmp":
+		sinceArg, _ := args["since"].(string)
+		if sinceArg == "" {
+			sinceArg = "15m"
+		}
+		now := time.Now()
+		since, err := parseTimeArg(sinceArg, now)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		window = now.Sub(since)
+		// The router IDs name the leaves behind the RDs, when the
+		// routers answer.
+		if routers, err := fabricRouters(); err == nil {
+			updateCounters(routers, routerIDs)
+		}
+		if entries, err = s.bmpChurn(since, glob, routerIDs); err != nil {
+			return toolError(err.Error())
+		}
+		fmt.Fprintf(&b, "Route churn received by the BMP collector over the last %s\n", window.Round(time.Second))
+	default:
+		seconds := float64(defaultChurnSeconds)
+		if v, ok := args["duration_seconds"].(float64); ok {
+			if v <= 0 || v > maxChurnSeconds {
+				return toolError(fmt.Sprintf("duration_seconds must be between 1 and %d", maxChurnSeconds))
+			}
+			seconds = v
+		}
+		interval := float64(defaultChurnInterval)
+		if v, ok := args["interval_seconds"].(float64); ok && v >= 1 {
+			interval = min(v, seconds)
+		}
+		all, err := fabricRouters()
+		if err != nil {
+			return toolError(err.Error())
+		}
+		routers := matchRouters(all, glob)
+		if len(routers) == 0 {
+			return toolError(fmt.Sprintf("no router matches %q", glob))
+		}
+		window = time.Duration(seconds * float64(time.Second))
+		fmt.Fprintf(&b, "Route churn sampled every %gs for %gs on %d router(s)\n", interval, seconds, len(routers))
+		start := time.Now()
+		before := updateCounters(routers, routerIDs)
+		entries = pollChurn(routers, window, time.Duration(interval*float64(time.Second)), routerIDs, &b)
+		after := updateCounters(routers, routerIDs)
+		elapsed := time.Since(start)
+
+		keys := make([]string, 0, len(after))
+		for k := range after {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if d := (after[keys[i]] - before[keys[i]]) - (after[keys[j]] - before[keys[j]]); d != 0 {
+				return d > 0
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys {
+			old, ok := before[k]
+			// A counter going back is a session that was reset.
+			if !ok || after[k] < old || after[k] == old {
+				continue
+			}
+			f := strings.SplitN(k, " ", 3)
+			delta := after[k] - old
+			rate := float64(delta) / elapsed.Minutes()
+			peerTable.add(f[0], f[1], f[2], delta, rate)
+			if len(peerLines) < limit {
+				peerLines = append(peerLines, fmt.Sprintf("  %s vrf %s from %s: %d UPDATE(s), %.1f/min", f[0], f[1], f[2], delta, rate))
+			}
+		}
+	}
+
+	list := make([]*churnEntry, 0, len(entries))
+	total := 0
+	byOrigin := make(map[string]int)
+	byVNI := make(map[uint32]int)
+	for _, e := range entries {
+		list = append(list, e)
+		total += e.total()
+		if e.origin != "" {
+			byOrigin[e.origin] += e.total()
+		}
+		if e.vni != 0 {
+			byVNI[e.vni] += e.total()
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].total() != list[j].total() {
+			return list[i].total() > list[j].total()
+		}
+		return list[i].rd+list[i].prefix < list[j].rd+list[j].prefix
+	})
+
+	prefixTable := newTable("prefixes", "family", "rd", "prefix", "origin", "vni", "announces", "withdraws", "changes", "total", "next_hops", "routers")
+	originTable := newTable("origins", "origin", "events", "share")
+	vniTable := newTable("vnis", "vni", "events", "share")
+	var findings []string
+	fmt.Fprintf(&b, "%d event(s) on %d route(s)\n", total, len(list))
+	if len(list) > 0 {
+		b.WriteString("\nNoisiest routes:\n")
+	}
+	for i, e := range list {
+		sort.Strings(e.nexthops)
+		sort.Strings(e.routers)
+		prefixTable.add(e.family, e.rd, e.prefix, e.origin, e.vni, e.announces, e.withdraws, e.changes, e.total(), e.nexthops, e.routers)
+		name := e.prefix
+		if e.rd != "" {
+			name = "RD " + e.rd + " " + e.prefix
+		}
+		if e.withdraws >= flappingRoute && e.announces >= flappingRoute {
+			findings = append(findings, fmt.Sprintf("%s flapped: withdrawn %d time(s), announced %d time(s)", name, e.withdraws, e.announces))
+		}
+		if i >= limit {
+			continue
+		}
+		line := fmt.Sprintf("  %4d %s: %d announce(s), %d withdraw(s)", e.total(), name, e.announces, e.withdraws)
+		if e.changes > 0 {
+			line += fmt.Sprintf(", %d change(s)", e.changes)
+		}
+		if e.origin != "" {
+			line += ", from " + e.origin
+		}
+		if e.vni != 0 {
+			line += fmt.Sprintf(", VNI %d", e.vni)
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(list) > limit {
+		fmt.Fprintf(&b, "  ... only the first %d shown, raise limit to see more\n", limit)
+	}
+
+	origins := make([]string, 0, len(byOrigin))
+	for o := range byOrigin {
+		origins = append(origins, o)
+	}
+	sort.Slice(origins, func(i, j int) bool {
+		if byOrigin[origins[i]] != byOrigin[origins[j]] {
+			return byOrigin[origins[i]] > byOrigin[origins[j]]
+		}
+		return origins[i] < origins[j]
+	})
+	if len(origins) > 0 {
+		b.WriteString("\nBy origin:\n")
+	}
+	for _, o := range origins {
+		share := float64(byOrigin[o]) / float64(total)
+		originTable.add(o, byOrigin[o], share)
+		fmt.Fprintf(&b, "  %-24s %5d event(s), %3.0f%%\n", o, byOrigin[o], share*100)
+	}
+	// A single origin making most of the churn of a busy window is the
+	// one generating the noise.
+	if len(origins) > 1 && total >= 10 && byOrigin[origins[0]]*2 > total {
+		findings = append(findings, fmt.Sprintf("%s generates %d of the %d routing event(s)", origins[0], byOrigin[origins[0]], total))
+	}
+
+	vnis := make([]uint32, 0, len(byVNI))
+	for v := range byVNI {
+		vnis = append(vnis, v)
+	}
+	sort.Slice(vnis, func(i, j int) bool {
+		if byVNI[vnis[i]] != byVNI[vnis[j]] {
+			return byVNI[vnis[i]] > byVNI[vnis[j]]
+		}
+		return vnis[i] < vnis[j]
+	})
+	if len(vnis) > 0 {
+		b.WriteString("\nBy VNI (from the route targets):\n")
+	}
+	for _, v := range vnis {
+		share := float64(byVNI[v]) / float64(total)
+		vniTable.add(v, byVNI[v], share)
+		fmt.Fprintf(&b, "  VNI %-10d %5d event(s), %3.0f%%\n", v, byVNI[v], share*100)
+	}
+
+	if len(peerLines) > 0 {
+		b.WriteString("\nUPDATEs received by neighbor:\n" + strings.Join(peerLines, "\n") + "\n")
+	}
+	if len(findings) > 0 {
+		b.WriteString("\nFindings:\n")
+		for _, f := range findings {
+			b.WriteString("  ⚠ " + f + "\n")
+		}
+	} else if total == 0 {
+		b.WriteString("\n✓ No route changed during the window\n")
+	}
+
+	var fields record
+	fields.add("source", source)
+	fields.add("window_seconds", window.Seconds())
+	fields.add("events", total)
+	fields.add("routes", len(list))
+	fields.add("findings", findings)
+	return formattedResult(format, b.String(), false, fields, prefixTable, originTable, vniTable, peerTable)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+)
+
+// traceTarget is what trace_route_origin looks for: a MAC, an address or a
+// prefix.
+type traceTarget struct {
+	mac    string
+	prefix netip.Prefix
+	// exact is set when a prefix rather than an address was given, the
+	// routes then having to match it exactly.
+	exact bool
+}
+
+func (t traceTarget) String() string {
+	switch {
+	case t.mac != "":
+		return t.mac
+	case t.exact:
+		return t.prefix.String()
+	}
+	return t.prefix.Addr().String()
+}
+
+// matchesPrefix tells whether a prefix or address of a route covers the
+// target.
+func (t traceTarget) matchesPrefix(s string) bool {
+	if t.mac != "" || s == "" {
+		return false
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return false
+		}
+		p = netip.PrefixFrom(a, a.BitLen())
+	}
+	p = p.Masked()
+	if t.exact {
+		return p == t.prefix
+	}
+	return p.Contains(t.prefix.Addr())
+}
+
+// matchesEVPN tells whether an EVPN route advertises the target: a type-2
+// route its MAC or address, a type-5 route a prefix covering it.
+func (t traceTarget) matchesEVPN(r evpnRoute) bool {
+	switch r.typ {
+	case 2:
+		if t.mac != "" {
+			return strings.EqualFold(r.mac, t.mac)
+		}
+		return t.matchesPrefix(r.ip)
+	case 5:
+		return t.matchesPrefix(r.ip)
+	}
+	return false
+}
+
+// tracePath is a path of the target in a BGP table of a router.
+type tracePath struct {
+	table  string
+	rd     string
+	prefix string
+	peer   string
+	asPath string
+	vteps  []string
+	rts    []string
+	typ    int
+	best   bool
+	valid  bool
+}
+
+func (p *tracePath) local() bool {
+	return localEVPNPeer(p.peer)
+}
+
+// traceHop is what a router knows of the target.
+type traceHop struct {
+	router string
+	paths  []*tracePath
+	// vrfs tells whether the router has VRFs besides the default one,
+	// into which the type-5 routes it receives are imported.
+	vrfs bool
+	err  error
+}
+
+// originates tells whether the router originates the target.
+func (h *traceHop) originates() bool {
+	for _, p := range h.paths {
+		if p.local() {
+			return true
+		}
+	}
+	return false
+}
+
+// distance returns the length of the shortest AS path of the valid paths of
+// the router, -1 when it has none.
+func (h *traceHop) distance() int {
+	d := -1
+	for _, p := range h.paths {
+		if !p.valid {
+			continue
+		}
+		if n := len(strings.Fields(p.asPath)); d < 0 || n < d {
+			d = n
+		}
+	}
+	return d
+}
+
+// bgpUnicastPaths returns the paths of the unicast BGP tables of every VRF of
+// a router matching the target, and whether the router has VRFs besides the
+// default one.
+func bgpUnicastPaths(router string, target traceTarget) ([]*tracePath, bool, error) {
+	afi := "ipv4"
+	if target.prefix.Addr().Is6() {
+		afi = "ipv6"
+	}
+	vrfs, err := frrClient(router).AllUnicastRoutes(afi)
+	if err != nil {
+		return nil, false, err
+	}
+	var paths []*tracePath
+	hasVRFs := false
+	for vrf, routes := range vrfs {
+		hasVRFs = hasVRFs || vrf != "default"
+		for prefix, ps := range routes {
+			if !target.matchesPrefix(prefix) {
+				continue
+			}
+			for _, p := range ps {
+				tp := &tracePath{table: "vrf " + vrf, prefix: prefix, peer: p.PeerID, asPath: p.Path, best: p.Best(), valid: p.Valid}
+				for _, nh := range p.Nexthops {
+					tp.vteps = append(tp.vteps, nh.IP)
+				}
+				paths = append(paths, tp)
+			}
+		}
+	}
+	return paths, hasVRFs, nil
+}
+
+// traceHopOf collects the paths of the target known to a router, in its
+// EVPN table and, for an address or prefix, in its unicast BGP tables.
+func traceHopOf(router string, target traceTarget) *traceHop {
+	h := &traceHop{router: router}
+	routes, err := evpnRoutes(router, 0, 0)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	for _, r := range routes {
+		if !target.matchesEVPN(r) {
+			continue
+		}
+		h.paths = append(h.paths, &tracePath{table: "evpn", rd: r.rd, prefix: r.prefix, peer: r.peer, asPath: r.asPath,
+			vteps: r.vteps, rts: r.rts, typ: r.typ, best: r.best, valid: r.valid})
+	}
+	if target.mac == "" {
+		paths, vrfs, err := bgpUnicastPaths(router, target)
+		if err != nil {
+			h.err = err
+			return h
+		}
+		h.vrfs = vrfs
+		sort.Slice(paths, func(i, j int) bool {
+			if paths[i].table != paths[j].table {
+				return paths[i].table < paths[j].table
+			}
+			return paths[i].prefix < paths[j].prefix
+		})
+		h.paths = append(h.paths, paths...)
+	}
+	return h
+}
+
+func (s *MCPServer) traceRouteOrigin(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	var target traceTarget
+	prefix, _ := args["prefix"].(string)
+	mac, _ := args["mac"].(string)
+	switch {
+	case prefix != "" && mac != "":
+		return toolError("give either prefix or mac, not both")
+	case mac != "":
+		hw, err := net.ParseMAC(mac)
+		if err != nil || len(hw) != 6 {
+			return toolError(fmt.Sprintf("invalid mac %q", mac))
+		}
+		target.mac = hw.String()
+	case strings.Contains(prefix, "/"):
+		p, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid prefix %q", prefix))
+		}
+		target.prefix, target.exact = p.Masked(), true
+	case prefix != "":
+		a, err := netip.ParseAddr(prefix)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid prefix %q", prefix))
+		}
+		target.prefix = netip.PrefixFrom(a, a.BitLen())
+	default:
+		return toolError("prefix or mac is required")
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	var hops []*traceHop
+	failed := 0
+	for _, router := range routers {
+		h := traceHopOf(router, target)
+		if h.err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, h.err)
+			failed++
+			continue
+		}
+		hops = append(hops, h)
+	}
+
+	// The origins come first, then the routers by how far the target
+	// travelled to them, then the routers it never reached.
+	sort.SliceStable(hops, func(i, j int) bool {
+		x, y := hops[i], hops[j]
+		if x.originates() != y.originates() {
+			return x.originates()
+		}
+		dx, dy := x.distance(), y.distance()
+		if (dx < 0) != (dy < 0) {
+			return dx >= 0
+		}
+		if dx != dy {
+			return dx < dy
+		}
+		return x.router < y.router
+	})
+
+	routerTable := newTable("routers", "router", "state", "paths", "best_as_path")
+	pathTable := newTable("paths", "router", "table", "rd", "prefix", "peer", "as_path", "nexthops", "route_targets", "best", "valid")
+	var origins, reached, missing []string
+	var findings []string
+	for _, h := range hops {
+		state := "absent"
+		bestASPath := ""
+		hasValid, evpnType5, imported := false, false, false
+		for _, p := range h.paths {
+			hasValid = hasValid || p.valid
+			if p.best && p.valid && bestASPath == "" {
+				bestASPath = p.asPath
+			}
+			if p.table == "evpn" && p.typ == 5 && p.valid && !p.local() {
+				evpnType5 = true
+			}
+			if p.table != "evpn" && p.table != "vrf default" && p.valid {
+				imported = true
+			}
+		}
+		switch {
+		case h.originates():
+			state = "origin"
+			origins = append(origins, h.router)
+		case hasValid:
+			state = "received"
+			reached = append(reached, h.router)
+		case len(h.paths) > 0:
+			state = "invalid"
+			findings = append(findings, fmt.Sprintf("%s only has invalid paths to %s", h.router, target))
+		default:
+			missing = append(missing, h.router)
+		}
+		routerTable.add(h.router, state, len(h.paths), bestASPath)
+		// A type-5 route a router with VRFs received but imported into
+		// none of them stops there.
+		if evpnType5 && h.vrfs && !imported {
+			findings = append(findings, fmt.Sprintf("%s received the EVPN type-5 route of %s but imported it into no VRF (see check_route_targets)", h.router, target))
+		}
+
+		var lines []string
+		for _, p := range h.paths {
+			pathTable.add(h.router, p.table, p.rd, p.prefix, p.peer, p.asPath, p.vteps, p.rts, p.best, p.valid)
+			mark := "✓"
+			switch {
+			case !p.valid:
+				mark = "✗"
+			case !p.best:
+				mark = " "
+			}
+			line := fmt.Sprintf("  %s %s %s", mark, p.table, p.prefix)
+			if p.rd != "" {
+				line += " RD " + p.rd
+			}
+			if p.local() {
+				line += ": originated here"
+			} else {
+				line += " from " + p.peer
+				if p.asPath != "" {
+					line += ", AS path " + p.asPath
+				}
+			}
+			if len(p.vteps) > 0 {
+				line += ", via " + strings.Join(p.vteps, ", ")
+			}
+			if len(p.rts) > 0 {
+				line += ", RT " + strings.Join(p.rts, " ")
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "  no path")
+		}
+		fmt.Fprintf(&b, "\n=== %s (%s) ===\n%s\n", h.router, state, strings.Join(lines, "\n"))
+	}
+
+	switch {
+	case len(origins) == 0 && len(reached) == 0:
+		findings = append(findings, fmt.Sprintf("no router has a valid path to %s: it is not originated, or the routers originating it were not queried", target))
+	case len(origins) == 0:
+		findings = append(findings, fmt.Sprintf("no queried router originates %s, reached through %s", target, strings.Join(reached, ", ")))
+	case len(origins) > 1:
+		findings = append(findings, fmt.Sprintf("%s is originated by %d routers: %s", target, len(origins), strings.Join(origins, ", ")))
+	}
+	if len(missing) > 0 && len(origins)+len(reached) > 0 {
+		findings = append(findings, fmt.Sprintf("%s stopped propagating before %s", target, strings.Join(missing, ", ")))
+	}
+
+	summary := fmt.Sprintf("%s: originated by %d router(s), received by %d, absent from %d", target, len(origins), len(reached), len(missing))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	}
+
+	var fields record
+	fields.add("target", target.String())
+	fields.add("origins", origins)
+	fields.add("received_by", reached)
+	fields.add("absent_from", missing)
+	fields.add("unreachable_routers", failed)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, routerTable, pathTable)
+}
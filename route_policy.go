@@ -0,0 +1,700 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRouteMapCalls bounds the route-maps a route-map evaluation may call,
+// not to loop on route-maps calling each other.
+const maxRouteMapCalls = 8
+
+var (
+	// routeMapRe matches the header of a route-map in 'show route-map',
+	// e.g. "route-map: RM-IN Invoked: 12 Optimization: enabled ...".
+	routeMapRe = regexp.MustCompile(`^route-map:?\s+(\S+?),?\s+Invoked:\s+(\d+)`)
+	// routeMapEntryRe matches an entry of a route-map, e.g.
+	// " permit, sequence 10 Invoked 3".
+	routeMapEntryRe = regexp.MustCompile(`^\s+(permit|deny), sequence (\d+)(?: Invoked (\d+))?`)
+	// prefixListRe matches the header of a prefix-list in 'show ip
+	// prefix-list detail', e.g. "BGP: ip prefix-list PL-IN:".
+	prefixListRe = regexp.MustCompile(`^(?:(\S+): )?(ip|ipv6) prefix-list (\S+):`)
+	// prefixListEntryRe matches an entry of a prefix-list, e.g.
+	// "   seq 5 permit 10.0.0.0/8 le 24 (hit count: 3, refcount: 1)".
+	prefixListEntryRe = regexp.MustCompile(`^\s+seq (\d+) (permit|deny) (\S+)(?: ge (\d+))?(?: le (\d+))?(?: \(hit count: (\d+))?`)
+	// daemonHeaderRe matches the line naming the daemon the output that
+	// follows comes from, e.g. "BGP:".
+	daemonHeaderRe = regexp.MustCompile(`^([A-Z][A-Z0-9]*):\s*$`)
+	asPathListRe   = regexp.MustCompile(`^AS path access list (\S+)`)
+	commListRe     = regexp.MustCompile(`^Community (standard|\(expanded\)) (?:access )?list (\S+)`)
+	listEntryRe    = regexp.MustCompile(`^\s+(permit|deny) (.*)$`)
+)
+
+// routeMapEntry is an entry of a route-map, with the clauses 'show
+// route-map' prints.
+type routeMapEntry struct {
+	action  string
+	seq     int
+	invoked int64
+	matches []string
+	sets    []string
+	call    string
+	// exit is "exit", "next" or "goto N", what happens once the entry
+	// permits a route.
+	exit string
+}
+
+// routeMap is a route-map of bgpd with its entries, by sequence.
+type routeMap struct {
+	name    string
+	invoked int64
+	entries []*routeMapEntry
+}
+
+// prefixListEntry is an entry of a prefix-list.
+type prefixListEntry struct {
+	seq    int
+	action string
+	prefix string
+	ge, le int
+	hits   int64
+}
+
+// matches tells whether the entry matches a prefix: the prefix is within
+// the entry's, with a length between ge and le, the entry's length when
+// neither is given.
+func (e *prefixListEntry) matches(p netip.Prefix) bool {
+	if e.prefix == "any" {
+		return true
+	}
+	ep, err := netip.ParsePrefix(e.prefix)
+	if err != nil || ep.Addr().Is4() != p.Addr().Is4() {
+		return false
+	}
+	if p.Bits() < ep.Bits() || !ep.Contains(p.Addr()) {
+		return false
+	}
+	lo, hi := ep.Bits(), ep.Bits()
+	if e.ge != 0 {
+		lo, hi = e.ge, p.Addr().BitLen()
+	}
+	if e.le != 0 {
+		hi = e.le
+	}
+	return p.Bits() >= lo && p.Bits() <= hi
+}
+
+func (e *prefixListEntry) String() string {
+	s := fmt.Sprintf("seq %d %s %s", e.seq, e.action, e.prefix)
+	if e.ge != 0 {
+		s += fmt.Sprintf(" ge %d", e.ge)
+	}
+	if e.le != 0 {
+		s += fmt.Sprintf(" le %d", e.le)
+	}
+	return s
+}
+
+// prefixList is a prefix-list of bgpd, afi being "ip" or "ipv6".
+type prefixList struct {
+	afi     string
+	name    string
+	entries []*prefixListEntry
+}
+
+// bgpAccessList is an AS path or community list: its entries are tried in
+// order, the first matching one decides.
+type bgpAccessList struct {
+	name     string
+	expanded bool
+	entries  []bgpAccessListEntry
+}
+
+type bgpAccessListEntry struct {
+	action string
+	value  string
+}
+
+// routePolicies is the routing policy of a router, as bgpd knows it.
+type routePolicies struct {
+	routeMaps   map[string]*routeMap
+	prefixLists map[string]*prefixList
+	asPathLists map[string]*bgpAccessList
+	commLists   map[string]*bgpAccessList
+	mapNames    []string
+	listKeys    []string
+}
+
+// daemonSection tells whether a line of vtysh output is the header naming
+// the daemon the lines that follow come from, and updates it.
+func daemonSection(line string, daemon *string) bool {
+	if m := daemonHeaderRe.FindStringSubmatch(line); m != nil {
+		*daemon = m[1]
+		return true
+	}
+	return false
+}
+
+// parseRouteMaps parses the bgpd route-maps of 'show route-map'.
+func parseRouteMaps(out string) map[string]*routeMap {
+	maps := make(map[string]*routeMap)
+	daemon := ""
+	var current *routeMap
+	var entry *routeMapEntry
+	section := ""
+	for _, line := range strings.Split(out, "\n") {
+		if daemonSection(line, &daemon) {
+			current, entry = nil, nil
+			continue
+		}
+		if daemon != "" && daemon != "BGP" {
+			continue
+		}
+		if m := routeMapRe.FindStringSubmatch(line); m != nil {
+			current = &routeMap{name: m[1]}
+			current.invoked, _ = strconv.ParseInt(m[2], 10, 64)
+			maps[current.name] = current
+			entry = nil
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if m := routeMapEntryRe.FindStringSubmatch(line); m != nil {
+			entry = &routeMapEntry{action: m[1], exit: "exit"}
+			entry.seq, _ = strconv.Atoi(m[2])
+			entry.invoked, _ = strconv.ParseInt(m[3], 10, 64)
+			current.entries = append(current.entries, entry)
+			section = ""
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch trimmed {
+		case "":
+			continue
+		case "Match clauses:", "Set clauses:", "Call clause:", "Action:":
+			section = trimmed
+			continue
+		case "Description:":
+			section = ""
+			continue
+		}
+		switch section {
+		case "Match clauses:":
+			entry.matches = append(entry.matches, trimmed)
+		case "Set clauses:":
+			entry.sets = append(entry.sets, trimmed)
+		case "Call clause:":
+			entry.call = strings.TrimPrefix(trimmed, "Call ")
+		case "Action:":
+			switch {
+			case strings.HasPrefix(trimmed, "Goto "):
+				entry.exit = "goto " + strings.TrimPrefix(trimmed, "Goto ")
+			case strings.HasPrefix(trimmed, "Continue"):
+				entry.exit = "next"
+			}
+		}
+	}
+	for _, m := range maps {
+		sort.SliceStable(m.entries, func(i, j int) bool { return m.entries[i].seq < m.entries[j].seq })
+	}
+	return maps
+}
+
+// parsePrefixLists parses the bgpd prefix-lists of 'show ip prefix-list
+// detail' or 'show ipv6 prefix-list detail', keyed by afi and name.
+func parsePrefixLists(out string, lists map[string]*prefixList) {
+	daemon := ""
+	var current *prefixList
+	for _, line := range strings.Split(out, "\n") {
+		if daemonSection(line, &daemon) {
+			current = nil
+			continue
+		}
+		if m := prefixListRe.FindStringSubmatch(line); m != nil {
+			if m[1] != "" {
+				daemon = m[1]
+			}
+			current = nil
+			if daemon == "" || daemon == "BGP" {
+				current = &prefixList{afi: m[2], name: m[3]}
+				lists[m[2]+" "+m[3]] = current
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if m := prefixListEntryRe.FindStringSubmatch(line); m != nil {
+			e := &prefixListEntry{action: m[2], prefix: m[3]}
+			e.seq, _ = strconv.Atoi(m[1])
+			e.ge, _ = strconv.Atoi(m[4])
+			e.le, _ = strconv.Atoi(m[5])
+			e.hits, _ = strconv.ParseInt(m[6], 10, 64)
+			current.entries = append(current.entries, e)
+		}
+	}
+}
+
+// parseBGPAccessLists parses 'show bgp as-path-access-list' or 'show bgp
+// community-list'.
+func parseBGPAccessLists(out string, header *regexp.Regexp) map[string]*bgpAccessList {
+	lists := make(map[string]*bgpAccessList)
+	var current *bgpAccessList
+	for _, line := range strings.Split(out, "\n") {
+		if m := header.FindStringSubmatch(line); m != nil {
+			name, expanded := m[1], false
+			if len(m) > 2 {
+				name, expanded = m[2], m[1] != "standard"
+			}
+			current = &bgpAccessList{name: name, expanded: expanded}
+			lists[name] = current
+			continue
+		}
+		if m := listEntryRe.FindStringSubmatch(line); m != nil && current != nil {
+			current.entries = append(current.entries, bgpAccessListEntry{action: m[1], value: strings.TrimSpace(m[2])})
+		}
+	}
+	return lists
+}
+
+// routerPolicies returns the route-maps, or only the named one, and the
+// lists of a router.
+func routerPolicies(router, name string) (*routePolicies, error) {
+	command := "show route-map"
+	if name != "" {
+		command += " " + name
+	}
+	out, err := runVtysh(router, command)
+	if err != nil {
+		return nil, err
+	}
+	p := &routePolicies{routeMaps: parseRouteMaps(string(out)), prefixLists: make(map[string]*prefixList)}
+	for _, afi := range []string{"ip", "ipv6"} {
+		out, err := runVtysh(router, fmt.Sprintf("show %s prefix-list detail", afi))
+		if err != nil {
+			return nil, err
+		}
+		parsePrefixLists(string(out), p.prefixLists)
+	}
+	// The AS path and community lists are only needed to evaluate routes,
+	// and missing when bgpd does not run.
+	if out, err := runVtysh(router, "show bgp as-path-access-list"); err == nil {
+		p.asPathLists = parseBGPAccessLists(string(out), asPathListRe)
+	}
+	if out, err := runVtysh(router, "show bgp community-list"); err == nil {
+		p.commLists = parseBGPAccessLists(string(out), commListRe)
+	}
+	for n := range p.routeMaps {
+		p.mapNames = append(p.mapNames, n)
+	}
+	sort.Strings(p.mapNames)
+	for k := range p.prefixLists {
+		p.listKeys = append(p.listKeys, k)
+	}
+	sort.Strings(p.listKeys)
+	return p, nil
+}
+
+// routeAttrs is the route a route-map is evaluated against; the attributes
+// not given are unknown, and the clauses matching them cannot be evaluated.
+type routeAttrs struct {
+	prefix      netip.Prefix
+	asPath      *string
+	communities []string
+	hasComms    bool
+	localPref   *int64
+	metric      *int64
+	tag         *int64
+	protocol    string
+}
+
+// routeAttrsArg returns the route described by the prefix, as_path,
+// communities, local_preference, metric, tag and source_protocol arguments.
+func routeAttrsArg(args map[string]any) (routeAttrs, error) {
+	var route routeAttrs
+	if v, _ := args["prefix"].(string); v != "" {
+		p, err := parseEndpoint(v)
+		if err != nil {
+			return route, fmt.Errorf("invalid prefix %q", v)
+		}
+		route.prefix = p.Masked()
+	}
+	if v, ok := args["as_path"].(string); ok {
+		route.asPath = &v
+	}
+	if _, ok := args["communities"]; ok {
+		var err error
+		if route.communities, err = stringsArg(args, "communities"); err != nil {
+			return route, err
+		}
+		route.hasComms = true
+	}
+	for arg, attr := range map[string]**int64{"local_preference": &route.localPref, "metric": &route.metric, "tag": &route.tag} {
+		if v, ok := args[arg].(float64); ok {
+			n := int64(v)
+			*attr = &n
+		}
+	}
+	route.protocol, _ = args["source_protocol"].(string)
+	return route, nil
+}
+
+// asPathRegexp translates an AS path regular expression of FRR, where "_"
+// matches a delimiter, to Go.
+func asPathRegexp(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(strings.ReplaceAll(expr, "_", `(?:^|[,{}() ]|$)`))
+}
+
+// actionVerb returns the verb of a permit or deny action.
+func actionVerb(action string) string {
+	if action == "deny" {
+		return "denies"
+	}
+	return "permits"
+}
+
+// evalPrefixList returns whether a prefix-list permits a prefix, and why.
+func (p *routePolicies) evalPrefixList(afi, name string, prefix netip.Prefix) (bool, string) {
+	if (afi == "ip") != prefix.Addr().Is4() {
+		return false, fmt.Sprintf("%s prefix-list %s does not apply to %s", afi, name, prefix)
+	}
+	list, ok := p.prefixLists[afi+" "+name]
+	if !ok {
+		return false, fmt.Sprintf("%s prefix-list %s does not exist", afi, name)
+	}
+	for _, e := range list.entries {
+		if e.matches(prefix) {
+			return e.action == "permit", fmt.Sprintf("prefix-list %s %s %s (%s)", name, actionVerb(e.action), prefix, e)
+		}
+	}
+	return false, fmt.Sprintf("no entry of prefix-list %s matches %s (implicit deny)", name, prefix)
+}
+
+// evalAccessList returns whether an AS path or community list permits a
+// route, and why.
+func evalAccessList(kind string, list *bgpAccessList, match func(bgpAccessListEntry) (bool, error)) (bool, string, error) {
+	for _, e := range list.entries {
+		ok, err := match(e)
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			return e.action == "permit", fmt.Sprintf("%s %s %s (%s %s)", kind, list.name, actionVerb(e.action), e.action, e.value), nil
+		}
+	}
+	return false, fmt.Sprintf("no entry of %s %s matches (implicit deny)", kind, list.name), nil
+}
+
+// evalMatch evaluates a match clause of a route-map against a route. known
+// is false when the clause is not supported or needs an attribute not
+// given.
+func (p *routePolicies) evalMatch(clause string, route routeAttrs) (matched bool, reason string, known bool) {
+	f := strings.Fields(clause)
+	unknown := func(why string) (bool, string, bool) {
+		return false, fmt.Sprintf("'%s' cannot be evaluated: %s", clause, why), false
+	}
+	number := func(attr *int64, name string) (bool, string, bool) {
+		if attr == nil {
+			return unknown(name + " not given")
+		}
+		want, err := strconv.ParseInt(f[len(f)-1], 10, 64)
+		if err != nil {
+			return unknown("not a number")
+		}
+		return *attr == want, fmt.Sprintf("%s %d, %s %d", name, *attr, clause, want), true
+	}
+	switch {
+	case len(f) == 4 && (f[0] == "ip" || f[0] == "ipv6") && f[1] == "address" && f[2] == "prefix-list":
+		ok, why := p.evalPrefixList(f[0], f[3], route.prefix)
+		return ok, why, true
+	case len(f) == 4 && (f[0] == "ip" || f[0] == "ipv6") && f[1] == "address" && f[2] == "prefix-len":
+		n, err := strconv.Atoi(f[3])
+		if err != nil {
+			return unknown("not a number")
+		}
+		return route.prefix.Bits() == n, fmt.Sprintf("%s is a /%d", route.prefix, route.prefix.Bits()), true
+	case len(f) == 2 && f[0] == "as-path":
+		if route.asPath == nil {
+			return unknown("as_path not given")
+		}
+		list, ok := p.asPathLists[f[1]]
+		if !ok {
+			return false, fmt.Sprintf("as-path access list %s does not exist", f[1]), true
+		}
+		ok, why, err := evalAccessList("as-path list", list, func(e bgpAccessListEntry) (bool, error) {
+			re, err := asPathRegexp(e.value)
+			if err != nil {
+				return false, fmt.Errorf("regular expression %q of as-path list %s: %w", e.value, list.name, err)
+			}
+			return re.MatchString(*route.asPath), nil
+		})
+		if err != nil {
+			return unknown(err.Error())
+		}
+		return ok, why, true
+	case len(f) >= 2 && f[0] == "community":
+		if !route.hasComms {
+			return unknown("communities not given")
+		}
+		list, ok := p.commLists[f[1]]
+		if !ok {
+			return false, fmt.Sprintf("community list %s does not exist", f[1]), true
+		}
+		exact := len(f) > 2 && f[2] == "exact-match"
+		ok, why, err := evalAccessList("community list", list, func(e bgpAccessListEntry) (bool, error) {
+			if list.expanded {
+				re, err := regexp.Compile(e.value)
+				if err != nil {
+					return false, fmt.Errorf("regular expression %q of community list %s: %w", e.value, list.name, err)
+				}
+				return re.MatchString(strings.Join(route.communities, " ")), nil
+			}
+			want := strings.Fields(e.value)
+			if len(want) == 1 && want[0] == "internet" {
+				return true, nil
+			}
+			for _, c := range want {
+				if !containsString(route.communities, c) {
+					return false, nil
+				}
+			}
+			return !exact || len(want) == len(route.communities), nil
+		})
+		if err != nil {
+			return unknown(err.Error())
+		}
+		return ok, why, true
+	case len(f) == 2 && f[0] == "local-preference":
+		return number(route.localPref, "local_preference")
+	case len(f) == 2 && f[0] == "metric":
+		return number(route.metric, "metric")
+	case len(f) == 2 && f[0] == "tag":
+		return number(route.tag, "tag")
+	case len(f) == 2 && f[0] == "source-protocol":
+		if route.protocol == "" {
+			return unknown("source_protocol not given")
+		}
+		return route.protocol == f[1], fmt.Sprintf("the route comes from %s", route.protocol), true
+	}
+	return unknown("clause not supported")
+}
+
+// policyStep is an entry of a route-map tried while evaluating a route.
+type policyStep struct {
+	routeMap string
+	seq      int
+	action   string
+	result   string
+	reason   string
+}
+
+// evalRouteMap evaluates a route-map against a route as bgpd does: the
+// entries are tried by sequence, a route matching every match clause of an
+// entry is denied by a deny entry, or permitted by a permit one, with its
+// set clauses applied, and a route no entry matches is denied. It returns
+// "permit", "deny" or "unknown" when a clause cannot be evaluated, the set
+// clauses applied and the entries tried.
+func (p *routePolicies) evalRouteMap(name string, route routeAttrs, depth int) (string, []string, []policyStep) {
+	rm, ok := p.routeMaps[name]
+	if !ok {
+		return "deny", nil, []policyStep{{routeMap: name, result: "deny", reason: "the route-map does not exist: bgpd denies every route"}}
+	}
+	var steps []policyStep
+	var sets []string
+	permitted := false
+	for i := 0; i < len(rm.entries); i++ {
+		e := rm.entries[i]
+		step := policyStep{routeMap: name, seq: e.seq, action: e.action}
+		matched := true
+		var reasons []string
+		for _, clause := range e.matches {
+			ok, why, known := p.evalMatch(clause, route)
+			if !known {
+				step.result, step.reason = "unknown", why
+				return "unknown", sets, append(steps, step)
+			}
+			reasons = append(reasons, why)
+			if !ok {
+				matched = false
+				break
+			}
+		}
+		if len(e.matches) == 0 {
+			reasons = append(reasons, "no match clause, every route matches")
+		}
+		step.reason = strings.Join(reasons, "; ")
+		if !matched {
+			step.result = "no match"
+			steps = append(steps, step)
+			continue
+		}
+		if e.action == "deny" {
+			step.result = "deny"
+			return "deny", sets, append(steps, step)
+		}
+		step.result = "permit"
+		steps = append(steps, step)
+		permitted = true
+		sets = append(sets, e.sets...)
+		if e.call != "" {
+			if depth >= maxRouteMapCalls {
+				return "unknown", sets, append(steps, policyStep{routeMap: e.call, result: "unknown", reason: "too many nested route-map calls"})
+			}
+			result, called, callSteps := p.evalRouteMap(e.call, route, depth+1)
+			steps = append(steps, callSteps...)
+			sets = append(sets, called...)
+			if result != "permit" {
+				return result, sets, steps
+			}
+		}
+		switch {
+		case e.exit == "next":
+			continue
+		case strings.HasPrefix(e.exit, "goto "):
+			target, _ := strconv.Atoi(strings.TrimPrefix(e.exit, "goto "))
+			j := i + 1
+			for j < len(rm.entries) && rm.entries[j].seq < target {
+				j++
+			}
+			i = j - 1
+			continue
+		}
+		return "permit", sets, steps
+	}
+	if permitted {
+		return "permit", sets, steps
+	}
+	steps = append(steps, policyStep{routeMap: name, result: "deny", reason: "no entry matches (implicit deny)"})
+	return "deny", sets, steps
+}
+
+func (s *MCPServer) getRoutePolicies(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	if router == "" {
+		return toolError("router is required")
+	}
+	name, _ := args["route_map"].(string)
+	if strings.ContainsAny(name, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid route_map %q", name))
+	}
+
+	// A prefix asks for the route-map to be evaluated against the route.
+	var route routeAttrs
+	evaluate := false
+	if v, _ := args["prefix"].(string); v != "" {
+		if name == "" {
+			return toolError("route_map is required to evaluate a prefix")
+		}
+		evaluate = true
+	}
+	if route, err = routeAttrsArg(args); err != nil {
+		return toolError(err.Error())
+	}
+
+	policies, err := routerPolicies(router, name)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if name != "" && policies.routeMaps[name] == nil && !evaluate {
+		return toolError(fmt.Sprintf("no route-map %s in bgpd on %s", name, routerContainer(router)))
+	}
+
+	var b strings.Builder
+	container := routerContainer(router)
+	mapTable := newTable("route_maps", "route_map", "invoked", "sequence", "action", "entry_invoked", "match", "set", "call", "on_match")
+	listTable := newTable("prefix_lists", "afi", "prefix_list", "sequence", "action", "prefix", "ge", "le", "hit_count")
+
+	// Only the prefix-lists a route-map matches on are shown with it.
+	used := make(map[string]bool)
+	fmt.Fprintf(&b, "%d route-map(s) in bgpd on %s\n", len(policies.mapNames), container)
+	for _, n := range policies.mapNames {
+		rm := policies.routeMaps[n]
+		fmt.Fprintf(&b, "\nroute-map %s, invoked %d time(s)\n", n, rm.invoked)
+		for _, e := range rm.entries {
+			mapTable.add(n, rm.invoked, e.seq, e.action, e.invoked, e.matches, e.sets, e.call, e.exit)
+			fmt.Fprintf(&b, "  %s %d, invoked %d time(s)\n", e.action, e.seq, e.invoked)
+			for _, m := range e.matches {
+				fmt.Fprintf(&b, "    match %s\n", m)
+				if f := strings.Fields(m); len(f) == 4 && f[2] == "prefix-list" {
+					used[f[0]+" "+f[3]] = true
+				}
+			}
+			for _, set := range e.sets {
+				fmt.Fprintf(&b, "    set %s\n", set)
+			}
+			if e.call != "" {
+				fmt.Fprintf(&b, "    call %s\n", e.call)
+			}
+			if e.exit != "exit" {
+				fmt.Fprintf(&b, "    on-match %s\n", e.exit)
+			}
+		}
+		if len(rm.entries) == 0 {
+			b.WriteString("  no entry: every route is denied\n")
+		}
+	}
+
+	shown := 0
+	for _, key := range policies.listKeys {
+		if name != "" && !used[key] {
+			continue
+		}
+		pl := policies.prefixLists[key]
+		if shown == 0 {
+			b.WriteString("\nPrefix-lists:\n")
+		}
+		shown++
+		fmt.Fprintf(&b, "  %s prefix-list %s\n", pl.afi, pl.name)
+		for _, e := range pl.entries {
+			listTable.add(pl.afi, pl.name, e.seq, e.action, e.prefix, e.ge, e.le, e.hits)
+			fmt.Fprintf(&b, "    %-36s hit count %d\n", e.String(), e.hits)
+		}
+	}
+
+	var fields record
+	fields.add("router", container)
+	fields.add("route_maps", len(policies.mapNames))
+	fields.add("prefix_lists", shown)
+	tables := []*table{mapTable, listTable}
+	if evaluate {
+		result, sets, steps := policies.evalRouteMap(name, route, 0)
+		stepTable := newTable("evaluation", "route_map", "sequence", "action", "result", "reason")
+		fmt.Fprintf(&b, "\nEvaluating %s against route-map %s:\n", route.prefix, name)
+		for _, st := range steps {
+			stepTable.add(st.routeMap, st.seq, st.action, st.result, st.reason)
+			where := st.routeMap
+			if st.seq != 0 {
+				where += fmt.Sprintf(" %s %d", st.action, st.seq)
+			}
+			fmt.Fprintf(&b, "  %s: %s, %s\n", where, st.result, st.reason)
+		}
+		switch result {
+		case "permit":
+			if len(sets) == 0 {
+				b.WriteString("\n✓ Permitted, unmodified: the entries matching it set nothing\n")
+			} else {
+				fmt.Fprintf(&b, "\n✓ Permitted, with: %s\n", strings.Join(sets, "; "))
+			}
+		case "deny":
+			b.WriteString("\n✗ Denied\n")
+		default:
+			b.WriteString("\n? Undetermined: give the missing attributes, or check the clause by hand\n")
+		}
+		fields.add("result", result)
+		fields.add("sets", sets)
+		tables = append(tables, stepTable)
+	}
+	return formattedResult(format, b.String(), false, fields, tables...)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestPrefixListEntryMatches(t *testing.T) {
+	tests := []struct {
+		entry  prefixListEntry
+		prefix string
+		want   bool
+	}{
+		{prefixListEntry{prefix: "10.0.0.0/8"}, "10.0.0.0/8", true},
+		{prefixListEntry{prefix: "10.0.0.0/8"}, "10.1.0.0/16", false},
+		{prefixListEntry{prefix: "10.0.0.0/8", le: 24}, "10.1.0.0/16", true},
+		{prefixListEntry{prefix: "10.0.0.0/8", le: 24}, "10.0.0.0/8", true},
+		{prefixListEntry{prefix: "10.0.0.0/8", le: 24}, "10.1.1.0/25", false},
+		{prefixListEntry{prefix: "10.0.0.0/8", le: 24}, "11.0.0.0/16", false},
+		{prefixListEntry{prefix: "10.0.0.0/8", ge: 16}, "10.0.0.0/8", false},
+		{prefixListEntry{prefix: "10.0.0.0/8", ge: 16}, "10.1.1.1/32", true},
+		{prefixListEntry{prefix: "10.0.0.0/8", ge: 16, le: 24}, "10.1.1.0/24", true},
+		{prefixListEntry{prefix: "10.0.0.0/8", ge: 16, le: 24}, "10.1.1.0/25", false},
+		{prefixListEntry{prefix: "10.1.0.0/16"}, "10.0.0.0/8", false},
+		{prefixListEntry{prefix: "any"}, "2001:db8::/32", true},
+		{prefixListEntry{prefix: "2001:db8::/32", ge: 48, le: 64}, "2001:db8:1::/48", true},
+		{prefixListEntry{prefix: "2001:db8::/32", ge: 48, le: 64}, "2001:db8:1::/96", false},
+		{prefixListEntry{prefix: "2001:db8::/32", ge: 48}, "2001:db8:1::1/128", true},
+		{prefixListEntry{prefix: "10.0.0.0/8", le: 32}, "::/0", false},
+		{prefixListEntry{prefix: "::/0", le: 128}, "10.0.0.0/8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry.String()+" "+tt.prefix, func(t *testing.T) {
+			if got := tt.entry.matches(netip.MustParsePrefix(tt.prefix)); got != tt.want {
+				t.Errorf("matches(%s) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+// testRouteMaps is the output of 'show route-map' on a router where zebra
+// has a route-map bgpd does not.
+const testRouteMaps = `ZEBRA:
+route-map: RM-ZEBRA Invoked: 0 Optimization: enabled Processed Change: false
+ permit, sequence 10 Invoked 0
+  Match clauses:
+  Set clauses:
+  Call clause:
+  Action:
+    Exit routemap
+BGP:
+route-map: RM-IN Invoked: 12 Optimization: enabled Processed Change: false
+ permit, sequence 10 Invoked 3
+  Match clauses:
+    ip address prefix-list PL-TENANT
+    community CL-TENANT
+  Set clauses:
+    local-preference 200
+  Call clause:
+  Action:
+    Continue to next entry
+ deny, sequence 5 Invoked 0
+  Match clauses:
+    ip address prefix-list PL-BOGONS
+  Set clauses:
+  Call clause:
+  Action:
+    Exit routemap
+ permit, sequence 20 Invoked 0
+  Match clauses:
+    as-path AS-CUST
+  Set clauses:
+    metric 50
+  Call clause:
+    Call RM-TAG
+  Action:
+    Exit routemap
+route-map: RM-TAG Invoked: 0 Optimization: enabled Processed Change: false
+ permit, sequence 10 Invoked 0
+  Match clauses:
+  Set clauses:
+    tag 7
+  Call clause:
+  Action:
+    Exit routemap
+route-map: RM-GOTO Invoked: 0 Optimization: enabled Processed Change: false
+ permit, sequence 10 Invoked 0
+  Match clauses:
+  Set clauses:
+    metric 1
+  Call clause:
+  Action:
+    Goto 30
+ deny, sequence 20 Invoked 0
+  Match clauses:
+  Set clauses:
+  Call clause:
+  Action:
+    Exit routemap
+ permit, sequence 30 Invoked 0
+  Match clauses:
+    ip address prefix-len 24
+  Set clauses:
+    metric 3
+  Call clause:
+  Action:
+    Exit routemap
+route-map: RM-EXP Invoked: 0 Optimization: enabled Processed Change: false
+ permit, sequence 10 Invoked 0
+  Match clauses:
+    community CL-EXP
+    local-preference 100
+  Set clauses:
+  Call clause:
+  Action:
+    Exit routemap
+`
+
+const testPrefixLists = `BGP: ip prefix-list PL-TENANT:
+ count: 2, range entries: 1, sequences: 5 - 10
+   seq 5 permit 10.10.0.0/16 le 24 (hit count: 3, refcount: 1)
+   seq 10 deny any (hit count: 0, refcount: 1)
+BGP: ip prefix-list PL-BOGONS:
+ count: 1, range entries: 1, sequences: 5 - 5
+   seq 5 permit 192.168.0.0/16 ge 16 (hit count: 0, refcount: 1)
+`
+
+const testASPathLists = `AS path access list AS-CUST
+    permit _65010$
+`
+
+const testCommunityLists = `Community standard list CL-TENANT
+    permit 64512:100
+Community (expanded) access list CL-EXP
+    permit ^64512:1[0-9]+$
+`
+
+func testRoutePolicies() *routePolicies {
+	p := &routePolicies{routeMaps: parseRouteMaps(testRouteMaps), prefixLists: make(map[string]*prefixList)}
+	parsePrefixLists(testPrefixLists, p.prefixLists)
+	p.asPathLists = parseBGPAccessLists(testASPathLists, asPathListRe)
+	p.commLists = parseBGPAccessLists(testCommunityLists, commListRe)
+	return p
+}
+
+func TestParseRouteMaps(t *testing.T) {
+	maps := parseRouteMaps(testRouteMaps)
+	if _, ok := maps["RM-ZEBRA"]; ok {
+		t.Error("the route-map of zebra was parsed as one of bgpd")
+	}
+	rm := maps["RM-IN"]
+	if rm == nil {
+		t.Fatal("RM-IN not parsed")
+	}
+	if rm.invoked != 12 {
+		t.Errorf("RM-IN invoked %d times, want 12", rm.invoked)
+	}
+	var seqs []int
+	for _, e := range rm.entries {
+		seqs = append(seqs, e.seq)
+	}
+	if !reflect.DeepEqual(seqs, []int{5, 10, 20}) {
+		t.Errorf("RM-IN sequences = %v, want them sorted", seqs)
+	}
+	e := rm.entries[1]
+	want := routeMapEntry{action: "permit", seq: 10, invoked: 3, matches: []string{"ip address prefix-list PL-TENANT", "community CL-TENANT"}, sets: []string{"local-preference 200"}, exit: "next"}
+	if !reflect.DeepEqual(*e, want) {
+		t.Errorf("RM-IN seq 10 = %+v, want %+v", *e, want)
+	}
+	if call, exit := rm.entries[2].call, maps["RM-GOTO"].entries[0].exit; call != "RM-TAG" || exit != "goto 30" {
+		t.Errorf("call = %q, exit = %q, want RM-TAG and goto 30", call, exit)
+	}
+}
+
+func TestEvalRouteMap(t *testing.T) {
+	asPath := func(s string) *string { return &s }
+	localPref := func(n int64) *int64 { return &n }
+	tests := []struct {
+		name     string
+		routeMap string
+		route    routeAttrs
+		want     string
+		wantSets []string
+	}{
+		{
+			name:     "denied bogon",
+			routeMap: "RM-IN",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("192.168.1.0/24")},
+			want:     "deny",
+		},
+		{
+			name:     "continue then call",
+			routeMap: "RM-IN",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.10.1.0/24"), communities: []string{"64512:100"}, hasComms: true, asPath: asPath("65001 65010")},
+			want:     "permit",
+			wantSets: []string{"local-preference 200", "metric 50", "tag 7"},
+		},
+		{
+			name:     "permitted entry followed by no match",
+			routeMap: "RM-IN",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.10.1.0/24"), communities: []string{"64512:100"}, hasComms: true, asPath: asPath("65010 65001")},
+			want:     "permit",
+			wantSets: []string{"local-preference 200"},
+		},
+		{
+			name:     "implicit deny",
+			routeMap: "RM-IN",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.20.0.0/16"), communities: []string{}, hasComms: true, asPath: asPath("65020")},
+			want:     "deny",
+		},
+		{
+			name:     "attribute not given",
+			routeMap: "RM-IN",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.10.1.0/24")},
+			want:     "unknown",
+		},
+		{
+			name:     "goto skips entries",
+			routeMap: "RM-GOTO",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.0.0.0/24")},
+			want:     "permit",
+			wantSets: []string{"metric 1", "metric 3"},
+		},
+		{
+			name:     "goto target not matching",
+			routeMap: "RM-GOTO",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.0.0.0/16")},
+			want:     "permit",
+			wantSets: []string{"metric 1"},
+		},
+		{
+			name:     "expanded community list",
+			routeMap: "RM-EXP",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.0.0.0/24"), communities: []string{"64512:150"}, hasComms: true, localPref: localPref(100)},
+			want:     "permit",
+		},
+		{
+			name:     "expanded community list not matching",
+			routeMap: "RM-EXP",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.0.0.0/24"), communities: []string{"64513:150"}, hasComms: true, localPref: localPref(100)},
+			want:     "deny",
+		},
+		{
+			name:     "number not matching",
+			routeMap: "RM-EXP",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.0.0.0/24"), communities: []string{"64512:150"}, hasComms: true, localPref: localPref(200)},
+			want:     "deny",
+		},
+		{
+			name:     "route-map of another daemon",
+			routeMap: "RM-ZEBRA",
+			route:    routeAttrs{prefix: netip.MustParsePrefix("10.0.0.0/24")},
+			want:     "deny",
+		},
+	}
+	p := testRoutePolicies()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, sets, steps := p.evalRouteMap(tt.routeMap, tt.route, 0)
+			if got != tt.want {
+				t.Errorf("evalRouteMap(%s) = %s, want %s; steps: %+v", tt.routeMap, got, tt.want, steps)
+			}
+			if !reflect.DeepEqual(sets, tt.wantSets) {
+				t.Errorf("evalRouteMap(%s) sets = %q, want %q", tt.routeMap, sets, tt.wantSets)
+			}
+		})
+	}
+}
+
+func TestEvalPrefixList(t *testing.T) {
+	tests := []struct {
+		afi, name, prefix string
+		want              bool
+	}{
+		{"ip", "PL-TENANT", "10.10.0.0/16", true},
+		{"ip", "PL-TENANT", "10.10.1.128/25", false},
+		{"ip", "PL-TENANT", "10.20.0.0/16", false},
+		{"ip", "PL-BOGONS", "192.168.0.0/16", true},
+		{"ip", "PL-MISSING", "10.0.0.0/8", false},
+		{"ipv6", "PL-TENANT", "2001:db8::/32", false},
+	}
+	p := testRoutePolicies()
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.prefix, func(t *testing.T) {
+			if got, why := p.evalPrefixList(tt.afi, tt.name, netip.MustParsePrefix(tt.prefix)); got != tt.want {
+				t.Errorf("evalPrefixList(%s) = %v (%s), want %v", tt.prefix, got, why, tt.want)
+			}
+		})
+	}
+}
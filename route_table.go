@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// defaultRouteLimit bounds the routes returned by get_route_table, when not
+// given.
+const defaultRouteLimit = 500
+
+// vrfRoute is a route of the RIB of a VRF.
+type vrfRoute struct {
+	vrf string
+	ribRoute
+}
+
+// ribRoutes returns the routes of an address family ("ip" or "ipv6") of a
+// VRF of a router, or of all its VRFs when vrf is empty.
+func ribRoutes(router, family, vrf string) ([]vrfRoute, error) {
+	vrfs, err := frrClient(router).Routes(family, vrf)
+	if err != nil {
+		return nil, err
+	}
+	var routes []vrfRoute
+	for name, rs := range vrfs {
+		for _, r := range rs {
+			routes = append(routes, vrfRoute{vrf: name, ribRoute: r})
+		}
+	}
+	return routes, nil
+}
+
+func (s *MCPServer) getRouteTable(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	if router == "" {
+		return toolError("router is required")
+	}
+	vrf, _ := args["vrf"].(string)
+	if strings.ContainsAny(vrf, " \t\n;") {
+		return toolError(fmt.Sprintf("invalid vrf %q", vrf))
+	}
+	families := []string{"ip", "ipv6"}
+	switch afi, _ := args["afi"].(string); afi {
+	case "":
+	case "ipv4":
+		families = []string{"ip"}
+	case "ipv6":
+		families = []string{"ipv6"}
+	default:
+		return toolError(fmt.Sprintf("invalid afi %q, expected ipv4 or ipv6", afi))
+	}
+	var prefix netip.Prefix
+	if v, _ := args["prefix"].(string); v != "" {
+		if prefix, err = parseEndpoint(v); err != nil {
+			return toolError(fmt.Sprintf("invalid prefix %q: expected an address or a prefix", v))
+		}
+		if prefix.Addr().Is4() {
+			families = []string{"ip"}
+		} else {
+			families = []string{"ipv6"}
+		}
+	}
+	protocol, _ := args["protocol"].(string)
+	selectedOnly, _ := args["selected_only"].(bool)
+	limit := defaultRouteLimit
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	var routes []vrfRoute
+	for _, family := range families {
+		rs, err := ribRoutes(router, family, vrf)
+		if err != nil {
+			return toolError(err.Error())
+		}
+		routes = append(routes, rs...)
+	}
+
+	// A prefix selects the routes within it and the ones covering it, so
+	// both '10.1.1.0/24' and the address of a host find the route used.
+	matches := func(r vrfRoute) bool {
+		switch {
+		case protocol != "" && r.Protocol != protocol,
+			selectedOnly && !r.Selected:
+			return false
+		case !prefix.IsValid():
+			return true
+		}
+		p, err := netip.ParsePrefix(r.Prefix)
+		if err != nil {
+			return false
+		}
+		return prefix.Contains(p.Addr()) && p.Bits() >= prefix.Bits() || p.Contains(prefix.Addr()) && prefix.Bits() >= p.Bits()
+	}
+	var kept []vrfRoute
+	for _, r := range routes {
+		if matches(r) {
+			kept = append(kept, r)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		a, b := kept[i], kept[j]
+		if a.vrf != b.vrf {
+			return a.vrf < b.vrf
+		}
+		pa, errA := netip.ParsePrefix(a.Prefix)
+		pb, errB := netip.ParsePrefix(b.Prefix)
+		if errA == nil && errB == nil && pa != pb {
+			if c := pa.Addr().Compare(pb.Addr()); c != 0 {
+				return c < 0
+			}
+			return pa.Bits() < pb.Bits()
+		}
+		return a.Selected && !b.Selected
+	})
+	shown := min(len(kept), limit)
+
+	var b strings.Builder
+	where := "all VRFs"
+	if vrf != "" {
+		where = "vrf " + vrf
+	}
+	fmt.Fprintf(&b, "%d route(s) in %s of %s", len(kept), where, routerContainer(router))
+	if shown < len(kept) {
+		fmt.Fprintf(&b, ", showing the first %d", shown)
+	}
+	b.WriteString("\n")
+
+	table := newTable("routes", "vrf", "prefix", "protocol", "selected", "installed", "distance", "metric", "nexthops", "uptime")
+	current := ""
+	for i, r := range kept[:shown] {
+		var nexthops []string
+		for _, nh := range r.Nexthops {
+			nexthops = append(nexthops, nh.String())
+		}
+		table.add(r.vrf, r.Prefix, r.Protocol, r.Selected, r.Installed, r.Distance, r.Metric, nexthops, r.Uptime)
+
+		if i == 0 || r.vrf != current {
+			current = r.vrf
+			fmt.Fprintf(&b, "\n=== vrf %s ===\n", r.vrf)
+		}
+		mark := " "
+		switch {
+		case r.Selected && r.Installed:
+			mark = "*"
+		case r.Selected:
+			mark = ">"
+		}
+		line := fmt.Sprintf("  %s %-20s %-10s [%d/%d] via %s", mark, r.Prefix, r.Protocol, r.Distance, r.Metric, strings.Join(nexthops, ", "))
+		if r.Uptime != "" {
+			line += ", " + r.Uptime
+		}
+		b.WriteString(line + "\n")
+	}
+	if shown > 0 {
+		b.WriteString("\n* selected and installed, > selected, not installed\n")
+	}
+
+	var fields record
+	fields.add("router", routerContainer(router))
+	fields.add("vrf", vrf)
+	fields.add("total", len(kept))
+	fields.add("shown", shown)
+	return formattedResult(format, b.String(), false, fields, table)
+}
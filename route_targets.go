@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+)
+
+// evpnVNIConfig is a VNI of bgpd with its route targets, as the frr package
+// decodes it.
+type evpnVNIConfig = frr.VNIConfig
+
+// evpnVNIConfigs returns the VNIs of bgpd on a router, by VNI.
+func evpnVNIConfigs(router string) ([]*evpnVNIConfig, error) {
+	return frrClient(router).VNIConfigs()
+}
+
+// rtMatches tells whether an import route target matches the route target
+// of a route, "*:100" matching any AS.
+func rtMatches(imported, rt string) bool {
+	if imported == rt {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(imported, "*:")
+	return ok && strings.HasSuffix(rt, ":"+suffix) && strings.Count(rt, ":") == 1
+}
+
+// importsRT tells whether a list of import route targets matches a route
+// target.
+func importsRT(imports []string, rt string) bool {
+	for _, imported := range imports {
+		if rtMatches(imported, rt) {
+			return true
+		}
+	}
+	return false
+}
+
+// rtExporter is a VNI of a router exporting a route target.
+type rtExporter struct {
+	router string
+	vni    uint32
+	typ    string
+}
+
+func (e rtExporter) String() string {
+	return fmt.Sprintf("%s %s VNI %d", e.router, e.typ, e.vni)
+}
+
+// autoRTHint explains a route target mismatch caused by route targets
+// derived from the AS: FRR derives them as AS:VNI, which differ between
+// leaves of an eBGP fabric.
+func autoRTHint(vni uint32, rts []string) string {
+	for _, rt := range rts {
+		if strings.HasSuffix(rt, fmt.Sprintf(":%d", vni)) {
+			return fmt.Sprintf(" (the route targets look derived from the AS: import *:%d, or set 'autort rfc8365-compatible')", vni)
+		}
+	}
+	return ""
+}
+
+func (s *MCPServer) checkRouteTargets(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+
+	routers, err := vniRouters(glob)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	configs := make(map[string][]*evpnVNIConfig)
+	routes := make(map[string][]evpnRoute)
+	exporters := make(map[string][]rtExporter)
+	var queried []string
+	failed := 0
+	for _, router := range routers {
+		vnis, err := evpnVNIConfigs(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		configs[router] = vnis
+		queried = append(queried, router)
+		for _, v := range vnis {
+			for _, rt := range v.ExportRTs {
+				exporters[rt] = append(exporters[rt], rtExporter{router, v.VNI, v.Type})
+			}
+		}
+		if rs, err := evpnRoutes(router, 0, 0); err == nil {
+			routes[router] = rs
+		} else {
+			fmt.Fprintf(&b, "  (EVPN routes of %s unavailable: %v)\n", router, err)
+		}
+	}
+
+	vniTable := newTable("vnis", "router", "vni", "type", "vrf", "rd", "import_rts", "export_rts", "remote_routes_imported")
+	unimportedTable := newTable("unimported", "router", "route_targets", "route_type", "routes", "vteps", "exported_by")
+	var findings []string
+	for _, router := range queried {
+		vnis := configs[router]
+
+		// Received routes are imported into the VNIs and VRFs with an
+		// import route target matching one of theirs.
+		imported := make(map[uint32]int)
+		type group struct {
+			rts   string
+			typ   int
+			count int
+			vteps []string
+		}
+		groups := make(map[string]*group)
+		for _, r := range routes[router] {
+			if localEVPNPeer(r.peer) || !r.valid || len(r.rts) == 0 {
+				continue
+			}
+			matched := false
+			for _, v := range vnis {
+				for _, rt := range r.rts {
+					if importsRT(v.ImportRTs, rt) {
+						imported[v.VNI]++
+						matched = true
+						break
+					}
+				}
+			}
+			if matched {
+				continue
+			}
+			key := fmt.Sprintf("%d %s", r.typ, strings.Join(r.rts, " "))
+			g, ok := groups[key]
+			if !ok {
+				g = &group{rts: strings.Join(r.rts, " "), typ: r.typ}
+				groups[key] = g
+			}
+			g.count++
+			for _, vtep := range r.vteps {
+				if !containsString(g.vteps, vtep) {
+					g.vteps = append(g.vteps, vtep)
+				}
+			}
+		}
+
+		var lines []string
+		for _, v := range vnis {
+			vrf := v.TenantVRF
+			vniTable.add(router, v.VNI, v.Type, vrf, v.RD, v.ImportRTs, v.ExportRTs, imported[v.VNI])
+			line := fmt.Sprintf("  %s VNI %d", v.Type, v.VNI)
+			if vrf != "" {
+				line += " vrf " + vrf
+			}
+			line += fmt.Sprintf(": import %s, export %s, %d remote route(s) imported", strings.Join(v.ImportRTs, " "), strings.Join(v.ExportRTs, " "), imported[v.VNI])
+			lines = append(lines, line)
+
+			// The same VNI on the other routers exports route targets this
+			// one must import, or their routes are dropped.
+			for _, other := range queried {
+				if other == router {
+					continue
+				}
+				for _, ov := range configs[other] {
+					if ov.VNI != v.VNI || ov.Type != v.Type {
+						continue
+					}
+					var missing []string
+					for _, rt := range ov.ExportRTs {
+						if !importsRT(v.ImportRTs, rt) {
+							missing = append(missing, rt)
+						}
+					}
+					if len(missing) > 0 && len(ov.ExportRTs) == len(missing) {
+						findings = append(findings, fmt.Sprintf("%s %s VNI %d imports %s but %s exports %s: the routes of %s for the VNI are not imported%s",
+							router, v.Type, v.VNI, strings.Join(v.ImportRTs, " "), other, strings.Join(ov.ExportRTs, " "), other, autoRTHint(v.VNI, append(missing, v.ImportRTs...))))
+					}
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(groups))
+		for k := range groups {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			g := groups[k]
+			var by []string
+			hosted := false
+			for _, rt := range strings.Fields(g.rts) {
+				for _, e := range exporters[rt] {
+					if e.router == router {
+						continue
+					}
+					by = append(by, e.String())
+					for _, v := range vnis {
+						hosted = hosted || v.VNI == e.vni && v.Type == e.typ
+					}
+				}
+			}
+			sort.Strings(g.vteps)
+			unimportedTable.add(router, strings.Fields(g.rts), g.typ, g.count, g.vteps, by)
+			line := fmt.Sprintf("  ✗ %d type-%d route(s) with RT %s from %s imported by no VNI or VRF", g.count, g.typ, g.rts, strings.Join(g.vteps, ", "))
+			if len(by) > 0 {
+				line += " (exported by " + strings.Join(by, ", ") + ")"
+			}
+			lines = append(lines, line)
+			// A route exported for a VNI the router also has is black-holed;
+			// the others are for VNIs the router does not host.
+			if hosted {
+				findings = append(findings, fmt.Sprintf("%s drops %d type-%d route(s) with RT %s exported by %s, though it has the VNI", router, g.count, g.typ, g.rts, strings.Join(by, ", ")))
+			}
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "  no VNI")
+		}
+		fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+	}
+
+	// Route targets exported that no router imports go nowhere.
+	rts := make([]string, 0, len(exporters))
+	for rt := range exporters {
+		rts = append(rts, rt)
+	}
+	sort.Strings(rts)
+	for _, rt := range rts {
+		importedBy := false
+		for _, router := range queried {
+			for _, v := range configs[router] {
+				if !importsRT(v.ImportRTs, rt) {
+					continue
+				}
+				for _, e := range exporters[rt] {
+					importedBy = importedBy || e.router != router
+				}
+			}
+		}
+		if !importedBy && len(queried) > 1 {
+			var by []string
+			for _, e := range exporters[rt] {
+				by = append(by, e.String())
+			}
+			findings = append(findings, fmt.Sprintf("RT %s exported by %s is imported by no other router", rt, strings.Join(by, ", ")))
+		}
+	}
+	sort.Strings(findings)
+
+	summary := fmt.Sprintf("Route targets of %d router(s)", len(queried))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	} else if len(queried) > 0 {
+		text += "\n✓ Every VNI imports the route targets the other routers export for it\n"
+	}
+
+	var fields record
+	fields.add("routers", len(queried))
+	fields.add("unreachable_routers", failed)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, vniTable, unimportedTable)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// demoRefreshInterval is how often demo mode looks for new node names and
+// ASNs in the lab.
+const demoRefreshInterval = time.Minute
+
+// demoMinASN is the lowest ASN rewritten in demo mode: lower numbers are too
+// likely to be counts or ports to be replaced wherever they appear.
+const demoMinASN = 1000
+
+var (
+	ipv4CandidateRe = regexp.MustCompile(`\d{1,3}(?:\.\d{1,3}){3}`)
+	ipv6CandidateRe = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`)
+	numberRe        = regexp.MustCompile(`\d+`)
+)
+
+// sanitizer rewrites node names, IP addresses and ASNs in demo mode, so that
+// recorded sessions can be shown publicly. The mapping is kept for the life
+// of the server: the same lab value is always rewritten the same way, across
+// tools and sessions.
+type sanitizer struct {
+	mu sync.Mutex
+	// names maps node and cluster names to their demo names, reverse the
+	// other way around.
+	names   map[string]string
+	reverse map[string]string
+	// namesRe matches any of the names, longest first.
+	namesRe *regexp.Regexp
+	// roles counts the names given per role (leaf, spine, cluster).
+	roles map[string]int
+	asns  map[string]string
+	// v4Nets and v6Nets map the /24 and /64 networks of the lab to
+	// documentation ones, keeping the host part.
+	v4Nets    map[string]string
+	v6Nets    map[netip.Prefix]netip.Prefix
+	linkLocal map[netip.Addr]netip.Addr
+	refreshed time.Time
+}
+
+func newSanitizer() *sanitizer {
+	return &sanitizer{
+		names:     make(map[string]string),
+		reverse:   make(map[string]string),
+		roles:     make(map[string]int),
+		asns:      make(map[string]string),
+		v4Nets:    make(map[string]string),
+		v6Nets:    make(map[netip.Prefix]netip.Prefix),
+		linkLocal: make(map[netip.Addr]netip.Addr),
+	}
+}
+
+// nameRole returns the role a name is rewritten to, or "" when the name
+// carries nothing worth hiding.
+func nameRole(name string) string {
+	for _, role := range []string{"spine", "leaf"} {
+		if strings.HasPrefix(name, role) {
+			if name == role {
+				return ""
+			}
+			return role
+		}
+	}
+	return "node"
+}
+
+// refresh discovers the router short names, kind cluster names and ASNs of
+// the lab, at most once per demoRefreshInterval. Kind node names are
+// derived from their cluster name, so rewriting the cluster rewrites them.
+func (z *sanitizer) refresh() {
+	z.mu.Lock()
+	stale := time.Since(z.refreshed) >= demoRefreshInterval
+	if stale {
+		z.refreshed = time.Now()
+	}
+	z.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	type name struct{ value, role string }
+	var names []name
+	var asns []int64
+	routers, err := fabricRouters()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Demo mode: listing routers: %v\n", err)
+	}
+	for _, r := range routers {
+		if !isKindNode(r) {
+			short := strings.TrimPrefix(r, clabContainerPrefix)
+			if role := nameRole(short); role != "" {
+				names = append(names, name{short, role})
+			}
+		}
+		sessions, err := bgpSessions(r)
+		if err != nil {
+			continue
+		}
+		for _, s := range sessions {
+			asns = append(asns, s.RemoteAs)
+		}
+	}
+	if nodes, err := kindNodes(""); err == nil {
+		for _, n := range nodes {
+			if n.Cluster != "kind" {
+				names = append(names, name{n.Cluster, "cluster"})
+			}
+		}
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	added := false
+	for _, n := range names {
+		if _, ok := z.names[n.value]; ok {
+			continue
+		}
+		z.roles[n.role]++
+		demo := fmt.Sprintf("%s%d", n.role, z.roles[n.role])
+		z.names[n.value] = demo
+		z.reverse[demo] = n.value
+		added = true
+	}
+	for _, asn := range asns {
+		key := strconv.FormatInt(asn, 10)
+		if _, ok := z.asns[key]; ok || asn < demoMinASN {
+			continue
+		}
+		// RFC 5398 documentation ASNs: 64496-64511, then 65536-65551.
+		i := int64(len(z.asns))
+		demo := 64496 + i
+		if i >= 16 {
+			demo = 65536 + i - 16
+		}
+		z.asns[key] = strconv.FormatInt(demo, 10)
+	}
+	if added {
+		z.namesRe = namesRegexp(z.names)
+	}
+}
+
+// namesRegexp returns a regexp matching any key of names, longest first so
+// that a name never shadows a longer one it prefixes.
+func namesRegexp(names map[string]string) *regexp.Regexp {
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, regexp.QuoteMeta(k))
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	return regexp.MustCompile(strings.Join(keys, "|"))
+}
+
+// isAlnum reports whether the byte at i of text is a letter or a digit,
+// false out of bounds.
+func isAlnum(text string, i int) bool {
+	if i < 0 || i >= len(text) {
+		return false
+	}
+	c := text[i]
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// inDottedWord reports whether the byte at i of text continues a dotted
+// number, such as the fifth component of a version.
+func inDottedWord(text string, i int) bool {
+	if i < 0 || i >= len(text) {
+		return false
+	}
+	if text[i] == '.' {
+		return isAlnum(text, i-1) && isAlnum(text, i+1)
+	}
+	return isAlnum(text, i)
+}
+
+// replaceWords replaces the matches of re in text for which replace returns
+// true, skipping the ones glued to other characters as told by inWord.
+func replaceWords(text string, re *regexp.Regexp, inWord func(text string, i int) bool, replace func(string) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		if inWord(text, m[0]-1) || inWord(text, m[1]) {
+			continue
+		}
+		if demo, ok := replace(text[m[0]:m[1]]); ok {
+			b.WriteString(text[last:m[0]])
+			b.WriteString(demo)
+			last = m[1]
+		}
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// sanitize rewrites the node names, IP addresses and ASNs of text. The
+// caller holds z.mu.
+func (z *sanitizer) sanitize(text string) string {
+	if z.namesRe != nil {
+		text = replaceWords(text, z.namesRe, isAlnum, func(name string) (string, bool) {
+			return z.names[name], true
+		})
+	}
+	text = replaceWords(text, ipv6CandidateRe, func(text string, i int) bool {
+		return isAlnum(text, i) || (i >= 0 && i < len(text) && (text[i] == ':' || text[i] == '.'))
+	}, z.ipv6)
+	text = replaceWords(text, ipv4CandidateRe, inDottedWord, z.ipv4)
+	if len(z.asns) > 0 {
+		text = replaceWords(text, numberRe, func(text string, i int) bool {
+			return isAlnum(text, i) || (i >= 0 && i < len(text) && text[i] == '.')
+		}, func(n string) (string, bool) {
+			demo, ok := z.asns[n]
+			return demo, ok
+		})
+	}
+	return text
+}
+
+// ipv4 maps an address to the same host in the 10.0.0.0/8 /24 standing for
+// its network. Unspecified, loopback, multicast and netmask-like addresses
+// are kept.
+func (z *sanitizer) ipv4(s string) (string, bool) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.IsUnspecified() || addr.IsLoopback() || addr.IsMulticast() {
+		return "", false
+	}
+	octets := addr.As4()
+	if octets[0] == 255 || octets[0] == 0 {
+		return "", false
+	}
+	network := fmt.Sprintf("%d.%d.%d", octets[0], octets[1], octets[2])
+	demo, ok := z.v4Nets[network]
+	if !ok {
+		n := len(z.v4Nets) + 1
+		demo = fmt.Sprintf("10.%d.%d", n/256, n%256)
+		z.v4Nets[network] = demo
+	}
+	return fmt.Sprintf("%s.%d", demo, octets[3]), true
+}
+
+// ipv6 maps a global address to the same interface ID in a 2001:db8::/32
+// /64 standing for its network, and a link-local one to fe80::<n>.
+func (z *sanitizer) ipv6(s string) (string, bool) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is6() || addr.Is4In6() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsMulticast() {
+		return "", false
+	}
+	if addr.IsLinkLocalUnicast() {
+		demo, ok := z.linkLocal[addr]
+		if !ok {
+			n := len(z.linkLocal) + 1
+			demo = netip.AddrFrom16([16]byte{0: 0xfe, 1: 0x80, 14: byte(n >> 8), 15: byte(n)})
+			z.linkLocal[addr] = demo
+		}
+		return demo.String(), true
+	}
+	network := netip.PrefixFrom(addr, 64).Masked()
+	demo, ok := z.v6Nets[network]
+	if !ok {
+		n := len(z.v6Nets) + 1
+		demo = netip.PrefixFrom(netip.AddrFrom16([16]byte{0: 0x20, 1: 0x01, 2: 0x0d, 3: 0xb8, 4: byte(n >> 8), 5: byte(n)}), 64)
+		z.v6Nets[network] = demo
+	}
+	bytes, host := demo.Addr().As16(), addr.As16()
+	copy(bytes[8:], host[8:])
+	return netip.AddrFrom16(bytes).String(), true
+}
+
+// text sanitizes a tool output, notification or artifact.
+func (z *sanitizer) text(s string) string {
+	z.refresh()
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.sanitize(s)
+}
+
+// result sanitizes every content item of a tool result.
+func (z *sanitizer) result(result CallToolResult) CallToolResult {
+	z.refresh()
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	content := make([]ContentItem, len(result.Content))
+	for i, item := range result.Content {
+		item.Text = z.sanitize(item.Text)
+		if item.Resource != nil {
+			resource := *item.Resource
+			resource.Text = z.sanitize(resource.Text)
+			item.Resource = &resource
+		}
+		content[i] = item
+	}
+	result.Content = content
+	if result.StructuredContent != nil {
+		// The values are rewritten in their JSON encoding, as text.
+		var sanitized []byte
+		if data, err := json.Marshal(result.StructuredContent); err == nil {
+			sanitized = []byte(z.sanitize(string(data)))
+		}
+		if json.Valid(sanitized) {
+			result.StructuredContent = json.RawMessage(sanitized)
+		} else {
+			result.StructuredContent = nil
+		}
+	}
+	return result
+}
+
+// arguments maps the demo node names in the string arguments of a tool call
+// back to the lab ones, so the names read in earlier results can be passed
+// back as they are.
+func (z *sanitizer) arguments(args map[string]any) map[string]any {
+	if args == nil {
+		return nil
+	}
+	restored := make(map[string]any, len(args))
+	for name, value := range args {
+		restored[name] = z.argument(value)
+	}
+	return restored
+}
+
+func (z *sanitizer) argument(value any) any {
+	switch v := value.(type) {
+	case string:
+		return z.restore(v)
+	case []any:
+		restored := make([]any, len(v))
+		for i, item := range v {
+			restored[i] = z.argument(item)
+		}
+		return restored
+	case map[string]any:
+		return z.arguments(v)
+	}
+	return value
+}
+
+// rawArtifact reports whether an artifact holds data demo mode cannot
+// rewrite: pcaps, encrypted or not, carry the lab addresses in their
+// headers, and the archives bundle them. They are not served in demo mode.
+func rawArtifact(p string) bool {
+	return strings.HasSuffix(p, ".pcapng") || strings.HasSuffix(p, ".pcap") || strings.HasSuffix(p, ".tar.gz") || isEncryptedCapture(p)
+}
+
+// restore maps the demo node names of a resource URI or artifact path back
+// to the lab ones, so the links given to the client keep working.
+func (z *sanitizer) restore(s string) string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if len(z.reverse) == 0 {
+		return s
+	}
+	return replaceWords(s, namesRegexp(z.reverse), isAlnum, func(name string) (string, bool) {
+		return z.reverse[name], true
+	})
+}
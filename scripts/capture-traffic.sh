@@ -5,6 +5,101 @@ set -e
 # Set capture filter from environment variable (default to ICMP)
 CAPTURE_FILTER="${CAPTURE_FILTER:-icmp}"
 
+# Optional number of packets after which tshark stops on each node; the
+# script then copies the files out and exits on its own
+CAPTURE_MAX_PACKETS="${CAPTURE_MAX_PACKETS:-}"
+packet_limit=""
+if [ -n "$CAPTURE_MAX_PACKETS" ]; then
+    packet_limit="-c $CAPTURE_MAX_PACKETS"
+fi
+
+# Optional ring buffer: tshark switches to a new file every
+# CAPTURE_FILE_SIZE_KB kB and keeps the last CAPTURE_NUM_FILES of them
+ring_buffer=""
+if [ -n "${CAPTURE_FILE_SIZE_KB:-}" ]; then
+    ring_buffer="-b filesize:$CAPTURE_FILE_SIZE_KB -b files:${CAPTURE_NUM_FILES:-10}"
+fi
+
+# Optional live packet summaries: tshark prints a line per packet to a file
+# next to the pcapng, which is followed and printed prefixed with
+# "LIVE <container> " for the server to forward
+live_output="-q"
+live_pids=()
+if [ -n "${CAPTURE_LIVE:-}" ]; then
+    live_output="-P -l"
+fi
+
+# follow_live prints the packet summaries of a container as they come
+follow_live() {
+    local container="$1" live_file="$2"
+    [ -n "${CAPTURE_LIVE:-}" ] || return 0
+    docker exec "$container" sh -c "tail -n +1 -F $live_file 2>/dev/null | sed -u 's|^|LIVE $container |'" &
+    live_pids+=("$!")
+}
+
+# Optional capture on interfaces of the host running kind and containerlab,
+# such as the docker bridges, for traffic that never reaches the containers:
+#   CAPTURE_HOST_INTERFACES - space separated host interfaces
+# The host tshark writes straight to the output directory.
+host_pid=""
+host_live_file=""
+
+# start_host_capture starts tshark on the host interfaces, if any
+start_host_capture() {
+    [ -n "${CAPTURE_HOST_INTERFACES:-}" ] || return 0
+    local filter_name capture_file interfaces=""
+    filter_name=$(echo "$CAPTURE_FILTER" | tr ' ' '_' | tr -cd '[:alnum:]_-')
+    capture_file="${host_output_dir}/${filter_name}_capture_host.pcapng"
+    for iface in $CAPTURE_HOST_INTERFACES; do
+        interfaces="${interfaces:+$interfaces }-i $iface"
+    done
+    echo "Processing host interfaces: $CAPTURE_HOST_INTERFACES"
+    echo "  Starting tshark capture ($interfaces) -> $capture_file"
+    if [ -n "${CAPTURE_LIVE:-}" ]; then
+        host_live_file="${capture_file%.pcapng}.live"
+        tshark $interfaces $packet_limit $ring_buffer -F pcapng -n -t ad -f "$CAPTURE_FILTER" -w "$capture_file" -P -l > "$host_live_file" 2>/dev/null &
+        host_pid=$!
+        tail -n +1 -F "$host_live_file" 2>/dev/null | sed -u 's|^|LIVE host |' &
+        live_pids+=("$!")
+    else
+        tshark $interfaces $packet_limit $ring_buffer -F pcapng -n -t ad -f "$CAPTURE_FILTER" -w "$capture_file" -q &
+        host_pid=$!
+    fi
+
+    # Verify the capture is running
+    sleep 1
+    if kill -0 "$host_pid" 2>/dev/null; then
+        echo "  Capture started with PID: $host_pid (on host)"
+    else
+        echo "  ✗ Failed to start tshark capture on host"
+        host_pid=""
+    fi
+    echo ""
+}
+
+# Optional node and interface selection:
+#   CAPTURE_NODES      - space separated containers to capture on
+#   CAPTURE_INTERFACES - space separated container:iface1,iface2 entries,
+#                        nodes without an entry capture on all interfaces
+declare -A capture_interfaces
+for entry in ${CAPTURE_INTERFACES:-}; do
+    capture_interfaces["${entry%%:*}"]="${entry#*:}"
+done
+
+# tshark_interfaces prints the tshark interface arguments of a container
+tshark_interfaces() {
+    local ifaces="${capture_interfaces[$1]:-}"
+    if [ -z "$ifaces" ]; then
+        echo "-iany"
+        return
+    fi
+    local args=""
+    for iface in ${ifaces//,/ }; do
+        args="${args:+$args }-i $iface"
+    done
+    echo "$args"
+}
+
 # Function to ensure tshark is installed in containers
 ensure_tshark() {
     echo "Checking tshark installation in containers..."
@@ -59,6 +154,13 @@ if [ $# -gt 1 ]; then
     echo "Environment variables:"
     echo "  CAPTURE_FILTER - tshark capture filter (default: icmp)"
     echo "                   Examples: 'tcp port 22', 'udp', 'host 192.168.1.1'"
+    echo "  CAPTURE_NODES  - containers to capture on (default: kind nodes and spine)"
+    echo "  CAPTURE_INTERFACES - container:iface1,iface2 entries (default: all interfaces)"
+    echo "  CAPTURE_MAX_PACKETS - stop after this many packets per node (default: no limit)"
+    echo "  CAPTURE_FILE_SIZE_KB - rotate files at this size in kB (default: single file)"
+    echo "  CAPTURE_NUM_FILES - rotated files kept per node (default: 10)"
+    echo "  CAPTURE_LIVE - print a summary line per captured packet, prefixed with LIVE <container>"
+    echo "  CAPTURE_HOST_INTERFACES - host interfaces to capture on too (default: none)"
     exit 1
 fi
 
@@ -83,11 +185,20 @@ containers=(
     "pe-kind-b-worker"
     "clab-kind-spine"
 )
+if [ -n "${CAPTURE_NODES:-}" ]; then
+    read -r -a containers <<< "$CAPTURE_NODES"
+fi
 
 # Arrays to store container names and tshark PIDs for cleanup
 capture_containers=()
 capture_pids=()
 
+# capture_running tells whether a tshark process is still running in a
+# container, zombies left behind by the container init included
+capture_running() {
+    docker exec "$1" sh -c "test -e /proc/$2 && ! grep -q '^State:.*Z' /proc/$2/status" 2>/dev/null
+}
+
 # Cleanup function
 cleanup() {
     echo "Stopping tshark captures..."
@@ -101,10 +212,28 @@ cleanup() {
             echo "  Sent SIGTERM to capture process $pid in container $container"
         fi
     done
+    if [ -n "$host_pid" ] && kill -0 "$host_pid" 2>/dev/null; then
+        kill -TERM "$host_pid" 2>/dev/null
+        echo "  Sent SIGTERM to capture process $host_pid on host"
+    fi
     
     # Give processes time to terminate gracefully
     echo "Waiting for processes to terminate and files to be written..."
     sleep 3
+
+    # Stop following the packet summaries, in the containers too
+    for pid in "${live_pids[@]}"; do
+        kill "$pid" 2>/dev/null || true
+    done
+    if [ ${#live_pids[@]} -gt 0 ]; then
+        for container in "${capture_containers[@]}"; do
+            docker exec "$container" pkill -f "tail -n +1 -F /.*_capture_.*\.live" 2>/dev/null || true
+        done
+    fi
+    if [ -n "$host_live_file" ]; then
+        pkill -f "tail -n +1 -F $host_live_file" 2>/dev/null || true
+        rm -f "$host_live_file"
+    fi
     
     # Force kill any remaining processes
     for i in "${!capture_pids[@]}"; do
@@ -116,32 +245,39 @@ cleanup() {
             echo "  Force killed process $pid in container $container"
         fi
     done
+    if [ -n "$host_pid" ] && kill -0 "$host_pid" 2>/dev/null; then
+        kill -KILL "$host_pid" 2>/dev/null
+        echo "  Force killed process $host_pid on host"
+    fi
     
     echo "Copying capture files from containers to host..."
     for container in "${containers[@]}"; do
         # Create the same safe filename as used during capture
         filter_name=$(echo "$CAPTURE_FILTER" | tr ' ' '_' | tr -cd '[:alnum:]_-')
-        capture_file="/${filter_name}_capture_${container}.pcap"
-        host_file="${host_output_dir}/${filter_name}_capture_${container}.pcap"
+        capture_base="/${filter_name}_capture_${container}"
         
         echo "  Checking for files in container $container..."
         docker exec "$container" ls -la /*_capture_* 2>/dev/null || echo "    No capture files found"
         
-        # Check if file exists in container first
-        if docker exec "$container" test -f "$capture_file" 2>/dev/null; then
+        # The ring buffer rotates files named <base>_<index>_<timestamp>.pcapng
+        capture_files=$(docker exec "$container" sh -c "ls -1 ${capture_base}.pcapng ${capture_base}_[0-9]*_[0-9]*.pcapng 2>/dev/null" || true)
+        if [ -z "$capture_files" ]; then
+            echo "  ✗ File ${capture_base}.pcapng not found in container $container"
+            continue
+        fi
+        for capture_file in $capture_files; do
             echo "  ✓ Found $capture_file in container $container"
             file_size=$(docker exec "$container" stat -c%s "$capture_file" 2>/dev/null)
             echo "    File size: $file_size bytes"
             
+            host_file="${host_output_dir}${capture_file}"
             echo "  Copying from $container:$capture_file to $host_file"
             if docker cp "$container:$capture_file" "$host_file"; then
                 echo "    ✓ Successfully copied"
             else
                 echo "    ✗ Failed to copy (exit code: $?)"
             fi
-        else
-            echo "  ✗ File $capture_file not found in container $container"
-        fi
+        done
     done
     
     echo "Cleanup completed. Capture files saved to: $host_output_dir"
@@ -170,21 +306,28 @@ for container in "${containers[@]}"; do
     
     # Create a safe filename based on the filter
     filter_name=$(echo "$CAPTURE_FILTER" | tr ' ' '_' | tr -cd '[:alnum:]_-')
-    capture_file="/${filter_name}_capture_${container}.pcap"
-    echo "  Starting tshark capture -> $capture_file"
+    capture_file="/${filter_name}_capture_${container}.pcapng"
+    live_file="/${filter_name}_capture_${container}.live"
+    live_redirect=""
+    if [ -n "${CAPTURE_LIVE:-}" ]; then
+        live_redirect="> $live_file 2>/dev/null"
+    fi
+    interfaces=$(tshark_interfaces "$container")
+    echo "  Starting tshark capture ($interfaces) -> $capture_file"
     
     # Handle different container types
-    if [[ "$container" == "clab-kind-spine" ]]; then
-        # Direct capture in spine container (no FRR namespace needed)
-        echo "  Using direct capture method for spine container"
+    if [[ "$container" == clab-* ]]; then
+        # Direct capture in containerlab containers (no FRR namespace needed)
+        echo "  Using direct capture method for containerlab container"
         
         # Start tshark directly in the container and get its PID
-        tshark_pid=$(docker exec "$container" bash -c "tshark -iany -n -t ad -f '$CAPTURE_FILTER' -w $capture_file -q & echo \$!")
+        tshark_pid=$(docker exec "$container" bash -c "tshark $interfaces $packet_limit $ring_buffer -F pcapng -n -t ad -f '$CAPTURE_FILTER' -w $capture_file $live_output $live_redirect & echo \$!")
         
         if [ -n "$tshark_pid" ]; then
             capture_containers+=("$container")
             capture_pids+=("$tshark_pid")
             echo "  Capture started with PID: $tshark_pid (inside container $container)"
+            follow_live "$container" "$live_file"
             
             # Wait a moment and check if the process is still running inside the container
             sleep 1
@@ -214,12 +357,13 @@ for container in "${containers[@]}"; do
                 echo "  Debug: Starting tshark capture inside container namespace"
                 
                 # Start tshark in background and get its PID from inside the container
-                tshark_pid=$(docker exec "$container" bash -c "nsenter -t $actual_pid -n tshark -iany -n -t ad -f '$CAPTURE_FILTER' -w $capture_file -q & echo \$!")
+                tshark_pid=$(docker exec "$container" bash -c "nsenter -t $actual_pid -n tshark $interfaces $packet_limit $ring_buffer -F pcapng -n -t ad -f '$CAPTURE_FILTER' -w $capture_file $live_output $live_redirect & echo \$!")
                 
                 if [ -n "$tshark_pid" ]; then
                     capture_containers+=("$container")
                     capture_pids+=("$tshark_pid")
                     echo "  Capture started with PID: $tshark_pid (inside container $container)"
+                    follow_live "$container" "$live_file"
                     
                     # Wait a moment and check if the process is still running inside the container
                     sleep 1
@@ -242,12 +386,17 @@ for container in "${containers[@]}"; do
     echo ""
 done
 
+start_host_capture
+
 echo ""
 echo "All captures started. Files will be saved inside containers as:"
 filter_name=$(echo "$CAPTURE_FILTER" | tr ' ' '_' | tr -cd '[:alnum:]_-')
 for container in "${containers[@]}"; do
-    echo "  - $container:/${filter_name}_capture_${container}.pcap"
+    echo "  - $container:/${filter_name}_capture_${container}.pcapng"
 done
+if [ -n "$host_pid" ]; then
+    echo "  - host:${host_output_dir}/${filter_name}_capture_host.pcapng (written there directly)"
+fi
 
 echo ""
 echo "On cleanup, files will be copied to host directory: $host_output_dir"
@@ -257,4 +406,21 @@ echo "Captures are running in background..."
 # Keep script running to maintain captures
 while true; do
     sleep 1
+    if [ -z "$CAPTURE_MAX_PACKETS" ] || { [ ${#capture_pids[@]} -eq 0 ] && [ -z "$host_pid" ]; }; then
+        continue
+    fi
+    running=0
+    if [ -n "$host_pid" ] && kill -0 "$host_pid" 2>/dev/null; then
+        running=1
+    fi
+    for i in "${!capture_pids[@]}"; do
+        if capture_running "${capture_containers[$i]}" "${capture_pids[$i]}"; then
+            running=1
+            break
+        fi
+    done
+    if [ $running -eq 0 ]; then
+        echo "All captures reached their packet limit"
+        cleanup
+    fi
 done
@@ -5,6 +5,14 @@
 
 set -e
 
+# Routers to extract: "leaf" (containerlab leaves and kind clusters), "spine"
+# or "all"
+ROUTER_ROLE="${ROUTER_ROLE:-all}"
+case "$ROUTER_ROLE" in
+    all|leaf|spine) ;;
+    *) echo "Invalid ROUTER_ROLE '$ROUTER_ROLE': expected all, leaf or spine" >&2; exit 1;;
+esac
+
 # Colors for output
 RED='\033[0;31m'
 GREEN='\033[0;32m'
@@ -16,7 +24,7 @@ NC='\033[0m' # No Color
 OUTPUT_DIR="network_configs_$(date +%Y%m%d_%H%M%S)"
 mkdir -p "$OUTPUT_DIR"
 
-echo -e "${GREEN}=== Extracting FRR configurations from all leaf nodes and spine routers ===${NC}"
+echo -e "${GREEN}=== Extracting FRR configurations (routers: $ROUTER_ROLE) ===${NC}"
 echo -e "${BLUE}Output directory: $OUTPUT_DIR${NC}"
 echo
 
@@ -82,55 +90,59 @@ extract_kind_leaf_config() {
 }
 
 # Extract configs from regular containerlab FRR spine routers
-echo -e "${GREEN}=== Processing regular containerlab spine routers ===${NC}"
-spine_routers=$(docker ps --filter "name=clab-kind-spine" --format "{{.Names}}" | grep -E "spine" || true)
-
-if [[ -n "$spine_routers" ]]; then
-    while IFS= read -r spine; do
-        if [[ -n "$spine" ]]; then
-            # Extract just the spine name (remove clab-kind- prefix)
-            spine_name=${spine#clab-kind-}
-            output_file="$OUTPUT_DIR/${spine_name}_config.txt"
-            extract_regular_config "$spine" "$output_file" "spine"
-        fi
-    done <<< "$spine_routers"
-else
-    echo -e "${YELLOW}No regular spine containers found${NC}"
+if [[ "$ROUTER_ROLE" != "leaf" ]]; then
+    echo -e "${GREEN}=== Processing regular containerlab spine routers ===${NC}"
+    spine_routers=$(docker ps --filter "name=clab-kind-spine" --format "{{.Names}}" | grep -E "spine" || true)
+
+    if [[ -n "$spine_routers" ]]; then
+        while IFS= read -r spine; do
+            if [[ -n "$spine" ]]; then
+                # Extract just the spine name (remove clab-kind- prefix)
+                spine_name=${spine#clab-kind-}
+                output_file="$OUTPUT_DIR/${spine_name}_config.txt"
+                extract_regular_config "$spine" "$output_file" "spine"
+            fi
+        done <<< "$spine_routers"
+    else
+        echo -e "${YELLOW}No regular spine containers found${NC}"
+    fi
+    echo
 fi
-echo
 
 # Extract configs from regular containerlab FRR leaf containers
-echo -e "${GREEN}=== Processing regular containerlab leaf nodes ===${NC}"
-regular_leaves=$(docker ps --filter "name=clab-kind-leaf" --format "{{.Names}}" | grep -E "leaf[A-Z]|leafkind" || true)
-
-if [[ -n "$regular_leaves" ]]; then
-    while IFS= read -r leaf; do
-        if [[ -n "$leaf" ]]; then
-            # Extract just the leaf name (remove clab-kind- prefix)
-            leaf_name=${leaf#clab-kind-}
-            output_file="$OUTPUT_DIR/${leaf_name}_config.txt"
-            extract_regular_config "$leaf" "$output_file" "leaf"
-        fi
-    done <<< "$regular_leaves"
-else
-    echo -e "${YELLOW}No regular leaf containers found${NC}"
-fi
-echo
+if [[ "$ROUTER_ROLE" != "spine" ]]; then
+    echo -e "${GREEN}=== Processing regular containerlab leaf nodes ===${NC}"
+    regular_leaves=$(docker ps --filter "name=clab-kind-leaf" --format "{{.Names}}" | grep -E "leaf[A-Z]|leafkind" || true)
 
-# Extract configs from FRR containers inside kind clusters
-echo -e "${GREEN}=== Processing kind cluster leaf nodes ===${NC}"
-kind_clusters=$(kind get clusters 2>/dev/null || true)
+    if [[ -n "$regular_leaves" ]]; then
+        while IFS= read -r leaf; do
+            if [[ -n "$leaf" ]]; then
+                # Extract just the leaf name (remove clab-kind- prefix)
+                leaf_name=${leaf#clab-kind-}
+                output_file="$OUTPUT_DIR/${leaf_name}_config.txt"
+                extract_regular_config "$leaf" "$output_file" "leaf"
+            fi
+        done <<< "$regular_leaves"
+    else
+        echo -e "${YELLOW}No regular leaf containers found${NC}"
+    fi
+    echo
 
-if [[ -n "$kind_clusters" ]]; then
-    while IFS= read -r cluster; do
-        if [[ -n "$cluster" ]]; then
-            extract_kind_leaf_config "$cluster"
-        fi
-    done <<< "$kind_clusters"
-else
-    echo -e "${YELLOW}No kind clusters found${NC}"
+    # Extract configs from FRR containers inside kind clusters
+    echo -e "${GREEN}=== Processing kind cluster leaf nodes ===${NC}"
+    kind_clusters=$(kind get clusters 2>/dev/null || true)
+
+    if [[ -n "$kind_clusters" ]]; then
+        while IFS= read -r cluster; do
+            if [[ -n "$cluster" ]]; then
+                extract_kind_leaf_config "$cluster"
+            fi
+        done <<< "$kind_clusters"
+    else
+        echo -e "${YELLOW}No kind clusters found${NC}"
+    fi
+    echo
 fi
-echo
 
 echo -e "${GREEN}=== Configuration extraction complete ===${NC}"
 echo -e "${BLUE}All configurations saved to: $OUTPUT_DIR${NC}"
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ellorent/openperouter-mcp/internal/frr"
+	_ "modernc.org/sqlite"
+)
+
+// stateSchema is the layout of the state database. Every snapshot row
+// references the snapshot it was collected in, so states can be compared over
+// time with plain SQL; the bmp_ tables are filled continuously by the BMP
+// collector and trend_samples by the trend sampler. It is documented in the README; keep both in sync.
+const stateSchema = `
+CREATE TABLE IF NOT EXISTS snapshots (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	taken_at TEXT NOT NULL,
+	label    TEXT
+);
+CREATE TABLE IF NOT EXISTS bgp_sessions (
+	snapshot_id       INTEGER NOT NULL REFERENCES snapshots(id),
+	router            TEXT NOT NULL,
+	vrf               TEXT NOT NULL,
+	afi               TEXT NOT NULL,
+	neighbor          TEXT NOT NULL,
+	remote_as         INTEGER,
+	state             TEXT,
+	prefixes_received INTEGER,
+	uptime            TEXT
+);
+CREATE TABLE IF NOT EXISTS routes (
+	snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+	router      TEXT NOT NULL,
+	vrf         TEXT NOT NULL,
+	prefix      TEXT NOT NULL,
+	protocol    TEXT,
+	selected    INTEGER,
+	installed   INTEGER,
+	nexthops    TEXT
+);
+CREATE TABLE IF NOT EXISTS fdb (
+	snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+	router      TEXT NOT NULL,
+	mac         TEXT NOT NULL,
+	dev         TEXT,
+	vlan        INTEGER,
+	dst         TEXT,
+	master      TEXT,
+	state       TEXT,
+	flags       TEXT
+);
+CREATE TABLE IF NOT EXISTS resources (
+	snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+	cluster     TEXT NOT NULL,
+	kind        TEXT NOT NULL,
+	namespace   TEXT,
+	name        TEXT NOT NULL,
+	spec        TEXT
+);
+CREATE TABLE IF NOT EXISTS collection_errors (
+	snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+	source      TEXT NOT NULL,
+	error       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS bmp_peer_events (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	received_at TEXT NOT NULL,
+	router      TEXT NOT NULL,
+	peer        TEXT NOT NULL,
+	peer_as     INTEGER,
+	peer_bgp_id TEXT,
+	peer_rd     TEXT NOT NULL,
+	peer_type   TEXT,
+	event       TEXT NOT NULL,
+	detail      TEXT
+);
+CREATE TABLE IF NOT EXISTS bmp_route_events (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	received_at TEXT NOT NULL,
+	router      TEXT NOT NULL,
+	peer        TEXT NOT NULL,
+	peer_as     INTEGER,
+	peer_rd     TEXT NOT NULL,
+	post_policy INTEGER,
+	action      TEXT NOT NULL,
+	family      TEXT NOT NULL,
+	prefix      TEXT NOT NULL,
+	next_hop    TEXT,
+	as_path     TEXT,
+	attributes  TEXT
+);
+CREATE INDEX IF NOT EXISTS bmp_route_events_received_at ON bmp_route_events(received_at);
+CREATE TABLE IF NOT EXISTS trend_samples (
+	sampled_at TEXT NOT NULL,
+	label      TEXT,
+	metric     TEXT NOT NULL,
+	router     TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	value      REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS trend_samples_metric ON trend_samples(metric, sampled_at);
+`
+
+// maxQueryRows bounds the rows returned by query_state.
+const maxQueryRows = 500
+
+// openperouterAPIGroup is the API group of the openperouter custom resources.
+const openperouterAPIGroup = "openpe.openperouter.github.io"
+
+// The BGP summary and the RIB are decoded by the frr package.
+type (
+	bgpPeerSummary = frr.PeerSummary
+	bgpSession     = frr.Session
+	ribNexthop     = frr.Nexthop
+	ribRoute       = frr.Route
+)
+
+type fdbEntry struct {
+	MAC    string   `json:"mac"`
+	IfName string   `json:"ifname"`
+	Vlan   int      `json:"vlan"`
+	Dst    string   `json:"dst"`
+	Master string   `json:"master"`
+	State  string   `json:"state"`
+	Flags  []string `json:"flags"`
+}
+
+func openStateDB(path string) (*sql.DB, error) {
+	// The BMP collector writes while snapshots are taken: wait for the lock
+	// rather than failing.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(stateSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating state schema in %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// bgpSessions returns the BGP peers of every VRF and address family of a
+// router.
+func bgpSessions(router string) ([]bgpSession, error) {
+	return frrClient(router).BGPSessions()
+}
+
+func collectBGPSessions(tx *sql.Tx, snapshotID int64, router string) (int, error) {
+	sessions, err := bgpSessions(router)
+	if err != nil {
+		return 0, err
+	}
+	for i, p := range sessions {
+		if _, err := tx.Exec(`INSERT INTO bgp_sessions VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			snapshotID, router, p.VRF, p.AFI, p.Neighbor, p.RemoteAs, p.State, p.PfxRcd, p.PeerUptime); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+func collectRoutes(tx *sql.Tx, snapshotID int64, router string) (int, error) {
+	count := 0
+	for _, family := range []string{"ip", "ipv6"} {
+		vrfs, err := frrClient(router).Routes(family, "")
+		if err != nil {
+			return count, err
+		}
+		for vrf, routes := range vrfs {
+			for _, r := range routes {
+				var nexthops []string
+				for _, nh := range r.Nexthops {
+					nexthops = append(nexthops, nh.String())
+				}
+				if _, err := tx.Exec(`INSERT INTO routes VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+					snapshotID, router, vrf, r.Prefix, r.Protocol, r.Selected, r.Installed, strings.Join(nexthops, ", ")); err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func collectFDB(tx *sql.Tx, snapshotID int64, router string) (int, error) {
+	out, err := runInRouterNetns(router, "bridge", "-j", "fdb", "show")
+	if err != nil {
+		return 0, err
+	}
+	var entries []fdbEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return 0, fmt.Errorf("parsing FDB of %s: %w", router, err)
+	}
+	for _, e := range entries {
+		if _, err := tx.Exec(`INSERT INTO fdb VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			snapshotID, router, e.MAC, e.IfName, e.Vlan, e.Dst, e.Master, e.State, strings.Join(e.Flags, ",")); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// openperouterResources returns the names of the openperouter resource types
+// served by the cluster (e.g. "underlays.openpe.openperouter.github.io").
+func openperouterResources(cluster string) ([]string, error) {
+	out, err := kubectl(cluster, "api-resources", "--api-group="+openperouterAPIGroup, "-o", "name")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func collectResources(tx *sql.Tx, snapshotID int64, cluster string) (int, error) {
+	kinds, err := openperouterResources(cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, kind := range kinds {
+		var list struct {
+			Items []struct {
+				Kind     string          `json:"kind"`
+				Metadata objectMeta      `json:"metadata"`
+				Spec     json.RawMessage `json:"spec"`
+			} `json:"items"`
+		}
+		if err := kubectlGetJSON(cluster, &list, kind, "-A"); err != nil {
+			return count, err
+		}
+		for _, item := range list.Items {
+			if _, err := tx.Exec(`INSERT INTO resources VALUES (?, ?, ?, ?, ?, ?)`,
+				snapshotID, cluster, item.Kind, item.Metadata.Namespace, item.Metadata.Name, string(item.Spec)); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MCPServer) snapshotState(args map[string]any) CallToolResult {
+	label, _ := args["label"].(string)
+
+	db, err := openStateDB(s.config.StateDB)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error opening state database: %v", err))
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return toolError(fmt.Sprintf("Error starting transaction: %v", err))
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO snapshots (taken_at, label) VALUES (?, ?)`, time.Now().UTC().Format(time.RFC3339), label)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error creating snapshot: %v", err))
+	}
+	snapshotID, err := res.LastInsertId()
+	if err != nil {
+		return toolError(fmt.Sprintf("Error creating snapshot: %v", err))
+	}
+
+	var failures []string
+	record := func(source string, err error) {
+		failures = append(failures, fmt.Sprintf("%s: %v", source, err))
+		tx.Exec(`INSERT INTO collection_errors VALUES (?, ?, ?)`, snapshotID, source, err.Error())
+	}
+
+	routers, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	counts := make(map[string]int)
+	for _, router := range routers {
+		for _, c := range []struct {
+			table   string
+			collect func(*sql.Tx, int64, string) (int, error)
+		}{
+			{"bgp_sessions", collectBGPSessions},
+			{"routes", collectRoutes},
+			{"fdb", collectFDB},
+		} {
+			n, err := c.collect(tx, snapshotID, router)
+			counts[c.table] += n
+			if err != nil {
+				record(fmt.Sprintf("%s %s", c.table, router), err)
+			}
+		}
+	}
+
+	nodes, err := kindNodes("")
+	if err != nil {
+		record("kind nodes", err)
+	}
+	seen := make(map[string]bool)
+	for _, n := range nodes {
+		if seen[n.Cluster] {
+			continue
+		}
+		seen[n.Cluster] = true
+		count, err := collectResources(tx, snapshotID, n.Cluster)
+		counts["resources"] += count
+		if err != nil {
+			record("resources "+n.Cluster, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return toolError(fmt.Sprintf("Error saving snapshot: %v", err))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Snapshot %d saved to %s", snapshotID, s.config.StateDB)
+	if label != "" {
+		fmt.Fprintf(&b, " (label %q)", label)
+	}
+	fmt.Fprintf(&b, " from %d router(s):\n", len(routers))
+	for _, table := range []string{"bgp_sessions", "routes", "fdb", "resources"} {
+		fmt.Fprintf(&b, "- %s: %d rows\n", table, counts[table])
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\n%d collection error(s), also stored in collection_errors:\n", len(failures))
+		for _, f := range failures {
+			fmt.Fprintf(&b, "- %s\n", f)
+		}
+	}
+	b.WriteString("\nUse query_state to analyze it with SQL.")
+
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
+
+func (s *MCPServer) queryState(args map[string]any) CallToolResult {
+	query, _ := args["sql"].(string)
+	if strings.TrimSpace(query) == "" {
+		return toolError("sql is required")
+	}
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	db, err := sql.Open("sqlite", "file:"+s.config.StateDB+"?mode=ro&_pragma=query_only(1)")
+	if err != nil {
+		return toolError(fmt.Sprintf("Error opening state database: %v", err))
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return toolError(fmt.Sprintf("Query failed: %v", err))
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return toolError(fmt.Sprintf("Query failed: %v", err))
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(columns, "\t") + "\n")
+	result := newTable("rows", columns...)
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	n := 0
+	truncated := false
+	for rows.Next() {
+		if n == maxQueryRows {
+			truncated = true
+			break
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return toolError(fmt.Sprintf("Reading results failed: %v", err))
+		}
+		fields := make([]string, len(values))
+		row := make([]any, len(values))
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				fields[i] = "NULL"
+			case []byte:
+				fields[i] = string(v)
+				row[i] = string(v)
+			default:
+				fields[i] = fmt.Sprint(v)
+				row[i] = v
+			}
+		}
+		b.WriteString(strings.Join(fields, "\t") + "\n")
+		result.add(row...)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return toolError(fmt.Sprintf("Reading results failed: %v", err))
+	}
+
+	if truncated {
+		fmt.Fprintf(&b, "(truncated to %d rows, refine the query)\n", maxQueryRows)
+	} else {
+		fmt.Fprintf(&b, "(%d rows)\n", n)
+	}
+	var fields record
+	fields.add("truncated", truncated)
+	return formattedResult(format, b.String(), false, fields, result)
+}
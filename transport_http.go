@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// sseSession is a network client session. Despite the name it also backs
+// WebSocket connections: messages carries what is sent to the client on its
+// event stream or socket.
+type sseSession struct {
+	id       string
+	messages chan []byte
+	// connected and lastActivity are guarded by httpTransport.mu.
+	connected    bool
+	lastActivity time.Time
+}
+
+// sseKeepAliveInterval is how often a comment is written on idle event
+// streams, so connections to clients that vanished are detected.
+const sseKeepAliveInterval = 30 * time.Second
+
+// httpTransport serves the MCP HTTP+SSE transport: clients open an event
+// stream on /sse and post JSON-RPC requests to the endpoint announced on it.
+// It also serves the WebSocket transport, sharing sessions and their cleanup.
+type httpTransport struct {
+	server      *MCPServer
+	sessions    map[string]*sseSession
+	mu          sync.Mutex
+	idleTimeout time.Duration
+}
+
+func newHTTPTransport(server *MCPServer) *httpTransport {
+	return &httpTransport{
+		server:      server,
+		sessions:    make(map[string]*sseSession),
+		idleTimeout: server.config.SessionIdleTimeout.Duration,
+	}
+}
+
+// reapIdleSessions periodically drops sessions whose event stream is closed
+// and that have not posted anything for the configured idle timeout,
+// stopping the captures they left behind.
+func (t *httpTransport) reapIdleSessions() {
+	timeout := t.idleTimeout
+	// time.Tick returns nil, blocking forever, for a zero interval.
+	interval := max(min(timeout/2, 30*time.Second), time.Second)
+	for range time.Tick(interval) {
+		var expired []string
+		t.mu.Lock()
+		for id, session := range t.sessions {
+			if !session.connected && time.Since(session.lastActivity) > timeout {
+				expired = append(expired, id)
+				delete(t.sessions, id)
+			}
+		}
+		t.mu.Unlock()
+
+		for _, id := range expired {
+			fmt.Fprintf(os.Stderr, "Session %s idle for more than %s, cleaning up\n", id, timeout)
+			go t.server.closeSession(id)
+		}
+	}
+}
+
+func (t *httpTransport) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sse", t.handleSSE)
+	mux.HandleFunc("POST /message", t.handleMessage)
+	if t.server.config.WebUI {
+		mux.Handle("/ui/", t.server.webUIHandler())
+	}
+	return mux
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// connect registers a new session with an open stream.
+func (t *httpTransport) connect(transport string) *sseSession {
+	session := &sseSession{
+		id:           newSessionID(),
+		messages:     make(chan []byte, 16),
+		connected:    true,
+		lastActivity: time.Now(),
+	}
+	t.mu.Lock()
+	t.sessions[session.id] = session
+	t.mu.Unlock()
+	t.server.openSession(session.id, transport)
+	t.server.setNotifier(session.id, func(data []byte) {
+		// Don't block the caller on a client that stopped reading.
+		select {
+		case session.messages <- data:
+		default:
+			fmt.Fprintf(os.Stderr, "Session %s message queue full, dropping a notification\n", session.id)
+		}
+	})
+	return session
+}
+
+// disconnect marks the stream of a session closed. The session outlives its
+// stream until the idle reaper collects it, so that captures it started are
+// cleaned up rather than dropped.
+func (t *httpTransport) disconnect(session *sseSession) {
+	t.mu.Lock()
+	session.connected = false
+	session.lastActivity = time.Now()
+	expired := t.idleTimeout <= 0
+	if expired {
+		delete(t.sessions, session.id)
+	}
+	t.mu.Unlock()
+	// The requests sent on the stream won't be answered anymore.
+	t.server.cancelPending(session.id)
+	// Without an idle timeout, captures outlive their session.
+	if expired {
+		t.server.forgetSession(session.id)
+	}
+}
+
+// touch records activity on a session. It returns false if the session is
+// unknown or its stream is closed.
+func (t *httpTransport) touch(session *sseSession) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !session.connected {
+		return false
+	}
+	session.lastActivity = time.Now()
+	return true
+}
+
+// dispatch handles a JSON-RPC message received on a session and returns the
+// encoded response, nil for the responses of the client to the requests of
+// the server.
+func (t *httpTransport) dispatch(session *sseSession, body []byte) ([]byte, error) {
+	var resp JSONRPCResponse
+	var req JSONRPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		resp = t.server.errorResponse(nil, -32700, "Parse error")
+	} else if req.isResponse() {
+		t.server.handleClientResponse(session.id, req)
+		return nil, nil
+	} else {
+		resp = t.server.handleRequest(session.id, req)
+	}
+	return json.Marshal(resp)
+}
+
+func (t *httpTransport) handleSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	session := t.connect("http")
+	defer t.disconnect(session)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "event: endpoint\ndata: /message?sessionId=%s\n\n", session.id)
+	flusher.Flush()
+
+	rc := http.NewResponseController(w)
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg := <-session.messages:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (t *httpTransport) handleMessage(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	session, ok := t.sessions[r.URL.Query().Get("sessionId")]
+	t.mu.Unlock()
+	if !ok || !t.touch(session) {
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+
+	const maxCapacity = 1024 * 1024
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCapacity))
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+
+	data, err := t.dispatch(session, body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if data == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	select {
+	case session.messages <- data:
+		w.WriteHeader(http.StatusAccepted)
+	case <-r.Context().Done():
+	}
+}
+
+// loadTLSConfig builds the listener TLS configuration. It returns nil when no
+// certificate is configured. When clientCAFile is set, clients must present a
+// certificate signed by one of the CAs it contains.
+func loadTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("--tls-cert and --tls-key must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS key pair: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// serveNetwork serves the HTTP+SSE transport on httpAddr, the WebSocket
+// transport on wsAddr and the gRPC control API on grpcAddr, whichever are
+// set, until one of the listeners fails.
+func serveNetwork(server *MCPServer, httpAddr, wsAddr, grpcAddr string, tlsConfig *tls.Config) error {
+	transport := newHTTPTransport(server)
+	if transport.idleTimeout > 0 {
+		go transport.reapIdleSessions()
+	}
+
+	errs := make(chan error, 3)
+	if httpAddr != "" {
+		if server.config.WebUI {
+			fmt.Fprintf(os.Stderr, "Web UI served on /ui/ of %s\n", httpAddr)
+		}
+		go func() { errs <- listenAndServe(httpAddr, "http", "/sse", transport.handler(), tlsConfig) }()
+	}
+	if wsAddr != "" {
+		go func() { errs <- listenAndServe(wsAddr, "ws", "/ws", transport.wsHandler(), tlsConfig) }()
+	}
+	if grpcAddr != "" {
+		go func() { errs <- serveGRPC(server, grpcAddr, tlsConfig) }()
+	}
+	return <-errs
+}
+
+// listenAndServe serves handler on addr, announcing the URL clients connect
+// to. scheme is the cleartext one ("http" or "ws"), TLS appends an "s".
+func listenAndServe(addr, scheme, path string, handler http.Handler, tlsConfig *tls.Config) error {
+	httpServer := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	if tlsConfig != nil {
+		fmt.Fprintf(os.Stderr, "Listening on %ss://%s%s\n", scheme, addr, path)
+		return httpServer.ListenAndServeTLS("", "")
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s://%s%s\n", scheme, addr, path)
+	return httpServer.ListenAndServe()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// serveStdio serves the single stdio session until the client closes stdin.
+// Tool calls are handled concurrently, so that the client can answer the
+// requests of the server, such as confirmations, while a call waits on them.
+func serveStdio(server *MCPServer) error {
+	server.openSession(stdioSessionID, "stdio")
+	server.setNotifier(stdioSessionID, server.writeMessage)
+	// The client is gone: don't leave its captures running as orphans.
+	defer server.closeSession(stdioSessionID)
+
+	var calls sync.WaitGroup
+	defer func() {
+		// Calls waiting on the client, such as for a confirmation, would
+		// otherwise wait for it until they time out.
+		server.setNotifier(stdioSessionID, nil)
+		server.cancelPending(stdioSessionID)
+		calls.Wait()
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	const maxCapacity = 1024 * 1024
+	buf := make([]byte, maxCapacity)
+	scanner.Buffer(buf, maxCapacity)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req JSONRPCRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp := server.errorResponse(nil, -32700, "Parse error")
+			server.writeResponse(resp)
+			continue
+		}
+
+		if req.isResponse() {
+			server.handleClientResponse(stdioSessionID, req)
+			continue
+		}
+		if req.Method == "tools/call" {
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				server.writeResponse(server.handleRequest(stdioSessionID, req))
+			}()
+			continue
+		}
+
+		resp := server.handleRequest(stdioSessionID, req)
+		server.writeResponse(resp)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsWriteTimeout bounds how long a write to a WebSocket client may block.
+const wsWriteTimeout = 10 * time.Second
+
+// checkWSOrigin accepts the WebSocket handshakes of non-browser clients,
+// which send no Origin, of pages served by the listener itself, and of the
+// dashboards of ws_allowed_origins. Any other page a lab engineer opens
+// could otherwise drive the tools of the server from the browser.
+func (t *httpTransport) checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range t.server.config.WSAllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *httpTransport) wsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws", t.handleWS)
+	return mux
+}
+
+// handleWS serves a WebSocket session: every text message received is a
+// JSON-RPC request, handled concurrently, and responses are sent back as
+// they complete, through the same session queue the SSE stream uses.
+func (t *httpTransport) handleWS(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: t.checkWSOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error.
+		return
+	}
+	defer conn.Close()
+
+	session := t.connect("websocket")
+	defer t.disconnect(session)
+
+	closed := make(chan struct{})
+	go t.wsWriteLoop(conn, session, closed)
+	defer close(closed)
+
+	const maxCapacity = 1024 * 1024
+	conn.SetReadLimit(maxCapacity)
+	for {
+		msgType, body, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msgType != websocket.TextMessage || !t.touch(session) {
+			continue
+		}
+		go func() {
+			data, err := t.dispatch(session, body)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
+				return
+			}
+			if data == nil {
+				return
+			}
+			select {
+			case session.messages <- data:
+			case <-closed:
+			}
+		}()
+	}
+}
+
+// wsWriteLoop sends the queued messages of a session, and pings the client
+// when idle so connections to clients that vanished are detected.
+func (t *httpTransport) wsWriteLoop(conn *websocket.Conn, session *sseSession, closed chan struct{}) {
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case msg := <-session.messages:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = conn.WriteMessage(websocket.TextMessage, msg)
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		case <-closed:
+			return
+		}
+		if err != nil {
+			// Unblock the read loop.
+			conn.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trendMetrics are the metrics recorded by the trend sampler, with what the
+// router and target columns of their samples hold. sample_trends can record
+// other metrics measured by the caller (e.g. convergence_seconds).
+var trendMetrics = map[string]string{
+	"bgp_sessions_established": "established BGP sessions of the router, target 'all'",
+	"bgp_sessions_down":        "BGP sessions of the router not established, target 'all'",
+	"bgp_prefixes_received":    "prefixes received from a neighbor, target 'vrf/afi/neighbor'",
+	"route_count":              "routes of a route_watermarks target, e.g. 'VRF red' or 'VNI 100'",
+	"probe_rtt_ms":             "average ping RTT of a trend_probes entry, target the pinged address",
+	"probe_loss_pct":           "ping loss of a trend_probes entry, target the pinged address",
+}
+
+// trendBuckets are the aggregation periods of query_trends, as SQLite
+// expressions over sampled_at.
+var trendBuckets = map[string]string{
+	"hour": "substr(sampled_at, 1, 13)",
+	"day":  "substr(sampled_at, 1, 10)",
+	"week": "strftime('%Y-W%W', sampled_at)",
+}
+
+// trendChangeThreshold is the relative change between the first and last
+// bucket of a series reported as a trend by query_trends.
+const trendChangeThreshold = 0.2
+
+// TrendProbe is a ping from a router whose RTT is sampled over time.
+type TrendProbe struct {
+	Router string `json:"router"`
+	Target string `json:"target"`
+}
+
+var pingRTTRe = regexp.MustCompile(`= [\d.]+/([\d.]+)/`)
+var pingLossRe = regexp.MustCompile(`([\d.]+)% packet loss`)
+
+// probe pings the target from the router, returning the average RTT in
+// milliseconds and the loss percentage. The RTT is NaN when every ping was
+// lost.
+func (p *TrendProbe) probe() (rtt, loss float64, err error) {
+	// ping exits non-zero on loss, its summary is still meaningful.
+	out, _ := runInRouterNetns(p.Router, "ping", "-q", "-n", "-c", "5", "-i", "0.2", "-W", "1", p.Target)
+	m := pingLossRe.FindSubmatch(out)
+	if m == nil {
+		return 0, 0, fmt.Errorf("pinging %s from %s: %s", p.Target, p.Router, strings.TrimSpace(string(out)))
+	}
+	loss, _ = strconv.ParseFloat(string(m[1]), 64)
+	rtt = math.NaN()
+	if m := pingRTTRe.FindSubmatch(out); m != nil {
+		rtt, _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	return rtt, loss, nil
+}
+
+// trendSample is one value of a metric.
+type trendSample struct {
+	metric string
+	router string
+	target string
+	value  float64
+}
+
+// collectTrendSamples measures the trend metrics across the fabric. Failing
+// sources are reported and skipped.
+func collectTrendSamples(config *Config) ([]trendSample, []string) {
+	var samples []trendSample
+	var failures []string
+
+	routers, err := fabricRouters()
+	if err != nil {
+		failures = append(failures, err.Error())
+	}
+	for _, router := range routers {
+		sessions, err := bgpSessions(router)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("BGP sessions of %s: %v", router, err))
+			continue
+		}
+		var up, down int
+		for _, p := range sessions {
+			if p.State == "Established" {
+				up++
+			} else {
+				down++
+			}
+			samples = append(samples, trendSample{"bgp_prefixes_received", router, p.VRF + "/" + p.AFI + "/" + p.Neighbor, float64(p.PfxRcd)})
+		}
+		samples = append(samples,
+			trendSample{"bgp_sessions_established", router, "all", float64(up)},
+			trendSample{"bgp_sessions_down", router, "all", float64(down)})
+	}
+
+	for i := range config.RouteWatermarks {
+		w := &config.RouteWatermarks[i]
+		count, err := w.routeCount()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("route count of %s: %v", w, err))
+			continue
+		}
+		samples = append(samples, trendSample{"route_count", w.Router, w.target(), float64(count)})
+	}
+
+	for i := range config.TrendProbes {
+		p := &config.TrendProbes[i]
+		rtt, loss, err := p.probe()
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		samples = append(samples, trendSample{"probe_loss_pct", p.Router, p.Target, loss})
+		if !math.IsNaN(rtt) {
+			samples = append(samples, trendSample{"probe_rtt_ms", p.Router, p.Target, rtt})
+		}
+	}
+	return samples, failures
+}
+
+func storeTrendSamples(db *sql.DB, at time.Time, label string, samples []trendSample) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	sampledAt := at.UTC().Format(time.RFC3339)
+	for _, s := range samples {
+		if _, err := tx.Exec(`INSERT INTO trend_samples VALUES (?, ?, ?, ?, ?, ?)`,
+			sampledAt, label, s.metric, s.router, s.target, s.value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// startTrendSampler records the trend metrics every interval until the
+// process exits, dropping the samples older than the retention period.
+func startTrendSampler(config *Config) error {
+	db, err := openStateDB(config.StateDB)
+	if err != nil {
+		return err
+	}
+	interval, retention := config.TrendInterval.Duration, config.TrendRetention.Duration
+	fmt.Fprintf(os.Stderr, "Sampling trends every %s into %s\n", interval, config.StateDB)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			samples, failures := collectTrendSamples(config)
+			for _, f := range failures {
+				fmt.Fprintf(os.Stderr, "Trend sampling: %s\n", f)
+			}
+			if err := storeTrendSamples(db, now, "", samples); err != nil {
+				fmt.Fprintf(os.Stderr, "Storing trend samples: %v\n", err)
+			}
+			if retention > 0 {
+				cutoff := now.Add(-retention).UTC().Format(time.RFC3339)
+				if _, err := db.Exec(`DELETE FROM trend_samples WHERE sampled_at < ?`, cutoff); err != nil {
+					fmt.Fprintf(os.Stderr, "Pruning trend samples: %v\n", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *MCPServer) sampleTrends(args map[string]any) CallToolResult {
+	label, _ := args["label"].(string)
+
+	var extra []trendSample
+	if values, ok := args["values"].(map[string]any); ok {
+		for metric, v := range values {
+			value, ok := v.(float64)
+			if !ok {
+				return toolError(fmt.Sprintf("values.%s must be a number", metric))
+			}
+			extra = append(extra, trendSample{metric, "", "all", value})
+		}
+	}
+
+	db, err := openStateDB(s.config.StateDB)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error opening state database: %v", err))
+	}
+	defer db.Close()
+
+	samples, failures := collectTrendSamples(s.config)
+	samples = append(samples, extra...)
+	if err := storeTrendSamples(db, time.Now(), label, samples); err != nil {
+		return toolError(fmt.Sprintf("Error storing trend samples: %v", err))
+	}
+
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		counts[sample.metric]++
+	}
+	metrics := make([]string, 0, len(counts))
+	for m := range counts {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recorded %d trend sample(s) to %s", len(samples), s.config.StateDB)
+	if label != "" {
+		fmt.Fprintf(&b, " (label %q)", label)
+	}
+	b.WriteString(":\n")
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "- %s: %d\n", m, counts[m])
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\n%d source(s) could not be sampled:\n", len(failures))
+		for _, f := range failures {
+			fmt.Fprintf(&b, "- %s\n", f)
+		}
+	}
+	return CallToolResult{Content: []ContentItem{summaryContent(b.String())}}
+}
+
+func (s *MCPServer) queryTrends(args map[string]any) CallToolResult {
+	metric, _ := args["metric"].(string)
+	if metric == "" {
+		return toolError("metric is required")
+	}
+	router, _ := args["router"].(string)
+	target, _ := args["target"].(string)
+	label, _ := args["label"].(string)
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	bucket := "day"
+	if v, ok := args["bucket"].(string); ok && v != "" {
+		bucket = v
+	}
+	bucketExpr, ok := trendBuckets[bucket]
+	if !ok {
+		return toolError(fmt.Sprintf("unknown bucket %q, expected hour, day or week", bucket))
+	}
+
+	now := time.Now()
+	since := now.Add(-30 * 24 * time.Hour)
+	if v, ok := args["since"].(string); ok && v != "" {
+		if since, err = parseTimeArg(v, now); err != nil {
+			return toolError(err.Error())
+		}
+	}
+
+	db, err := sql.Open("sqlite", "file:"+s.config.StateDB+"?mode=ro&_pragma=query_only(1)")
+	if err != nil {
+		return toolError(fmt.Sprintf("Error opening state database: %v", err))
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT `+bucketExpr+` AS bucket, router, target, COUNT(*), MIN(value), AVG(value), MAX(value)
+		FROM trend_samples
+		WHERE metric = ? AND sampled_at >= ?
+			AND (? = '' OR router = ?) AND (? = '' OR instr(target, ?) > 0) AND (? = '' OR label = ?)
+		GROUP BY bucket, router, target
+		ORDER BY router, target, bucket`,
+		metric, since.UTC().Format(time.RFC3339), router, router, target, target, label, label)
+	if err != nil {
+		return toolError(fmt.Sprintf("Error querying trend samples: %v", err))
+	}
+	defer rows.Close()
+
+	type series struct {
+		name        string
+		first, last float64
+		firstBucket string
+		lastBucket  string
+	}
+	var all []*series
+	buckets := newTable("buckets", "bucket", "router", "target", "samples", "min", "avg", "max")
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s per %s since %s\n", metric, bucket, since.UTC().Format(time.RFC3339))
+	for rows.Next() {
+		var period, r, t string
+		var n int
+		var lo, avg, hi float64
+		if err := rows.Scan(&period, &r, &t, &n, &lo, &avg, &hi); err != nil {
+			return toolError(fmt.Sprintf("Error reading trend samples: %v", err))
+		}
+		avg = math.Round(avg*1000) / 1000
+		buckets.add(period, r, t, n, lo, avg, hi)
+
+		name := t
+		if r != "" {
+			name = r + " " + t
+		}
+		if len(all) == 0 || all[len(all)-1].name != name {
+			all = append(all, &series{name: name, first: avg, firstBucket: period})
+			fmt.Fprintf(&b, "\n%s:\n", name)
+		}
+		cur := all[len(all)-1]
+		cur.last, cur.lastBucket = avg, period
+		fmt.Fprintf(&b, "  %s  avg %-10g min %-10g max %-10g (%d samples)\n", period, avg, lo, hi, n)
+	}
+	if err := rows.Err(); err != nil {
+		return toolError(fmt.Sprintf("Error reading trend samples: %v", err))
+	}
+	if len(all) == 0 {
+		b.WriteString("\nNo samples recorded for this metric and window. Sampled metrics:\n")
+		names := make([]string, 0, len(trendMetrics))
+		for m := range trendMetrics {
+			names = append(names, m)
+		}
+		sort.Strings(names)
+		for _, m := range names {
+			fmt.Fprintf(&b, "  - %s: %s\n", m, trendMetrics[m])
+		}
+	}
+
+	var trends []string
+	for _, sr := range all {
+		if sr.firstBucket == sr.lastBucket || sr.first == 0 {
+			continue
+		}
+		change := (sr.last - sr.first) / math.Abs(sr.first)
+		if math.Abs(change) >= trendChangeThreshold {
+			trends = append(trends, fmt.Sprintf("%s: %g (%s) -> %g (%s), %+.0f%%",
+				sr.name, sr.first, sr.firstBucket, sr.last, sr.lastBucket, 100*change))
+		}
+	}
+	if len(trends) > 0 {
+		fmt.Fprintf(&b, "\nChanged by %.0f%% or more over the window:\n", 100*trendChangeThreshold)
+		for _, t := range trends {
+			fmt.Fprintf(&b, "  - %s\n", t)
+		}
+	}
+
+	var fields record
+	fields.add("metric", metric)
+	fields.add("bucket", bucket)
+	fields.add("since", since.UTC().Format(time.RFC3339))
+	fields.add("trends", trends)
+	return formattedResult(format, b.String(), false, fields, buckets)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// frrVRFRe matches the VRFs of 'show vrf', e.g. "vrf red id 6 table 1100"
+// or "vrf blue inactive".
+var frrVRFRe = regexp.MustCompile(`^vrf (\S+)(?: id (\d+))?(?: table (\d+))?`)
+
+// vrfInfo is a VRF of a router, as FRR and the kernel know it.
+type vrfInfo struct {
+	name        string
+	inFRR       bool
+	inKernel    bool
+	frrInactive bool
+	frrTable    int
+	kernelTable int
+	l3vni       uint32
+	vxlan       string
+	svi         string
+	state       string
+	routerMAC   string
+	members     []string
+}
+
+// routerVRFs returns the VRFs of a router, merged from 'show vrf', 'show vrf
+// vni json' and 'ip -j vrf show', with the interfaces enslaved to them.
+func routerVRFs(router string) ([]*vrfInfo, error) {
+	byName := make(map[string]*vrfInfo)
+	get := func(name string) *vrfInfo {
+		v, ok := byName[name]
+		if !ok {
+			v = &vrfInfo{name: name}
+			byName[name] = v
+		}
+		return v
+	}
+
+	out, err := runVtysh(router, "show vrf")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		m := frrVRFRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		v := get(m[1])
+		v.inFRR = true
+		v.frrInactive = strings.Contains(line, "inactive")
+		v.frrTable, _ = strconv.Atoi(m[3])
+	}
+
+	if l3vnis, err := frrClient(router).VRFVNIs(); err == nil {
+		for _, l3 := range l3vnis {
+			if l3.VNI == 0 {
+				continue
+			}
+			v := get(l3.VRF)
+			v.l3vni, v.vxlan, v.svi, v.state, v.routerMAC = l3.VNI, l3.VxlanIntf, l3.SVIIntf, l3.State, l3.RouterMAC
+		}
+	}
+
+	out, err = runInRouterNetns(router, "ip", "-j", "vrf", "show")
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(out))) > 0 {
+		var kernel []struct {
+			Name  string `json:"name"`
+			Table int    `json:"table"`
+		}
+		if err := json.Unmarshal(out, &kernel); err != nil {
+			return nil, fmt.Errorf("parsing VRFs of %s: %w", router, err)
+		}
+		for _, k := range kernel {
+			v := get(k.Name)
+			v.inKernel = true
+			v.kernelTable = k.Table
+		}
+	}
+
+	links, err := routerLinks(router)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		if v, ok := byName[l.Master]; ok {
+			v.members = append(v.members, l.Ifname)
+		}
+	}
+
+	vrfs := make([]*vrfInfo, 0, len(byName))
+	for _, v := range byName {
+		sort.Strings(v.members)
+		vrfs = append(vrfs, v)
+	}
+	sort.Slice(vrfs, func(i, j int) bool { return vrfs[i].name < vrfs[j].name })
+	return vrfs, nil
+}
+
+// problems returns what is inconsistent about a VRF between FRR and the
+// kernel.
+func (v *vrfInfo) problems() []string {
+	var problems []string
+	switch {
+	case v.inFRR && !v.inKernel:
+		problems = append(problems, "configured in FRR but missing from the kernel")
+	case v.inKernel && !v.inFRR:
+		problems = append(problems, "exists in the kernel but FRR does not know it")
+	case v.frrInactive:
+		problems = append(problems, "inactive in FRR")
+	case v.frrTable != 0 && v.frrTable != v.kernelTable:
+		problems = append(problems, fmt.Sprintf("FRR uses table %d, the kernel %d", v.frrTable, v.kernelTable))
+	}
+	if v.l3vni != 0 && v.state != "" && v.state != "Up" {
+		problems = append(problems, fmt.Sprintf("L3VNI %d is %s", v.l3vni, v.state))
+	}
+	return problems
+}
+
+func (s *MCPServer) listVRFs(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	glob, _ := args["router"].(string)
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return toolError(fmt.Sprintf("invalid router glob %q", glob))
+	}
+
+	all, err := fabricRouters()
+	if err != nil {
+		return toolError(err.Error())
+	}
+	routers := matchRouters(all, glob)
+	if len(routers) == 0 {
+		return toolError(fmt.Sprintf("no router matches %q", glob))
+	}
+
+	var b strings.Builder
+	table := newTable("vrfs", "router", "vrf", "in_frr", "in_kernel", "table", "l3vni", "vxlan_interface", "svi", "state", "router_mac", "members", "problems")
+	var findings []string
+	total, failed := 0, 0
+	for _, router := range routers {
+		vrfs, err := routerVRFs(router)
+		if err != nil {
+			fmt.Fprintf(&b, "✗ %s: %v\n", router, err)
+			failed++
+			continue
+		}
+		var lines []string
+		for _, v := range vrfs {
+			total++
+			problems := v.problems()
+			for _, p := range problems {
+				findings = append(findings, fmt.Sprintf("%s: vrf %s %s", router, v.name, p))
+			}
+			tableID := v.kernelTable
+			if tableID == 0 {
+				tableID = v.frrTable
+			}
+			table.add(router, v.name, v.inFRR, v.inKernel, tableID, v.l3vni, v.vxlan, v.svi, v.state, v.routerMAC, v.members, problems)
+
+			mark := "✓"
+			if len(problems) > 0 {
+				mark = "✗"
+			}
+			line := fmt.Sprintf("  %s %-14s table %-6d", mark, v.name, tableID)
+			if v.l3vni != 0 {
+				line += fmt.Sprintf(" L3VNI %d %s", v.l3vni, v.state)
+				if v.vxlan != "" || v.svi != "" {
+					line += fmt.Sprintf(" (%s/%s)", v.vxlan, v.svi)
+				}
+			}
+			if len(v.members) > 0 {
+				line += ", members " + strings.Join(v.members, ", ")
+			}
+			if len(problems) > 0 {
+				line += " ⚠ " + strings.Join(problems, "; ")
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "  no VRF")
+		}
+		fmt.Fprintf(&b, "\n=== %s ===\n%s\n", router, strings.Join(lines, "\n"))
+	}
+
+	summary := fmt.Sprintf("%d VRF(s) on %d router(s)", total, len(routers)-failed)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d router(s) could not be queried", failed)
+	}
+	text := summary + "\n" + b.String()
+	if len(findings) > 0 {
+		text += "\nFindings:\n"
+		for _, f := range findings {
+			text += "  ⚠ " + f + "\n"
+		}
+	} else if total > 0 {
+		text += "\n✓ FRR and the kernel agree on every VRF\n"
+	}
+
+	var fields record
+	fields.add("routers", len(routers)-failed)
+	fields.add("unreachable_routers", failed)
+	fields.add("vrf_count", total)
+	fields.add("findings", findings)
+	return formattedResult(format, text, failed == len(routers), fields, table)
+}
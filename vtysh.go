@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxVtyshOutput bounds the output run_vtysh returns, as some show commands
+// dump whole tables.
+const maxVtyshOutput = 256 << 10
+
+// vtyshAllowed tells whether a command starts with one of the allowed
+// prefixes. They are compared word by word, so "show" does not allow
+// "showrun"; abbreviated keywords are therefore refused too.
+func vtyshAllowed(allowlist []string, command string) bool {
+	words := strings.Fields(command)
+	for _, prefix := range allowlist {
+		allowed := strings.Fields(prefix)
+		if len(allowed) == 0 || len(allowed) > len(words) {
+			continue
+		}
+		match := true
+		for i, w := range allowed {
+			if !strings.EqualFold(w, words[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// vtyshShowOnly tells whether an allowlist only lets show commands through.
+func vtyshShowOnly(allowlist []string) bool {
+	for _, prefix := range allowlist {
+		if words := strings.Fields(prefix); len(words) == 0 || !strings.EqualFold(words[0], "show") {
+			return false
+		}
+	}
+	return true
+}
+
+// tools returns the tool definitions, with run_vtysh annotated as
+// destructive when vtysh_allowlist lets other commands than show through.
+func (s *MCPServer) tools() []Tool {
+	tools := toolDefinitions()
+	if vtyshShowOnly(s.config.VtyshAllowlist) {
+		return tools
+	}
+	for i := range tools {
+		if tools[i].Name == "run_vtysh" {
+			tools[i].Annotations = destructiveTool(tools[i].Annotations.Title)
+		}
+	}
+	return tools
+}
+
+func (s *MCPServer) runVtyshTool(args map[string]any) CallToolResult {
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	router, _ := args["router"].(string)
+	if router == "" {
+		return toolError("router is required")
+	}
+	command, _ := args["command"].(string)
+	// vtysh runs every line of -c as a command, and pipes the output to
+	// the shell after a '|'.
+	if strings.ContainsAny(command, "\r\n|") {
+		return toolError("command must be a single line, without '|' output filters")
+	}
+	command = strings.Join(strings.Fields(command), " ")
+	if command == "" {
+		return toolError("command is required")
+	}
+	allowlist := s.config.VtyshAllowlist
+	if len(allowlist) == 0 {
+		return toolError("run_vtysh is disabled: vtysh_allowlist is empty in the config file")
+	}
+	if !vtyshAllowed(allowlist, command) {
+		quoted := make([]string, len(allowlist))
+		for i, p := range allowlist {
+			quoted[i] = fmt.Sprintf("%q", p)
+		}
+		allowed := quoted[0]
+		if len(quoted) > 1 {
+			allowed = "one of " + strings.Join(quoted, ", ")
+		}
+		return toolError(fmt.Sprintf("command %q is not allowed: it must start with %s (vtysh_allowlist)", command, allowed))
+	}
+
+	out, err := runVtysh(router, command)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	truncated := len(out) > maxVtyshOutput
+	if truncated {
+		out = out[:maxVtyshOutput]
+	}
+
+	text := strings.TrimRight(string(out), "\n")
+	if text == "" {
+		text = "(no output)"
+	}
+	if truncated {
+		text += fmt.Sprintf("\n\n(output truncated to %d KiB)", maxVtyshOutput>>10)
+	}
+
+	var fields record
+	fields.add("router", routerContainer(router))
+	fields.add("command", command)
+	fields.add("truncated", truncated)
+	// JSON output is embedded as a document rather than as a string.
+	var doc any
+	if truncated || !strings.HasSuffix(command, " json") || json.Unmarshal(out, &doc) != nil {
+		doc = string(out)
+	}
+	fields.add("output", doc)
+	return formattedResult(format, text, false, fields)
+}
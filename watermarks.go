@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RouteWatermark is the expected range of routes for a VRF or an EVPN VNI on
+// a router. Counts outside of it usually mean a mass withdrawal or a leak,
+// even when every individual session still looks healthy.
+type RouteWatermark struct {
+	Router string `json:"router"`
+	VRF    string `json:"vrf,omitempty"`
+	VNI    int    `json:"vni,omitempty"`
+	// AFI selects the VRF address family, "ipv4" (default) or "ipv6".
+	AFI string `json:"afi,omitempty"`
+	Min int    `json:"min"`
+	// Max is the upper bound, zero meaning unbounded.
+	Max int `json:"max,omitempty"`
+}
+
+// target names the VRF or VNI whose routes are counted.
+func (w *RouteWatermark) target() string {
+	target := "VRF " + w.VRF
+	if w.VNI != 0 {
+		target = fmt.Sprintf("VNI %d", w.VNI)
+	} else if w.AFI == "ipv6" {
+		target += " (ipv6)"
+	}
+	return target
+}
+
+func (w *RouteWatermark) String() string {
+	return fmt.Sprintf("%s %s", w.Router, w.target())
+}
+
+func (w *RouteWatermark) bounds() string {
+	if w.Max == 0 {
+		return fmt.Sprintf(">= %d", w.Min)
+	}
+	return fmt.Sprintf("%d-%d", w.Min, w.Max)
+}
+
+// routeCount returns the number of routes the watermark applies to: the RIB
+// size of the VRF, or the number of EVPN prefixes of the VNI.
+func (w *RouteWatermark) routeCount() (int, error) {
+	client := frrClient(w.Router)
+	if w.VNI != 0 {
+		return client.VNIPrefixCount(uint32(w.VNI))
+	}
+
+	family := "ip"
+	if w.AFI == "ipv6" {
+		family = "ipv6"
+	}
+	summary, err := client.RouteSummary(family, w.VRF)
+	if err != nil {
+		return 0, err
+	}
+	return summary.RoutesTotal, nil
+}
+
+func (s *MCPServer) checkRouteWatermarks(args map[string]any) CallToolResult {
+	router, _ := args["router"].(string)
+	format, err := formatArg(args)
+	if err != nil {
+		return toolError(err.Error())
+	}
+
+	if len(s.config.RouteWatermarks) == 0 {
+		return toolError("No route watermarks configured. Add a route_watermarks section to the config file.")
+	}
+
+	var b strings.Builder
+	var alerts, checked int
+	watermarks := newTable("watermarks", "router", "target", "count", "min", "max", "status", "error")
+	for i := range s.config.RouteWatermarks {
+		w := &s.config.RouteWatermarks[i]
+		if router != "" && w.Router != router {
+			continue
+		}
+		checked++
+
+		target := w.target()
+		count, err := w.routeCount()
+		switch {
+		case err != nil:
+			alerts++
+			fmt.Fprintf(&b, "✗ %s: could not count routes: %v\n", w, err)
+			watermarks.add(w.Router, target, nil, w.Min, w.Max, "error", err.Error())
+		case count < w.Min:
+			alerts++
+			fmt.Fprintf(&b, "✗ ALERT %s: %d routes, below the watermark (%s) - possible mass withdrawal\n", w, count, w.bounds())
+			watermarks.add(w.Router, target, count, w.Min, w.Max, "below", "")
+		case w.Max > 0 && count > w.Max:
+			alerts++
+			fmt.Fprintf(&b, "✗ ALERT %s: %d routes, above the watermark (%s) - possible route leak\n", w, count, w.bounds())
+			watermarks.add(w.Router, target, count, w.Min, w.Max, "above", "")
+		default:
+			fmt.Fprintf(&b, "✓ %s: %d routes (expected %s)\n", w, count, w.bounds())
+			watermarks.add(w.Router, target, count, w.Min, w.Max, "ok", "")
+		}
+	}
+
+	if checked == 0 {
+		return toolError(fmt.Sprintf("No route watermarks configured for router %s", router))
+	}
+	fmt.Fprintf(&b, "\n%d of %d watermark(s) in alert\n", alerts, checked)
+	if alerts > 0 {
+		fmt.Fprintf(os.Stderr, "Route watermark check: %d alert(s)\n", alerts)
+	}
+
+	var fields record
+	fields.add("checked", checked)
+	fields.add("alerts", alerts)
+	return formattedResult(format, b.String(), alerts > 0, fields, watermarks)
+}
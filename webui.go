@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed ui/index.html
+var webUITemplate string
+
+var webUIPage = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"size": formatSize,
+	"ago": func(t time.Time) string {
+		return time.Since(t).Truncate(time.Second).String()
+	},
+}).Parse(webUITemplate))
+
+// artifactPatterns are the directories, relative to the working directory,
+// the tools write their results to. The web UI lists and serves only these.
+var artifactPatterns = []string{
+	filepath.Join("captures", "*", "capture_*"),
+	configSnapshotPattern,
+	frrChangesPattern,
+	"node_logs_*",
+}
+
+// webUIMaxHistory bounds the snapshots shown in the health history.
+const webUIMaxHistory = 20
+
+type uiSession struct {
+	Label     string
+	Transport string
+	Opened    time.Time
+	Captures  int
+}
+
+type uiFile struct {
+	Path string
+	Size int64
+	// Served is false for the files of the captures of open sessions.
+	Served bool
+}
+
+type uiCapture struct {
+	CaptureID string
+	Session   string
+	Filter    string
+	Started   time.Time
+	OutputDir string
+}
+
+type uiArtifact struct {
+	Dir     string
+	Session string
+	// Open is set when the session the capture belongs to is still open.
+	Open     bool
+	Modified time.Time
+	Files    []uiFile
+	Size     int64
+}
+
+type uiSnapshot struct {
+	ID           int64
+	TakenAt      string
+	Label        string
+	SessionsDown int
+	Errors       int
+	Routes       int
+}
+
+type uiTrend struct {
+	SampledAt string
+	Metric    string
+	Router    string
+	Target    string
+	Value     float64
+}
+
+type uiPage struct {
+	Generated time.Time
+	Sessions  []uiSession
+	Captures  []uiCapture
+	Artifacts []uiArtifact
+	Snapshots []uiSnapshot
+	Trends    []uiTrend
+	// StateError explains why the health history is missing.
+	StateError string
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// sessionLabel identifies a session on the web UI. The ID of an HTTP
+// session is the only credential its requests carry, so the page, which
+// anyone reaching the listener can read, shows a digest of it instead.
+func sessionLabel(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:4])
+}
+
+// hideSession replaces the ID of a session by its label in a path.
+func hideSession(p, sessionID string) string {
+	return strings.ReplaceAll(p, sessionID, sessionLabel(sessionID))
+}
+
+// sessionList returns the open sessions, oldest first.
+func (s *MCPServer) sessionList() []uiSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.sessions[ids[i]].Opened.Before(s.sessions[ids[j]].Opened) })
+	sessions := make([]uiSession, len(ids))
+	for i, id := range ids {
+		info := s.sessions[id]
+		sessions[i] = uiSession{Label: sessionLabel(id), Transport: info.Transport, Opened: info.Opened}
+		for _, call := range s.activeCalls {
+			if call.SessionID == id && call.Run != nil {
+				sessions[i].Captures++
+			}
+		}
+	}
+	return sessions
+}
+
+// captureList returns the running captures, their sessions hidden.
+func (s *MCPServer) captureList() []uiCapture {
+	var captures []uiCapture
+	for _, call := range s.sessionCaptures("") {
+		captures = append(captures, uiCapture{
+			CaptureID: call.CaptureID,
+			Session:   sessionLabel(call.SessionID),
+			Filter:    call.Filter,
+			Started:   call.Started,
+			OutputDir: hideSession(call.OutputDir, call.SessionID),
+		})
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].CaptureID < captures[j].CaptureID })
+	return captures
+}
+
+// sessionOpen reports whether a session is open.
+func (s *MCPServer) sessionOpen(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[sessionID]
+	return ok
+}
+
+// artifactSession returns the session a capture artifact path belongs to,
+// empty for the other artifacts.
+func artifactSession(p string) string {
+	parts := strings.Split(p, "/")
+	if len(parts) < 2 || parts[0] != "captures" {
+		return ""
+	}
+	return parts[1]
+}
+
+// listArtifacts returns the result directories of the tools, newest first.
+func listArtifacts() []uiArtifact {
+	var artifacts []uiArtifact
+	for _, pattern := range artifactPatterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, dir := range matches {
+			info, err := os.Stat(dir)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			a := uiArtifact{Dir: filepath.ToSlash(dir), Session: artifactSession(filepath.ToSlash(dir)), Modified: info.ModTime()}
+			filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return nil
+				}
+				if fi, err := d.Info(); err == nil {
+					a.Files = append(a.Files, uiFile{Path: filepath.ToSlash(p), Size: fi.Size(), Served: true})
+					a.Size += fi.Size()
+				}
+				return nil
+			})
+			artifacts = append(artifacts, a)
+		}
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Modified.After(artifacts[j].Modified) })
+	return artifacts
+}
+
+// healthHistory reads the latest snapshots and trend samples from the state
+// database.
+func healthHistory(dbPath string) ([]uiSnapshot, []uiTrend, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, nil, fmt.Errorf("no state database at %s yet, run snapshot_state or sample_trends", dbPath)
+	}
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=query_only(1)")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT s.id, s.taken_at, COALESCE(s.label, ''),
+			(SELECT COUNT(*) FROM bgp_sessions b WHERE b.snapshot_id = s.id AND b.state != 'Established'),
+			(SELECT COUNT(*) FROM collection_errors e WHERE e.snapshot_id = s.id),
+			(SELECT COUNT(*) FROM routes r WHERE r.snapshot_id = s.id)
+		FROM snapshots s ORDER BY s.id DESC LIMIT ?`, webUIMaxHistory)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var snapshots []uiSnapshot
+	for rows.Next() {
+		var sn uiSnapshot
+		if err := rows.Scan(&sn.ID, &sn.TakenAt, &sn.Label, &sn.SessionsDown, &sn.Errors, &sn.Routes); err != nil {
+			return nil, nil, err
+		}
+		snapshots = append(snapshots, sn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Only the most recent value of every series.
+	rows, err = db.Query(`SELECT t.sampled_at, t.metric, t.router, t.target, t.value
+		FROM trend_samples t
+		JOIN (SELECT metric, router, target, MAX(sampled_at) AS latest FROM trend_samples GROUP BY metric, router, target) l
+			ON t.metric = l.metric AND t.router = l.router AND t.target = l.target AND t.sampled_at = l.latest
+		ORDER BY t.metric, t.router, t.target`)
+	if err != nil {
+		return snapshots, nil, err
+	}
+	defer rows.Close()
+	var trends []uiTrend
+	for rows.Next() {
+		var t uiTrend
+		if err := rows.Scan(&t.SampledAt, &t.Metric, &t.Router, &t.Target, &t.Value); err != nil {
+			return snapshots, nil, err
+		}
+		trends = append(trends, t)
+	}
+	return snapshots, trends, rows.Err()
+}
+
+// webUIHandler serves a read-only overview of the server for teammates
+// without an MCP client: sessions, running captures, the artifacts written
+// by the tools and the health history of the state database.
+func (s *MCPServer) webUIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ui/{$}", func(w http.ResponseWriter, r *http.Request) {
+		page := uiPage{
+			Generated: time.Now(),
+			Sessions:  s.sessionList(),
+			Captures:  s.captureList(),
+			Artifacts: listArtifacts(),
+		}
+		for i := range page.Artifacts {
+			a := &page.Artifacts[i]
+			var files []uiFile
+			for _, f := range a.Files {
+				// The files demo mode does not serve are not listed.
+				if s.demo != nil && rawArtifact(f.Path) {
+					continue
+				}
+				files = append(files, f)
+			}
+			a.Files = files
+			if a.Session == "" {
+				continue
+			}
+			// The captures of an open session are served to it alone, as
+			// its resources; the web UI neither links nor names them. The
+			// ID of a closed session grants nothing anymore.
+			if a.Open = s.sessionOpen(a.Session); a.Open {
+				for j := range a.Files {
+					a.Files[j].Path = hideSession(a.Files[j].Path, a.Session)
+					a.Files[j].Served = false
+				}
+			}
+			a.Dir = hideSession(a.Dir, a.Session)
+			a.Session = sessionLabel(a.Session)
+		}
+		var err error
+		if page.Snapshots, page.Trends, err = healthHistory(s.config.StateDB); err != nil {
+			page.StateError = err.Error()
+		}
+		var b bytes.Buffer
+		if err := webUIPage.Execute(&b, page); err != nil {
+			fmt.Fprintf(os.Stderr, "Rendering web UI: %v\n", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		html := b.String()
+		if s.demo != nil {
+			html = s.demo.text(html)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, html)
+	})
+	mux.HandleFunc("GET /ui/files/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean(r.PathValue("path"))
+		if s.demo != nil {
+			p = s.demo.restore(p)
+		}
+		if !isArtifactPath(p) || (s.demo != nil && rawArtifact(p)) || s.sessionOpen(artifactSession(p)) {
+			http.NotFound(w, r)
+			return
+		}
+		info, err := os.Stat(filepath.FromSlash(p))
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(p, ".pcapng") {
+			w.Header().Set("Content-Type", captureMimeType)
+		} else if s.demo != nil {
+			// Text artifacts are rewritten as they are served.
+			data, err := os.ReadFile(filepath.FromSlash(p))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, s.demo.text(string(data)))
+			return
+		}
+		http.ServeFile(w, r, filepath.FromSlash(p))
+	})
+	return mux
+}
+
+// isArtifactPath reports whether a slash-separated relative path lies in one
+// of the artifact directories.
+func isArtifactPath(p string) bool {
+	if p == "." || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "../") || p == ".." {
+		return false
+	}
+	parts := strings.Split(p, "/")
+	for _, pattern := range artifactPatterns {
+		depth := len(strings.Split(filepath.ToSlash(pattern), "/"))
+		if len(parts) <= depth {
+			continue
+		}
+		if ok, _ := path.Match(filepath.ToSlash(pattern), strings.Join(parts[:depth], "/")); ok {
+			return true
+		}
+	}
+	return false
+}